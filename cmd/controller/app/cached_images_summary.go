@@ -0,0 +1,154 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// cachedImagesSummaryKey is the key of the summary ConfigMap holding the number of nodes each image is cached on
+	cachedImagesSummaryKey = "images.json"
+	// cachedImagesNodeIndexKey is the key of the summary ConfigMap holding the images cached on each node
+	cachedImagesNodeIndexKey = "nodes.json"
+	// cachedImagesSummaryPeriod is how often the summary ConfigMap is brought up to date, in addition to
+	// after each reconcile, so that it catches up with the status writes of the last reconciles
+	cachedImagesSummaryPeriod = 30 * time.Second
+)
+
+// cachedImagesSummary counts, for every image cached by the image caches, the nodes on which at least one
+// image cache reports it as cached
+func cachedImagesSummary(imageCaches []*v1alpha3.ImageCache) map[string]int {
+	nodes := map[string]map[string]bool{}
+	for _, imageCache := range imageCaches {
+		for _, ns := range imageCache.Status.Nodes {
+			for _, image := range ns.Images {
+				if image.State != v1alpha3.NodeImageStateCached {
+					continue
+				}
+				if nodes[image.Image] == nil {
+					nodes[image.Image] = map[string]bool{}
+				}
+				nodes[image.Image][ns.Node] = true
+			}
+		}
+	}
+	summary := map[string]int{}
+	for image, n := range nodes {
+		summary[image] = len(n)
+	}
+	return summary
+}
+
+// cachedImagesNodeIndex lists, for every node, the sorted images that at least one image cache reports as
+// cached on it, so that e.g. a scheduler plugin can tell whether a node is warm for the images of a pod
+func cachedImagesNodeIndex(imageCaches []*v1alpha3.ImageCache) map[string][]string {
+	cached := map[string]map[string]bool{}
+	for _, imageCache := range imageCaches {
+		for _, ns := range imageCache.Status.Nodes {
+			for _, image := range ns.Images {
+				if image.State != v1alpha3.NodeImageStateCached {
+					continue
+				}
+				if cached[ns.Node] == nil {
+					cached[ns.Node] = map[string]bool{}
+				}
+				cached[ns.Node][image.Image] = true
+			}
+		}
+	}
+	index := map[string][]string{}
+	for node, imgs := range cached {
+		for image := range imgs {
+			index[node] = append(index[node], image)
+		}
+		sort.Strings(index[node])
+	}
+	return index
+}
+
+// runCachedImagesSummaryWorker brings the summary ConfigMap up to date
+func (c *Controller) runCachedImagesSummaryWorker() {
+	if err := c.updateCachedImagesSummary(); err != nil {
+		klog.Errorf("Error updating cached images summary configmap %s: %v", c.cachedImagesConfigMap, err)
+	}
+}
+
+// updateCachedImagesSummary writes the images cached by all the image caches, with the number of nodes
+// each is cached on, and the images cached on each node to the summary ConfigMap in the namespace of the
+// controller. The ConfigMap is created if missing, and written only when the summary changes.
+func (c *Controller) updateCachedImagesSummary() error {
+	if c.cachedImagesConfigMap == "" {
+		return nil
+	}
+	c.cachedImagesSummaryLock.Lock()
+	defer c.cachedImagesSummaryLock.Unlock()
+	imageCaches, err := c.listImageCaches()
+	if err != nil {
+		return err
+	}
+	summary, err := json.MarshalIndent(cachedImagesSummary(imageCaches), "", "  ")
+	if err != nil {
+		return err
+	}
+	index, err := json.MarshalIndent(cachedImagesNodeIndex(imageCaches), "", "  ")
+	if err != nil {
+		return err
+	}
+	data := map[string]string{cachedImagesSummaryKey: string(summary), cachedImagesNodeIndexKey: string(index)}
+	if reflect.DeepEqual(data, c.lastCachedImagesSummary) {
+		return nil
+	}
+	configMaps := c.kubeclientset.CoreV1().ConfigMaps(c.fledgedNameSpace)
+	configMap, err := configMaps.Get(context.TODO(), c.cachedImagesConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.cachedImagesConfigMap, Namespace: c.fledgedNameSpace},
+			Data:       data,
+		}
+		if _, err = configMaps.Create(context.TODO(), configMap, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if configMap.Data[cachedImagesSummaryKey] != data[cachedImagesSummaryKey] ||
+		configMap.Data[cachedImagesNodeIndexKey] != data[cachedImagesNodeIndexKey] {
+		configMap = configMap.DeepCopy()
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		for k, v := range data {
+			configMap.Data[k] = v
+		}
+		if _, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	klog.V(4).Infof("Cached images summary configmap %s updated", c.cachedImagesConfigMap)
+	c.lastCachedImagesSummary = data
+	return nil
+}
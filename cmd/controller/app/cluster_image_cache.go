@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// A ClusterImageCache is reconciled as an ImageCache in the cluster image cache namespace, in which
+// its jobs are created. Its key in the workqueue has no namespace, which tells it apart from the keys
+// of the ImageCaches.
+
+// imageCacheFromCluster converts a ClusterImageCache received from the informer to an ImageCache
+func (c *Controller) imageCacheFromCluster(obj interface{}) *v1alpha3.ImageCache {
+	clusterImageCache, ok := obj.(*v1alpha3.ClusterImageCache)
+	if !ok {
+		return nil
+	}
+	return v1alpha3.ImageCacheFromCluster(clusterImageCache, c.clusterImageCacheNamespace)
+}
+
+// getImageCache gets the image cache of the namespace and name from the informer cache. An empty
+// namespace gets the ClusterImageCache of the name.
+func (c *Controller) getImageCache(namespace, name string) (*v1alpha3.ImageCache, error) {
+	if namespace == "" {
+		clusterImageCache, err := c.clusterImageCachesLister.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return v1alpha3.ImageCacheFromCluster(clusterImageCache, c.clusterImageCacheNamespace), nil
+	}
+	return c.imageCachesLister.ImageCaches(namespace).Get(name)
+}
+
+// fetchImageCache gets the image cache of the namespace and name from the api server. An empty
+// namespace gets the ClusterImageCache of the name.
+func (c *Controller) fetchImageCache(namespace, name string) (*v1alpha3.ImageCache, error) {
+	if namespace == "" {
+		clusterImageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ClusterImageCaches().Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return v1alpha3.ImageCacheFromCluster(clusterImageCache, c.clusterImageCacheNamespace), nil
+	}
+	return c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// latestImageCache gets the latest version of the ImageCache, or of the ClusterImageCache it reconciles,
+// from the api server
+func (c *Controller) latestImageCache(imageCache *v1alpha3.ImageCache) (*v1alpha3.ImageCache, error) {
+	if v1alpha3.IsClusterImageCache(imageCache) {
+		return c.fetchImageCache("", imageCache.Name)
+	}
+	return c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Get(context.TODO(), imageCache.Name, metav1.GetOptions{})
+}
+
+// updateImageCache updates the ImageCache, or the ClusterImageCache it reconciles
+func (c *Controller) updateImageCache(imageCache *v1alpha3.ImageCache) error {
+	if v1alpha3.IsClusterImageCache(imageCache) {
+		_, err := c.kubefledgedclientset.KubefledgedV1alpha3().ClusterImageCaches().Update(context.TODO(),
+			v1alpha3.ClusterImageCacheFromImageCache(imageCache), metav1.UpdateOptions{})
+		return err
+	}
+	_, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(context.TODO(), imageCache, metav1.UpdateOptions{})
+	return err
+}
+
+// listImageCaches lists the ImageCaches of all the namespaces and the ClusterImageCaches from the informer cache
+func (c *Controller) listImageCaches() ([]*v1alpha3.ImageCache, error) {
+	imageCaches, err := c.imageCachesLister.ImageCaches("").List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	clusterImageCaches, err := c.clusterImageCachesLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, clusterImageCache := range clusterImageCaches {
+		imageCaches = append(imageCaches, v1alpha3.ImageCacheFromCluster(clusterImageCache, c.clusterImageCacheNamespace))
+	}
+	return imageCaches, nil
+}
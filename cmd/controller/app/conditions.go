@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setReconcilingConditions sets the Reconciling and Stalled conditions of an image cache from the status
+// of its last action, following the kstatus convention: an image cache processing an action is Reconciling,
+// one whose last action failed is Stalled. Either condition is removed rather than set to False, so that an
+// image cache with neither is healthy once its observedGeneration matches its generation.
+func setReconcilingConditions(status *v1alpha3.ImageCacheStatus, generation int64) {
+	reason := status.Reason
+	if reason == "" {
+		reason = string(status.Status)
+	}
+	condition := metav1.Condition{
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            status.Message,
+	}
+	switch status.Status {
+	case v1alpha3.ImageCacheActionStatusProcessing:
+		condition.Type = v1alpha3.ImageCacheConditionReconciling
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha3.ImageCacheConditionStalled)
+	case v1alpha3.ImageCacheActionStatusFailed, v1alpha3.ImageCacheActionStatusAborted:
+		condition.Type = v1alpha3.ImageCacheConditionStalled
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha3.ImageCacheConditionReconciling)
+	default:
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha3.ImageCacheConditionReconciling)
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha3.ImageCacheConditionStalled)
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// setPausedCondition sets the Paused condition of a paused image cache, and removes it from an image
+// cache that is not paused
+func setPausedCondition(status *v1alpha3.ImageCacheStatus, paused bool, generation int64) {
+	if !paused {
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha3.ImageCacheConditionPaused)
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               v1alpha3.ImageCacheConditionPaused,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             v1alpha3.ImageCacheReasonImageCachePaused,
+		Message:            v1alpha3.ImageCacheMessageImageCachePaused,
+	})
+}
@@ -20,9 +20,10 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	v1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
 	fledgedscheme "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned/scheme"
@@ -30,6 +31,7 @@ import (
 	listers "github.com/lcouds/kube-fledged/pkg/client/listers/kubefledged/v1alpha3"
 	"github.com/lcouds/kube-fledged/pkg/images"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
@@ -42,12 +44,13 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 const controllerAgentName = "kubefledged-controller"
-const imageCachePurgeAnnotationKey = "kubefledged.io/purge-imagecache"
-const imageCacheRefreshAnnotationKey = "kubefledged.io/refresh-imagecache"
 
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a ImageCache is synced
@@ -58,6 +61,8 @@ const (
 )
 
 var (
+	// defaultNodeLatency is the time waited for more nodes to join the cluster before warming the
+	// nodes that joined with the images of the image caches
 	defaultNodeLatency = 5 * time.Second
 )
 
@@ -73,6 +78,13 @@ type Controller struct {
 	nodesSynced       cache.InformerSynced
 	imageCachesLister listers.ImageCacheLister
 	imageCachesSynced cache.InformerSynced
+	// clusterImageCacheNamespace is the namespace in which the jobs of the ClusterImageCaches are created
+	clusterImageCacheNamespace string
+	clusterImageCachesLister   listers.ClusterImageCacheLister
+	clusterImageCachesSynced   cache.InformerSynced
+	// configMapsLister gets the ConfigMaps holding the image lists of the image caches
+	configMapsLister corelisters.ConfigMapLister
+	configMapsSynced cache.InformerSynced
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -82,13 +94,44 @@ type Controller struct {
 	workqueue      workqueue.RateLimitingInterface
 	imageworkqueue workqueue.RateLimitingInterface
 	imageManager   *images.ImageManager
+	// reconciling serializes the reconciles of each image cache across the workers
+	reconciling *reconcilingKeys
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder                   record.EventRecorder
 	imageCacheRefreshFrequency time.Duration
+	// clock is used to decide when the refresh schedule of an image cache fires
+	clock clock.Clock
+	// lastScheduledRefresh is the time at which the refresh schedule of each image cache was last checked or fired
+	lastScheduledRefresh map[string]time.Time
+	// registryMirrors are the registry mirrors from which images are pulled, to look up the size of images on nodes
+	registryMirrors map[string]string
+	// jobNamespace is the namespace of the image pull/delete jobs, the namespace of each image cache when empty
+	jobNamespace string
+	// validateImagePullSecrets checks that the image pull secrets of an image cache exist before creating its jobs
+	validateImagePullSecrets bool
+	// imagePullSecretRecheckInterval is the interval at which an image cache with missing image pull secrets is
+	// reconciled again, so that its images are pulled once the secrets are created. Zero disables the recheck.
+	imagePullSecretRecheckInterval time.Duration
+	// cachedImagesConfigMap is the ConfigMap in the namespace of the controller to which a summary of the images
+	// cached by all the image caches, and an index of the images cached on each node, is written. Empty disables the summary.
+	cachedImagesConfigMap   string
+	lastCachedImagesSummary map[string]string
+	cachedImagesSummaryLock sync.Mutex
+	// registryPullLimitsConfigMap is the ConfigMap in the namespace of the controller holding the per-registry
+	// limits of the pull jobs. Empty disables the limits.
+	registryPullLimitsConfigMap string
 
 	// TODO(gaocegege): Should we use concurrent map?
 	nodesCache map[string]bool
+	// nodeWarmingDelay is the time waited for more nodes to join before warming the nodes that joined
+	nodeWarmingDelay time.Duration
+	// nodesToWarm are the nodes that joined and are waiting to be warmed by nodeWarmingTimer
+	nodesToWarm      map[string]bool
+	nodeWarmingTimer *time.Timer
+	nodeWarmingLock  sync.Mutex
+	// logger logs the reconciles of the image caches with their key, work type, images and nodes
+	logger klog.Logger
 }
 
 // NewController returns a new fledged controller
@@ -96,48 +139,72 @@ func NewController(
 	kubeclientset kubernetes.Interface,
 	kubefledgedclientset clientset.Interface,
 	namespace string,
+	clusterImageCacheNamespace string,
 	nodeInformer coreinformers.NodeInformer,
+	configMapInformer coreinformers.ConfigMapInformer,
 	imageCacheInformer informers.ImageCacheInformer,
+	clusterImageCacheInformer informers.ClusterImageCacheInformer,
 	imageCacheRefreshFrequency time.Duration,
 	imagePullDeadlineDuration time.Duration,
 	criClientImage string,
 	busyboxImage string,
 	imagePullPolicy string,
 	serviceAccountName string,
-	imageDeleteJobHostNetwork bool,
 	jobPriorityClassName string,
 	canDeleteJob bool,
-	criSocketPath string) *Controller {
+	criSocketPath string,
+	validateImagePullSecrets bool,
+	imagePullSecretRecheckInterval time.Duration,
+	cachedImagesConfigMap string,
+	jobOptions images.JobOptions,
+	logger klog.Logger) *Controller {
 
 	runtime.Must(fledgedscheme.AddToScheme(scheme.Scheme))
-	glog.V(4).Info("Creating event broadcaster")
+	klog.V(4).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartLogging(klog.Infof)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:              kubeclientset,
-		kubefledgedclientset:       kubefledgedclientset,
-		fledgedNameSpace:           namespace,
-		nodesLister:                nodeInformer.Lister(),
-		nodesCache:                 map[string]bool{},
-		nodesSynced:                nodeInformer.Informer().HasSynced,
-		imageCachesLister:          imageCacheInformer.Lister(),
-		imageCachesSynced:          imageCacheInformer.Informer().HasSynced,
-		workqueue:                  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches"),
-		imageworkqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus"),
-		recorder:                   recorder,
-		imageCacheRefreshFrequency: imageCacheRefreshFrequency,
+		kubeclientset:                  kubeclientset,
+		kubefledgedclientset:           kubefledgedclientset,
+		fledgedNameSpace:               namespace,
+		nodesLister:                    nodeInformer.Lister(),
+		nodesCache:                     map[string]bool{},
+		nodesSynced:                    nodeInformer.Informer().HasSynced,
+		imageCachesLister:              imageCacheInformer.Lister(),
+		imageCachesSynced:              imageCacheInformer.Informer().HasSynced,
+		clusterImageCacheNamespace:     clusterImageCacheNamespace,
+		clusterImageCachesLister:       clusterImageCacheInformer.Lister(),
+		clusterImageCachesSynced:       clusterImageCacheInformer.Informer().HasSynced,
+		configMapsLister:               configMapInformer.Lister(),
+		configMapsSynced:               configMapInformer.Informer().HasSynced,
+		workqueue:                      workqueue.NewNamedRateLimitingQueue(newSyncRateLimiter(), "ImageCaches"),
+		imageworkqueue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus"),
+		recorder:                       recorder,
+		imageCacheRefreshFrequency:     imageCacheRefreshFrequency,
+		clock:                          clock.RealClock{},
+		lastScheduledRefresh:           map[string]time.Time{},
+		reconciling:                    newReconcilingKeys(),
+		registryMirrors:                jobOptions.RegistryMirrors,
+		jobNamespace:                   jobOptions.JobNamespace,
+		validateImagePullSecrets:       validateImagePullSecrets,
+		imagePullSecretRecheckInterval: imagePullSecretRecheckInterval,
+		cachedImagesConfigMap:          cachedImagesConfigMap,
+		registryPullLimitsConfigMap:    jobOptions.RegistryPullLimitsConfigMap,
+		nodeWarmingDelay:               defaultNodeLatency,
+		nodesToWarm:                    map[string]bool{},
+		logger:                         logger,
 	}
 
 	imageManager, _ := images.NewImageManager(controller.workqueue, controller.imageworkqueue,
 		controller.kubeclientset, controller.fledgedNameSpace, imagePullDeadlineDuration,
-		criClientImage, busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDeleteJob, criSocketPath)
+		criClientImage, busyboxImage, imagePullPolicy, serviceAccountName,
+		jobPriorityClassName, canDeleteJob, criSocketPath, jobOptions, klog.LoggerWithName(logger, "image-manager"))
 	controller.imageManager = imageManager
 
-	glog.Info("Setting up event handlers")
+	klog.Info("Setting up event handlers")
 	// Set up an event handler for when ImageCache resources change
 	imageCacheInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -150,6 +217,18 @@ func NewController(
 			controller.enqueueImageCache(images.ImageCacheDelete, obj, nil)
 		},
 	})
+	// ClusterImageCache resources are enqueued as the ImageCaches through which they are reconciled
+	clusterImageCacheInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			controller.enqueueImageCache(images.ImageCacheCreate, nil, controller.imageCacheFromCluster(obj))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueImageCache(images.ImageCacheUpdate, controller.imageCacheFromCluster(old), controller.imageCacheFromCluster(new))
+		},
+		DeleteFunc: func(obj interface{}) {
+			controller.enqueueImageCache(images.ImageCacheDelete, obj, nil)
+		},
+	})
 
 	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -162,6 +241,18 @@ func NewController(
 			controller.enqueueNode(obj, "delete")
 		},
 	})
+	// Image caches are updated when the ConfigMap of their image list changes
+	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			controller.enqueueConfigMap(nil, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueConfigMap(old, new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			controller.enqueueConfigMap(nil, obj)
+		},
+	})
 	return controller
 }
 
@@ -172,12 +263,12 @@ func (c *Controller) enqueueNode(obj interface{}, operation string) {
 		if !ok {
 			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 			if !ok {
-				glog.Errorf("Couldn't get object from tombstone %#v", obj)
+				klog.Errorf("Couldn't get object from tombstone %#v", obj)
 				return
 			}
 			node, ok = tombstone.Obj.(*corev1.Node)
 			if !ok {
-				glog.Errorf("Tombstone contained object that is not a Node %#v", obj)
+				klog.Errorf("Tombstone contained object that is not a Node %#v", obj)
 				return
 			}
 		}
@@ -187,43 +278,20 @@ func (c *Controller) enqueueNode(obj interface{}, operation string) {
 		if !ok {
 			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 			if !ok {
-				glog.Errorf("Couldn't get object from tombstone %#v", obj)
+				klog.Errorf("Couldn't get object from tombstone %#v", obj)
 				return
 			}
 			node, ok = tombstone.Obj.(*corev1.Node)
 			if !ok {
-				glog.Errorf("Tombstone contained object that is not a Node %#v", obj)
+				klog.Errorf("Tombstone contained object that is not a Node %#v", obj)
 				return
 			}
 		}
 		if IsNodeReady(node) {
 			if _, ok := c.nodesCache[node.Name]; !ok {
 				c.nodesCache[node.Name] = true
-				glog.V(4).Infof("Node %s updated and ready", node.Name)
-				ics, err := c.imageCachesLister.ImageCaches(c.fledgedNameSpace).List(labels.Everything())
-				if err != nil {
-					glog.Errorf("Error listing ImageCaches: %s", err.Error())
-					return
-				}
-
-				// Wait for defaultNodeLatency before enqueuing ImageCaches to make kubernetes api server happy.
-				ticker := time.NewTicker(defaultNodeLatency)
-				quit := make(chan struct{})
-				go func() {
-					for {
-						select {
-						case <-ticker.C:
-							glog.V(4).Infof("Enqueuing ImageCaches for node %s", node.Name)
-							for _, ic := range ics {
-								c.enqueueImageCache(images.ImageCacheRefresh, ic, ic)
-							}
-							close(quit)
-						case <-quit:
-							ticker.Stop()
-							return
-						}
-					}
-				}()
+				klog.V(4).Infof("Node %s updated and ready", node.Name)
+				c.warmNode(node.Name)
 			}
 		}
 	}
@@ -261,12 +329,12 @@ func (c *Controller) danglingJobs() error {
 		LabelSelector: labelSelector.String(),
 	})
 	if err != nil {
-		glog.Errorf("Error listing jobs: %v", err)
+		klog.Errorf("Error listing jobs: %v", err)
 		return err
 	}
 
 	if joblist == nil || len(joblist.Items) == 0 {
-		glog.Info("No dangling or stuck jobs found...")
+		klog.Info("No dangling or stuck jobs found...")
 		return nil
 	}
 	deletePropagation := metav1.DeletePropagationBackground
@@ -274,10 +342,10 @@ func (c *Controller) danglingJobs() error {
 		err := c.kubeclientset.BatchV1().Jobs(job.Namespace).
 			Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &deletePropagation})
 		if err != nil {
-			glog.Errorf("Error deleting job(%s): %v", job.Name, err)
+			klog.Errorf("Error deleting job(%s): %v", job.Name, err)
 			return err
 		}
-		glog.Infof("Dangling Job(%s) deleted", job.Name)
+		klog.Infof("Dangling Job(%s) deleted", job.Name)
 	}
 	return nil
 }
@@ -288,12 +356,26 @@ func (c *Controller) danglingImageCaches() error {
 	dangling := false
 	imagecachelist, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches("").List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		glog.Errorf("Error listing imagecaches: %v", err)
+		klog.Errorf("Error listing imagecaches: %v", err)
+		return err
+	}
+	clusterimagecachelist, err := c.kubefledgedclientset.KubefledgedV1alpha3().ClusterImageCaches().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		klog.Errorf("Error listing clusterimagecaches: %v", err)
 		return err
 	}
+	if imagecachelist == nil {
+		imagecachelist = &v1alpha3.ImageCacheList{}
+	}
+	if clusterimagecachelist != nil {
+		for i := range clusterimagecachelist.Items {
+			imagecachelist.Items = append(imagecachelist.Items,
+				*v1alpha3.ImageCacheFromCluster(&clusterimagecachelist.Items[i], c.clusterImageCacheNamespace))
+		}
+	}
 
-	if imagecachelist == nil || len(imagecachelist.Items) == 0 {
-		glog.Info("No dangling or stuck imagecaches found...")
+	if len(imagecachelist.Items) == 0 {
+		klog.Info("No dangling or stuck imagecaches found...")
 		return nil
 	}
 	status := &v1alpha3.ImageCacheStatus{
@@ -307,16 +389,16 @@ func (c *Controller) danglingImageCaches() error {
 			status.StartTime = imagecache.Status.StartTime
 			err := c.updateImageCacheStatus(&imagecache, status)
 			if err != nil {
-				glog.Errorf("Error updating ImageCache(%s) status to '%s': %v", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted, err)
+				klog.Errorf("Error updating ImageCache(%s) status to '%s': %v", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted, err)
 				return err
 			}
 			dangling = true
-			glog.Infof("Dangling Image cache(%s) status changed to '%s'", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted)
+			klog.Infof("Dangling Image cache(%s) status changed to '%s'", imagecache.Name, v1alpha3.ImageCacheActionStatusAborted)
 		}
 	}
 
 	if !dangling {
-		glog.Info("No dangling or stuck imagecaches found...")
+		klog.Info("No dangling or stuck imagecaches found...")
 	}
 	return nil
 }
@@ -331,33 +413,46 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer c.imageworkqueue.ShutDown()
 
 	// Start the informer factories to begin populating the informer caches
-	glog.Info("Starting kubefledged-controller")
+	klog.Info("Starting kubefledged-controller")
 
 	// Wait for the caches to be synced before starting workers
-	if ok := cache.WaitForCacheSync(stopCh, c.nodesSynced, c.imageCachesSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.nodesSynced, c.imageCachesSynced, c.clusterImageCachesSynced, c.configMapsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
-	glog.Info("Informer caches synched successfull")
+	klog.Info("Informer caches synched successfull")
+
+	c.syncRegistryPullLimits()
 
 	// Launch workers to process ImageCache resources
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
-	glog.Info("Image cache worker started")
+	klog.Info("Image cache worker started")
 
 	if c.imageCacheRefreshFrequency.Nanoseconds() != int64(0) {
 		go wait.Until(c.runRefreshWorker, c.imageCacheRefreshFrequency, stopCh)
-		glog.Info("Image cache refresh worker started")
+		klog.Info("Image cache refresh worker started")
+	}
+
+	go wait.Until(c.runScheduledRefreshWorker, refreshScheduleCheckPeriod, stopCh)
+	klog.Info("Image cache scheduled refresh worker started")
+
+	go wait.Until(c.deleteOrphanJobs, orphanJobsSweepPeriod, stopCh)
+	klog.Info("Orphan jobs sweep worker started")
+
+	if c.cachedImagesConfigMap != "" {
+		go wait.Until(c.runCachedImagesSummaryWorker, cachedImagesSummaryPeriod, stopCh)
+		klog.Info("Cached images summary worker started")
 	}
 
 	c.imageManager.Run(stopCh)
 	if err := c.imageManager.Run(stopCh); err != nil {
-		glog.Fatalf("Error running image manager: %s", err.Error())
+		klog.Fatalf("Error running image manager: %s", err.Error())
 	}
-	glog.Info("Image manager started")
+	klog.Info("Image manager started")
 
 	<-stopCh
-	glog.Info("Shutting down workers")
+	klog.Info("Shutting down workers")
 
 	return nil
 }
@@ -375,6 +470,11 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 	case images.ImageCacheCreate:
 		obj = new
 		newImageCache := new.(*v1alpha3.ImageCache)
+		// An image cache found being deleted on startup still has its images to be deleted
+		if deletionPending(newImageCache) || jobsCleanupPending(newImageCache) {
+			workType = images.ImageCacheDelete
+			break
+		}
 		// If the ImageCache resource already has a status field, it means it's already
 		// synced, so do not queue it for processing
 		if !reflect.DeepEqual(newImageCache.Status, v1alpha3.ImageCacheStatus{}) {
@@ -385,20 +485,37 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 		oldImageCache := old.(*v1alpha3.ImageCache)
 		newImageCache := new.(*v1alpha3.ImageCache)
 
+		// An image cache being deleted is not updated, purged or refreshed. Its images
+		// are deleted once it is no longer under processing.
+		if newImageCache.DeletionTimestamp != nil {
+			if !deletionPending(newImageCache) && !jobsCleanupPending(newImageCache) {
+				return false
+			}
+			workType = images.ImageCacheDelete
+			break
+		}
+
 		if oldImageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
 			if !reflect.DeepEqual(newImageCache.Spec, oldImageCache.Spec) {
-				glog.Warningf("Received image cache update/purge/delete for '%s' while it is under processing, so ignoring.", oldImageCache.Name)
+				klog.Warningf("Received image cache update/purge/delete for '%s' while it is under processing, so ignoring.", oldImageCache.Name)
 				return false
 			}
 		}
-		if _, exists := newImageCache.Annotations[imageCachePurgeAnnotationKey]; exists {
-			if _, exists := oldImageCache.Annotations[imageCachePurgeAnnotationKey]; !exists {
+		if _, exists := newImageCache.Annotations[v1alpha3.ImageCachePurgeAnnotationKey]; exists {
+			if _, exists := oldImageCache.Annotations[v1alpha3.ImageCachePurgeAnnotationKey]; !exists {
 				workType = images.ImageCachePurge
 				break
 			}
 		}
-		if _, exists := newImageCache.Annotations[imageCacheRefreshAnnotationKey]; exists {
-			if _, exists := oldImageCache.Annotations[imageCacheRefreshAnnotationKey]; !exists {
+		if image, exists := newImageCache.Annotations[v1alpha3.ImageCachePurgeImageAnnotationKey]; exists {
+			if oldImage, exists := oldImageCache.Annotations[v1alpha3.ImageCachePurgeImageAnnotationKey]; !exists || oldImage != image {
+				workType = images.ImageCachePurge
+				wqKey.Image = image
+				break
+			}
+		}
+		if _, exists := newImageCache.Annotations[v1alpha3.ImageCacheRefreshAnnotationKey]; exists {
+			if _, exists := oldImageCache.Annotations[v1alpha3.ImageCacheRefreshAnnotationKey]; !exists {
 				workType = images.ImageCacheRefresh
 				break
 			}
@@ -413,7 +530,7 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 		obj = old
 	}
 
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
+	if key, err = images.ImageCacheKey(obj.(*v1alpha3.ImageCache)); err != nil {
 		runtime.HandleError(err)
 		return false
 	}
@@ -425,7 +542,7 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 	}
 
 	c.workqueue.AddRateLimited(wqKey)
-	glog.V(4).Infof("enqueueImageCache::ImageCache resource queued for work type %s", workType)
+	klog.V(4).Infof("enqueueImageCache::ImageCache resource queued for work type %s", workType)
 	return true
 }
 
@@ -438,15 +555,27 @@ func (c *Controller) runWorker() {
 }
 
 // processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it, by calling the syncHandler.
+// attempt to process it, by calling the syncHandler. The items of the image
+// cache parked while it was reconciled by this worker are processed next.
 func (c *Controller) processNextWorkItem() bool {
-	//glog.Info("processNextWorkItem::Beginning...")
+	//klog.Info("processNextWorkItem::Beginning...")
 	obj, shutdown := c.workqueue.Get()
 
 	if shutdown {
 		return false
 	}
 
+	key, ok := obj.(images.WorkQueueKey)
+	if !ok {
+		c.processWorkItem(obj)
+		return true
+	}
+	c.reconciling.process(key.ObjKey, obj, c.processWorkItem)
+	return true
+}
+
+// processWorkItem processes a single work item of the workqueue by calling the syncHandler
+func (c *Controller) processWorkItem(obj interface{}) {
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
 		// We call Done here so the workqueue knows we have finished
@@ -474,84 +603,125 @@ func (c *Controller) processNextWorkItem() bool {
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
 		if err := c.syncHandler(key); err != nil {
-			glog.Errorf("error syncing imagecache: %v", err.Error())
-			return fmt.Errorf("error syncing imagecache: %v", err.Error())
+			c.logger.Error(err, "Error syncing image cache", "imagecache", key.ObjKey, "workType", key.WorkType)
+			// The sync is retried with exponential backoff and jitter, e.g. while the API server
+			// throttles requests, rather than hot-looping
+			if retries := c.workqueue.NumRequeues(obj); retries < maxSyncRetries {
+				c.workqueue.AddRateLimited(obj)
+				return fmt.Errorf("error syncing imagecache '%s', retry %d of %d: %v", key.ObjKey, retries+1, maxSyncRetries, err.Error())
+			}
+			c.workqueue.Forget(obj)
+			return fmt.Errorf("error syncing imagecache '%s', dropped after %d retries: %v", key.ObjKey, maxSyncRetries, err.Error())
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
-		//glog.Infof("Successfully synced '%s' for event '%s'", key.ObjKey, key.WorkType)
+		c.runCachedImagesSummaryWorker()
+		//klog.Infof("Successfully synced '%s' for event '%s'", key.ObjKey, key.WorkType)
 		return nil
 	}(obj)
 
 	if err != nil {
 		runtime.HandleError(err)
-		return true
 	}
-
-	return true
 }
 
 // runRefreshWorker is resposible of refreshing the image cache
 func (c *Controller) runRefreshWorker() {
 	// List the ImageCache resources
-	imageCaches, err := c.imageCachesLister.ImageCaches("").List(labels.Everything())
+	imageCaches, err := c.listImageCaches()
 	if err != nil {
-		glog.Errorf("Error in listing image caches: %v", err)
+		klog.Errorf("Error in listing image caches: %v", err)
 		return
 	}
 	for i := range imageCaches {
-		// Do not refresh if status is not yet updated
-		if reflect.DeepEqual(imageCaches[i].Status, v1alpha3.ImageCacheStatus{}) {
-			continue
-		}
-		// Do not refresh if image cache is already under processing
-		if imageCaches[i].Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
-			continue
-		}
-		// Do not refresh image cache if cache spec validation failed
-		if imageCaches[i].Status.Status == v1alpha3.ImageCacheActionStatusFailed &&
-			imageCaches[i].Status.Reason == v1alpha3.ImageCacheReasonCacheSpecValidationFailed {
+		// Image caches with a refresh schedule are refreshed by the scheduled refresh worker
+		if imageCaches[i].Spec.RefreshSchedule != "" {
 			continue
 		}
-		// Do not refresh if image cache has been purged
-		if imageCaches[i].Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
+		if !refreshable(imageCaches[i]) {
 			continue
 		}
 		c.enqueueImageCache(images.ImageCacheRefresh, imageCaches[i], nil)
 	}
 }
 
+// refreshable checks whether the image cache can be refreshed
+func refreshable(imageCache *v1alpha3.ImageCache) bool {
+	// Do not refresh if status is not yet updated
+	if reflect.DeepEqual(imageCache.Status, v1alpha3.ImageCacheStatus{}) {
+		return false
+	}
+	// Do not refresh if image cache is being deleted
+	if imageCache.DeletionTimestamp != nil {
+		return false
+	}
+	// Do not refresh if image cache is paused
+	if imageCache.Spec.Paused {
+		return false
+	}
+	// Do not refresh if image cache is already under processing
+	if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
+		return false
+	}
+	// Do not refresh image cache if cache spec validation failed
+	if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusFailed &&
+		imageCache.Status.Reason == v1alpha3.ImageCacheReasonCacheSpecValidationFailed {
+		return false
+	}
+	// Do not refresh if image cache has been purged
+	if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
+		return false
+	}
+	// Do not refresh before the retry-after of image pulls rate-limited by the registry
+	if rateLimited(imageCache, time.Now()) {
+		return false
+	}
+	return true
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the ImageCache resource
 // with the current status of the resource.
-func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
+func (c *Controller) syncHandler(wqKey images.WorkQueueKey) (err error) {
 	status := &v1alpha3.ImageCacheStatus{
 		Failures: map[string]v1alpha3.NodeReasonMessageList{},
+		Retries:  int32(c.workqueue.NumRequeues(wqKey)),
 	}
 
+	logger := klog.LoggerWithValues(c.logger, "imagecache", wqKey.ObjKey, "workType", wqKey.WorkType)
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(wqKey.ObjKey)
 	if err != nil {
-		glog.Errorf("Error from cache.SplitMetaNamespaceKey(): %v", err)
+		logger.Error(err, "Error splitting the key of the image cache")
 		return err
 	}
 
-	glog.Infof("Starting to sync image cache %s(%s)", name, wqKey.WorkType)
+	logger.Info("Starting to sync image cache")
 
 	switch wqKey.WorkType {
-	case images.ImageCacheCreate, images.ImageCacheUpdate, images.ImageCacheRefresh, images.ImageCachePurge:
+	case images.ImageCacheCreate, images.ImageCacheUpdate, images.ImageCacheRefresh, images.ImageCachePurge, images.ImageCacheDelete:
+		// the span of the reconcile lasts until the status update of the results of its jobs, unless
+		// the reconcile ends without handing requests to the image manager
+		c.imageManager.StartReconcileSpan(wqKey.ObjKey, wqKey.WorkType)
+		handedOff := false
+		defer func() {
+			if !handedOff {
+				c.imageManager.EndReconcileSpan(wqKey.ObjKey, string(status.Status), err)
+			}
+		}()
 
 		startTime := metav1.Now()
 		status.StartTime = &startTime
 		// Get the ImageCache resource with this namespace/name
-		imageCache, err := c.imageCachesLister.ImageCaches(namespace).Get(name)
+		imageCache, err := c.getImageCache(namespace, name)
 		if err != nil {
 			// The ImageCache resource may no longer exist, in which case we stop
 			// processing.
-			glog.Errorf("Error getting imagecache(%s): %v", name, err)
+			logger.Error(err, "Error getting image cache")
 			return err
 		}
+		status.ObservedGeneration = imageCache.Generation
 
 		if wqKey.WorkType == images.ImageCacheUpdate && wqKey.OldImageCache == nil {
 			status.Status = v1alpha3.ImageCacheActionStatusFailed
@@ -559,15 +729,15 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			status.Message = v1alpha3.ImageCacheMessageOldImageCacheNotFound
 
 			if err := c.updateImageCacheStatus(imageCache, status); err != nil {
-				glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+				logger.Error(err, "Error updating image cache status", "status", status.Status)
 				return err
 			}
-			glog.Errorf("%s: %s", v1alpha3.ImageCacheReasonOldImageCacheNotFound, v1alpha3.ImageCacheMessageOldImageCacheNotFound)
+			logger.Error(nil, v1alpha3.ImageCacheMessageOldImageCacheNotFound, "reason", v1alpha3.ImageCacheReasonOldImageCacheNotFound)
 			return fmt.Errorf("%s: %s", v1alpha3.ImageCacheReasonOldImageCacheNotFound, v1alpha3.ImageCacheMessageOldImageCacheNotFound)
 		}
 
 		cacheSpec := imageCache.Spec.CacheSpec
-		glog.V(4).Infof("cacheSpec: %+v", cacheSpec)
+		logger.V(4).Info("Image cache spec", "cacheSpec", cacheSpec)
 		var nodes []*corev1.Node
 
 		status.Status = v1alpha3.ImageCacheActionStatusProcessing
@@ -590,101 +760,302 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 		if wqKey.WorkType == images.ImageCachePurge {
 			status.Reason = v1alpha3.ImageCacheReasonImageCachePurge
 			status.Message = v1alpha3.ImageCacheMessagePurgeCache
+			if wqKey.Image != "" {
+				status.Reason = v1alpha3.ImageCacheReasonImagePurge
+				status.Message = v1alpha3.ImageCacheMessagePurgeImage
+			}
+		}
+
+		if wqKey.WorkType == images.ImageCacheDelete {
+			status.Reason = v1alpha3.ImageCacheReasonImageCacheDelete
+			status.Message = v1alpha3.ImageCacheMessageDeletingImages
 		}
 
-		imageCache, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		imageCache, err = c.fetchImageCache(namespace, name)
 		if err != nil {
-			glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+			logger.Error(err, "Error getting image cache from api server")
 			return err
 		}
 
-		if err = c.updateImageCacheStatus(imageCache, status); err != nil {
-			glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		// The images of an image cache being deleted are deleted from the nodes unless they
+		// have been purged or deleted already, or deleteImagesOnCacheDeletion has been unset.
+		if wqKey.WorkType == images.ImageCacheDelete {
+			if jobsCleanupPending(imageCache) {
+				return c.deleteJobs(imageCache)
+			}
+			if !deletionPending(imageCache) {
+				return nil
+			}
+			if !imageCache.Spec.DeleteImagesOnCacheDeletion || imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge ||
+				imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheDelete {
+				return c.removeFinalizer(imageCache)
+			}
+		} else if err := c.syncFinalizer(imageCache); err != nil {
+			logger.Error(err, "Error updating finalizer of image cache")
 			return err
 		}
 
-		for k, i := range cacheSpec {
-			if len(i.NodeSelector) > 0 {
-				if nodes, err = c.nodesLister.List(labels.Set(i.NodeSelector).AsSelector()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector %+v: %v", i.NodeSelector, err)
+		// a paused image cache creates no job; the images of an image cache being deleted are still deleted
+		if imageCache.Spec.Paused && wqKey.WorkType != images.ImageCacheDelete {
+			return c.pauseImageCache(imageCache, status)
+		}
+
+		// the images of the image list are cached as the last image list of the cacheSpec
+		resolved, err := c.resolveImageList(imageCache)
+		if err != nil && wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete {
+			return c.rejectImageList(imageCache, status, err)
+		}
+		if err != nil {
+			logger.Info("Images of the image list of image cache not deleted", "err", err)
+		} else {
+			imageCache = resolved
+			cacheSpec = imageCache.Spec.CacheSpec
+		}
+
+		// images are pulled only to the nodes of the workload, which must be readable
+		if wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete {
+			if _, err := c.workloadPodSpec(imageCache); err != nil {
+				return c.rejectWorkload(imageCache, status, err)
+			}
+		}
+
+		if wqKey.Image != "" && !imageInCacheSpec(imageCache, wqKey.Image) {
+			return c.rejectPurgeImage(imageCache, wqKey.Image, status)
+		}
+
+		status.PinnedDigests = pinnedDigests(imageCache)
+
+		// images of an image cache being deleted are purged from the nodes
+		workType := wqKey.WorkType
+		var referenced map[string][]string
+		if workType == images.ImageCacheDelete {
+			workType = images.ImageCachePurge
+			if referenced, err = c.referencedImages(imageCache); err != nil {
+				return err
+			}
+		}
+
+		if workType != images.ImageCachePurge && c.validateImagePullSecrets {
+			missing, err := c.missingImagePullSecrets(imageCache)
+			if err != nil {
+				return err
+			}
+			if len(missing) > 0 {
+				status.Status = v1alpha3.ImageCacheActionStatusFailed
+				status.Reason = v1alpha3.ImageCacheReasonImagePullSecretNotFound
+				status.Message = fmt.Sprintf("%s: %s", v1alpha3.ImageCacheMessageImagePullSecretNotFound, strings.Join(missing, ", "))
+
+				if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+					logger.Error(err, "Error updating image cache status", "status", status.Status)
 					return err
 				}
-			} else {
-				if nodes, err = c.nodesLister.List(labels.Everything()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector labels.Everything(): %v", err)
-					return err
+				logger.Error(nil, status.Message, "reason", v1alpha3.ImageCacheReasonImagePullSecretNotFound)
+				// no job is created until the secrets exist
+				if c.imagePullSecretRecheckInterval > 0 {
+					logger.Info("Image cache is reconciled again to check for the image pull secrets", "after", c.imagePullSecretRecheckInterval)
+					c.workqueue.AddAfter(wqKey, c.imagePullSecretRecheckInterval)
+				}
+				return nil
+			}
+		}
+
+		// an update pulls only the images added or changed since the cacheSpec was last applied,
+		// and images not yet cached on a node
+		var applied []v1alpha3.CacheSpecImages
+		if wqKey.WorkType == images.ImageCacheUpdate {
+			applied = appliedCacheSpec(imageCache, wqKey.OldImageCache)
+		}
+		current := newNodeImages(imageCache.Status.Nodes)
+		status.LastAppliedCacheSpec = cacheSpec
+		if workType == images.ImageCachePurge && wqKey.Image == "" {
+			status.LastAppliedCacheSpec = []v1alpha3.CacheSpecImages{}
+		}
+
+		// a refresh warming nodes that just joined pulls the images only to those not yet caching them
+		nodesToWarm := warmedNodes(wqKey)
+
+		// requests are placed in the imageworkqueue once the status of the image cache is updated
+		var requests []images.ImageWorkRequest
+		// unchanged are the images left as they are on the nodes
+		var unchanged []images.ImageWorkRequest
+		// excluded are the images of the nodes excluded by the image cache
+		var excluded []images.ImageWorkRequest
+		// pulls are the nodes to which each image is pulled
+		pulls := map[string]map[string]bool{}
+		// image lists of the cacheSpec selecting overlapping nodes plan an image they share once per node,
+		// with the settings of the first image list listing it
+		planned, plannedExcluded := nodeImagePlan{}, nodeImagePlan{}
+		for _, i := range cacheSpec {
+			var excludedNodes []*corev1.Node
+			if nodes, excludedNodes, err = c.selectAndExcludeNodes(imageCache, i.NodeSelector); err != nil {
+				return err
+			}
+			logger.V(4).Info("Nodes of image list", "nodeSelector", i.NodeSelector, "nodes", len(nodes))
+			if workType != images.ImageCachePurge {
+				for _, n := range excludedNodes {
+					for _, image := range i.Images {
+						if plannedExcluded.add(n.Name, image.Name) {
+							excluded = append(excluded, images.ImageWorkRequest{Image: image.Name, Node: n, WorkType: workType})
+						}
+					}
 				}
 			}
-			glog.V(4).Infof("No. of nodes in %+v is %d", i.NodeSelector, len(nodes))
 
 			for _, n := range nodes {
 				for _, image := range i.Images {
+					if !planned.add(n.Name, image.Name) {
+						logger.V(4).Info("Image already planned on node by another image list", "image", image.Name, "node", n.Name)
+						continue
+					}
+					if imageReferenced(image.Name, referenced[n.Name]) {
+						logger.Info("Image not deleted from node as it is referenced by another image cache", "image", image.Name, "node", n.Name)
+						continue
+					}
+					cachePaths := image.CachePaths
+					warmCommand := image.WarmCommand
+					aliases := image.Aliases
+					architectures := image.Architectures
+					imagePullSecrets := image.ImagePullSecrets
+					// images are deleted by the digest they were pulled by, even if no longer pinned
+					digest := status.PinnedDigests[image.Name]
+					if workType == images.ImageCachePurge {
+						digest = imageCache.Status.PinnedDigests[image.Name]
+					}
 					ipr := images.ImageWorkRequest{
 						Image:                   image.Name,
 						ForceFullCache:          image.ForceFullCache,
+						ImagePullPolicy:         image.ImagePullPolicy,
+						CachePaths:              &cachePaths,
+						WarmCommand:             &warmCommand,
+						Aliases:                 &aliases,
+						Architectures:           &architectures,
+						ImagePullSecrets:        &imagePullSecrets,
 						Node:                    n,
 						ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
-						WorkType:                wqKey.WorkType,
+						WorkType:                workType,
 						Imagecache:              imageCache,
+						Digest:                  digest,
+						Priority:                image.Priority,
+						ArtifactType:            image.ArtifactType,
 					}
-					c.imageworkqueue.AddRateLimited(ipr)
-				}
-				if wqKey.WorkType == images.ImageCacheUpdate {
-					for _, oldimage := range wqKey.OldImageCache.Spec.CacheSpec[k].Images {
-						matched := false
-						for _, newimage := range i.Images {
-							if oldimage == newimage {
-								matched = true
-								break
-							}
-						}
-						if !matched {
-							ipr := images.ImageWorkRequest{
-								Image:                   oldimage.Name,
-								ForceFullCache:          oldimage.ForceFullCache,
-								Node:                    n,
-								ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
-								WorkType:                images.ImageCachePurge,
-								Imagecache:              imageCache,
-							}
-							c.imageworkqueue.AddRateLimited(ipr)
+					// a purge of a single image leaves the other images on the nodes
+					if wqKey.Image != "" && !images.SameImage(image.Name, wqKey.Image) {
+						unchanged = append(unchanged, ipr)
+						continue
+					}
+					if nodesToWarm != nil && (!nodesToWarm[n.Name] || current[n.Name][image.Name].State == v1alpha3.NodeImageStateCached) {
+						unchanged = append(unchanged, ipr)
+						continue
+					}
+					if wqKey.WorkType == images.ImageCacheUpdate && unchangedImage(applied, i.NodeSelector, image) &&
+						current[n.Name][image.Name].State == v1alpha3.NodeImageStateCached {
+						logger.V(4).Info("Image unchanged on node, so not pulled", "image", image.Name, "node", n.Name)
+						unchanged = append(unchanged, ipr)
+						continue
+					}
+					requests = append(requests, ipr)
+					if workType != images.ImageCachePurge {
+						if pulls[image.Name] == nil {
+							pulls[image.Name] = map[string]bool{}
 						}
+						pulls[image.Name][n.Name] = true
 					}
 				}
 			}
 		}
 
+		// images removed from the cacheSpec are deleted from the nodes if pruning is enabled
+		if wqKey.WorkType == images.ImageCacheUpdate && imageCache.Spec.PruneRemovedImages {
+			pruned, err := c.pruneRequests(imageCache, applied)
+			if err != nil {
+				return err
+			}
+			requests = append(requests, pruned...)
+		}
+
+		if wqKey.WorkType == images.ImageCacheRefresh {
+			if err = limitRollout(imageCache, requests); err != nil {
+				logger.Error(err, "Error applying rollout strategy of image cache")
+				return err
+			}
+		}
+
+		if nodesToWarm != nil && len(requests) == 0 {
+			logger.Info("Images of image cache already cached on nodes", "nodes", wqKey.Nodes)
+			return nil
+		}
+
+		status.Nodes = nodeImageStatusForRequests(imageCache.Status.Nodes, requests, unchanged, excluded, startTime)
+		c.updateImageSizes(status)
+		// an update leaving every image unchanged completes without any job
+		if len(requests) == 0 && len(unchanged) > 0 {
+			status.Status = v1alpha3.ImageCacheActionStatusSucceeded
+			status.Message = v1alpha3.ImageCacheMessageImagesUnchanged
+			if err = c.updateImageCacheStatus(imageCache, status); err != nil {
+				logger.Error(err, "Error updating image cache status", "status", status.Status)
+				return err
+			}
+			logger.Info("No image of image cache added or changed")
+			return nil
+		}
+		if err = c.updateImageCacheStatus(imageCache, status); err != nil {
+			logger.Error(err, "Error updating image cache status", "status", status.Status)
+			return err
+		}
+
+		// images of higher priority are pulled first
+		sortByPriority(requests)
+		for _, ipr := range requests {
+			c.imageworkqueue.AddRateLimited(ipr)
+		}
 		// We add an empty image pull request to signal the image manager that all
 		// requests for this sync action have been placed in the imageworkqueue
 		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache})
+		handedOff = true
+		if !imageCache.Spec.DryRun {
+			c.recordPullStartedEvent(imageCache, pulls)
+		}
 
 	case images.ImageCacheStatusUpdate:
-		glog.V(4).Infof("wqKey.Status = %+v", wqKey.Status)
+		logger.V(4).Info("Image work results", "status", wqKey.Status)
 		// Finally, we update the status block of the ImageCache resource to reflect the
 		// current state of the world
 		// Get the ImageCache resource with this namespace/name
-		imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		imageCache, err := c.fetchImageCache(namespace, name)
 		if err != nil {
-			glog.Errorf("Error getting image cache %s: %v", name, err)
+			logger.Error(err, "Error getting image cache")
 			return err
 		}
 
 		if imageCache.Status.StartTime != nil {
 			status.StartTime = imageCache.Status.StartTime
 		}
+		status.Retries += imageCache.Status.Retries
 
 		status.Status = v1alpha3.ImageCacheActioneNoImagesPulledOrDeleted
 		status.Reason = imageCache.Status.Reason
 		status.Message = v1alpha3.ImageCacheMessageNoImagesPulledOrDeleted
 
 		failures := false
+		retries := false
 		for _, v := range *wqKey.Status {
-			if (v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusAlreadyPulled) && !failures {
+			if v.Status == images.ImageWorkResultStatusSucceededAfterRetries {
+				retries = true
+			}
+			if (v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusSucceededAfterRetries ||
+				v.Status == images.ImageWorkResultStatusAlreadyPulled || v.Status == images.ImageWorkResultStatusWouldPull ||
+				v.Status == images.ImageWorkResultStatusWouldDelete || v.Status == images.ImageWorkResultStatusAlreadyAbsent) && !failures {
 				status.Status = v1alpha3.ImageCacheActionStatusSucceeded
 				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
 					status.Message = v1alpha3.ImageCacheMessageImagesDeletedSuccessfully
+					if retries {
+						status.Message = v1alpha3.ImageCacheMessageImagesDeletedAfterRetries
+					}
 				} else {
 					status.Message = v1alpha3.ImageCacheMessageImagesPulledSuccessfully
+					if retries {
+						status.Message = v1alpha3.ImageCacheMessageImagesPulledAfterRetries
+					}
 				}
 			}
 			if (v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown) && !failures {
@@ -696,7 +1067,13 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 					status.Message = v1alpha3.ImageCacheMessageImagePullFailedForSomeImages
 				}
 			}
-			if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown {
+			if v.Status == images.ImageWorkResultStatusImageMissing && !failures {
+				failures = true
+				status.Status = v1alpha3.ImageCacheActionStatusFailed
+				status.Message = v1alpha3.ImageCacheMessageImagesMissingOnSomeNodes
+			}
+			if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown ||
+				v.Status == images.ImageWorkResultStatusImageMissing {
 				status.Failures[v.ImageWorkRequest.Image] = append(
 					status.Failures[v.ImageWorkRequest.Image], v1alpha3.NodeReasonMessage{
 						Node:    v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"],
@@ -706,74 +1083,167 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			}
 		}
 
+		if imageCache.Spec.DryRun && status.Status == v1alpha3.ImageCacheActionStatusSucceeded {
+			status.Message = v1alpha3.ImageCacheMessageDryRun
+		}
+
+		// pulls failing for fewer node/image pairs than the partial failure threshold do not fail the image cache
+		if status.Status == v1alpha3.ImageCacheActionStatusFailed && partiallyCached(*wqKey.Status, imageCache.Spec.PartialFailureThresholdPercent) {
+			status.Status = v1alpha3.ImageCacheActionStatusPartiallyCached
+			status.Message = v1alpha3.ImageCacheMessageImagesPartiallyCached
+		}
+
+		// pulls rate-limited by the registry are retried after the retry-after, and not before
+		retryAfter, rateLimited := rateLimitRetryAfter(*wqKey.Status)
+		if rateLimited {
+			status.Message = v1alpha3.ImageCacheMessageImagePullRateLimited
+			if retryAfter > 0 {
+				retryTime := metav1.NewTime(time.Now().Add(retryAfter))
+				status.RetryAfter = &retryTime
+			}
+		}
+
+		// the Stalled condition of an image cache whose helper images could not be pulled tells so
+		if helperImageUnavailable(*wqKey.Status) {
+			status.Reason = v1alpha3.ImageCacheReasonHelperImageUnavailable
+			status.Message = v1alpha3.ImageCacheMessageHelperImageUnavailable
+		}
+
+		status.Nodes = nodeImageStatusForResults(imageCache.Status.Nodes, *wqKey.Status, metav1.Now())
+		status.PinnedDigests = pinnedDigests(imageCache)
+		c.updateImageSizes(status)
+		c.updateImageDigests(status, imageCache.Spec.PinDigests)
+
 		err = c.updateImageCacheStatus(imageCache, status)
 		if err != nil {
-			glog.Errorf("Error updating ImageCache status: %v", err)
+			logger.Error(err, "Error updating image cache status")
 			return err
 		}
+		c.imageManager.EndReconcileSpan(wqKey.ObjKey, string(status.Status), nil)
 
-		if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge || imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh {
-			imageCache, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge || imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh ||
+			imageCache.Status.Reason == v1alpha3.ImageCacheReasonImagePurge {
+			imageCache, err := c.fetchImageCache(namespace, name)
 			if err != nil {
-				glog.Errorf("Error getting image cache %s: %v", name, err)
+				logger.Error(err, "Error getting image cache")
 				return err
 			}
 			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCachePurge {
-				if err := c.removeAnnotation(imageCache, imageCachePurgeAnnotationKey); err != nil {
-					glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", imageCachePurgeAnnotationKey, imageCache.Name, err)
+				if err := c.removeAnnotation(imageCache, v1alpha3.ImageCachePurgeAnnotationKey); err != nil {
+					logger.Error(err, "Error removing annotation from image cache", "annotation", v1alpha3.ImageCachePurgeAnnotationKey)
+					return err
+				}
+			}
+			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImagePurge {
+				if err := c.removeAnnotation(imageCache, v1alpha3.ImageCachePurgeImageAnnotationKey); err != nil {
+					logger.Error(err, "Error removing annotation from image cache", "annotation", v1alpha3.ImageCachePurgeImageAnnotationKey)
 					return err
 				}
 			}
-			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh {
-				if _, ok := imageCache.Annotations[imageCacheRefreshAnnotationKey]; ok {
-					if err := c.removeAnnotation(imageCache, imageCacheRefreshAnnotationKey); err != nil {
-						glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", imageCacheRefreshAnnotationKey, imageCache.Name, err)
+			// a refresh whose helper images could not be pulled is reported as such
+			if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheRefresh || imageCache.Status.Reason == v1alpha3.ImageCacheReasonHelperImageUnavailable {
+				if _, ok := imageCache.Annotations[v1alpha3.ImageCacheRefreshAnnotationKey]; ok {
+					if err := c.removeAnnotation(imageCache, v1alpha3.ImageCacheRefreshAnnotationKey); err != nil {
+						logger.Error(err, "Error removing annotation from image cache", "annotation", v1alpha3.ImageCacheRefreshAnnotationKey)
 						return err
 					}
 				}
 			}
 		}
 
+		// An image cache being deleted is removed once its images are deleted
+		if imageCache.Status.Reason == v1alpha3.ImageCacheReasonImageCacheDelete && hasFinalizer(imageCache) {
+			imageCache, err := c.fetchImageCache(namespace, name)
+			if err != nil {
+				logger.Error(err, "Error getting image cache")
+				return err
+			}
+			if err := c.removeFinalizer(imageCache); err != nil {
+				logger.Error(err, "Error removing finalizer from image cache", "finalizer", imageCacheFinalizer)
+				return err
+			}
+		}
+
+		c.recordImageWorkEvents(imageCache, *wqKey.Status)
+
+		if status.RetryAfter != nil {
+			logger.Info("Image pulls of image cache rate-limited by the registry, refreshing it again", "after", retryAfter)
+			c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: wqKey.ObjKey}, retryAfter)
+		}
+
 		if status.Status == v1alpha3.ImageCacheActionStatusSucceeded || status.Status == v1alpha3.ImageCacheActioneNoImagesPulledOrDeleted {
 			c.recorder.Event(imageCache, corev1.EventTypeNormal, status.Reason, status.Message)
 		}
 
-		if status.Status == v1alpha3.ImageCacheActionStatusFailed {
+		if status.Status == v1alpha3.ImageCacheActionStatusFailed || status.Status == v1alpha3.ImageCacheActionStatusPartiallyCached {
 			c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
 		}
 	}
-	glog.Infof("Completed sync actions for image cache %s(%s)", name, wqKey.WorkType)
+	logger.Info("Completed sync actions for image cache")
 	return nil
 
 }
 
 func (c *Controller) updateImageCacheStatus(imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus) error {
-	imageCacheCopy, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Get(context.TODO(), imageCache.Name, metav1.GetOptions{})
-	if err != nil {
+	// Status writes of concurrent reconciles, e.g. of image pull jobs completing at the same time, and
+	// edits of the image cache conflict with each other. On a conflict the status is written again
+	// over the latest image cache, so that the parts of the status left unset are not clobbered.
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		imageCacheCopy, err := c.latestImageCache(imageCache)
+		if err != nil {
+			return err
+		}
+		// NEVER modify objects from the store. It's a read-only, local cache.
+		// You can use DeepCopy() to make a deep copy of original object and modify this copy
+		// Or create a copy manually for better performance
+		nodes, totalSizeBytes, pinned := imageCacheCopy.Status.Nodes, imageCacheCopy.Status.TotalSizeBytes, imageCacheCopy.Status.PinnedDigests
+		applied := imageCacheCopy.Status.LastAppliedCacheSpec
+		observedGeneration := imageCacheCopy.Status.ObservedGeneration
+		conditions := imageCacheCopy.Status.Conditions
+		imageCacheCopy.Status = *status.DeepCopy()
+		// A nil Nodes retains the per-node status of the image cache
+		if status.Nodes == nil {
+			imageCacheCopy.Status.Nodes = nodes
+			imageCacheCopy.Status.TotalSizeBytes = totalSizeBytes
+		}
+		// A nil PinnedDigests retains the pinned digests of the image cache
+		if status.PinnedDigests == nil {
+			imageCacheCopy.Status.PinnedDigests = pinned
+		}
+		// A nil LastAppliedCacheSpec retains the cacheSpec last applied to the nodes
+		if status.LastAppliedCacheSpec == nil {
+			imageCacheCopy.Status.LastAppliedCacheSpec = applied
+		}
+		// A zero ObservedGeneration retains the generation last applied to the nodes
+		if status.ObservedGeneration == 0 {
+			imageCacheCopy.Status.ObservedGeneration = observedGeneration
+		}
+		imageCacheCopy.Status.Conditions = conditions
+		setCompletion(&imageCacheCopy.Status, imageCacheCopy.Generation)
+		setReconcilingConditions(&imageCacheCopy.Status, imageCacheCopy.Generation)
+		setPausedCondition(&imageCacheCopy.Status, imageCacheCopy.Spec.Paused, imageCacheCopy.Generation)
+		if imageCacheCopy.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
+			completionTime := metav1.Now()
+			imageCacheCopy.Status.CompletionTime = &completionTime
+		}
+		// If the CustomResourceSubresources feature gate is not enabled,
+		// we must use Update instead of UpdateStatus to update the Status block of the ImageCache resource.
+		// UpdateStatus will not allow changes to the Spec of the resource,
+		// which is ideal for ensuring nothing other than resource status has been updated.
+		err = c.updateImageCache(imageCacheCopy)
+		if apierrors.IsConflict(err) {
+			klog.V(4).Infof("Conflict updating status of imagecache(%s), retrying", imageCache.Name)
+		}
 		return err
-	}
-	// NEVER modify objects from the store. It's a read-only, local cache.
-	// You can use DeepCopy() to make a deep copy of original object and modify this copy
-	// Or create a copy manually for better performance
-	imageCacheCopy.Status = *status
-	if imageCacheCopy.Status.Status != v1alpha3.ImageCacheActionStatusProcessing {
-		completionTime := metav1.Now()
-		imageCacheCopy.Status.CompletionTime = &completionTime
-	}
-	// If the CustomResourceSubresources feature gate is not enabled,
-	// we must use Update instead of UpdateStatus to update the Status block of the ImageCache resource.
-	// UpdateStatus will not allow changes to the Spec of the resource,
-	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err = c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(context.TODO(), imageCacheCopy, metav1.UpdateOptions{})
-	return err
+	})
 }
 
 func (c *Controller) removeAnnotation(imageCache *v1alpha3.ImageCache, annotationKey string) error {
 	imageCacheCopy := imageCache.DeepCopy()
 	delete(imageCacheCopy.Annotations, annotationKey)
-	_, err := c.kubefledgedclientset.KubefledgedV1alpha3().ImageCaches(imageCache.Namespace).Update(context.TODO(), imageCacheCopy, metav1.UpdateOptions{})
+	err := c.updateImageCache(imageCacheCopy)
 	if err == nil {
-		glog.Infof("Annotation %s removed from imagecache(%s)", annotationKey, imageCache.Name)
+		klog.Infof("Annotation %s removed from imagecache(%s)", annotationKey, imageCache.Name)
 	}
 	return err
 }
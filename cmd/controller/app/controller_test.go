@@ -17,27 +17,44 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
 	kubefledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
 	kubefledgedclientsetfake "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned/fake"
 	informers "github.com/lcouds/kube-fledged/pkg/client/informers/externalversions"
 	kubefledgedinformers "github.com/lcouds/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha3"
 	"github.com/lcouds/kube-fledged/pkg/images"
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	clocktesting "k8s.io/utils/clock/testing"
 )
 
 const fledgedNameSpace = "kube-fledged"
@@ -54,20 +71,33 @@ func noResyncPeriodFunc() time.Duration {
 }
 
 func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clientset.Interface) (*Controller, coreinformers.NodeInformer, kubefledgedinformers.ImageCacheInformer) {
+	controller, nodeInformer, imagecacheInformer, _ := newTestClusterController(kubeclientset, fledgedclientset)
+	return controller, nodeInformer, imagecacheInformer
+}
+
+func newTestClusterController(kubeclientset kubernetes.Interface, fledgedclientset clientset.Interface) (*Controller,
+	coreinformers.NodeInformer, kubefledgedinformers.ImageCacheInformer, kubefledgedinformers.ClusterImageCacheInformer) {
+	return newTestClusterControllerWithLogger(kubeclientset, fledgedclientset, klog.Background())
+}
+
+func newTestClusterControllerWithLogger(kubeclientset kubernetes.Interface, fledgedclientset clientset.Interface, logger klog.Logger) (*Controller,
+	coreinformers.NodeInformer, kubefledgedinformers.ImageCacheInformer, kubefledgedinformers.ClusterImageCacheInformer) {
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeclientset, noResyncPeriodFunc())
 	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedclientset, noResyncPeriodFunc())
 	nodeInformer := kubeInformerFactory.Core().V1().Nodes()
 	imagecacheInformer := fledgedInformerFactory.Kubefledged().V1alpha3().ImageCaches()
+	clusterimagecacheInformer := fledgedInformerFactory.Kubefledged().V1alpha3().ClusterImageCaches()
 	imageCacheRefreshFrequency := time.Second * 0
 	imagePullDeadlineDuration := time.Second * 5
 	criClientImage := "senthilrch/fledged-docker-client:latest"
 	busyboxImage := "busybox:latest"
 	imagePullPolicy := "IfNotPresent"
 	serviceAccountName := "sa-kube-fledged"
-	imageDeleteJobHostNetwork := false
 	jobPriorityClassName := "priority-class-kube-fledged"
 	canDelete := false
 	socketPath := ""
+	validateImagePullSecrets := true
+	imagePullSecretRecheckInterval := time.Second * 0
 
 	/* 	startInformers := true
 	   	if startInformers {
@@ -78,13 +108,15 @@ func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clie
 	   	} */
 
 	controller := NewController(kubeclientset,
-		fledgedclientset, fledgedNameSpace, nodeInformer, imagecacheInformer,
+		fledgedclientset, fledgedNameSpace, fledgedNameSpace, nodeInformer, kubeInformerFactory.Core().V1().ConfigMaps(),
+		imagecacheInformer, clusterimagecacheInformer,
 		imageCacheRefreshFrequency, imagePullDeadlineDuration, criClientImage,
-		busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDelete, socketPath)
+		busyboxImage, imagePullPolicy, serviceAccountName,
+		jobPriorityClassName, canDelete, socketPath, validateImagePullSecrets, imagePullSecretRecheckInterval, "", images.JobOptions{}, logger)
 	controller.nodesSynced = func() bool { return true }
 	controller.imageCachesSynced = func() bool { return true }
-	return controller, nodeInformer, imagecacheInformer
+	controller.clusterImageCachesSynced = func() bool { return true }
+	return controller, nodeInformer, imagecacheInformer, clusterimagecacheInformer
 }
 
 func TestPreFlightChecks(t *testing.T) {
@@ -414,6 +446,27 @@ func TestRunRefreshWorker(t *testing.T) {
 			imageCacheListError: nil,
 			workqueueItems:      0,
 		},
+		{
+			name: "#8: Do not refresh if image cache is paused",
+			imageCacheList: &kubefledgedv1alpha3.ImageCacheList{
+				Items: []kubefledgedv1alpha3.ImageCache{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "foo",
+							Namespace: "kube-fledged",
+						},
+						Spec: kubefledgedv1alpha3.ImageCacheSpec{
+							Paused: true,
+						},
+						Status: kubefledgedv1alpha3.ImageCacheStatus{
+							Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+						},
+					},
+				},
+			},
+			imageCacheListError: nil,
+			workqueueItems:      0,
+		},
 	}
 
 	for _, test := range tests {
@@ -892,6 +945,62 @@ func TestSyncHandler(t *testing.T) {
 			expectErr:         false,
 			expectedErrString: "",
 		},
+		{
+			name:       "#16: StatusUpdate - ImagesMissingOnSomeNodes",
+			imageCache: defaultImageCache,
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"fakejob-1": {
+						Status: images.ImageWorkResultStatusAlreadyPulled,
+						ImageWorkRequest: images.ImageWorkRequest{
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+					"fakejob-2": {
+						Status:  images.ImageWorkResultStatusImageMissing,
+						Reason:  kubefledgedv1alpha3.ImageCacheReasonImageMissing,
+						Message: kubefledgedv1alpha3.ImageCacheMessageImageMissing,
+						ImageWorkRequest: images.ImageWorkRequest{
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name:       "#17: StatusUpdate - ImagesPulledAfterRetries",
+			imageCache: defaultImageCache,
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"job1": {
+						Status:  images.ImageWorkResultStatusSucceededAfterRetries,
+						Retries: 1,
+						ImageWorkRequest: images.ImageWorkRequest{
+							WorkType: images.ImageCacheCreate,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
 	}
 
 	for _, test := range tests {
@@ -931,6 +1040,22 @@ func TestSyncHandler(t *testing.T) {
 	t.Logf("%d tests passed", len(tests))
 }
 
+// deletingImageCache returns a copy of the image cache being deleted
+func deletingImageCache(imageCache kubefledgedv1alpha3.ImageCache, status kubefledgedv1alpha3.ImageCacheActionStatus, finalizers ...string) kubefledgedv1alpha3.ImageCache {
+	now := metav1.Now()
+	imageCache = *imageCache.DeepCopy()
+	imageCache.DeletionTimestamp = &now
+	imageCache.Finalizers = finalizers
+	imageCache.Status.Status = status
+	return imageCache
+}
+
+// purgeImageCache returns a copy of the image cache annotated to purge the image
+func purgeImageCache(imageCache kubefledgedv1alpha3.ImageCache, image string) kubefledgedv1alpha3.ImageCache {
+	imageCache.Annotations = map[string]string{kubefledgedv1alpha3.ImageCachePurgeImageAnnotationKey: image}
+	return imageCache
+}
+
 func TestEnqueueImageCache(t *testing.T) {
 	//now := metav1.Now()
 	//nowplus5s := metav1.NewTime(time.Now().Add(time.Second * 5))
@@ -999,7 +1124,7 @@ func TestEnqueueImageCache(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:        "foo",
 					Namespace:   "kube-fledged",
-					Annotations: map[string]string{imageCachePurgeAnnotationKey: ""},
+					Annotations: map[string]string{kubefledgedv1alpha3.ImageCachePurgeAnnotationKey: ""},
 				},
 				Spec: kubefledgedv1alpha3.ImageCacheSpec{
 					CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
@@ -1132,7 +1257,7 @@ func TestEnqueueImageCache(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:        "foo",
 					Namespace:   "kube-fledged",
-					Annotations: map[string]string{imageCacheRefreshAnnotationKey: ""},
+					Annotations: map[string]string{kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey: ""},
 				},
 				Spec: kubefledgedv1alpha3.ImageCacheSpec{
 					CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
@@ -1152,6 +1277,62 @@ func TestEnqueueImageCache(t *testing.T) {
 			},
 			expectedResult: true,
 		},
+		{
+			name:           "#11: Update - Imagecache being deleted. Successful queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, imageCacheFinalizer),
+			expectedResult: true,
+		},
+		{
+			name:           "#12: Update - Imagecache being deleted while under processing, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusProcessing, imageCacheFinalizer),
+			expectedResult: false,
+		},
+		{
+			name:           "#13: Update - Imagecache being deleted without finalizer, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, "example.com/other"),
+			expectedResult: false,
+		},
+		{
+			name:           "#14: Create - Imagecache being deleted on startup. Successful queueing",
+			workType:       images.ImageCacheCreate,
+			newImageCache:  deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, imageCacheFinalizer),
+			expectedResult: true,
+		},
+		{
+			name:           "#15: Update - Purge image annotation added. Successful queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  purgeImageCache(defaultImageCache, "foo"),
+			expectedResult: true,
+		},
+		{
+			name:           "#16: Update - Purge image annotation unchanged, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  purgeImageCache(defaultImageCache, "foo"),
+			newImageCache:  purgeImageCache(defaultImageCache, "foo"),
+			expectedResult: false,
+		},
+		{
+			name:           "#17: Update - Imagecache being deleted with jobs to delete. Successful queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, jobsFinalizer),
+			expectedResult: true,
+		},
+		{
+			name:          "#18: Update - Jobs deleted after the images of the image cache, so no queueing",
+			workType:      images.ImageCacheUpdate,
+			oldImageCache: defaultImageCache,
+			newImageCache: deletingImageCache(defaultImageCache, kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				imageCacheFinalizer, jobsFinalizer),
+			expectedResult: false,
+		},
 	}
 
 	for _, test := range tests {
@@ -1286,3 +1467,4206 @@ func TestProcessNextWorkItem(t *testing.T) {
 	}
 	t.Logf("%d tests passed", len(tests))
 }
+
+func TestRecordImageWorkEvents(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	newNode := func(hostname string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   hostname,
+				Labels: map[string]string{"kubernetes.io/hostname": hostname},
+			},
+		}
+	}
+	failedOnManyNodes := map[string]images.ImageWorkResult{}
+	for i := 0; i < 7; i++ {
+		failedOnManyNodes[fmt.Sprintf("job%d", i)] = images.ImageWorkResult{
+			Status: images.ImageWorkResultStatusFailed,
+			ImageWorkRequest: images.ImageWorkRequest{
+				Image:    "foo:v1",
+				WorkType: images.ImageCacheCreate,
+				Node:     newNode(fmt.Sprintf("node%d", i)),
+			},
+		}
+	}
+	tests := []struct {
+		name           string
+		results        map[string]images.ImageWorkResult
+		expectedEvents []string
+	}{
+		{
+			name: "#1: Pulls succeeded",
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: newNode("node1")},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusSucceededAfterRetries,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: newNode("node1")},
+				},
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusAlreadyPulled,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: newNode("node2")},
+				},
+			},
+			expectedEvents: []string{"Normal PullSucceeded Pulled 2 image(s) to 1 node(s)"},
+		},
+		{
+			name: "#2: Pull failed on some nodes",
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: newNode("node1")},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusFailed,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: newNode("node3")},
+				},
+				"job3": {
+					Status:           images.ImageWorkResultStatusUnknown,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: newNode("node2")},
+				},
+			},
+			expectedEvents: []string{
+				"Normal PullSucceeded Pulled 1 image(s) to 1 node(s)",
+				"Warning PullFailed Failed to pull image foo:v1 to node(s) node2, node3",
+			},
+		},
+		{
+			name:    "#3: Pull failures on many nodes are deduplicated",
+			results: failedOnManyNodes,
+			expectedEvents: []string{
+				"Warning PullFailed Failed to pull image foo:v1 to node(s) node0, node1, node2, node3, node4 and 2 more",
+			},
+		},
+		{
+			name: "#4: Image delete failed",
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCachePurge, Node: newNode("node1")},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusFailed,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCachePurge, Node: newNode("node1")},
+				},
+			},
+			expectedEvents: []string{"Warning ImageDeleteFailed Failed to delete image bar:v1 from node(s) node1"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		recorder := record.NewFakeRecorder(10)
+		controller.recorder = recorder
+		controller.recordImageWorkEvents(imageCache, test.results)
+		close(recorder.Events)
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		if strings.Join(events, "\n") != strings.Join(test.expectedEvents, "\n") {
+			t.Errorf("Test: %s failed: expectedEvents=%q, actualEvents=%q", test.name, test.expectedEvents, events)
+		}
+	}
+}
+
+func TestRecordPullStartedEvent(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+	recorder := record.NewFakeRecorder(10)
+	controller.recorder = recorder
+	controller.recordPullStartedEvent(imageCache, map[string]map[string]bool{})
+	controller.recordPullStartedEvent(imageCache, map[string]map[string]bool{
+		"foo:v1": {"node1": true, "node2": true},
+		"bar:v1": {"node1": true},
+	})
+	close(recorder.Events)
+	events := []string{}
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	expectedEvents := []string{"Normal PullStarted Pulling 2 image(s) to 2 node(s)"}
+	if strings.Join(events, "\n") != strings.Join(expectedEvents, "\n") {
+		t.Errorf("Test failed: expectedEvents=%q, actualEvents=%q", expectedEvents, events)
+	}
+}
+
+func TestNodeImageStatus(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(earlier.Add(time.Hour))
+	node1 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	node2 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}
+	pulling := []kubefledgedv1alpha3.NodeStatus{
+		{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+			{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+			{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+		}},
+		{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+			{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+			{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+		}},
+	}
+	partiallyFailed := []kubefledgedv1alpha3.NodeStatus{
+		{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+			{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+			{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+		}},
+		{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+			{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateFailed, LastTransitionTime: now,
+				Reason: "ErrImagePull", Message: "pull access denied", LastError: "pull access denied"},
+			{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+		}},
+	}
+	tests := []struct {
+		name          string
+		current       []kubefledgedv1alpha3.NodeStatus
+		requests      []images.ImageWorkRequest
+		excluded      []images.ImageWorkRequest
+		results       map[string]images.ImageWorkResult
+		expectedNodes []kubefledgedv1alpha3.NodeStatus
+	}{
+		{
+			name: "#1: Images being pulled are marked Pulling",
+			requests: []images.ImageWorkRequest{
+				{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				{WorkType: images.ImageCacheCreate},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now},
+				}},
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now},
+				}},
+			},
+		},
+		{
+			name:    "#2: Partially failed cache",
+			current: pulling,
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusSucceededAfterRetries,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusAlreadyPulled,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"job3": {
+					Status:           images.ImageWorkResultStatusFailed,
+					Reason:           "ErrImagePull",
+					Message:          "pull access denied",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+			},
+			expectedNodes: partiallyFailed,
+		},
+		{
+			name: "#3: Refresh retains the transition time of images still failing",
+			current: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateFailed, LastTransitionTime: earlier,
+						Reason: "ErrImagePull", Message: "pull access denied", LastError: "pull access denied"},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: earlier},
+				}},
+			},
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusFailed,
+					Reason:           "ErrImagePull",
+					Message:          "pull access denied",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheRefresh, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateFailed, LastTransitionTime: earlier,
+						Reason: "ErrImagePull", Message: "pull access denied", LastError: "pull access denied"},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: earlier},
+				}},
+			},
+		},
+		{
+			name:    "#4: Images being deleted are marked Deleting",
+			current: partiallyFailed,
+			requests: []images.ImageWorkRequest{
+				{Image: "foo:v1", WorkType: images.ImageCachePurge, Node: node1},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting, LastTransitionTime: now},
+				}},
+			},
+		},
+		{
+			name: "#5: Deleted images are removed",
+			current: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting, LastTransitionTime: earlier},
+				}},
+			},
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCachePurge, Node: node1},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{},
+		},
+		{
+			name:    "#6: Images skipped on nodes of another architecture",
+			current: pulling,
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"job3": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusSkipped,
+					Reason:           kubefledgedv1alpha3.ImageCacheReasonArchitectureMismatch,
+					Message:          kubefledgedv1alpha3.ImageCacheMessageArchitectureMismatch,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				partiallyFailed[0],
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateSkipped, LastTransitionTime: now,
+						Reason: kubefledgedv1alpha3.ImageCacheReasonArchitectureMismatch, Message: kubefledgedv1alpha3.ImageCacheMessageArchitectureMismatch},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+				}},
+			},
+		},
+		{
+			name:    "#7: Dry run plan",
+			current: pulling,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusWouldPull,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"fakejob-2": {
+					Status:           images.ImageWorkResultStatusAlreadyPulled,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node1},
+				},
+				"fakejob-3": {
+					Status:           images.ImageWorkResultStatusWouldDelete,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCachePurge, Node: node2},
+				},
+				"fakejob-4": {
+					Status:           images.ImageWorkResultStatusWouldPull,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateWouldPull, LastTransitionTime: now},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+				}},
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateWouldDelete, LastTransitionTime: now},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateWouldPull, LastTransitionTime: now},
+				}},
+			},
+		},
+		{
+			name:    "#8: Last error retained while the image is pulled again",
+			current: partiallyFailed,
+			requests: []images.ImageWorkRequest{
+				{Image: "bar:v1", WorkType: images.ImageCacheRefresh, Node: node2},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now,
+						LastError: "pull access denied"},
+				}},
+			},
+		},
+		{
+			name: "#9: Last error cleared once the image is cached",
+			current: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier,
+						LastError: "pull access denied"},
+				}},
+			},
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheRefresh, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now},
+				}},
+			},
+		},
+		{
+			name:    "#10: Last error is the reason of a failure without message",
+			current: pulling[1:],
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusFailed,
+					Reason:           "Error",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateFailed, LastTransitionTime: now,
+						Reason: "Error", LastError: "Error"},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+				}},
+			},
+		},
+		{
+			name:    "#11: Images of an excluded node",
+			current: partiallyFailed,
+			requests: []images.ImageWorkRequest{
+				{Image: "bar:v1", WorkType: images.ImageCacheRefresh, Node: node1},
+			},
+			excluded: []images.ImageWorkRequest{
+				{Image: "bar:v1", WorkType: images.ImageCacheRefresh, Node: node2},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: now},
+				}},
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateExcluded, LastTransitionTime: now,
+						Reason: kubefledgedv1alpha3.ImageCacheReasonNodeExcluded, Message: kubefledgedv1alpha3.ImageCacheMessageNodeExcluded,
+						LastError: "pull access denied"},
+				}},
+			},
+		},
+		{
+			name:    "#12: Image cached after passing verification is verified",
+			current: pulling[1:],
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					Verification:     true,
+					Verified:         true,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: node2},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStatePulling, LastTransitionTime: earlier},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: now, Verified: true},
+				}},
+			},
+		},
+		{
+			name: "#13: Images already absent from the node are removed",
+			current: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting, LastTransitionTime: earlier},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting, LastTransitionTime: earlier},
+				}},
+			},
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCachePurge, Node: node1},
+				},
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusAlreadyAbsent,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCachePurge, Node: node1},
+				},
+			},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{},
+		},
+	}
+	for _, test := range tests {
+		var nodes []kubefledgedv1alpha3.NodeStatus
+		if test.results != nil {
+			nodes = nodeImageStatusForResults(test.current, test.results, now)
+		} else {
+			nodes = nodeImageStatusForRequests(test.current, test.requests, nil, test.excluded, now)
+		}
+		if !reflect.DeepEqual(nodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.expectedNodes, nodes)
+		}
+	}
+}
+
+func TestUpdateImageSizes(t *testing.T) {
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: corev1.NodeStatus{
+				Images: []corev1.ContainerImage{
+					{Names: []string{"docker.io/library/foo@sha256:0123", "docker.io/library/foo:v1"}, SizeBytes: 100},
+					{Names: []string{"docker.io/library/bar:v1"}, SizeBytes: 20},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+			Status: corev1.NodeStatus{
+				Images: []corev1.ContainerImage{
+					{Names: []string{"docker.io/library/foo:v1"}, SizeBytes: 100},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name                   string
+		nodes                  []kubefledgedv1alpha3.NodeStatus
+		expectedSizes          map[string]int64
+		expectedNodeTotals     map[string]int64
+		expectedTotalSizeBytes int64
+	}{
+		{
+			name: "#1: Sizes of cached images are aggregated per node and for the cache",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+				}},
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateFailed},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+				}},
+			},
+			expectedSizes:          map[string]int64{"node1/bar:v1": 20, "node1/foo:v1": 100, "node2/bar:v1": 0, "node2/foo:v1": 100},
+			expectedNodeTotals:     map[string]int64{"node1": 120, "node2": 100},
+			expectedTotalSizeBytes: 220,
+		},
+		{
+			name: "#2: Image not yet listed in the node status keeps its previous size",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+					{Image: "baz:v1", State: kubefledgedv1alpha3.NodeImageStateCached, SizeBytes: 50},
+				}},
+			},
+			expectedSizes:          map[string]int64{"node2/bar:v1": 0, "node2/baz:v1": 50},
+			expectedNodeTotals:     map[string]int64{"node2": 50},
+			expectedTotalSizeBytes: 50,
+		},
+		{
+			name: "#3: Unknown node keeps the previous sizes",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node3", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, SizeBytes: 100},
+				}},
+			},
+			expectedSizes:          map[string]int64{"node3/foo:v1": 100},
+			expectedNodeTotals:     map[string]int64{"node3": 100},
+			expectedTotalSizeBytes: 100,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, nodeInformer, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		for i := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(&nodes[i])
+		}
+		status := &kubefledgedv1alpha3.ImageCacheStatus{Nodes: test.nodes}
+		controller.updateImageSizes(status)
+		sizes := map[string]int64{}
+		nodeTotals := map[string]int64{}
+		for _, n := range status.Nodes {
+			nodeTotals[n.Node] = n.TotalSizeBytes
+			for _, i := range n.Images {
+				sizes[n.Node+"/"+i.Image] = i.SizeBytes
+			}
+		}
+		if !reflect.DeepEqual(sizes, test.expectedSizes) {
+			t.Errorf("Test: %s failed: expectedSizes=%v, actualSizes=%v", test.name, test.expectedSizes, sizes)
+		}
+		if !reflect.DeepEqual(nodeTotals, test.expectedNodeTotals) {
+			t.Errorf("Test: %s failed: expectedNodeTotals=%v, actualNodeTotals=%v", test.name, test.expectedNodeTotals, nodeTotals)
+		}
+		if status.TotalSizeBytes != test.expectedTotalSizeBytes {
+			t.Errorf("Test: %s failed: expectedTotalSizeBytes=%d, actualTotalSizeBytes=%d", test.name, test.expectedTotalSizeBytes, status.TotalSizeBytes)
+		}
+	}
+}
+
+func TestRunScheduledRefreshWorker(t *testing.T) {
+	start := time.Date(2021, 1, 1, 1, 59, 0, 0, time.UTC)
+	newImageCache := func(name, schedule string, status kubefledgedv1alpha3.ImageCacheActionStatus) *kubefledgedv1alpha3.ImageCache {
+		return &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				RefreshSchedule: schedule,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: status,
+			},
+		}
+	}
+	refreshed := func(controller *Controller, name string) bool {
+		return controller.workqueue.NumRequeues(images.WorkQueueKey{
+			WorkType: images.ImageCacheRefresh,
+			ObjKey:   "kube-fledged/" + name,
+		}) > 0
+	}
+	tests := []struct {
+		name              string
+		imageCache        *kubefledgedv1alpha3.ImageCache
+		advance           []time.Duration
+		expectedRefreshes []bool
+	}{
+		{
+			name:              "#1: Refresh when the schedule fires",
+			imageCache:        newImageCache("foo", "0 2 * * *", kubefledgedv1alpha3.ImageCacheActionStatusSucceeded),
+			advance:           []time.Duration{0, 30 * time.Second, 30 * time.Second},
+			expectedRefreshes: []bool{false, false, true},
+		},
+		{
+			name:              "#2: Do not refresh before the schedule fires",
+			imageCache:        newImageCache("foo", "0 2 * * *", kubefledgedv1alpha3.ImageCacheActionStatusSucceeded),
+			advance:           []time.Duration{0, 59 * time.Second},
+			expectedRefreshes: []bool{false, false},
+		},
+		{
+			name:              "#3: Do not refresh image cache without a schedule",
+			imageCache:        newImageCache("foo", "", kubefledgedv1alpha3.ImageCacheActionStatusSucceeded),
+			advance:           []time.Duration{0, time.Hour},
+			expectedRefreshes: []bool{false, false},
+		},
+		{
+			name:              "#4: Do not refresh image cache under processing",
+			imageCache:        newImageCache("foo", "0 2 * * *", kubefledgedv1alpha3.ImageCacheActionStatusProcessing),
+			advance:           []time.Duration{0, time.Hour},
+			expectedRefreshes: []bool{false, false},
+		},
+		{
+			name:              "#5: Schedule missed before the image cache was observed does not fire",
+			imageCache:        newImageCache("foo", "0 1 * * *", kubefledgedv1alpha3.ImageCacheActionStatusSucceeded),
+			advance:           []time.Duration{0, time.Minute},
+			expectedRefreshes: []bool{false, false},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		fakeClock := clocktesting.NewFakeClock(start)
+		controller.clock = fakeClock
+		imagecacheInformer.Informer().GetIndexer().Add(test.imageCache)
+		for i, d := range test.advance {
+			fakeClock.Step(d)
+			controller.runScheduledRefreshWorker()
+			if refreshed(controller, test.imageCache.Name) != test.expectedRefreshes[i] {
+				t.Errorf("Test: %s failed: at %s expectedRefresh=%t, actualRefresh=%t",
+					test.name, fakeClock.Now(), test.expectedRefreshes[i], !test.expectedRefreshes[i])
+			}
+		}
+	}
+}
+
+func TestRefreshTimeZone(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeZone      string
+		expectedFired time.Time
+	}{
+		{
+			name:          "#1: Default time zone is UTC",
+			timeZone:      "",
+			expectedFired: time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "#2: UTC",
+			timeZone:      "UTC",
+			expectedFired: time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "#3: America/New_York",
+			timeZone:      "America/New_York",
+			expectedFired: time.Date(2021, 1, 1, 7, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		fakeClock := clocktesting.NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		controller.clock = fakeClock
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				RefreshSchedule: "0 2 * * *",
+				RefreshTimeZone: test.timeZone,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+			},
+		})
+		var fired time.Time
+		for i := 0; i < 12*60 && fired.IsZero(); i++ {
+			controller.runScheduledRefreshWorker()
+			if controller.workqueue.NumRequeues(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"}) > 0 {
+				fired = fakeClock.Now()
+			}
+			fakeClock.Step(time.Minute)
+		}
+		if !fired.Equal(test.expectedFired) {
+			t.Errorf("Test: %s failed: expectedFired=%s, actualFired=%s", test.name, test.expectedFired, fired)
+		}
+	}
+}
+
+func TestRunRefreshWorkerSkipsScheduledImageCaches(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			RefreshSchedule: "0 2 * * *",
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+		},
+	})
+	controller.runRefreshWorker()
+	if n := controller.workqueue.NumRequeues(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"}); n != 0 {
+		t.Errorf("Test: image cache with a refresh schedule failed: expected no refresh, actual %d", n)
+	}
+}
+
+func TestSelectNodes(t *testing.T) {
+	newNode := func(name string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	nodes := []*corev1.Node{
+		newNode("cp1", map[string]string{"node-role.kubernetes.io/control-plane": ""}),
+		newNode("gpu1", map[string]string{"accelerator": "nvidia", "zone": "a"}),
+		newNode("gpu2", map[string]string{"accelerator": "nvidia", "zone": "b"}),
+		newNode("cpu1", map[string]string{"zone": "a"}),
+	}
+	requiredAffinity := func(terms ...corev1.NodeSelectorTerm) *corev1.Affinity {
+		return &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: terms},
+			},
+		}
+	}
+	tests := []struct {
+		name             string
+		nodeSelector     map[string]string
+		spec             kubefledgedv1alpha3.ImageCacheSpec
+		workloads        []runtime.Object
+		expectedNodes    []string
+		expectedExcluded []string
+		expectErr        bool
+	}{
+		{
+			name:          "#1: All nodes",
+			expectedNodes: []string{"cp1", "cpu1", "gpu1", "gpu2"},
+		},
+		{
+			name:          "#2: Node selector of the image cache",
+			spec:          kubefledgedv1alpha3.ImageCacheSpec{NodeSelector: map[string]string{"accelerator": "nvidia"}},
+			expectedNodes: []string{"gpu1", "gpu2"},
+		},
+		{
+			name:          "#3: Node selectors of the image cache and the cache spec are intersected",
+			nodeSelector:  map[string]string{"zone": "a"},
+			spec:          kubefledgedv1alpha3.ImageCacheSpec{NodeSelector: map[string]string{"accelerator": "nvidia"}},
+			expectedNodes: []string{"gpu1"},
+		},
+		{
+			name: "#4: Required node affinity avoids control-plane nodes",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{Affinity: requiredAffinity(corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.NodeSelectorOpDoesNotExist},
+				},
+			})},
+			expectedNodes: []string{"cpu1", "gpu1", "gpu2"},
+		},
+		{
+			name: "#5: Node selector terms are ORed",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{Affinity: requiredAffinity(
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}},
+				}},
+				corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{
+					{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"cpu1"}},
+				}},
+			)},
+			expectedNodes: []string{"cpu1", "gpu2"},
+		},
+		{
+			name: "#6: Invalid operator",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{Affinity: requiredAffinity(corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: "Near"}},
+			})},
+			expectErr: true,
+		},
+		{
+			name: "#7: Excluded node selector",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{ExcludedNodeSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "node-role.kubernetes.io/control-plane", Operator: metav1.LabelSelectorOpExists},
+				},
+			}},
+			expectedNodes:    []string{"cpu1", "gpu1", "gpu2"},
+			expectedExcluded: []string{"cp1"},
+		},
+		{
+			name:             "#8: Excluded node names matching the node selector",
+			spec:             kubefledgedv1alpha3.ImageCacheSpec{NodeSelector: map[string]string{"accelerator": "nvidia"}, ExcludedNodeNames: []string{"gpu2", "cpu1"}},
+			expectedNodes:    []string{"gpu1"},
+			expectedExcluded: []string{"gpu2"},
+		},
+		{
+			name: "#9: Invalid excluded node selector",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{ExcludedNodeSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "zone", Operator: "Near"}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "#10: Node selector of a deployment limits the nodes",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{WorkloadRef: &kubefledgedv1alpha3.WorkloadReference{
+				Kind: kubefledgedv1alpha3.WorkloadKindDeployment, Name: "web"}},
+			workloads: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kube-fledged"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{"zone": "a"},
+				}}},
+			}},
+			expectedNodes: []string{"cpu1", "gpu1"},
+		},
+		{
+			name: "#11: Node selectors of the image cache and the deployment are intersected",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{NodeSelector: map[string]string{"accelerator": "nvidia"},
+				WorkloadRef: &kubefledgedv1alpha3.WorkloadReference{Kind: kubefledgedv1alpha3.WorkloadKindDeployment, Name: "web"}},
+			workloads: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kube-fledged"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{"zone": "a"},
+				}}},
+			}},
+			expectedNodes: []string{"gpu1"},
+		},
+		{
+			name: "#12: Required node affinity of a daemonset limits the nodes",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{WorkloadRef: &kubefledgedv1alpha3.WorkloadReference{
+				Kind: kubefledgedv1alpha3.WorkloadKindDaemonSet, Name: "agent"}},
+			workloads: []runtime.Object{&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "kube-fledged"},
+				Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Affinity: requiredAffinity(corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "accelerator", Operator: corev1.NodeSelectorOpExists},
+					}}),
+				}}},
+			}},
+			expectedNodes: []string{"gpu1", "gpu2"},
+		},
+		{
+			name: "#13: Missing workload does not limit the nodes",
+			spec: kubefledgedv1alpha3.ImageCacheSpec{WorkloadRef: &kubefledgedv1alpha3.WorkloadReference{
+				Kind: kubefledgedv1alpha3.WorkloadKindDeployment, Name: "web"}},
+			expectedNodes: []string{"cp1", "cpu1", "gpu1", "gpu2"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset(test.workloads...)
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, nodeInformer, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       test.spec,
+		}
+		selected, excluded, err := controller.selectAndExcludeNodes(imageCache, test.nodeSelector)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Test: %s failed: expected an error, actual nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		names := []string{}
+		for _, n := range selected {
+			names = append(names, n.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%v, actualNodes=%v", test.name, test.expectedNodes, names)
+		}
+		var excludedNames []string
+		for _, n := range excluded {
+			excludedNames = append(excludedNames, n.Name)
+		}
+		sort.Strings(excludedNames)
+		if !reflect.DeepEqual(excludedNames, test.expectedExcluded) {
+			t.Errorf("Test: %s failed: expectedExcludedNodes=%v, actualExcludedNodes=%v", test.name, test.expectedExcluded, excludedNames)
+		}
+	}
+}
+
+func TestSyncHandlerSkipsNodesNotMatchingImageCache(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu1", Labels: map[string]string{"kubernetes.io/hostname": "gpu1", "accelerator": "nvidia"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu1", Labels: map[string]string{"kubernetes.io/hostname": "cpu1"}}},
+	}
+	newImageCache := func(images ...string) *kubefledgedv1alpha3.ImageCache {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec:    []kubefledgedv1alpha3.CacheSpecImages{{}},
+				NodeSelector: map[string]string{"accelerator": "nvidia"},
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded},
+		}
+		for _, image := range images {
+			imageCache.Spec.CacheSpec[0].Images = append(imageCache.Spec.CacheSpec[0].Images, kubefledgedv1alpha3.Image{Name: image})
+		}
+		return imageCache
+	}
+	tests := []struct {
+		name          string
+		workType      images.WorkType
+		imageCache    *kubefledgedv1alpha3.ImageCache
+		oldImageCache *kubefledgedv1alpha3.ImageCache
+		prune         bool
+		expectedNodes []kubefledgedv1alpha3.NodeStatus
+	}{
+		{
+			name:       "#1: Pull jobs only on matching nodes",
+			workType:   images.ImageCacheCreate,
+			imageCache: newImageCache("foo:v1"),
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+		{
+			name:          "#2: Delete jobs only on matching nodes",
+			workType:      images.ImageCacheUpdate,
+			imageCache:    newImageCache("foo:v1"),
+			oldImageCache: newImageCache("foo:v1", "bar:v1"),
+			prune:         true,
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+		{
+			name:       "#3: Purge jobs only on matching nodes",
+			workType:   images.ImageCachePurge,
+			imageCache: newImageCache("foo:v1"),
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting},
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		test.imageCache.Spec.PruneRemovedImages = test.prune
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(test.imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(test.imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType:      test.workType,
+			ObjKey:        "kube-fledged/foo",
+			OldImageCache: test.oldImageCache,
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		imageCache, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		for i := range imageCache.Status.Nodes {
+			for j := range imageCache.Status.Nodes[i].Images {
+				imageCache.Status.Nodes[i].Images[j].LastTransitionTime = metav1.Time{}
+			}
+		}
+		if !reflect.DeepEqual(imageCache.Status.Nodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.expectedNodes, imageCache.Status.Nodes)
+		}
+	}
+}
+
+func TestSyncHandlerWorkloadRef(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu1", Labels: map[string]string{"kubernetes.io/hostname": "gpu1", "accelerator": "nvidia"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu1", Labels: map[string]string{"kubernetes.io/hostname": "cpu1"}}},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "kube-fledged"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			NodeSelector:   map[string]string{"accelerator": "nvidia"},
+			InitContainers: []corev1.Container{{Name: "migrate", Image: "migrate:v1"}},
+			Containers:     []corev1.Container{{Name: "web", Image: "web:v1"}, {Name: "foo", Image: "foo:v1"}},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "busybox:1.36"}},
+			},
+		}}},
+	}
+	tests := []struct {
+		name           string
+		workloads      []runtime.Object
+		cacheImages    bool
+		expectedStatus kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedReason string
+		expectedNodes  []kubefledgedv1alpha3.NodeStatus
+	}{
+		{
+			name:           "#1: Pull jobs only on the nodes of the deployment",
+			workloads:      []runtime.Object{deployment},
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+		{
+			name:           "#2: Missing deployment fails the image cache",
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonWorkloadNotFound,
+		},
+		{
+			name:           "#3: Images of the init, regular and ephemeral containers of the deployment are cached",
+			workloads:      []runtime.Object{deployment},
+			cacheImages:    true,
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "busybox:1.36", State: kubefledgedv1alpha3.NodeImageStatePulling},
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+					{Image: "migrate:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+					{Image: "web:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+		{
+			name:           "#4: Missing deployment caching its images fails the image cache",
+			cacheImages:    true,
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonWorkloadNotFound,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+				WorkloadRef: &kubefledgedv1alpha3.WorkloadReference{Kind: kubefledgedv1alpha3.WorkloadKindDeployment, Name: "web",
+					CacheImages: test.cacheImages},
+			},
+		}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(test.workloads...)
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus || updated.Status.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expectedStatus=%s/%s, actualStatus=%s/%s", test.name,
+				test.expectedStatus, test.expectedReason, updated.Status.Status, updated.Status.Reason)
+		}
+		for i := range updated.Status.Nodes {
+			for j := range updated.Status.Nodes[i].Images {
+				updated.Status.Nodes[i].Images[j].LastTransitionTime = metav1.Time{}
+			}
+		}
+		if !reflect.DeepEqual(updated.Status.Nodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.expectedNodes, updated.Status.Nodes)
+		}
+	}
+}
+
+func TestSyncHandlerPaused(t *testing.T) {
+	testNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}},
+	}
+	earlier := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	// foo:v1 was cached before the image cache was paused, and bar:v1 added while paused
+	applied := []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}}
+	imageCache := func(paused bool) *kubefledgedv1alpha3.ImageCache {
+		return &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}, {Name: "bar:v1"}}}},
+				Paused:    paused,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status:               kubefledgedv1alpha3.ImageCacheActioneNoImagesPulledOrDeleted,
+				Reason:               kubefledgedv1alpha3.ImageCacheReasonImageCachePaused,
+				LastAppliedCacheSpec: applied,
+				Nodes: []kubefledgedv1alpha3.NodeStatus{{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: earlier},
+				}}},
+				Conditions: []metav1.Condition{{Type: kubefledgedv1alpha3.ImageCacheConditionPaused, Status: metav1.ConditionTrue,
+					Reason: kubefledgedv1alpha3.ImageCacheReasonImageCachePaused, LastTransitionTime: earlier}},
+			},
+		}
+	}
+	tests := []struct {
+		name             string
+		imageCache       *kubefledgedv1alpha3.ImageCache
+		workType         images.WorkType
+		expectedRequests []string
+		expectedReason   string
+		expectedPaused   bool
+	}{
+		{
+			name:           "#1: No job created for update of paused image cache",
+			imageCache:     imageCache(true),
+			workType:       images.ImageCacheUpdate,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonImageCachePaused,
+			expectedPaused: true,
+		},
+		{
+			name:           "#2: No job created for refresh of paused image cache",
+			imageCache:     imageCache(true),
+			workType:       images.ImageCacheRefresh,
+			expectedReason: kubefledgedv1alpha3.ImageCacheReasonImageCachePaused,
+			expectedPaused: true,
+		},
+		{
+			name:             "#3: Resume pulls the images added while paused",
+			imageCache:       imageCache(false),
+			workType:         images.ImageCacheUpdate,
+			expectedRequests: []string{"node1 bar:v1"},
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImageCacheUpdate,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(test.imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		nodeInformer.Informer().GetIndexer().Add(testNode)
+		imagecacheInformer.Informer().GetIndexer().Add(test.imageCache)
+		wqKey := images.WorkQueueKey{WorkType: test.workType, ObjKey: "kube-fledged/foo"}
+		if test.workType == images.ImageCacheUpdate {
+			wqKey.OldImageCache = imageCache(true)
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		requests := []string{}
+		if test.expectedRequests != nil {
+			// the requests are followed by an empty request signalling the end of the sync action
+			for {
+				item, _ := controller.imageworkqueue.Get()
+				ipr := item.(images.ImageWorkRequest)
+				controller.imageworkqueue.Done(item)
+				if ipr.Node == nil {
+					break
+				}
+				requests = append(requests, ipr.Node.Name+" "+ipr.Image)
+			}
+		} else if controller.imageworkqueue.Len() != 0 {
+			t.Errorf("Test: %s failed: expectedRequests=0, actualRequests=%d", test.name, controller.imageworkqueue.Len())
+		}
+		if test.expectedRequests != nil && !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, updated.Status.Reason)
+		}
+		if paused := meta.IsStatusConditionTrue(updated.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionPaused); paused != test.expectedPaused {
+			t.Errorf("Test: %s failed: expectedPausedCondition=%t, actualPausedCondition=%t", test.name, test.expectedPaused, paused)
+		}
+		if !reflect.DeepEqual(updated.Status.LastAppliedCacheSpec, applied) && test.expectedPaused {
+			t.Errorf("Test: %s failed: expectedLastAppliedCacheSpec=%+v, actualLastAppliedCacheSpec=%+v",
+				test.name, applied, updated.Status.LastAppliedCacheSpec)
+		}
+	}
+}
+
+func TestSyncHandlerImageLists(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu1", Labels: map[string]string{"kubernetes.io/hostname": "gpu1", "accelerator": "nvidia"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cpu1", Labels: map[string]string{"kubernetes.io/hostname": "cpu1", "pool": "cpu"}}},
+	}
+	imageList := func(nodeSelector map[string]string, names ...string) kubefledgedv1alpha3.CacheSpecImages {
+		list := kubefledgedv1alpha3.CacheSpecImages{NodeSelector: nodeSelector}
+		for _, name := range names {
+			list.Images = append(list.Images, kubefledgedv1alpha3.Image{Name: name})
+		}
+		return list
+	}
+	gpu := map[string]string{"accelerator": "nvidia"}
+	tests := []struct {
+		name             string
+		workType         images.WorkType
+		cacheSpec        []kubefledgedv1alpha3.CacheSpecImages
+		expectedRequests []string
+		expectedState    kubefledgedv1alpha3.NodeImageState
+	}{
+		{
+			name:     "#1: Image lists of disjoint nodes",
+			workType: images.ImageCacheCreate,
+			cacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				imageList(gpu, "cuda:v1"),
+				imageList(map[string]string{"pool": "cpu"}, "base:v1"),
+			},
+			expectedRequests: []string{"cpu1 base:v1", "gpu1 cuda:v1"},
+			expectedState:    kubefledgedv1alpha3.NodeImageStatePulling,
+		},
+		{
+			name:     "#2: Image shared by image lists of overlapping nodes pulled once per node",
+			workType: images.ImageCacheCreate,
+			cacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				imageList(gpu, "cuda:v1", "base:v1"),
+				imageList(nil, "base:v1", "tools:v1"),
+			},
+			expectedRequests: []string{"cpu1 base:v1", "cpu1 tools:v1", "gpu1 base:v1", "gpu1 cuda:v1", "gpu1 tools:v1"},
+			expectedState:    kubefledgedv1alpha3.NodeImageStatePulling,
+		},
+		{
+			name:     "#3: Image shared by image lists of overlapping nodes deleted once per node",
+			workType: images.ImageCachePurge,
+			cacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				imageList(gpu, "cuda:v1", "base:v1"),
+				imageList(nil, "base:v1"),
+			},
+			expectedRequests: []string{"cpu1 base:v1", "gpu1 base:v1", "gpu1 cuda:v1"},
+			expectedState:    kubefledgedv1alpha3.NodeImageStateDeleting,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       kubefledgedv1alpha3.ImageCacheSpec{CacheSpec: test.cacheSpec},
+			Status:     kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{WorkType: test.workType, ObjKey: "kube-fledged/foo"})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		// the requests are followed by an empty request signalling the end of the sync action
+		requests := []string{}
+		for {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			requests = append(requests, ipr.Node.Name+" "+ipr.Image)
+		}
+		sort.Strings(requests)
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		statuses := []string{}
+		for _, n := range updated.Status.Nodes {
+			for _, i := range n.Images {
+				if i.State != test.expectedState {
+					t.Errorf("Test: %s failed: expectedState=%s, actualState=%s of %s on %s", test.name, test.expectedState, i.State, i.Image, n.Node)
+				}
+				statuses = append(statuses, n.Node+" "+i.Image)
+			}
+		}
+		sort.Strings(statuses)
+		if !reflect.DeepEqual(statuses, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedNodeImages=%v, actualNodeImages=%v", test.name, test.expectedRequests, statuses)
+		}
+	}
+}
+
+func TestSyncHandlerExcludedNodes(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu1", Labels: map[string]string{"kubernetes.io/hostname": "gpu1", "accelerator": "nvidia"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu2", Labels: map[string]string{"kubernetes.io/hostname": "gpu2", "accelerator": "nvidia"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu3", Labels: map[string]string{"kubernetes.io/hostname": "gpu3", "accelerator": "nvidia", "pool": "spot"}}},
+	}
+	tests := []struct {
+		name             string
+		workType         images.WorkType
+		expectedRequests []string
+		expectedNodes    []kubefledgedv1alpha3.NodeStatus
+	}{
+		{
+			name:             "#1: Create - Excluded nodes get no pull jobs",
+			workType:         images.ImageCacheCreate,
+			expectedRequests: []string{"gpu1 foo:v1"},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+				{Node: "gpu2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateExcluded,
+						Reason: kubefledgedv1alpha3.ImageCacheReasonNodeExcluded, Message: kubefledgedv1alpha3.ImageCacheMessageNodeExcluded},
+				}},
+				{Node: "gpu3", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateExcluded,
+						Reason: kubefledgedv1alpha3.ImageCacheReasonNodeExcluded, Message: kubefledgedv1alpha3.ImageCacheMessageNodeExcluded},
+				}},
+			},
+		},
+		{
+			name:             "#2: Purge - Excluded nodes get no delete jobs",
+			workType:         images.ImageCachePurge,
+			expectedRequests: []string{"gpu1 foo:v1"},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "gpu1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateDeleting},
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{
+					Images:       []kubefledgedv1alpha3.Image{{Name: "foo:v1"}},
+					NodeSelector: map[string]string{"accelerator": "nvidia"},
+				}},
+				ExcludedNodeNames:    []string{"gpu2"},
+				ExcludedNodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "spot"}},
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType: test.workType,
+			ObjKey:   "kube-fledged/foo",
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		// the requests are followed by an empty request signalling the end of the sync action
+		requests := []string{}
+		for {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			requests = append(requests, ipr.Node.Name+" "+ipr.Image)
+		}
+		sort.Strings(requests)
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		imageCache, _ = fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		for i := range imageCache.Status.Nodes {
+			for j := range imageCache.Status.Nodes[i].Images {
+				imageCache.Status.Nodes[i].Images[j].LastTransitionTime = metav1.Time{}
+			}
+		}
+		if !reflect.DeepEqual(imageCache.Status.Nodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.expectedNodes, imageCache.Status.Nodes)
+		}
+	}
+}
+
+func TestLimitRollout(t *testing.T) {
+	percent := intstr.FromString("25%")
+	absolute := intstr.FromInt(3)
+	tests := []struct {
+		name                        string
+		rolloutStrategy             *kubefledgedv1alpha3.RolloutStrategy
+		nodes                       int
+		expectedMaxUnavailableNodes int
+	}{
+		{
+			name:                        "#1: No rollout strategy",
+			nodes:                       8,
+			expectedMaxUnavailableNodes: 0,
+		},
+		{
+			name:                        "#2: Rollout strategy without maxUnavailable",
+			rolloutStrategy:             &kubefledgedv1alpha3.RolloutStrategy{},
+			nodes:                       8,
+			expectedMaxUnavailableNodes: 0,
+		},
+		{
+			name:                        "#3: maxUnavailable 25% of 8 nodes",
+			rolloutStrategy:             &kubefledgedv1alpha3.RolloutStrategy{MaxUnavailable: &percent},
+			nodes:                       8,
+			expectedMaxUnavailableNodes: 2,
+		},
+		{
+			name:                        "#4: maxUnavailable 25% of 3 nodes is rounded up",
+			rolloutStrategy:             &kubefledgedv1alpha3.RolloutStrategy{MaxUnavailable: &percent},
+			nodes:                       3,
+			expectedMaxUnavailableNodes: 1,
+		},
+		{
+			name:                        "#5: maxUnavailable of 3 nodes",
+			rolloutStrategy:             &kubefledgedv1alpha3.RolloutStrategy{MaxUnavailable: &absolute},
+			nodes:                       8,
+			expectedMaxUnavailableNodes: 3,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				RolloutStrategy: test.rolloutStrategy,
+			},
+		}
+		requests := []images.ImageWorkRequest{}
+		for i := 0; i < test.nodes; i++ {
+			n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node%d", i)}}
+			for _, image := range []string{"foo:v1", "bar:v1"} {
+				requests = append(requests, images.ImageWorkRequest{
+					Image:      image,
+					Node:       n,
+					WorkType:   images.ImageCacheRefresh,
+					Imagecache: imageCache,
+				})
+			}
+		}
+		if err := limitRollout(imageCache, requests); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+			continue
+		}
+		for _, r := range requests {
+			if r.MaxUnavailableNodes != test.expectedMaxUnavailableNodes {
+				t.Errorf("Test: %s failed: expectedMaxUnavailableNodes=%d, actualMaxUnavailableNodes=%d",
+					test.name, test.expectedMaxUnavailableNodes, r.MaxUnavailableNodes)
+				break
+			}
+		}
+	}
+}
+
+func TestLimitRolloutPerGroup(t *testing.T) {
+	percent := intstr.FromString("50%")
+	absolute := intstr.FromInt(1)
+	tests := []struct {
+		name                                string
+		rolloutStrategy                     *kubefledgedv1alpha3.RolloutStrategy
+		expectedMaxUnavailableNodesPerGroup map[string]int
+	}{
+		{
+			name:                                "#1: Rollout strategy without maxUnavailablePerGroup",
+			rolloutStrategy:                     &kubefledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone"},
+			expectedMaxUnavailableNodesPerGroup: map[string]int{"zone-a": 0, "zone-b": 0, "": 0},
+		},
+		{
+			name: "#2: maxUnavailablePerGroup of 1 node per zone",
+			rolloutStrategy: &kubefledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone",
+				MaxUnavailablePerGroup: &absolute},
+			expectedMaxUnavailableNodesPerGroup: map[string]int{"zone-a": 1, "zone-b": 1, "": 1},
+		},
+		{
+			name: "#3: maxUnavailablePerGroup 50% of the nodes of each zone is rounded up",
+			rolloutStrategy: &kubefledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone",
+				MaxUnavailablePerGroup: &percent},
+			expectedMaxUnavailableNodesPerGroup: map[string]int{"zone-a": 2, "zone-b": 1, "": 1},
+		},
+		{
+			name:                                "#4: maxUnavailablePerGroup without refreshGroupByLabel",
+			rolloutStrategy:                     &kubefledgedv1alpha3.RolloutStrategy{MaxUnavailablePerGroup: &percent},
+			expectedMaxUnavailableNodesPerGroup: map[string]int{"": 4},
+		},
+	}
+	// 4 nodes in zone-a, 2 in zone-b and one without zone
+	zones := []string{"zone-a", "zone-a", "zone-a", "zone-a", "zone-b", "zone-b", ""}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				RolloutStrategy: test.rolloutStrategy,
+			},
+		}
+		requests := []images.ImageWorkRequest{}
+		for i, zone := range zones {
+			n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node%d", i), Labels: map[string]string{}}}
+			if zone != "" {
+				n.Labels["topology.kubernetes.io/zone"] = zone
+			}
+			requests = append(requests, images.ImageWorkRequest{
+				Image:      "foo:v1",
+				Node:       n,
+				WorkType:   images.ImageCacheRefresh,
+				Imagecache: imageCache,
+			})
+		}
+		if err := limitRollout(imageCache, requests); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+			continue
+		}
+		for _, r := range requests {
+			expected, ok := test.expectedMaxUnavailableNodesPerGroup[r.NodeGroup]
+			if !ok || r.MaxUnavailableNodesPerGroup != expected {
+				t.Errorf("Test: %s failed: node %s: expectedMaxUnavailableNodesPerGroup=%v, actualNodeGroup=%s, actualMaxUnavailableNodesPerGroup=%d",
+					test.name, r.Node.Name, test.expectedMaxUnavailableNodesPerGroup, r.NodeGroup, r.MaxUnavailableNodesPerGroup)
+				break
+			}
+		}
+	}
+}
+
+func TestSyncHandlerImagePullSecrets(t *testing.T) {
+	existingSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "dockerhub", Namespace: "kube-fledged"}}
+	tests := []struct {
+		name                   string
+		imageCacheSecrets      []corev1.LocalObjectReference
+		imageSecrets           []corev1.LocalObjectReference
+		disableValidation      bool
+		createdSecret          string
+		expectMissing          bool
+		expectedMessage        string
+		expectPulledAfterCheck bool
+	}{
+		{
+			name:              "#1: Image pull secrets exist",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "dockerhub"}},
+			imageSecrets:      []corev1.LocalObjectReference{{Name: "dockerhub"}},
+		},
+		{
+			name:              "#2: Image pull secret of the image not found",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "dockerhub"}},
+			imageSecrets:      []corev1.LocalObjectReference{{Name: "private-registry"}, {Name: "quay"}},
+			expectMissing:     true,
+			expectedMessage:   kubefledgedv1alpha3.ImageCacheMessageImagePullSecretNotFound + ": private-registry, quay",
+		},
+		{
+			name:              "#3: Image pull secret of the image cache not found",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "quay"}},
+			expectMissing:     true,
+			expectedMessage:   kubefledgedv1alpha3.ImageCacheMessageImagePullSecretNotFound + ": quay",
+		},
+		{
+			name:              "#4: Image pull secrets are not checked when validation is disabled",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "quay"}},
+			disableValidation: true,
+		},
+		{
+			name:                   "#5: Images are pulled once the missing secret is created",
+			imageCacheSecrets:      []corev1.LocalObjectReference{{Name: "quay"}},
+			createdSecret:          "quay",
+			expectMissing:          true,
+			expectedMessage:        kubefledgedv1alpha3.ImageCacheMessageImagePullSecretNotFound + ": quay",
+			expectPulledAfterCheck: true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1", ImagePullSecrets: test.imageSecrets}}},
+				},
+				ImagePullSecrets: test.imageCacheSecrets,
+			},
+		}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(existingSecret)
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		controller.validateImagePullSecrets = !test.disableValidation
+		controller.imagePullSecretRecheckInterval = time.Millisecond
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		wqKey := images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if test.expectMissing && (updated.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusFailed ||
+			updated.Status.Reason != kubefledgedv1alpha3.ImageCacheReasonImagePullSecretNotFound ||
+			updated.Status.Message != test.expectedMessage || len(updated.Status.Nodes) != 0) {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedMessage=%s, expectedNodes=0, actualStatus=%s, actualReason=%s, actualMessage=%s, actualNodes=%d",
+				test.name, kubefledgedv1alpha3.ImageCacheActionStatusFailed, test.expectedMessage,
+				updated.Status.Status, updated.Status.Reason, updated.Status.Message, len(updated.Status.Nodes))
+		}
+		if !test.expectMissing && (len(updated.Status.Nodes) != 1 || updated.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusProcessing) {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedNodes=1, actualStatus=%s, actualNodes=%d", test.name,
+				kubefledgedv1alpha3.ImageCacheActionStatusProcessing, updated.Status.Status, len(updated.Status.Nodes))
+		}
+		if !test.expectMissing {
+			continue
+		}
+
+		// the image cache is reconciled again after the recheck interval
+		item, _ := controller.workqueue.Get()
+		if item != wqKey {
+			t.Errorf("Test: %s failed: expectedRequeuedKey=%+v, actualRequeuedKey=%+v", test.name, wqKey, item)
+			continue
+		}
+		controller.workqueue.Done(item)
+		if !test.expectPulledAfterCheck {
+			continue
+		}
+		fakekubeclientset.CoreV1().Secrets("kube-fledged").Create(context.TODO(),
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: test.createdSecret, Namespace: "kube-fledged"}}, metav1.CreateOptions{})
+		imagecacheInformer.Informer().GetIndexer().Update(updated)
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ = fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if len(updated.Status.Nodes) != 1 || updated.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusProcessing {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedNodes=1, actualStatus=%s, actualNodes=%d", test.name,
+				kubefledgedv1alpha3.ImageCacheActionStatusProcessing, updated.Status.Status, len(updated.Status.Nodes))
+		}
+	}
+}
+
+func TestSyncHandlerDryRun(t *testing.T) {
+	tests := []struct {
+		name            string
+		dryRun          bool
+		workType        images.WorkType
+		results         map[string]images.ImageWorkResult
+		expectedStatus  kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedMessage string
+		expectPullStart bool
+	}{
+		{
+			name:            "#1: Pull started event is recorded",
+			workType:        images.ImageCacheCreate,
+			expectPullStart: true,
+		},
+		{
+			name:     "#2: No pull started event is recorded in dry run mode",
+			dryRun:   true,
+			workType: images.ImageCacheCreate,
+		},
+		{
+			name:     "#3: Dry run plan",
+			dryRun:   true,
+			workType: images.ImageCacheStatusUpdate,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusWouldPull,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+			},
+			expectedStatus:  kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageDryRun,
+		},
+		{
+			name:     "#4: Dry run plan with missing image",
+			dryRun:   true,
+			workType: images.ImageCacheStatusUpdate,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusImageMissing,
+					Reason:           kubefledgedv1alpha3.ImageCacheReasonImageMissing,
+					Message:          kubefledgedv1alpha3.ImageCacheMessageImageMissing,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+			},
+			expectedStatus:  kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageImagesMissingOnSomeNodes,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+				},
+				DryRun: test.dryRun,
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		recorder := record.NewFakeRecorder(10)
+		controller.recorder = recorder
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		wqKey := images.WorkQueueKey{WorkType: test.workType, ObjKey: "kube-fledged/foo"}
+		if test.results != nil {
+			wqKey.Status = &test.results
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if test.workType == images.ImageCacheStatusUpdate {
+			updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+			if updated.Status.Status != test.expectedStatus || updated.Status.Message != test.expectedMessage {
+				t.Errorf("Test: %s failed: expectedStatus=%s, expectedMessage=%s, actualStatus=%s, actualMessage=%s",
+					test.name, test.expectedStatus, test.expectedMessage, updated.Status.Status, updated.Status.Message)
+			}
+			continue
+		}
+		pullStarted := false
+		for len(recorder.Events) > 0 {
+			if strings.Contains(<-recorder.Events, EventReasonPullStarted) {
+				pullStarted = true
+			}
+		}
+		if pullStarted != test.expectPullStart {
+			t.Errorf("Test: %s failed: expectedPullStartedEvent=%t, actualPullStartedEvent=%t", test.name, test.expectPullStart, pullStarted)
+		}
+	}
+}
+
+func TestSyncHandlerDeleteImagesOnCacheDeletion(t *testing.T) {
+	newImageCache := func(name string, deleteImages bool, images ...string) kubefledgedv1alpha3.ImageCache {
+		imageCache := kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec:                   []kubefledgedv1alpha3.CacheSpecImages{{}},
+				DeleteImagesOnCacheDeletion: deleteImages,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			},
+		}
+		for _, image := range images {
+			imageCache.Spec.CacheSpec[0].Images = append(imageCache.Spec.CacheSpec[0].Images, kubefledgedv1alpha3.Image{Name: image})
+		}
+		return imageCache
+	}
+	testNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"kubernetes.io/hostname": "node1"},
+		},
+	}
+	deleting := func(imageCache kubefledgedv1alpha3.ImageCache) kubefledgedv1alpha3.ImageCache {
+		return deletingImageCache(imageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, imageCacheFinalizer)
+	}
+	tests := []struct {
+		name              string
+		imageCache        kubefledgedv1alpha3.ImageCache
+		otherImageCache   *kubefledgedv1alpha3.ImageCache
+		workType          images.WorkType
+		results           map[string]images.ImageWorkResult
+		expectedFinalizer bool
+		expectedReason    string
+		expectedDeleting  []string
+	}{
+		{
+			name:              "#1: Finalizer added to image cache deleting images on deletion",
+			imageCache:        newImageCache("foo", true, "foo:v1"),
+			workType:          images.ImageCacheCreate,
+			expectedFinalizer: true,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name: "#2: Finalizer removed from image cache no longer deleting images on deletion",
+			imageCache: func() kubefledgedv1alpha3.ImageCache {
+				imageCache := newImageCache("foo", false, "foo:v1")
+				imageCache.Finalizers = []string{imageCacheFinalizer}
+				return imageCache
+			}(),
+			workType:          images.ImageCacheUpdate,
+			expectedFinalizer: false,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheUpdate,
+		},
+		{
+			name:              "#3: Deletion gated until the images are deleted",
+			imageCache:        deleting(newImageCache("foo", true, "foo:v1", "bar:v1")),
+			workType:          images.ImageCacheDelete,
+			expectedFinalizer: true,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheDelete,
+			expectedDeleting:  []string{"bar:v1", "foo:v1"},
+		},
+		{
+			name:       "#4: Images referenced by other image caches are not deleted",
+			imageCache: deleting(newImageCache("foo", true, "foo:v1", "bar:v1")),
+			otherImageCache: func() *kubefledgedv1alpha3.ImageCache {
+				imageCache := newImageCache("other", false, "docker.io/library/bar:v1")
+				return &imageCache
+			}(),
+			workType:          images.ImageCacheDelete,
+			expectedFinalizer: true,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheDelete,
+			expectedDeleting:  []string{"foo:v1"},
+		},
+		{
+			name: "#5: Finalizer removed once the image delete jobs complete",
+			imageCache: func() kubefledgedv1alpha3.ImageCache {
+				imageCache := deletingImageCache(newImageCache("foo", true, "foo:v1"),
+					kubefledgedv1alpha3.ImageCacheActionStatusProcessing, imageCacheFinalizer)
+				imageCache.Status.Reason = kubefledgedv1alpha3.ImageCacheReasonImageCacheDelete
+				return imageCache
+			}(),
+			workType: images.ImageCacheStatusUpdate,
+			results: map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCachePurge, Node: &testNode},
+				},
+			},
+			expectedFinalizer: false,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheDelete,
+		},
+		{
+			name: "#6: Images of purged image cache are not deleted again",
+			imageCache: func() kubefledgedv1alpha3.ImageCache {
+				imageCache := newImageCache("foo", true, "foo:v1")
+				imageCache.Status.Reason = kubefledgedv1alpha3.ImageCacheReasonImageCachePurge
+				return deleting(imageCache)
+			}(),
+			workType:          images.ImageCacheDelete,
+			expectedFinalizer: false,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCachePurge,
+		},
+		{
+			name:              "#7: Images remain when deleteImagesOnCacheDeletion was unset",
+			imageCache:        deleting(newImageCache("foo", false, "foo:v1")),
+			workType:          images.ImageCacheDelete,
+			expectedFinalizer: false,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+	}
+	for _, test := range tests {
+		imageCache := test.imageCache.DeepCopy()
+		objects := []runtime.Object{imageCache}
+		if test.otherImageCache != nil {
+			objects = append(objects, test.otherImageCache)
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(objects...)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		nodeInformer.Informer().GetIndexer().Add(&testNode)
+		for _, obj := range objects {
+			imagecacheInformer.Informer().GetIndexer().Add(obj)
+		}
+		wqKey := images.WorkQueueKey{WorkType: test.workType, ObjKey: "kube-fledged/foo"}
+		if test.workType == images.ImageCacheUpdate {
+			wqKey.OldImageCache = imageCache
+		}
+		if test.results != nil {
+			wqKey.Status = &test.results
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if hasFinalizer(updated) != test.expectedFinalizer {
+			t.Errorf("Test: %s failed: expectedFinalizer=%t, actualFinalizer=%t", test.name, test.expectedFinalizer, hasFinalizer(updated))
+		}
+		if updated.Status.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, updated.Status.Reason)
+		}
+		if test.workType != images.ImageCacheDelete {
+			continue
+		}
+		deleting := []string{}
+		for _, n := range updated.Status.Nodes {
+			for _, i := range n.Images {
+				if i.State == kubefledgedv1alpha3.NodeImageStateDeleting {
+					deleting = append(deleting, i.Image)
+				}
+			}
+		}
+		if len(deleting) != len(test.expectedDeleting) || (len(deleting) > 0 && !reflect.DeepEqual(deleting, test.expectedDeleting)) {
+			t.Errorf("Test: %s failed: expectedDeleting=%v, actualDeleting=%v", test.name, test.expectedDeleting, deleting)
+		}
+	}
+}
+
+func TestSyncHandlerJobNamespace(t *testing.T) {
+	imageCache := kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+		},
+	}
+	job := func(name, imageCacheName string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "kubefledged-jobs",
+			Labels: map[string]string{
+				"app":                              "kubefledged",
+				"kubefledged":                      "kubefledged-image-manager",
+				"imagecache":                       imageCacheName,
+				images.ImageCacheNamespaceLabelKey: "kube-fledged",
+			},
+		}}
+	}
+	tests := []struct {
+		name                  string
+		jobNamespace          string
+		imageCache            kubefledgedv1alpha3.ImageCache
+		workType              images.WorkType
+		expectedJobsFinalizer bool
+		expectedJobs          []string
+	}{
+		{
+			name:                  "#1: Jobs finalizer added to image cache whose jobs are in the job namespace",
+			jobNamespace:          "kubefledged-jobs",
+			imageCache:            imageCache,
+			workType:              images.ImageCacheCreate,
+			expectedJobsFinalizer: true,
+			expectedJobs:          []string{"bar-1", "foo-1"},
+		},
+		{
+			name:         "#2: No jobs finalizer on image cache in the job namespace",
+			jobNamespace: "kube-fledged",
+			imageCache:   imageCache,
+			workType:     images.ImageCacheCreate,
+			expectedJobs: []string{"bar-1", "foo-1"},
+		},
+		{
+			name:         "#3: Jobs of image cache being deleted are deleted",
+			jobNamespace: "kubefledged-jobs",
+			imageCache:   deletingImageCache(imageCache, kubefledgedv1alpha3.ImageCacheActionStatusSucceeded, jobsFinalizer),
+			workType:     images.ImageCacheDelete,
+			expectedJobs: []string{"bar-1"},
+		},
+	}
+	for _, test := range tests {
+		imageCache := test.imageCache.DeepCopy()
+		fakekubeclientset := fakeclientset.NewSimpleClientset(job("foo-1", "foo"), job("bar-1", "bar"))
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		controller.jobNamespace = test.jobNamespace
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		if err := controller.syncHandler(images.WorkQueueKey{WorkType: test.workType, ObjKey: "kube-fledged/foo"}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if hasJobsFinalizer(updated) != test.expectedJobsFinalizer {
+			t.Errorf("Test: %s failed: expectedJobsFinalizer=%t, actualJobsFinalizer=%t", test.name, test.expectedJobsFinalizer, hasJobsFinalizer(updated))
+		}
+		jobs, _ := fakekubeclientset.BatchV1().Jobs("kubefledged-jobs").List(context.TODO(), metav1.ListOptions{})
+		actualJobs := []string{}
+		for _, j := range jobs.Items {
+			actualJobs = append(actualJobs, j.Name)
+		}
+		sort.Strings(actualJobs)
+		if !reflect.DeepEqual(actualJobs, test.expectedJobs) {
+			t.Errorf("Test: %s failed: expectedJobs=%v, actualJobs=%v", test.name, test.expectedJobs, actualJobs)
+		}
+	}
+}
+
+func TestSyncHandlerPinDigests(t *testing.T) {
+	const (
+		oldDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+		newDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	)
+	digestNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"kubernetes.io/hostname": "node1"},
+		},
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx@" + oldDigest}, SizeBytes: 100},
+				{Names: []string{"docker.io/library/nginx@" + newDigest, "docker.io/library/nginx:1.25"}, SizeBytes: 120},
+			},
+		},
+	}
+	tests := []struct {
+		name                  string
+		pinDigests            bool
+		pinnedDigests         map[string]string
+		expectedDigest        string
+		expectedPinnedDigests map[string]string
+	}{
+		{
+			name:           "#1: Resolved digest is recorded per node",
+			expectedDigest: newDigest,
+		},
+		{
+			name:                  "#2: First resolved digest is pinned",
+			pinDigests:            true,
+			expectedDigest:        newDigest,
+			expectedPinnedDigests: map[string]string{"nginx:1.25": newDigest},
+		},
+		{
+			name:                  "#3: Pinned digest is kept after the tag moved",
+			pinDigests:            true,
+			pinnedDigests:         map[string]string{"nginx:1.25": oldDigest},
+			expectedDigest:        oldDigest,
+			expectedPinnedDigests: map[string]string{"nginx:1.25": oldDigest},
+		},
+		{
+			name:           "#4: Pinned digests are cleared once pinning is disabled",
+			pinnedDigests:  map[string]string{"nginx:1.25": oldDigest},
+			expectedDigest: newDigest,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "nginx:1.25"}}},
+				},
+				PinDigests: test.pinDigests,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status:        kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				Reason:        kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+				PinnedDigests: test.pinnedDigests,
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&digestNode)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		results := map[string]images.ImageWorkResult{
+			"fakejob-1": {
+				Status:           images.ImageWorkResultStatusSucceeded,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "nginx:1.25", WorkType: images.ImageCacheCreate, Node: &digestNode},
+			},
+		}
+		if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &results}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if len(updated.Status.Nodes) != 1 || len(updated.Status.Nodes[0].Images) != 1 {
+			t.Errorf("Test: %s failed: expectedNodes=1, actualNodes=%v", test.name, updated.Status.Nodes)
+			continue
+		}
+		if digest := updated.Status.Nodes[0].Images[0].Digest; digest != test.expectedDigest {
+			t.Errorf("Test: %s failed: expectedDigest=%s, actualDigest=%s", test.name, test.expectedDigest, digest)
+		}
+		if len(updated.Status.PinnedDigests) != len(test.expectedPinnedDigests) ||
+			(len(test.expectedPinnedDigests) > 0 && !reflect.DeepEqual(updated.Status.PinnedDigests, test.expectedPinnedDigests)) {
+			t.Errorf("Test: %s failed: expectedPinnedDigests=%v, actualPinnedDigests=%v", test.name, test.expectedPinnedDigests, updated.Status.PinnedDigests)
+		}
+
+		// a refresh of the image cache pulls the pinned digest
+		imagecacheInformer.Informer().GetIndexer().Update(updated)
+		if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		item, _ := controller.imageworkqueue.Get()
+		ipr := item.(images.ImageWorkRequest)
+		if ipr.WorkType != images.ImageCacheRefresh || ipr.Digest != test.expectedPinnedDigests["nginx:1.25"] {
+			t.Errorf("Test: %s failed: expectedRequestDigest=%s, actualWorkType=%s, actualRequestDigest=%s",
+				test.name, test.expectedPinnedDigests["nginx:1.25"], ipr.WorkType, ipr.Digest)
+		}
+	}
+}
+
+func TestSyncHandlerPartialFailure(t *testing.T) {
+	tests := []struct {
+		name             string
+		workType         images.WorkType
+		thresholdPercent int32
+		failed           int
+		expectedStatus   kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedMessage  string
+		expectWarning    bool
+	}{
+		{
+			name:            "#1: Failed pull fails the image cache without a partial failure threshold",
+			failed:          1,
+			expectedStatus:  kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+			expectWarning:   true,
+		},
+		{
+			name:             "#2: Failed pulls below the partial failure threshold",
+			thresholdPercent: 20,
+			failed:           1,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusPartiallyCached,
+			expectedMessage:  kubefledgedv1alpha3.ImageCacheMessageImagesPartiallyCached,
+			expectWarning:    true,
+		},
+		{
+			name:             "#3: Failed pulls at the partial failure threshold",
+			thresholdPercent: 10,
+			failed:           1,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage:  kubefledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+			expectWarning:    true,
+		},
+		{
+			name:             "#4: Failed pulls above the partial failure threshold",
+			thresholdPercent: 50,
+			failed:           6,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage:  kubefledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+			expectWarning:    true,
+		},
+		{
+			name:             "#5: No failed pulls with a partial failure threshold",
+			thresholdPercent: 50,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+			expectedMessage:  kubefledgedv1alpha3.ImageCacheMessageImagesPulledSuccessfully,
+		},
+		{
+			name:             "#6: Failed deletes are not partially cached",
+			workType:         images.ImageCachePurge,
+			thresholdPercent: 50,
+			failed:           1,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage:  kubefledgedv1alpha3.ImageCacheMessageImageDeleteFailedForSomeImages,
+			expectWarning:    true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "nginx:1.25"}}},
+				},
+				PartialFailureThresholdPercent: test.thresholdPercent,
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			},
+		}
+		workType := images.ImageCacheCreate
+		if test.workType != "" {
+			workType = test.workType
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		recorder := record.NewFakeRecorder(10)
+		controller.recorder = recorder
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		// every node/image pair of ten nodes has a result, the first ones failed
+		results := map[string]images.ImageWorkResult{}
+		for i := 0; i < 10; i++ {
+			hostname := fmt.Sprintf("node%d", i)
+			result := images.ImageWorkResult{
+				Status: images.ImageWorkResultStatusSucceeded,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "nginx:1.25", WorkType: workType,
+					Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: hostname, Labels: map[string]string{"kubernetes.io/hostname": hostname}}}},
+			}
+			if i < test.failed {
+				result.Status = images.ImageWorkResultStatusFailed
+				result.Reason = "ErrImagePull"
+			}
+			results[fmt.Sprintf("fakejob-%d", i)] = result
+		}
+		if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &results}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus || updated.Status.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedMessage=%s, actualStatus=%s, actualMessage=%s",
+				test.name, test.expectedStatus, test.expectedMessage, updated.Status.Status, updated.Status.Message)
+		}
+		if failures := len(updated.Status.Failures["nginx:1.25"]); failures != test.failed {
+			t.Errorf("Test: %s failed: expectedFailures=%d, actualFailures=%d", test.name, test.failed, failures)
+		}
+		warning := false
+		for len(recorder.Events) > 0 {
+			if strings.HasPrefix(<-recorder.Events, corev1.EventTypeWarning+" "+kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate) {
+				warning = true
+			}
+		}
+		if warning != test.expectWarning {
+			t.Errorf("Test: %s failed: expectedWarningEvent=%t, actualWarningEvent=%t", test.name, test.expectWarning, warning)
+		}
+	}
+}
+
+func TestSetCompletion(t *testing.T) {
+	nodeStatus := func(node string, states ...kubefledgedv1alpha3.NodeImageState) kubefledgedv1alpha3.NodeStatus {
+		n := kubefledgedv1alpha3.NodeStatus{Node: node}
+		for i, state := range states {
+			n.Images = append(n.Images, kubefledgedv1alpha3.NodeImageStatus{Image: fmt.Sprintf("foo:v%d", i), State: state})
+		}
+		return n
+	}
+	tests := []struct {
+		name                 string
+		nodes                []kubefledgedv1alpha3.NodeStatus
+		expectedPercentage   int32
+		expectedReady        metav1.ConditionStatus
+		expectedReadyReason  string
+		expectedReadyMessage string
+	}{
+		{
+			name: "#1: Partial completion",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				nodeStatus("node1", kubefledgedv1alpha3.NodeImageStateCached, kubefledgedv1alpha3.NodeImageStateCached),
+				nodeStatus("node2", kubefledgedv1alpha3.NodeImageStateCached, kubefledgedv1alpha3.NodeImageStatePulling),
+			},
+			expectedPercentage:   75,
+			expectedReady:        metav1.ConditionFalse,
+			expectedReadyReason:  kubefledgedv1alpha3.ImageCacheReasonImagesNotCached,
+			expectedReadyMessage: "3 of 4 images cached on the nodes",
+		},
+		{
+			name: "#2: Full completion",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				nodeStatus("node1", kubefledgedv1alpha3.NodeImageStateCached, kubefledgedv1alpha3.NodeImageStateCached),
+				nodeStatus("node2", kubefledgedv1alpha3.NodeImageStateCached, kubefledgedv1alpha3.NodeImageStateCached),
+			},
+			expectedPercentage:   100,
+			expectedReady:        metav1.ConditionTrue,
+			expectedReadyReason:  kubefledgedv1alpha3.ImageCacheReasonAllImagesCached,
+			expectedReadyMessage: "4 of 4 images cached on the nodes",
+		},
+		{
+			name: "#3: Skipped images are not to be cached",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				nodeStatus("node1", kubefledgedv1alpha3.NodeImageStateCached, kubefledgedv1alpha3.NodeImageStateSkipped),
+			},
+			expectedPercentage:   100,
+			expectedReady:        metav1.ConditionTrue,
+			expectedReadyReason:  kubefledgedv1alpha3.ImageCacheReasonAllImagesCached,
+			expectedReadyMessage: "1 of 1 images cached on the nodes",
+		},
+		{
+			name: "#4: Failed pulls and dry run plans are not complete",
+			nodes: []kubefledgedv1alpha3.NodeStatus{
+				nodeStatus("node1", kubefledgedv1alpha3.NodeImageStateFailed, kubefledgedv1alpha3.NodeImageStateWouldPull,
+					kubefledgedv1alpha3.NodeImageStateCached),
+			},
+			expectedPercentage:   33,
+			expectedReady:        metav1.ConditionFalse,
+			expectedReadyReason:  kubefledgedv1alpha3.ImageCacheReasonImagesNotCached,
+			expectedReadyMessage: "1 of 3 images cached on the nodes",
+		},
+		{
+			name:                 "#5: No images to be cached",
+			expectedPercentage:   0,
+			expectedReady:        metav1.ConditionFalse,
+			expectedReadyReason:  kubefledgedv1alpha3.ImageCacheReasonImagesNotCached,
+			expectedReadyMessage: "0 of 0 images cached on the nodes",
+		},
+	}
+	for _, test := range tests {
+		status := &kubefledgedv1alpha3.ImageCacheStatus{Nodes: test.nodes}
+		setCompletion(status, 2)
+		if status.CompletionPercentage != test.expectedPercentage {
+			t.Errorf("Test: %s failed: expectedPercentage=%d, actualPercentage=%d", test.name, test.expectedPercentage, status.CompletionPercentage)
+		}
+		if len(status.Conditions) != 1 {
+			t.Errorf("Test: %s failed: expectedConditions=1, actualConditions=%d", test.name, len(status.Conditions))
+			continue
+		}
+		ready := status.Conditions[0]
+		if ready.Type != kubefledgedv1alpha3.ImageCacheConditionReady || ready.Status != test.expectedReady ||
+			ready.Reason != test.expectedReadyReason || ready.Message != test.expectedReadyMessage || ready.ObservedGeneration != 2 {
+			t.Errorf("Test: %s failed: expectedReady=%s, expectedReason=%s, expectedMessage=%s, actualCondition=%+v",
+				test.name, test.expectedReady, test.expectedReadyReason, test.expectedReadyMessage, ready)
+		}
+	}
+}
+
+func TestSyncHandlerReadyCondition(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+			},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+	controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+
+	// the image cache is Ready once the image is cached on the node
+	for _, step := range []struct {
+		status        string
+		expectedReady metav1.ConditionStatus
+	}{
+		{images.ImageWorkResultStatusFailed, metav1.ConditionFalse},
+		{images.ImageWorkResultStatusSucceeded, metav1.ConditionTrue},
+	} {
+		results := map[string]images.ImageWorkResult{
+			"fakejob-1": {
+				Status:           step.status,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node},
+			},
+		}
+		if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &results}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", step.status, err.Error())
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		ready := meta.FindStatusCondition(updated.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionReady)
+		if ready == nil || ready.Status != step.expectedReady {
+			t.Errorf("Test: %s failed: expectedReady=%s, actualConditions=%+v", step.status, step.expectedReady, updated.Status.Conditions)
+		}
+		imagecacheInformer.Informer().GetIndexer().Update(updated)
+	}
+}
+
+func TestSyncHandlerPartialUpdate(t *testing.T) {
+	updateNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}}}
+	cacheSpec := func(images ...kubefledgedv1alpha3.Image) []kubefledgedv1alpha3.CacheSpecImages {
+		return []kubefledgedv1alpha3.CacheSpecImages{{Images: images}}
+	}
+	nodeStatus := func(state kubefledgedv1alpha3.NodeImageState, images ...string) []kubefledgedv1alpha3.NodeStatus {
+		n := kubefledgedv1alpha3.NodeStatus{Node: "node1"}
+		for _, image := range images {
+			n.Images = append(n.Images, kubefledgedv1alpha3.NodeImageStatus{Image: image, State: state})
+		}
+		return []kubefledgedv1alpha3.NodeStatus{n}
+	}
+	foo := kubefledgedv1alpha3.Image{Name: "foo:v1"}
+	bar := kubefledgedv1alpha3.Image{Name: "bar:v1"}
+	tests := []struct {
+		name             string
+		cacheSpec        []kubefledgedv1alpha3.CacheSpecImages
+		lastApplied      []kubefledgedv1alpha3.CacheSpecImages
+		oldCacheSpec     []kubefledgedv1alpha3.CacheSpecImages
+		nodes            []kubefledgedv1alpha3.NodeStatus
+		prune            bool
+		expectedRequests []string
+		expectedStatus   kubefledgedv1alpha3.ImageCacheActionStatus
+	}{
+		{
+			name:             "#1: One image changed is pulled, and the image it replaced deleted",
+			cacheSpec:        cacheSpec(foo, kubefledgedv1alpha3.Image{Name: "bar:v2"}),
+			lastApplied:      cacheSpec(foo, bar),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			prune:            true,
+			expectedRequests: []string{"pull bar:v2", "purge bar:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:             "#2: One image added is pulled",
+			cacheSpec:        cacheSpec(foo, bar),
+			lastApplied:      cacheSpec(foo),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "foo:v1"),
+			expectedRequests: []string{"pull bar:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:             "#3: Image with changed settings is pulled again",
+			cacheSpec:        cacheSpec(kubefledgedv1alpha3.Image{Name: "foo:v1", ImagePullPolicy: corev1.PullAlways}, bar),
+			lastApplied:      cacheSpec(foo, bar),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			expectedRequests: []string{"pull foo:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:             "#4: Unchanged image not cached on the node is pulled again",
+			cacheSpec:        cacheSpec(foo, bar),
+			lastApplied:      cacheSpec(foo, bar),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateFailed, "bar:v1", "foo:v1"),
+			expectedRequests: []string{"pull bar:v1", "pull foo:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:             "#5: Spec before the update is used when no cacheSpec was applied",
+			cacheSpec:        cacheSpec(foo, kubefledgedv1alpha3.Image{Name: "bar:v2"}),
+			oldCacheSpec:     cacheSpec(foo, bar),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			prune:            true,
+			expectedRequests: []string{"pull bar:v2", "purge bar:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:             "#6: Removed image is not deleted without pruning",
+			cacheSpec:        cacheSpec(foo, kubefledgedv1alpha3.Image{Name: "bar:v2"}),
+			lastApplied:      cacheSpec(foo, bar),
+			nodes:            nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			expectedRequests: []string{"pull bar:v2"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+		},
+		{
+			name:           "#7: No image changed",
+			cacheSpec:      cacheSpec(bar, foo),
+			lastApplied:    cacheSpec(foo, bar),
+			nodes:          nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+		},
+		{
+			name:           "#8: Image with changed priority is not pulled again",
+			cacheSpec:      cacheSpec(kubefledgedv1alpha3.Image{Name: "foo:v1", Priority: 10}, bar),
+			lastApplied:    cacheSpec(foo, bar),
+			nodes:          nodeStatus(kubefledgedv1alpha3.NodeImageStateCached, "bar:v1", "foo:v1"),
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       kubefledgedv1alpha3.ImageCacheSpec{CacheSpec: test.cacheSpec, PruneRemovedImages: test.prune},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status:               kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Nodes:                test.nodes,
+				LastAppliedCacheSpec: test.lastApplied,
+			},
+		}
+		oldImageCache := imageCache.DeepCopy()
+		oldImageCache.Spec.CacheSpec = test.oldCacheSpec
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		nodeInformer.Informer().GetIndexer().Add(updateNode)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType:      images.ImageCacheUpdate,
+			ObjKey:        "kube-fledged/foo",
+			OldImageCache: oldImageCache,
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		requests := []string{}
+		if test.expectedRequests != nil {
+			// the requests are followed by an empty request signalling the end of the sync action
+			for {
+				item, _ := controller.imageworkqueue.Get()
+				ipr := item.(images.ImageWorkRequest)
+				controller.imageworkqueue.Done(item)
+				if ipr.Node == nil {
+					break
+				}
+				workType := "pull"
+				if ipr.WorkType == images.ImageCachePurge {
+					workType = "purge"
+				}
+				requests = append(requests, workType+" "+ipr.Image)
+			}
+			sort.Strings(requests)
+			sort.Strings(test.expectedRequests)
+		} else {
+			time.Sleep(20 * time.Millisecond)
+			if n := controller.imageworkqueue.Len(); n != 0 {
+				t.Errorf("Test: %s failed: expectedRequests=0, actualRequests=%d", test.name, n)
+			}
+			test.expectedRequests = []string{}
+		}
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, updated.Status.Status)
+		}
+		// images left unchanged keep their per-node status
+		if len(test.expectedRequests) == 0 && !reflect.DeepEqual(updated.Status.Nodes, test.nodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.nodes, updated.Status.Nodes)
+		}
+		if !reflect.DeepEqual(updated.Status.LastAppliedCacheSpec, test.cacheSpec) {
+			t.Errorf("Test: %s failed: expectedLastAppliedCacheSpec=%+v, actualLastAppliedCacheSpec=%+v",
+				test.name, test.cacheSpec, updated.Status.LastAppliedCacheSpec)
+		}
+	}
+}
+
+func TestSyncHandlerPruneRemovedImages(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"kubernetes.io/hostname": "node2"}}},
+	}
+	now := metav1.Now()
+	tests := []struct {
+		name             string
+		prune            bool
+		otherDeleted     bool
+		expectedRequests []string
+	}{
+		{
+			name:             "#1: Removed image is deleted from the nodes it is cached on, unless cached by another image cache",
+			prune:            true,
+			expectedRequests: []string{"node1 bar:v1"},
+		},
+		{
+			name:             "#2: Image cache being deleted does not keep the removed image",
+			prune:            true,
+			otherDeleted:     true,
+			expectedRequests: []string{"node1 bar:v1", "node2 bar:v1"},
+		},
+		{
+			name:             "#3: Removed image is kept without pruning",
+			expectedRequests: []string{},
+		},
+	}
+	for _, test := range tests {
+		cacheSpec := []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}}
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       kubefledgedv1alpha3.ImageCacheSpec{CacheSpec: cacheSpec, PruneRemovedImages: test.prune},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Nodes: []kubefledgedv1alpha3.NodeStatus{
+					{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+						{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+						{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+					}},
+					{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+						{Image: "bar:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+						{Image: "baz:v1", State: kubefledgedv1alpha3.NodeImageStateFailed},
+					}},
+				},
+				LastAppliedCacheSpec: cacheSpec,
+			},
+		}
+		otherImageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{
+					Images:       []kubefledgedv1alpha3.Image{{Name: "bar:v1"}},
+					NodeSelector: map[string]string{"kubernetes.io/hostname": "node2"},
+				}},
+			},
+		}
+		if test.otherDeleted {
+			otherImageCache.DeletionTimestamp = &now
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		imagecacheInformer.Informer().GetIndexer().Add(otherImageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType:      images.ImageCacheUpdate,
+			ObjKey:        "kube-fledged/foo",
+			OldImageCache: imageCache,
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		// foo:v1 is pulled to node2, followed by an empty request signalling the end of the sync action
+		requests := []string{}
+		for {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			if ipr.WorkType == images.ImageCachePurge {
+				requests = append(requests, ipr.Node.Name+" "+ipr.Image)
+			}
+		}
+		sort.Strings(requests)
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+	}
+}
+
+func TestSyncHandlerClusterImageCache(t *testing.T) {
+	tests := []struct {
+		name             string
+		workType         images.WorkType
+		results          map[string]images.ImageWorkResult
+		expectedStatus   kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedRequests int
+	}{
+		{
+			name:             "#1: Create - Jobs of the cluster image cache are created in the cluster image cache namespace",
+			workType:         images.ImageCacheCreate,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedRequests: 1,
+		},
+		{
+			name:             "#2: Refresh",
+			workType:         images.ImageCacheRefresh,
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedRequests: 1,
+		},
+		{
+			name:     "#3: StatusUpdate - Images pulled",
+			workType: images.ImageCacheStatusUpdate,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+			},
+			expectedStatus: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+		},
+	}
+	for _, test := range tests {
+		clusterImageCache := &kubefledgedv1alpha3.ClusterImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+				},
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate},
+		}
+		// an image cache of the same name in the cluster image cache namespace is left as it is
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "cache-jobs"},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(clusterImageCache, imageCache)
+		controller, nodeInformer, imagecacheInformer, clusterimagecacheInformer := newTestClusterController(fakekubeclientset, fakefledgedclientset)
+		controller.clusterImageCacheNamespace = "cache-jobs"
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		clusterimagecacheInformer.Informer().GetIndexer().Add(clusterImageCache)
+		wqKey := images.WorkQueueKey{WorkType: test.workType, ObjKey: "foo"}
+		if test.results != nil {
+			wqKey.Status = &test.results
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ClusterImageCaches().Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, updated.Status.Status)
+		}
+		untouched, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("cache-jobs").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if !reflect.DeepEqual(untouched.Status, kubefledgedv1alpha3.ImageCacheStatus{}) {
+			t.Errorf("Test: %s failed: expectedImageCacheStatus=%+v, actualImageCacheStatus=%+v",
+				test.name, kubefledgedv1alpha3.ImageCacheStatus{}, untouched.Status)
+		}
+		requests := 0
+		for i := 0; i < test.expectedRequests; i++ {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			requests++
+			if ipr.Imagecache.Namespace != "cache-jobs" || !kubefledgedv1alpha3.IsClusterImageCache(ipr.Imagecache) {
+				t.Errorf("Test: %s failed: expectedNamespace=cache-jobs, expectedKind=%s, actualNamespace=%s, actualKind=%s",
+					test.name, kubefledgedv1alpha3.ClusterImageCacheKind, ipr.Imagecache.Namespace, ipr.Imagecache.Kind)
+			}
+			if key, _ := images.ImageCacheKey(ipr.Imagecache); key != "foo" {
+				t.Errorf("Test: %s failed: expectedKey=foo, actualKey=%s", test.name, key)
+			}
+		}
+		if requests != test.expectedRequests {
+			t.Errorf("Test: %s failed: expectedRequests=%d, actualRequests=%d", test.name, test.expectedRequests, requests)
+		}
+	}
+}
+
+func TestEnqueueClusterImageCache(t *testing.T) {
+	clusterImageCache := &kubefledgedv1alpha3.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+			},
+		},
+	}
+	controller, _, _, clusterimagecacheInformer := newTestClusterController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+	if !controller.enqueueImageCache(images.ImageCacheCreate, nil, controller.imageCacheFromCluster(clusterImageCache)) {
+		t.Fatalf("Test: Enqueue cluster image cache failed: expectedQueued=true, actualQueued=false")
+	}
+	item, _ := controller.workqueue.Get()
+	controller.workqueue.Done(item)
+	if key := item.(images.WorkQueueKey).ObjKey; key != "foo" {
+		t.Errorf("Test: Enqueue cluster image cache failed: expectedKey=foo, actualKey=%s", key)
+	}
+
+	// cluster image caches are refreshed by the refresh worker along with the image caches
+	clusterImageCache.Status.Status = kubefledgedv1alpha3.ImageCacheActionStatusSucceeded
+	clusterimagecacheInformer.Informer().GetIndexer().Add(clusterImageCache)
+	controller.runRefreshWorker()
+	item, _ = controller.workqueue.Get()
+	controller.workqueue.Done(item)
+	if wqKey := item.(images.WorkQueueKey); wqKey.ObjKey != "foo" || wqKey.WorkType != images.ImageCacheRefresh {
+		t.Errorf("Test: Refresh cluster image cache failed: expectedKey=foo, expectedWorkType=%s, actualKey=%s, actualWorkType=%s",
+			images.ImageCacheRefresh, wqKey.ObjKey, wqKey.WorkType)
+	}
+}
+
+func TestWarmNodes(t *testing.T) {
+	newNode := func(name string, ready corev1.ConditionStatus, labels map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	newImageCache := func(name string, nodeSelector map[string]string) *kubefledgedv1alpha3.ImageCache {
+		return &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{
+					Images:       []kubefledgedv1alpha3.Image{{Name: "foo:v1"}},
+					NodeSelector: nodeSelector,
+				}},
+			},
+		}
+	}
+	tests := []struct {
+		name         string
+		nodes        []*corev1.Node
+		imageCaches  []*kubefledgedv1alpha3.ImageCache
+		expectedKeys []string
+	}{
+		{
+			name:         "#1: New node matching the node selector of an image cache",
+			nodes:        []*corev1.Node{newNode("gpu1", corev1.ConditionTrue, map[string]string{"accelerator": "nvidia"})},
+			imageCaches:  []*kubefledgedv1alpha3.ImageCache{newImageCache("foo", map[string]string{"accelerator": "nvidia"})},
+			expectedKeys: []string{"kube-fledged/foo gpu1"},
+		},
+		{
+			name:         "#2: New node matching no image cache",
+			nodes:        []*corev1.Node{newNode("cpu1", corev1.ConditionTrue, nil)},
+			imageCaches:  []*kubefledgedv1alpha3.ImageCache{newImageCache("foo", map[string]string{"accelerator": "nvidia"})},
+			expectedKeys: []string{},
+		},
+		{
+			name:         "#3: New node not ready",
+			nodes:        []*corev1.Node{newNode("gpu1", corev1.ConditionFalse, map[string]string{"accelerator": "nvidia"})},
+			imageCaches:  []*kubefledgedv1alpha3.ImageCache{newImageCache("foo", map[string]string{"accelerator": "nvidia"})},
+			expectedKeys: []string{},
+		},
+		{
+			name: "#4: Nodes joining together warm each image cache once",
+			nodes: []*corev1.Node{
+				newNode("gpu1", corev1.ConditionTrue, map[string]string{"accelerator": "nvidia"}),
+				newNode("gpu2", corev1.ConditionTrue, map[string]string{"accelerator": "nvidia"}),
+				newNode("cpu1", corev1.ConditionTrue, nil),
+			},
+			imageCaches: []*kubefledgedv1alpha3.ImageCache{
+				newImageCache("foo", map[string]string{"accelerator": "nvidia"}),
+				newImageCache("bar", nil),
+			},
+			expectedKeys: []string{"kube-fledged/bar cpu1,gpu1,gpu2", "kube-fledged/foo gpu1,gpu2"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.nodeWarmingDelay = 10 * time.Millisecond
+		for _, imageCache := range test.imageCaches {
+			imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		}
+		for _, n := range test.nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+			controller.enqueueNode(n, "add")
+			// a node seen again is not warmed again
+			controller.enqueueNode(n, "update")
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys := []string{}
+		for controller.workqueue.Len() > 0 {
+			item, _ := controller.workqueue.Get()
+			wqKey := item.(images.WorkQueueKey)
+			controller.workqueue.Done(item)
+			if wqKey.WorkType != images.ImageCacheRefresh {
+				t.Errorf("Test: %s failed: expectedWorkType=%s, actualWorkType=%s", test.name, images.ImageCacheRefresh, wqKey.WorkType)
+			}
+			keys = append(keys, wqKey.ObjKey+" "+wqKey.Nodes)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, test.expectedKeys) {
+			t.Errorf("Test: %s failed: expectedKeys=%v, actualKeys=%v", test.name, test.expectedKeys, keys)
+		}
+	}
+}
+
+func TestSyncHandlerWarmNodes(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"kubernetes.io/hostname": "node2"}}},
+	}
+	cached := []kubefledgedv1alpha3.NodeStatus{
+		{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+			{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+		}},
+	}
+	tests := []struct {
+		name             string
+		nodes            string
+		expectedRequests []string
+		expectedNodes    []kubefledgedv1alpha3.NodeStatus
+	}{
+		{
+			name:             "#1: Images pulled only to the new node",
+			nodes:            "node2",
+			expectedRequests: []string{"node2 foo:v1"},
+			expectedNodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached},
+				}},
+				{Node: "node2", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+		{
+			name:             "#2: Images already cached on the node",
+			nodes:            "node1",
+			expectedRequests: []string{},
+			expectedNodes:    cached,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+				Nodes:  cached,
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType: images.ImageCacheRefresh,
+			ObjKey:   "kube-fledged/foo",
+			Nodes:    test.nodes,
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		// the requests are followed by an empty request signalling the end of the sync action,
+		// and no request is placed if the images are already cached
+		requests := []string{}
+		for len(test.expectedRequests) > 0 {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			requests = append(requests, ipr.Node.Name+" "+ipr.Image)
+		}
+		if len(test.expectedRequests) == 0 {
+			time.Sleep(50 * time.Millisecond)
+			if n := controller.imageworkqueue.Len(); n != 0 {
+				t.Errorf("Test: %s failed: expectedRequests=0, actualRequests=%d", test.name, n)
+			}
+		}
+		sort.Strings(requests)
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		actual, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		for i := range actual.Status.Nodes {
+			for j := range actual.Status.Nodes[i].Images {
+				actual.Status.Nodes[i].Images[j].LastTransitionTime = metav1.Time{}
+			}
+		}
+		if !reflect.DeepEqual(actual.Status.Nodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%+v, actualNodes=%+v", test.name, test.expectedNodes, actual.Status.Nodes)
+		}
+	}
+}
+
+func TestSyncHandlerImagePriority(t *testing.T) {
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}}},
+	}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "envoy:v1"}, {Name: "app:v1", Priority: 10}}},
+				{Images: []kubefledgedv1alpha3.Image{{Name: "fluentd:v1"}, {Name: "init:v1", Priority: 5}, {Name: "statsd:v1", Priority: -1}}},
+			},
+		},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+	controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	controller.recorder = record.NewFakeRecorder(10)
+	// requests are placed in the imageworkqueue in order, without delay
+	controller.imageworkqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 1))
+	for _, n := range nodes {
+		nodeInformer.Informer().GetIndexer().Add(n)
+	}
+	imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+	if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"}); err != nil {
+		t.Fatalf("Test: Image priority failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	expectedImages := []string{"app:v1", "init:v1", "envoy:v1", "fluentd:v1", "statsd:v1"}
+	actualImages := []string{}
+	for {
+		item, _ := controller.imageworkqueue.Get()
+		ipr := item.(images.ImageWorkRequest)
+		controller.imageworkqueue.Done(item)
+		if ipr.Node == nil {
+			break
+		}
+		actualImages = append(actualImages, ipr.Image)
+	}
+	if !reflect.DeepEqual(actualImages, expectedImages) {
+		t.Errorf("Test: Image priority failed: expectedImages=%v, actualImages=%v", expectedImages, actualImages)
+	}
+}
+
+func TestSyncRateLimiter(t *testing.T) {
+	rateLimiter := newSyncRateLimiter()
+	item := images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"}
+	previous := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		minDelay := syncRetryBaseDelay << i
+		maxDelay := time.Duration(float64(minDelay) * (1 + syncRetryJitter))
+		delay := rateLimiter.When(item)
+		if delay < minDelay || delay > maxDelay || delay <= previous {
+			t.Errorf("Test: Retry %d failed: expectedDelay=[%s, %s] and longer than %s, actualDelay=%s", i, minDelay, maxDelay, previous, delay)
+		}
+		previous = delay
+	}
+	if n := rateLimiter.NumRequeues(item); n != 10 {
+		t.Errorf("Test: NumRequeues failed: expectedNumRequeues=10, actualNumRequeues=%d", n)
+	}
+	rateLimiter.Forget(item)
+	if delay := rateLimiter.When(item); delay > time.Duration(float64(syncRetryBaseDelay)*(1+syncRetryJitter)) {
+		t.Errorf("Test: Forget failed: expectedDelay<=%s, actualDelay=%s", syncRetryBaseDelay, delay)
+	}
+}
+
+func TestProcessNextWorkItemRetries(t *testing.T) {
+	tests := []struct {
+		name            string
+		failures        int
+		expectedRetries int32
+	}{
+		{
+			name:            "#1: Sync succeeding at once",
+			failures:        0,
+			expectedRetries: 0,
+		},
+		{
+			name:            "#2: Sync retried while the API server throttles requests",
+			failures:        3,
+			expectedRetries: 3,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		failures := 0
+		fakefledgedclientset.PrependReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			if failures < test.failures {
+				failures++
+				return true, nil, apierrors.NewTooManyRequests("the server has received too many requests", 1)
+			}
+			return false, nil, nil
+		})
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		wqKey := images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"}
+		controller.workqueue.Add(wqKey)
+
+		// each failed sync is requeued, to be retried after a longer delay
+		synced := []time.Time{}
+		for i := 0; i <= test.failures; i++ {
+			controller.processNextWorkItem()
+			synced = append(synced, time.Now())
+		}
+		for i := 1; i < len(synced); i++ {
+			if minDelay := syncRetryBaseDelay << (i - 1); synced[i].Sub(synced[i-1]) < minDelay {
+				t.Errorf("Test: %s failed: retry=%d, expectedMinDelay=%s, actualDelay=%s", test.name, i, minDelay, synced[i].Sub(synced[i-1]))
+			}
+		}
+		if n := controller.workqueue.NumRequeues(wqKey); n != 0 {
+			t.Errorf("Test: %s failed: expectedNumRequeues=0, actualNumRequeues=%d", test.name, n)
+		}
+		actual, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if actual.Status.Retries != test.expectedRetries || actual.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusProcessing {
+			t.Errorf("Test: %s failed: expectedRetries=%d, expectedStatus=%s, actualRetries=%d, actualStatus=%s", test.name,
+				test.expectedRetries, kubefledgedv1alpha3.ImageCacheActionStatusProcessing, actual.Status.Retries, actual.Status.Status)
+		}
+	}
+}
+
+// kstatus computes the status of an image cache as GitOps tools read it by the kstatus rules
+func kstatus(imageCache *kubefledgedv1alpha3.ImageCache) string {
+	if imageCache.Status.ObservedGeneration != imageCache.Generation ||
+		meta.IsStatusConditionTrue(imageCache.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionReconciling) {
+		return "InProgress"
+	}
+	if meta.IsStatusConditionTrue(imageCache.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionStalled) {
+		return "Failed"
+	}
+	return "Current"
+}
+
+func TestSyncHandlerKstatusConditions(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged", Generation: 2},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+			},
+		},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+	controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+
+	tests := []struct {
+		name                string
+		wqKey               images.WorkQueueKey
+		result              string
+		expectedKstatus     string
+		expectedReconciling bool
+		expectedStalled     bool
+	}{
+		{
+			name:                "#1: Image cache being created is in progress",
+			wqKey:               images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"},
+			expectedKstatus:     "InProgress",
+			expectedReconciling: true,
+		},
+		{
+			name:            "#2: Image cache whose image failed to be pulled has failed",
+			wqKey:           images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo"},
+			result:          images.ImageWorkResultStatusFailed,
+			expectedKstatus: "Failed",
+			expectedStalled: true,
+		},
+		{
+			name:                "#3: Image cache being refreshed is in progress",
+			wqKey:               images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"},
+			expectedKstatus:     "InProgress",
+			expectedReconciling: true,
+		},
+		{
+			name:            "#4: Image cache whose image is cached is current",
+			wqKey:           images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo"},
+			result:          images.ImageWorkResultStatusSucceeded,
+			expectedKstatus: "Current",
+		},
+	}
+	for _, test := range tests {
+		if test.result != "" {
+			results := map[string]images.ImageWorkResult{
+				"fakejob-1": {
+					Status:           test.result,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+			}
+			test.wqKey.Status = &results
+		}
+		if err := controller.syncHandler(test.wqKey); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if actual := kstatus(updated); actual != test.expectedKstatus || updated.Status.ObservedGeneration != 2 {
+			t.Errorf("Test: %s failed: expectedKstatus=%s, expectedObservedGeneration=2, actualKstatus=%s, actualObservedGeneration=%d",
+				test.name, test.expectedKstatus, actual, updated.Status.ObservedGeneration)
+		}
+		reconciling := meta.FindStatusCondition(updated.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionReconciling)
+		stalled := meta.FindStatusCondition(updated.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionStalled)
+		if (reconciling != nil) != test.expectedReconciling || (stalled != nil) != test.expectedStalled {
+			t.Errorf("Test: %s failed: expectedReconciling=%t, expectedStalled=%t, actualConditions=%+v",
+				test.name, test.expectedReconciling, test.expectedStalled, updated.Status.Conditions)
+		}
+		imagecacheInformer.Informer().GetIndexer().Update(updated)
+	}
+
+	// a spec not yet applied to the nodes is in progress
+	updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+	updated.Generation = 3
+	if actual := kstatus(updated); actual != "InProgress" {
+		t.Errorf("Test: Updated spec failed: expectedKstatus=InProgress, actualKstatus=%s", actual)
+	}
+}
+
+func TestSyncHandlerPurgeImage(t *testing.T) {
+	tests := []struct {
+		name             string
+		image            string
+		expectedRequests []string
+		expectedStatus   kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedReason   string
+	}{
+		{
+			name:             "#1: Only the delete jobs of the image are created",
+			image:            "foo:v1",
+			expectedRequests: []string{"foo:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImagePurge,
+		},
+		{
+			name:             "#2: Image given in another form of its reference",
+			image:            "docker.io/library/foo:v1",
+			expectedRequests: []string{"foo:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImagePurge,
+		},
+		{
+			name:             "#3: Image not in the cacheSpec fails the purge",
+			image:            "redis:7",
+			expectedRequests: []string{},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImageNotInCacheSpec,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "kube-fledged",
+				Annotations: map[string]string{kubefledgedv1alpha3.ImageCachePurgeImageAnnotationKey: test.image},
+			},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}, {Name: "bar:v1"}}},
+				},
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.imageworkqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 1))
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{
+			WorkType: images.ImageCachePurge,
+			ObjKey:   "kube-fledged/foo",
+			Image:    test.image,
+		})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		requests := []string{}
+		for controller.imageworkqueue.Len() > 0 {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			if ipr.WorkType != images.ImageCachePurge {
+				t.Errorf("Test: %s failed: expectedWorkType=%s, actualWorkType=%s", test.name, images.ImageCachePurge, ipr.WorkType)
+			}
+			requests = append(requests, ipr.Image)
+		}
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus || updated.Status.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, actualStatus=%s, actualReason=%s",
+				test.name, test.expectedStatus, test.expectedReason, updated.Status.Status, updated.Status.Reason)
+		}
+		// a purge of a single image keeps the cacheSpec applied to the nodes
+		if test.expectedStatus == kubefledgedv1alpha3.ImageCacheActionStatusProcessing && len(updated.Status.LastAppliedCacheSpec) != 1 {
+			t.Errorf("Test: %s failed: expectedLastAppliedCacheSpec=%+v, actualLastAppliedCacheSpec=%+v",
+				test.name, imageCache.Spec.CacheSpec, updated.Status.LastAppliedCacheSpec)
+		}
+		// the annotation of an image not in the cacheSpec is removed at once
+		if _, ok := updated.Annotations[kubefledgedv1alpha3.ImageCachePurgeImageAnnotationKey]; ok != (test.expectedStatus == kubefledgedv1alpha3.ImageCacheActionStatusProcessing) {
+			t.Errorf("Test: %s failed: expectedAnnotation=%t, actualAnnotations=%+v",
+				test.name, test.expectedStatus == kubefledgedv1alpha3.ImageCacheActionStatusProcessing, updated.Annotations)
+		}
+	}
+}
+
+func TestParseImageList(t *testing.T) {
+	tests := []struct {
+		name              string
+		data              string
+		expectedImages    []string
+		expectedErrString string
+	}{
+		{
+			name:           "#1: One image per line",
+			data:           "# generated by the build pipeline\nnginx:1.25\n\n  redis:7  \n",
+			expectedImages: []string{"nginx:1.25", "redis:7"},
+		},
+		{
+			name:           "#2: JSON array of images",
+			data:           ` ["nginx:1.25", "redis:7"] `,
+			expectedImages: []string{"nginx:1.25", "redis:7"},
+		},
+		{
+			name:           "#3: No images",
+			data:           "# nothing to cache yet\n",
+			expectedImages: []string{},
+		},
+		{
+			name:              "#4: Invalid JSON array",
+			data:              `["nginx:1.25",`,
+			expectedErrString: "invalid JSON array of images",
+		},
+		{
+			name:              "#5: Invalid image reference",
+			data:              "nginx:1.25\nNGINX:1.25\n",
+			expectedErrString: "invalid image reference \"NGINX:1.25\"",
+		},
+	}
+	for _, test := range tests {
+		imgs, err := parseImageList(test.data)
+		if test.expectedErrString != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErrString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(imgs, test.expectedImages) {
+			t.Errorf("Test: %s failed: expectedImages=%v, actualImages=%v", test.name, test.expectedImages, imgs)
+		}
+	}
+}
+
+// newConfigMapLister returns a lister of the ConfigMaps
+func newConfigMapLister(configMaps ...*corev1.ConfigMap) corelisters.ConfigMapLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, configMap := range configMaps {
+		indexer.Add(configMap)
+	}
+	return corelisters.NewConfigMapLister(indexer)
+}
+
+func TestSyncHandlerImageListFrom(t *testing.T) {
+	tests := []struct {
+		name              string
+		configMap         *corev1.ConfigMap
+		key               string
+		expectedRequests  []string
+		expectedStatus    kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedReason    string
+		expectedErrString string
+	}{
+		{
+			name: "#1: Images of every key of the ConfigMap are pulled with the images of the cacheSpec",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace},
+				Data:       map[string]string{"app": "bar:v1\nbaz:v1\n", "sidecars": "baz:v1\nqux:v1\n"},
+			},
+			expectedRequests: []string{"bar:v1", "baz:v1", "foo:v1", "qux:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name: "#2: Images of the given key as a JSON array",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace},
+				Data:       map[string]string{"images.json": `["bar:v1"]`, "other": "baz:v1"},
+			},
+			key:              "images.json",
+			expectedRequests: []string{"bar:v1", "foo:v1"},
+			expectedStatus:   kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			expectedReason:   kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name:              "#3: ConfigMap not found",
+			expectedRequests:  []string{},
+			expectedStatus:    kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageListInvalid,
+			expectedErrString: kubefledgedv1alpha3.ImageCacheMessageImageListInvalid + ": error getting configmap images",
+		},
+		{
+			name: "#4: Invalid image in the ConfigMap",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace},
+				Data:       map[string]string{"app": "bar:v1\nBAR:v1\n"},
+			},
+			expectedRequests:  []string{},
+			expectedStatus:    kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedReason:    kubefledgedv1alpha3.ImageCacheReasonImageListInvalid,
+			expectedErrString: kubefledgedv1alpha3.ImageCacheMessageImageListInvalid + ": key app of configmap images: invalid image reference \"BAR:v1\"",
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}},
+				},
+				ImageListFrom: &kubefledgedv1alpha3.ImageListSource{
+					ConfigMapRef: &kubefledgedv1alpha3.ConfigMapImageListReference{Name: "images", Key: test.key},
+				},
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		controller.imageworkqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 1))
+		if test.configMap != nil {
+			controller.configMapsLister = newConfigMapLister(test.configMap)
+		}
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheCreate, ObjKey: "kube-fledged/foo"})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		requests := []string{}
+		for controller.imageworkqueue.Len() > 0 {
+			item, _ := controller.imageworkqueue.Get()
+			ipr := item.(images.ImageWorkRequest)
+			controller.imageworkqueue.Done(item)
+			if ipr.Node == nil {
+				break
+			}
+			requests = append(requests, ipr.Image)
+		}
+		sort.Strings(requests)
+		if !reflect.DeepEqual(requests, test.expectedRequests) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, actualRequests=%v", test.name, test.expectedRequests, requests)
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus || updated.Status.Reason != test.expectedReason ||
+			!strings.HasPrefix(updated.Status.Message, test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, expectedMessage=%s, actualStatus=%s, actualReason=%s, actualMessage=%s",
+				test.name, test.expectedStatus, test.expectedReason, test.expectedErrString, updated.Status.Status, updated.Status.Reason, updated.Status.Message)
+		}
+		// the images of the list are applied to the nodes, but not added to the spec of the image cache
+		if len(updated.Spec.CacheSpec) != 1 {
+			t.Errorf("Test: %s failed: expectedCacheSpec=%+v, actualCacheSpec=%+v", test.name, imageCache.Spec.CacheSpec, updated.Spec.CacheSpec)
+		}
+		if test.expectedStatus == kubefledgedv1alpha3.ImageCacheActionStatusProcessing && len(updated.Status.LastAppliedCacheSpec) != 2 {
+			t.Errorf("Test: %s failed: expectedLastAppliedImageLists=2, actualLastAppliedCacheSpec=%+v", test.name, updated.Status.LastAppliedCacheSpec)
+		}
+	}
+}
+
+func TestEnqueueConfigMap(t *testing.T) {
+	imageList := func(name, configMap string) *kubefledgedv1alpha3.ImageCache {
+		return &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				ImageListFrom: &kubefledgedv1alpha3.ImageListSource{
+					ConfigMapRef: &kubefledgedv1alpha3.ConfigMapImageListReference{Name: configMap},
+				},
+			},
+		}
+	}
+	oldConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace, ResourceVersion: "1"},
+		Data:       map[string]string{"images": "bar:v1"},
+	}
+	tests := []struct {
+		name         string
+		newConfigMap *corev1.ConfigMap
+		expectedKeys []string
+	}{
+		{
+			name: "#1: Image caches reading the changed ConfigMap are updated",
+			newConfigMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace, ResourceVersion: "2"},
+				Data:       map[string]string{"images": "bar:v1\nbaz:v1"},
+			},
+			expectedKeys: []string{"kube-fledged/foo"},
+		},
+		{
+			name: "#2: ConfigMap whose data did not change",
+			newConfigMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: fledgedNameSpace, ResourceVersion: "2",
+					Labels: map[string]string{"team": "web"}},
+				Data: map[string]string{"images": "bar:v1"},
+			},
+			expectedKeys: []string{},
+		},
+		{
+			name: "#3: ConfigMap of the same name in another namespace",
+			newConfigMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "images", Namespace: "default", ResourceVersion: "2"},
+				Data:       map[string]string{"images": "bar:v1\nbaz:v1"},
+			},
+			expectedKeys: []string{},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.workqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 1))
+		imagecacheInformer.Informer().GetIndexer().Add(imageList("foo", "images"))
+		imagecacheInformer.Informer().GetIndexer().Add(imageList("bar", "other-images"))
+		controller.enqueueConfigMap(oldConfigMap, test.newConfigMap)
+
+		keys := []string{}
+		for controller.workqueue.Len() > 0 {
+			item, _ := controller.workqueue.Get()
+			wqKey := item.(images.WorkQueueKey)
+			controller.workqueue.Done(item)
+			if wqKey.WorkType != images.ImageCacheUpdate || wqKey.OldImageCache == nil {
+				t.Errorf("Test: %s failed: expectedWorkType=%s with the old image cache, actualWorkQueueKey=%+v", test.name, images.ImageCacheUpdate, wqKey)
+			}
+			keys = append(keys, wqKey.ObjKey)
+		}
+		if !reflect.DeepEqual(keys, test.expectedKeys) {
+			t.Errorf("Test: %s failed: expectedKeys=%v, actualKeys=%v", test.name, test.expectedKeys, keys)
+		}
+	}
+}
+
+func TestSyncHandlerRateLimited(t *testing.T) {
+	tests := []struct {
+		name               string
+		results            map[string]images.ImageWorkResult
+		expectedStatus     kubefledgedv1alpha3.ImageCacheActionStatus
+		expectedMessage    string
+		expectedRetryAfter time.Duration
+		expectedRefresh    bool
+	}{
+		{
+			name: "#1: Rate-limited pulls are retried after the longest retry-after",
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonRateLimited,
+					Message: "toomanyrequests: You have reached your pull rate limit", RetryAfter: time.Millisecond,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+				"fakejob-2": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonRateLimited,
+					Message: "429 Too Many Requests (retry-after=1)", RetryAfter: 10 * time.Millisecond,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+				"fakejob-3": {Status: images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "baz:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+			},
+			expectedStatus:     kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage:    kubefledgedv1alpha3.ImageCacheMessageImagePullRateLimited,
+			expectedRetryAfter: 10 * time.Millisecond,
+			expectedRefresh:    true,
+		},
+		{
+			name: "#2: Rate-limited pulls not retried",
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonRateLimited,
+					Message:          "toomanyrequests: You have reached your pull rate limit",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+			},
+			expectedStatus:  kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageImagePullRateLimited,
+		},
+		{
+			name: "#3: Other pull failures",
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: "Error", Message: "pull access denied",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+			},
+			expectedStatus:  kubefledgedv1alpha3.ImageCacheActionStatusFailed,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}, {Name: "bar:v1"}, {Name: "baz:v1"}}},
+				},
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.workqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 1))
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+
+		start := time.Now()
+		err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &test.results})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != test.expectedStatus || updated.Status.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedMessage=%s, actualStatus=%s, actualMessage=%s",
+				test.name, test.expectedStatus, test.expectedMessage, updated.Status.Status, updated.Status.Message)
+		}
+		if (updated.Status.RetryAfter != nil) != (test.expectedRetryAfter > 0) ||
+			(updated.Status.RetryAfter != nil && updated.Status.RetryAfter.Time.Before(start.Add(test.expectedRetryAfter))) {
+			t.Errorf("Test: %s failed: expectedRetryAfter=%s, actualRetryAfter=%v", test.name, test.expectedRetryAfter, updated.Status.RetryAfter)
+		}
+		// the image cache is not refreshed before the retry-after
+		if rateLimited(updated, start) != (test.expectedRetryAfter > 0) {
+			t.Errorf("Test: %s failed: expectedRateLimited=%t, actualRateLimited=%t", test.name, test.expectedRetryAfter > 0, rateLimited(updated, start))
+		}
+		if test.expectedRefresh {
+			time.Sleep(2 * test.expectedRetryAfter)
+		}
+		refreshes := []images.WorkQueueKey{}
+		for controller.workqueue.Len() > 0 {
+			item, _ := controller.workqueue.Get()
+			controller.workqueue.Done(item)
+			refreshes = append(refreshes, item.(images.WorkQueueKey))
+		}
+		if test.expectedRefresh && (len(refreshes) != 1 || refreshes[0].WorkType != images.ImageCacheRefresh) || !test.expectedRefresh && len(refreshes) != 0 {
+			t.Errorf("Test: %s failed: expectedRefresh=%t, actualWorkQueueKeys=%+v", test.name, test.expectedRefresh, refreshes)
+		}
+	}
+}
+
+func TestSyncHandlerHelperImageUnavailable(t *testing.T) {
+	const failure = "Helper image(s) senthilrch/busybox:1.35.0 could not be pulled onto node bar: manifest unknown"
+	tests := []struct {
+		name               string
+		reason             string
+		annotations        map[string]string
+		results            map[string]images.ImageWorkResult
+		expectedReason     string
+		expectedMessage    string
+		expectedAnnotation bool
+	}{
+		{
+			name:   "#1: Image cache stalled as the helper images are unavailable",
+			reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonHelperImageUnavailable, Message: failure,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+				"fakejob-2": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonHelperImageUnavailable, Message: failure,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+			},
+			expectedReason:  kubefledgedv1alpha3.ImageCacheReasonHelperImageUnavailable,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageHelperImageUnavailable,
+		},
+		{
+			name:        "#2: Refresh annotation removed from image cache whose helper images are unavailable",
+			reason:      kubefledgedv1alpha3.ImageCacheReasonImageCacheRefresh,
+			annotations: map[string]string{kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey: ""},
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: kubefledgedv1alpha3.ImageCacheReasonHelperImageUnavailable, Message: failure,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheRefresh, Node: &node}},
+			},
+			expectedReason:  kubefledgedv1alpha3.ImageCacheReasonHelperImageUnavailable,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageHelperImageUnavailable,
+		},
+		{
+			name:   "#3: Other pull failures",
+			reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			results: map[string]images.ImageWorkResult{
+				"fakejob-1": {Status: images.ImageWorkResultStatusFailed, Reason: "Error", Message: "pull access denied",
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo:v1", WorkType: images.ImageCacheCreate, Node: &node}},
+			},
+			expectedReason:  kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+			expectedMessage: kubefledgedv1alpha3.ImageCacheMessageImagePullFailedForSomeImages,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged", Annotations: test.annotations},
+			Spec: kubefledgedv1alpha3.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+					{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}, {Name: "bar:v1"}}},
+				},
+			},
+			Status: kubefledgedv1alpha3.ImageCacheStatus{
+				Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+				Reason: test.reason,
+			},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+
+		err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &test.results})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if updated.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusFailed || updated.Status.Reason != test.expectedReason ||
+			updated.Status.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, expectedMessage=%s, actualStatus=%s, actualReason=%s, actualMessage=%s",
+				test.name, kubefledgedv1alpha3.ImageCacheActionStatusFailed, test.expectedReason, test.expectedMessage,
+				updated.Status.Status, updated.Status.Reason, updated.Status.Message)
+		}
+		stalled := meta.FindStatusCondition(updated.Status.Conditions, kubefledgedv1alpha3.ImageCacheConditionStalled)
+		if stalled == nil || stalled.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expectedStalledReason=%s, actualStalledCondition=%+v", test.name, test.expectedReason, stalled)
+		}
+		if _, ok := updated.Annotations[kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey]; ok != test.expectedAnnotation {
+			t.Errorf("Test: %s failed: expectedRefreshAnnotation=%t, actualRefreshAnnotation=%t", test.name, test.expectedAnnotation, ok)
+		}
+	}
+}
+
+func TestUpdateImageCacheStatusConflicts(t *testing.T) {
+	tests := []struct {
+		name          string
+		conflicts     int
+		expectErr     bool
+		expectedNodes int
+	}{
+		{
+			name:          "#1: Status written at once",
+			conflicts:     0,
+			expectedNodes: 0,
+		},
+		{
+			name:          "#2: Status written again over concurrent writes of the per-node status",
+			conflicts:     3,
+			expectedNodes: 3,
+		},
+		{
+			name:      "#3: Conflicts outlasting the retries",
+			conflicts: 100,
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Status:     kubefledgedv1alpha3.ImageCacheStatus{Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing},
+		}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		gvr := kubefledgedv1alpha3.SchemeGroupVersion.WithResource("imagecaches")
+		conflicts := 0
+		fakefledgedclientset.PrependReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			if conflicts >= test.conflicts {
+				return false, nil, nil
+			}
+			// a concurrent reconcile writes the status of another node before this write lands
+			conflicts++
+			obj, _ := fakefledgedclientset.Tracker().Get(gvr, "kube-fledged", "foo")
+			latest := obj.(*kubefledgedv1alpha3.ImageCache).DeepCopy()
+			latest.Status.Nodes = append(latest.Status.Nodes, kubefledgedv1alpha3.NodeStatus{Node: fmt.Sprintf("node%d", conflicts)})
+			fakefledgedclientset.Tracker().Update(gvr, latest, "kube-fledged")
+			return true, nil, apierrors.NewConflict(gvr.GroupResource(), "foo", fmt.Errorf("the object has been modified"))
+		})
+		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		status := &kubefledgedv1alpha3.ImageCacheStatus{
+			Status: kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+			Reason: kubefledgedv1alpha3.ImageCacheReasonImagesPulledSuccessfully,
+		}
+		err := controller.updateImageCacheStatus(imageCache, status)
+		if test.expectErr {
+			if !apierrors.IsConflict(err) {
+				t.Errorf("Test: %s failed: expected a conflict, actualError=%v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		actual, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if actual.Status.Status != status.Status || actual.Status.Reason != status.Reason {
+			t.Errorf("Test: %s failed: expectedStatus=%s/%s, actualStatus=%s/%s", test.name,
+				status.Status, status.Reason, actual.Status.Status, actual.Status.Reason)
+		}
+		if len(actual.Status.Nodes) != test.expectedNodes {
+			t.Errorf("Test: %s failed: expectedNodes=%d, actualNodes=%+v", test.name, test.expectedNodes, actual.Status.Nodes)
+		}
+	}
+}
+
+func TestUpdateCachedImagesSummary(t *testing.T) {
+	nodeStatus := func(node string, states map[string]kubefledgedv1alpha3.NodeImageState) kubefledgedv1alpha3.NodeStatus {
+		ns := kubefledgedv1alpha3.NodeStatus{Node: node}
+		for image, state := range states {
+			ns.Images = append(ns.Images, kubefledgedv1alpha3.NodeImageStatus{Image: image, State: state})
+		}
+		return ns
+	}
+	cached := kubefledgedv1alpha3.NodeImageStateCached
+	teamA := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "team-a"},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{Nodes: []kubefledgedv1alpha3.NodeStatus{
+			nodeStatus("node1", map[string]kubefledgedv1alpha3.NodeImageState{"base:v1": cached, "app-a:v1": cached}),
+			nodeStatus("node2", map[string]kubefledgedv1alpha3.NodeImageState{"base:v1": cached, "app-a:v1": kubefledgedv1alpha3.NodeImageStateFailed}),
+		}},
+	}
+	teamB := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-b", Namespace: "team-b"},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{Nodes: []kubefledgedv1alpha3.NodeStatus{
+			nodeStatus("node2", map[string]kubefledgedv1alpha3.NodeImageState{"base:v1": cached}),
+			nodeStatus("node3", map[string]kubefledgedv1alpha3.NodeImageState{"base:v1": cached, "app-b:v1": kubefledgedv1alpha3.NodeImageStatePulling}),
+		}},
+	}
+	platform := &kubefledgedv1alpha3.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{Nodes: []kubefledgedv1alpha3.NodeStatus{
+			nodeStatus("node1", map[string]kubefledgedv1alpha3.NodeImageState{"agent:v1": cached}),
+			nodeStatus("node3", map[string]kubefledgedv1alpha3.NodeImageState{"agent:v1": cached}),
+		}},
+	}
+	tests := []struct {
+		name              string
+		configMapName     string
+		existing          []runtime.Object
+		imageCaches       []*kubefledgedv1alpha3.ImageCache
+		clusterImageCache *kubefledgedv1alpha3.ClusterImageCache
+		expectedSummary   map[string]int
+		expectedIndex     map[string][]string
+	}{
+		{
+			name:          "#1: Summary disabled",
+			configMapName: "",
+			imageCaches:   []*kubefledgedv1alpha3.ImageCache{teamA},
+		},
+		{
+			name:            "#2: No image caches",
+			configMapName:   "cached-images",
+			expectedSummary: map[string]int{},
+			expectedIndex:   map[string][]string{},
+		},
+		{
+			name:              "#3: Union of the images cached by image caches and cluster image caches",
+			configMapName:     "cached-images",
+			imageCaches:       []*kubefledgedv1alpha3.ImageCache{teamA, teamB},
+			clusterImageCache: platform,
+			expectedSummary:   map[string]int{"base:v1": 3, "app-a:v1": 1, "agent:v1": 2},
+			expectedIndex: map[string][]string{
+				"node1": {"agent:v1", "app-a:v1", "base:v1"},
+				"node2": {"base:v1"},
+				"node3": {"agent:v1", "base:v1"},
+			},
+		},
+		{
+			name:          "#4: Existing summary updated",
+			configMapName: "cached-images",
+			existing: []runtime.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cached-images", Namespace: fledgedNameSpace},
+				Data:       map[string]string{cachedImagesSummaryKey: `{"old:v1": 1}`},
+			}},
+			imageCaches:     []*kubefledgedv1alpha3.ImageCache{teamB},
+			expectedSummary: map[string]int{"base:v1": 2},
+			expectedIndex:   map[string][]string{"node2": {"base:v1"}, "node3": {"base:v1"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset(test.existing...)
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, imagecacheInformer, clusterimagecacheInformer := newTestClusterController(fakekubeclientset, fakefledgedclientset)
+		controller.cachedImagesConfigMap = test.configMapName
+		for _, imageCache := range test.imageCaches {
+			imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		}
+		if test.clusterImageCache != nil {
+			clusterimagecacheInformer.Informer().GetIndexer().Add(test.clusterImageCache)
+		}
+		if err := controller.updateCachedImagesSummary(); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		configMaps, _ := fakekubeclientset.CoreV1().ConfigMaps(fledgedNameSpace).List(context.TODO(), metav1.ListOptions{})
+		if test.expectedSummary == nil {
+			if len(configMaps.Items) != 0 {
+				t.Errorf("Test: %s failed: expected no configmap, actualConfigMaps=%+v", test.name, configMaps.Items)
+			}
+			continue
+		}
+		configMap, err := fakekubeclientset.CoreV1().ConfigMaps(fledgedNameSpace).Get(context.TODO(), test.configMapName, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		summary := map[string]int{}
+		if err := json.Unmarshal([]byte(configMap.Data[cachedImagesSummaryKey]), &summary); err != nil {
+			t.Errorf("Test: %s failed: invalid summary %q: %v", test.name, configMap.Data[cachedImagesSummaryKey], err)
+			continue
+		}
+		if !reflect.DeepEqual(summary, test.expectedSummary) {
+			t.Errorf("Test: %s failed: expectedSummary=%v, actualSummary=%v", test.name, test.expectedSummary, summary)
+		}
+		index := map[string][]string{}
+		if err := json.Unmarshal([]byte(configMap.Data[cachedImagesNodeIndexKey]), &index); err != nil {
+			t.Errorf("Test: %s failed: invalid node index %q: %v", test.name, configMap.Data[cachedImagesNodeIndexKey], err)
+			continue
+		}
+		if !reflect.DeepEqual(index, test.expectedIndex) {
+			t.Errorf("Test: %s failed: expectedIndex=%v, actualIndex=%v", test.name, test.expectedIndex, index)
+		}
+	}
+}
+
+func TestCachedImagesNodeIndexPullCompletion(t *testing.T) {
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"kubernetes.io/hostname": "node2"}}},
+	}
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{
+				{Images: []kubefledgedv1alpha3.Image{{Name: "nginx:1.25"}, {Name: "redis:7"}}},
+			},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			Status: kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			Reason: kubefledgedv1alpha3.ImageCacheReasonImageCacheCreate,
+		},
+	}
+	tests := []struct {
+		name          string
+		results       map[string]string
+		expectedIndex map[string][]string
+	}{
+		{
+			name:          "#1: Pulls not completed yet",
+			expectedIndex: map[string][]string{},
+		},
+		{
+			name: "#2: Succeeded pulls are indexed on their nodes",
+			results: map[string]string{
+				"node1 nginx:1.25": images.ImageWorkResultStatusSucceeded,
+				"node1 redis:7":    images.ImageWorkResultStatusAlreadyPulled,
+				"node2 nginx:1.25": images.ImageWorkResultStatusSucceededAfterRetries,
+			},
+			expectedIndex: map[string][]string{"node1": {"nginx:1.25", "redis:7"}, "node2": {"nginx:1.25"}},
+		},
+		{
+			name: "#3: Failed pulls are not indexed",
+			results: map[string]string{
+				"node1 nginx:1.25": images.ImageWorkResultStatusSucceeded,
+				"node1 redis:7":    images.ImageWorkResultStatusFailed,
+				"node2 nginx:1.25": images.ImageWorkResultStatusFailed,
+				"node2 redis:7":    images.ImageWorkResultStatusFailed,
+			},
+			expectedIndex: map[string][]string{"node1": {"nginx:1.25"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset()
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.recorder = record.NewFakeRecorder(10)
+		controller.cachedImagesConfigMap = "cached-images"
+		for i := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(&nodes[i])
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		if test.results != nil {
+			results := map[string]images.ImageWorkResult{}
+			i := 0
+			for pair, status := range test.results {
+				nodeName, image, _ := strings.Cut(pair, " ")
+				for j := range nodes {
+					if nodes[j].Name == nodeName {
+						results[fmt.Sprintf("fakejob-%d", i)] = images.ImageWorkResult{
+							Status:           status,
+							ImageWorkRequest: images.ImageWorkRequest{Image: image, WorkType: images.ImageCacheCreate, Node: &nodes[j]},
+						}
+					}
+				}
+				i++
+			}
+			if err := controller.syncHandler(images.WorkQueueKey{WorkType: images.ImageCacheStatusUpdate, ObjKey: "kube-fledged/foo", Status: &results}); err != nil {
+				t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+			// the informer observes the status written on completion of the pulls
+			updated, _ := fakefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+			imagecacheInformer.Informer().GetIndexer().Update(updated)
+		}
+		if err := controller.updateCachedImagesSummary(); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		configMap, err := fakekubeclientset.CoreV1().ConfigMaps(fledgedNameSpace).Get(context.TODO(), "cached-images", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		index := map[string][]string{}
+		if err := json.Unmarshal([]byte(configMap.Data[cachedImagesNodeIndexKey]), &index); err != nil {
+			t.Errorf("Test: %s failed: invalid node index %q: %v", test.name, configMap.Data[cachedImagesNodeIndexKey], err)
+			continue
+		}
+		if !reflect.DeepEqual(index, test.expectedIndex) {
+			t.Errorf("Test: %s failed: expectedIndex=%v, actualIndex=%v", test.name, test.expectedIndex, index)
+		}
+	}
+}
+
+func TestReconcilingKeys(t *testing.T) {
+	// processing records the items being processed, and blocks each item until released
+	type processing struct {
+		lock      sync.Mutex
+		active    map[string]int
+		maxActive map[string]int
+		processed []string
+		started   chan string
+		release   chan struct{}
+	}
+	newProcessing := func() *processing {
+		return &processing{
+			active:    map[string]int{},
+			maxActive: map[string]int{},
+			started:   make(chan string, 10),
+			release:   make(chan struct{}),
+		}
+	}
+	processItem := func(p *processing) func(interface{}) {
+		return func(obj interface{}) {
+			item := obj.(images.WorkQueueKey)
+			p.lock.Lock()
+			p.active[item.ObjKey]++
+			if p.active[item.ObjKey] > p.maxActive[item.ObjKey] {
+				p.maxActive[item.ObjKey] = p.active[item.ObjKey]
+			}
+			p.lock.Unlock()
+			p.started <- item.ObjKey + "/" + string(item.WorkType)
+			<-p.release
+			p.lock.Lock()
+			p.active[item.ObjKey]--
+			p.processed = append(p.processed, item.ObjKey+"/"+string(item.WorkType))
+			p.lock.Unlock()
+		}
+	}
+	waitStarted := func(p *processing, n int) []string {
+		started := []string{}
+		timeout := time.After(wait.ForeverTestTimeout)
+		for len(started) < n {
+			select {
+			case item := <-p.started:
+				started = append(started, item)
+			case <-timeout:
+				return started
+			}
+		}
+		return started
+	}
+
+	{
+		name := "#1: Different image caches are reconciled in parallel"
+		p := newProcessing()
+		r := newReconcilingKeys()
+		var workers sync.WaitGroup
+		for _, key := range []string{"kube-fledged/foo", "kube-fledged/bar", "default/foo"} {
+			workers.Add(1)
+			go func(key string) {
+				defer workers.Done()
+				r.process(key, images.WorkQueueKey{ObjKey: key, WorkType: images.ImageCacheCreate}, processItem(p))
+			}(key)
+		}
+		// every image cache is being reconciled before any is released
+		started := waitStarted(p, 3)
+		close(p.release)
+		workers.Wait()
+		if len(started) != 3 {
+			t.Errorf("Test: %s failed: expectedStarted=3, actualStarted=%v", name, started)
+		}
+		if len(r.parked) != 0 {
+			t.Errorf("Test: %s failed: expectedParked=map[], actualParked=%v", name, r.parked)
+		}
+	}
+
+	{
+		name := "#2: The same image cache is not reconciled concurrently, and its items are processed in order"
+		p := newProcessing()
+		r := newReconcilingKeys()
+		key := "kube-fledged/foo"
+		first := make(chan struct{})
+		go func() {
+			defer close(first)
+			r.process(key, images.WorkQueueKey{ObjKey: key, WorkType: images.ImageCacheCreate}, processItem(p))
+		}()
+		waitStarted(p, 1)
+		// the other workers park their items, and return without processing them
+		for _, workType := range []images.WorkType{images.ImageCacheUpdate, images.ImageCacheStatusUpdate} {
+			r.process(key, images.WorkQueueKey{ObjKey: key, WorkType: workType}, processItem(p))
+		}
+		for i := 0; i < 3; i++ {
+			p.release <- struct{}{}
+		}
+		<-first
+		expectedProcessed := []string{key + "/" + string(images.ImageCacheCreate), key + "/" + string(images.ImageCacheUpdate),
+			key + "/" + string(images.ImageCacheStatusUpdate)}
+		if !reflect.DeepEqual(p.processed, expectedProcessed) {
+			t.Errorf("Test: %s failed: expectedProcessed=%v, actualProcessed=%v", name, expectedProcessed, p.processed)
+		}
+		if p.maxActive[key] != 1 {
+			t.Errorf("Test: %s failed: expectedMaxActive=1, actualMaxActive=%d", name, p.maxActive[key])
+		}
+		if len(r.parked) != 0 {
+			t.Errorf("Test: %s failed: expectedParked=map[], actualParked=%v", name, r.parked)
+		}
+	}
+}
+
+// capturingLogger returns a logger of the given verbosity recording the key/value pairs of each log line
+func capturingLogger(verbosity int) (klog.Logger, *[]string) {
+	lines := &[]string{}
+	var lock sync.Mutex
+	logger := funcr.New(func(prefix, args string) {
+		lock.Lock()
+		defer lock.Unlock()
+		*lines = append(*lines, args)
+	}, funcr.Options{Verbosity: verbosity})
+	return logger, lines
+}
+
+func TestSyncHandlerStructuredLogging(t *testing.T) {
+	testNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}},
+	}
+	earlier := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	// foo:v1 is already cached, and bar:v1 added by the update
+	oldImageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		Spec: kubefledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+		},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			Status:               kubefledgedv1alpha3.ImageCacheActionStatusSucceeded,
+			LastAppliedCacheSpec: []kubefledgedv1alpha3.CacheSpecImages{{Images: []kubefledgedv1alpha3.Image{{Name: "foo:v1"}}}},
+			Nodes: []kubefledgedv1alpha3.NodeStatus{{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+				{Image: "foo:v1", State: kubefledgedv1alpha3.NodeImageStateCached, LastTransitionTime: earlier},
+			}}},
+		},
+	}
+	imageCache := oldImageCache.DeepCopy()
+	imageCache.Spec.CacheSpec[0].Images = append(imageCache.Spec.CacheSpec[0].Images, kubefledgedv1alpha3.Image{Name: "bar:v1"})
+	reconcile := `"imagecache"="kube-fledged/foo" "workType"="update"`
+	tests := []struct {
+		name             string
+		verbosity        int
+		expectedLines    []string
+		notExpectedLines []string
+	}{
+		{
+			name:      "#1: Reconcile logged with the image cache and work type",
+			verbosity: 0,
+			expectedLines: []string{
+				`"level"=0 "msg"="Starting to sync image cache" ` + reconcile,
+				`"level"=0 "msg"="Completed sync actions for image cache" ` + reconcile,
+			},
+			notExpectedLines: []string{
+				`"level"=4 "msg"="Image unchanged on node, so not pulled" ` + reconcile + ` "image"="foo:v1" "node"="node1"`,
+			},
+		},
+		{
+			name:      "#2: Verbose reconcile logged with the images and nodes",
+			verbosity: 4,
+			expectedLines: []string{
+				`"level"=0 "msg"="Starting to sync image cache" ` + reconcile,
+				`"level"=4 "msg"="Image unchanged on node, so not pulled" ` + reconcile + ` "image"="foo:v1" "node"="node1"`,
+				`"level"=0 "msg"="Completed sync actions for image cache" ` + reconcile,
+			},
+		},
+	}
+	for _, test := range tests {
+		logger, lines := capturingLogger(test.verbosity)
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache)
+		controller, nodeInformer, imagecacheInformer, _ := newTestClusterControllerWithLogger(fakekubeclientset, fakefledgedclientset, logger)
+		controller.recorder = record.NewFakeRecorder(10)
+		nodeInformer.Informer().GetIndexer().Add(testNode)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		wqKey := images.WorkQueueKey{WorkType: images.ImageCacheUpdate, ObjKey: "kube-fledged/foo", OldImageCache: oldImageCache}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for _, expected := range test.expectedLines {
+			if !containsLine(*lines, expected) {
+				t.Errorf("Test: %s failed: expectedLine=%s, actualLines=%q", test.name, expected, *lines)
+			}
+		}
+		for _, notExpected := range test.notExpectedLines {
+			if containsLine(*lines, notExpected) {
+				t.Errorf("Test: %s failed: notExpectedLine=%s, actualLines=%q", test.name, notExpected, *lines)
+			}
+		}
+	}
+}
+
+// containsLine checks whether one of the lines starts with prefix
+func containsLine(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeleteOrphanJobs(t *testing.T) {
+	imageCache := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+	}
+	clusterImageCache := &kubefledgedv1alpha3.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-foo", UID: "cluster-foo-uid"},
+	}
+	jobLabels := map[string]string{"app": "kubefledged", "kubefledged": "kubefledged-image-manager"}
+	ownedJob := func(name, kind, owner string, uid types.UID) *batchv1.Job {
+		isController := true
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: fledgedNameSpace, Labels: jobLabels,
+			OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: owner, UID: uid, Controller: &isController}}}}
+	}
+	labelledJob := func(name, namespace, imageCache string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "jobs",
+			Labels: map[string]string{"app": "kubefledged", "kubefledged": "kubefledged-image-manager",
+				"imagecache": imageCache, images.ImageCacheNamespaceLabelKey: namespace}}}
+	}
+	tests := []struct {
+		name            string
+		job             *batchv1.Job
+		expectedDeleted bool
+	}{
+		{
+			name:            "#1: Job of existing image cache is kept",
+			job:             ownedJob("job1", "ImageCache", "foo", "foo-uid"),
+			expectedDeleted: false,
+		},
+		{
+			name:            "#2: Job of deleted image cache is deleted",
+			job:             ownedJob("job2", "ImageCache", "bar", "bar-uid"),
+			expectedDeleted: true,
+		},
+		{
+			name:            "#3: Job of image cache deleted and recreated with the same name is deleted",
+			job:             ownedJob("job3", "ImageCache", "foo", "old-foo-uid"),
+			expectedDeleted: true,
+		},
+		{
+			name:            "#4: Job of existing cluster image cache is kept",
+			job:             ownedJob("job4", kubefledgedv1alpha3.ClusterImageCacheKind, "cluster-foo", "cluster-foo-uid"),
+			expectedDeleted: false,
+		},
+		{
+			name:            "#5: Job of deleted cluster image cache is deleted",
+			job:             ownedJob("job5", kubefledgedv1alpha3.ClusterImageCacheKind, "cluster-bar", "cluster-bar-uid"),
+			expectedDeleted: true,
+		},
+		{
+			name:            "#6: Job in the job namespace of existing image cache is kept",
+			job:             labelledJob("job6", fledgedNameSpace, "foo"),
+			expectedDeleted: false,
+		},
+		{
+			name:            "#7: Job in the job namespace of deleted image cache is deleted",
+			job:             labelledJob("job7", fledgedNameSpace, "bar"),
+			expectedDeleted: true,
+		},
+		{
+			name: "#8: Job of no image cache is kept",
+			job: &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job8", Namespace: fledgedNameSpace,
+				Labels: jobLabels}},
+			expectedDeleted: false,
+		},
+	}
+	objects := []runtime.Object{}
+	for _, test := range tests {
+		objects = append(objects, test.job)
+	}
+	fakekubeclientset := fakeclientset.NewSimpleClientset(objects...)
+	fakefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset(imageCache, clusterImageCache)
+	controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+
+	controller.deleteOrphanJobs()
+
+	for _, test := range tests {
+		_, err := fakekubeclientset.BatchV1().Jobs(test.job.Namespace).Get(context.TODO(), test.job.Name, metav1.GetOptions{})
+		if deleted := apierrors.IsNotFound(err); deleted != test.expectedDeleted {
+			t.Errorf("Test: %s failed: expectedDeleted=%t, actualDeleted=%t", test.name, test.expectedDeleted, deleted)
+		}
+	}
+}
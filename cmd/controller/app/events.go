@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EventReasonPullStarted is used as the Event 'reason' when image pulls of an ImageCache are started
+	EventReasonPullStarted = "PullStarted"
+	// EventReasonPullSucceeded is used as the Event 'reason' when images of an ImageCache are pulled
+	EventReasonPullSucceeded = "PullSucceeded"
+	// EventReasonPullFailed is used as the Event 'reason' when an image of an ImageCache fails to be pulled
+	EventReasonPullFailed = "PullFailed"
+	// EventReasonImageDeleteFailed is used as the Event 'reason' when an image of an ImageCache fails to be deleted
+	EventReasonImageDeleteFailed = "ImageDeleteFailed"
+)
+
+// maxEventNodes is the maximum number of nodes named in the message of an Event
+const maxEventNodes = 5
+
+// recordPullStartedEvent records a single Event for all the image pulls of a sync action
+func (c *Controller) recordPullStartedEvent(imageCache *v1alpha3.ImageCache, pulls map[string]map[string]bool) {
+	if len(pulls) == 0 {
+		return
+	}
+	nodes := map[string]bool{}
+	for _, imageNodes := range pulls {
+		for node := range imageNodes {
+			nodes[node] = true
+		}
+	}
+	c.recorder.Eventf(imageCache, corev1.EventTypeNormal, EventReasonPullStarted,
+		"Pulling %d image(s) to %d node(s)", len(pulls), len(nodes))
+}
+
+// recordImageWorkEvents records the Events for the results of the image pulls/deletes of a sync action.
+// Successful pulls are summarized in a single Event. Failures are recorded in one Event per image,
+// naming at most maxEventNodes of the nodes on which the image failed.
+func (c *Controller) recordImageWorkEvents(imageCache *v1alpha3.ImageCache, results map[string]images.ImageWorkResult) {
+	pulledImages := map[string]bool{}
+	pulledNodes := map[string]bool{}
+	pullFailures := map[string][]string{}
+	deleteFailures := map[string][]string{}
+	for _, v := range results {
+		hostname := v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"]
+		failed := v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown
+		switch {
+		case v.ImageWorkRequest.WorkType == images.ImageCachePurge && failed:
+			deleteFailures[v.ImageWorkRequest.Image] = append(deleteFailures[v.ImageWorkRequest.Image], hostname)
+		case v.ImageWorkRequest.WorkType == images.ImageCachePurge:
+		case failed:
+			pullFailures[v.ImageWorkRequest.Image] = append(pullFailures[v.ImageWorkRequest.Image], hostname)
+		case v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusSucceededAfterRetries:
+			pulledImages[v.ImageWorkRequest.Image] = true
+			pulledNodes[hostname] = true
+		}
+	}
+	if len(pulledImages) > 0 {
+		c.recorder.Eventf(imageCache, corev1.EventTypeNormal, EventReasonPullSucceeded,
+			"Pulled %d image(s) to %d node(s)", len(pulledImages), len(pulledNodes))
+	}
+	for _, image := range sortedKeys(pullFailures) {
+		c.recorder.Eventf(imageCache, corev1.EventTypeWarning, EventReasonPullFailed,
+			"Failed to pull image %s to node(s) %s", image, summarizeNodes(pullFailures[image]))
+	}
+	for _, image := range sortedKeys(deleteFailures) {
+		c.recorder.Eventf(imageCache, corev1.EventTypeWarning, EventReasonImageDeleteFailed,
+			"Failed to delete image %s from node(s) %s", image, summarizeNodes(deleteFailures[image]))
+	}
+}
+
+// summarizeNodes returns the sorted list of nodes, truncated to maxEventNodes
+func summarizeNodes(nodes []string) string {
+	sort.Strings(nodes)
+	if len(nodes) <= maxEventNodes {
+		return strings.Join(nodes, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(nodes[:maxEventNodes], ", "), len(nodes)-maxEventNodes)
+}
+
+// sortedKeys returns the keys of the map in sorted order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// imageCacheFinalizer keeps an image cache with deleteImagesOnCacheDeletion from being
+// removed until its images are deleted from the nodes
+const imageCacheFinalizer = "kubefledged.io/delete-images"
+
+// jobsFinalizer keeps an image cache whose jobs are created in the job namespace, and so
+// are not owned by it, from being removed until its jobs are deleted
+const jobsFinalizer = "kubefledged.io/delete-jobs"
+
+// hasFinalizer checks whether the image cache has the finalizer of kube-fledged
+func hasFinalizer(imageCache *v1alpha3.ImageCache) bool {
+	return containsFinalizer(imageCache, imageCacheFinalizer)
+}
+
+// hasJobsFinalizer checks whether the image cache has the finalizer deleting its jobs
+func hasJobsFinalizer(imageCache *v1alpha3.ImageCache) bool {
+	return containsFinalizer(imageCache, jobsFinalizer)
+}
+
+// containsFinalizer checks whether the image cache has the finalizer
+func containsFinalizer(imageCache *v1alpha3.ImageCache, finalizer string) bool {
+	for _, f := range imageCache.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// deletionPending checks whether the image cache is being deleted and its images are yet to be deleted
+func deletionPending(imageCache *v1alpha3.ImageCache) bool {
+	return imageCache.DeletionTimestamp != nil && hasFinalizer(imageCache) &&
+		imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing
+}
+
+// jobsCleanupPending checks whether the image cache is being deleted and its jobs are yet to be
+// deleted. The jobs are deleted once its images are.
+func jobsCleanupPending(imageCache *v1alpha3.ImageCache) bool {
+	return imageCache.DeletionTimestamp != nil && hasJobsFinalizer(imageCache) && !hasFinalizer(imageCache) &&
+		imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing
+}
+
+// syncFinalizer adds the finalizer to an image cache with deleteImagesOnCacheDeletion,
+// and removes it from an image cache without. Likewise, the jobs finalizer is added to
+// an image cache whose jobs are not owned by it.
+func (c *Controller) syncFinalizer(imageCache *v1alpha3.ImageCache) error {
+	deleteJobs := !images.JobsOwned(imageCache, c.jobNamespace)
+	if imageCache.DeletionTimestamp != nil || (imageCache.Spec.DeleteImagesOnCacheDeletion == hasFinalizer(imageCache) &&
+		deleteJobs == hasJobsFinalizer(imageCache)) {
+		return nil
+	}
+	imageCacheCopy := imageCache.DeepCopy()
+	imageCacheCopy.Finalizers = nil
+	for _, f := range imageCache.Finalizers {
+		if f != imageCacheFinalizer && f != jobsFinalizer {
+			imageCacheCopy.Finalizers = append(imageCacheCopy.Finalizers, f)
+		}
+	}
+	if imageCache.Spec.DeleteImagesOnCacheDeletion {
+		imageCacheCopy.Finalizers = append(imageCacheCopy.Finalizers, imageCacheFinalizer)
+	}
+	if deleteJobs {
+		imageCacheCopy.Finalizers = append(imageCacheCopy.Finalizers, jobsFinalizer)
+	}
+	err := c.updateImageCache(imageCacheCopy)
+	if err == nil {
+		klog.Infof("Finalizers of imagecache(%s) set to %v", imageCache.Name, imageCacheCopy.Finalizers)
+	}
+	return err
+}
+
+// removeFinalizer removes the finalizer from the image cache. An image cache
+// already removed is ignored.
+func (c *Controller) removeFinalizer(imageCache *v1alpha3.ImageCache) error {
+	return c.dropFinalizer(imageCache, imageCacheFinalizer)
+}
+
+// dropFinalizer removes a finalizer of kube-fledged from the image cache. An image
+// cache already removed is ignored.
+func (c *Controller) dropFinalizer(imageCache *v1alpha3.ImageCache, finalizer string) error {
+	imageCacheCopy := imageCache.DeepCopy()
+	imageCacheCopy.Finalizers = nil
+	for _, f := range imageCache.Finalizers {
+		if f != finalizer {
+			imageCacheCopy.Finalizers = append(imageCacheCopy.Finalizers, f)
+		}
+	}
+	err := c.updateImageCache(imageCacheCopy)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err == nil {
+		klog.Infof("Finalizer %s removed from imagecache(%s)", finalizer, imageCache.Name)
+	}
+	return err
+}
+
+// deleteJobs deletes the jobs of an image cache being deleted that it does not own, then
+// removes the jobs finalizer from the image cache
+func (c *Controller) deleteJobs(imageCache *v1alpha3.ImageCache) error {
+	namespace := images.JobNamespace(imageCache, c.jobNamespace)
+	joblist, err := c.kubeclientset.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: images.ImageCacheJobsSelector(imageCache).String(),
+	})
+	if err != nil {
+		klog.Errorf("Error listing jobs of imagecache(%s): %v", imageCache.Name, err)
+		return err
+	}
+	deletePropagation := metav1.DeletePropagationBackground
+	for _, job := range joblist.Items {
+		err := c.kubeclientset.BatchV1().Jobs(namespace).
+			Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &deletePropagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.Errorf("Error deleting job(%s): %v", job.Name, err)
+			return err
+		}
+		klog.Infof("Job(%s) of imagecache(%s) deleted", job.Name, imageCache.Name)
+	}
+	return c.dropFinalizer(imageCache, jobsFinalizer)
+}
+
+// referencedImages lists, for each node, the images of the other image caches that are
+// not being deleted. These images are not deleted from the node when the image cache is deleted.
+func (c *Controller) referencedImages(imageCache *v1alpha3.ImageCache) (map[string][]string, error) {
+	imageCaches, err := c.listImageCaches()
+	if err != nil {
+		klog.Errorf("Error in listing image caches: %v", err)
+		return nil, err
+	}
+	referenced := map[string][]string{}
+	for _, ic := range imageCaches {
+		if (ic.Namespace == imageCache.Namespace && ic.Name == imageCache.Name &&
+			v1alpha3.IsClusterImageCache(ic) == v1alpha3.IsClusterImageCache(imageCache)) || ic.DeletionTimestamp != nil {
+			continue
+		}
+		if resolved, err := c.resolveImageList(ic); err == nil {
+			ic = resolved
+		}
+		for _, i := range ic.Spec.CacheSpec {
+			nodes, err := c.selectNodes(ic, i.NodeSelector)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range nodes {
+				for _, image := range i.Images {
+					referenced[n.Name] = append(referenced[n.Name], image.Name)
+				}
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// imageReferenced checks whether the image is one of the referenced images
+func imageReferenced(image string, referenced []string) bool {
+	for _, r := range referenced {
+		if images.SameImage(image, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+)
+
+// helperImageUnavailable checks whether image pulls failed as a helper image of the image pull jobs
+// could not be pulled, so that no pull job was created for them
+func helperImageUnavailable(results map[string]images.ImageWorkResult) bool {
+	for _, v := range results {
+		if v.Status == images.ImageWorkResultStatusFailed && v.Reason == v1alpha3.ImageCacheReasonHelperImageUnavailable {
+			return true
+		}
+	}
+	return false
+}
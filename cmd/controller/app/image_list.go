@@ -0,0 +1,203 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// parseImageList parses the images held by a key of a ConfigMap: a JSON array of images, or one image
+// per line. Blank lines and lines starting with '#' are ignored.
+func parseImageList(data string) ([]string, error) {
+	var list []string
+	if trimmed := strings.TrimSpace(data); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &list); err != nil {
+			return nil, fmt.Errorf("invalid JSON array of images: %v", err)
+		}
+	} else {
+		list = strings.Split(data, "\n")
+	}
+	imgs := []string{}
+	for _, image := range list {
+		image = strings.TrimSpace(image)
+		if image == "" || strings.HasPrefix(image, "#") {
+			continue
+		}
+		if _, err := reference.ParseNormalizedNamed(image); err != nil {
+			return nil, fmt.Errorf("invalid image reference %q: %v", image, err)
+		}
+		imgs = append(imgs, image)
+	}
+	return imgs, nil
+}
+
+// imageListImages reads the images of the ConfigMap referenced by an image list, in the namespace of the
+// image cache. The images of every key are read, in the order of the keys, unless a key is given.
+func (c *Controller) imageListImages(namespace string, ref *v1alpha3.ConfigMapImageListReference) ([]string, error) {
+	configMap, err := c.configMapsLister.ConfigMaps(namespace).Get(ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting configmap %s: %v", ref.Name, err)
+	}
+	keys := []string{ref.Key}
+	if ref.Key == "" {
+		keys = []string{}
+		for k := range configMap.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	} else if _, ok := configMap.Data[ref.Key]; !ok {
+		return nil, fmt.Errorf("key %s not found in configmap %s", ref.Key, ref.Name)
+	}
+	imgs := []string{}
+	for _, k := range keys {
+		list, err := parseImageList(configMap.Data[k])
+		if err != nil {
+			return nil, fmt.Errorf("key %s of configmap %s: %v", k, ref.Name, err)
+		}
+		// images listed more than once, e.g. by several keys, are cached once
+		for _, image := range list {
+			if !imageListed(image, imgs) {
+				imgs = append(imgs, image)
+			}
+		}
+	}
+	return imgs, nil
+}
+
+// imageListed checks whether the image is one of the listed images
+func imageListed(image string, listed []string) bool {
+	for _, l := range listed {
+		if images.SameImage(image, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveImageList returns a copy of the image cache whose cacheSpec ends with the images of its imageListFrom,
+// followed by the images of its workload if it caches them. The copy is not to be written back to the api server,
+// as these images are not part of its spec.
+func (c *Controller) resolveImageList(imageCache *v1alpha3.ImageCache) (*v1alpha3.ImageCache, error) {
+	resolved := imageCache
+	if source := imageCache.Spec.ImageListFrom; source != nil && source.ConfigMapRef != nil {
+		imgs, err := c.imageListImages(imageCache.Namespace, source.ConfigMapRef)
+		if err != nil {
+			return nil, err
+		}
+		resolved = imageCache.DeepCopy()
+		if len(imgs) > 0 {
+			list := v1alpha3.CacheSpecImages{NodeSelector: source.NodeSelector}
+			for _, image := range imgs {
+				list.Images = append(list.Images, v1alpha3.Image{Name: image})
+			}
+			resolved.Spec.CacheSpec = append(resolved.Spec.CacheSpec, list)
+		}
+	}
+	// the syncHandler rejects an image cache whose workload cannot be read, so its images are left out until then
+	imgs, err := c.workloadImages(resolved)
+	if err != nil {
+		klog.Warningf("Images of workload of imagecache(%s) not read: %v", imageCache.Name, err)
+		return resolved, nil
+	}
+	if len(imgs) > 0 {
+		if resolved == imageCache {
+			resolved = imageCache.DeepCopy()
+		}
+		list := v1alpha3.CacheSpecImages{}
+		for _, image := range imgs {
+			list.Images = append(list.Images, v1alpha3.Image{Name: image})
+		}
+		resolved.Spec.CacheSpec = append(resolved.Spec.CacheSpec, list)
+	}
+	return resolved, nil
+}
+
+// rejectImageList fails the action on an image cache whose image list could not be read. The image
+// cache is reconciled again when the ConfigMap changes.
+func (c *Controller) rejectImageList(imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus, err error) error {
+	status.Status = v1alpha3.ImageCacheActionStatusFailed
+	status.Reason = v1alpha3.ImageCacheReasonImageListInvalid
+	status.Message = fmt.Sprintf("%s: %v", v1alpha3.ImageCacheMessageImageListInvalid, err)
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		klog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+	klog.Errorf("%s: %s", v1alpha3.ImageCacheReasonImageListInvalid, status.Message)
+	c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
+	return nil
+}
+
+// enqueueConfigMap enqueues an update of the image caches reading their image list from a ConfigMap
+// whose data changed. The images added to or removed from the list are pulled or pruned as with an
+// update of the cacheSpec. A change of the registry pull limits ConfigMap sets the limits of the image manager.
+func (c *Controller) enqueueConfigMap(old, new interface{}) {
+	configMap, ok := new.(*corev1.ConfigMap)
+	if !ok {
+		tombstone, ok := new.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if configMap, ok = tombstone.Obj.(*corev1.ConfigMap); !ok {
+			return
+		}
+	}
+	if oldConfigMap, ok := old.(*corev1.ConfigMap); ok && reflect.DeepEqual(oldConfigMap.Data, configMap.Data) {
+		return
+	}
+	if configMap.Namespace == c.fledgedNameSpace && configMap.Name == c.registryPullLimitsConfigMap {
+		c.syncRegistryPullLimits()
+		return
+	}
+	imageCaches, err := c.listImageCaches()
+	if err != nil {
+		klog.Errorf("Error listing image caches for configmap %s/%s: %v", configMap.Namespace, configMap.Name, err)
+		return
+	}
+	for _, imageCache := range imageCaches {
+		source := imageCache.Spec.ImageListFrom
+		if source == nil || source.ConfigMapRef == nil || source.ConfigMapRef.Name != configMap.Name ||
+			imageCache.Namespace != configMap.Namespace || imageCache.DeletionTimestamp != nil {
+			continue
+		}
+		if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusProcessing {
+			klog.Warningf("Received change of configmap %s for '%s' while it is under processing, so ignoring.", configMap.Name, imageCache.Name)
+			continue
+		}
+		key, err := images.ImageCacheKey(imageCache)
+		if err != nil {
+			klog.Errorf("Error getting key of imagecache(%s): %v", imageCache.Name, err)
+			continue
+		}
+		klog.Infof("Image list of imagecache(%s) changed in configmap %s", key, configMap.Name)
+		c.workqueue.AddRateLimited(images.WorkQueueKey{
+			WorkType:      images.ImageCacheUpdate,
+			ObjKey:        key,
+			OldImageCache: imageCache,
+		})
+	}
+}
@@ -0,0 +1,30 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+
+	"github.com/lcouds/kube-fledged/pkg/images"
+)
+
+// sortByPriority orders the image work requests by decreasing priority of their image, so that the
+// images of higher priority are placed first in the imageworkqueue. Requests of the same priority keep
+// their order.
+func sortByPriority(requests []images.ImageWorkRequest) {
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].Priority > requests[j].Priority })
+}
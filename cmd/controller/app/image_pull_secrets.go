@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// missingImagePullSecrets returns the names of the image pull secrets of the image cache and of
+// its images that do not exist in the namespace of its jobs. Secrets the controller is not
+// allowed to get are not checked, and are reported by the image pull jobs if missing.
+func (c *Controller) missingImagePullSecrets(imageCache *v1alpha3.ImageCache) ([]string, error) {
+	secrets := images.MergeImagePullSecrets(imageCache.Spec.ImagePullSecrets, nil)
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, image := range i.Images {
+			secrets = images.MergeImagePullSecrets(secrets, image.ImagePullSecrets)
+		}
+	}
+	// the jobs refer to the secrets of their own namespace
+	namespace := images.JobNamespace(imageCache, c.jobNamespace)
+	missing := []string{}
+	for _, secret := range secrets {
+		_, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, secret.Name)
+		} else if apierrors.IsForbidden(err) {
+			klog.Warningf("Unable to check image pull secret %s/%s: %v", namespace, secret.Name, err)
+		} else if err != nil {
+			klog.Errorf("Error getting image pull secret %s/%s: %v", namespace, secret.Name, err)
+			return nil, err
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/klog/v2"
+)
+
+// nodeSelectorOperators maps the operators of node selector requirements to label selector operators
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// selectNodes lists the nodes of a cache spec: the nodes matching both the nodeSelector of
+// the cache spec and the nodeSelector of the image cache, that satisfy the required node
+// affinity of the image cache and the placement of its workload, and are not excluded by it.
+func (c *Controller) selectNodes(imageCache *v1alpha3.ImageCache, nodeSelector map[string]string) ([]*corev1.Node, error) {
+	selected, _, err := c.selectAndExcludeNodes(imageCache, nodeSelector)
+	return selected, err
+}
+
+// selectAndExcludeNodes lists the nodes of a cache spec, and apart from them the nodes that
+// would be nodes of the cache spec but are excluded by the excludedNodeSelector or the
+// excludedNodeNames of the image cache.
+func (c *Controller) selectAndExcludeNodes(imageCache *v1alpha3.ImageCache, nodeSelector map[string]string) ([]*corev1.Node, []*corev1.Node, error) {
+	selector := labels.SelectorFromSet(nodeSelector)
+	if len(imageCache.Spec.NodeSelector) > 0 {
+		requirements, _ := labels.SelectorFromSet(imageCache.Spec.NodeSelector).Requirements()
+		selector = selector.Add(requirements...)
+	}
+	excludedSelector := labels.Nothing()
+	if imageCache.Spec.ExcludedNodeSelector != nil {
+		var err error
+		if excludedSelector, err = metav1.LabelSelectorAsSelector(imageCache.Spec.ExcludedNodeSelector); err != nil {
+			klog.Errorf("Invalid excludedNodeSelector of imagecache(%s): %v", imageCache.Name, err)
+			return nil, nil, err
+		}
+	}
+	placement, err := c.workloadPlacement(imageCache)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := c.nodesLister.List(selector)
+	if err != nil {
+		klog.Errorf("Error listing nodes using nodeselector %s: %v", selector, err)
+		return nil, nil, err
+	}
+	selected := []*corev1.Node{}
+	excluded := []*corev1.Node{}
+	for _, n := range nodes {
+		matched, err := nodeMatchesAffinity(n, imageCache.Spec.Affinity)
+		if err != nil {
+			klog.Errorf("Error matching node %s against the affinity of imagecache(%s): %v", n.Name, imageCache.Name, err)
+			return nil, nil, err
+		}
+		if !matched {
+			continue
+		}
+		if matched, err = nodeMatchesPlacement(n, placement); err != nil {
+			klog.Errorf("Error matching node %s against the workload of imagecache(%s): %v", n.Name, imageCache.Name, err)
+			return nil, nil, err
+		}
+		if !matched {
+			continue
+		}
+		if excludedSelector.Matches(labels.Set(n.Labels)) || nodeNameExcluded(n.Name, imageCache.Spec.ExcludedNodeNames) {
+			klog.V(4).Infof("Node %s excluded by imagecache(%s)", n.Name, imageCache.Name)
+			excluded = append(excluded, n)
+			continue
+		}
+		selected = append(selected, n)
+	}
+	return selected, excluded, nil
+}
+
+// nodeImagePlan records the images planned on each node across the image lists of a cacheSpec
+type nodeImagePlan map[string][]string
+
+// add plans the image on the node, unless it is planned there already
+func (p nodeImagePlan) add(node, image string) bool {
+	if imageReferenced(image, p[node]) {
+		return false
+	}
+	p[node] = append(p[node], image)
+	return true
+}
+
+// nodeNameExcluded checks whether the node is one of the excluded node names
+func nodeNameExcluded(name string, excludedNodeNames []string) bool {
+	for _, excluded := range excludedNodeNames {
+		if name == excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeMatchesAffinity checks whether the node satisfies the required node affinity.
+// Preferred node affinity and pod (anti-)affinity are left to the scheduler.
+func nodeMatchesAffinity(node *corev1.Node, affinity *corev1.Affinity) (bool, error) {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true, nil
+	}
+	// node selector terms are ORed
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		matched, err := nodeMatchesSelectorTerm(node, term)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodeMatchesSelectorTerm checks whether the node satisfies all the requirements of a
+// node selector term. As in the scheduler, an empty term matches no node.
+func nodeMatchesSelectorTerm(node *corev1.Node, term corev1.NodeSelectorTerm) (bool, error) {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false, nil
+	}
+	for _, r := range term.MatchExpressions {
+		matched, err := nodeMatchesRequirement(labels.Set(node.Labels), r)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	for _, r := range term.MatchFields {
+		if r.Key != "metadata.name" {
+			return false, fmt.Errorf("unsupported field %q in node selector term", r.Key)
+		}
+		matched, err := nodeMatchesRequirement(labels.Set{"metadata.name": node.Name}, r)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func nodeMatchesRequirement(set labels.Set, r corev1.NodeSelectorRequirement) (bool, error) {
+	op, ok := nodeSelectorOperators[r.Operator]
+	if !ok {
+		return false, fmt.Errorf("unsupported operator %q in node selector requirement", r.Operator)
+	}
+	requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+	if err != nil {
+		return false, err
+	}
+	return requirement.Matches(set), nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// nodeImages maps a node name to the status of each image on that node
+type nodeImages map[string]map[string]v1alpha3.NodeImageStatus
+
+// newNodeImages indexes the per-node status of an image cache
+func newNodeImages(nodes []v1alpha3.NodeStatus) nodeImages {
+	m := nodeImages{}
+	for _, n := range nodes {
+		for _, i := range n.Images {
+			if m[n.Node] == nil {
+				m[n.Node] = map[string]v1alpha3.NodeImageStatus{}
+			}
+			m[n.Node][i.Image] = i
+		}
+	}
+	return m
+}
+
+// set records the state of an image on a node. The last transition time is
+// retained if the state of the image has not changed, the size and digest
+// of the image unless it failed, was skipped or excluded, and the last error of the
+// image until it is cached.
+func (m nodeImages) set(old nodeImages, node, image string, state v1alpha3.NodeImageState, reason, message string, now metav1.Time) {
+	status := v1alpha3.NodeImageStatus{
+		Image:              image,
+		State:              state,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	}
+	prev, ok := old[node][image]
+	if ok && prev.State == state {
+		status.LastTransitionTime = prev.LastTransitionTime
+	}
+	if ok && state != v1alpha3.NodeImageStateFailed && state != v1alpha3.NodeImageStateSkipped && state != v1alpha3.NodeImageStateExcluded {
+		status.SizeBytes = prev.SizeBytes
+		status.Digest = prev.Digest
+	}
+	if ok && state != v1alpha3.NodeImageStateCached {
+		status.LastError = prev.LastError
+	}
+	if state == v1alpha3.NodeImageStateFailed {
+		status.LastError = lastError(reason, message)
+	}
+	if m[node] == nil {
+		m[node] = map[string]v1alpha3.NodeImageStatus{}
+	}
+	m[node][image] = status
+}
+
+// verified records whether an image on a node passed verification after its pull
+func (m nodeImages) verified(node, image string, verified bool) {
+	if status, ok := m[node][image]; ok {
+		status.Verified = verified
+		m[node][image] = status
+	}
+}
+
+// lastError describes a failure by its message, or by its reason if it has no message
+func lastError(reason, message string) string {
+	if message != "" {
+		return message
+	}
+	return reason
+}
+
+// remove drops an image from the status of a node
+func (m nodeImages) remove(node, image string) {
+	delete(m[node], image)
+	if len(m[node]) == 0 {
+		delete(m, node)
+	}
+}
+
+// list returns the per-node status sorted by node and image. The list is
+// never nil, so that an image cache with no images left on any node clears
+// its per-node status.
+func (m nodeImages) list() []v1alpha3.NodeStatus {
+	nodes := []v1alpha3.NodeStatus{}
+	for node, imgs := range m {
+		n := v1alpha3.NodeStatus{Node: node}
+		for _, i := range imgs {
+			n.Images = append(n.Images, i)
+		}
+		sort.Slice(n.Images, func(i, j int) bool { return n.Images[i].Image < n.Images[j].Image })
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes
+}
+
+// nodeImageStatusForRequests returns the per-node status of an image cache
+// whose image work requests have just been placed in the imageworkqueue.
+// Images being pulled are marked Pulling and images being deleted Deleting.
+// Images left unchanged on a node keep their status, and images of the nodes
+// excluded by the image cache are marked Excluded.
+func nodeImageStatusForRequests(current []v1alpha3.NodeStatus, requests, unchanged, excluded []images.ImageWorkRequest, now metav1.Time) []v1alpha3.NodeStatus {
+	old := newNodeImages(current)
+	m := nodeImages{}
+	for _, r := range unchanged {
+		if s, ok := old[r.Node.Name][r.Image]; ok {
+			if m[r.Node.Name] == nil {
+				m[r.Node.Name] = map[string]v1alpha3.NodeImageStatus{}
+			}
+			m[r.Node.Name][r.Image] = s
+		}
+	}
+	for _, r := range requests {
+		if r.Node == nil {
+			continue
+		}
+		state := v1alpha3.NodeImageStatePulling
+		if r.WorkType == images.ImageCachePurge {
+			state = v1alpha3.NodeImageStateDeleting
+		}
+		m.set(old, r.Node.Name, r.Image, state, "", "", now)
+	}
+	for _, r := range excluded {
+		m.set(old, r.Node.Name, r.Image, v1alpha3.NodeImageStateExcluded,
+			v1alpha3.ImageCacheReasonNodeExcluded, v1alpha3.ImageCacheMessageNodeExcluded, now)
+	}
+	return m.list()
+}
+
+// nodeImageStatusForResults applies the results of the image work requests
+// to the per-node status of an image cache. Images successfully deleted from
+// a node, or already absent from it, are removed from the status of that node. Images that would be pulled
+// or deleted by an image cache in dry run mode are marked WouldPull or WouldDelete.
+// Images cached after passing verification are marked verified.
+func nodeImageStatusForResults(current []v1alpha3.NodeStatus, results map[string]images.ImageWorkResult, now metav1.Time) []v1alpha3.NodeStatus {
+	old := newNodeImages(current)
+	m := newNodeImages(current)
+	for _, v := range results {
+		if v.ImageWorkRequest.Node == nil {
+			continue
+		}
+		node := v.ImageWorkRequest.Node.Name
+		image := v.ImageWorkRequest.Image
+		switch v.Status {
+		case images.ImageWorkResultStatusSucceeded, images.ImageWorkResultStatusSucceededAfterRetries,
+			images.ImageWorkResultStatusAlreadyPulled, images.ImageWorkResultStatusAlreadyAbsent:
+			if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+				m.remove(node, image)
+			} else {
+				m.set(old, node, image, v1alpha3.NodeImageStateCached, "", "", now)
+				m.verified(node, image, v.Verified)
+			}
+		case images.ImageWorkResultStatusFailed, images.ImageWorkResultStatusUnknown,
+			images.ImageWorkResultStatusImageMissing:
+			m.set(old, node, image, v1alpha3.NodeImageStateFailed, v.Reason, v.Message, now)
+		case images.ImageWorkResultStatusSkipped:
+			m.set(old, node, image, v1alpha3.NodeImageStateSkipped, v.Reason, v.Message, now)
+		case images.ImageWorkResultStatusWouldPull:
+			m.set(old, node, image, v1alpha3.NodeImageStateWouldPull, "", "", now)
+		case images.ImageWorkResultStatusWouldDelete:
+			m.set(old, node, image, v1alpha3.NodeImageStateWouldDelete, "", "", now)
+		}
+	}
+	return m.list()
+}
+
+// updateImageSizes records the size of each cached image from the status of
+// its node, and totals the sizes per node and for the image cache. An image
+// not yet listed in the status of its node keeps its previous size and is
+// looked up again during the next reconciliation of the image cache. Images
+// pulled from a registry mirror are looked up by their mirror reference, and
+// images pinned to a digest by their repo@digest reference.
+func (c *Controller) updateImageSizes(status *v1alpha3.ImageCacheStatus) {
+	status.TotalSizeBytes = 0
+	for i := range status.Nodes {
+		n := &status.Nodes[i]
+		node, err := c.nodesLister.Get(n.Node)
+		if err != nil {
+			klog.V(4).Infof("Unable to get node %s to record image sizes: %v", n.Node, err)
+		}
+		n.TotalSizeBytes = 0
+		for j := range n.Images {
+			image := &n.Images[j]
+			if node != nil && image.State == v1alpha3.NodeImageStateCached {
+				if size, ok := images.ImageSizeInNode(c.nodeImageRef(image.Image, status), node); ok {
+					image.SizeBytes = size
+				} else {
+					klog.V(4).Infof("Image %s not yet listed in the status of node %s", image.Image, n.Node)
+				}
+			}
+			n.TotalSizeBytes += image.SizeBytes
+		}
+		status.TotalSizeBytes += n.TotalSizeBytes
+	}
+}
+
+// updateImageDigests records the digest each cached image resolved to from the
+// status of its node. When pin is set, images not yet pinned are pinned to the
+// digest they resolved to on the first node listing it.
+func (c *Controller) updateImageDigests(status *v1alpha3.ImageCacheStatus, pin bool) {
+	for i := range status.Nodes {
+		n := &status.Nodes[i]
+		node, err := c.nodesLister.Get(n.Node)
+		if err != nil {
+			klog.V(4).Infof("Unable to get node %s to record image digests: %v", n.Node, err)
+			continue
+		}
+		for j := range n.Images {
+			image := &n.Images[j]
+			if image.State != v1alpha3.NodeImageStateCached {
+				continue
+			}
+			digest, ok := images.ImageDigestInNode(c.nodeImageRef(image.Image, status), node)
+			if !ok {
+				klog.V(4).Infof("Digest of image %s not yet listed in the status of node %s", image.Image, n.Node)
+				continue
+			}
+			image.Digest = digest
+			if pin && status.PinnedDigests[image.Image] == "" && !images.IsDigestRef(image.Image) {
+				if status.PinnedDigests == nil {
+					status.PinnedDigests = map[string]string{}
+				}
+				status.PinnedDigests[image.Image] = digest
+				klog.Infof("Image %s pinned to digest %s", image.Image, digest)
+			}
+		}
+	}
+}
+
+// nodeImageRef returns the reference under which the node lists the image: its
+// mirror reference, pinned to its digest if any
+func (c *Controller) nodeImageRef(image string, status *v1alpha3.ImageCacheStatus) string {
+	return images.RewriteImageRef(images.PinnedImageRef(image, status.PinnedDigests[image]), c.registryMirrors)
+}
+
+// pinnedDigests returns the digests the images of an image cache pinning digests
+// are pinned to. The map is never nil, so that the pinned digests of images no
+// longer in the cache, or of an image cache no longer pinning digests, are cleared.
+func pinnedDigests(imageCache *v1alpha3.ImageCache) map[string]string {
+	pinned := map[string]string{}
+	if !imageCache.Spec.PinDigests {
+		return pinned
+	}
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, image := range i.Images {
+			if digest, ok := imageCache.Status.PinnedDigests[image.Name]; ok {
+				pinned[image.Name] = digest
+			}
+		}
+	}
+	return pinned
+}
+
+// setCompletion computes the completion percentage of an image cache from its per-node status, and sets
+// its Ready condition. Images skipped on a node (e.g. of another architecture) or on a node excluded
+// by the image cache are not to be cached there. An image cache with no image to be cached on any node is not Ready.
+func setCompletion(status *v1alpha3.ImageCacheStatus, generation int64) {
+	cached, total := 0, 0
+	for _, n := range status.Nodes {
+		for _, i := range n.Images {
+			if i.State == v1alpha3.NodeImageStateSkipped || i.State == v1alpha3.NodeImageStateExcluded {
+				continue
+			}
+			total++
+			if i.State == v1alpha3.NodeImageStateCached {
+				cached++
+			}
+		}
+	}
+	status.CompletionPercentage = 0
+	if total > 0 {
+		status.CompletionPercentage = int32(cached * 100 / total)
+	}
+	condition := metav1.Condition{
+		Type:               v1alpha3.ImageCacheConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             v1alpha3.ImageCacheReasonImagesNotCached,
+		Message:            fmt.Sprintf("%d of %d images cached on the nodes", cached, total),
+	}
+	if total > 0 && cached == total {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1alpha3.ImageCacheReasonAllImagesCached
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	v1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"k8s.io/klog/v2"
+)
+
+// warmNode schedules the images of the image caches matching a node that just joined the cluster
+// to be pulled to it. The nodes joining within nodeWarmingDelay of each other are warmed together,
+// so that a scale-up of many nodes refreshes each image cache once rather than once per node.
+func (c *Controller) warmNode(name string) {
+	c.nodeWarmingLock.Lock()
+	defer c.nodeWarmingLock.Unlock()
+	c.nodesToWarm[name] = true
+	if c.nodeWarmingTimer == nil {
+		c.nodeWarmingTimer = time.AfterFunc(c.nodeWarmingDelay, c.warmNodes)
+	}
+}
+
+// warmNodes enqueues a refresh of each image cache matching any of the nodes to warm,
+// limited to the matching nodes
+func (c *Controller) warmNodes() {
+	c.nodeWarmingLock.Lock()
+	nodesToWarm := c.nodesToWarm
+	c.nodesToWarm = map[string]bool{}
+	c.nodeWarmingTimer = nil
+	c.nodeWarmingLock.Unlock()
+
+	imageCaches, err := c.listImageCaches()
+	if err != nil {
+		klog.Errorf("Error listing image caches to warm nodes: %v", err)
+		return
+	}
+	for _, imageCache := range imageCaches {
+		if imageCache.DeletionTimestamp != nil || imageCache.Spec.Paused {
+			continue
+		}
+		nodes, err := c.imageCacheNodes(imageCache, nodesToWarm)
+		if err != nil || len(nodes) == 0 {
+			continue
+		}
+		key, err := images.ImageCacheKey(imageCache)
+		if err != nil {
+			klog.Errorf("Error getting key of imagecache(%s): %v", imageCache.Name, err)
+			continue
+		}
+		klog.Infof("Warming nodes %s with the images of imagecache(%s)", strings.Join(nodes, ","), key)
+		c.workqueue.AddRateLimited(images.WorkQueueKey{
+			WorkType: images.ImageCacheRefresh,
+			ObjKey:   key,
+			Nodes:    strings.Join(nodes, ","),
+		})
+	}
+}
+
+// imageCacheNodes returns the sorted names of the given nodes selected by any cache spec of the image cache
+func (c *Controller) imageCacheNodes(imageCache *v1alpha3.ImageCache, names map[string]bool) ([]string, error) {
+	matched := map[string]bool{}
+	if resolved, err := c.resolveImageList(imageCache); err == nil {
+		imageCache = resolved
+	}
+	for _, i := range imageCache.Spec.CacheSpec {
+		nodes, err := c.selectNodes(imageCache, i.NodeSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			if names[n.Name] {
+				matched[n.Name] = true
+			}
+		}
+	}
+	nodes := []string{}
+	for n := range matched {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// warmedNodes returns the set of nodes to which the images of a work queue key are limited,
+// or nil if the images are pulled to all the nodes of the image cache
+func warmedNodes(wqKey images.WorkQueueKey) map[string]bool {
+	if wqKey.Nodes == "" {
+		return nil
+	}
+	nodes := map[string]bool{}
+	for _, n := range strings.Split(wqKey.Nodes, ",") {
+		nodes[n] = true
+	}
+	return nodes
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// orphanJobsSweepPeriod is how often the jobs of deleted image caches are looked for and deleted
+const orphanJobsSweepPeriod = 10 * time.Minute
+
+// jobImageCache returns the namespace and name of the image cache of a job, and the UID of the image cache
+// owning it if any: from the controller reference of the job, or from its labels for the jobs created outside
+// the namespace of their image cache. The namespace of a ClusterImageCache is empty. It returns false for
+// the jobs that cannot be attributed to an image cache.
+func jobImageCache(job *batchv1.Job) (string, string, types.UID, bool) {
+	if owner := metav1.GetControllerOf(job); owner != nil {
+		switch owner.Kind {
+		case "ImageCache":
+			return job.Namespace, owner.Name, owner.UID, true
+		case v1alpha3.ClusterImageCacheKind:
+			return "", owner.Name, owner.UID, true
+		}
+		return "", "", "", false
+	}
+	if namespace, ok := job.Labels[images.ImageCacheNamespaceLabelKey]; ok && job.Labels["imagecache"] != "" {
+		return namespace, job.Labels["imagecache"], "", true
+	}
+	return "", "", "", false
+}
+
+// deleteOrphanJobs deletes the image pull/delete jobs whose image cache no longer exists, or was recreated
+// since the job was created, e.g. jobs left behind by a controller crash while their image cache was
+// deleted. Jobs owned by their image cache are usually garbage collected with it; the jobs created
+// outside its namespace are not. The image caches are read from the api server, so that the image caches
+// just created are not mistaken for deleted ones.
+func (c *Controller) deleteOrphanJobs() {
+	selector := labels.SelectorFromSet(labels.Set{"app": "kubefledged", "kubefledged": "kubefledged-image-manager"})
+	joblist, err := c.kubeclientset.BatchV1().Jobs("").List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		klog.Errorf("Error listing jobs: %v", err)
+		return
+	}
+	deletePropagation := metav1.DeletePropagationBackground
+	for i := range joblist.Items {
+		job := &joblist.Items[i]
+		if job.DeletionTimestamp != nil {
+			continue
+		}
+		namespace, name, uid, ok := jobImageCache(job)
+		if !ok {
+			continue
+		}
+		imageCache, err := c.fetchImageCache(namespace, name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.Errorf("Error getting imagecache(%s/%s) of job %s/%s: %v", namespace, name, job.Namespace, job.Name, err)
+			continue
+		}
+		if err == nil && (uid == "" || imageCache.UID == uid) {
+			continue
+		}
+		if err := c.kubeclientset.BatchV1().Jobs(job.Namespace).
+			Delete(context.TODO(), job.Name, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			klog.Errorf("Error deleting orphan job %s/%s: %v", job.Namespace, job.Name, err)
+			continue
+		}
+		klog.Infof("Orphan job %s/%s of deleted imagecache(%s/%s) deleted", job.Namespace, job.Name, namespace, name)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/images"
+)
+
+// partiallyCached checks whether the image pulls failed for fewer node/image pairs than the partial
+// failure threshold of the image cache, so that it is reported as partially cached rather than failed
+func partiallyCached(results map[string]images.ImageWorkResult, thresholdPercent int32) bool {
+	if thresholdPercent <= 0 {
+		return false
+	}
+	total, failed := 0, 0
+	for _, v := range results {
+		if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+			return false
+		}
+		total++
+		if v.Status == images.ImageWorkResultStatusFailed || v.Status == images.ImageWorkResultStatusUnknown ||
+			v.Status == images.ImageWorkResultStatusImageMissing {
+			failed++
+		}
+	}
+	return failed > 0 && failed*100 < int(thresholdPercent)*total
+}
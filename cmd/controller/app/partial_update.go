@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// appliedCacheSpec returns the cacheSpec last applied to the nodes of the image cache. Image caches
+// last applied by an earlier version of the controller fall back to the spec before the update.
+func appliedCacheSpec(imageCache, oldImageCache *v1alpha3.ImageCache) []v1alpha3.CacheSpecImages {
+	if imageCache.Status.LastAppliedCacheSpec != nil || oldImageCache == nil {
+		return imageCache.Status.LastAppliedCacheSpec
+	}
+	return oldImageCache.Spec.CacheSpec
+}
+
+// unchangedImage checks whether the image was last applied with the same settings to the nodes
+// selected by the node selector. The priority of the image only orders its pull, so it is ignored.
+func unchangedImage(applied []v1alpha3.CacheSpecImages, nodeSelector map[string]string, image v1alpha3.Image) bool {
+	for _, i := range applied {
+		if !equality.Semantic.DeepEqual(i.NodeSelector, nodeSelector) {
+			continue
+		}
+		for _, a := range i.Images {
+			if images.SameImage(a.Name, image.Name) {
+				a.Name = image.Name
+				a.Priority = image.Priority
+				return equality.Semantic.DeepEqual(a, image)
+			}
+		}
+	}
+	return false
+}
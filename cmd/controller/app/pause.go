@@ -0,0 +1,38 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// pauseImageCache records that the image cache is paused instead of creating its jobs. The cacheSpec
+// last applied to the nodes is retained, so that the changes made while paused are applied on resume.
+func (c *Controller) pauseImageCache(imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus) error {
+	status.Status = v1alpha3.ImageCacheActioneNoImagesPulledOrDeleted
+	status.Reason = v1alpha3.ImageCacheReasonImageCachePaused
+	status.Message = v1alpha3.ImageCacheMessageImageCachePaused
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		klog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+	klog.Infof("Image cache %s is paused, no job created", imageCache.Name)
+	c.recorder.Event(imageCache, corev1.EventTypeNormal, status.Reason, status.Message)
+	return nil
+}
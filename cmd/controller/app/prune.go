@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// removedImage checks whether the image is no longer in the cacheSpec
+func removedImage(cacheSpec []v1alpha3.CacheSpecImages, image string) bool {
+	for _, i := range cacheSpec {
+		for _, newimage := range i.Images {
+			if images.SameImage(image, newimage.Name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pruneRequests returns the image delete requests of the images removed from the cacheSpec of the image
+// cache. The images are deleted from the nodes the applied cacheSpec selected for them, and from the nodes
+// the per-node status lists them as cached on. Images cached by other image caches on a node are kept.
+func (c *Controller) pruneRequests(imageCache *v1alpha3.ImageCache, applied []v1alpha3.CacheSpecImages) ([]images.ImageWorkRequest, error) {
+	removed := map[string]map[string]images.ImageWorkRequest{}
+	add := func(n *corev1.Node, image v1alpha3.Image) {
+		if !removedImage(imageCache.Spec.CacheSpec, image.Name) {
+			return
+		}
+		if removed[n.Name] == nil {
+			removed[n.Name] = map[string]images.ImageWorkRequest{}
+		}
+		if _, ok := removed[n.Name][image.Name]; ok {
+			return
+		}
+		imagePullSecrets := image.ImagePullSecrets
+		removed[n.Name][image.Name] = images.ImageWorkRequest{
+			Image:                   image.Name,
+			ForceFullCache:          image.ForceFullCache,
+			ImagePullPolicy:         image.ImagePullPolicy,
+			ImagePullSecrets:        &imagePullSecrets,
+			Node:                    n,
+			ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
+			WorkType:                images.ImageCachePurge,
+			Imagecache:              imageCache,
+			Digest:                  imageCache.Status.PinnedDigests[image.Name],
+			ArtifactType:            image.ArtifactType,
+		}
+	}
+
+	for _, i := range applied {
+		nodes, err := c.selectNodes(imageCache, i.NodeSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			for _, image := range i.Images {
+				add(n, image)
+			}
+		}
+	}
+	for _, ns := range imageCache.Status.Nodes {
+		n, err := c.nodesLister.Get(ns.Node)
+		if err != nil {
+			klog.V(4).Infof("Unable to get node %s to prune removed images: %v", ns.Node, err)
+			continue
+		}
+		for _, image := range ns.Images {
+			if image.State == v1alpha3.NodeImageStateCached {
+				add(n, v1alpha3.Image{Name: image.Image})
+			}
+		}
+	}
+
+	referenced, err := c.referencedImages(imageCache)
+	if err != nil {
+		return nil, err
+	}
+	var requests []images.ImageWorkRequest
+	for node, imgs := range removed {
+		for image, ipr := range imgs {
+			if imageReferenced(image, referenced[node]) {
+				klog.Infof("Image %s not deleted from node %s as it is referenced by another image cache", image, node)
+				continue
+			}
+			requests = append(requests, ipr)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Node.Name != requests[j].Node.Name {
+			return requests[i].Node.Name < requests[j].Node.Name
+		}
+		return requests[i].Image < requests[j].Image
+	})
+	return requests, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"k8s.io/klog/v2"
+)
+
+// imageInCacheSpec checks whether the image is one of the images in the cacheSpec of the image cache
+func imageInCacheSpec(imageCache *v1alpha3.ImageCache, image string) bool {
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, cached := range i.Images {
+			if images.SameImage(cached.Name, image) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rejectPurgeImage fails the purge of an image not in the cacheSpec of the image cache
+// and removes the purge-image annotation, so that no image is deleted from the nodes
+func (c *Controller) rejectPurgeImage(imageCache *v1alpha3.ImageCache, image string, status *v1alpha3.ImageCacheStatus) error {
+	status.Status = v1alpha3.ImageCacheActionStatusFailed
+	status.Reason = v1alpha3.ImageCacheReasonImageNotInCacheSpec
+	status.Message = fmt.Sprintf("%s: %s", v1alpha3.ImageCacheMessageImageNotInCacheSpec, image)
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		klog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+	klog.Errorf("%s: %s", v1alpha3.ImageCacheReasonImageNotInCacheSpec, status.Message)
+	latest, err := c.fetchImageCache(imageCache.Namespace, imageCache.Name)
+	if err != nil {
+		klog.Errorf("Error getting image cache %s: %v", imageCache.Name, err)
+		return err
+	}
+	if err := c.removeAnnotation(latest, v1alpha3.ImageCachePurgeImageAnnotationKey); err != nil {
+		klog.Errorf("Error removing Annotation %s from imagecache(%s): %v", v1alpha3.ImageCachePurgeImageAnnotationKey, imageCache.Name, err)
+		return err
+	}
+	return nil
+}
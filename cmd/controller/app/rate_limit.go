@@ -0,0 +1,47 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+)
+
+// rateLimitRetryAfter returns whether an image pull was rate-limited by the registry, and the longest
+// duration after which the rate-limited pulls are to be retried
+func rateLimitRetryAfter(results map[string]images.ImageWorkResult) (time.Duration, bool) {
+	var retryAfter time.Duration
+	rateLimited := false
+	for _, v := range results {
+		if v.Status != images.ImageWorkResultStatusFailed || v.Reason != v1alpha3.ImageCacheReasonRateLimited {
+			continue
+		}
+		rateLimited = true
+		if v.RetryAfter > retryAfter {
+			retryAfter = v.RetryAfter
+		}
+	}
+	return retryAfter, rateLimited
+}
+
+// rateLimited checks whether the image cache waits for the retry-after of image pulls rate-limited by
+// the registry, so that refreshing it does not pull the images again before
+func rateLimited(imageCache *v1alpha3.ImageCache, now time.Time) bool {
+	return imageCache.Status.RetryAfter != nil && now.Before(imageCache.Status.RetryAfter.Time)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// reconcilingKeys serializes the reconciles of each image cache across the workers of the workqueue.
+// The workqueue only keeps identical items from being processed concurrently, while an image cache is
+// enqueued as distinct items, e.g. an update while the status update of its previous action is pending.
+// The items of an image cache picked by a worker while another worker reconciles it are parked, and
+// processed in order by that worker once it is done.
+type reconcilingKeys struct {
+	lock sync.Mutex
+	// parked holds the items parked for each image cache being reconciled
+	parked map[string][]interface{}
+}
+
+// newReconcilingKeys returns an empty set of image caches being reconciled
+func newReconcilingKeys() *reconcilingKeys {
+	return &reconcilingKeys{parked: map[string][]interface{}{}}
+}
+
+// process calls processItem with the item, and then with the items of the image cache parked meanwhile,
+// unless another worker is reconciling the image cache, in which case the item is parked for it.
+func (r *reconcilingKeys) process(key string, item interface{}, processItem func(interface{})) {
+	if !r.acquire(key, item) {
+		klog.V(4).Infof("Image cache %s is being reconciled by another worker, so parked", key)
+		return
+	}
+	for ok := true; ok; item, ok = r.next(key) {
+		processItem(item)
+	}
+}
+
+// acquire marks the image cache as being reconciled by the caller, which then processes the item.
+// If another worker is reconciling the image cache, the item is parked for it and false is returned.
+func (r *reconcilingKeys) acquire(key string, item interface{}) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if parked, ok := r.parked[key]; ok {
+		r.parked[key] = append(parked, item)
+		return false
+	}
+	r.parked[key] = nil
+	return true
+}
+
+// next returns the next item parked for the image cache. If there is none, the image cache is no
+// longer being reconciled and false is returned.
+func (r *reconcilingKeys) next(key string) (interface{}, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	parked := r.parked[key]
+	if len(parked) == 0 {
+		delete(r.parked, key)
+		return nil, false
+	}
+	r.parked[key] = parked[1:]
+	return parked[0], true
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+	// time zones are embedded, as the controller image may not provide them
+	_ "time/tzdata"
+
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"github.com/robfig/cron"
+	"k8s.io/klog/v2"
+)
+
+// refreshScheduleCheckPeriod is how often the refresh schedules of the image caches are checked
+const refreshScheduleCheckPeriod = 10 * time.Second
+
+// runScheduledRefreshWorker refreshes each image cache that has a refresh schedule
+// when its schedule fires, evaluated in the refresh time zone of the image cache.
+// A schedule is first checked from the time the image cache is observed by the
+// worker, so that the controller starting up does not fire the schedules missed
+// while it was down.
+func (c *Controller) runScheduledRefreshWorker() {
+	imageCaches, err := c.listImageCaches()
+	if err != nil {
+		klog.Errorf("Error in listing image caches: %v", err)
+		return
+	}
+	now := c.clock.Now()
+	lastScheduledRefresh := map[string]time.Time{}
+	for i := range imageCaches {
+		if imageCaches[i].Spec.RefreshSchedule == "" {
+			continue
+		}
+		key, err := images.ImageCacheKey(imageCaches[i])
+		if err != nil {
+			klog.Errorf("Error getting key of imagecache(%s): %v", imageCaches[i].Name, err)
+			continue
+		}
+		schedule, err := cron.ParseStandard(imageCaches[i].Spec.RefreshSchedule)
+		if err != nil {
+			klog.Errorf("Invalid refresh schedule %q of imagecache(%s): %v", imageCaches[i].Spec.RefreshSchedule, key, err)
+			continue
+		}
+		location, err := refreshLocation(imageCaches[i].Spec.RefreshTimeZone)
+		if err != nil {
+			klog.Errorf("Invalid refresh time zone %q of imagecache(%s): %v", imageCaches[i].Spec.RefreshTimeZone, key, err)
+			continue
+		}
+		last, ok := c.lastScheduledRefresh[key]
+		if !ok {
+			last = now
+		}
+		if next := schedule.Next(last.In(location)); !next.After(now) {
+			if refreshable(imageCaches[i]) {
+				klog.Infof("Refresh schedule %q of imagecache(%s) fired at %s", imageCaches[i].Spec.RefreshSchedule, key, next)
+				c.enqueueImageCache(images.ImageCacheRefresh, imageCaches[i], nil)
+			}
+			last = now
+		}
+		lastScheduledRefresh[key] = last
+	}
+	c.lastScheduledRefresh = lastScheduledRefresh
+}
+
+// refreshLocation returns the location in which a refresh schedule is evaluated, UTC by default
+func refreshLocation(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(timeZone)
+}
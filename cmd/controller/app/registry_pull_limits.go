@@ -0,0 +1,47 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/lcouds/kube-fledged/pkg/images"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+// syncRegistryPullLimits sets the registry pull limits of the image manager from the registry pull limits
+// ConfigMap. The limits are removed with the ConfigMap, and kept when the ConfigMap is invalid.
+func (c *Controller) syncRegistryPullLimits() {
+	if c.registryPullLimitsConfigMap == "" {
+		return
+	}
+	limits := images.RegistryPullLimits{}
+	configMap, err := c.configMapsLister.ConfigMaps(c.fledgedNameSpace).Get(c.registryPullLimitsConfigMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("Error getting registry pull limits configmap %s: %v", c.registryPullLimitsConfigMap, err)
+		return
+	}
+	if err == nil {
+		if limits, err = images.ParseRegistryPullLimits(configMap.Data); err != nil {
+			klog.Errorf("Error parsing registry pull limits configmap %s, keeping the previous limits: %v",
+				c.registryPullLimitsConfigMap, err)
+			return
+		}
+	}
+	klog.Infof("Registry pull limits set from configmap %s (default: %d, registries: %v)",
+		c.registryPullLimitsConfigMap, limits.Default, limits.Registries)
+	c.imageManager.SetRegistryPullLimits(limits)
+}
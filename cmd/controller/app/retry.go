@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// syncRetryBaseDelay and syncRetryMaxDelay bound the exponential backoff of the retries of a failed sync
+	syncRetryBaseDelay = 5 * time.Millisecond
+	syncRetryMaxDelay  = 1000 * time.Second
+	// syncRetryJitter is the maximum fraction by which the delay of a retry is randomly lengthened
+	syncRetryJitter = 0.5
+	// maxSyncRetries is the number of times a failed sync of an image cache is retried before it is dropped
+	maxSyncRetries = 15
+)
+
+// jitterRateLimiter lengthens the delays of a rate limiter by a random jitter, so that the retries of
+// the image caches failing together (e.g. while the API server throttles requests) are spread over time
+type jitterRateLimiter struct {
+	workqueue.RateLimiter
+	jitter float64
+}
+
+// When returns the delay of the rate limiter for the item, randomly lengthened by up to the jitter
+func (r *jitterRateLimiter) When(item interface{}) time.Duration {
+	return wait.Jitter(r.RateLimiter.When(item), r.jitter)
+}
+
+// newSyncRateLimiter returns the rate limiter of the workqueue of the controller: the failed syncs of an
+// image cache are retried with exponential backoff and jitter, within the overall rate limit of the
+// default controller rate limiter
+func newSyncRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		&jitterRateLimiter{
+			RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(syncRetryBaseDelay, syncRetryMaxDelay),
+			jitter:      syncRetryJitter,
+		},
+		workqueue.DefaultControllerRateLimiter(),
+	)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// maxUnavailableNodes returns the maximum number of nodes refreshing the image cache at once, given by the
+// maxUnavailable (or maxUnavailablePerGroup) field of its rollout strategy and the number of nodes it applies
+// to. A percentage is rounded up, and at least one node is refreshed at a time. Zero means no limit.
+func maxUnavailableNodes(maxUnavailable *intstr.IntOrString, fieldName string, nodes int) (int, error) {
+	if maxUnavailable == nil {
+		return 0, nil
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, nodes, true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s of rollout strategy: %v", fieldName, err)
+	}
+	if value < 1 {
+		value = 1
+	}
+	return value, nil
+}
+
+// nodeGroup returns the node group of the node, the value of its RefreshGroupByLabel label
+func nodeGroup(imageCache *v1alpha3.ImageCache, node *corev1.Node) string {
+	if imageCache.Spec.RolloutStrategy == nil || imageCache.Spec.RolloutStrategy.RefreshGroupByLabel == "" {
+		return ""
+	}
+	return node.Labels[imageCache.Spec.RolloutStrategy.RefreshGroupByLabel]
+}
+
+// limitRollout applies the rollout strategy of the image cache to its image pull requests, so that the
+// image manager refreshes the image cache on at most maxUnavailable of its nodes, and on at most
+// maxUnavailablePerGroup of the nodes of each node group, at once
+func limitRollout(imageCache *v1alpha3.ImageCache, requests []images.ImageWorkRequest) error {
+	nodes := map[string]bool{}
+	groups := map[string]map[string]bool{}
+	for _, r := range requests {
+		if r.Node != nil && r.WorkType != images.ImageCachePurge {
+			nodes[r.Node.Name] = true
+			group := nodeGroup(imageCache, r.Node)
+			if groups[group] == nil {
+				groups[group] = map[string]bool{}
+			}
+			groups[group][r.Node.Name] = true
+		}
+	}
+	strategy := imageCache.Spec.RolloutStrategy
+	if strategy == nil {
+		strategy = &v1alpha3.RolloutStrategy{}
+	}
+	maxUnavailable, err := maxUnavailableNodes(strategy.MaxUnavailable, "maxUnavailable", len(nodes))
+	if err != nil {
+		return err
+	}
+	maxUnavailablePerGroup := map[string]int{}
+	for group, groupNodes := range groups {
+		if maxUnavailablePerGroup[group], err = maxUnavailableNodes(strategy.MaxUnavailablePerGroup, "maxUnavailablePerGroup", len(groupNodes)); err != nil {
+			return err
+		}
+	}
+	for i := range requests {
+		if requests[i].WorkType != images.ImageCachePurge {
+			requests[i].MaxUnavailableNodes = maxUnavailable
+			if requests[i].Node != nil {
+				requests[i].NodeGroup = nodeGroup(imageCache, requests[i].Node)
+				requests[i].MaxUnavailableNodesPerGroup = maxUnavailablePerGroup[requests[i].NodeGroup]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"k8s.io/klog/v2"
+)
+
+// tracingServiceName is the service name of the spans of the controller, unless set by OTEL_SERVICE_NAME
+const tracingServiceName = "kubefledged-controller"
+
+// tracingEnabled checks whether an OTLP endpoint to export the spans to is set in the environment
+func tracingEnabled(getenv func(string) string) bool {
+	return getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// SetupTracing exports the spans of the reconciles of image caches and of their jobs over OTLP/HTTP, when
+// an OTLP endpoint is set in the environment. The exporter is configured with the standard OTEL_EXPORTER_OTLP_*
+// environment variables, and the resource of the spans with OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES.
+// It returns the function flushing the spans and shutting down the exporter.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if !tracingEnabled(os.Getenv) {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(tracingServiceName)), resource.WithFromEnv())
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	klog.Info("Exporting traces over OTLP")
+	return provider.Shutdown, nil
+}
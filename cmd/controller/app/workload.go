@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// workloadPodSpec reads the pod template of the workload referenced by the image cache, in the
+// namespace of the image cache. It returns nil if the image cache references no workload.
+func (c *Controller) workloadPodSpec(imageCache *v1alpha3.ImageCache) (*corev1.PodSpec, error) {
+	ref := imageCache.Spec.WorkloadRef
+	if ref == nil {
+		return nil, nil
+	}
+	switch ref.Kind {
+	case v1alpha3.WorkloadKindDeployment:
+		deployment, err := c.kubeclientset.AppsV1().Deployments(imageCache.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &deployment.Spec.Template.Spec, nil
+	case v1alpha3.WorkloadKindDaemonSet:
+		daemonSet, err := c.kubeclientset.AppsV1().DaemonSets(imageCache.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &daemonSet.Spec.Template.Spec, nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind %q", ref.Kind)
+}
+
+// podSpecImages returns the images of the containers, init containers and ephemeral containers of a pod
+// spec, each once
+func podSpecImages(podSpec *corev1.PodSpec) []string {
+	imgs := []string{}
+	add := func(image string) {
+		if image != "" && !imageListed(image, imgs) {
+			imgs = append(imgs, image)
+		}
+	}
+	for _, container := range podSpec.InitContainers {
+		add(container.Image)
+	}
+	for _, container := range podSpec.Containers {
+		add(container.Image)
+	}
+	for _, container := range podSpec.EphemeralContainers {
+		add(container.Image)
+	}
+	return imgs
+}
+
+// workloadImages returns the images of the workload referenced by the image cache that are not already
+// in its cacheSpec, if the image cache caches the images of its workload
+func (c *Controller) workloadImages(imageCache *v1alpha3.ImageCache) ([]string, error) {
+	if imageCache.Spec.WorkloadRef == nil || !imageCache.Spec.WorkloadRef.CacheImages {
+		return nil, nil
+	}
+	podSpec, err := c.workloadPodSpec(imageCache)
+	if err != nil {
+		return nil, err
+	}
+	imgs := []string{}
+	for _, image := range podSpecImages(podSpec) {
+		if !imageInCacheSpec(imageCache, image) {
+			imgs = append(imgs, image)
+		}
+	}
+	return imgs, nil
+}
+
+// workloadPlacement returns the pod template of the workload restricting the nodes of the image cache.
+// Images are not pulled if the workload is missing, as the syncHandler rejects the image cache before,
+// but they are deleted from all the nodes of the image cache, as the workload may have been deleted
+// after they were pulled.
+func (c *Controller) workloadPlacement(imageCache *v1alpha3.ImageCache) (*corev1.PodSpec, error) {
+	podSpec, err := c.workloadPodSpec(imageCache)
+	if apierrors.IsNotFound(err) {
+		klog.Warningf("Workload %s %s/%s of imagecache(%s) not found, so not restricting its nodes",
+			imageCache.Spec.WorkloadRef.Kind, imageCache.Namespace, imageCache.Spec.WorkloadRef.Name, imageCache.Name)
+		return nil, nil
+	}
+	if err != nil {
+		klog.Errorf("Error getting workload of imagecache(%s): %v", imageCache.Name, err)
+		return nil, err
+	}
+	return podSpec, nil
+}
+
+// nodeMatchesPlacement checks whether the pods of a workload can be scheduled on the node as far as
+// their nodeSelector and required node affinity go. Taints are left to the tolerations of the image cache.
+func nodeMatchesPlacement(node *corev1.Node, podSpec *corev1.PodSpec) (bool, error) {
+	if podSpec == nil {
+		return true, nil
+	}
+	if !labels.SelectorFromSet(podSpec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+	return nodeMatchesAffinity(node, podSpec.Affinity)
+}
+
+// rejectWorkload fails the action on an image cache whose workload could not be read. The image
+// cache is reconciled again on its next update or refresh.
+func (c *Controller) rejectWorkload(imageCache *v1alpha3.ImageCache, status *v1alpha3.ImageCacheStatus, err error) error {
+	status.Status = v1alpha3.ImageCacheActionStatusFailed
+	status.Reason = v1alpha3.ImageCacheReasonWorkloadNotFound
+	status.Message = fmt.Sprintf("%s: %v", v1alpha3.ImageCacheMessageWorkloadNotFound, err)
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		klog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+	klog.Errorf("%s: %s", v1alpha3.ImageCacheReasonWorkloadNotFound, status.Message)
+	c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
+	return nil
+}
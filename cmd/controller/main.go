@@ -17,21 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
 
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"github.com/lcouds/kube-fledged/cmd/controller/app"
 	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
 	informers "github.com/lcouds/kube-fledged/pkg/client/informers/externalversions"
+	"github.com/lcouds/kube-fledged/pkg/images"
 	"github.com/lcouds/kube-fledged/pkg/signals"
 )
 
@@ -42,6 +48,7 @@ var (
 	busyboxImage               string
 	imagePullPolicy            string
 	fledgedNameSpace           string
+	clusterImageCacheNamespace string
 	serviceAccountName         string
 	imageDeleteJobHostNetwork  bool
 	jobPriorityClassName       string
@@ -50,75 +57,112 @@ var (
 	//Default value for when `--job-retention-policy` flag is not set
 	canDeleteJob  bool = true
 	criSocketPath string
+	jobOptions    images.JobOptions
+
+	validateImagePullSecrets       bool
+	imagePullSecretRecheckInterval time.Duration
+	cachedImagesConfigMap          string
+	concurrentReconciles           = 1
 )
 
 func main() {
 	flag.Parse()
 
+	if imageDeleteJobHostNetwork {
+		klog.Warning("--image-delete-job-host-network is deprecated and ignored: set deleteJobHostNetwork in the spec of the image caches instead")
+	}
+
+	if clusterImageCacheNamespace == "" {
+		clusterImageCacheNamespace = fledgedNameSpace
+	}
+
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
 
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
-		glog.Fatalf("Error building kubeconfig: %s", err.Error())
+		klog.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
 	fledgedClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building fledged clientset: %s", err.Error())
+		klog.Fatalf("Error building fledged clientset: %s", err.Error())
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
 	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedClient, time.Second*30)
 
-	controller := app.NewController(kubeClient, fledgedClient, fledgedNameSpace,
+	controller := app.NewController(kubeClient, fledgedClient, fledgedNameSpace, clusterImageCacheNamespace,
 		kubeInformerFactory.Core().V1().Nodes(),
+		kubeInformerFactory.Core().V1().ConfigMaps(),
 		fledgedInformerFactory.Kubefledged().V1alpha3().ImageCaches(),
+		fledgedInformerFactory.Kubefledged().V1alpha3().ClusterImageCaches(),
 		imageCacheRefreshFrequency, imagePullDeadlineDuration, criClientImage,
-		busyboxImage, imagePullPolicy, serviceAccountName, imageDeleteJobHostNetwork,
-		jobPriorityClassName, canDeleteJob, criSocketPath)
+		busyboxImage, imagePullPolicy, serviceAccountName,
+		jobPriorityClassName, canDeleteJob, criSocketPath, validateImagePullSecrets, imagePullSecretRecheckInterval,
+		cachedImagesConfigMap, jobOptions, klog.Background())
 
-	glog.Info("Starting pre-flight checks")
+	klog.Info("Starting pre-flight checks")
 	if err = controller.PreFlightChecks(); err != nil {
-		glog.Fatalf("Error running pre-flight checks: %s", err.Error())
+		klog.Fatalf("Error running pre-flight checks: %s", err.Error())
 	}
-	glog.Info("Pre-flight checks completed")
+	klog.Info("Pre-flight checks completed")
+
+	shutdownTracing, err := app.SetupTracing(context.Background())
+	if err != nil {
+		klog.Fatalf("Error setting up tracing: %s", err.Error())
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			klog.Errorf("Error shutting down tracing: %v", err)
+		}
+	}()
 
 	go kubeInformerFactory.Start(stopCh)
 	go fledgedInformerFactory.Start(stopCh)
 
-	if err = controller.Run(1, stopCh); err != nil {
-		glog.Fatalf("Error running controller: %s", err.Error())
+	if err = controller.Run(concurrentReconciles, stopCh); err != nil {
+		klog.Fatalf("Error running controller: %s", err.Error())
 	}
 }
 
 func init() {
+	// klog registers the logging flags of glog (e.g. -v, -stderrthreshold) and its own
+	klog.InitFlags(nil)
 
 	flag.StringVar(&kubeconfig, "kubeconfig", "",
 		"Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "",
 		"The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 
-	flag.DurationVar(&imagePullDeadlineDuration, "image-pull-deadline-duration", time.Minute*5, "Maximum duration allowed for pulling an image. After this duration, image pull is considered to have failed")
+	flag.DurationVar(&imagePullDeadlineDuration, "image-pull-deadline-duration", time.Minute*5, "Maximum duration allowed for pulling an image. After this duration, image pull is considered to have failed. It also bounds the activeDeadlineSeconds of image pull jobs. Can be overridden per image cache using 'imagePullDeadline' in the cache spec")
 	flag.DurationVar(&imageCacheRefreshFrequency, "image-cache-refresh-frequency", time.Minute*15, "The image cache is refreshed periodically to ensure the cache is up to date. Setting this flag to 0s will disable refresh")
-	flag.StringVar(&imagePullPolicy, "image-pull-policy", "IfNotPresent", "Image pull policy for pulling images into the cache. Possible values are 'IfNotPresent' and 'Always'. Default value is 'IfNotPresent'. Images with no or ':latest' tag are always pulled")
+	flag.StringVar(&imagePullPolicy, "image-pull-policy", "IfNotPresent", "Image pull policy for pulling images into the cache. Possible values are 'IfNotPresent', 'Always' and 'Never'. Default value is 'IfNotPresent'. Images with no or ':latest' tag are always pulled. 'Never' only verifies that the images are present in the nodes without pulling them")
 	if fledgedNameSpace = os.Getenv("KUBEFLEDGED_NAMESPACE"); fledgedNameSpace == "" {
 		fledgedNameSpace = "kube-fledged"
 	}
+	flag.StringVar(&clusterImageCacheNamespace, "cluster-image-cache-namespace", "", "namespace in which the jobs of ClusterImageCaches are created. Its secrets are the image pull secrets of the ClusterImageCaches (default: the namespace of kubefledged-controller)")
 	if criClientImage = os.Getenv("KUBEFLEDGED_CRI_CLIENT_IMAGE"); criClientImage == "" {
 		criClientImage = "senthilrch/kubefledged-cri-client:latest"
 	}
 	if busyboxImage = os.Getenv("BUSYBOX_IMAGE"); busyboxImage == "" {
 		busyboxImage = "senthilrch/busybox:1.35.0"
 	}
+	if jobOptions.WindowsCRIClientImage = os.Getenv("KUBEFLEDGED_WINDOWS_CRI_CLIENT_IMAGE"); jobOptions.WindowsCRIClientImage == "" {
+		jobOptions.WindowsCRIClientImage = images.DefaultWindowsCRIClientImage
+	}
+	if jobOptions.OrasImage = os.Getenv("KUBEFLEDGED_ORAS_IMAGE"); jobOptions.OrasImage == "" {
+		jobOptions.OrasImage = images.DefaultOrasImage
+	}
+	flag.StringVar(&jobOptions.ArtifactCacheDir, "artifact-cache-dir", images.DefaultArtifactCacheDir, "directory of the nodes to which the images of artifactType 'Artifact' (e.g. Helm charts) are pulled with oras")
 	flag.StringVar(&serviceAccountName, "service-account-name", "", "serviceAccountName used in Jobs created for pulling/deleting images. Optional flag. If not specified the default service account of the namespace is used")
-	flag.BoolVar(&imageDeleteJobHostNetwork, "image-delete-job-host-network", false, "whether the pod for the image delete job should be run with 'HostNetwork: true'. Default value: false")
-	flag.StringVar(&jobPriorityClassName, "job-priority-class-name", "", "priorityClassName of jobs created by kubefledged-controller")
+	flag.BoolVar(&imageDeleteJobHostNetwork, "image-delete-job-host-network", false, "DEPRECATED: ignored. Set 'deleteJobHostNetwork' in the cache spec to run the image delete jobs of an image cache with 'HostNetwork: true'")
+	flag.StringVar(&jobPriorityClassName, "job-priority-class-name", "", "priorityClassName of jobs created by kubefledged-controller, unless overridden by pullJobPriorityClassName or deleteJobPriorityClassName of the image cache")
 	flag.Func("job-retention-policy", "sets the retention behavior of finished Image Manager Jobs (default: 'delete')",
 		func(val string) error {
 			const (
@@ -128,19 +172,165 @@ func init() {
 			switch strings.ToLower(strings.TrimSpace(val)) {
 			case deletePolicy:
 				canDeleteJob = true
-				glog.Infof("Using '%s' Job Retention Policy", deletePolicy)
+				klog.Infof("Using '%s' Job Retention Policy", deletePolicy)
 				return nil
 			case retainPolicy:
 				canDeleteJob = false
-				glog.Infof("Using '%s' Job Retention Policy", retainPolicy)
+				klog.Infof("Using '%s' Job Retention Policy", retainPolicy)
 				return nil
 			default:
 				//canDeleteJob is initialized to true already
-				glog.Infof("Failed to set '%s' Job Retention Policy -- invalid input:"+
+				klog.Infof("Failed to set '%s' Job Retention Policy -- invalid input:"+
 					" falling back to '%s' Job Retention Policy", val, deletePolicy)
 				return nil
 			}
 		},
 	)
-	flag.StringVar(&criSocketPath, "cri-socket-path", "", "path to the cri socket on the node e.g. /run/containerd/containerd.sock (default: /var/run/docker.sock, /run/containerd/containerd.sock, /var/run/crio/crio.sock)")
+	flag.BoolVar(&validateImagePullSecrets, "validate-image-pull-secrets", true, "whether the image pull secrets of an image cache are checked to exist before its images are pulled. An image cache with missing secrets fails with reason 'ImagePullSecretNotFound' and creates no jobs")
+	flag.DurationVar(&imagePullSecretRecheckInterval, "image-pull-secret-recheck-interval", time.Second*30, "interval at which an image cache with missing image pull secrets is checked again, so that its images are pulled once the secrets are created. Setting this flag to 0s disables the recheck")
+	flag.StringVar(&cachedImagesConfigMap, "cached-images-configmap", "", "name of a ConfigMap in the namespace of kubefledged-controller to which the images cached by all the image caches are written, with the number of nodes each is cached on, and the images cached on each node. Empty disables the summary")
+	flag.BoolVar(&jobOptions.DisableLatestAlwaysPull, "disable-latest-always-pull", false, "keep the IfNotPresent image pull policy for images tagged latest or untagged, instead of always pulling them. Can be set per image cache using 'disableLatestAlwaysPull' in the cache spec")
+	flag.BoolVar(&jobOptions.ForceFullCache, "force-full-cache", false, "cache all the files of the images by default, as with 'forceFullCache' of the image in the cache spec. Images with 'forceFullCache' or 'cachePaths' in the cache spec are cached as set there")
+	flag.BoolVar(&jobOptions.LegacyModelzDirCache, "legacy-modelz-dir-cache", false, "DEPRECATED: cache the /opt/conda/bin/ and /opt/conda/lib/ directories of images whose name contains 'modelzai'. Use 'cachePaths' of the image in the cache spec instead")
+	flag.DurationVar(&jobOptions.ImagePullJobDeadline, "image-pull-job-deadline", time.Hour, "activeDeadlineSeconds of the jobs created for pulling images, unless the image pull deadline is shorter. Can be overridden per image cache using 'imagePullJobDeadline' in the cache spec")
+	flag.DurationVar(&jobOptions.ImageDeleteJobDeadline, "image-delete-job-deadline", time.Hour, "activeDeadlineSeconds of the jobs created for deleting images. Can be overridden per image cache using 'imageDeleteJobDeadline' in the cache spec")
+	flag.Func("job-backoff-limit", "number of retries of image pull/delete jobs before they are considered failed (default: 0)",
+		nonNegativeInt32Flag(&jobOptions.JobBackoffLimit))
+	jobOptions.PullJobRestartPolicy = corev1.RestartPolicyNever
+	flag.Func("pull-job-restart-policy", "restartPolicy of the pods of image pull jobs. 'OnFailure' restarts a failed container within its pod, e.g. to resume reading the files of 'cachePaths', instead of creating a new pod. Possible values are 'Never' and 'OnFailure' (default: Never)",
+		restartPolicyFlag(&jobOptions.PullJobRestartPolicy))
+	jobOptions.DeleteJobRestartPolicy = corev1.RestartPolicyNever
+	flag.Func("delete-job-restart-policy", "restartPolicy of the pods of image delete jobs. Possible values are 'Never' and 'OnFailure' (default: Never)",
+		restartPolicyFlag(&jobOptions.DeleteJobRestartPolicy))
+	jobOptions.TTLSecondsAfterFinished = 300
+	flag.Func("job-ttl-seconds-after-finished", "ttlSecondsAfterFinished of image pull/delete jobs, after which finished jobs are deleted automatically. Setting this flag to 0 disables it (default: 300)",
+		nonNegativeInt32Flag(&jobOptions.TTLSecondsAfterFinished))
+	jobOptions.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+	}
+	flag.Func("job-cpu-request", "cpu request of the containers of image pull/delete jobs (default: 10m)",
+		resourceQuantityFlag(jobOptions.Resources.Requests, corev1.ResourceCPU))
+	flag.Func("job-cpu-limit", "cpu limit of the containers of image pull/delete jobs (default: 500m)",
+		resourceQuantityFlag(jobOptions.Resources.Limits, corev1.ResourceCPU))
+	flag.Func("job-memory-request", "memory request of the containers of image pull/delete jobs (default: 32Mi)",
+		resourceQuantityFlag(jobOptions.Resources.Requests, corev1.ResourceMemory))
+	flag.Func("job-memory-limit", "memory limit of the containers of image pull/delete jobs (default: 256Mi)",
+		resourceQuantityFlag(jobOptions.Resources.Limits, corev1.ResourceMemory))
+	flag.Func("container-runtime", "container runtime used for deleting images, overriding the runtime detected from the node. Possible values are 'docker', 'containerd', 'crio', 'nerdctl' and 'podman' (default: detected from the node)",
+		func(val string) error {
+			runtime, err := images.ParseContainerRuntime(val)
+			if err != nil {
+				return err
+			}
+			jobOptions.ContainerRuntime = runtime
+			return nil
+		},
+	)
+	flag.Func("kubernetes-distribution", "kubernetes distribution embedding the container runtime of the nodes, overriding the distribution detected from the node for resolving the cri socket and the registry trust directory. Possible values are 'k3s', 'rke2' and 'microk8s' (default: detected from the node)",
+		func(val string) error {
+			distribution, err := images.ParseKubernetesDistribution(val)
+			if err != nil {
+				return err
+			}
+			jobOptions.KubernetesDistribution = distribution
+			return nil
+		},
+	)
+	flag.DurationVar(&jobOptions.ImagePullBackOffGracePeriod, "image-pull-backoff-grace-period", time.Second*30, "how long the pod of an image pull/delete job may fail to pull its image (ErrImagePull or ImagePullBackOff) before the job is failed with the error of the registry and deleted, instead of waiting for the image pull deadline. Setting this flag to 0s fails the job at the first failed pull")
+	flag.DurationVar(&jobOptions.RateLimitRetryAfter, "rate-limit-retry-after", time.Hour, "how long after an image pull rate-limited by the registry (e.g. toomanyrequests or HTTP 429) the image cache is refreshed to retry it, unless the registry gives a retry-after. The image cache is not refreshed before. Setting this flag to 0s disables the retry")
+	flag.StringVar(&jobOptions.HTTPProxy, "job-http-proxy", "", "HTTP_PROXY of the containers of image pull/delete jobs, for clusters behind a proxy (default: none)")
+	flag.StringVar(&jobOptions.HTTPSProxy, "job-https-proxy", "", "HTTPS_PROXY of the containers of image pull/delete jobs, for clusters behind a proxy (default: none)")
+	flag.BoolVar(&jobOptions.CheckHelperImages, "check-helper-images", false, "check with a single job on one node that the busybox and cri client images can be pulled before creating the image pull jobs of an image cache. If they cannot be pulled (e.g. from a bad mirror), no image pull job is created and the image cache fails with reason HelperImageUnavailable (default: false)")
+	flag.StringVar(&jobOptions.JobNamespace, "job-namespace", "", "namespace in which the image pull/delete jobs are created, instead of the namespace of their image cache. The image pull secrets of the image caches must exist in that namespace (default: none)")
+	flag.StringVar(&jobOptions.NoProxy, "job-no-proxy", "", "comma-separated destinations added to NO_PROXY of the containers of image pull/delete jobs, which always has the loopback addresses, the cluster domain and the private address ranges (default: none)")
+	flag.Func("max-node-disk-usage-percent", "defer the image pulls to the nodes reporting DiskPressure, or whose images use at least this percentage of their ephemeral storage, to the next refresh of the image cache. Setting this flag to 0 disables the check (default: 0)",
+		percentFlag(&jobOptions.MaxNodeDiskUsagePercent))
+	flag.IntVar(&jobOptions.MaxPullJobsPerNode, "max-pull-jobs-per-node", 2, "Maximum number of image pull jobs active on a node at once. The remaining image pulls of the node are queued. Setting this flag to 0 removes the limit")
+	flag.IntVar(&jobOptions.MaxConcurrentPullJobs, "max-concurrent-pull-jobs", 0, "Maximum number of image pull jobs active in the cluster at once. The remaining image pulls are queued, with the next free slot going to the image cache with the fewest active pull jobs. Setting this flag to 0 removes the limit")
+	flag.BoolVar(&jobOptions.DeleteImagesByDigest, "delete-images-by-digest", false, "Delete images from the nodes by the repo@digest name listed for them in the status of the node instead of by their tag, so that an image referenced by several tags is removed and frees its disk. Images not listed with a digest are deleted by their tag. Default value is 'false'")
+	flag.StringVar(&jobOptions.RegistryPullLimitsConfigMap, "registry-pull-limits-configmap", "", "name of a ConfigMap in the namespace of kubefledged-controller holding the maximum number of image pull jobs active at once per registry: the default limit in its 'default' key, and the limits of given registries in its 'registries' key as a comma-separated list of registry=limit e.g. docker.io=2,registry.internal:5000=20. The remaining image pulls of a registry are queued. Changes are applied without restart. Empty disables the limits")
+	flag.Func("concurrent-reconciles", "number of workers reconciling image caches in parallel. An image cache is never reconciled by two workers at once (default: 1)",
+		positiveIntFlag(&concurrentReconciles))
+	flag.Func("registry-mirrors", "comma-separated list of registry mirrors from which images are pulled, each of the form source=mirror e.g. docker.io/library=registry.internal/mirror. The longest source prefix matching the fully-qualified repository of an image is replaced by its mirror prefix (default: none)",
+		func(val string) error {
+			mirrors, err := images.ParseRegistryMirrors(val)
+			if err != nil {
+				return err
+			}
+			jobOptions.RegistryMirrors = mirrors
+			return nil
+		},
+	)
+	flag.StringVar(&criSocketPath, "cri-socket-path", "", "path to the cri socket on the node e.g. /run/containerd/containerd.sock (default: detected from the container runtime and kubernetes distribution of the node). The node annotation kubefledged.io/cri-socket-path takes precedence over this flag")
+}
+
+// resourceQuantityFlag parses a resource quantity into the resource list. An empty value removes the resource from the list
+func resourceQuantityFlag(resources corev1.ResourceList, name corev1.ResourceName) func(string) error {
+	return func(val string) error {
+		if val == "" {
+			delete(resources, name)
+			return nil
+		}
+		quantity, err := resource.ParseQuantity(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s quantity %q: %v", name, val, err)
+		}
+		resources[name] = quantity
+		return nil
+	}
+}
+
+// restartPolicyFlag parses the restart policy of the pods of jobs into target
+func restartPolicyFlag(target *corev1.RestartPolicy) func(string) error {
+	return func(val string) error {
+		policy, err := images.ParseRestartPolicy(val)
+		if err != nil {
+			return err
+		}
+		*target = policy
+		return nil
+	}
+}
+
+// percentFlag parses a percentage between 0 and 100 into target
+func percentFlag(target *int) func(string) error {
+	return func(val string) error {
+		i, err := strconv.Atoi(val)
+		if err != nil || i < 0 || i > 100 {
+			return fmt.Errorf("invalid value %q: must be a percentage between 0 and 100", val)
+		}
+		*target = i
+		return nil
+	}
+}
+
+// positiveIntFlag parses a positive integer into target
+func positiveIntFlag(target *int) func(string) error {
+	return func(val string) error {
+		i, err := strconv.Atoi(val)
+		if err != nil || i < 1 {
+			return fmt.Errorf("invalid value %q: must be a positive integer", val)
+		}
+		*target = i
+		return nil
+	}
+}
+
+// nonNegativeInt32Flag parses a non-negative integer into target
+func nonNegativeInt32Flag(target *int32) func(string) error {
+	return func(val string) error {
+		i, err := strconv.ParseInt(val, 10, 32)
+		if err != nil || i < 0 {
+			return fmt.Errorf("invalid value %q: must be a non-negative integer", val)
+		}
+		*target = int32(i)
+		return nil
+	}
 }
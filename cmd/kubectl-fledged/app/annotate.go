@@ -0,0 +1,75 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Action is an action on an image cache triggered by annotating it
+type Action string
+
+// List of actions on an image cache
+const (
+	ActionRefresh Action = "refresh"
+	ActionPurge   Action = "purge"
+)
+
+// AnnotationKey returns the annotation that triggers the action
+func (a Action) AnnotationKey() (string, error) {
+	switch a {
+	case ActionRefresh:
+		return v1alpha3.ImageCacheRefreshAnnotationKey, nil
+	case ActionPurge:
+		return v1alpha3.ImageCachePurgeAnnotationKey, nil
+	}
+	return "", fmt.Errorf("unknown action %q: must be %q or %q", a, ActionRefresh, ActionPurge)
+}
+
+// Trigger annotates the image cache so that the controller refreshes or purges it. An image
+// cache already annotated for the action, or being deleted, is left untouched.
+func Trigger(ctx context.Context, client clientset.Interface, namespace, name string, action Action) (*v1alpha3.ImageCache, error) {
+	key, err := action.AnnotationKey()
+	if err != nil {
+		return nil, err
+	}
+	imageCache, err := client.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting imagecache %s/%s: %v", namespace, name, err)
+	}
+	if imageCache.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("imagecache %s/%s is being deleted", namespace, name)
+	}
+	if _, ok := imageCache.Annotations[key]; ok {
+		return nil, fmt.Errorf("%s of imagecache %s/%s already in progress (annotation %s is set)", action, namespace, name, key)
+	}
+	imageCacheCopy := imageCache.DeepCopy()
+	if imageCacheCopy.Annotations == nil {
+		imageCacheCopy.Annotations = map[string]string{}
+	}
+	imageCacheCopy.Annotations[key] = ""
+	imageCache, err = client.KubefledgedV1alpha3().ImageCaches(namespace).Update(ctx, imageCacheCopy, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error annotating imagecache %s/%s: %v", namespace, name, err)
+	}
+	return imageCache, nil
+}
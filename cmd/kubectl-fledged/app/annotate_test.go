@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	kubefledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	kubefledgedclientsetfake "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+)
+
+func TestTrigger(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name                string
+		imageCache          *kubefledgedv1alpha3.ImageCache
+		action              Action
+		updateError         bool
+		expectedAnnotations map[string]string
+		expectErr           bool
+		expectedErrorString string
+	}{
+		{
+			name:                "#1: Refresh an image cache without annotations",
+			imageCache:          &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"}},
+			action:              ActionRefresh,
+			expectedAnnotations: map[string]string{kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey: ""},
+		},
+		{
+			name: "#2: Purge an image cache keeps its other annotations",
+			imageCache: &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged",
+				Annotations: map[string]string{"foo": "bar"}}},
+			action:              ActionPurge,
+			expectedAnnotations: map[string]string{"foo": "bar", kubefledgedv1alpha3.ImageCachePurgeAnnotationKey: ""},
+		},
+		{
+			name: "#3: Refresh already in progress",
+			imageCache: &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged",
+				Annotations: map[string]string{kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey: ""}}},
+			action:              ActionRefresh,
+			expectErr:           true,
+			expectedErrorString: "refresh of imagecache kube-fledged/foo already in progress",
+		},
+		{
+			name: "#4: Image cache being deleted",
+			imageCache: &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged",
+				DeletionTimestamp: &now}},
+			action:              ActionPurge,
+			expectErr:           true,
+			expectedErrorString: "imagecache kube-fledged/foo is being deleted",
+		},
+		{
+			name:                "#5: Image cache not found",
+			action:              ActionRefresh,
+			expectErr:           true,
+			expectedErrorString: "error getting imagecache kube-fledged/foo",
+		},
+		{
+			name:                "#6: Unknown action",
+			imageCache:          &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"}},
+			action:              Action("delete"),
+			expectErr:           true,
+			expectedErrorString: "unknown action \"delete\"",
+		},
+		{
+			name:                "#7: Error updating the image cache",
+			imageCache:          &kubefledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"}},
+			action:              ActionRefresh,
+			updateError:         true,
+			expectErr:           true,
+			expectedErrorString: "error annotating imagecache kube-fledged/foo",
+		},
+	}
+
+	for _, test := range tests {
+		fakekubefledgedclientset := kubefledgedclientsetfake.NewSimpleClientset()
+		if test.imageCache != nil {
+			fakekubefledgedclientset = kubefledgedclientsetfake.NewSimpleClientset(test.imageCache)
+		}
+		if test.updateError {
+			fakekubefledgedclientset.PrependReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, fmt.Errorf("fake error")
+			})
+		}
+		imageCache, err := Trigger(context.TODO(), fakekubefledgedclientset, "kube-fledged", "foo", test.action)
+		if test.expectErr {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrorString, err)
+			}
+			if test.imageCache != nil {
+				stored, _ := fakekubefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+				if !reflect.DeepEqual(stored.Annotations, test.imageCache.Annotations) {
+					t.Errorf("Test: %s failed: expectedAnnotations=%+v, actualAnnotations=%+v", test.name, test.imageCache.Annotations, stored.Annotations)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: err=%v", test.name, err)
+			continue
+		}
+		stored, _ := fakekubefledgedclientset.KubefledgedV1alpha3().ImageCaches("kube-fledged").Get(context.TODO(), "foo", metav1.GetOptions{})
+		if !reflect.DeepEqual(stored.Annotations, test.expectedAnnotations) || !reflect.DeepEqual(imageCache.Annotations, test.expectedAnnotations) {
+			t.Errorf("Test: %s failed: expectedAnnotations=%+v, actualAnnotations=%+v", test.name, test.expectedAnnotations, stored.Annotations)
+		}
+	}
+}
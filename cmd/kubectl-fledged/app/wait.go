@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Wait polls the image cache until the controller completes the action, printing the
+// per-node progress to out whenever it changes. The controller removes the annotation
+// triggering the action once it has recorded the outcome in the status.
+func Wait(ctx context.Context, client clientset.Interface, namespace, name string, action Action,
+	interval, timeout time.Duration, out io.Writer) (*v1alpha3.ImageCache, error) {
+	key, err := action.AnnotationKey()
+	if err != nil {
+		return nil, err
+	}
+	var imageCache *v1alpha3.ImageCache
+	last := ""
+	err = wait.PollImmediate(interval, timeout, func() (bool, error) {
+		ic, err := client.KubefledgedV1alpha3().ImageCaches(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("error getting imagecache %s/%s: %v", namespace, name, err)
+		}
+		imageCache = ic
+		if progress := formatProgress(imageCache); progress != last {
+			fmt.Fprint(out, progress)
+			last = progress
+		}
+		_, annotated := imageCache.Annotations[key]
+		return !annotated && imageCache.Status.Status != v1alpha3.ImageCacheActionStatusProcessing, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return imageCache, fmt.Errorf("timed out after %s waiting for %s of imagecache %s/%s", timeout, action, namespace, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imageCache, nil
+}
+
+// formatProgress describes the status of the image cache, followed by the number of images
+// in each state on every node
+func formatProgress(imageCache *v1alpha3.ImageCache) string {
+	var b strings.Builder
+	status := imageCache.Status.Status
+	if status == "" {
+		status = "Pending"
+	}
+	fmt.Fprintf(&b, "%s: %d%% complete\n", status, imageCache.Status.CompletionPercentage)
+	for _, n := range imageCache.Status.Nodes {
+		counts := map[v1alpha3.NodeImageState]int{}
+		for _, i := range n.Images {
+			counts[i.State]++
+		}
+		states := []string{}
+		for state, count := range counts {
+			states = append(states, fmt.Sprintf("%s=%d", state, count))
+		}
+		sort.Strings(states)
+		fmt.Fprintf(&b, "  %s: %s\n", n.Node, strings.Join(states, " "))
+	}
+	return b.String()
+}
+
+// FormatResult describes the outcome of the action, including the images that failed on each node
+func FormatResult(imageCache *v1alpha3.ImageCache) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", imageCache.Status.Status, imageCache.Status.Message)
+	images := []string{}
+	for image := range imageCache.Status.Failures {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	for _, image := range images {
+		for _, f := range imageCache.Status.Failures[image] {
+			fmt.Fprintf(&b, "  %s on %s: %s: %s\n", image, f.Node, f.Reason, f.Message)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	kubefledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	kubefledgedclientsetfake "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+)
+
+func TestWait(t *testing.T) {
+	processing := &kubefledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged",
+			Annotations: map[string]string{kubefledgedv1alpha3.ImageCacheRefreshAnnotationKey: ""}},
+		Status: kubefledgedv1alpha3.ImageCacheStatus{
+			Status:               kubefledgedv1alpha3.ImageCacheActionStatusProcessing,
+			CompletionPercentage: 50,
+			Nodes: []kubefledgedv1alpha3.NodeStatus{
+				{Node: "node1", Images: []kubefledgedv1alpha3.NodeImageStatus{
+					{Image: "foo", State: kubefledgedv1alpha3.NodeImageStateCached},
+					{Image: "bar", State: kubefledgedv1alpha3.NodeImageStatePulling},
+				}},
+			},
+		},
+	}
+	completed := processing.DeepCopy()
+	completed.Annotations = nil
+	completed.Status.Status = kubefledgedv1alpha3.ImageCacheActionStatusSucceeded
+	completed.Status.CompletionPercentage = 100
+	completed.Status.Nodes[0].Images[1].State = kubefledgedv1alpha3.NodeImageStateCached
+
+	tests := []struct {
+		name                string
+		imageCaches         []*kubefledgedv1alpha3.ImageCache
+		expectedOutput      string
+		expectErr           bool
+		expectedErrorString string
+	}{
+		{
+			name:        "#1: Refresh completes",
+			imageCaches: []*kubefledgedv1alpha3.ImageCache{processing, processing, completed},
+			expectedOutput: "Processing: 50% complete\n  node1: Cached=1 Pulling=1\n" +
+				"Succeeded: 100% complete\n  node1: Cached=2\n",
+		},
+		{
+			name:                "#2: Refresh times out",
+			imageCaches:         []*kubefledgedv1alpha3.ImageCache{processing},
+			expectedOutput:      "Processing: 50% complete\n  node1: Cached=1 Pulling=1\n",
+			expectErr:           true,
+			expectedErrorString: "timed out after",
+		},
+	}
+
+	for _, test := range tests {
+		fakekubefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		gets := 0
+		fakekubefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			imageCache := test.imageCaches[len(test.imageCaches)-1]
+			if gets < len(test.imageCaches) {
+				imageCache = test.imageCaches[gets]
+			}
+			gets++
+			return true, imageCache, nil
+		})
+		out := &bytes.Buffer{}
+		imageCache, err := Wait(context.TODO(), fakekubefledgedclientset, "kube-fledged", "foo", ActionRefresh,
+			time.Millisecond, 50*time.Millisecond, out)
+		if test.expectErr {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrorString, err)
+			}
+		} else if err != nil || imageCache.Status.Status != kubefledgedv1alpha3.ImageCacheActionStatusSucceeded {
+			t.Errorf("Test: %s failed: err=%v, imageCache=%+v", test.name, err, imageCache)
+		}
+		if out.String() != test.expectedOutput {
+			t.Errorf("Test: %s failed: expectedOutput=%q, actualOutput=%q", test.name, test.expectedOutput, out.String())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-fledged refreshes or purges an image cache and waits for the controller to complete it.
+// Installed on the PATH, it is invoked as the kubectl plugin "kubectl fledged".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lcouds/kube-fledged/cmd/kubectl-fledged/app"
+	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `Usage: kubectl fledged (refresh|purge) IMAGECACHE [flags]
+
+Flags:
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("kubectl-fledged", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	kubeConfig := fs.String("kubeconfig", "", "Path to a kubeconfig. Defaults to the kubeconfig of kubectl.")
+	namespace := fs.String("namespace", "", "Namespace of the image cache. Defaults to the namespace of the current context.")
+	fs.StringVar(namespace, "n", "", "Shorthand for --namespace.")
+	noWait := fs.Bool("no-wait", false, "Return once the image cache is annotated, without waiting for the controller to complete the action.")
+	interval := fs.Duration("interval", 2*time.Second, "Interval between checks of the status of the image cache.")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Maximum time to wait for the controller to complete the action.")
+
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := app.Action(args[0])
+	if _, err := action.AnnotationKey(); err != nil {
+		return err
+	}
+	// flags may be given before or after the name of the image cache
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		return fmt.Errorf("name of the image cache is required")
+	}
+	name := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeConfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	if *namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			return fmt.Errorf("error getting the namespace of the current context: %v", err)
+		}
+		*namespace = ns
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error building kubefledged clientset: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := app.Trigger(ctx, client, *namespace, name, action); err != nil {
+		return err
+	}
+	fmt.Printf("imagecache %s/%s annotated for %s\n", *namespace, name, action)
+	if *noWait {
+		return nil
+	}
+	imageCache, err := app.Wait(ctx, client, *namespace, name, action, *interval, *timeout, os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Print(app.FormatResult(imageCache))
+	if imageCache.Status.Status == v1alpha3.ImageCacheActionStatusFailed {
+		return fmt.Errorf("%s of imagecache %s/%s failed", action, *namespace, name)
+	}
+	return nil
+}
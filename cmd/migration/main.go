@@ -5,12 +5,12 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/golang/glog"
 	"github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	clientset "github.com/lcouds/kube-fledged/pkg/client/clientset/versioned"
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -20,6 +20,8 @@ var (
 )
 
 func init() {
+	// klog registers the logging flags of glog (e.g. -v, -stderrthreshold) and its own
+	klog.InitFlags(nil)
 	flag.StringVar(&kubeConfig, "kubeconfig", "",
 		"Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "",
@@ -33,17 +35,17 @@ func main() {
 
 	clientCmdConfig, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
 	if err != nil {
-		glog.Fatalf("error building kubeconfig: %s", err.Error())
+		klog.Fatalf("error building kubeconfig: %s", err.Error())
 	}
 
 	client, err := clientset.NewForConfig(clientCmdConfig)
 	if err != nil {
-		glog.Fatalf("error building Inference clientset: %s", err.Error())
+		klog.Fatalf("error building Inference clientset: %s", err.Error())
 	}
 
 	old, err := client.KubefledgedV1alpha2().ImageCaches("").List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		glog.Fatalf("error listing Inferences: %s", err.Error())
+		klog.Fatalf("error listing Inferences: %s", err.Error())
 	}
 
 	for _, o := range old.Items {
@@ -89,13 +91,13 @@ func main() {
 		}
 		_, err = client.KubefledgedV1alpha3().ImageCaches(o.Namespace).Update(context.TODO(), new, metav1.UpdateOptions{})
 		if err != nil {
-			glog.Fatalf("error creating Inference: %s", err.Error())
+			klog.Fatalf("error creating Inference: %s", err.Error())
 		}
 	}
 
 	new, err := client.KubefledgedV1alpha3().ImageCaches("").List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		glog.Fatalf("error listing Inferences: %s", err.Error())
+		klog.Fatalf("error listing Inferences: %s", err.Error())
 	}
 
 	for _, n := range new.Items {
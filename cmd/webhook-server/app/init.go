@@ -28,15 +28,16 @@ import (
 	"os"
 	"time"
 
-	"github.com/golang/glog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 )
 
 // InitWebhookServer initialises kube-fledged webhook server:-
 // - generates cert/key pair
 // - patched CA bundle to validatingwebhookconfiguration
+// - patched CA bundle to mutatingwebhookconfiguration, if one is configured
 func InitWebhookServer() error {
 	var caPEM, serverCertPEM, serverPrivKeyPEM *bytes.Buffer
 
@@ -44,6 +45,7 @@ func InitWebhookServer() error {
 	webhookServerNameSpace := os.Getenv("KUBEFLEDGED_NAMESPACE")
 	certKeyPath := os.Getenv("CERT_KEY_PATH")
 	validatingWebhookConfig := os.Getenv("VALIDATING_WEBHOOK_CONFIG")
+	mutatingWebhookConfig := os.Getenv("MUTATING_WEBHOOK_CONFIG")
 
 	// CA config
 	caConf := &x509.Certificate{
@@ -62,18 +64,18 @@ func InitWebhookServer() error {
 	// CA private key
 	caPrivKey, err := rsa.GenerateKey(cryptorand.Reader, 4096)
 	if err != nil {
-		glog.Errorf("error in generating CA private key: %v", err)
+		klog.Errorf("error in generating CA private key: %v", err)
 		return err
 	}
-	glog.Info("success: ca private key created")
+	klog.Info("success: ca private key created")
 
 	// Self signed CA certificate
 	caBytes, err := x509.CreateCertificate(cryptorand.Reader, caConf, caConf, &caPrivKey.PublicKey, caPrivKey)
 	if err != nil {
-		glog.Errorf("error in generating CA certificate: %v", err)
+		klog.Errorf("error in generating CA certificate: %v", err)
 		return err
 	}
-	glog.Info("success: self-signed ca certificate created")
+	klog.Info("success: self-signed ca certificate created")
 
 	// PEM encode CA cert
 	caPEM = new(bytes.Buffer)
@@ -81,7 +83,7 @@ func InitWebhookServer() error {
 		Type:  "CERTIFICATE",
 		Bytes: caBytes,
 	})
-	glog.Info("success: ca certificate encoded to pem format")
+	klog.Info("success: ca certificate encoded to pem format")
 
 	dnsNames := []string{
 		webhookServerService,
@@ -108,18 +110,18 @@ func InitWebhookServer() error {
 	// server private key
 	serverPrivKey, err := rsa.GenerateKey(cryptorand.Reader, 4096)
 	if err != nil {
-		glog.Errorf("error in generating server private key: %v", err)
+		klog.Errorf("error in generating server private key: %v", err)
 		return err
 	}
-	glog.Info("success: server private key created")
+	klog.Info("success: server private key created")
 
 	// sign the server cert
 	serverCertBytes, err := x509.CreateCertificate(cryptorand.Reader, certConf, caConf, &serverPrivKey.PublicKey, caPrivKey)
 	if err != nil {
-		glog.Errorf("error in generating server certificate: %v", err)
+		klog.Errorf("error in generating server certificate: %v", err)
 		return err
 	}
-	glog.Info("success: server certificate created")
+	klog.Info("success: server certificate created")
 
 	// PEM encode the  server cert and key
 	serverCertPEM = new(bytes.Buffer)
@@ -127,39 +129,49 @@ func InitWebhookServer() error {
 		Type:  "CERTIFICATE",
 		Bytes: serverCertBytes,
 	})
-	glog.Info("success: server certificate encoded to pem format")
+	klog.Info("success: server certificate encoded to pem format")
 
 	serverPrivKeyPEM = new(bytes.Buffer)
 	_ = pem.Encode(serverPrivKeyPEM, &pem.Block{
 		Type:  "RSA PRIVATE KEY",
 		Bytes: x509.MarshalPKCS1PrivateKey(serverPrivKey),
 	})
-	glog.Info("success: server private key encoded to pem format")
+	klog.Info("success: server private key encoded to pem format")
 
 	err = os.MkdirAll(certKeyPath, 0666)
 	if err != nil {
-		glog.Errorf("error in creating directory %s: %v", certKeyPath, err)
+		klog.Errorf("error in creating directory %s: %v", certKeyPath, err)
 		return err
 	}
 	err = writeFile(certKeyPath+"tls.crt", serverCertPEM)
 	if err != nil {
-		glog.Errorf("error in writing tls.crt: %v", err)
+		klog.Errorf("error in writing tls.crt: %v", err)
 		return err
 	}
-	glog.Infof("success: server cert (tls.crt) copied to %s", certKeyPath)
+	klog.Infof("success: server cert (tls.crt) copied to %s", certKeyPath)
 
 	err = writeFile(certKeyPath+"tls.key", serverPrivKeyPEM)
 	if err != nil {
-		glog.Errorf("error in writing tls.key: %v", err)
+		klog.Errorf("error in writing tls.key: %v", err)
 		return err
 	}
-	glog.Infof("success: server key (tls.key) copied to %s", certKeyPath)
+	klog.Infof("success: server key (tls.key) copied to %s", certKeyPath)
 
 	err = updateValidatingWebhookConfig(caPEM, validatingWebhookConfig)
 	if err != nil {
 		return err
 	}
-	glog.Infof("success: validatingwebhookconfiguration %s updated", validatingWebhookConfig)
+	klog.Infof("success: validatingwebhookconfiguration %s updated", validatingWebhookConfig)
+
+	if mutatingWebhookConfig == "" {
+		klog.Info("MUTATING_WEBHOOK_CONFIG not set: image references will not be canonicalized on admission")
+		return nil
+	}
+	err = updateMutatingWebhookConfig(caPEM, mutatingWebhookConfig)
+	if err != nil {
+		return err
+	}
+	klog.Infof("success: mutatingwebhookconfiguration %s updated", mutatingWebhookConfig)
 	return nil
 }
 
@@ -182,20 +194,20 @@ func updateValidatingWebhookConfig(caPEM *bytes.Buffer, validatingWebhookConfig
 
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
-		glog.Fatalf("Error building kubeconfig: %s", err.Error())
+		klog.Fatalf("Error building kubeconfig: %s", err.Error())
 		return err
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 		return err
 	}
 
 	vwc, err := kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(
 		context.TODO(), validatingWebhookConfig, metav1.GetOptions{})
 	if err != nil {
-		glog.Errorf("Error in getting validatingwebhookconfig: %s", err.Error())
+		klog.Errorf("Error in getting validatingwebhookconfig: %s", err.Error())
 		return err
 	}
 
@@ -204,7 +216,40 @@ func updateValidatingWebhookConfig(caPEM *bytes.Buffer, validatingWebhookConfig
 	_, err = kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Update(
 		context.TODO(), vwc, metav1.UpdateOptions{})
 	if err != nil {
-		glog.Errorf("Error in updating validatingwebhookconfig: %s", err.Error())
+		klog.Errorf("Error in updating validatingwebhookconfig: %s", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func updateMutatingWebhookConfig(caPEM *bytes.Buffer, mutatingWebhookConfig string) error {
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		klog.Fatalf("Error building kubeconfig: %s", err.Error())
+		return err
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		return err
+	}
+
+	mwc, err := kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
+		context.TODO(), mutatingWebhookConfig, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("Error in getting mutatingwebhookconfig: %s", err.Error())
+		return err
+	}
+
+	mwc.Webhooks[0].ClientConfig.CABundle = caPEM.Bytes()
+
+	_, err = kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(
+		context.TODO(), mwc, metav1.UpdateOptions{})
+	if err != nil {
+		klog.Errorf("Error in updating mutatingwebhookconfig: %s", err.Error())
 		return err
 	}
 
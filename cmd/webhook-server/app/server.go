@@ -23,8 +23,8 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"github.com/golang/glog"
 	"github.com/lcouds/kube-fledged/pkg/webhook"
+	"k8s.io/klog/v2"
 
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
@@ -74,7 +74,7 @@ type Config struct {
 func configTLS(config Config) *tls.Config {
 	sCert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
 	if err != nil {
-		glog.Fatal(err)
+		klog.Fatal(err)
 	}
 	return &tls.Config{
 		Certificates: []tls.Certificate{sCert},
@@ -111,17 +111,17 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 	// verify the content type is accurate
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/json" {
-		glog.Errorf("contentType=%s, expect application/json", contentType)
+		klog.Errorf("contentType=%s, expect application/json", contentType)
 		return
 	}
 
-	glog.V(2).Info(fmt.Sprintf("handling request: %s", body))
+	klog.V(2).Info(fmt.Sprintf("handling request: %s", body))
 
 	deserializer := codecs.UniversalDeserializer()
 	obj, gvk, err := deserializer.Decode(body, nil, nil)
 	if err != nil {
 		msg := fmt.Sprintf("Request could not be decoded: %v", err)
-		glog.Error(msg)
+		klog.Error(msg)
 		http.Error(w, msg, http.StatusBadRequest)
 		return
 	}
@@ -131,7 +131,7 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 	case admissionv1beta1.SchemeGroupVersion.WithKind("AdmissionReview"):
 		requestedAdmissionReview, ok := obj.(*admissionv1beta1.AdmissionReview)
 		if !ok {
-			glog.Errorf("Expected v1beta1.AdmissionReview but got: %T", obj)
+			klog.Errorf("Expected v1beta1.AdmissionReview but got: %T", obj)
 			return
 		}
 		responseAdmissionReview := &admissionv1beta1.AdmissionReview{}
@@ -142,7 +142,7 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 	case admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"):
 		requestedAdmissionReview, ok := obj.(*admissionv1.AdmissionReview)
 		if !ok {
-			glog.Errorf("Expected v1.AdmissionReview but got: %T", obj)
+			klog.Errorf("Expected v1.AdmissionReview but got: %T", obj)
 			return
 		}
 		responseAdmissionReview := &admissionv1.AdmissionReview{}
@@ -152,21 +152,21 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 		responseObj = responseAdmissionReview
 	default:
 		msg := fmt.Sprintf("Unsupported group version kind: %v", gvk)
-		glog.Error(msg)
+		klog.Error(msg)
 		http.Error(w, msg, http.StatusBadRequest)
 		return
 	}
 
-	glog.V(2).Info(fmt.Sprintf("sending response: %v", responseObj))
+	klog.V(2).Info(fmt.Sprintf("sending response: %v", responseObj))
 	respBytes, err := json.Marshal(responseObj)
 	if err != nil {
-		glog.Error(err)
+		klog.Error(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(respBytes); err != nil {
-		glog.Error(err)
+		klog.Error(err)
 	}
 }
 
@@ -249,7 +249,7 @@ func validateImageCache(w http.ResponseWriter, r *http.Request) {
 }
 
 func mutateImageCache(w http.ResponseWriter, r *http.Request) {
-	// serve(w, r, newDelegateToV1AdmitHandler(webhook.MutateImageCache))
+	serve(w, r, newDelegateToV1AdmitHandler(webhook.MutateImageCache))
 }
 
 // StartWebhookServer starts a new wwebhook server for kube-fledged
@@ -266,7 +266,7 @@ func StartWebhookServer(certFile string, keyFile string, port int) error {
 		Addr:      fmt.Sprintf(":%d", port),
 		TLSConfig: configTLS(config),
 	}
-	glog.Infof("Wehook server listening on :%d", port)
+	klog.Infof("Wehook server listening on :%d", port)
 	err := server.ListenAndServeTLS("", "")
 	if err != nil {
 		return err
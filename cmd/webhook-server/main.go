@@ -20,6 +20,8 @@ import (
 	"flag"
 
 	"github.com/lcouds/kube-fledged/cmd/webhook-server/app"
+	"github.com/lcouds/kube-fledged/pkg/webhook"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -27,13 +29,29 @@ var (
 	keyFile    string
 	port       int
 	initServer bool
+	// imagePolicy restricts the images that image caches can cache
+	imagePolicy webhook.ImagePolicy
 )
 
 func init() {
+	// klog registers the logging flags of glog (e.g. -v, -stderrthreshold) and its own
+	klog.InitFlags(nil)
 	flag.StringVar(&certFile, "cert-file", "", "File containing the default x509 Certificate for HTTPS. (CA cert, if any, concatenated after server cert).")
 	flag.StringVar(&keyFile, "key-file", "", "File containing the default x509 private key matching --cert-file.")
 	flag.IntVar(&port, "port", 443, "Secure port that the webhook server listens on")
 	flag.BoolVar(&initServer, "init-server", false, "True means only init tasks for the server will be performed. Server is not started")
+	flag.Func("image-allowlist", "comma-separated list of patterns of the fully-qualified repositories of images that image caches are allowed to cache e.g. docker.io/library/*,*.internal.io/*. '*' matches any characters, including '/' (default: all images allowed)",
+		func(val string) (err error) {
+			imagePolicy.Allowlist, err = webhook.ParseImagePatterns(val)
+			return err
+		},
+	)
+	flag.Func("image-denylist", "comma-separated list of patterns of the fully-qualified repositories of images that image caches are not allowed to cache. Takes precedence over --image-allowlist (default: none)",
+		func(val string) (err error) {
+			imagePolicy.Denylist, err = webhook.ParseImagePatterns(val)
+			return err
+		},
+	)
 }
 
 func main() {
@@ -50,6 +68,9 @@ func main() {
 		}
 		return
 	}
+	if err := webhook.SetImagePolicy(imagePolicy); err != nil {
+		panic(err)
+	}
 	if err := app.StartWebhookServer(certFile, keyFile, port); err != nil {
 		panic(err)
 	}
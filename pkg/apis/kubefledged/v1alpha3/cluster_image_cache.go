@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterImageCacheKind is the kind of ClusterImageCache resources
+const ClusterImageCacheKind = "ClusterImageCache"
+
+// ImageCacheFromCluster converts a ClusterImageCache to the ImageCache through which it is reconciled.
+// The ImageCache is in the namespace in which the jobs of the ClusterImageCache are created, and keeps
+// the kind ClusterImageCache so that it is written back as a ClusterImageCache.
+func ImageCacheFromCluster(clusterImageCache *ClusterImageCache, namespace string) *ImageCache {
+	imageCache := &ImageCache{
+		TypeMeta:   metav1.TypeMeta{Kind: ClusterImageCacheKind, APIVersion: SchemeGroupVersion.String()},
+		ObjectMeta: *clusterImageCache.ObjectMeta.DeepCopy(),
+		Spec:       *clusterImageCache.Spec.DeepCopy(),
+		Status:     *clusterImageCache.Status.DeepCopy(),
+	}
+	imageCache.Namespace = namespace
+	return imageCache
+}
+
+// ClusterImageCacheFromImageCache converts back the ImageCache through which a ClusterImageCache is reconciled
+func ClusterImageCacheFromImageCache(imageCache *ImageCache) *ClusterImageCache {
+	clusterImageCache := &ClusterImageCache{
+		TypeMeta:   metav1.TypeMeta{Kind: ClusterImageCacheKind, APIVersion: SchemeGroupVersion.String()},
+		ObjectMeta: *imageCache.ObjectMeta.DeepCopy(),
+		Spec:       *imageCache.Spec.DeepCopy(),
+		Status:     *imageCache.Status.DeepCopy(),
+	}
+	clusterImageCache.Namespace = ""
+	return clusterImageCache
+}
+
+// IsClusterImageCache checks whether the ImageCache reconciles a ClusterImageCache
+func IsClusterImageCache(imageCache *ImageCache) bool {
+	return imageCache.Kind == ClusterImageCacheKind
+}
@@ -18,7 +18,9 @@ package v1alpha3
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
@@ -27,6 +29,8 @@ import (
 // ImageCache is a specification for a ImageCache resource
 // +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message"
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Completion",type="integer",JSONPath=".status.completionPercentage"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type ImageCache struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -40,18 +44,267 @@ type ImageCache struct {
 type Image struct {
 	Name           string `json:"name"`
 	ForceFullCache bool   `json:"forceFullCache"`
+	// ImagePullPolicy overrides the controller-wide image pull policy for this image
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// CachePaths lists the directories of the image whose files are read after the pull,
+	// so that they get cached at streaming mode of GCP
+	CachePaths []string `json:"cachePaths,omitempty"`
+	// WarmCommand is run in the pulled image by its pull job, instead of the echo binary copied from the
+	// busybox image, e.g. to exercise a model loader or prime a cache directory. It is not run on Windows nodes.
+	WarmCommand []string `json:"warmCommand,omitempty"`
+	// Aliases are further references the image is known by, e.g. its name in another registry. Once
+	// the image is pulled, a short-lived job tags it with its aliases through the client of the container
+	// runtime of the node, so that pods referring to an alias find the image cached. Images are not tagged
+	// on CRI-O and Windows nodes, and OCI artifacts have no aliases.
+	Aliases []string `json:"aliases,omitempty"`
+	// Architectures lists the node architectures (e.g. amd64, arm64) the image is built for.
+	// Nodes of other architectures are skipped. When empty, the image is pulled on all nodes.
+	Architectures []string `json:"architectures,omitempty"`
+	// ImagePullSecrets are the secrets used to pull this image, in addition to the imagePullSecrets of the image cache
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// Priority orders the pulls of the images of the image cache: images of higher priority (e.g. the
+	// application image) are pulled before images of lower priority (e.g. sidecars). Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
+	// ArtifactType tells how the image is pulled to the nodes. Defaults to Image, a container image
+	// pulled by running it. Wasm images are pulled into the container runtime without being run, and
+	// Artifacts (e.g. Helm charts) are pulled with oras into the artifact cache directory of the nodes.
+	ArtifactType ArtifactType `json:"artifactType,omitempty"`
 }
 
+// ArtifactType defines how an image of the cache is pulled and stored on the nodes
+type ArtifactType string
+
+// List of constants for ArtifactType
+const (
+	// ArtifactTypeImage is a runnable container image, pulled by the kubelet running it
+	ArtifactTypeImage ArtifactType = "Image"
+	// ArtifactTypeWasm is a non-runnable image (e.g. a WASM module) pulled through the runtime socket
+	ArtifactTypeWasm ArtifactType = "Wasm"
+	// ArtifactTypeArtifact is an OCI artifact not stored by the container runtime (e.g. a Helm chart)
+	ArtifactTypeArtifact ArtifactType = "Artifact"
+)
+
+// FailurePolicy defines whether the image pulls of an image cache go on after one of them failed
+type FailurePolicy string
+
+// List of constants for FailurePolicy
+const (
+	// FailurePolicyContinue pulls the remaining images to the remaining nodes after a failed pull (best effort)
+	FailurePolicyContinue FailurePolicy = "Continue"
+	// FailurePolicyAbort creates no new pull job after a failed pull (fail fast). Active pull jobs run to completion.
+	FailurePolicyAbort FailurePolicy = "Abort"
+)
+
 // CacheSpecImages specifies the Images to be cached
 type CacheSpecImages struct {
 	Images       []Image           `json:"images"`
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 }
 
+// ImageListSource specifies a list of images to be cached that is read from another resource
+type ImageListSource struct {
+	// ConfigMapRef is the ConfigMap holding the images to be cached
+	ConfigMapRef *ConfigMapImageListReference `json:"configMapRef,omitempty"`
+	// NodeSelector selects the nodes to which the images of the list are cached. All the nodes if empty.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+// ConfigMapImageListReference references a ConfigMap in the namespace of the image cache holding images
+// to be cached, one image per line or as a JSON array of images. Lines starting with '#' are ignored.
+type ConfigMapImageListReference struct {
+	// Name is the name of the ConfigMap
+	Name string `json:"name"`
+	// Key is the key of the data of the ConfigMap holding the images. The images of every key are read if empty.
+	Key string `json:"key,omitempty"`
+}
+
+// WorkloadReference references a workload in the namespace of the image cache (the cluster image cache
+// namespace for a ClusterImageCache)
+type WorkloadReference struct {
+	// Kind is the kind of the workload: Deployment or DaemonSet
+	Kind WorkloadKind `json:"kind"`
+	// Name is the name of the workload
+	Name string `json:"name"`
+	// CacheImages adds the images of the containers, init containers and ephemeral containers of the pod
+	// template of the workload to the cacheSpec
+	CacheImages bool `json:"cacheImages,omitempty"`
+}
+
+// WorkloadKind is the kind of a workload referenced by an image cache
+type WorkloadKind string
+
+// List of constants for WorkloadKind
+const (
+	WorkloadKindDeployment WorkloadKind = "Deployment"
+	WorkloadKindDaemonSet  WorkloadKind = "DaemonSet"
+)
+
+// RegistryCA is the CA bundle of a registry, read from a key of a ConfigMap or Secret in the namespace of
+// the image cache (the cluster image cache namespace for a ClusterImageCache)
+type RegistryCA struct {
+	// Registry is the host, and port if any, of the registry e.g. registry.corp.internal:5000
+	Registry string `json:"registry"`
+	// ConfigMapRef is the key of a ConfigMap holding the PEM-encoded CA bundle
+	ConfigMapRef *corev1.ConfigMapKeySelector `json:"configMapRef,omitempty"`
+	// SecretRef is the key of a Secret holding the PEM-encoded CA bundle
+	SecretRef *corev1.SecretKeySelector `json:"secretRef,omitempty"`
+}
+
+// RolloutStrategy specifies how the refresh of an image cache is rolled out to its nodes
+type RolloutStrategy struct {
+	// MaxUnavailable is the maximum number of nodes refreshing the image cache at once, as an
+	// absolute number (e.g. 2) or a percentage of the nodes of the image cache (e.g. "25%").
+	// A percentage is rounded up, so that at least one node is refreshed at a time.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// RefreshGroupByLabel is the label of the nodes grouping them for MaxUnavailablePerGroup,
+	// e.g. topology.kubernetes.io/zone. The nodes without the label form a group of their own.
+	RefreshGroupByLabel string `json:"refreshGroupByLabel,omitempty"`
+	// MaxUnavailablePerGroup is the maximum number of nodes of a group refreshing the image cache at once,
+	// as an absolute number (e.g. 1) or a percentage of the nodes of the group (e.g. "50%"), so that a
+	// refresh does not take a whole zone at once. The groups are refreshed in parallel, within MaxUnavailable.
+	MaxUnavailablePerGroup *intstr.IntOrString `json:"maxUnavailablePerGroup,omitempty"`
+}
+
 // ImageCacheSpec is the spec for a ImageCache resource
 type ImageCacheSpec struct {
 	CacheSpec        []CacheSpecImages             `json:"cacheSpec"`
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// ImageListFrom adds the images read from a ConfigMap to the cacheSpec, e.g. an image list generated by a
+	// build pipeline. The image cache is updated when the ConfigMap changes.
+	ImageListFrom *ImageListSource `json:"imageListFrom,omitempty"`
+	// RegistryCAs are the CA bundles of registries with a self-signed or internal CA. Image pull jobs
+	// install them in the registry trust directory of the container runtime of the node before pulling.
+	RegistryCAs []RegistryCA `json:"registryCAs,omitempty"`
+	// ImagePullJobDeadline overrides the controller-wide activeDeadlineSeconds of image pull jobs
+	ImagePullJobDeadline *metav1.Duration `json:"imagePullJobDeadline,omitempty"`
+	// ImageDeleteJobDeadline overrides the controller-wide activeDeadlineSeconds of image delete jobs
+	ImageDeleteJobDeadline *metav1.Duration `json:"imageDeleteJobDeadline,omitempty"`
+	// ImagePullDeadline overrides the controller-wide maximum duration allowed for pulling the images of
+	// the cache. Images not pulled by then are reported as failed with reason PullTimedOut. It also bounds
+	// the activeDeadlineSeconds of the image pull jobs.
+	ImagePullDeadline *metav1.Duration `json:"imagePullDeadline,omitempty"`
+	// ImagePullTimeoutRetries is the number of times the pull job of an image not pulled within the image
+	// pull deadline is recreated, each getting the full deadline, before the pull is reported as timed out
+	ImagePullTimeoutRetries int32 `json:"imagePullTimeoutRetries,omitempty"`
+	// FailedPullRetries is the number of times the failed pull jobs of the image cache are recreated, each
+	// getting the full image pull deadline, before the pulls are reported as failed
+	FailedPullRetries int32 `json:"failedPullRetries,omitempty"`
+	// PartialFailureThresholdPercent is the percentage of node/image pairs whose pull may fail while the
+	// image cache is still reported as PartiallyCached rather than Failed. Defaults to 0, i.e. any failed
+	// pull fails the image cache.
+	PartialFailureThresholdPercent int32 `json:"partialFailureThresholdPercent,omitempty"`
+	// FailurePolicy is whether the controller goes on creating the pull jobs of the image cache after one of
+	// them failed (Continue), or skips the image pulls not yet started (Abort). Defaults to Continue.
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+	// JobResources overrides the controller-wide resource requests and limits of the containers of image pull/delete jobs
+	JobResources *corev1.ResourceRequirements `json:"jobResources,omitempty"`
+	// JobPodSecurityContext overrides the pod security context of image pull/delete jobs on Linux nodes.
+	// By default, pull jobs run as the unprivileged user 65534 and delete jobs as root, the owner of the runtime socket.
+	JobPodSecurityContext *corev1.PodSecurityContext `json:"jobPodSecurityContext,omitempty"`
+	// JobSecurityContext overrides the security context of the containers of image pull/delete jobs on Linux nodes.
+	// By default, the containers run with a read-only root filesystem, no capabilities and no privilege escalation.
+	JobSecurityContext *corev1.SecurityContext `json:"jobSecurityContext,omitempty"`
+	// JobSeccompProfile overrides the seccomp profile of the pods of image pull/delete jobs on Linux nodes,
+	// taking precedence over the seccomp profile of jobPodSecurityContext. Defaults to RuntimeDefault.
+	JobSeccompProfile *corev1.SeccompProfile `json:"jobSeccompProfile,omitempty"`
+	// DeleteJobHostNetwork runs the image delete jobs of the image cache in the network namespace of the node.
+	// The runtime socket is reached through a hostPath mount, so delete jobs need no host networking by default.
+	DeleteJobHostNetwork bool `json:"deleteJobHostNetwork,omitempty"`
+	// JobDNSPolicy is the dnsPolicy of the pods of image pull/delete jobs, e.g. None to resolve a private
+	// registry only through the resolvers of jobDNSConfig. Defaults to ClusterFirst.
+	JobDNSPolicy corev1.DNSPolicy `json:"jobDNSPolicy,omitempty"`
+	// JobDNSConfig is the dnsConfig (nameservers, searches and options) of the pods of image pull/delete jobs
+	JobDNSConfig *corev1.PodDNSConfig `json:"jobDNSConfig,omitempty"`
+	// ContainerdNamespace is the containerd namespace from which images are deleted on containerd nodes.
+	// When empty, images are deleted through the CRI (namespace k8s.io) using crictl.
+	ContainerdNamespace string `json:"containerdNamespace,omitempty"`
+	// Snapshotter is the containerd snapshotter (e.g. stargz or soci) into which the images pulled through the
+	// runtime socket (artifactType Wasm) are unpacked on containerd nodes, using ctr (or nerdctl) instead of crictl.
+	// When empty, the snapshotter configured for the CRI plugin of containerd is used.
+	Snapshotter string `json:"snapshotter,omitempty"`
+	// RefreshSchedule is a cron schedule (e.g. "0 2 * * *") on which the image cache is refreshed.
+	// When empty, the image cache is refreshed at the controller-wide refresh frequency.
+	RefreshSchedule string `json:"refreshSchedule,omitempty"`
+	// RefreshTimeZone is the IANA name of the time zone (e.g. "America/New_York") in which the refresh schedule is evaluated.
+	// Defaults to UTC.
+	RefreshTimeZone string `json:"refreshTimeZone,omitempty"`
+	// NodeSelector restricts the image cache to the nodes with these labels, in addition to the
+	// nodeSelector of each cache spec. Image pull/delete jobs are scheduled with this nodeSelector.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Affinity restricts the image cache to the nodes satisfying the required node affinity.
+	// Image pull/delete jobs are scheduled with this affinity.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// ExcludedNodeSelector excludes the nodes matching this label selector from the image cache, even if
+	// they match its nodeSelector and affinity. Excluded nodes are reported as Excluded in the status.
+	ExcludedNodeSelector *metav1.LabelSelector `json:"excludedNodeSelector,omitempty"`
+	// ExcludedNodeNames excludes the nodes of these names from the image cache, as excludedNodeSelector does
+	ExcludedNodeNames []string `json:"excludedNodeNames,omitempty"`
+	// WorkloadRef restricts the image cache to the nodes on which the pods of a Deployment or DaemonSet
+	// in the namespace of the image cache can be scheduled, i.e. the nodes matching the nodeSelector and
+	// the required node affinity of its pod template.
+	WorkloadRef *WorkloadReference `json:"workloadRef,omitempty"`
+	// Tolerations are the tolerations of image pull/delete jobs. When unset, image pull jobs tolerate
+	// no taint and image delete jobs tolerate every taint.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// CacheOnUnschedulableNodes pulls images also to the nodes that are unschedulable (cordoned).
+	// By default these nodes are skipped.
+	CacheOnUnschedulableNodes bool `json:"cacheOnUnschedulableNodes,omitempty"`
+	// RolloutStrategy limits the number of nodes refreshing the image cache at once.
+	// When unset, the image cache is refreshed on all nodes at once.
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+	// DryRun reports in the per-node status which images would be pulled to or deleted from
+	// each node, without creating any image pull/delete job.
+	DryRun bool `json:"dryRun,omitempty"`
+	// VerifyImages runs a short-lived job after each successful pull, inspecting the image through
+	// the container runtime of the node to confirm it is present with the expected digest. Images
+	// that pass the check are marked verified in the per-node status.
+	VerifyImages bool `json:"verifyImages,omitempty"`
+	// RuntimePresenceCheck checks the presence of the images through the container runtime of the node,
+	// with a short-lived job, instead of trusting the images listed in the node's status, which the kubelet
+	// updates lazily. It applies to the images the node's status lists as present with the IfNotPresent
+	// image pull policy, which are pulled if the runtime does not have them, and to all the images with
+	// the Never image pull policy. Ignored on Windows nodes and in dry run.
+	RuntimePresenceCheck bool `json:"runtimePresenceCheck,omitempty"`
+	// Paused stops the controller from creating image pull and delete jobs for the image cache, e.g.
+	// during a maintenance window. Active jobs run to completion. The changes made to the spec while
+	// paused are applied once the image cache is resumed.
+	Paused bool `json:"paused,omitempty"`
+	// DeleteImagesOnCacheDeletion deletes the images of the cache from the nodes when the image cache
+	// is deleted, except for images also cached by other image caches on the same node. The image
+	// cache is removed once the image delete jobs complete. By default the images remain on the nodes.
+	DeleteImagesOnCacheDeletion bool `json:"deleteImagesOnCacheDeletion,omitempty"`
+	// PruneRemovedImages deletes the images removed from the cacheSpec by an update of the image cache
+	// from the nodes, except for images also cached by other image caches on the same node. By default
+	// the images remain on the nodes.
+	PruneRemovedImages bool `json:"pruneRemovedImages,omitempty"`
+	// ForceDelete deletes images from the nodes even if they are used by pods on the node.
+	// By default such images are not deleted.
+	ForceDelete bool `json:"forceDelete,omitempty"`
+	// PinDigests pins each image to the digest it first resolved to, so that refreshes pull
+	// that exact digest even if the tag has moved since. The pinned digests are recorded in the status.
+	PinDigests bool `json:"pinDigests,omitempty"`
+	// DisableLatestAlwaysPull keeps the IfNotPresent image pull policy for images tagged latest or
+	// untagged, which are otherwise always pulled again on refresh
+	DisableLatestAlwaysPull bool `json:"disableLatestAlwaysPull,omitempty"`
+	// BusyboxImage overrides the controller-wide busybox image that image pull jobs copy the echo binary from
+	BusyboxImage string `json:"busyboxImage,omitempty"`
+	// CriClientImage overrides the controller-wide cri client image of image delete jobs on Linux nodes
+	CriClientImage string `json:"criClientImage,omitempty"`
+	// CriClientImages overrides the cri client image of image delete jobs per container runtime
+	// (docker, containerd, crio, nerdctl or podman), taking precedence over criClientImage
+	CriClientImages map[string]string `json:"criClientImages,omitempty"`
+	// PullJobPriorityClassName overrides the controller-wide priorityClassName of image pull jobs
+	PullJobPriorityClassName string `json:"pullJobPriorityClassName,omitempty"`
+	// DeleteJobPriorityClassName overrides the controller-wide priorityClassName of image delete jobs
+	DeleteJobPriorityClassName string `json:"deleteJobPriorityClassName,omitempty"`
+	// JobLabels are added to the labels of the pods of image pull/delete jobs. The labels set by the
+	// controller (app, kubefledged, imagecache, controller and image) cannot be overridden.
+	JobLabels map[string]string `json:"jobLabels,omitempty"`
+	// JobAnnotations are added to the annotations of the pods of image pull/delete jobs
+	JobAnnotations map[string]string `json:"jobAnnotations,omitempty"`
+	// PullBandwidth limits the ingress bandwidth of the pods of image pull jobs, e.g. 10M, through the
+	// kubernetes.io/ingress-bandwidth annotation. It needs a CNI plugin supporting traffic shaping.
+	PullBandwidth *resource.Quantity `json:"pullBandwidth,omitempty"`
 }
 
 // ImageCacheStatus is the status for a ImageCache resource
@@ -62,8 +315,75 @@ type ImageCacheStatus struct {
 	Failures       map[string]NodeReasonMessageList `json:"failures,omitempty"`
 	StartTime      *metav1.Time                     `json:"startTime"`
 	CompletionTime *metav1.Time                     `json:"completionTime,omitempty"`
+	// Nodes lists, for each node, the state of each image of the cache on that node
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+	// TotalSizeBytes is the disk space used by the cached images on all the nodes
+	TotalSizeBytes int64 `json:"totalSizeBytes,omitempty"`
+	// PinnedDigests maps each image of an image cache pinning digests to the digest it is pinned to
+	PinnedDigests map[string]string `json:"pinnedDigests,omitempty"`
+	// LastAppliedCacheSpec is the cacheSpec last applied to the nodes by a create, update or refresh
+	// of the image cache. An update pulls only the images added or changed since.
+	LastAppliedCacheSpec []CacheSpecImages `json:"lastAppliedCacheSpec,omitempty"`
+	// CompletionPercentage is the percentage of the images cached on the nodes of the image cache,
+	// out of all the images to be cached on these nodes
+	CompletionPercentage int32 `json:"completionPercentage"`
+	// Conditions are the conditions of the image cache. The Ready condition is True when every image
+	// is cached on every node of the image cache.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the generation of the image cache whose spec was last applied to the nodes
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Retries is the number of times the sync of the last action on the image cache was retried after
+	// failing, e.g. because the API server throttled requests
+	Retries int32 `json:"retries,omitempty"`
+	// RetryAfter is when the image pulls rate-limited by the registry are retried. The image cache
+	// is not refreshed before.
+	RetryAfter *metav1.Time `json:"retryAfter,omitempty"`
+}
+
+// NodeStatus has the state of the images of an image cache on a node
+type NodeStatus struct {
+	Node   string            `json:"node"`
+	Images []NodeImageStatus `json:"images"`
+	// TotalSizeBytes is the disk space used by the cached images on the node
+	TotalSizeBytes int64 `json:"totalSizeBytes,omitempty"`
 }
 
+// NodeImageStatus has the state of an image on a node
+type NodeImageStatus struct {
+	Image              string         `json:"image"`
+	State              NodeImageState `json:"state"`
+	LastTransitionTime metav1.Time    `json:"lastTransitionTime"`
+	Reason             string         `json:"reason,omitempty"`
+	Message            string         `json:"message,omitempty"`
+	// SizeBytes is the size of the image as reported in the status of the node
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+	// Digest is the digest the image resolved to on the node, as reported in the status of the node
+	Digest string `json:"digest,omitempty"`
+	// LastError is the error of the last failed pull or delete of the image on the node, from the
+	// termination message of the job container. It is retained until the image is cached on the node.
+	LastError string `json:"lastError,omitempty"`
+	// Verified is set on the images cached on the node that passed the check after their pull,
+	// when the image cache verifies its images
+	Verified bool `json:"verified,omitempty"`
+}
+
+// NodeImageState defines the state of an image on a node
+type NodeImageState string
+
+// List of constants for NodeImageState
+const (
+	NodeImageStatePulling  NodeImageState = "Pulling"
+	NodeImageStateCached   NodeImageState = "Cached"
+	NodeImageStateFailed   NodeImageState = "Failed"
+	NodeImageStateDeleting NodeImageState = "Deleting"
+	NodeImageStateSkipped  NodeImageState = "Skipped"
+	// NodeImageStateExcluded is reported on the nodes excluded by excludedNodeSelector or excludedNodeNames
+	NodeImageStateExcluded NodeImageState = "Excluded"
+	// NodeImageStateWouldPull and NodeImageStateWouldDelete are reported by image caches in dry run mode
+	NodeImageStateWouldPull   NodeImageState = "WouldPull"
+	NodeImageStateWouldDelete NodeImageState = "WouldDelete"
+)
+
 // NodeReasonMessage has failure reason and message for a node
 type NodeReasonMessage struct {
 	Node    string `json:"node"`
@@ -84,6 +404,61 @@ type ImageCacheList struct {
 	Items []ImageCache `json:"items"`
 }
 
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterImageCache is a specification for a cluster-scoped ImageCache resource. Its jobs are
+// created in the namespace of the controller.
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Completion",type="integer",JSONPath=".status.completionPercentage"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ClusterImageCache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageCacheSpec   `json:"spec"`
+	Status ImageCacheStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterImageCacheList is a list of ClusterImageCache resources
+type ClusterImageCacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterImageCache `json:"items"`
+}
+
+// ImageCacheRefreshAnnotationKey is the annotation that triggers a refresh of an image cache
+const ImageCacheRefreshAnnotationKey = "kubefledged.io/refresh-imagecache"
+
+// ImageCachePurgeAnnotationKey is the annotation that triggers a purge of an image cache
+const ImageCachePurgeAnnotationKey = "kubefledged.io/purge-imagecache"
+
+// ImageCachePurgeImageAnnotationKey is the annotation that triggers the deletion of a single image of an
+// image cache from its nodes. Its value is the reference of an image in the cacheSpec.
+const ImageCachePurgeImageAnnotationKey = "kubefledged.io/purge-image"
+
+// ImageCacheConditionReady is the condition that is True when every image is cached on every node of the image cache
+const ImageCacheConditionReady = "Ready"
+
+// ImageCacheConditionReconciling is the condition that is True while an action on the image cache is processing.
+// It is removed once the action completes, as in the kstatus convention read by GitOps tools.
+const ImageCacheConditionReconciling = "Reconciling"
+
+// ImageCacheConditionStalled is the condition that is True when the last action on the image cache failed.
+// It is removed once an action succeeds, as in the kstatus convention read by GitOps tools.
+const ImageCacheConditionStalled = "Stalled"
+
+// ImageCacheConditionPaused is the condition that is True while the image cache is paused.
+// It is removed once the image cache is resumed.
+const ImageCacheConditionPaused = "Paused"
+
 // ImageCacheActionStatus defines the status of ImageCacheAction
 type ImageCacheActionStatus string
 
@@ -95,6 +470,7 @@ const (
 	ImageCacheActionStatusUnknown            ImageCacheActionStatus = "Unknown"
 	ImageCacheActionStatusAborted            ImageCacheActionStatus = "Aborted"
 	ImageCacheActioneNoImagesPulledOrDeleted ImageCacheActionStatus = "NoImagesPulledOrDeleted"
+	ImageCacheActionStatusPartiallyCached    ImageCacheActionStatus = "PartiallyCached"
 )
 
 // List of constants for ImageCacheReason
@@ -104,6 +480,10 @@ const (
 	ImageCacheReasonImageCacheRefresh              = "ImageCacheRefresh"
 	ImageCacheReasonImageCachePurge                = "ImageCachePurge"
 	ImageCacheReasonImageCacheDelete               = "ImageCacheDelete"
+	ImageCacheReasonImagePurge                     = "ImagePurge"
+	ImageCacheReasonImageNotInCacheSpec            = "ImageNotInCacheSpec"
+	ImageCacheReasonImageListInvalid               = "ImageListInvalid"
+	ImageCacheReasonWorkloadNotFound               = "WorkloadNotFound"
 	ImageCacheReasonImagesPulledSuccessfully       = "ImagesPulledSuccessfully"
 	ImageCacheReasonImagesDeletedSuccessfully      = "ImagesDeletedSuccessfully"
 	ImageCacheReasonImagePullFailedForSomeImages   = "ImagePullFailedForSomeImages"
@@ -113,7 +493,25 @@ const (
 	ImageCacheReasonImagePullAborted               = "ImagePullAborted"
 	ImageCacheReasonCacheSpecValidationFailed      = "CacheSpecValidationFailed"
 	ImageCacheReasonOldImageCacheNotFound          = "OldImageCacheNotFound"
+	ImageCacheReasonImagePullSecretNotFound        = "ImagePullSecretNotFound"
 	ImageCacheReasonNotSupportedUpdates            = "NotSupportedUpdates"
+	ImageCacheReasonImageMissing                   = "ImageMissing"
+	ImageCacheReasonRateLimited                    = "RateLimited"
+	ImageCacheReasonPullJobQueued                  = "PullJobQueued"
+	ImageCacheReasonPullTimedOut                   = "PullTimedOut"
+	ImageCacheReasonArchitectureMismatch           = "ArchitectureMismatch"
+	ImageCacheReasonTaintNotTolerated              = "TaintNotTolerated"
+	ImageCacheReasonNodeUnschedulable              = "NodeUnschedulable"
+	ImageCacheReasonNodeExcluded                   = "NodeExcluded"
+	ImageCacheReasonDeferredDiskPressure           = "DeferredDiskPressure"
+	ImageCacheReasonImageVerificationFailed        = "ImageVerificationFailed"
+	ImageCacheReasonImageTagFailed                 = "ImageTagFailed"
+	ImageCacheReasonImageCachePaused               = "ImageCachePaused"
+	ImageCacheReasonImageInUse                     = "ImageInUse"
+	ImageCacheReasonAbortedOnFailure               = "AbortedOnFailure"
+	ImageCacheReasonAllImagesCached                = "AllImagesCached"
+	ImageCacheReasonImagesNotCached                = "ImagesNotCached"
+	ImageCacheReasonHelperImageUnavailable         = "HelperImageUnavailable"
 )
 
 // List of constants for ImageCacheMessage
@@ -123,14 +521,40 @@ const (
 	ImageCacheMessageRefreshingCache                = "Image cache is being refreshed. Please view the status after some time"
 	ImageCacheMessagePurgeCache                     = "Image cache is being purged. Please view the status after some time"
 	ImageCacheMessageDeletingImages                 = "Images in the cache are being deleted. Please view the status after some time"
+	ImageCacheMessagePurgeImage                     = "Image is being deleted from the nodes of the image cache. Please view the status after some time"
+	ImageCacheMessageImageNotInCacheSpec            = "The image to purge is not in the cacheSpec of the image cache"
+	ImageCacheMessageImageListInvalid               = "The image list of imageListFrom could not be read"
+	ImageCacheMessageWorkloadNotFound               = "The workload of workloadRef could not be read"
 	ImageCacheMessageImagesPulledSuccessfully       = "All requested images pulled succesfully to respective nodes"
 	ImageCacheMessageImagesDeletedSuccessfully      = "All cached images succesfully deleted from respective nodes"
+	ImageCacheMessageImagesPulledAfterRetries       = "All requested images pulled succesfully to respective nodes, some after retries"
+	ImageCacheMessageImagesDeletedAfterRetries      = "All cached images succesfully deleted from respective nodes, some after retries"
 	ImageCacheMessageImagePullFailedForSomeImages   = "Image pull failed for some images. Please see \"failures\" section"
+	ImageCacheMessageImagesPartiallyCached          = "Image pull failed for fewer node/image pairs than the partial failure threshold. Please see \"failures\" section"
 	ImageCacheMessageImageDeleteFailedForSomeImages = "Image deletion failed for some images. Please see \"failures\" section"
 	ImageCacheMessageImagePullFailedOnSomeNodes     = "Image pull failed on some nodes. Please see \"failures\" section"
 	ImageCacheMessageImagePullStatusUnknown         = "Unable to get the status of Image pull. Retry after some time or contact cluster administrator"
 	ImageCacheMessageImagePullAborted               = "Image cache processing aborted. Image cache will get refreshed during next refresh cycle"
 	ImageCacheMessageOldImageCacheNotFound          = "Unable to fetch the previous version of Image cache spec before update action."
+	ImageCacheMessageImagePullSecretNotFound        = "Image pull secrets not found in the namespace of the image cache"
 	ImageCacheMessageNotSupportedUpdates            = "The updates performed to image cache spec is not supported. Only addition or removal of images in a image list is supported."
 	ImageCacheMessageNoImagesPulledOrDeleted        = "No images were pulled or deleted because nodeSelector specified did not match any nodes"
+	ImageCacheMessageImageMissing                   = "Image is not present in the node and image pull policy is Never"
+	ImageCacheMessagePullJobQueued                  = "Image pull job was still queued behind other pull jobs on the node when the image pull deadline expired"
+	ImageCacheMessagePullTimedOut                   = "Image pull did not complete within the image pull deadline"
+	ImageCacheMessageImagePullRateLimited           = "Image pull was rate-limited by the registry for some images. Please see \"failures\" section"
+	ImageCacheMessageArchitectureMismatch           = "Image is not built for the architecture of the node, so it was not pulled"
+	ImageCacheMessageTaintNotTolerated              = "Image was not pulled as the node has a taint not tolerated by the image cache"
+	ImageCacheMessageNodeUnschedulable              = "Image was not pulled as the node is unschedulable"
+	ImageCacheMessageNodeExcluded                   = "Image was not pulled as the node is excluded by the image cache"
+	ImageCacheMessageDeferredDiskPressure           = "Image pull was deferred to the next refresh as the disk of the node is short of space"
+	ImageCacheMessageImageVerificationFailed        = "Image could not be inspected on the node after its pull"
+	ImageCacheMessageImageTagFailed                 = "Image could not be tagged with its aliases on the node after its pull"
+	ImageCacheMessageImageCachePaused               = "Image cache is paused: no image pull or delete job is created until it is resumed"
+	ImageCacheMessageImageInUse                     = "Image was not deleted as it is used by pods on the node"
+	ImageCacheMessageAbortedOnFailure               = "Image was not pulled as another image pull of the image cache failed and its failurePolicy is Abort"
+	ImageCacheMessageImagesMissingOnSomeNodes       = "Some images are missing on some nodes. Please see \"failures\" section"
+	ImageCacheMessageDryRun                         = "Dry run: no images were pulled or deleted. Please see \"nodes\" section for the images that would be pulled or deleted"
+	ImageCacheMessageImagesUnchanged                = "No images were pulled or deleted because no image of the cache was added or changed"
+	ImageCacheMessageHelperImageUnavailable         = "Images were not pulled as a helper image of the image pull jobs (busybox or cri client) could not be pulled. Please see \"failures\" section"
 )
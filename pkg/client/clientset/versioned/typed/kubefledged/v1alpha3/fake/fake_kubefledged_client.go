@@ -28,6 +28,10 @@ type FakeKubefledgedV1alpha3 struct {
 	*testing.Fake
 }
 
+func (c *FakeKubefledgedV1alpha3) ClusterImageCaches() v1alpha3.ClusterImageCacheInterface {
+	return &FakeClusterImageCaches{c}
+}
+
 func (c *FakeKubefledgedV1alpha3) ImageCaches(namespace string) v1alpha3.ImageCacheInterface {
 	return &FakeImageCaches{c, namespace}
 }
@@ -18,4 +18,6 @@ limitations under the License.
 
 package v1alpha3
 
+type ClusterImageCacheExpansion interface{}
+
 type ImageCacheExpansion interface{}
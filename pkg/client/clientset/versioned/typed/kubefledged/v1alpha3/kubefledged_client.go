@@ -28,6 +28,7 @@ import (
 
 type KubefledgedV1alpha3Interface interface {
 	RESTClient() rest.Interface
+	ClusterImageCachesGetter
 	ImageCachesGetter
 }
 
@@ -36,6 +37,10 @@ type KubefledgedV1alpha3Client struct {
 	restClient rest.Interface
 }
 
+func (c *KubefledgedV1alpha3Client) ClusterImageCaches() ClusterImageCacheInterface {
+	return newClusterImageCaches(c)
+}
+
 func (c *KubefledgedV1alpha3Client) ImageCaches(namespace string) ImageCacheInterface {
 	return newImageCaches(c, namespace)
 }
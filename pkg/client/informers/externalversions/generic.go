@@ -58,6 +58,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubefledged().V1alpha2().ImageCaches().Informer()}, nil
 
 		// Group=kubefledged.io, Version=v1alpha3
+	case v1alpha3.SchemeGroupVersion.WithResource("clusterimagecaches"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubefledged().V1alpha3().ClusterImageCaches().Informer()}, nil
 	case v1alpha3.SchemeGroupVersion.WithResource("imagecaches"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubefledged().V1alpha3().ImageCaches().Informer()}, nil
 
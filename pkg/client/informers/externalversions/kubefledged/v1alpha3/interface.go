@@ -24,6 +24,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ClusterImageCaches returns a ClusterImageCacheInformer.
+	ClusterImageCaches() ClusterImageCacheInformer
 	// ImageCaches returns a ImageCacheInformer.
 	ImageCaches() ImageCacheInformer
 }
@@ -39,6 +41,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ClusterImageCaches returns a ClusterImageCacheInformer.
+func (v *version) ClusterImageCaches() ClusterImageCacheInformer {
+	return &clusterImageCacheInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // ImageCaches returns a ImageCacheInformer.
 func (v *version) ImageCaches() ImageCacheInformer {
 	return &imageCacheInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
@@ -18,6 +18,10 @@ limitations under the License.
 
 package v1alpha3
 
+// ClusterImageCacheListerExpansion allows custom methods to be added to
+// ClusterImageCacheLister.
+type ClusterImageCacheListerExpansion interface{}
+
 // ImageCacheListerExpansion allows custom methods to be added to
 // ImageCacheLister.
 type ImageCacheListerExpansion interface{}
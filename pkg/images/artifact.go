@@ -0,0 +1,293 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/docker/distribution/reference"
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// DefaultOrasImage is the image of the oras client pulling OCI artifacts
+const DefaultOrasImage = "ghcr.io/oras-project/oras:v1.2.0"
+
+// DefaultArtifactCacheDir is the directory of the nodes to which OCI artifacts are pulled
+const DefaultArtifactCacheDir = "/var/lib/kubefledged/artifacts"
+
+// artifactPulledMarker is the file written in the directory of an artifact once completely pulled
+const artifactPulledMarker = ".kubefledged-pulled"
+
+// registryAuthMountPath is where the registry credentials of the pull secret are mounted in oras jobs
+const registryAuthMountPath = "/var/run/kubefledged/registry-auth"
+
+// storedByRuntime checks whether images of the artifact type are stored by the container runtime,
+// and hence listed in the status of the node
+func storedByRuntime(artifactType fledgedv1alpha3.ArtifactType) bool {
+	return artifactType != fledgedv1alpha3.ArtifactTypeArtifact
+}
+
+// artifactCacheDir returns the artifact cache directory of the nodes
+func artifactCacheDir(jobOptions JobOptions) string {
+	if jobOptions.ArtifactCacheDir != "" {
+		return jobOptions.ArtifactCacheDir
+	}
+	return DefaultArtifactCacheDir
+}
+
+// artifactDir returns the directory under cacheDir to which the artifact is pulled, laid out as
+// <registry>/<repository>/<tag> or <registry>/<repository>/<algorithm>-<hex> for digests
+// e.g. ghcr.io/org/charts/app/1.0.0
+func artifactDir(cacheDir, artifact string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(artifact)
+	if err != nil {
+		return "", err
+	}
+	version := "latest"
+	if digested, ok := named.(reference.Digested); ok {
+		version = digested.Digest().Algorithm().String() + "-" + digested.Digest().Encoded()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		version = tagged.Tag()
+	}
+	return path.Join(cacheDir, reference.Domain(named), reference.Path(named), version), nil
+}
+
+// newRuntimePullJob constructs a job manifest pulling an image that cannot be run (e.g. a WASM module)
+// into the container runtime of the node, using the client of the runtime talking to its socket
+func newRuntimePullJob(imagecache *fledgedv1alpha3.ImageCache, image string, imagePullSecrets []corev1.LocalObjectReference,
+	node *corev1.Node, containerRuntimeVersion string, dockerclientimage string, busyboxImage string, serviceAccountName string,
+	jobPriorityClassName string, criSocketPath string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if isWindowsNode(node) {
+		return nil, fmt.Errorf("images of artifact type %s are not pulled to Windows nodes", fledgedv1alpha3.ArtifactTypeWasm)
+	}
+	// jobs are labelled with the image of the cache, not the one pulled from its mirror
+	cachedImage := image
+	image = RewriteImageRef(image, jobOptions.RegistryMirrors)
+	if imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = imagecache.Spec.BusyboxImage
+	}
+	runtime := detectContainerRuntime(containerRuntimeVersion, jobOptions.ContainerRuntime)
+	socketPath := resolveCRISocketPath(node, runtime, containerRuntimeVersion, criSocketPath, jobOptions.KubernetesDistribution)
+
+	job := criClientJob(imagecache, node.Labels["kubernetes.io/hostname"], jobLabels(imagecache, cachedImage),
+		criClientImage(imagecache, runtime, dockerclientimage),
+		buildPullCommand(runtime, socketPath, image, imagecache.Spec.ContainerdNamespace, imagecache.Spec.Snapshotter), socketPath)
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImagePullJob(job, imagecache, cachedImage, imagePullSecrets, node, busyboxImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// newArtifactPullJob constructs a job manifest pulling an OCI artifact (e.g. a Helm chart) with oras
+// into its directory under the artifact cache directory of the node. Unless pullAlways is set, an
+// artifact already pulled is not pulled again. The registry credentials are read from the first of
+// the image pull secrets of the image cache and of the image, which must be of type kubernetes.io/dockerconfigjson.
+func newArtifactPullJob(imagecache *fledgedv1alpha3.ImageCache, artifact string, pullAlways bool,
+	imagePullSecrets []corev1.LocalObjectReference, node *corev1.Node, busyboxImage string, serviceAccountName string,
+	jobPriorityClassName string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if isWindowsNode(node) {
+		return nil, fmt.Errorf("images of artifact type %s are not pulled to Windows nodes", fledgedv1alpha3.ArtifactTypeArtifact)
+	}
+	// the artifact is stored under the reference of the cache, not the one pulled from its mirror
+	cacheDir := artifactCacheDir(jobOptions)
+	dir, err := artifactDir(cacheDir, artifact)
+	if err != nil {
+		klog.Errorf("Invalid artifact reference %s: %v", artifact, err)
+		return nil, fmt.Errorf("invalid artifact reference %s: %v", artifact, err)
+	}
+	if imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = imagecache.Spec.BusyboxImage
+	}
+	orasImage := jobOptions.OrasImage
+	if orasImage == "" {
+		orasImage = DefaultOrasImage
+	}
+
+	orasPull := "oras pull"
+	volumes := []corev1.Volume{}
+	volumeMounts := []corev1.VolumeMount{}
+	if secrets := MergeImagePullSecrets(imagecache.Spec.ImagePullSecrets, imagePullSecrets); len(secrets) > 0 {
+		orasPull += " --registry-config " + registryAuthMountPath + "/config.json"
+		volumes = append(volumes, corev1.Volume{
+			Name: "registry-auth",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secrets[0].Name,
+					Items:      []corev1.KeyToPath{{Key: corev1.DockerConfigJsonKey, Path: "config.json"}},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: "registry-auth", MountPath: registryAuthMountPath, ReadOnly: true})
+	}
+	// the artifact is pulled into a partial directory renamed once complete, so that an interrupted
+	// pull is never taken for a cached artifact
+	script := fmt.Sprintf("set -e; dir=%s; ", shellQuoteAll([]string{dir}))
+	if !pullAlways {
+		script += fmt.Sprintf("if [ -f \"$dir/%s\" ]; then exit 0; fi; ", artifactPulledMarker)
+	}
+	script += fmt.Sprintf("rm -rf \"$dir.partial\"; mkdir -p \"$dir.partial\"; %s -o \"$dir.partial\" %s; "+
+		"rm -rf \"$dir\"; mv \"$dir.partial\" \"$dir\"; touch \"$dir/%s\"",
+		orasPull, shellQuoteAll([]string{RewriteImageRef(artifact, jobOptions.RegistryMirrors)}), artifactPulledMarker)
+
+	hostpathtype := corev1.HostPathDirectoryOrCreate
+	volumes = append(volumes,
+		corev1.Volume{
+			Name: "artifact-cache",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: cacheDir, Type: &hostpathtype},
+			},
+		},
+		// the root filesystem is read-only, so oras gets a writable home directory
+		corev1.Volume{
+			Name:         "tmp",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	volumeMounts = append(volumeMounts,
+		corev1.VolumeMount{Name: "artifact-cache", MountPath: cacheDir},
+		corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"})
+
+	labels := jobLabels(imagecache, artifact)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: imagecache.Name + "-",
+			Namespace:    imagecache.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				ownerReference(imagecache),
+			},
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: imagecache.Namespace,
+					Labels:    labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"kubernetes.io/hostname": node.Labels["kubernetes.io/hostname"],
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "oras",
+							Image:           orasImage,
+							Command:         []string{"/bin/sh", "-c", script},
+							Env:             []corev1.EnvVar{{Name: "HOME", Value: "/tmp"}},
+							VolumeMounts:    volumeMounts,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+						},
+					},
+					Volumes:       volumes,
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+	// the artifact cache directory of the node is owned by root
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImagePullJob(job, imagecache, artifact, imagePullSecrets, node, busyboxImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// newArtifactDeleteJob constructs a job manifest removing the directory of an OCI artifact from
+// the artifact cache directory of the node
+func newArtifactDeleteJob(imagecache *fledgedv1alpha3.ImageCache, artifact string, node *corev1.Node,
+	busyboxImage string, serviceAccountName string, jobPriorityClassName string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if isWindowsNode(node) {
+		return nil, fmt.Errorf("images of artifact type %s are not deleted from Windows nodes", fledgedv1alpha3.ArtifactTypeArtifact)
+	}
+	cacheDir := artifactCacheDir(jobOptions)
+	dir, err := artifactDir(cacheDir, artifact)
+	if err != nil {
+		klog.Errorf("Invalid artifact reference %s: %v", artifact, err)
+		return nil, fmt.Errorf("invalid artifact reference %s: %v", artifact, err)
+	}
+	if imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = imagecache.Spec.BusyboxImage
+	}
+	hostpathtype := corev1.HostPathDirectoryOrCreate
+	labels := jobLabels(imagecache, artifact)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: imagecache.Name + "-",
+			Namespace:    imagecache.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				ownerReference(imagecache),
+			},
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: imagecache.Namespace,
+					Labels:    labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"kubernetes.io/hostname": node.Labels["kubernetes.io/hostname"],
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "busybox",
+							Image:   busyboxImage,
+							Command: []string{"rm", "-rf", dir, dir + ".partial"},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "artifact-cache",
+									MountPath: cacheDir,
+								},
+							},
+							ImagePullPolicy: corev1.PullIfNotPresent,
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "artifact-cache",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: cacheDir, Type: &hostpathtype},
+							},
+						},
+					},
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
+				},
+			},
+		},
+	}
+	// the artifact cache directory of the node is owned by root
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImageDeleteJob(job, imagecache, artifact, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
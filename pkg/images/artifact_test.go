@@ -0,0 +1,300 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/testing"
+)
+
+func TestArtifactDir(t *testing.T) {
+	tests := []struct {
+		name        string
+		artifact    string
+		expectedDir string
+		expectError bool
+	}{
+		{
+			name:        "#1: Tagged artifact",
+			artifact:    "ghcr.io/org/charts/app:1.0.0",
+			expectedDir: "/var/lib/kubefledged/artifacts/ghcr.io/org/charts/app/1.0.0",
+		},
+		{
+			name:        "#2: Untagged artifact of docker hub",
+			artifact:    "org/app",
+			expectedDir: "/var/lib/kubefledged/artifacts/docker.io/org/app/latest",
+		},
+		{
+			name:        "#3: Artifact pinned to a digest",
+			artifact:    "ghcr.io/org/app@sha256:" + strings.Repeat("a", 64),
+			expectedDir: "/var/lib/kubefledged/artifacts/ghcr.io/org/app/sha256-" + strings.Repeat("a", 64),
+		},
+		{
+			name:        "#4: Invalid reference",
+			artifact:    "ghcr.io/org/App:1.0.0",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		dir, err := artifactDir(DefaultArtifactCacheDir, test.artifact)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if dir != test.expectedDir {
+			t.Errorf("Test: %s failed: expectedDir=%s, actualDir=%s", test.name, test.expectedDir, dir)
+		}
+	}
+}
+
+func TestNewArtifactPullJob(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	windowsNode := node
+	windowsNode.Labels = map[string]string{"kubernetes.io/hostname": "bar", corev1.LabelOSStable: "windows"}
+	tests := []struct {
+		name               string
+		pullAlways         bool
+		imagePullSecrets   []corev1.LocalObjectReference
+		node               *corev1.Node
+		jobOptions         JobOptions
+		expectedImage      string
+		expectedInCommand  []string
+		expectedNoCommand  []string
+		expectedCacheDir   string
+		expectedAuthSecret string
+		expectError        bool
+	}{
+		{
+			name:          "#1: Artifact pulled unless already pulled",
+			node:          &node,
+			expectedImage: DefaultOrasImage,
+			expectedInCommand: []string{"dir='/var/lib/kubefledged/artifacts/ghcr.io/org/charts/app/1.0.0'",
+				"if [ -f \"$dir/.kubefledged-pulled\" ]; then exit 0; fi",
+				"oras pull -o \"$dir.partial\" 'ghcr.io/org/charts/app:1.0.0'"},
+			expectedNoCommand: []string{"--registry-config"},
+			expectedCacheDir:  DefaultArtifactCacheDir,
+		},
+		{
+			name:               "#2: Artifact always pulled with the credentials of the pull secret",
+			pullAlways:         true,
+			imagePullSecrets:   []corev1.LocalObjectReference{{Name: "ghcr-creds"}},
+			node:               &node,
+			jobOptions:         JobOptions{OrasImage: "oras:v1.1.0", ArtifactCacheDir: "/data/artifacts"},
+			expectedImage:      "oras:v1.1.0",
+			expectedInCommand:  []string{"oras pull --registry-config /var/run/kubefledged/registry-auth/config.json -o \"$dir.partial\""},
+			expectedNoCommand:  []string{".kubefledged-pulled\" ]"},
+			expectedCacheDir:   "/data/artifacts",
+			expectedAuthSecret: "ghcr-creds",
+		},
+		{
+			name:        "#3: Artifact not pulled to Windows nodes",
+			node:        &windowsNode,
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		job, err := newArtifactPullJob(imagecache, "ghcr.io/org/charts/app:1.0.0", test.pullAlways, test.imagePullSecrets,
+			test.node, "busybox:1.35.0", "", "", test.jobOptions)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		container := job.Spec.Template.Spec.Containers[0]
+		if container.Image != test.expectedImage {
+			t.Errorf("Test: %s failed: expectedImage=%s, actualImage=%s", test.name, test.expectedImage, container.Image)
+		}
+		command := strings.Join(container.Command, " ")
+		for _, expected := range test.expectedInCommand {
+			if !strings.Contains(command, expected) {
+				t.Errorf("Test: %s failed: expected %q in command, actualCommand=%s", test.name, expected, command)
+			}
+		}
+		for _, unexpected := range test.expectedNoCommand {
+			if strings.Contains(command, unexpected) {
+				t.Errorf("Test: %s failed: unexpected %q in command, actualCommand=%s", test.name, unexpected, command)
+			}
+		}
+		var cacheDir, authSecret string
+		for _, volume := range job.Spec.Template.Spec.Volumes {
+			if volume.Name == "artifact-cache" {
+				cacheDir = volume.HostPath.Path
+			}
+			if volume.Name == "registry-auth" {
+				authSecret = volume.Secret.SecretName
+			}
+		}
+		if cacheDir != test.expectedCacheDir {
+			t.Errorf("Test: %s failed: expectedCacheDir=%s, actualCacheDir=%s", test.name, test.expectedCacheDir, cacheDir)
+		}
+		if authSecret != test.expectedAuthSecret {
+			t.Errorf("Test: %s failed: expectedAuthSecret=%s, actualAuthSecret=%s", test.name, test.expectedAuthSecret, authSecret)
+		}
+		if job.Annotations[ImageAnnotationKey] != "ghcr.io/org/charts/app:1.0.0" {
+			t.Errorf("Test: %s failed: expectedImageAnnotation=ghcr.io/org/charts/app:1.0.0, actualImageAnnotation=%s", test.name, job.Annotations[ImageAnnotationKey])
+		}
+	}
+}
+
+func TestNewArtifactDeleteJob(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	job, err := newArtifactDeleteJob(imagecache, "ghcr.io/org/charts/app:1.0.0", &node, "busybox:1.35.0", "", "", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: #1: Artifact directory removed failed. expectedError=nil, actualError=%s", err.Error())
+	}
+	expectedCommand := "rm -rf /var/lib/kubefledged/artifacts/ghcr.io/org/charts/app/1.0.0 /var/lib/kubefledged/artifacts/ghcr.io/org/charts/app/1.0.0.partial"
+	if command := strings.Join(job.Spec.Template.Spec.Containers[0].Command, " "); command != expectedCommand {
+		t.Errorf("Test: #1: Artifact directory removed failed: expectedCommand=%s, actualCommand=%s", expectedCommand, command)
+	}
+}
+
+func TestProcessNextWorkItemArtifactType(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	testnode := node
+	testnode.Status.NodeInfo.ContainerRuntimeVersion = "containerd://1.6.8"
+	testnode.Status.Images = []corev1.ContainerImage{
+		{
+			Names: []string{"ghcr.io/org/wasm/filter:v1", "ghcr.io/org/charts/app:1.0.0"},
+		},
+	}
+	tests := []struct {
+		name              string
+		image             string
+		artifactType      fledgedv1alpha3.ArtifactType
+		imagePullPolicy   string
+		snapshotter       string
+		expectedContainer string
+		expectedInCommand string
+	}{
+		{
+			name:              "#1: Container image pulled by running it",
+			image:             "nginx:1.25",
+			expectedContainer: "imagepuller",
+			expectedInCommand: "/tmp/bin/echo",
+		},
+		{
+			name:              "#2: Wasm image pulled through the runtime socket",
+			image:             "ghcr.io/org/wasm/filter:v2",
+			artifactType:      fledgedv1alpha3.ArtifactTypeWasm,
+			expectedContainer: "docker-cri-client",
+			expectedInCommand: "crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock pull 'ghcr.io/org/wasm/filter:v2'",
+		},
+		{
+			name:         "#3: Wasm image present in node",
+			image:        "ghcr.io/org/wasm/filter:v1",
+			artifactType: fledgedv1alpha3.ArtifactTypeWasm,
+		},
+		{
+			name:              "#4: Artifact pulled with oras even if listed in node",
+			image:             "ghcr.io/org/charts/app:1.0.0",
+			artifactType:      fledgedv1alpha3.ArtifactTypeArtifact,
+			expectedContainer: "oras",
+			expectedInCommand: "oras pull -o \"$dir.partial\" 'ghcr.io/org/charts/app:1.0.0'",
+		},
+		{
+			name:              "#5: Artifact pulled with oras under image pull policy Never",
+			image:             "ghcr.io/org/charts/app:1.0.0",
+			artifactType:      fledgedv1alpha3.ArtifactTypeArtifact,
+			imagePullPolicy:   "Never",
+			expectedContainer: "oras",
+			expectedInCommand: "oras pull",
+		},
+		{
+			name:              "#6: Wasm image pulled into the snapshotter of the image cache",
+			image:             "ghcr.io/org/wasm/filter:v2",
+			artifactType:      fledgedv1alpha3.ArtifactTypeWasm,
+			snapshotter:       "stargz",
+			expectedContainer: "docker-cri-client",
+			expectedInCommand: "ctr --address=/run/containerd/containerd.sock -n k8s.io images pull --snapshotter='stargz' 'ghcr.io/org/wasm/filter:v2'",
+		},
+	}
+	for _, test := range tests {
+		imagePullPolicy := test.imagePullPolicy
+		if imagePullPolicy == "" {
+			imagePullPolicy = "IfNotPresent"
+		}
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, imagePullPolicy, "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imageCache := defaultImageCache.DeepCopy()
+		imageCache.Spec.Snapshotter = test.snapshotter
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   test.image,
+			Node:                    &testnode,
+			ContainerRuntimeVersion: testnode.Status.NodeInfo.ContainerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache:              imageCache,
+			ArtifactType:            test.artifactType,
+		})
+		imagemanager.processNextWorkItem()
+		var jobs []*batchv1.Job
+		for _, action := range fakekubeclientset.Actions() {
+			if action.Matches("create", "jobs") {
+				jobs = append(jobs, action.(core.CreateAction).GetObject().(*batchv1.Job))
+			}
+		}
+		if test.expectedContainer == "" {
+			if len(jobs) != 0 {
+				t.Errorf("Test: %s failed: expectedJobs=0, actualJobs=%d", test.name, len(jobs))
+			}
+			continue
+		}
+		if len(jobs) != 1 {
+			t.Errorf("Test: %s failed: expectedJobs=1, actualJobs=%d", test.name, len(jobs))
+			continue
+		}
+		container := jobs[0].Spec.Template.Spec.Containers[0]
+		if container.Name != test.expectedContainer {
+			t.Errorf("Test: %s failed: expectedContainer=%s, actualContainer=%s", test.name, test.expectedContainer, container.Name)
+		}
+		if command := strings.Join(container.Command, " "); !strings.Contains(command, test.expectedInCommand) {
+			t.Errorf("Test: %s failed: expected %q in command, actualCommand=%s", test.name, test.expectedInCommand, command)
+		}
+	}
+}
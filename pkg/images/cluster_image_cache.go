@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ImageCacheKey returns the key of an image cache in the workqueue: namespace/name for an ImageCache,
+// and name for a ClusterImageCache, as it is cluster-scoped
+func ImageCacheKey(imageCache *fledgedv1alpha3.ImageCache) (string, error) {
+	if fledgedv1alpha3.IsClusterImageCache(imageCache) {
+		return imageCache.Name, nil
+	}
+	return cache.MetaNamespaceKeyFunc(imageCache)
+}
+
+// imageCacheKey returns the key matching the requests of an image cache: namespace/name for an ImageCache,
+// name for a ClusterImageCache, so that an ImageCache and a ClusterImageCache of the same name are told apart
+func imageCacheKey(imagecache *fledgedv1alpha3.ImageCache) string {
+	key, _ := ImageCacheKey(imagecache)
+	return key
+}
+
+// ownerReference returns the reference of the jobs of an image cache to the ImageCache or ClusterImageCache
+func ownerReference(imagecache *fledgedv1alpha3.ImageCache) metav1.OwnerReference {
+	kind := "ImageCache"
+	if fledgedv1alpha3.IsClusterImageCache(imagecache) {
+		kind = fledgedv1alpha3.ClusterImageCacheKind
+	}
+	return *metav1.NewControllerRef(imagecache, fledgedv1alpha3.SchemeGroupVersion.WithKind(kind))
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterImageCacheJobs(t *testing.T) {
+	clusterImageCache := &fledgedv1alpha3.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: types.UID("cluster-uid")},
+	}
+	tests := []struct {
+		name              string
+		imagecache        *fledgedv1alpha3.ImageCache
+		deleteJob         bool
+		expectedNamespace string
+		expectedKind      string
+		expectedKey       string
+	}{
+		{
+			name:              "#1: Pull job of an image cache",
+			imagecache:        &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "team-a"}},
+			expectedNamespace: "team-a",
+			expectedKind:      "ImageCache",
+			expectedKey:       "team-a/foo",
+		},
+		{
+			name:              "#2: Pull job of a cluster image cache",
+			imagecache:        fledgedv1alpha3.ImageCacheFromCluster(clusterImageCache, "kube-fledged"),
+			expectedNamespace: "kube-fledged",
+			expectedKind:      fledgedv1alpha3.ClusterImageCacheKind,
+			expectedKey:       "foo",
+		},
+		{
+			name:              "#3: Delete job of a cluster image cache",
+			imagecache:        fledgedv1alpha3.ImageCacheFromCluster(clusterImageCache, "kube-fledged"),
+			deleteJob:         true,
+			expectedNamespace: "kube-fledged",
+			expectedKind:      fledgedv1alpha3.ClusterImageCacheKind,
+			expectedKey:       "foo",
+		},
+	}
+	for _, test := range tests {
+		var job *batchv1.Job
+		var err error
+		if test.deleteJob {
+			job, err = newImageDeleteJob(test.imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", JobOptions{})
+		} else {
+			job, err = newImagePullJob(test.imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", JobOptions{})
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if job.Namespace != test.expectedNamespace {
+			t.Errorf("Test: %s failed: expectedNamespace=%s, actualNamespace=%s", test.name, test.expectedNamespace, job.Namespace)
+		}
+		owner := job.OwnerReferences[0]
+		if owner.Kind != test.expectedKind || owner.Name != "foo" || owner.UID != test.imagecache.UID {
+			t.Errorf("Test: %s failed: expectedKind=%s, actualOwnerReference=%+v", test.name, test.expectedKind, owner)
+		}
+		if key, _ := ImageCacheKey(test.imagecache); key != test.expectedKey {
+			t.Errorf("Test: %s failed: expectedKey=%s, actualKey=%s", test.name, test.expectedKey, key)
+		}
+	}
+
+	// the cluster image cache is written back without the namespace of its jobs
+	converted := fledgedv1alpha3.ClusterImageCacheFromImageCache(fledgedv1alpha3.ImageCacheFromCluster(clusterImageCache, "kube-fledged"))
+	if converted.Namespace != "" || converted.Name != "foo" || converted.UID != clusterImageCache.UID {
+		t.Errorf("Test: Convert back cluster image cache failed: expectedNamespace=, actualObjectMeta=%+v", converted.ObjectMeta)
+	}
+}
+
+func TestClusterImageCacheAndImageCacheOfSameName(t *testing.T) {
+	cluster := fledgedv1alpha3.ImageCacheFromCluster(&fledgedv1alpha3.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: types.UID("cluster-uid")},
+	}, fledgedNameSpace)
+	namespaced := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"}}
+	imagemanager, _ := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.imageworkstatus["cluster-1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: cluster},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: namespaced},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	clusterChanged := imagemanager.watchJobs(imageCacheKey(cluster))
+	namespacedChanged := imagemanager.watchJobs(imageCacheKey(namespaced))
+	defer imagemanager.unwatchJobs(clusterChanged)
+	defer imagemanager.unwatchJobs(namespacedChanged)
+
+	imagemanager.jobEventHandler().AddFunc(finishedJob(cluster, "cluster-1", batchv1.JobComplete, "", ""))
+	if len(clusterChanged) != 1 || len(namespacedChanged) != 0 {
+		t.Errorf("Test: Job of the cluster image cache finished failed: expectedNotified=cluster, actualNotifiedCluster=%d, actualNotifiedImageCache=%d",
+			len(clusterChanged), len(namespacedChanged))
+	}
+	if !imagemanager.jobsDone(imageCacheKey(cluster)) || imagemanager.jobsDone(imageCacheKey(namespaced)) {
+		t.Errorf("Test: Job of the cluster image cache finished failed: expectedJobsDone=cluster, actualJobsDoneCluster=%t, actualJobsDoneImageCache=%t",
+			imagemanager.jobsDone(imageCacheKey(cluster)), imagemanager.jobsDone(imageCacheKey(namespaced)))
+	}
+
+	errCh := make(chan error, 1)
+	imagemanager.updateImageCacheStatus(cluster, errCh)
+	if err := <-errCh; err != nil {
+		t.Fatalf("Test: Status of the cluster image cache failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	item, _ := imagemanager.workqueue.Get()
+	wqKey := item.(WorkQueueKey)
+	if _, ok := (*wqKey.Status)["cluster-1"]; wqKey.ObjKey != "foo" || len(*wqKey.Status) != 1 || !ok {
+		t.Errorf("Test: Status of the cluster image cache failed: expectedObjKey=foo, expectedResults=cluster-1, actualObjKey=%s, actualResults=%+v",
+			wqKey.ObjKey, *wqKey.Status)
+	}
+	// the job of the image cache of the same name is left running
+	if iwres, ok := imagemanager.imageworkstatus["foo-1"]; !ok || iwres.Status != ImageWorkResultStatusJobCreated {
+		t.Errorf("Test: Status of the cluster image cache failed: expectedImageCacheStatus=%s, actualImageCacheResult=%+v",
+			ImageWorkResultStatusJobCreated, iwres)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CRISocketPathAnnotationKey is the node annotation that sets the cri socket path of that node
+const CRISocketPathAnnotationKey = "kubefledged.io/cri-socket-path"
+
+// containerRuntime is the container runtime of a node
+type containerRuntime string
+
+const (
+	runtimeDocker     containerRuntime = "docker"
+	runtimeContainerd containerRuntime = "containerd"
+	runtimeCRIO       containerRuntime = "crio"
+	runtimeNerdctl    containerRuntime = "nerdctl"
+	runtimePodman     containerRuntime = "podman"
+)
+
+const (
+	dockerSocketPath             = "/var/run/docker.sock"
+	containerdSocketPath         = "/run/containerd/containerd.sock"
+	k3sContainerdSocketPath      = "/run/k3s/containerd/containerd.sock"
+	microk8sContainerdSocketPath = "/var/snap/microk8s/common/run/containerd.sock"
+	crioSocketPath               = "/var/run/crio/crio.sock"
+	podmanSocketPath             = "/run/podman/podman.sock"
+	k3sInstanceTypeLabelValue    = "k3s"
+	microk8sClusterLabelKey      = "microk8s.io/cluster"
+)
+
+// ParseContainerRuntime validates the name of a container runtime set to override detection.
+// An empty name means the runtime is detected from the node.
+func ParseContainerRuntime(name string) (string, error) {
+	switch runtime := containerRuntime(strings.ToLower(strings.TrimSpace(name))); runtime {
+	case "", runtimeDocker, runtimeContainerd, runtimeCRIO, runtimeNerdctl, runtimePodman:
+		return string(runtime), nil
+	}
+	return "", fmt.Errorf("unsupported container runtime %q: supported values are %q, %q, %q, %q and %q",
+		name, runtimeDocker, runtimeContainerd, runtimeCRIO, runtimeNerdctl, runtimePodman)
+}
+
+// detectContainerRuntime returns the container runtime from the node's containerRuntimeVersion
+// e.g. containerd://1.6.8, cri-o://1.25.1, docker://20.10.17. Unknown runtimes default to docker.
+// A non-empty runtimeOverride is used as is.
+func detectContainerRuntime(containerRuntimeVersion string, runtimeOverride string) containerRuntime {
+	if runtimeOverride != "" {
+		return containerRuntime(runtimeOverride)
+	}
+	switch {
+	case strings.Contains(containerRuntimeVersion, "podman"):
+		return runtimePodman
+	case strings.Contains(containerRuntimeVersion, "containerd"):
+		return runtimeContainerd
+	case strings.Contains(containerRuntimeVersion, "crio"), strings.Contains(containerRuntimeVersion, "cri-o"):
+		return runtimeCRIO
+	default:
+		return runtimeDocker
+	}
+}
+
+// resolveCRISocketPath returns the path of the cri socket on the node. In order of precedence:
+// the node's CRISocketPathAnnotationKey annotation, the controller-wide criSocketPath, the socket
+// path of the kubernetes distribution (k3s/rke2, microk8s), set by distributionOverride or detected
+// from the node, and finally the default socket path of the runtime.
+func resolveCRISocketPath(node *corev1.Node, runtime containerRuntime, containerRuntimeVersion string, criSocketPath string,
+	distributionOverride string) string {
+	if socketPath := node.Annotations[CRISocketPathAnnotationKey]; socketPath != "" {
+		return socketPath
+	}
+	if criSocketPath != "" {
+		return criSocketPath
+	}
+	switch runtime {
+	case runtimeContainerd, runtimeNerdctl:
+		switch detectKubernetesDistribution(node, containerRuntimeVersion, distributionOverride) {
+		case distributionK3s:
+			return k3sContainerdSocketPath
+		case distributionMicrok8s:
+			return microk8sContainerdSocketPath
+		}
+		return containerdSocketPath
+	case runtimeCRIO:
+		return crioSocketPath
+	case runtimePodman:
+		return podmanSocketPath
+	default:
+		return dockerSocketPath
+	}
+}
+
+// buildDeleteCommand returns the command of the image delete job container that removes the image using the
+// client of the container runtime talking to the socket. On containerd nodes, a non-empty containerdNamespace
+// deletes the image from that namespace using ctr (or nerdctl) instead of going through the CRI.
+func buildDeleteCommand(runtime containerRuntime, socketPath, image, containerdNamespace string) []string {
+	var deleteCommand string
+	switch {
+	case runtime == runtimeContainerd && containerdNamespace != "":
+		// ctr does not normalize image references
+		if normalizedImage, err := normalizeImageRef(image); err == nil {
+			image = normalizedImage
+		}
+		deleteCommand = "/usr/bin/ctr --address=" + socketPath + " -n " + shellQuoteAll([]string{containerdNamespace}) + " images rm "
+	case runtime == runtimeNerdctl && containerdNamespace != "":
+		deleteCommand = "/usr/bin/nerdctl --address=" + socketPath + " -n " + shellQuoteAll([]string{containerdNamespace}) + " rmi -f "
+	case runtime == runtimeContainerd, runtime == runtimeCRIO:
+		deleteCommand = "/usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " rmi "
+	case runtime == runtimeNerdctl:
+		deleteCommand = "/usr/bin/nerdctl --address=" + socketPath + " -n k8s.io rmi -f "
+	case runtime == runtimePodman:
+		deleteCommand = "/usr/bin/podman --remote --url=unix://" + socketPath + " rmi -f "
+	default:
+		deleteCommand = "/usr/bin/docker --host=unix://" + socketPath + " image rm -f "
+	}
+	return []string{"/bin/bash", "-c", "exec " + deleteCommand + shellQuoteAll([]string{image}) + " > /dev/termination-log 2>&1"}
+}
+
+// buildPullCommand returns the command of the image pull job container that pulls the image into the container
+// runtime using its client talking to the socket, without running the image. It is used for images that cannot
+// be run (e.g. WASM modules). containerdNamespace is handled as in buildDeleteCommand. On containerd nodes, a
+// non-empty snapshotter unpacks the image into that snapshotter, using ctr (in namespace k8s.io unless
+// containerdNamespace is set) as crictl cannot select a snapshotter. Other runtimes have no snapshotter.
+func buildPullCommand(runtime containerRuntime, socketPath, image, containerdNamespace, snapshotter string) []string {
+	var pullCommand string
+	namespace := "k8s.io"
+	if containerdNamespace != "" {
+		namespace = shellQuoteAll([]string{containerdNamespace})
+	}
+	snapshotterFlag := ""
+	if snapshotter != "" {
+		snapshotterFlag = "--snapshotter=" + shellQuoteAll([]string{snapshotter}) + " "
+	}
+	switch {
+	case runtime == runtimeContainerd && (containerdNamespace != "" || snapshotter != ""):
+		// ctr does not normalize image references
+		if normalizedImage, err := normalizeImageRef(image); err == nil {
+			image = normalizedImage
+		}
+		pullCommand = "/usr/bin/ctr --address=" + socketPath + " -n " + namespace + " images pull " + snapshotterFlag
+	case runtime == runtimeNerdctl:
+		pullCommand = "/usr/bin/nerdctl --address=" + socketPath + " -n " + namespace + " " + snapshotterFlag + "pull "
+	case runtime == runtimeContainerd, runtime == runtimeCRIO:
+		pullCommand = "/usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " pull "
+	case runtime == runtimePodman:
+		pullCommand = "/usr/bin/podman --remote --url=unix://" + socketPath + " pull "
+	default:
+		pullCommand = "/usr/bin/docker --host=unix://" + socketPath + " image pull "
+	}
+	return []string{"/bin/bash", "-c", "exec " + pullCommand + shellQuoteAll([]string{image}) + " > /dev/termination-log 2>&1"}
+}
+
+// buildVerifyCommand returns the command of the image verify job container that inspects the image using the
+// client of the container runtime talking to the socket, failing if the image is not present in the runtime.
+// containerdNamespace is handled as in buildDeleteCommand.
+func buildVerifyCommand(runtime containerRuntime, socketPath, image, containerdNamespace string) []string {
+	var verifyCommand string
+	switch {
+	case runtime == runtimeContainerd && containerdNamespace != "":
+		// ctr does not normalize image references, and reports the content of an image missing
+		// from the namespace as incomplete rather than failing
+		if normalizedImage, err := normalizeImageRef(image); err == nil {
+			image = normalizedImage
+		}
+		return []string{"/bin/bash", "-c", "/usr/bin/ctr --address=" + socketPath + " -n " + shellQuoteAll([]string{containerdNamespace}) +
+			" images check " + shellQuoteAll([]string{"name==" + image}) + " > /dev/termination-log 2>&1 && grep -qw complete /dev/termination-log"}
+	case runtime == runtimeNerdctl && containerdNamespace != "":
+		verifyCommand = "/usr/bin/nerdctl --address=" + socketPath + " -n " + shellQuoteAll([]string{containerdNamespace}) + " image inspect "
+	case runtime == runtimeContainerd, runtime == runtimeCRIO:
+		verifyCommand = "/usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " inspecti "
+	case runtime == runtimeNerdctl:
+		verifyCommand = "/usr/bin/nerdctl --address=" + socketPath + " -n k8s.io image inspect "
+	case runtime == runtimePodman:
+		verifyCommand = "/usr/bin/podman --remote --url=unix://" + socketPath + " image inspect "
+	default:
+		verifyCommand = "/usr/bin/docker --host=unix://" + socketPath + " image inspect "
+	}
+	return []string{"/bin/bash", "-c", "exec " + verifyCommand + shellQuoteAll([]string{image}) + " > /dev/termination-log 2>&1"}
+}
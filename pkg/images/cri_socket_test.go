@@ -0,0 +1,534 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveCRISocketPath(t *testing.T) {
+	tests := []struct {
+		name                    string
+		labels                  map[string]string
+		annotations             map[string]string
+		containerRuntimeVersion string
+		criSocketPath           string
+		distributionOverride    string
+		expectedSocketPath      string
+	}{
+		{
+			name:                    "#1: Standard containerd",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/run/containerd/containerd.sock",
+		},
+		{
+			name:                    "#2: k3s containerd detected from runtime version",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+		},
+		{
+			name:                    "#3: k3s containerd detected from instance type label",
+			labels:                  map[string]string{"node.kubernetes.io/instance-type": "k3s"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+		},
+		{
+			name:                    "#4: microk8s containerd",
+			labels:                  map[string]string{"microk8s.io/cluster": "true"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/var/snap/microk8s/common/run/containerd.sock",
+		},
+		{
+			name:                    "#5: cri-o",
+			containerRuntimeVersion: "cri-o://1.25.1",
+			expectedSocketPath:      "/var/run/crio/crio.sock",
+		},
+		{
+			name:                    "#6: docker",
+			containerRuntimeVersion: "docker://20.10.17",
+			expectedSocketPath:      "/var/run/docker.sock",
+		},
+		{
+			name:                    "#7: Controller-wide socket path overrides detection",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			criSocketPath:           "/custom/containerd.sock",
+			expectedSocketPath:      "/custom/containerd.sock",
+		},
+		{
+			name:                    "#8: Node annotation overrides controller-wide socket path",
+			annotations:             map[string]string{CRISocketPathAnnotationKey: "/node/containerd.sock"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			criSocketPath:           "/custom/containerd.sock",
+			expectedSocketPath:      "/node/containerd.sock",
+		},
+		{
+			name:                    "#9: k3s containerd set by the distribution override",
+			containerRuntimeVersion: "containerd://1.6.8",
+			distributionOverride:    "k3s",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+		},
+		{
+			name:                    "#10: Distribution override is ignored on cri-o",
+			containerRuntimeVersion: "cri-o://1.25.1",
+			distributionOverride:    "k3s",
+			expectedSocketPath:      "/var/run/crio/crio.sock",
+		},
+		{
+			name:                    "#11: Controller-wide socket path overrides the distribution override",
+			containerRuntimeVersion: "containerd://1.6.8",
+			criSocketPath:           "/custom/containerd.sock",
+			distributionOverride:    "k3s",
+			expectedSocketPath:      "/custom/containerd.sock",
+		},
+	}
+	for _, test := range tests {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "fakenode",
+				Labels:      test.labels,
+				Annotations: test.annotations,
+			},
+		}
+		runtime := detectContainerRuntime(test.containerRuntimeVersion, "")
+		socketPath := resolveCRISocketPath(node, runtime, test.containerRuntimeVersion, test.criSocketPath, test.distributionOverride)
+		if socketPath != test.expectedSocketPath {
+			t.Errorf("Test: %s failed: expectedSocketPath=%s, actualSocketPath=%s", test.name, test.expectedSocketPath, socketPath)
+		}
+	}
+}
+
+func TestNewImageDeleteJobSocketPath(t *testing.T) {
+	tests := []struct {
+		name                    string
+		labels                  map[string]string
+		containerdNamespace     string
+		containerRuntimeVersion string
+		distributionOverride    string
+		expectedSocketPath      string
+		expectedCommandPrefix   string
+	}{
+		{
+			name:                    "#1: Standard containerd",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/run/containerd/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock",
+		},
+		{
+			name:                    "#2: k3s containerd",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/crictl --runtime-endpoint=unix:///run/k3s/containerd/containerd.sock",
+		},
+		{
+			name:                    "#3: microk8s containerd",
+			labels:                  map[string]string{"kubernetes.io/hostname": "fakenode", "microk8s.io/cluster": "true"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/var/snap/microk8s/common/run/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/crictl --runtime-endpoint=unix:///var/snap/microk8s/common/run/containerd.sock",
+		},
+		{
+			name:                    "#4: docker",
+			containerRuntimeVersion: "docker://20.10.17",
+			expectedSocketPath:      "/var/run/docker.sock",
+			expectedCommandPrefix:   "exec /usr/bin/docker --host=unix:///var/run/docker.sock image rm -f 'nginx:1.25'",
+		},
+		{
+			name:                    "#5: k3s containerd with namespace",
+			containerdNamespace:     "buildkit",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/ctr --address=/run/k3s/containerd/containerd.sock -n 'buildkit' images rm",
+		},
+		{
+			name:                    "#6: k3s containerd detected from instance type label",
+			labels:                  map[string]string{"node.kubernetes.io/instance-type": "k3s"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/crictl --runtime-endpoint=unix:///run/k3s/containerd/containerd.sock --image-endpoint=unix:///run/k3s/containerd/containerd.sock rmi 'nginx:1.25'",
+		},
+		{
+			name:                    "#7: k3s containerd set by the distribution override",
+			containerRuntimeVersion: "containerd://1.6.8",
+			distributionOverride:    "k3s",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommandPrefix:   "exec /usr/bin/crictl --runtime-endpoint=unix:///run/k3s/containerd/containerd.sock --image-endpoint=unix:///run/k3s/containerd/containerd.sock rmi 'nginx:1.25'",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ContainerdNamespace: test.containerdNamespace,
+			},
+		}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "fakenode",
+				Labels: test.labels,
+			},
+		}
+		job, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, node, test.containerRuntimeVersion, "cri-client:latest",
+			"", "", "", JobOptions{KubernetesDistribution: test.distributionOverride})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if podSpec.Volumes[0].HostPath.Path != test.expectedSocketPath || podSpec.Containers[0].VolumeMounts[0].MountPath != test.expectedSocketPath {
+			t.Errorf("Test: %s failed: expectedSocketPath=%s, actualHostPath=%s, actualMountPath=%s", test.name,
+				test.expectedSocketPath, podSpec.Volumes[0].HostPath.Path, podSpec.Containers[0].VolumeMounts[0].MountPath)
+		}
+		if command := podSpec.Containers[0].Command[2]; !strings.HasPrefix(command, test.expectedCommandPrefix) {
+			t.Errorf("Test: %s failed: expectedCommandPrefix=%s, actualCommand=%s", test.name, test.expectedCommandPrefix, command)
+		}
+	}
+}
+
+func TestNewRuntimePullJobSocketPath(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		distributionOverride    string
+		expectedSocketPath      string
+		expectedCommand         string
+	}{
+		{
+			name:                    "#1: Standard containerd",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedSocketPath:      "/run/containerd/containerd.sock",
+			expectedCommand:         "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock pull 'ghcr.io/org/module:v1' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#2: k3s containerd",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommand:         "exec /usr/bin/crictl --runtime-endpoint=unix:///run/k3s/containerd/containerd.sock --image-endpoint=unix:///run/k3s/containerd/containerd.sock pull 'ghcr.io/org/module:v1' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#3: k3s containerd set by the distribution override",
+			containerRuntimeVersion: "containerd://1.6.8",
+			distributionOverride:    "k3s",
+			expectedSocketPath:      "/run/k3s/containerd/containerd.sock",
+			expectedCommand:         "exec /usr/bin/crictl --runtime-endpoint=unix:///run/k3s/containerd/containerd.sock --image-endpoint=unix:///run/k3s/containerd/containerd.sock pull 'ghcr.io/org/module:v1' > /dev/termination-log 2>&1",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+		}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "fakenode",
+				Labels: map[string]string{"kubernetes.io/hostname": "fakenode"},
+			},
+		}
+		job, err := newRuntimePullJob(imagecache, "ghcr.io/org/module:v1", nil, node, test.containerRuntimeVersion,
+			"cri-client:latest", "busybox:1.35.0", "", "", "", JobOptions{KubernetesDistribution: test.distributionOverride})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if podSpec.Volumes[0].HostPath.Path != test.expectedSocketPath || podSpec.Containers[0].VolumeMounts[0].MountPath != test.expectedSocketPath {
+			t.Errorf("Test: %s failed: expectedSocketPath=%s, actualHostPath=%s, actualMountPath=%s", test.name,
+				test.expectedSocketPath, podSpec.Volumes[0].HostPath.Path, podSpec.Containers[0].VolumeMounts[0].MountPath)
+		}
+		if command := podSpec.Containers[0].Command[2]; command != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%s", test.name, test.expectedCommand, command)
+		}
+	}
+}
+
+func TestNewImageDeleteJobCriClientImage(t *testing.T) {
+	tests := []struct {
+		name                    string
+		criClientImage          string
+		criClientImages         map[string]string
+		containerRuntimeVersion string
+		expectedImage           string
+	}{
+		{
+			name:                    "#1: Controller-wide cri client image",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedImage:           "cri-client:latest",
+		},
+		{
+			name:                    "#2: Cri client image of the image cache",
+			criClientImage:          "registry.internal/mirror/cri-client:v0.10.0",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedImage:           "registry.internal/mirror/cri-client:v0.10.0",
+		},
+		{
+			name:                    "#3: Cri client image of the container runtime takes precedence",
+			criClientImage:          "registry.internal/mirror/cri-client:v0.10.0",
+			criClientImages:         map[string]string{"crio": "registry.internal/mirror/crictl:v1.25.0"},
+			containerRuntimeVersion: "cri-o://1.25.1",
+			expectedImage:           "registry.internal/mirror/crictl:v1.25.0",
+		},
+		{
+			name:                    "#4: Cri client image of another container runtime is ignored",
+			criClientImages:         map[string]string{"crio": "registry.internal/mirror/crictl:v1.25.0"},
+			containerRuntimeVersion: "docker://20.10.17",
+			expectedImage:           "cri-client:latest",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				CriClientImage:  test.criClientImage,
+				CriClientImages: test.criClientImages,
+			},
+		}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "fakenode"},
+		}
+		job, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, node, test.containerRuntimeVersion, "cri-client:latest",
+			"", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if image := job.Spec.Template.Spec.Containers[0].Image; image != test.expectedImage {
+			t.Errorf("Test: %s failed: expectedImage=%s, actualImage=%s", test.name, test.expectedImage, image)
+		}
+	}
+}
+
+func TestBuildDeleteCommand(t *testing.T) {
+	tests := []struct {
+		name                string
+		runtime             containerRuntime
+		socketPath          string
+		containerdNamespace string
+		expectedCommand     string
+	}{
+		{
+			name:            "#1: docker",
+			runtime:         runtimeDocker,
+			socketPath:      "/var/run/docker.sock",
+			expectedCommand: "exec /usr/bin/docker --host=unix:///var/run/docker.sock image rm -f 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#2: containerd",
+			runtime:         runtimeContainerd,
+			socketPath:      "/run/containerd/containerd.sock",
+			expectedCommand: "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock rmi 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#3: cri-o",
+			runtime:         runtimeCRIO,
+			socketPath:      "/var/run/crio/crio.sock",
+			expectedCommand: "exec /usr/bin/crictl --runtime-endpoint=unix:///var/run/crio/crio.sock --image-endpoint=unix:///var/run/crio/crio.sock rmi 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#4: nerdctl",
+			runtime:         runtimeNerdctl,
+			socketPath:      "/run/containerd/containerd.sock",
+			expectedCommand: "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n k8s.io rmi -f 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#5: podman",
+			runtime:         runtimePodman,
+			socketPath:      "/run/podman/podman.sock",
+			expectedCommand: "exec /usr/bin/podman --remote --url=unix:///run/podman/podman.sock rmi -f 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#6: containerd with namespace",
+			runtime:             runtimeContainerd,
+			socketPath:          "/run/containerd/containerd.sock",
+			containerdNamespace: "buildkit",
+			expectedCommand:     "exec /usr/bin/ctr --address=/run/containerd/containerd.sock -n 'buildkit' images rm 'docker.io/library/nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#7: nerdctl with namespace",
+			runtime:             runtimeNerdctl,
+			socketPath:          "/run/containerd/containerd.sock",
+			containerdNamespace: "buildkit",
+			expectedCommand:     "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n 'buildkit' rmi -f 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#8: Namespace is ignored on cri-o",
+			runtime:             runtimeCRIO,
+			socketPath:          "/var/run/crio/crio.sock",
+			containerdNamespace: "buildkit",
+			expectedCommand:     "exec /usr/bin/crictl --runtime-endpoint=unix:///var/run/crio/crio.sock --image-endpoint=unix:///var/run/crio/crio.sock rmi 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+	}
+	for _, test := range tests {
+		command := buildDeleteCommand(test.runtime, test.socketPath, "nginx:1.25", test.containerdNamespace)
+		if len(command) != 3 || command[0] != "/bin/bash" || command[1] != "-c" || command[2] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%v", test.name, test.expectedCommand, command)
+		}
+	}
+}
+
+func TestDetectContainerRuntime(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		runtimeOverride         string
+		expectedRuntime         containerRuntime
+	}{
+		{
+			name:                    "#1: docker",
+			containerRuntimeVersion: "docker://20.10.17",
+			expectedRuntime:         runtimeDocker,
+		},
+		{
+			name:                    "#2: containerd",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedRuntime:         runtimeContainerd,
+		},
+		{
+			name:                    "#3: cri-o",
+			containerRuntimeVersion: "cri-o://1.25.1",
+			expectedRuntime:         runtimeCRIO,
+		},
+		{
+			name:                    "#4: podman",
+			containerRuntimeVersion: "podman://4.3.1",
+			expectedRuntime:         runtimePodman,
+		},
+		{
+			name:                    "#5: Override selects nerdctl on a containerd node",
+			containerRuntimeVersion: "containerd://1.6.8",
+			runtimeOverride:         "nerdctl",
+			expectedRuntime:         runtimeNerdctl,
+		},
+	}
+	for _, test := range tests {
+		runtime := detectContainerRuntime(test.containerRuntimeVersion, test.runtimeOverride)
+		if runtime != test.expectedRuntime {
+			t.Errorf("Test: %s failed: expectedRuntime=%s, actualRuntime=%s", test.name, test.expectedRuntime, runtime)
+		}
+	}
+}
+
+func TestBuildVerifyCommand(t *testing.T) {
+	tests := []struct {
+		name                string
+		runtime             containerRuntime
+		socketPath          string
+		containerdNamespace string
+		expectedCommand     string
+	}{
+		{
+			name:            "#1: docker",
+			runtime:         runtimeDocker,
+			socketPath:      "/var/run/docker.sock",
+			expectedCommand: "exec /usr/bin/docker --host=unix:///var/run/docker.sock image inspect 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#2: containerd",
+			runtime:         runtimeContainerd,
+			socketPath:      "/run/containerd/containerd.sock",
+			expectedCommand: "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock inspecti 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#3: nerdctl",
+			runtime:         runtimeNerdctl,
+			socketPath:      "/run/containerd/containerd.sock",
+			expectedCommand: "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n k8s.io image inspect 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#4: podman",
+			runtime:         runtimePodman,
+			socketPath:      "/run/podman/podman.sock",
+			expectedCommand: "exec /usr/bin/podman --remote --url=unix:///run/podman/podman.sock image inspect 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#5: containerd with namespace",
+			runtime:             runtimeContainerd,
+			socketPath:          "/run/containerd/containerd.sock",
+			containerdNamespace: "buildkit",
+			expectedCommand:     "/usr/bin/ctr --address=/run/containerd/containerd.sock -n 'buildkit' images check 'name==docker.io/library/nginx:1.25' > /dev/termination-log 2>&1 && grep -qw complete /dev/termination-log",
+		},
+	}
+	for _, test := range tests {
+		command := buildVerifyCommand(test.runtime, test.socketPath, "nginx:1.25", test.containerdNamespace)
+		if len(command) != 3 || command[0] != "/bin/bash" || command[1] != "-c" || command[2] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%v", test.name, test.expectedCommand, command)
+		}
+	}
+}
+
+func TestBuildPullCommand(t *testing.T) {
+	tests := []struct {
+		name                string
+		runtime             containerRuntime
+		containerdNamespace string
+		snapshotter         string
+		expectedCommand     string
+	}{
+		{
+			name:            "#1: containerd",
+			runtime:         runtimeContainerd,
+			expectedCommand: "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock pull 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#2: containerd with snapshotter",
+			runtime:         runtimeContainerd,
+			snapshotter:     "stargz",
+			expectedCommand: "exec /usr/bin/ctr --address=/run/containerd/containerd.sock -n k8s.io images pull --snapshotter='stargz' 'docker.io/library/nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#3: containerd with namespace and snapshotter",
+			runtime:             runtimeContainerd,
+			containerdNamespace: "buildkit",
+			snapshotter:         "soci",
+			expectedCommand:     "exec /usr/bin/ctr --address=/run/containerd/containerd.sock -n 'buildkit' images pull --snapshotter='soci' 'docker.io/library/nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#4: nerdctl",
+			runtime:         runtimeNerdctl,
+			expectedCommand: "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n k8s.io pull 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#5: nerdctl with snapshotter",
+			runtime:         runtimeNerdctl,
+			snapshotter:     "stargz",
+			expectedCommand: "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n k8s.io --snapshotter='stargz' pull 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#6: Snapshotter ignored by cri-o",
+			runtime:         runtimeCRIO,
+			snapshotter:     "stargz",
+			expectedCommand: "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock --image-endpoint=unix:///run/containerd/containerd.sock pull 'nginx:1.25' > /dev/termination-log 2>&1",
+		},
+	}
+	for _, test := range tests {
+		command := buildPullCommand(test.runtime, "/run/containerd/containerd.sock", "nginx:1.25", test.containerdNamespace, test.snapshotter)
+		if len(command) != 3 || command[0] != "/bin/bash" || command[1] != "-c" || command[2] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%v", test.name, test.expectedCommand, command)
+		}
+	}
+}
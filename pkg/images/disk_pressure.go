@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeDiskPressure checks whether images are to be pulled to the node no more for lack of disk space:
+// the node reports the DiskPressure condition, or the images listed in its status use at least
+// maxUsagePercent of its ephemeral storage capacity. The kubelet lists only the largest images of the
+// node (--node-status-max-images), so the usage may be underestimated. Zero disables the check.
+func nodeDiskPressure(node *corev1.Node, maxUsagePercent int) (string, bool) {
+	if maxUsagePercent <= 0 {
+		return "", false
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeDiskPressure && c.Status == corev1.ConditionTrue {
+			return "node reports DiskPressure", true
+		}
+	}
+	capacity, ok := node.Status.Capacity[corev1.ResourceEphemeralStorage]
+	if !ok || capacity.Value() <= 0 {
+		return "", false
+	}
+	var used int64
+	for _, image := range node.Status.Images {
+		used += image.SizeBytes
+	}
+	usage := int(used * 100 / capacity.Value())
+	if usage < maxUsagePercent {
+		return "", false
+	}
+	return fmt.Sprintf("images use %d%% of the ephemeral storage of the node, limit %d%%", usage, maxUsagePercent), true
+}
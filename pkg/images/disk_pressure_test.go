@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// diskNode returns a node of 100GB ephemeral storage whose status lists images of the given sizes in GB
+func diskNode(name string, imageSizesGB ...int64) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/hostname": name}},
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("100G")},
+		},
+	}
+	for i, size := range imageSizesGB {
+		node.Status.Images = append(node.Status.Images, corev1.ContainerImage{
+			Names:     []string{name + "/image:" + string(rune('a'+i))},
+			SizeBytes: size * 1000 * 1000 * 1000,
+		})
+	}
+	return node
+}
+
+func TestNodeDiskPressure(t *testing.T) {
+	pressured := diskNode("pressured", 10)
+	pressured.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue}}
+	noCapacity := diskNode("no-capacity", 90)
+	noCapacity.Status.Capacity = nil
+	tests := []struct {
+		name             string
+		node             *corev1.Node
+		maxUsagePercent  int
+		expectedPressure bool
+	}{
+		{
+			name:             "#1: Check disabled",
+			node:             diskNode("full", 60, 39),
+			maxUsagePercent:  0,
+			expectedPressure: false,
+		},
+		{
+			name:             "#2: Node with room",
+			node:             diskNode("roomy", 20, 30),
+			maxUsagePercent:  85,
+			expectedPressure: false,
+		},
+		{
+			name:             "#3: Node with low available space",
+			node:             diskNode("full", 60, 30),
+			maxUsagePercent:  85,
+			expectedPressure: true,
+		},
+		{
+			name:             "#4: Node reporting DiskPressure",
+			node:             pressured,
+			maxUsagePercent:  85,
+			expectedPressure: true,
+		},
+		{
+			name:             "#5: Node not reporting its ephemeral storage",
+			node:             noCapacity,
+			maxUsagePercent:  85,
+			expectedPressure: false,
+		},
+	}
+	for _, test := range tests {
+		pressure, ok := nodeDiskPressure(test.node, test.maxUsagePercent)
+		if ok != test.expectedPressure {
+			t.Errorf("Test: %s failed: expectedPressure=%t, actualPressure=%t (%s)", test.name, test.expectedPressure, ok, pressure)
+		}
+	}
+}
+
+func TestProcessNextWorkItemDiskPressure(t *testing.T) {
+	imagecache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+	}
+	tests := []struct {
+		name           string
+		node           *corev1.Node
+		workType       WorkType
+		expectedJobs   int
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Image pulled to node with room",
+			node:           diskNode("roomy", 20, 30),
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Image pull deferred on node with low available space",
+			node:           diskNode("full", 60, 30),
+			workType:       ImageCacheRefresh,
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusSkipped,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonDeferredDiskPressure,
+		},
+		{
+			name: "#3: Image deleted from node with low available space",
+			node: func() *corev1.Node {
+				node := diskNode("full", 60, 30)
+				node.Status.Images = append(node.Status.Images, corev1.ContainerImage{Names: []string{"docker.io/library/foo:v1"}})
+				return node
+			}(),
+			workType:       ImageCachePurge,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.MaxNodeDiskUsagePercent = 85
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   "foo:v1",
+			Node:                    test.node,
+			ContainerRuntimeVersion: "containerd://1.6.8",
+			WorkType:                test.workType,
+			Imagecache:              &imagecache,
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, createdJobs(fakekubeclientset))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, iwres.Reason)
+			}
+		}
+	}
+}
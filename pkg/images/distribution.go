@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// kubernetesDistribution is a kubernetes distribution embedding its own container runtime,
+// whose socket and registry trust directory are not those of the runtime
+type kubernetesDistribution string
+
+const (
+	distributionNone     kubernetesDistribution = ""
+	distributionK3s      kubernetesDistribution = "k3s"
+	distributionMicrok8s kubernetesDistribution = "microk8s"
+)
+
+// ParseKubernetesDistribution validates the name of a kubernetes distribution set to override detection.
+// rke2 embeds the containerd of k3s and is parsed as k3s. An empty name means the distribution is detected
+// from the node.
+func ParseKubernetesDistribution(name string) (string, error) {
+	switch distribution := kubernetesDistribution(strings.ToLower(strings.TrimSpace(name))); distribution {
+	case distributionNone, distributionK3s, distributionMicrok8s:
+		return string(distribution), nil
+	case "rke2":
+		return string(distributionK3s), nil
+	}
+	return "", fmt.Errorf("unsupported kubernetes distribution %q: supported values are %q, %q and %q",
+		name, distributionK3s, "rke2", distributionMicrok8s)
+}
+
+// detectKubernetesDistribution returns the kubernetes distribution of the node: k3s (and rke2) from the
+// node's containerRuntimeVersion e.g. containerd://1.6.8-k3s1 or its instance type label, microk8s from
+// its cluster label. A non-empty distributionOverride is used as is.
+func detectKubernetesDistribution(node *corev1.Node, containerRuntimeVersion string, distributionOverride string) kubernetesDistribution {
+	if distributionOverride != "" {
+		return kubernetesDistribution(distributionOverride)
+	}
+	switch {
+	case strings.Contains(containerRuntimeVersion, "k3s"),
+		node.Labels[corev1.LabelInstanceTypeStable] == k3sInstanceTypeLabelValue:
+		return distributionK3s
+	case node.Labels[microk8sClusterLabelKey] == "true":
+		return distributionMicrok8s
+	default:
+		return distributionNone
+	}
+}
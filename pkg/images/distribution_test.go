@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseKubernetesDistribution(t *testing.T) {
+	tests := []struct {
+		name                 string
+		value                string
+		expectedDistribution string
+		expectErr            bool
+	}{
+		{
+			name:                 "#1: Empty value detects the distribution",
+			value:                "",
+			expectedDistribution: "",
+		},
+		{
+			name:                 "#2: k3s",
+			value:                " K3s ",
+			expectedDistribution: "k3s",
+		},
+		{
+			name:                 "#3: rke2 embeds the containerd of k3s",
+			value:                "rke2",
+			expectedDistribution: "k3s",
+		},
+		{
+			name:                 "#4: microk8s",
+			value:                "microk8s",
+			expectedDistribution: "microk8s",
+		},
+		{
+			name:      "#5: Unsupported distribution",
+			value:     "kind",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		distribution, err := ParseKubernetesDistribution(test.value)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=error, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if distribution != test.expectedDistribution {
+			t.Errorf("Test: %s failed: expectedDistribution=%s, actualDistribution=%s", test.name, test.expectedDistribution, distribution)
+		}
+	}
+}
+
+func TestDetectKubernetesDistribution(t *testing.T) {
+	tests := []struct {
+		name                    string
+		labels                  map[string]string
+		containerRuntimeVersion string
+		distributionOverride    string
+		expectedDistribution    kubernetesDistribution
+	}{
+		{
+			name:                    "#1: Standard containerd",
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedDistribution:    distributionNone,
+		},
+		{
+			name:                    "#2: k3s from runtime version",
+			containerRuntimeVersion: "containerd://1.6.8-k3s1",
+			expectedDistribution:    distributionK3s,
+		},
+		{
+			name:                    "#3: k3s from instance type label",
+			labels:                  map[string]string{"node.kubernetes.io/instance-type": "k3s"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedDistribution:    distributionK3s,
+		},
+		{
+			name:                    "#4: microk8s from cluster label",
+			labels:                  map[string]string{"microk8s.io/cluster": "true"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			expectedDistribution:    distributionMicrok8s,
+		},
+		{
+			name:                    "#5: Override takes precedence over detection",
+			labels:                  map[string]string{"microk8s.io/cluster": "true"},
+			containerRuntimeVersion: "containerd://1.6.8",
+			distributionOverride:    "k3s",
+			expectedDistribution:    distributionK3s,
+		},
+	}
+	for _, test := range tests {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "fakenode",
+				Labels: test.labels,
+			},
+		}
+		distribution := detectKubernetesDistribution(node, test.containerRuntimeVersion, test.distributionOverride)
+		if distribution != test.expectedDistribution {
+			t.Errorf("Test: %s failed: expectedDistribution=%s, actualDistribution=%s", test.name, test.expectedDistribution, distribution)
+		}
+	}
+}
@@ -14,5 +14,6 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package images is responsible for pulling images into and removing images from worker nodes
+// Package images is responsible for pulling images into and removing images from worker nodes.
+// Other controllers can construct the image pull/delete jobs of kube-fledged with an ImageJobBuilder.
 package images
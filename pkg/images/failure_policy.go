@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+// abortsOnFailure checks whether the image cache of the request creates no new pull job after a failed pull
+func abortsOnFailure(iwr ImageWorkRequest) bool {
+	return iwr.WorkType != ImageCachePurge && iwr.Imagecache != nil &&
+		iwr.Imagecache.Spec.FailurePolicy == fledgedv1alpha3.FailurePolicyAbort
+}
+
+// abortedImageCaches returns the image caches aborting on failure with a failed pull. The caller must hold m.lock.
+func (m *ImageManager) abortedImageCaches() map[string]bool {
+	aborted := map[string]bool{}
+	for _, iwres := range m.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusFailed && abortsOnFailure(iwres.ImageWorkRequest) {
+			aborted[imageCacheKey(iwres.ImageWorkRequest.Imagecache)] = true
+		}
+	}
+	return aborted
+}
+
+// abortedPull returns the result of a pull request skipped as a pull of its image cache failed
+func abortedPull(iwr ImageWorkRequest) ImageWorkResult {
+	return ImageWorkResult{
+		ImageWorkRequest: iwr,
+		Status:           ImageWorkResultStatusSkipped,
+		Reason:           fledgedv1alpha3.ImageCacheReasonAbortedOnFailure,
+		Message:          fledgedv1alpha3.ImageCacheMessageAbortedOnFailure,
+	}
+}
+
+// abortPullOnFailure records the pull request as skipped if its image cache aborts on failure and a pull
+// of the image cache failed. It returns whether the request was skipped.
+func (m *ImageManager) abortPullOnFailure(iwr ImageWorkRequest) bool {
+	if !abortsOnFailure(iwr) {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.abortedImageCaches()[imageCacheKey(iwr.Imagecache)] {
+		return false
+	}
+	m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = abortedPull(iwr)
+	return true
+}
+
+// abortQueuedPullJobs skips the queued pull requests of the image caches aborting on failure with a failed
+// pull, and returns them. The caller must hold m.lock.
+func (m *ImageManager) abortQueuedPullJobs() []ImageWorkRequest {
+	abortedCaches := m.abortedImageCaches()
+	aborted := []ImageWorkRequest{}
+	for cacheKey, pending := range m.pendingPullJobs {
+		if !abortedCaches[cacheKey] {
+			continue
+		}
+		for _, key := range pending {
+			if iwres, ok := m.imageworkstatus[key]; ok && iwres.Status == ImageWorkResultStatusJobQueued {
+				m.imageworkstatus[key] = abortedPull(iwres.ImageWorkRequest)
+				aborted = append(aborted, iwres.ImageWorkRequest)
+			}
+		}
+		m.pendingPullJobs[cacheKey] = nil
+	}
+	return aborted
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	failedPod := corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "manifest unknown"},
+		}}},
+	}
+	tests := []struct {
+		name                string
+		failurePolicy       fledgedv1alpha3.FailurePolicy
+		expectedCreatedJobs int
+		expectedSkipped     int
+	}{
+		{
+			name:                "#1: Pulls go on after a failed pull by default",
+			failurePolicy:       "",
+			expectedCreatedJobs: 2,
+			expectedSkipped:     0,
+		},
+		{
+			name:                "#2: Pulls go on after a failed pull with failure policy Continue",
+			failurePolicy:       fledgedv1alpha3.FailurePolicyContinue,
+			expectedCreatedJobs: 2,
+			expectedSkipped:     0,
+		},
+		{
+			name:                "#3: Pulls not yet started are skipped after a failed pull with failure policy Abort",
+			failurePolicy:       fledgedv1alpha3.FailurePolicyAbort,
+			expectedCreatedJobs: 1,
+			expectedSkipped:     3,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.MaxConcurrentPullJobs = 1
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{FailurePolicy: test.failurePolicy},
+		}
+		request := func(i int) ImageWorkRequest {
+			return ImageWorkRequest{
+				Image: "foo:v1",
+				Node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"kubernetes.io/hostname": fmt.Sprintf("node%d", i)},
+				}},
+				WorkType:   ImageCacheCreate,
+				Imagecache: imageCache,
+			}
+		}
+		for i := 0; i < 3; i++ {
+			imagemanager.imageworkqueue.Add(request(i))
+		}
+		for i := 0; i < 3; i++ {
+			imagemanager.processNextWorkItem()
+		}
+
+		// The pull to the first node fails, then the image is requested on one more node
+		jobs := activeJobs(imagemanager)
+		if len(jobs) != 1 {
+			t.Errorf("Test: %s failed: expectedActiveJobs=1, actualActiveJobs=%d", test.name, len(jobs))
+			continue
+		}
+		imagemanager.handlePodStatusChange(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: jobs[0] + "-abcde", Labels: map[string]string{"job-name": jobs[0]}},
+			Status:     failedPod,
+		})
+		imagemanager.imageworkqueue.Add(request(3))
+		imagemanager.processNextWorkItem()
+
+		if createdJobs(fakekubeclientset) != test.expectedCreatedJobs {
+			t.Errorf("Test: %s failed: expectedCreatedJobs=%d, actualCreatedJobs=%d", test.name, test.expectedCreatedJobs,
+				createdJobs(fakekubeclientset))
+		}
+		skipped := 0
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status == ImageWorkResultStatusSkipped && iwres.Reason == fledgedv1alpha3.ImageCacheReasonAbortedOnFailure {
+				skipped++
+			}
+		}
+		if skipped != test.expectedSkipped {
+			t.Errorf("Test: %s failed: expectedSkipped=%d, actualSkipped=%d", test.name, test.expectedSkipped, skipped)
+		}
+	}
+}
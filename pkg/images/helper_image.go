@@ -0,0 +1,282 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/klog/v2"
+)
+
+// helperImageCheck is the state of the check that the helper images of the jobs can be pulled
+type helperImageCheck struct {
+	// images are the helper images checked
+	images []string
+	// job is the name of the active check job. Empty once the check finished.
+	job string
+	// failure is the message of the check that failed to pull the helper images. Empty if they are available.
+	failure string
+}
+
+// helperImages returns the helper images of the jobs of the pull request: the busybox image the image pull jobs
+// copy the echo binary from, and the cri client image of the container runtime of the node
+func (m *ImageManager) helperImages(iwr ImageWorkRequest) []string {
+	busyboxImage := m.busyboxImage
+	if iwr.Imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = iwr.Imagecache.Spec.BusyboxImage
+	}
+	runtime := detectContainerRuntime(iwr.ContainerRuntimeVersion, m.jobOptions.ContainerRuntime)
+	images := []string{}
+	for _, image := range []string{busyboxImage, criClientImage(iwr.Imagecache, runtime, m.criClientImage)} {
+		if image != "" && (len(images) == 0 || images[0] != image) {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// newHelperImageCheckJob constructs a job manifest pulling the helper images onto the node, each in a container
+// running true, so that a helper image that cannot be pulled (e.g. from a bad mirror) is found by a single job
+// rather than by every job of the image cache. The images are always pulled, as their presence on the node
+// tells nothing of their registry. The job gets the settings of the image pull jobs.
+func newHelperImageCheckJob(imagecache *fledgedv1alpha3.ImageCache, image string, helperImages []string,
+	imagePullSecrets []corev1.LocalObjectReference, node *corev1.Node, busyboxImage string, serviceAccountName string,
+	jobPriorityClassName string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = imagecache.Spec.BusyboxImage
+	}
+	labels := jobLabels(imagecache, image)
+	containers := []corev1.Container{}
+	for i, helperImage := range helperImages {
+		containers = append(containers, corev1.Container{
+			Name:            fmt.Sprintf("helper-%d", i),
+			Image:           helperImage,
+			Command:         []string{"true"},
+			ImagePullPolicy: corev1.PullAlways,
+		})
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: imagecache.Name + "-",
+			Namespace:    imagecache.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				ownerReference(imagecache),
+			},
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: imagecache.Namespace,
+					Labels:    labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"kubernetes.io/hostname": node.Labels["kubernetes.io/hostname"],
+					},
+					Containers:    containers,
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, pullJobPodSecurityContext())
+	finishImagePullJob(job, imagecache, image, imagePullSecrets, node, busyboxImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// checkHelperImages creates the job checking that the helper images can be pulled onto the node of the request
+func (m *ImageManager) checkHelperImages(iwr ImageWorkRequest, helperImages []string) (*batchv1.Job, error) {
+	var imagePullSecrets []corev1.LocalObjectReference
+	if iwr.ImagePullSecrets != nil {
+		imagePullSecrets = *iwr.ImagePullSecrets
+	}
+	newjob, err := newHelperImageCheckJob(iwr.Imagecache, pinnedImage(iwr), helperImages, imagePullSecrets, iwr.Node,
+		m.busyboxImage, m.serviceAccountName, m.jobPriorityClassName, m.jobOptions)
+	if err != nil {
+		m.requestLogger(iwr).Error(err, "Error when constructing job manifest")
+		return nil, err
+	}
+	job, err := m.createJob(m.jobNamespace(iwr.Imagecache), newjob)
+	if err != nil {
+		m.requestLogger(iwr).Error(err, "Error creating job")
+		return nil, err
+	}
+	m.startJobSpan(iwr, job.Name, "helper-check")
+	return job, nil
+}
+
+// waitForHelperImages makes the pull request wait for the check of the helper images of its jobs, starting the
+// check on the node of the request if none is active, or fails the request if the helper images could not be
+// pulled. It returns false, the pull job is to be created, once the helper images are available or if they
+// are not checked.
+func (m *ImageManager) waitForHelperImages(iwr ImageWorkRequest) bool {
+	if !m.jobOptions.CheckHelperImages || isWindowsNode(iwr.Node) {
+		return false
+	}
+	helperImages := m.helperImages(iwr)
+	key := strings.Join(helperImages, ",")
+	logger := m.requestLogger(iwr)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	check, ok := m.helperImageChecks[key]
+	// the check job may have been replaced by a pull job after its deadline
+	if current, active := m.imageworkstatus[check.job]; ok && check.job != "" &&
+		(!active || !current.HelperImageCheck || current.Status != ImageWorkResultStatusJobCreated) {
+		ok = false
+	}
+	switch {
+	case ok && check.job != "":
+		m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+			ImageWorkRequest:    iwr,
+			Status:              ImageWorkResultStatusJobQueued,
+			HelperImageCheckJob: check.job,
+		}
+		logger.Info("Job not created", "reason", "helper-image-check", "action", "pull", "job", check.job)
+		return true
+	case ok && check.failure != "":
+		m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = helperImageUnavailable(iwr, check.failure)
+		logger.Info("Job not created", "reason", "helper-image-unavailable", "action", "pull")
+		return true
+	case ok:
+		return false
+	}
+	job, err := m.checkHelperImages(iwr, helperImages)
+	if err != nil {
+		// the pull jobs then find whether the helper images can be pulled
+		logger.Error(err, "Error checking helper images, creating pull job without the check")
+		return false
+	}
+	m.helperImageChecks[key] = helperImageCheck{images: helperImages, job: job.Name}
+	m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated, HelperImageCheck: true}
+	logger.Info("Job created", "job", job.Name, "action", "helper-check", "images", helperImages)
+	return true
+}
+
+// helperImageUnavailable returns the result of a pull request whose pull job was not created as the helper
+// images of the jobs could not be pulled
+func helperImageUnavailable(iwr ImageWorkRequest, failure string) ImageWorkResult {
+	return ImageWorkResult{
+		ImageWorkRequest: iwr,
+		Status:           ImageWorkResultStatusFailed,
+		Reason:           fledgedv1alpha3.ImageCacheReasonHelperImageUnavailable,
+		Message:          failure,
+	}
+}
+
+// helperImagePullFailed checks whether the helper image check job failed as a helper image could not be pulled
+func helperImagePullFailed(iwres ImageWorkResult) bool {
+	return iwres.Status == ImageWorkResultStatusFailed && (iwres.Reason == waitingReasonErrImagePull ||
+		iwres.Reason == waitingReasonImagePullBackOff || iwres.Reason == fledgedv1alpha3.ImageCacheReasonRateLimited)
+}
+
+// finishHelperImageCheck applies the result of the finished helper image check job to the pull requests waiting
+// for it, including the request that started the check. If a helper image could not be pulled, the requests fail
+// with HelperImageUnavailable without any pull job, as do the pull requests until the status of the image cache
+// is updated. Otherwise the pull jobs of the requests are created. A check that failed for another reason, e.g.
+// its deadline expired, is not remembered.
+func (m *ImageManager) finishHelperImageCheck(job string, iwres ImageWorkResult) {
+	m.lock.Lock()
+	key, check, ok := "", helperImageCheck{}, false
+	for k, c := range m.helperImageChecks {
+		if c.job == job {
+			key, check, ok = k, c, true
+		}
+	}
+	if !ok {
+		m.lock.Unlock()
+		return
+	}
+	waiting := map[string]ImageWorkRequest{job: iwres.ImageWorkRequest}
+	for k, r := range m.imageworkstatus {
+		if r.Status == ImageWorkResultStatusJobQueued && r.HelperImageCheckJob == job {
+			waiting[k] = r.ImageWorkRequest
+		}
+	}
+	unavailable := helperImagePullFailed(iwres)
+	switch {
+	case unavailable:
+		failure := fmt.Sprintf("Helper image(s) %s could not be pulled onto node %s: %s", strings.Join(check.images, ", "),
+			iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.Message)
+		m.helperImageChecks[key] = helperImageCheck{images: check.images, failure: failure}
+		for k, r := range waiting {
+			m.imageworkstatus[k] = helperImageUnavailable(r, failure)
+		}
+	case pullSucceeded(iwres):
+		m.helperImageChecks[key] = helperImageCheck{images: check.images}
+	default:
+		delete(m.helperImageChecks, key)
+	}
+	m.lock.Unlock()
+
+	if unavailable {
+		klog.Warningf("Job %s failed, helper images %s cannot be pulled: %s", job, strings.Join(check.images, ", "), iwres.Message)
+	} else {
+		if !pullSucceeded(iwres) {
+			klog.Warningf("Job %s checking helper images %s failed (%s), creating pull jobs: %s", job,
+				strings.Join(check.images, ", "), iwres.Reason, iwres.Message)
+		}
+		// the pull jobs are created before the requests stop waiting, so that their image caches keep waiting for them
+		for k, r := range waiting {
+			if err := m.startPull(r, false); err != nil {
+				klog.Errorf("Error pulling image '%s' to node '%s' after the helper image check: %v", r.Image, r.Node.Labels["kubernetes.io/hostname"], err)
+			}
+			m.lock.Lock()
+			delete(m.imageworkstatus, k)
+			m.lock.Unlock()
+		}
+		if m.canDeleteJob {
+			deletePropagation := metav1.DeletePropagationBackground
+			if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwres.ImageWorkRequest.Imagecache)).
+				Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+				klog.Errorf("Error deleting job %s: %v", job, err)
+			}
+		}
+	}
+	m.endJobSpan(job, iwres)
+	for _, r := range waiting {
+		m.notifyImageWorkResult(r)
+	}
+}
+
+// forgetUnavailableHelperImages drops the failed helper image checks once the status of an image cache whose pull
+// requests failed with HelperImageUnavailable is updated, so that its next refresh checks the helper images again.
+// The caller must hold m.lock.
+func (m *ImageManager) forgetUnavailableHelperImages(results map[string]ImageWorkResult) {
+	for _, iwres := range results {
+		if iwres.Status == ImageWorkResultStatusFailed && iwres.Reason == fledgedv1alpha3.ImageCacheReasonHelperImageUnavailable {
+			for key, check := range m.helperImageChecks {
+				if check.failure != "" {
+					delete(m.helperImageChecks, key)
+				}
+			}
+			return
+		}
+	}
+}
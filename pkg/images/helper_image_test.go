@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHelperImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     fledgedv1alpha3.ImageCacheSpec
+		expected []string
+	}{
+		{
+			name:     "#1: Default helper images",
+			expected: []string{"senthilrch/busybox:1.35.0", "senthilrch/fledged-docker-client:latest"},
+		},
+		{
+			name:     "#2: Helper images of the image cache",
+			spec:     fledgedv1alpha3.ImageCacheSpec{BusyboxImage: "mirror.local/busybox:1.36", CriClientImage: "mirror.local/cri-client:1.0"},
+			expected: []string{"mirror.local/busybox:1.36", "mirror.local/cri-client:1.0"},
+		},
+		{
+			name:     "#3: Same image for both helper images",
+			spec:     fledgedv1alpha3.ImageCacheSpec{BusyboxImage: "mirror.local/tools:1.0", CriClientImage: "mirror.local/tools:1.0"},
+			expected: []string{"mirror.local/tools:1.0"},
+		},
+	}
+	imagemanager, _ := newTestImageManager(newJobCreatingClientset(), "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{Spec: test.spec}
+		actual := imagemanager.helperImages(ImageWorkRequest{Image: "nginx:1.25", Node: &node, Imagecache: imagecache})
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expectedImages=%v, actualImages=%v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestNewHelperImageCheckJob(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	helperImages := []string{"senthilrch/busybox:1.35.0", "senthilrch/fledged-docker-client:latest"}
+	job, err := newHelperImageCheckJob(imagecache, "nginx:1.25", helperImages, nil, &node, "senthilrch/busybox:1.35.0",
+		"sa-kube-fledged", "priority-class-kube-fledged", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: #1: Helper image check job failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	containers := job.Spec.Template.Spec.Containers
+	if len(containers) != len(helperImages) {
+		t.Fatalf("Test: #1: Helper image check job failed: expectedContainers=%d, actualContainers=%d", len(helperImages), len(containers))
+	}
+	for i, container := range containers {
+		if container.Image != helperImages[i] || container.ImagePullPolicy != corev1.PullAlways || !reflect.DeepEqual(container.Command, []string{"true"}) {
+			t.Errorf("Test: #2: Helper image pulled by container %d failed: expectedImage=%s, expectedPullPolicy=%s, actualImage=%s, actualPullPolicy=%s, actualCommand=%v",
+				i, helperImages[i], corev1.PullAlways, container.Image, container.ImagePullPolicy, container.Command)
+		}
+	}
+	if hostname := job.Spec.Template.Spec.NodeSelector["kubernetes.io/hostname"]; hostname != "bar" {
+		t.Errorf("Test: #3: Helper image check job on the node failed: expectedHostname=bar, actualHostname=%s", hostname)
+	}
+	if _, err := newHelperImageCheckJob(nil, "nginx:1.25", helperImages, nil, &node, "senthilrch/busybox:1.35.0",
+		"sa-kube-fledged", "priority-class-kube-fledged", JobOptions{}); err == nil {
+		t.Errorf("Test: #4: Helper image check job of nil image cache failed: expectedError=imagecache pointer is nil, actualError=nil")
+	}
+}
+
+func TestHelperImageCheck(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             corev1.PodStatus
+		expectedStatus     string
+		expectedReason     string
+		expectedPullJobs   int
+		expectedJobsDone   bool
+		expectedCheckState bool
+	}{
+		{
+			name: "#1: Helper images pulled, pull jobs created",
+			status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+			},
+			expectedStatus:     ImageWorkResultStatusJobCreated,
+			expectedPullJobs:   3,
+			expectedCheckState: true,
+		},
+		{
+			name: "#2: Helper image not pulled, rollout short-circuited",
+			status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer(waitingReasonErrImagePull, "manifest unknown")},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     fledgedv1alpha3.ImageCacheReasonHelperImageUnavailable,
+			expectedJobsDone:   true,
+			expectedCheckState: true,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.CheckHelperImages = true
+		for _, image := range []string{"nginx:1.25", "redis:7.2", "postgres:16"} {
+			imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: image, Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache})
+			imagemanager.processNextWorkItem()
+		}
+		checks := activeJobs(imagemanager)
+		if len(checks) != 1 || createdJobs(fakekubeclientset) != 1 {
+			t.Fatalf("Test: %s failed: expectedCheckJobs=1, actualCheckJobs=%d, actualJobsCreated=%d", test.name, len(checks), createdJobs(fakekubeclientset))
+		}
+		if imagemanager.jobsDone(imageCacheKey(imagecache)) {
+			t.Errorf("Test: %s failed: image cache waits for the helper image check: expectedJobsDone=false, actualJobsDone=true", test.name)
+		}
+
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job-name": checks[0]}}, Status: test.status}
+		if pod.Status.Phase == corev1.PodPending {
+			imagemanager.handlePodPending(pod)
+		} else {
+			imagemanager.handlePodStatusChange(pod)
+		}
+
+		if actual := createdJobs(fakekubeclientset) - 1; actual != test.expectedPullJobs {
+			t.Errorf("Test: %s failed: expectedPullJobs=%d, actualPullJobs=%d", test.name, test.expectedPullJobs, actual)
+		}
+		if actual := imagemanager.jobsDone(imageCacheKey(imagecache)); actual != test.expectedJobsDone {
+			t.Errorf("Test: %s failed: expectedJobsDone=%t, actualJobsDone=%t", test.name, test.expectedJobsDone, actual)
+		}
+		results := 0
+		for _, iwres := range imagemanager.imageworkstatus {
+			results++
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: image %s: expectedStatus=%s, expectedReason=%s, actualStatus=%s, actualReason=%s",
+					test.name, iwres.ImageWorkRequest.Image, test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+		if results != 3 {
+			t.Errorf("Test: %s failed: expectedResults=3, actualResults=%d", test.name, results)
+		}
+		if actual := len(imagemanager.helperImageChecks) == 1; actual != test.expectedCheckState {
+			t.Errorf("Test: %s failed: expectedCheckRemembered=%t, actualCheckRemembered=%t", test.name, test.expectedCheckState, actual)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+// nodeStatusMaxImages is the default number of images listed in the status of a node by the kubelet
+// (--node-status-max-images), the largest first. A node listing that many images may have more.
+const nodeStatusMaxImages = 50
+
+// imageAbsent checks whether the image to delete is known to be absent from the node, so that no delete
+// job is created for it. It is decided from the images listed in the status of the node, which lists only
+// the images of the container runtime in the namespace of the CRI and not OCI artifacts. A node whose
+// status may be truncated to nodeStatusMaxImages images gets a delete job.
+func (m *ImageManager) imageAbsent(iwr ImageWorkRequest) bool {
+	if !storedByRuntime(iwr.ArtifactType) || iwr.Imagecache.Spec.ContainerdNamespace != "" ||
+		len(iwr.Node.Status.Images) >= nodeStatusMaxImages {
+		return false
+	}
+	present, err := imageAlreadyPresentInNode(RewriteImageRef(pinnedImage(iwr), m.jobOptions.RegistryMirrors), iwr.Node)
+	return err == nil && !present
+}
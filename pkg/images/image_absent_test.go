@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProcessNextWorkItemImageAbsent(t *testing.T) {
+	// manyImages are as many images as the kubelet lists in the status of a node by default
+	manyImages := []corev1.ContainerImage{}
+	for i := 0; i < nodeStatusMaxImages; i++ {
+		manyImages = append(manyImages, corev1.ContainerImage{Names: []string{fmt.Sprintf("docker.io/library/app%d:v1", i)}})
+	}
+	tests := []struct {
+		name                string
+		nodeImages          []corev1.ContainerImage
+		registryMirrors     map[string]string
+		containerdNamespace string
+		artifactType        fledgedv1alpha3.ArtifactType
+		expectedJobs        int
+		expectedStatus      string
+	}{
+		{
+			name:           "#1: Image present on the node is deleted",
+			nodeImages:     []corev1.ContainerImage{{Names: []string{"docker.io/library/nginx:1.25"}}},
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Image absent from the node gets no delete job",
+			nodeImages:     []corev1.ContainerImage{{Names: []string{"docker.io/library/nginx:1.24"}}},
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusAlreadyAbsent,
+		},
+		{
+			name:           "#3: Image absent from a node without images gets no delete job",
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusAlreadyAbsent,
+		},
+		{
+			name:           "#4: Image not listed by a node whose status may be truncated is deleted",
+			nodeImages:     manyImages,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:            "#5: Image pulled from its registry mirror is deleted",
+			nodeImages:      []corev1.ContainerImage{{Names: []string{"registry.internal/mirror/nginx:1.25"}}},
+			registryMirrors: map[string]string{"docker.io/library": "registry.internal/mirror"},
+			expectedJobs:    1,
+			expectedStatus:  ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:                "#6: Image in another containerd namespace is deleted",
+			containerdNamespace: "buildkit",
+			expectedJobs:        1,
+			expectedStatus:      ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#7: OCI artifact not listed by the node is deleted",
+			artifactType:   fledgedv1alpha3.ArtifactTypeArtifact,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.RegistryMirrors = test.registryMirrors
+		testnode := node
+		testnode.Status.Images = test.nodeImages
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   "nginx:1.25",
+			Node:                    &testnode,
+			ContainerRuntimeVersion: "containerd://1.6.8",
+			WorkType:                ImageCachePurge,
+			ArtifactType:            test.artifactType,
+			Imagecache: &fledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+				Spec:       fledgedv1alpha3.ImageCacheSpec{ContainerdNamespace: test.containerdNamespace},
+			},
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, createdJobs(fakekubeclientset))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+		}
+	}
+}
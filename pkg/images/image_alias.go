@@ -0,0 +1,217 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// imageAliases returns the aliases of the image of the request
+func imageAliases(iwr ImageWorkRequest) []string {
+	if iwr.Aliases == nil {
+		return nil
+	}
+	return *iwr.Aliases
+}
+
+// runtimeTagsImages checks whether the client of the container runtime can tag images. crictl has no
+// command to tag an image, so images are not tagged on CRI-O nodes.
+func runtimeTagsImages(runtime containerRuntime) bool {
+	return runtime != runtimeCRIO
+}
+
+// tagsImage checks whether the image of the request is to be tagged with its aliases: it has aliases
+// and is stored by a container runtime able to tag it, on a Linux node
+func (m *ImageManager) tagsImage(iwr ImageWorkRequest) bool {
+	return len(imageAliases(iwr)) > 0 && iwr.WorkType != ImageCachePurge && iwr.Imagecache != nil &&
+		storedByRuntime(iwr.ArtifactType) && iwr.Node != nil && !isWindowsNode(iwr.Node) &&
+		runtimeTagsImages(detectContainerRuntime(iwr.ContainerRuntimeVersion, m.jobOptions.ContainerRuntime))
+}
+
+// tagsPull checks whether the image of a succeeded pull is to be tagged with its aliases, before
+// it is verified if the image cache verifies its images
+func (m *ImageManager) tagsPull(iwres ImageWorkResult) bool {
+	return !iwres.Tagging && !iwres.Verification && m.tagsImage(iwres.ImageWorkRequest)
+}
+
+// aliasesMissing checks whether an image already present on the node is to be tagged with aliases
+// that the node's status does not list, e.g. aliases added to the image cache after the pull
+func (m *ImageManager) aliasesMissing(iwr ImageWorkRequest) bool {
+	if !m.tagsImage(iwr) {
+		return false
+	}
+	for _, alias := range imageAliases(iwr) {
+		if present, err := imageAlreadyPresentInNode(alias, iwr.Node); err == nil && !present {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTagCommand returns the command of the image tag job container that tags the image with its aliases
+// using the client of the container runtime talking to the socket. On containerd nodes, the image is tagged
+// with ctr in the namespace of the CRI (k8s.io), or in containerdNamespace if set.
+func buildTagCommand(runtime containerRuntime, socketPath, image string, aliases []string, containerdNamespace string) []string {
+	namespace := "k8s.io"
+	if containerdNamespace != "" {
+		namespace = shellQuoteAll([]string{containerdNamespace})
+	}
+	var commands []string
+	switch runtime {
+	case runtimeContainerd:
+		// ctr does not normalize image references
+		refs := append([]string{image}, aliases...)
+		for i := range refs {
+			if normalizedRef, err := normalizeImageRef(refs[i]); err == nil {
+				refs[i] = normalizedRef
+			}
+		}
+		commands = append(commands, "/usr/bin/ctr --address="+socketPath+" -n "+namespace+" images tag --force "+shellQuoteAll(refs))
+	case runtimeNerdctl:
+		for _, alias := range aliases {
+			commands = append(commands, "/usr/bin/nerdctl --address="+socketPath+" -n "+namespace+" tag "+shellQuoteAll([]string{image, alias}))
+		}
+	case runtimePodman:
+		commands = append(commands, "/usr/bin/podman --remote --url=unix://"+socketPath+" tag "+shellQuoteAll(append([]string{image}, aliases...)))
+	default:
+		for _, alias := range aliases {
+			commands = append(commands, "/usr/bin/docker --host=unix://"+socketPath+" image tag "+shellQuoteAll([]string{image, alias}))
+		}
+	}
+	if len(commands) == 1 {
+		return []string{"/bin/bash", "-c", "exec " + commands[0] + " > /dev/termination-log 2>&1"}
+	}
+	return []string{"/bin/bash", "-c", "{ " + strings.Join(commands, " && ") + "; } > /dev/termination-log 2>&1"}
+}
+
+// newImageTagJob constructs a job manifest tagging the image pulled to the node with its aliases through the
+// client of the container runtime of the node. The image is tagged by the reference it was pulled with from
+// its registry mirror, if any. Like the image verify job, it gets the settings of the image delete jobs.
+func newImageTagJob(imagecache *fledgedv1alpha3.ImageCache, image string, aliases []string, node *corev1.Node,
+	containerRuntimeVersion string, dockerclientimage string, serviceAccountName string,
+	jobPriorityClassName string, criSocketPath string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if isWindowsNode(node) {
+		return nil, fmt.Errorf("images are not tagged on Windows nodes")
+	}
+	runtime := detectContainerRuntime(containerRuntimeVersion, jobOptions.ContainerRuntime)
+	if !runtimeTagsImages(runtime) {
+		return nil, fmt.Errorf("images are not tagged with the client of container runtime %s", runtime)
+	}
+	// jobs are labelled with the image of the cache, not the one pulled from its mirror
+	cachedImage := image
+	image = RewriteImageRef(image, jobOptions.RegistryMirrors)
+	socketPath := resolveCRISocketPath(node, runtime, containerRuntimeVersion, criSocketPath, jobOptions.KubernetesDistribution)
+
+	job := criClientJob(imagecache, node.Labels["kubernetes.io/hostname"], jobLabels(imagecache, cachedImage),
+		criClientImage(imagecache, runtime, dockerclientimage),
+		buildTagCommand(runtime, socketPath, image, aliases, imagecache.Spec.ContainerdNamespace), socketPath)
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImageDeleteJob(job, imagecache, cachedImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// tagImage tags the image of the node with its aliases
+func (m *ImageManager) tagImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	newjob, err := m.jobBuilder().TagJob(iwr)
+	if err != nil {
+		klog.Errorf("Error when constructing job manifest: %v", err)
+		return nil, err
+	}
+	// Create a Job to tag the image in the node
+	job, err := m.createJob(m.jobNamespace(iwr.Imagecache), newjob)
+	if err != nil {
+		klog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
+		return nil, err
+	}
+	m.startJobSpan(iwr, job.Name, "tag")
+	return job, nil
+}
+
+// tagPresentImage creates the job tagging the image already present on the node with its aliases,
+// whose result is the result of the request
+func (m *ImageManager) tagPresentImage(iwr ImageWorkRequest) error {
+	job, err := m.tagImage(iwr)
+	if err != nil {
+		m.jobCreationFailed(iwr, err)
+		return err
+	}
+	m.lock.Lock()
+	m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated, Tagging: true}
+	m.lock.Unlock()
+	m.requestLogger(iwr).Info("Job created", "job", job.Name, "action", "tag", "runtime", iwr.ContainerRuntimeVersion)
+	return nil
+}
+
+// startTagging replaces the succeeded pull job by a job tagging the pulled image with its aliases, which then
+// decides the result of the request. The caller must hold m.lock.
+func (m *ImageManager) startTagging(job string, iwres ImageWorkResult) {
+	iwr := iwres.ImageWorkRequest
+	newJob, err := m.tagImage(iwr)
+	if err != nil {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageTagFailed
+		iwres.Message = fmt.Sprintf("%s: error creating tag job: %v", fledgedv1alpha3.ImageCacheMessageImageTagFailed, err)
+		m.imageworkstatus[job] = iwres
+		return
+	}
+	m.requestLogger(iwr).Info("Job created", "job", newJob.Name, "action", "tag", "runtime", iwr.ContainerRuntimeVersion, "pullJob", job)
+	if m.canDeleteJob {
+		deletePropagation := metav1.DeletePropagationBackground
+		if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwr.Imagecache)).
+			Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+			klog.Errorf("Error deleting job %s: %v", job, err)
+		}
+	}
+	delete(m.imageworkstatus, job)
+	iwres.Status = ImageWorkResultStatusJobCreated
+	iwres.Tagging = true
+	m.imageworkstatus[newJob.Name] = iwres
+	m.moveSharedJob(job, newJob.Name)
+}
+
+// taggingResult applies the result of a finished tag job to the result of the request
+func taggingResult(iwres *ImageWorkResult) {
+	if !iwres.Tagging || iwres.Verification || iwres.Status != ImageWorkResultStatusFailed {
+		return
+	}
+	iwres.Message = tagFailedMessage(iwres.Reason, iwres.Message)
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageTagFailed
+}
+
+// tagFailedMessage returns the message of a failed tag job, given the reason and message of its failure if any
+func tagFailedMessage(reason, message string) string {
+	if reason == "" {
+		return fledgedv1alpha3.ImageCacheMessageImageTagFailed
+	}
+	if message == "" {
+		return fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessageImageTagFailed, reason)
+	}
+	return fmt.Sprintf("%s (%s: %s)", fledgedv1alpha3.ImageCacheMessageImageTagFailed, reason, message)
+}
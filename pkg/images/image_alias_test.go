@@ -0,0 +1,218 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildTagCommand(t *testing.T) {
+	tests := []struct {
+		name                string
+		runtime             containerRuntime
+		socketPath          string
+		aliases             []string
+		containerdNamespace string
+		expectedCommand     string
+	}{
+		{
+			name:            "#1: docker",
+			runtime:         runtimeDocker,
+			socketPath:      "/var/run/docker.sock",
+			aliases:         []string{"registry.example.com/nginx:1.25"},
+			expectedCommand: "exec /usr/bin/docker --host=unix:///var/run/docker.sock image tag 'nginx:1.25' 'registry.example.com/nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:       "#2: docker with several aliases",
+			runtime:    runtimeDocker,
+			socketPath: "/var/run/docker.sock",
+			aliases:    []string{"registry.example.com/nginx:1.25", "nginx:stable"},
+			expectedCommand: "{ /usr/bin/docker --host=unix:///var/run/docker.sock image tag 'nginx:1.25' 'registry.example.com/nginx:1.25' && " +
+				"/usr/bin/docker --host=unix:///var/run/docker.sock image tag 'nginx:1.25' 'nginx:stable'; } > /dev/termination-log 2>&1",
+		},
+		{
+			name:       "#3: containerd",
+			runtime:    runtimeContainerd,
+			socketPath: "/run/containerd/containerd.sock",
+			aliases:    []string{"registry.example.com/nginx:1.25", "nginx:stable"},
+			expectedCommand: "exec /usr/bin/ctr --address=/run/containerd/containerd.sock -n k8s.io images tag --force " +
+				"'docker.io/library/nginx:1.25' 'registry.example.com/nginx:1.25' 'docker.io/library/nginx:stable' > /dev/termination-log 2>&1",
+		},
+		{
+			name:                "#4: containerd with namespace",
+			runtime:             runtimeContainerd,
+			socketPath:          "/run/containerd/containerd.sock",
+			aliases:             []string{"registry.example.com/nginx"},
+			containerdNamespace: "buildkit",
+			expectedCommand: "exec /usr/bin/ctr --address=/run/containerd/containerd.sock -n 'buildkit' images tag --force " +
+				"'docker.io/library/nginx:1.25' 'registry.example.com/nginx:latest' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#5: nerdctl",
+			runtime:         runtimeNerdctl,
+			socketPath:      "/run/containerd/containerd.sock",
+			aliases:         []string{"registry.example.com/nginx:1.25"},
+			expectedCommand: "exec /usr/bin/nerdctl --address=/run/containerd/containerd.sock -n k8s.io tag 'nginx:1.25' 'registry.example.com/nginx:1.25' > /dev/termination-log 2>&1",
+		},
+		{
+			name:            "#6: podman",
+			runtime:         runtimePodman,
+			socketPath:      "/run/podman/podman.sock",
+			aliases:         []string{"registry.example.com/nginx:1.25", "nginx:stable"},
+			expectedCommand: "exec /usr/bin/podman --remote --url=unix:///run/podman/podman.sock tag 'nginx:1.25' 'registry.example.com/nginx:1.25' 'nginx:stable' > /dev/termination-log 2>&1",
+		},
+	}
+	for _, test := range tests {
+		command := buildTagCommand(test.runtime, test.socketPath, "nginx:1.25", test.aliases, test.containerdNamespace)
+		if len(command) != 3 || command[0] != "/bin/bash" || command[1] != "-c" || command[2] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expectedCommand=%s, actualCommand=%v", test.name, test.expectedCommand, command)
+		}
+	}
+}
+
+func TestImageAliasTagging(t *testing.T) {
+	failedPod := corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "image not found"},
+		}}},
+	}
+	succeededPod := corev1.PodStatus{Phase: corev1.PodSucceeded}
+	tests := []struct {
+		name           string
+		aliases        []string
+		verifyImages   bool
+		runtimeVersion string
+		nodeImages     []string
+		podStatuses    []corev1.PodStatus
+		expectedJobs   []string
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Pulled image is tagged with its aliases",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			podStatuses:    []corev1.PodStatus{succeededPod, succeededPod},
+			expectedJobs:   []string{"pull", "tag"},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#2: Failed tag job fails the request",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			podStatuses:    []corev1.PodStatus{succeededPod, failedPod},
+			expectedJobs:   []string{"pull", "tag"},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonImageTagFailed,
+		},
+		{
+			name:           "#3: Failed pull is not tagged",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			podStatuses:    []corev1.PodStatus{failedPod},
+			expectedJobs:   []string{"pull"},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "Error",
+		},
+		{
+			name:           "#4: Tagged image is verified",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			verifyImages:   true,
+			podStatuses:    []corev1.PodStatus{succeededPod, succeededPod, succeededPod},
+			expectedJobs:   []string{"pull", "tag", "verify"},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#5: Image without aliases is not tagged",
+			podStatuses:    []corev1.PodStatus{succeededPod},
+			expectedJobs:   []string{"pull"},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#6: Image is not tagged on CRI-O nodes",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			runtimeVersion: "cri-o://1.28.1",
+			podStatuses:    []corev1.PodStatus{succeededPod},
+			expectedJobs:   []string{"pull"},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#7: Present image listed with its aliases is already pulled",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			nodeImages:     []string{"docker.io/library/foo:v1", "registry.example.com/foo:v1"},
+			expectedJobs:   []string{},
+			expectedStatus: ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:           "#8: Present image missing an alias is tagged",
+			aliases:        []string{"registry.example.com/foo:v1"},
+			nodeImages:     []string{"docker.io/library/foo:v1"},
+			podStatuses:    []corev1.PodStatus{succeededPod},
+			expectedJobs:   []string{"tag"},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", true, "")
+		testnode := node
+		if len(test.nodeImages) > 0 {
+			testnode.Status.Images = []corev1.ContainerImage{{Names: test.nodeImages}}
+		}
+		runtimeVersion := test.runtimeVersion
+		if runtimeVersion == "" {
+			runtimeVersion = "containerd://1.6.8"
+		}
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{VerifyImages: test.verifyImages},
+		}
+		aliases := test.aliases
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: "foo:v1", Aliases: &aliases, Node: &testnode, WorkType: ImageCacheCreate,
+			Imagecache: imageCache, ContainerRuntimeVersion: runtimeVersion})
+		imagemanager.processNextWorkItem()
+
+		for _, status := range test.podStatuses {
+			for _, job := range activeJobs(imagemanager) {
+				imagemanager.handlePodStatusChange(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: job + "-abcde", Labels: map[string]string{"job-name": job}},
+					Status:     status,
+				})
+			}
+		}
+
+		if jobs := createdJobKinds(fakekubeclientset); strings.Join(jobs, ",") != strings.Join(test.expectedJobs, ",") {
+			t.Errorf("Test: %s failed: expectedJobs=%v, actualJobs=%v", test.name, test.expectedJobs, jobs)
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedResults=1, actualResults=%d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for _, actual := range imagemanager.imageworkstatus {
+			if actual.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, actual.Status)
+			}
+			if actual.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, actual.Reason)
+			}
+		}
+	}
+}
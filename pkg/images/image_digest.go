@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"github.com/docker/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ImageDigestInNode returns the digest the image resolved to on the node, from the
+// repo@digest name under which the node lists the image
+func ImageDigestInNode(image string, node *corev1.Node) (string, bool) {
+	ref, ok := localDigestRef(image, node)
+	if !ok {
+		return "", false
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", false
+	}
+	canonical, ok := named.(reference.Canonical)
+	if !ok {
+		return "", false
+	}
+	return canonical.Digest().String(), true
+}
+
+// PinnedImageRef returns the repo@digest reference of the image pinned to the digest
+// e.g. nginx:1.25 --> docker.io/library/nginx@sha256:... The tag is dropped, as container
+// runtimes list images pulled by digest under their repo@digest name only. The image is
+// returned unchanged if the digest is empty, or if the image is not a valid reference.
+func PinnedImageRef(image, digest string) string {
+	if digest == "" {
+		return image
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		klog.Warningf("Unable to parse image reference %s to pin it to digest %s: %v", image, digest, err)
+		return image
+	}
+	return reference.TrimNamed(named).String() + "@" + digest
+}
+
+// IsDigestRef checks whether the image reference has a digest
+func IsDigestRef(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	_, ok := named.(reference.Canonical)
+	return ok
+}
+
+// pinnedImage returns the reference of the image of the request, pinned to its digest if any
+func pinnedImage(iwr ImageWorkRequest) string {
+	return PinnedImageRef(iwr.Image, iwr.Digest)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/testing"
+)
+
+func TestImageDigestInNode(t *testing.T) {
+	node := &corev1.Node{
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx@" + testDigest, "docker.io/library/nginx:1.25"}},
+				{Names: []string{"docker.io/library/redis:7"}},
+			},
+		},
+	}
+	tests := []struct {
+		name           string
+		image          string
+		expectedDigest string
+		expectedFound  bool
+	}{
+		{"#1: Tag resolved to the digest listed by the node", "nginx:1.25", testDigest, true},
+		{"#2: Digest reference resolved to its own digest", "nginx@" + testDigest, testDigest, true},
+		{"#3: Image listed without a digest name", "redis:7", "", false},
+		{"#4: Image not listed by the node", "busybox:1.35", "", false},
+	}
+	for _, test := range tests {
+		digest, found := ImageDigestInNode(test.image, node)
+		if digest != test.expectedDigest || found != test.expectedFound {
+			t.Errorf("Test: %s failed: expectedDigest=%s, expectedFound=%t, actualDigest=%s, actualFound=%t",
+				test.name, test.expectedDigest, test.expectedFound, digest, found)
+		}
+	}
+}
+
+func TestPinnedImageRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       string
+		digest      string
+		expectedRef string
+	}{
+		{"#1: Image without a digest is unchanged", "nginx:1.25", "", "nginx:1.25"},
+		{"#2: Tag is replaced by the digest", "nginx:1.25", testDigest, "docker.io/library/nginx@" + testDigest},
+		{"#3: Private registry image is pinned", "registry.example.com:5000/team/app:v1", testDigest,
+			"registry.example.com:5000/team/app@" + testDigest},
+		{"#4: Invalid image reference is unchanged", "NGINX:1.25", testDigest, "NGINX:1.25"},
+	}
+	for _, test := range tests {
+		if ref := PinnedImageRef(test.image, test.digest); ref != test.expectedRef {
+			t.Errorf("Test: %s failed: expectedRef=%s, actualRef=%s", test.name, test.expectedRef, ref)
+		}
+	}
+}
+
+func TestProcessNextWorkItemPinnedDigest(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"kubernetes.io/hostname": "node1"},
+		},
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx@sha256:1111111111111111111111111111111111111111111111111111111111111111",
+					"docker.io/library/nginx:1.25"}},
+			},
+		},
+	}
+	pinnedImage := "docker.io/library/nginx@" + testDigest
+	tests := []struct {
+		name          string
+		workType      WorkType
+		digest        string
+		expectedJobs  int
+		expectedImage string
+	}{
+		{"#1: Refresh of a tag present on the node pulls nothing", ImageCacheRefresh, "", 0, ""},
+		{"#2: Refresh pulls the pinned digest, even though the tag is present", ImageCacheRefresh, testDigest, 1, pinnedImage},
+		{"#3: Purge deletes the pinned digest", ImageCachePurge, testDigest, 1, pinnedImage},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		// the pinned digest is deleted from the node having pulled it
+		testnode := node.DeepCopy()
+		if test.workType == ImageCachePurge {
+			testnode.Status.Images = append(testnode.Status.Images, corev1.ContainerImage{Names: []string{pinnedImage}})
+		}
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   "nginx:1.25",
+			Node:                    testnode,
+			ContainerRuntimeVersion: "containerd://1.6.0",
+			WorkType:                test.workType,
+			Imagecache: &fledgedv1alpha3.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+				Spec:       fledgedv1alpha3.ImageCacheSpec{ForceDelete: true},
+			},
+			Digest: test.digest,
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, createdJobs(fakekubeclientset))
+		}
+		for _, action := range fakekubeclientset.Actions() {
+			if action.GetVerb() != "create" {
+				continue
+			}
+			container := action.(core.CreateAction).GetObject().(*batchv1.Job).Spec.Template.Spec.Containers[0]
+			if test.workType == ImageCachePurge {
+				if command := strings.Join(container.Command, " "); !strings.Contains(command, test.expectedImage) {
+					t.Errorf("Test: %s failed: expectedImage=%s, actualCommand=%s", test.name, test.expectedImage, command)
+				}
+			} else if container.Image != test.expectedImage {
+				t.Errorf("Test: %s failed: expectedImage=%s, actualImage=%s", test.name, test.expectedImage, container.Image)
+			}
+		}
+	}
+}
@@ -17,103 +17,368 @@ limitations under the License.
 package images
 
 import (
-	"encoding/json"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
+	"github.com/docker/distribution/reference"
 	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
 )
 
-// newImagePullJob constructs a job manifest for pulling an image to a node
+// legacyModelzCachePaths are the directories cached for modelzai images when JobOptions.LegacyModelzDirCache is set
+var legacyModelzCachePaths = []string{"/opt/conda/bin/", "/opt/conda/lib/"}
+
+// newImagePullJob constructs a job manifest for pulling an image to a node.
+// imagePullPolicyOverride is the pull policy set for the image in the cache spec;
+// when set it takes precedence over the controller-wide imagePullPolicy.
+// When cachePaths is non-empty, the files under these directories are read after the pull.
+// imagePullSecrets are the pull secrets of the image, merged with those of the image cache.
+// The image is pulled from its registry mirror, if any. The busyboxImage and pullJobPriorityClassName
+// of the image cache, when set, take precedence over the controller-wide busyboxImage and jobPriorityClassName.
 func newImagePullJob(imagecache *fledgedv1alpha3.ImageCache, image string,
-	forceFullCache bool, node *corev1.Node, imagePullPolicy string,
-	busyboxImage string, serviceAccountName string, jobPriorityClassName string) (*batchv1.Job, error) {
+	forceFullCache bool, cachePaths []string, imagePullSecrets []corev1.LocalObjectReference, node *corev1.Node, imagePullPolicy string, imagePullPolicyOverride corev1.PullPolicy,
+	busyboxImage string, serviceAccountName string, jobPriorityClassName string, jobOptions JobOptions) (*batchv1.Job, error) {
 	var pullPolicy corev1.PullPolicy = corev1.PullIfNotPresent
 	hostname := node.Labels["kubernetes.io/hostname"]
 	if imagecache == nil {
-		glog.Error("imagecache pointer is nil")
+		klog.Error("imagecache pointer is nil")
 		return nil, fmt.Errorf("imagecache pointer is nil")
 	}
-	if imagePullPolicy == string(corev1.PullAlways) {
+	// jobs are labelled with the image of the cache, not the one pulled from its mirror
+	cachedImage := image
+	image = RewriteImageRef(image, jobOptions.RegistryMirrors)
+	if imagecache.Spec.BusyboxImage != "" {
+		busyboxImage = imagecache.Spec.BusyboxImage
+	}
+	if imagePullPolicyOverride != "" {
+		pullPolicy = imagePullPolicyOverride
+	} else if imagePullPolicy == string(corev1.PullAlways) {
 		pullPolicy = corev1.PullAlways
 	} else if imagePullPolicy == string(corev1.PullIfNotPresent) {
 		pullPolicy = corev1.PullIfNotPresent
-		if latestimage := strings.Contains(image, ":latest") || !strings.Contains(image, ":"); latestimage {
+		if latestImage(image) && latestAlwaysPull(imagecache, jobOptions) {
 			pullPolicy = corev1.PullAlways
 		}
 	}
 
-	labels := map[string]string{
-		"app":         "kubefledged",
-		"kubefledged": "kubefledged-image-manager",
-		"imagecache":  imagecache.Name,
-		"controller":  controllerAgentName,
-	}
+	labels := jobLabels(imagecache, cachedImage)
 
 	var job *batchv1.Job
-	if forceFullCache {
+	if isWindowsNode(node) {
+		if forceFullCache || len(cachePaths) > 0 {
+			klog.Warningf("Caching files of image %s is not supported on Windows node %s, the image is only pulled", image, hostname)
+		}
+		job = windowsPullJob(imagecache, image, pullPolicy, hostname, labels)
+	} else if forceFullCache {
 		job = fullCacheJob(imagecache, image, pullPolicy, hostname, labels)
-	} else if strings.Contains(image, "modelzai") {
-		job = dirCacheJob(imagecache, image, pullPolicy, hostname, labels, []string{
-			"/opt/conda/bin/", "/opt/conda/lib/",
-		})
+	} else if len(cachePaths) > 0 {
+		for _, cachePath := range cachePaths {
+			if err := validateCachePath(cachePath); err != nil {
+				klog.Errorf("Invalid cache path for image %s: %v", image, err)
+				return nil, fmt.Errorf("invalid cache path for image %s: %v", image, err)
+			}
+		}
+		job = dirCacheJob(imagecache, image, pullPolicy, hostname, labels, cachePaths)
+	} else if jobOptions.ForceFullCache {
+		job = fullCacheJob(imagecache, image, pullPolicy, hostname, labels)
+	} else if jobOptions.LegacyModelzDirCache && strings.Contains(image, "modelzai") {
+		job = dirCacheJob(imagecache, image, pullPolicy, hostname, labels, legacyModelzCachePaths)
 	} else {
 		job = commonJob(imagecache, image, pullPolicy, hostname, labels, busyboxImage)
 	}
+	// Windows containers take none of the Linux security settings
+	if !isWindowsNode(node) {
+		setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+			imagecache.Spec.JobSeccompProfile, pullJobPodSecurityContext())
+	}
+	finishImagePullJob(job, imagecache, cachedImage, imagePullSecrets, node, busyboxImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
 
+// finishImagePullJob applies the settings common to the image pull jobs of all nodes and artifact types
+func finishImagePullJob(job *batchv1.Job, imagecache *fledgedv1alpha3.ImageCache, image string, imagePullSecrets []corev1.LocalObjectReference,
+	node *corev1.Node, busyboxImage string, serviceAccountName string, jobPriorityClassName string, jobOptions JobOptions) {
 	if serviceAccountName != "" {
 		job.Spec.Template.Spec.ServiceAccountName = serviceAccountName
 	}
+	if imagecache.Spec.PullJobPriorityClassName != "" {
+		jobPriorityClassName = imagecache.Spec.PullJobPriorityClassName
+	}
 	if jobPriorityClassName != "" {
 		job.Spec.Template.Spec.PriorityClassName = jobPriorityClassName
 	}
-	return job, nil
+	job.Spec.ActiveDeadlineSeconds = jobDeadlineSeconds(imagecache.Spec.ImagePullJobDeadline, jobOptions.ImagePullJobDeadline)
+	backoffLimit := jobOptions.JobBackoffLimit
+	job.Spec.BackoffLimit = &backoffLimit
+	setJobResources(job, imagecache.Spec.JobResources, jobOptions.Resources)
+	setTerminationMessagePolicy(job)
+	setImageAnnotation(job, image)
+	setPullBandwidth(job, imagecache.Spec.PullBandwidth)
+	setJobPodMetadata(job, imagecache.Spec.JobLabels, imagecache.Spec.JobAnnotations)
+	setJobNamespace(job, imagecache, jobOptions)
+	setRegistryCAs(job, imagecache.Spec.RegistryCAs, node, busyboxImage, jobOptions.ContainerRuntime, jobOptions.KubernetesDistribution)
+	setJobProxyEnv(job, jobOptions)
+	setJobPlacement(job, imagecache.Spec.NodeSelector, imagecache.Spec.Affinity)
+	setJobDNS(job, imagecache.Spec.JobDNSPolicy, imagecache.Spec.JobDNSConfig)
+	job.Spec.Template.Spec.Tolerations = pullJobTolerations(imagecache)
+	job.Spec.Template.Spec.ImagePullSecrets = MergeImagePullSecrets(imagecache.Spec.ImagePullSecrets, imagePullSecrets)
+	setJobRestartPolicy(job, jobOptions.PullJobRestartPolicy)
+	job.Spec.TTLSecondsAfterFinished = jobTTLSecondsAfterFinished(jobOptions.TTLSecondsAfterFinished)
 }
 
-// newImageDeleteJob constructs a job manifest to delete an image from a node
-func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, node *corev1.Node,
-	containerRuntimeVersion string, dockerclientimage string, serviceAccountName string,
-	imageDeleteJobHostNetwork bool, jobPriorityClassName string, criSocketPath string) (*batchv1.Job, error) {
+// MergeImagePullSecrets returns the pull secrets of the image cache followed by those of the image,
+// without duplicates and secrets with no name. It returns nil if there are none.
+func MergeImagePullSecrets(imageCacheSecrets, imageSecrets []corev1.LocalObjectReference) []corev1.LocalObjectReference {
+	var merged []corev1.LocalObjectReference
+	seen := map[string]bool{}
+	for _, secrets := range [][]corev1.LocalObjectReference{imageCacheSecrets, imageSecrets} {
+		for _, secret := range secrets {
+			if secret.Name == "" || seen[secret.Name] {
+				continue
+			}
+			seen[secret.Name] = true
+			merged = append(merged, secret)
+		}
+	}
+	return merged
+}
+
+// jobTTLSecondsAfterFinished returns the ttlSecondsAfterFinished of a job, or nil when disabled
+func jobTTLSecondsAfterFinished(ttl int32) *int32 {
+	if ttl <= 0 {
+		return nil
+	}
+	return &ttl
+}
+
+// setJobPlacement adds the nodeSelector and affinity of the image cache to the pod of a job.
+// The job remains pinned to its node by the hostname label, which the nodeSelector cannot override.
+func setJobPlacement(job *batchv1.Job, nodeSelector map[string]string, affinity *corev1.Affinity) {
+	podSpec := &job.Spec.Template.Spec
+	for k, v := range nodeSelector {
+		if k == "kubernetes.io/hostname" {
+			continue
+		}
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = map[string]string{}
+		}
+		podSpec.NodeSelector[k] = v
+	}
+	if affinity != nil {
+		podSpec.Affinity = affinity.DeepCopy()
+	}
+}
+
+// setJobDNS sets the dnsPolicy and dnsConfig of the image cache on the pod of a job, e.g. to resolve a
+// private registry through an internal resolver
+func setJobDNS(job *batchv1.Job, dnsPolicy corev1.DNSPolicy, dnsConfig *corev1.PodDNSConfig) {
+	podSpec := &job.Spec.Template.Spec
+	if dnsPolicy != "" {
+		podSpec.DNSPolicy = dnsPolicy
+	}
+	if dnsConfig != nil {
+		podSpec.DNSConfig = dnsConfig.DeepCopy()
+	}
+}
+
+// pullJobTolerations returns the tolerations of image pull jobs: the tolerations of the
+// image cache, none by default. Pull jobs of image caches cached on unschedulable nodes
+// also tolerate the unschedulable taint.
+func pullJobTolerations(imagecache *fledgedv1alpha3.ImageCache) []corev1.Toleration {
+	tolerations := copyTolerations(imagecache.Spec.Tolerations)
+	if imagecache.Spec.CacheOnUnschedulableNodes {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key:      corev1.TaintNodeUnschedulable,
+			Operator: corev1.TolerationOpExists,
+			Effect:   corev1.TaintEffectNoSchedule,
+		})
+	}
+	return tolerations
+}
+
+// deleteJobTolerations returns the tolerations of image delete jobs: the tolerations of the
+// image cache, or by default a toleration of every taint, so that images can be deleted
+// from any node they were cached on.
+func deleteJobTolerations(imagecache *fledgedv1alpha3.ImageCache) []corev1.Toleration {
+	if imagecache.Spec.Tolerations == nil {
+		return []corev1.Toleration{
+			{
+				Operator: corev1.TolerationOpExists,
+			},
+		}
+	}
+	return copyTolerations(imagecache.Spec.Tolerations)
+}
+
+func copyTolerations(tolerations []corev1.Toleration) []corev1.Toleration {
+	if tolerations == nil {
+		return nil
+	}
+	copied := make([]corev1.Toleration, len(tolerations))
+	for i := range tolerations {
+		tolerations[i].DeepCopyInto(&copied[i])
+	}
+	return copied
+}
+
+// taintsTolerated checks whether the pods of image pull jobs can be scheduled onto the node,
+// i.e. whether each NoSchedule and NoExecute taint of the node is tolerated.
+func taintsTolerated(node *corev1.Node, tolerations []corev1.Toleration) (*corev1.Taint, bool) {
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint, false
+		}
+	}
+	return nil, true
+}
+
+// setJobResources sets the resource requests and limits of all the containers of a job. The
+// per-imagecache override takes precedence over the controller-wide resources.
+func setJobResources(job *batchv1.Job, override *corev1.ResourceRequirements, resources corev1.ResourceRequirements) {
+	if override != nil {
+		resources = *override
+	}
+	podSpec := &job.Spec.Template.Spec
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].Resources = *resources.DeepCopy()
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Resources = *resources.DeepCopy()
+	}
+}
+
+// jobDeadlineSeconds returns the activeDeadlineSeconds of a job. The per-imagecache override
+// takes precedence over the controller-wide deadline, which in turn defaults to one hour.
+func jobDeadlineSeconds(override *metav1.Duration, deadline time.Duration) *int64 {
+	if override != nil && override.Duration > 0 {
+		deadline = override.Duration
+	}
+	if deadline <= 0 {
+		deadline = time.Hour
+	}
+	activeDeadlineSeconds := int64(deadline.Seconds())
+	return &activeDeadlineSeconds
+}
+
+// imagePullDeadline returns the maximum duration allowed for pulling the images of the image cache: its
+// imagePullDeadline if set, otherwise the controller-wide deadline
+func imagePullDeadline(imagecache *fledgedv1alpha3.ImageCache, deadline time.Duration) time.Duration {
+	if imagecache.Spec.ImagePullDeadline != nil {
+		return imagecache.Spec.ImagePullDeadline.Duration
+	}
+	return deadline
+}
+
+// boundPullJobDeadline shortens the activeDeadlineSeconds of an image pull job to the image pull deadline,
+// so that the job stops once its pull times out. The job controller then fails the job with reason
+// DeadlineExceeded, which is reported as PullTimedOut.
+func boundPullJobDeadline(job *batchv1.Job, imagecache *fledgedv1alpha3.ImageCache, deadline time.Duration) {
+	deadline = imagePullDeadline(imagecache, deadline)
+	if deadline <= 0 {
+		return
+	}
+	activeDeadlineSeconds := int64(math.Ceil(deadline.Seconds()))
+	if job.Spec.ActiveDeadlineSeconds == nil || activeDeadlineSeconds < *job.Spec.ActiveDeadlineSeconds {
+		job.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+}
+
+// criClientImage returns the cri client image of the delete jobs of the image cache on nodes of
+// the runtime. In order of precedence: the criClientImages of the image cache for the runtime,
+// the criClientImage of the image cache and finally the controller-wide cri client image.
+func criClientImage(imagecache *fledgedv1alpha3.ImageCache, runtime containerRuntime, dockerclientimage string) string {
+	if image := imagecache.Spec.CriClientImages[string(runtime)]; image != "" {
+		return image
+	}
+	if imagecache.Spec.CriClientImage != "" {
+		return imagecache.Spec.CriClientImage
+	}
+	return dockerclientimage
+}
+
+// newImageDeleteJob constructs a job manifest to delete an image from a node.
+// The image is deleted by the reference it was pulled with from its registry mirror, if any.
+// Container runtimes take no registry credentials to remove an image, so the images with image
+// pull secrets, whether of the image cache or of the image, are removed by the repo@digest name
+// listed for them in the node's status, which needs no access to the private registry. With
+// DeleteImagesByDigest, all the images are removed by that name, so that the image is removed
+// with all its tags.
+func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, imagePullSecrets []corev1.LocalObjectReference,
+	node *corev1.Node, containerRuntimeVersion string, dockerclientimage string, serviceAccountName string,
+	jobPriorityClassName string, criSocketPath string, jobOptions JobOptions) (*batchv1.Job, error) {
 	hostname := node.Labels["kubernetes.io/hostname"]
-	socketPath := criSocketPath
 	if imagecache == nil {
-		glog.Error("imagecache pointer is nil")
+		klog.Error("imagecache pointer is nil")
 		return nil, fmt.Errorf("imagecache pointer is nil")
 	}
+	// jobs are labelled with the image of the cache, not the one pulled from its mirror
+	cachedImage := image
+	image = RewriteImageRef(image, jobOptions.RegistryMirrors)
+	// Images in another containerd namespace are not listed in the node's status
+	private := len(MergeImagePullSecrets(imagecache.Spec.ImagePullSecrets, imagePullSecrets)) > 0
+	if (private || jobOptions.DeleteImagesByDigest) && imagecache.Spec.ContainerdNamespace == "" {
+		if digestRef, ok := localDigestRef(image, node); ok {
+			klog.V(4).Infof("Deleting image %s by its local digest %s from node %s", image, digestRef, hostname)
+			image = digestRef
+		}
+	}
+	// The delete command is built from the socket path resolved for the node
+	runtime := detectContainerRuntime(containerRuntimeVersion, jobOptions.ContainerRuntime)
+	socketPath := resolveCRISocketPath(node, runtime, containerRuntimeVersion, criSocketPath, jobOptions.KubernetesDistribution)
+
+	labels := jobLabels(imagecache, cachedImage)
 
-	labels := map[string]string{
-		"app":         "kubefledged",
-		"kubefledged": "kubefledged-image-manager",
-		"imagecache":  imagecache.Name,
-		"controller":  controllerAgentName,
+	if isWindowsNode(node) {
+		criClientImage := jobOptions.WindowsCRIClientImage
+		if criClientImage == "" {
+			criClientImage = DefaultWindowsCRIClientImage
+		}
+		job := windowsDeleteJob(imagecache, image, criClientImage, hostname, labels)
+		finishImageDeleteJob(job, imagecache, cachedImage, serviceAccountName, jobPriorityClassName, jobOptions)
+		return job, nil
 	}
 
+	job := criClientJob(imagecache, hostname, labels, criClientImage(imagecache, runtime, dockerclientimage),
+		buildDeleteCommand(runtime, socketPath, image, imagecache.Spec.ContainerdNamespace), socketPath)
+	job.Spec.Template.Spec.HostNetwork = imagecache.Spec.DeleteJobHostNetwork
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImageDeleteJob(job, imagecache, cachedImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// criClientJob constructs a job running the command of the client of the container runtime
+// talking to the runtime socket of the node
+func criClientJob(imagecache *fledgedv1alpha3.ImageCache, hostname string, labels map[string]string,
+	clientImage string, command []string, socketPath string) *batchv1.Job {
 	hostpathtype := corev1.HostPathSocket
-	backoffLimit := int32(0)
-	activeDeadlineSeconds := int64((time.Hour).Seconds())
 
-	job := &batchv1.Job{
+	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: imagecache.Name + "-",
 			Namespace:    imagecache.Namespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
-					Group:   fledgedv1alpha3.SchemeGroupVersion.Group,
-					Version: fledgedv1alpha3.SchemeGroupVersion.Version,
-					Kind:    "ImageCache",
-				}),
+				ownerReference(imagecache),
 			},
 			Labels: labels,
 		},
 		Spec: batchv1.JobSpec{
-			BackoffLimit:          &backoffLimit,
-			ActiveDeadlineSeconds: &activeDeadlineSeconds,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Namespace: imagecache.Namespace,
@@ -126,13 +391,17 @@ func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, nod
 					Containers: []corev1.Container{
 						{
 							Name:    "docker-cri-client",
-							Image:   dockerclientimage,
-							Command: []string{"/bin/bash"},
-							Args:    []string{"-c", "exec /usr/bin/docker image rm -f " + image + " > /dev/termination-log 2>&1"},
+							Image:   clientImage,
+							Command: command,
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "runtime-sock",
-									MountPath: "/var/run/docker.sock",
+									MountPath: socketPath,
+								},
+								// the root filesystem is read-only, so the cri clients get a writable /tmp
+								{
+									Name:      "tmp",
+									MountPath: "/tmp",
 								},
 							},
 							ImagePullPolicy: corev1.PullIfNotPresent,
@@ -143,67 +412,94 @@ func newImageDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, nod
 							Name: "runtime-sock",
 							VolumeSource: corev1.VolumeSource{
 								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/var/run/docker.sock",
+									Path: socketPath,
 									Type: &hostpathtype,
 								},
 							},
 						},
-					},
-					RestartPolicy:    corev1.RestartPolicyNever,
-					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
-					HostNetwork:      imageDeleteJobHostNetwork,
-					Tolerations: []corev1.Toleration{
 						{
-							Operator: corev1.TolerationOpExists,
+							Name: "tmp",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
 						},
 					},
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
 				},
 			},
 		},
 	}
-	if strings.Contains(containerRuntimeVersion, "containerd") {
-		if criSocketPath == "" {
-			socketPath = "/run/containerd/containerd.sock"
-		}
-		deleteCommand := "exec /usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " rmi " + image + " > /dev/termination-log 2>&1"
-		job.Spec.Template.Spec.Containers[0].Args = []string{"-c", deleteCommand}
-		job.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath = socketPath
-		job.Spec.Template.Spec.Volumes[0].VolumeSource.HostPath.Path = socketPath
-	}
-	if strings.Contains(containerRuntimeVersion, "crio") || strings.Contains(containerRuntimeVersion, "cri-o") {
-		if criSocketPath == "" {
-			socketPath = "/var/run/crio/crio.sock"
-		}
-		deleteCommand := "exec /usr/bin/crictl --runtime-endpoint=unix://" + socketPath + " --image-endpoint=unix://" + socketPath + " rmi " + image + " > /dev/termination-log 2>&1"
-		job.Spec.Template.Spec.Containers[0].Args = []string{"-c", deleteCommand}
-		job.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath = socketPath
-		job.Spec.Template.Spec.Volumes[0].VolumeSource.HostPath.Path = socketPath
-	}
-	if strings.Contains(containerRuntimeVersion, "docker") {
-		if criSocketPath == "" {
-			socketPath = "/var/run/docker.sock"
-		}
-		job.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath = socketPath
-		job.Spec.Template.Spec.Volumes[0].VolumeSource.HostPath.Path = socketPath
-	}
+}
+
+// finishImageDeleteJob applies the settings common to the image delete jobs of all nodes
+func finishImageDeleteJob(job *batchv1.Job, imagecache *fledgedv1alpha3.ImageCache, image string,
+	serviceAccountName string, jobPriorityClassName string, jobOptions JobOptions) {
 	if serviceAccountName != "" {
 		job.Spec.Template.Spec.ServiceAccountName = serviceAccountName
 	}
+	if imagecache.Spec.DeleteJobPriorityClassName != "" {
+		jobPriorityClassName = imagecache.Spec.DeleteJobPriorityClassName
+	}
 	if jobPriorityClassName != "" {
 		job.Spec.Template.Spec.PriorityClassName = jobPriorityClassName
 	}
-	return job, nil
+	backoffLimit := jobOptions.JobBackoffLimit
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.ActiveDeadlineSeconds = jobDeadlineSeconds(imagecache.Spec.ImageDeleteJobDeadline, jobOptions.ImageDeleteJobDeadline)
+	setJobResources(job, imagecache.Spec.JobResources, jobOptions.Resources)
+	setTerminationMessagePolicy(job)
+	setImageAnnotation(job, image)
+	setJobPodMetadata(job, imagecache.Spec.JobLabels, imagecache.Spec.JobAnnotations)
+	setJobNamespace(job, imagecache, jobOptions)
+	setJobPlacement(job, imagecache.Spec.NodeSelector, imagecache.Spec.Affinity)
+	setJobDNS(job, imagecache.Spec.JobDNSPolicy, imagecache.Spec.JobDNSConfig)
+	setJobProxyEnv(job, jobOptions)
+	job.Spec.Template.Spec.Tolerations = deleteJobTolerations(imagecache)
+	setJobRestartPolicy(job, jobOptions.DeleteJobRestartPolicy)
+	job.Spec.TTLSecondsAfterFinished = jobTTLSecondsAfterFinished(jobOptions.TTLSecondsAfterFinished)
 }
 
-func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *corev1.Node) (bool, error) {
+// latestAlwaysPull checks whether images tagged latest or untagged are always pulled under the
+// IfNotPresent image pull policy, unless disabled for the image cache or controller-wide
+func latestAlwaysPull(imagecache *fledgedv1alpha3.ImageCache, jobOptions JobOptions) bool {
+	return !imagecache.Spec.DisableLatestAlwaysPull && !jobOptions.DisableLatestAlwaysPull
+}
+
+// latestImage checks whether the image is tagged latest, explicitly or by having neither a tag nor a digest.
+// The reference is parsed, so that the port of a registry (e.g. registry:5000/nginx) is not taken for a tag.
+// Invalid references are not latest.
+func latestImage(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return false
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		return tagged.Tag() == "latest"
+	}
+	return true
+}
+
+// checkIfImageNeedsToBePulled decides whether a pull job is required for the image on the node.
+// The reference is normalized first, so that short and fully-qualified forms of the
+// same image (e.g. nginx and docker.io/library/nginx:latest) lead to the same decision.
+// The original reference is left untouched for use in the job itself. Images tagged latest
+// are pulled even if present on the node when latestAlwaysPull is set.
+func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *corev1.Node, latestAlwaysPull bool) (bool, error) {
 	if imagePullPolicy == string(corev1.PullIfNotPresent) {
-		if !strings.Contains(image, ":") && !strings.Contains(image, "@sha") {
+		imageRef, err := normalizeImageRef(image)
+		if err != nil {
+			// let the pull job report the invalid reference
+			klog.Warningf("Unable to normalize image reference %s: %v", image, err)
 			return true, nil
 		}
-		if strings.Contains(image, ":latest") {
+		if latestAlwaysPull && latestImage(imageRef) {
 			return true, nil
 		}
-		imageAlreadyPresent, err := imageAlreadyPresentInNode(image, node)
+		imageAlreadyPresent, err := imageAlreadyPresentInNode(imageRef, node)
 		if err != nil {
 			return false, err
 		}
@@ -214,13 +510,112 @@ func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *cor
 	return true, nil
 }
 
+// architectureSupported checks whether the image is built for the architecture of the node.
+// Images without architectures, and nodes not reporting their architecture, are not checked.
+func architectureSupported(architectures *[]string, node *corev1.Node) bool {
+	if architectures == nil || len(*architectures) == 0 || node.Status.NodeInfo.Architecture == "" {
+		return true
+	}
+	for _, arch := range *architectures {
+		if arch == node.Status.NodeInfo.Architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// imageAlreadyPresentInNode checks whether the image is listed in the node's status.
 func imageAlreadyPresentInNode(image string, node *corev1.Node) (bool, error) {
-	imagesByteSlice, err := json.Marshal(node.Status.Images)
+	nodeImage, err := findImageInNode(image, node)
 	if err != nil {
 		return false, err
 	}
-	if strings.Contains(string(imagesByteSlice), image) {
-		return true, nil
+	return nodeImage != nil, nil
+}
+
+// ImageSizeInNode returns the size in bytes of the image as listed in the node's status.
+// It returns false if the image is not (yet) listed in the node's status.
+func ImageSizeInNode(image string, node *corev1.Node) (int64, bool) {
+	nodeImage, err := findImageInNode(image, node)
+	if err != nil || nodeImage == nil {
+		return 0, false
+	}
+	return nodeImage.SizeBytes, true
+}
+
+// findImageInNode returns the entry of the node's status that lists the image, or nil.
+// The reference is compared against every name reported for each image on the node
+// (including the repo@digest names), after both are normalized to their fully-qualified form.
+func findImageInNode(image string, node *corev1.Node) (*corev1.ContainerImage, error) {
+	imageRef, err := normalizeImageRef(image)
+	if err != nil {
+		return nil, err
+	}
+	for i := range node.Status.Images {
+		for _, name := range node.Status.Images[i].Names {
+			nodeImageRef, err := normalizeImageRef(name)
+			if err != nil {
+				// runtimes may report names such as "<none>@<none>", skip them
+				continue
+			}
+			if nodeImageRef == imageRef {
+				return &node.Status.Images[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// localDigestRef returns the repo@digest name under which the node lists the image.
+// It returns false if the node does not list the image, or lists no digest name for it.
+func localDigestRef(image string, node *corev1.Node) (string, bool) {
+	nodeImage, err := findImageInNode(image, node)
+	if err != nil || nodeImage == nil {
+		return "", false
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+	for _, name := range nodeImage.Names {
+		nodeRef, err := reference.ParseNormalizedNamed(name)
+		if err != nil {
+			continue
+		}
+		if _, ok := nodeRef.(reference.Canonical); ok && nodeRef.Name() == named.Name() {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// normalizeImageRef expands an image reference to its fully-qualified form
+// e.g. nginx --> docker.io/library/nginx:latest. Digest references are never
+// given a default tag, so that they keep matching the repo@digest names of a node.
+func normalizeImageRef(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return reference.TrimNamed(named).String() + "@" + canonical.Digest().String(), nil
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// SameImage checks whether two image references name the same image e.g. nginx
+// and docker.io/library/nginx:latest. References that do not parse are compared as is.
+func SameImage(a, b string) bool {
+	if a == b {
+		return true
+	}
+	na, err := normalizeImageRef(a)
+	if err != nil {
+		return false
+	}
+	nb, err := normalizeImageRef(b)
+	if err != nil {
+		return false
 	}
-	return false, nil
+	return na == nb
 }
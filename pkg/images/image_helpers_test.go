@@ -0,0 +1,1442 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testDigest = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+func TestImageAlreadyPresentInNode(t *testing.T) {
+	testnode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "bar"},
+		},
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{
+					Names: []string{"docker.io/library/myredis-sidecar:latest"},
+				},
+				{
+					Names: []string{
+						"docker.io/library/nginx@" + testDigest,
+						"docker.io/library/nginx:1.190",
+					},
+				},
+				{
+					Names: []string{"registry.example.com:5000/team/app:2.0"},
+				},
+				{
+					Names: []string{"<none>@<none>", "<none>:<none>"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name            string
+		image           string
+		expectedPresent bool
+		expectError     bool
+	}{
+		{
+			name:            "#1: Name is a substring of another image",
+			image:           "redis",
+			expectedPresent: false,
+		},
+		{
+			name:            "#2: Tag is a prefix of another tag",
+			image:           "nginx:1.19",
+			expectedPresent: false,
+		},
+		{
+			name:            "#3: Exact tag match (short form)",
+			image:           "nginx:1.190",
+			expectedPresent: true,
+		},
+		{
+			name:            "#4: Exact tag match (fully-qualified form)",
+			image:           "docker.io/library/nginx:1.190",
+			expectedPresent: true,
+		},
+		{
+			name:            "#5: Digest match",
+			image:           "nginx@" + testDigest,
+			expectedPresent: true,
+		},
+		{
+			name:            "#6: Tag and digest match",
+			image:           "nginx:1.25@" + testDigest,
+			expectedPresent: true,
+		},
+		{
+			name:            "#7: Digest mismatch",
+			image:           "nginx@sha256:1d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+			expectedPresent: false,
+		},
+		{
+			name:            "#8: Registry with port",
+			image:           "registry.example.com:5000/team/app:2.0",
+			expectedPresent: true,
+		},
+		{
+			name:            "#9: Same repository in a different registry",
+			image:           "quay.io/team/app:2.0",
+			expectedPresent: false,
+		},
+		{
+			name:        "#10: Invalid image reference",
+			image:       "nginx::",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		present, err := imageAlreadyPresentInNode(test.image, &testnode)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if present != test.expectedPresent {
+			t.Errorf("Test: %s failed: expectedPresent=%t, actualPresent=%t", test.name, test.expectedPresent, present)
+		}
+	}
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       string
+		expectedRef string
+		expectError bool
+	}{
+		{
+			name:        "#1: Bare name",
+			image:       "nginx",
+			expectedRef: "docker.io/library/nginx:latest",
+		},
+		{
+			name:        "#2: Bare name with tag",
+			image:       "nginx:1.25",
+			expectedRef: "docker.io/library/nginx:1.25",
+		},
+		{
+			name:        "#3: Docker hub user repository",
+			image:       "senthilrch/busybox",
+			expectedRef: "docker.io/senthilrch/busybox:latest",
+		},
+		{
+			name:        "#4: Fully-qualified reference is unchanged",
+			image:       "docker.io/library/nginx:latest",
+			expectedRef: "docker.io/library/nginx:latest",
+		},
+		{
+			name:        "#5: Registry with port and no tag",
+			image:       "registry.example.com:5000/nginx",
+			expectedRef: "registry.example.com:5000/nginx:latest",
+		},
+		{
+			name:        "#6: Registry with port and tag",
+			image:       "localhost:5000/team/nginx:1.0",
+			expectedRef: "localhost:5000/team/nginx:1.0",
+		},
+		{
+			name:        "#7: Digest reference gets no tag",
+			image:       "docker.io/library/nginx@" + testDigest,
+			expectedRef: "docker.io/library/nginx@" + testDigest,
+		},
+		{
+			name:        "#8: Digest reference with registry port",
+			image:       "registry.example.com:5000/nginx@" + testDigest,
+			expectedRef: "registry.example.com:5000/nginx@" + testDigest,
+		},
+		{
+			name:        "#9: Invalid reference",
+			image:       "my registry/img",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		ref, err := normalizeImageRef(test.image)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if ref != test.expectedRef {
+			t.Errorf("Test: %s failed: expectedRef=%s, actualRef=%s", test.name, test.expectedRef, ref)
+		}
+	}
+}
+
+func TestSameImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected bool
+	}{
+		{"#1: Identical references", "nginx:1.25", "nginx:1.25", true},
+		{"#2: Bare name and canonical reference", "nginx", "docker.io/library/nginx:latest", true},
+		{"#3: Different tags", "nginx:1.24", "nginx:1.25", false},
+		{"#4: Digest reference and tag", "nginx@" + testDigest, "nginx:latest", false},
+		{"#5: Short and canonical digest references", "nginx@" + testDigest, "docker.io/library/nginx@" + testDigest, true},
+		{"#6: Invalid reference", "my registry/img", "docker.io/library/img:latest", false},
+	}
+	for _, test := range tests {
+		if actual := SameImage(test.a, test.b); actual != test.expected {
+			t.Errorf("Test: %s failed: expected=%t, actual=%t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestCheckIfImageNeedsToBePulled(t *testing.T) {
+	testnode := corev1.Node{
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{
+					Names: []string{
+						"docker.io/library/nginx@" + testDigest,
+						"docker.io/library/nginx:1.25",
+					},
+				},
+				{
+					Names: []string{"localhost:5000/app:1.0"},
+				},
+				{
+					Names: []string{
+						"registry:5000/img@" + testDigest,
+						"registry:5000/img:1.0",
+					},
+				},
+				{
+					Names: []string{"docker.io/library/busybox:latest"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name                    string
+		imagePullPolicy         string
+		image                   string
+		disableLatestAlwaysPull bool
+		expectedPull            bool
+	}{
+		{
+			name:            "#1: Short form of a present image",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx:1.25",
+			expectedPull:    false,
+		},
+		{
+			name:            "#2: Bare name is always pulled",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx",
+			expectedPull:    true,
+		},
+		{
+			name:            "#3: Explicit latest tag is always pulled",
+			imagePullPolicy: "IfNotPresent",
+			image:           "docker.io/library/nginx:latest",
+			expectedPull:    true,
+		},
+		{
+			name:            "#4: Present digest reference",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx@" + testDigest,
+			expectedPull:    false,
+		},
+		{
+			name:            "#5: Present image in a registry with port",
+			imagePullPolicy: "IfNotPresent",
+			image:           "localhost:5000/app:1.0",
+			expectedPull:    false,
+		},
+		{
+			name:            "#6: Missing image",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx:1.19",
+			expectedPull:    true,
+		},
+		{
+			name:            "#7: Policy Always",
+			imagePullPolicy: "Always",
+			image:           "nginx:1.25",
+			expectedPull:    true,
+		},
+		{
+			name:            "#8: Invalid reference is left to the pull job",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx::",
+			expectedPull:    true,
+		},
+		{
+			name:            "#9: Present latest image is pulled again",
+			imagePullPolicy: "IfNotPresent",
+			image:           "busybox:latest",
+			expectedPull:    true,
+		},
+		{
+			name:                    "#10: Present latest image with latest always pull disabled",
+			imagePullPolicy:         "IfNotPresent",
+			image:                   "busybox:latest",
+			disableLatestAlwaysPull: true,
+			expectedPull:            false,
+		},
+		{
+			name:                    "#11: Present bare name with latest always pull disabled",
+			imagePullPolicy:         "IfNotPresent",
+			image:                   "busybox",
+			disableLatestAlwaysPull: true,
+			expectedPull:            false,
+		},
+		{
+			name:                    "#12: Missing latest image with latest always pull disabled",
+			imagePullPolicy:         "IfNotPresent",
+			image:                   "nginx",
+			disableLatestAlwaysPull: true,
+			expectedPull:            true,
+		},
+		{
+			name:            "#13: Port of the registry is not taken for a tag",
+			imagePullPolicy: "IfNotPresent",
+			image:           "registry:5000/img",
+			expectedPull:    true,
+		},
+		{
+			name:            "#14: Present tagged image in a registry with port",
+			imagePullPolicy: "IfNotPresent",
+			image:           "registry:5000/img:1.0",
+			expectedPull:    false,
+		},
+		{
+			name:            "#15: Present digest reference in a registry with port",
+			imagePullPolicy: "IfNotPresent",
+			image:           "registry:5000/img@" + testDigest,
+			expectedPull:    false,
+		},
+	}
+	for _, test := range tests {
+		pull, err := checkIfImageNeedsToBePulled(test.imagePullPolicy, test.image, &testnode, !test.disableLatestAlwaysPull)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if pull != test.expectedPull {
+			t.Errorf("Test: %s failed: expectedPull=%t, actualPull=%t", test.name, test.expectedPull, pull)
+		}
+	}
+}
+
+func TestNewImagePullJobImagePullPolicy(t *testing.T) {
+	tests := []struct {
+		name                    string
+		image                   string
+		imagePullPolicy         string
+		imagePullPolicyOverride corev1.PullPolicy
+		specDisable             bool
+		controllerDisable       bool
+		expectedPullPolicy      corev1.PullPolicy
+	}{
+		{
+			name:               "#1: Controller-wide IfNotPresent",
+			image:              "nginx:1.25",
+			imagePullPolicy:    "IfNotPresent",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "#2: Controller-wide IfNotPresent promoted to Always for latest image",
+			image:              "nginx:latest",
+			imagePullPolicy:    "IfNotPresent",
+			expectedPullPolicy: corev1.PullAlways,
+		},
+		{
+			name:               "#3: Controller-wide Always",
+			image:              "nginx:1.25",
+			imagePullPolicy:    "Always",
+			expectedPullPolicy: corev1.PullAlways,
+		},
+		{
+			name:                    "#4: Per-image Always overrides controller-wide IfNotPresent",
+			image:                   "nginx:1.25",
+			imagePullPolicy:         "IfNotPresent",
+			imagePullPolicyOverride: corev1.PullAlways,
+			expectedPullPolicy:      corev1.PullAlways,
+		},
+		{
+			name:                    "#5: Per-image IfNotPresent overrides controller-wide Always",
+			image:                   "nginx:1.25",
+			imagePullPolicy:         "Always",
+			imagePullPolicyOverride: corev1.PullIfNotPresent,
+			expectedPullPolicy:      corev1.PullIfNotPresent,
+		},
+		{
+			name:                    "#6: Per-image IfNotPresent is not promoted for latest image",
+			image:                   "nginx:latest",
+			imagePullPolicy:         "IfNotPresent",
+			imagePullPolicyOverride: corev1.PullIfNotPresent,
+			expectedPullPolicy:      corev1.PullIfNotPresent,
+		},
+		{
+			name:               "#7: Latest image not promoted when disabled for the image cache",
+			image:              "nginx:latest",
+			imagePullPolicy:    "IfNotPresent",
+			specDisable:        true,
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "#8: Untagged image not promoted when disabled controller-wide",
+			image:              "nginx",
+			imagePullPolicy:    "IfNotPresent",
+			controllerDisable:  true,
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "#9: Controller-wide Always is kept when promotion is disabled",
+			image:              "nginx:latest",
+			imagePullPolicy:    "Always",
+			specDisable:        true,
+			expectedPullPolicy: corev1.PullAlways,
+		},
+		{
+			name:               "#10: Untagged image in a registry with port promoted to Always",
+			image:              "registry:5000/img",
+			imagePullPolicy:    "IfNotPresent",
+			expectedPullPolicy: corev1.PullAlways,
+		},
+		{
+			name:               "#11: Tagged image in a registry with port",
+			image:              "registry:5000/img:1.0",
+			imagePullPolicy:    "IfNotPresent",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "#12: Digest reference in a registry with port",
+			image:              "registry:5000/img@" + testDigest,
+			imagePullPolicy:    "IfNotPresent",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{DisableLatestAlwaysPull: test.specDisable},
+		}
+		job, err := newImagePullJob(imagecache, test.image, false, nil, nil, &node, test.imagePullPolicy,
+			test.imagePullPolicyOverride, "busybox:1.35.0", "", "", JobOptions{DisableLatestAlwaysPull: test.controllerDisable})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		pullPolicy := job.Spec.Template.Spec.Containers[0].ImagePullPolicy
+		if pullPolicy != test.expectedPullPolicy {
+			t.Errorf("Test: %s failed: expectedPullPolicy=%s, actualPullPolicy=%s", test.name, test.expectedPullPolicy, pullPolicy)
+		}
+	}
+}
+
+func TestNewImagePullJobCachePaths(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name               string
+		image              string
+		forceFullCache     bool
+		cachePaths         []string
+		jobOptions         JobOptions
+		expectDirCacheJob  bool
+		expectedCachePaths []string
+	}{
+		{
+			name:              "#1: No cache paths",
+			image:             "nginx:1.25",
+			expectDirCacheJob: false,
+		},
+		{
+			name:               "#2: Cache paths set",
+			image:              "nginx:1.25",
+			cachePaths:         []string{"/usr/share/nginx/", "/etc/nginx/"},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/usr/share/nginx/", "/etc/nginx/"},
+		},
+		{
+			name:              "#3: modelzai image without cache paths",
+			image:             "modelzai/llm:1.0",
+			expectDirCacheJob: false,
+		},
+		{
+			name:               "#4: modelzai image with legacy modelz dir cache enabled",
+			image:              "modelzai/llm:1.0",
+			jobOptions:         JobOptions{LegacyModelzDirCache: true},
+			expectDirCacheJob:  true,
+			expectedCachePaths: legacyModelzCachePaths,
+		},
+		{
+			name:               "#5: Cache paths take precedence over legacy modelz dir cache",
+			image:              "modelzai/llm:1.0",
+			cachePaths:         []string{"/models/"},
+			jobOptions:         JobOptions{LegacyModelzDirCache: true},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/models/"},
+		},
+		{
+			name:               "#6: Force full cache takes precedence over cache paths",
+			image:              "nginx:1.25",
+			forceFullCache:     true,
+			cachePaths:         []string{"/usr/share/nginx/"},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/"},
+		},
+		{
+			name:               "#7: Force full cache of the image without the controller-wide force full cache",
+			image:              "nginx:1.25",
+			forceFullCache:     true,
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/"},
+		},
+		{
+			name:               "#8: Force full cache of the image with the controller-wide force full cache",
+			image:              "nginx:1.25",
+			forceFullCache:     true,
+			jobOptions:         JobOptions{ForceFullCache: true},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/"},
+		},
+		{
+			name:               "#9: Controller-wide force full cache",
+			image:              "nginx:1.25",
+			jobOptions:         JobOptions{ForceFullCache: true},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/"},
+		},
+		{
+			name:               "#10: Cache paths of the image take precedence over the controller-wide force full cache",
+			image:              "nginx:1.25",
+			cachePaths:         []string{"/usr/share/nginx/"},
+			jobOptions:         JobOptions{ForceFullCache: true},
+			expectDirCacheJob:  true,
+			expectedCachePaths: []string{"/usr/share/nginx/"},
+		},
+	}
+	for _, test := range tests {
+		job, err := newImagePullJob(imagecache, test.image, test.forceFullCache, test.cachePaths, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		// commonJob copies the echo binary using a busybox init container, dirCacheJob does not
+		isDirCacheJob := len(job.Spec.Template.Spec.InitContainers) == 0
+		if isDirCacheJob != test.expectDirCacheJob {
+			t.Errorf("Test: %s failed: expectedDirCacheJob=%t, actualDirCacheJob=%t", test.name, test.expectDirCacheJob, isDirCacheJob)
+			continue
+		}
+		if test.expectDirCacheJob {
+			command := job.Spec.Template.Spec.Containers[0].Command[2]
+			if !strings.HasPrefix(command, findCacheFilesCommand(test.expectedCachePaths)+" | ") {
+				t.Errorf("Test: %s failed: expectedCachePaths=%v, actualCommand=%s", test.name, test.expectedCachePaths, command)
+			}
+		}
+	}
+}
+
+func TestNewImagePullJobBusyboxImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		busyboxImage  string
+		expectedImage string
+	}{
+		{"#1: Controller-wide busybox image", "", "busybox:1.35.0"},
+		{"#2: Busybox image of the image cache", "registry.internal/mirror/busybox:1.35.0", "registry.internal/mirror/busybox:1.35.0"},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{BusyboxImage: test.busyboxImage},
+		}
+		job, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		initContainers := job.Spec.Template.Spec.InitContainers
+		if len(initContainers) != 1 || initContainers[0].Image != test.expectedImage {
+			t.Errorf("Test: %s failed: expectedBusyboxImage=%s, actualInitContainers=%+v", test.name, test.expectedImage, initContainers)
+		}
+	}
+}
+
+func TestNewImagePullJobInvalidCachePaths(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	_, err := newImagePullJob(imagecache, "nginx:1.25", false, []string{"/usr/share/nginx/", "etc/nginx"}, nil, &node,
+		"IfNotPresent", "", "busybox:1.35.0", "", "", JobOptions{})
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid cache path for image nginx:1.25") {
+		t.Errorf("Test failed: expectedError=invalid cache path for image nginx:1.25, actualError=%v", err)
+	}
+}
+
+func TestJobDeadlines(t *testing.T) {
+	tests := []struct {
+		name                   string
+		jobOptions             JobOptions
+		pullJobDeadline        *metav1.Duration
+		deleteJobDeadline      *metav1.Duration
+		expectedPullDeadline   int64
+		expectedDeleteDeadline int64
+	}{
+		{
+			name:                   "#1: Default deadline of one hour",
+			expectedPullDeadline:   3600,
+			expectedDeleteDeadline: 3600,
+		},
+		{
+			name:                   "#2: Controller-wide deadlines",
+			jobOptions:             JobOptions{ImagePullJobDeadline: 2 * time.Hour, ImageDeleteJobDeadline: 5 * time.Minute},
+			expectedPullDeadline:   7200,
+			expectedDeleteDeadline: 300,
+		},
+		{
+			name:                   "#3: Per-imagecache deadlines override controller-wide deadlines",
+			jobOptions:             JobOptions{ImagePullJobDeadline: 2 * time.Hour, ImageDeleteJobDeadline: 5 * time.Minute},
+			pullJobDeadline:        &metav1.Duration{Duration: 3 * time.Hour},
+			deleteJobDeadline:      &metav1.Duration{Duration: 90 * time.Second},
+			expectedPullDeadline:   10800,
+			expectedDeleteDeadline: 90,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ImagePullJobDeadline:   test.pullJobDeadline,
+				ImageDeleteJobDeadline: test.deleteJobDeadline,
+			},
+		}
+		for _, cachePaths := range [][]string{nil, {"/opt/conda/lib/"}} {
+			pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, cachePaths, nil, &node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", test.jobOptions)
+			if err != nil {
+				t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+			if *pullJob.Spec.ActiveDeadlineSeconds != test.expectedPullDeadline {
+				t.Errorf("Test: %s failed: expectedPullDeadline=%d, actualPullDeadline=%d", test.name, test.expectedPullDeadline, *pullJob.Spec.ActiveDeadlineSeconds)
+			}
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if *deleteJob.Spec.ActiveDeadlineSeconds != test.expectedDeleteDeadline {
+			t.Errorf("Test: %s failed: expectedDeleteDeadline=%d, actualDeleteDeadline=%d", test.name, test.expectedDeleteDeadline, *deleteJob.Spec.ActiveDeadlineSeconds)
+		}
+	}
+}
+
+func TestPullJobImagePullDeadline(t *testing.T) {
+	tests := []struct {
+		name                 string
+		imagePullDeadline    time.Duration
+		cacheDeadline        *metav1.Duration
+		pullJobDeadline      time.Duration
+		expectedPullDeadline int64
+	}{
+		{
+			name:                 "#1: No image pull deadline",
+			expectedPullDeadline: 3600,
+		},
+		{
+			name:                 "#2: Controller-wide image pull deadline bounds the pull job deadline",
+			imagePullDeadline:    5 * time.Minute,
+			expectedPullDeadline: 300,
+		},
+		{
+			name:                 "#3: Image pull deadline of the image cache bounds the pull job deadline",
+			imagePullDeadline:    5 * time.Minute,
+			cacheDeadline:        &metav1.Duration{Duration: 15 * time.Minute},
+			expectedPullDeadline: 900,
+		},
+		{
+			name:                 "#4: Shorter pull job deadline is kept",
+			imagePullDeadline:    2 * time.Hour,
+			pullJobDeadline:      10 * time.Minute,
+			expectedPullDeadline: 600,
+		},
+		{
+			name:                 "#5: Image pull deadline is rounded up to a second",
+			imagePullDeadline:    10 * time.Millisecond,
+			expectedPullDeadline: 1,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{ImagePullDeadline: test.cacheDeadline},
+		}
+		builder := NewImageJobBuilder(ImageJobBuilderOptions{
+			CriClientImage:    "cri-client:latest",
+			BusyboxImage:      "busybox:1.35.0",
+			ImagePullPolicy:   "IfNotPresent",
+			ImagePullDeadline: test.imagePullDeadline,
+			JobOptions:        JobOptions{ImagePullJobDeadline: test.pullJobDeadline},
+		})
+		pullJob, err := builder.PullJob(ImageWorkRequest{Image: "nginx:1.25", Node: &node, Imagecache: imagecache})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if *pullJob.Spec.ActiveDeadlineSeconds != test.expectedPullDeadline {
+			t.Errorf("Test: %s failed: expectedPullDeadline=%d, actualPullDeadline=%d", test.name, test.expectedPullDeadline, *pullJob.Spec.ActiveDeadlineSeconds)
+		}
+	}
+}
+
+func TestJobBackoffLimit(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	for _, backoffLimit := range []int32{0, 3} {
+		jobOptions := JobOptions{JobBackoffLimit: backoffLimit}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: backoffLimit=%d failed. expectedError=nil, actualError=%s", backoffLimit, err.Error())
+			continue
+		}
+		if *pullJob.Spec.BackoffLimit != backoffLimit {
+			t.Errorf("Test: backoffLimit=%d failed: expectedPullBackoffLimit=%d, actualPullBackoffLimit=%d", backoffLimit, backoffLimit, *pullJob.Spec.BackoffLimit)
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: backoffLimit=%d failed. expectedError=nil, actualError=%s", backoffLimit, err.Error())
+			continue
+		}
+		if *deleteJob.Spec.BackoffLimit != backoffLimit {
+			t.Errorf("Test: backoffLimit=%d failed: expectedDeleteBackoffLimit=%d, actualDeleteBackoffLimit=%d", backoffLimit, backoffLimit, *deleteJob.Spec.BackoffLimit)
+		}
+	}
+}
+
+func TestJobResources(t *testing.T) {
+	jobOptions := JobOptions{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+		},
+	}
+	override := &corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+	tests := []struct {
+		name              string
+		override          *corev1.ResourceRequirements
+		forceFullCache    bool
+		cachePaths        []string
+		expectedResources corev1.ResourceRequirements
+	}{
+		{
+			name:              "#1: Common job",
+			expectedResources: jobOptions.Resources,
+		},
+		{
+			name:              "#2: Directory cache job",
+			cachePaths:        []string{"/opt/conda/lib/"},
+			expectedResources: jobOptions.Resources,
+		},
+		{
+			name:              "#3: Full cache job",
+			forceFullCache:    true,
+			expectedResources: jobOptions.Resources,
+		},
+		{
+			name:              "#4: Per-imagecache resources override controller-wide resources",
+			override:          override,
+			expectedResources: *override,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				JobResources: test.override,
+			},
+		}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", test.forceFullCache, test.cachePaths, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for _, job := range []*batchv1.Job{pullJob, deleteJob} {
+			containers := append(job.Spec.Template.Spec.InitContainers, job.Spec.Template.Spec.Containers...)
+			for _, container := range containers {
+				if !reflect.DeepEqual(container.Resources, test.expectedResources) {
+					t.Errorf("Test: %s failed: container=%s, expectedResources=%+v, actualResources=%+v",
+						test.name, container.Name, test.expectedResources, container.Resources)
+				}
+			}
+		}
+	}
+}
+
+func TestJobTTLSecondsAfterFinished(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name        string
+		ttl         int32
+		expectedTTL *int32
+	}{
+		{
+			name:        "#1: TTL is set",
+			ttl:         300,
+			expectedTTL: func() *int32 { ttl := int32(300); return &ttl }(),
+		},
+		{
+			name:        "#2: Zero disables TTL",
+			ttl:         0,
+			expectedTTL: nil,
+		},
+	}
+	for _, test := range tests {
+		jobOptions := JobOptions{TTLSecondsAfterFinished: test.ttl}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for _, job := range []*batchv1.Job{pullJob, deleteJob} {
+			if !reflect.DeepEqual(job.Spec.TTLSecondsAfterFinished, test.expectedTTL) {
+				t.Errorf("Test: %s failed: expectedTTL=%v, actualTTL=%v", test.name, test.expectedTTL, job.Spec.TTLSecondsAfterFinished)
+			}
+		}
+	}
+}
+
+func TestJobPriorityClassName(t *testing.T) {
+	tests := []struct {
+		name                       string
+		jobPriorityClassName       string
+		pullJobPriorityClassName   string
+		deleteJobPriorityClassName string
+		expectedPull               string
+		expectedDelete             string
+	}{
+		{
+			name: "#1: No priority class",
+		},
+		{
+			name:                 "#2: Controller-wide priority class for both jobs",
+			jobPriorityClassName: "priority-class-kube-fledged",
+			expectedPull:         "priority-class-kube-fledged",
+			expectedDelete:       "priority-class-kube-fledged",
+		},
+		{
+			name:                       "#3: Pull and delete priority classes of the image cache",
+			jobPriorityClassName:       "priority-class-kube-fledged",
+			pullJobPriorityClassName:   "high-priority",
+			deleteJobPriorityClassName: "low-priority",
+			expectedPull:               "high-priority",
+			expectedDelete:             "low-priority",
+		},
+		{
+			name:                     "#4: Pull priority class only, delete jobs fall back to the controller-wide one",
+			jobPriorityClassName:     "priority-class-kube-fledged",
+			pullJobPriorityClassName: "high-priority",
+			expectedPull:             "high-priority",
+			expectedDelete:           "priority-class-kube-fledged",
+		},
+		{
+			name:                       "#5: Delete priority class only, without a controller-wide one",
+			deleteJobPriorityClassName: "low-priority",
+			expectedDelete:             "low-priority",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				PullJobPriorityClassName:   test.pullJobPriorityClassName,
+				DeleteJobPriorityClassName: test.deleteJobPriorityClassName,
+			},
+		}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", test.jobPriorityClassName, JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", test.jobPriorityClassName, "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if pullJob.Spec.Template.Spec.PriorityClassName != test.expectedPull || deleteJob.Spec.Template.Spec.PriorityClassName != test.expectedDelete {
+			t.Errorf("Test: %s failed: expectedPullPriorityClassName=%s, expectedDeletePriorityClassName=%s, actualPullPriorityClassName=%s, actualDeletePriorityClassName=%s",
+				test.name, test.expectedPull, test.expectedDelete, pullJob.Spec.Template.Spec.PriorityClassName, deleteJob.Spec.Template.Spec.PriorityClassName)
+		}
+	}
+}
+
+func TestJobPlacement(t *testing.T) {
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.NodeSelectorOpDoesNotExist},
+					}},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name                 string
+		nodeSelector         map[string]string
+		affinity             *corev1.Affinity
+		expectedNodeSelector map[string]string
+		expectedAffinity     *corev1.Affinity
+	}{
+		{
+			name:                 "#1: Job pinned to its node",
+			expectedNodeSelector: map[string]string{"kubernetes.io/hostname": "bar"},
+		},
+		{
+			name:                 "#2: Node selector of the image cache is added to the hostname",
+			nodeSelector:         map[string]string{"accelerator": "nvidia"},
+			expectedNodeSelector: map[string]string{"kubernetes.io/hostname": "bar", "accelerator": "nvidia"},
+		},
+		{
+			name:                 "#3: Node selector of the image cache does not override the hostname",
+			nodeSelector:         map[string]string{"kubernetes.io/hostname": "foo"},
+			expectedNodeSelector: map[string]string{"kubernetes.io/hostname": "bar"},
+		},
+		{
+			name:                 "#4: Affinity of the image cache",
+			affinity:             affinity,
+			expectedNodeSelector: map[string]string{"kubernetes.io/hostname": "bar"},
+			expectedAffinity:     affinity,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				NodeSelector: test.nodeSelector,
+				Affinity:     test.affinity,
+			},
+		}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for _, job := range []*batchv1.Job{pullJob, deleteJob} {
+			podSpec := job.Spec.Template.Spec
+			if !reflect.DeepEqual(podSpec.NodeSelector, test.expectedNodeSelector) {
+				t.Errorf("Test: %s failed: job=%s, expectedNodeSelector=%v, actualNodeSelector=%v",
+					test.name, job.GenerateName, test.expectedNodeSelector, podSpec.NodeSelector)
+			}
+			if !reflect.DeepEqual(podSpec.Affinity, test.expectedAffinity) {
+				t.Errorf("Test: %s failed: job=%s, expectedAffinity=%+v, actualAffinity=%+v",
+					test.name, job.GenerateName, test.expectedAffinity, podSpec.Affinity)
+			}
+		}
+	}
+}
+
+func TestDeleteJobHostNetwork(t *testing.T) {
+	tests := []struct {
+		name                 string
+		deleteJobHostNetwork bool
+	}{
+		{"#1: Delete job runs without host networking by default", false},
+		{"#2: Delete job runs with host networking when enabled for the image cache", true},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{DeleteJobHostNetwork: test.deleteJobHostNetwork},
+		}
+		job, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if podSpec.HostNetwork != test.deleteJobHostNetwork {
+			t.Errorf("Test: %s failed: expectedHostNetwork=%t, actualHostNetwork=%t", test.name, test.deleteJobHostNetwork, podSpec.HostNetwork)
+		}
+		// the runtime socket is mounted from the node either way
+		if podSpec.Volumes[0].HostPath == nil || podSpec.Volumes[0].HostPath.Path != containerdSocketPath ||
+			podSpec.Containers[0].VolumeMounts[0].MountPath != containerdSocketPath {
+			t.Errorf("Test: %s failed: expectedSocketPath=%s, actualVolumes=%+v", test.name, containerdSocketPath, podSpec.Volumes)
+		}
+	}
+}
+
+func TestJobDNS(t *testing.T) {
+	dnsConfig := &corev1.PodDNSConfig{
+		Nameservers: []string{"10.0.0.53"},
+		Searches:    []string{"corp.internal"},
+	}
+	windowsNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "win1",
+			Labels: map[string]string{"kubernetes.io/hostname": "win1", "kubernetes.io/os": "windows"},
+		},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "windows"}},
+	}
+	tests := []struct {
+		name              string
+		dnsPolicy         corev1.DNSPolicy
+		dnsConfig         *corev1.PodDNSConfig
+		expectedDNSPolicy corev1.DNSPolicy
+		expectedDNSConfig *corev1.PodDNSConfig
+	}{
+		{
+			name: "#1: Default DNS of the cluster",
+		},
+		{
+			name:              "#2: Internal resolver only",
+			dnsPolicy:         corev1.DNSNone,
+			dnsConfig:         dnsConfig,
+			expectedDNSPolicy: corev1.DNSNone,
+			expectedDNSConfig: dnsConfig,
+		},
+		{
+			name:              "#3: Search domains added to the DNS of the cluster",
+			dnsConfig:         dnsConfig,
+			expectedDNSConfig: dnsConfig,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{JobDNSPolicy: test.dnsPolicy, JobDNSConfig: test.dnsConfig},
+		}
+		jobs := map[string]*batchv1.Job{}
+		var err error
+		if jobs["pull job"], err = newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if jobs["directory cache job"], err = newImagePullJob(imagecache, "nginx:1.25", false, []string{"/etc/nginx"}, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if jobs["full cache job"], err = newImagePullJob(imagecache, "nginx:1.25", true, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if jobs["windows pull job"], err = newImagePullJob(imagecache, "mcr.microsoft.com/windows/servercore:ltsc2022", false, nil, nil,
+			windowsNode, "IfNotPresent", "", "busybox:1.35.0", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if jobs["delete job"], err = newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if jobs["windows delete job"], err = newImageDeleteJob(imagecache, "mcr.microsoft.com/windows/servercore:ltsc2022", nil, windowsNode,
+			"containerd://1.6.8", "cri-client:latest", "", "", "", JobOptions{}); err != nil {
+			t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		for name, job := range jobs {
+			podSpec := job.Spec.Template.Spec
+			if podSpec.DNSPolicy != test.expectedDNSPolicy || !reflect.DeepEqual(podSpec.DNSConfig, test.expectedDNSConfig) {
+				t.Errorf("Test: %s failed: job=%s, expectedDNSPolicy=%s, expectedDNSConfig=%+v, actualDNSPolicy=%s, actualDNSConfig=%+v",
+					test.name, name, test.expectedDNSPolicy, test.expectedDNSConfig, podSpec.DNSPolicy, podSpec.DNSConfig)
+			}
+		}
+	}
+}
+
+func TestJobTolerations(t *testing.T) {
+	tolerateAll := []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	gpuToleration := []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+	unschedulableToleration := corev1.Toleration{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name                      string
+		tolerations               []corev1.Toleration
+		cacheOnUnschedulableNodes bool
+		expectedPullTolerations   []corev1.Toleration
+		expectedDeleteTolerations []corev1.Toleration
+	}{
+		{
+			name:                      "#1: Default tolerations",
+			expectedPullTolerations:   nil,
+			expectedDeleteTolerations: tolerateAll,
+		},
+		{
+			name:                      "#2: Tolerations of the image cache",
+			tolerations:               gpuToleration,
+			expectedPullTolerations:   gpuToleration,
+			expectedDeleteTolerations: gpuToleration,
+		},
+		{
+			name:                      "#3: Empty tolerations of the image cache",
+			tolerations:               []corev1.Toleration{},
+			expectedPullTolerations:   []corev1.Toleration{},
+			expectedDeleteTolerations: []corev1.Toleration{},
+		},
+		{
+			name:                      "#4: Caching on unschedulable nodes",
+			tolerations:               gpuToleration,
+			cacheOnUnschedulableNodes: true,
+			expectedPullTolerations:   []corev1.Toleration{gpuToleration[0], unschedulableToleration},
+			expectedDeleteTolerations: gpuToleration,
+		},
+	}
+	windowsNode := node
+	windowsNode.Status.NodeInfo.OperatingSystem = "windows"
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				Tolerations:               test.tolerations,
+				CacheOnUnschedulableNodes: test.cacheOnUnschedulableNodes,
+			},
+		}
+		for _, n := range []*corev1.Node{&node, &windowsNode} {
+			for _, cachePaths := range [][]string{nil, {"/opt/conda/lib/"}} {
+				pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, cachePaths, nil, n, "IfNotPresent",
+					"", "busybox:1.35.0", "", "", JobOptions{})
+				if err != nil {
+					t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+					continue
+				}
+				if !reflect.DeepEqual(pullJob.Spec.Template.Spec.Tolerations, test.expectedPullTolerations) {
+					t.Errorf("Test: %s failed: os=%s, expectedPullTolerations=%+v, actualPullTolerations=%+v", test.name,
+						n.Status.NodeInfo.OperatingSystem, test.expectedPullTolerations, pullJob.Spec.Template.Spec.Tolerations)
+				}
+			}
+			deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, n, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", JobOptions{})
+			if err != nil {
+				t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+			if !reflect.DeepEqual(deleteJob.Spec.Template.Spec.Tolerations, test.expectedDeleteTolerations) {
+				t.Errorf("Test: %s failed: os=%s, expectedDeleteTolerations=%+v, actualDeleteTolerations=%+v", test.name,
+					n.Status.NodeInfo.OperatingSystem, test.expectedDeleteTolerations, deleteJob.Spec.Template.Spec.Tolerations)
+			}
+		}
+	}
+}
+
+func TestTaintsTolerated(t *testing.T) {
+	cordoned := corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}
+	gpu := corev1.Taint{Key: "nvidia.com/gpu", Value: "present", Effect: corev1.TaintEffectNoSchedule}
+	preferNot := corev1.Taint{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}
+	tests := []struct {
+		name              string
+		taints            []corev1.Taint
+		tolerations       []corev1.Toleration
+		expectedTolerated bool
+	}{
+		{
+			name:              "#1: Node without taints",
+			expectedTolerated: true,
+		},
+		{
+			name:              "#2: Cordoned node not tolerated",
+			taints:            []corev1.Taint{cordoned},
+			expectedTolerated: false,
+		},
+		{
+			name:              "#3: PreferNoSchedule taint ignored",
+			taints:            []corev1.Taint{preferNot},
+			expectedTolerated: true,
+		},
+		{
+			name:              "#4: Taint tolerated",
+			taints:            []corev1.Taint{gpu},
+			tolerations:       []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}},
+			expectedTolerated: true,
+		},
+		{
+			name:              "#5: One of the taints not tolerated",
+			taints:            []corev1.Taint{gpu, cordoned},
+			tolerations:       []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpEqual, Value: "present"}},
+			expectedTolerated: false,
+		},
+	}
+	for _, test := range tests {
+		n := &corev1.Node{Spec: corev1.NodeSpec{Taints: test.taints}}
+		if _, tolerated := taintsTolerated(n, test.tolerations); tolerated != test.expectedTolerated {
+			t.Errorf("Test: %s failed: expectedTolerated=%t, actualTolerated=%t", test.name, test.expectedTolerated, tolerated)
+		}
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	tests := []struct {
+		name                     string
+		imageCacheSecrets        []corev1.LocalObjectReference
+		imageSecrets             []corev1.LocalObjectReference
+		expectedImagePullSecrets []corev1.LocalObjectReference
+	}{
+		{
+			name:                     "#1: No image pull secrets",
+			expectedImagePullSecrets: nil,
+		},
+		{
+			name:                     "#2: Image pull secrets of the image cache",
+			imageCacheSecrets:        []corev1.LocalObjectReference{{Name: "dockerhub"}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "dockerhub"}},
+		},
+		{
+			name:                     "#3: Image pull secrets of the image",
+			imageSecrets:             []corev1.LocalObjectReference{{Name: "private-registry"}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "private-registry"}},
+		},
+		{
+			name:              "#4: Image pull secrets merged without duplicates",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "dockerhub"}, {Name: "quay"}},
+			imageSecrets:      []corev1.LocalObjectReference{{Name: "quay"}, {Name: "private-registry"}, {Name: ""}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{
+				{Name: "dockerhub"}, {Name: "quay"}, {Name: "private-registry"},
+			},
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ImagePullSecrets: test.imageCacheSecrets,
+			},
+		}
+		for _, cachePaths := range [][]string{nil, {"/opt/conda/lib/"}} {
+			pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, cachePaths, test.imageSecrets, &node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", JobOptions{})
+			if err != nil {
+				t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+			if !reflect.DeepEqual(pullJob.Spec.Template.Spec.ImagePullSecrets, test.expectedImagePullSecrets) {
+				t.Errorf("Test: %s failed: expectedImagePullSecrets=%+v, actualImagePullSecrets=%+v", test.name,
+					test.expectedImagePullSecrets, pullJob.Spec.Template.Spec.ImagePullSecrets)
+			}
+		}
+	}
+}
+
+func TestDeleteJobPrivateImage(t *testing.T) {
+	testnode := node
+	testnode.Status.Images = []corev1.ContainerImage{
+		{
+			Names: []string{
+				"registry.example.com/team/app@" + testDigest,
+				"registry.example.com/team/app:2.0",
+			},
+		},
+		{
+			Names: []string{"registry.example.com/team/tools:1.0"},
+		},
+	}
+	tests := []struct {
+		name                string
+		image               string
+		imagePullSecrets    []corev1.LocalObjectReference
+		imageSecrets        []corev1.LocalObjectReference
+		containerdNamespace string
+		deleteByDigest      bool
+		expectedImage       string
+	}{
+		{
+			name:          "#1: Image of image cache without pull secrets is deleted by its reference",
+			image:         "registry.example.com/team/app:2.0",
+			expectedImage: "registry.example.com/team/app:2.0",
+		},
+		{
+			name:             "#2: Private image is deleted by its local digest",
+			image:            "registry.example.com/team/app:2.0",
+			imagePullSecrets: []corev1.LocalObjectReference{{Name: "myregistrykey"}},
+			expectedImage:    "registry.example.com/team/app@" + testDigest,
+		},
+		{
+			name:             "#3: Private image without local digest is deleted by its reference",
+			image:            "registry.example.com/team/tools:1.0",
+			imagePullSecrets: []corev1.LocalObjectReference{{Name: "myregistrykey"}},
+			expectedImage:    "registry.example.com/team/tools:1.0",
+		},
+		{
+			name:             "#4: Private image not listed in the node's status is deleted by its reference",
+			image:            "registry.example.com/team/app:1.0",
+			imagePullSecrets: []corev1.LocalObjectReference{{Name: "myregistrykey"}},
+			expectedImage:    "registry.example.com/team/app:1.0",
+		},
+		{
+			name:                "#5: Private image in another containerd namespace is deleted by its reference",
+			image:               "registry.example.com/team/app:2.0",
+			imagePullSecrets:    []corev1.LocalObjectReference{{Name: "myregistrykey"}},
+			containerdNamespace: "buildkit",
+			expectedImage:       "registry.example.com/team/app:2.0",
+		},
+		{
+			name:           "#6: Image deleted by digest is deleted by its local digest",
+			image:          "registry.example.com/team/app:2.0",
+			deleteByDigest: true,
+			expectedImage:  "registry.example.com/team/app@" + testDigest,
+		},
+		{
+			name:           "#7: Image deleted by digest without local digest is deleted by its reference",
+			image:          "registry.example.com/team/tools:1.0",
+			deleteByDigest: true,
+			expectedImage:  "registry.example.com/team/tools:1.0",
+		},
+		{
+			name:                "#8: Image deleted by digest in another containerd namespace is deleted by its reference",
+			image:               "registry.example.com/team/app:2.0",
+			containerdNamespace: "buildkit",
+			deleteByDigest:      true,
+			expectedImage:       "registry.example.com/team/app:2.0",
+		},
+		{
+			name:          "#9: Image with its own pull secrets is deleted by its local digest",
+			image:         "registry.example.com/team/app:2.0",
+			imageSecrets:  []corev1.LocalObjectReference{{Name: "team-registry-key"}},
+			expectedImage: "registry.example.com/team/app@" + testDigest,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ImagePullSecrets:    test.imagePullSecrets,
+				ContainerdNamespace: test.containerdNamespace,
+			},
+		}
+		builder := NewImageJobBuilder(ImageJobBuilderOptions{
+			CriClientImage: "cri-client:latest",
+			JobOptions:     JobOptions{DeleteImagesByDigest: test.deleteByDigest},
+		})
+		imageSecrets := test.imageSecrets
+		job, err := builder.DeleteJob(ImageWorkRequest{Image: test.image, ImagePullSecrets: &imageSecrets, Node: &testnode,
+			ContainerRuntimeVersion: "containerd://1.6.8", WorkType: ImageCachePurge, Imagecache: imagecache})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		command := job.Spec.Template.Spec.Containers[0].Command[2]
+		if !strings.Contains(command, "'"+test.expectedImage+"'") {
+			t.Errorf("Test: %s failed: expectedImage=%s, actualCommand=%s", test.name, test.expectedImage, command)
+		}
+	}
+}
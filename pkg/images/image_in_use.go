@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/klog/v2"
+)
+
+// podsUsingImage lists the pods on the node that are not finished and have a container
+// running the image, either by the name in the image cache or by its registry mirror reference.
+func (m *ImageManager) podsUsingImage(image string, node *corev1.Node) ([]string, error) {
+	pods, err := m.kubeclientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{image, RewriteImageRef(image, m.jobOptions.RegistryMirrors)}
+	using := []string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != node.Name || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if podUsesImage(&pod, refs) {
+			using = append(using, pod.Namespace+"/"+pod.Name)
+		}
+	}
+	return using, nil
+}
+
+// podUsesImage checks whether a container of the pod runs one of the image references
+func podUsesImage(pod *corev1.Pod, refs []string) bool {
+	images := []string{}
+	for _, c := range pod.Spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		images = append(images, c.Image)
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		images = append(images, s.Image)
+	}
+	for _, image := range images {
+		for _, ref := range refs {
+			if SameImage(image, ref) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageInUse checks whether the image is used by pods on the node, in which case it is
+// not deleted unless the image cache forces deletion. It returns the result of the skipped deletion.
+func (m *ImageManager) imageInUse(iwr ImageWorkRequest) (*ImageWorkResult, error) {
+	if iwr.Imagecache.Spec.ForceDelete {
+		return nil, nil
+	}
+	pods, err := m.podsUsingImage(iwr.Image, iwr.Node)
+	if err != nil {
+		klog.Errorf("Error listing pods of node %s: %v", iwr.Node.Name, err)
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, nil
+	}
+	return &ImageWorkResult{
+		ImageWorkRequest: iwr,
+		Status:           ImageWorkResultStatusSkipped,
+		Reason:           fledgedv1alpha3.ImageCacheReasonImageInUse,
+		Message:          fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessageImageInUse, strings.Join(pods, ", ")),
+	}, nil
+}
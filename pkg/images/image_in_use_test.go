@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/storage/names"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestProcessNextWorkItemImageInUse(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"kubernetes.io/hostname": "node1"},
+		},
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx:1.25"}},
+				{Names: []string{"registry.internal/mirror/nginx:1.25"}},
+			},
+		},
+	}
+	newPod := func(name, nodeName string, phase corev1.PodPhase, image string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: corev1.PodSpec{
+				NodeName:   nodeName,
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	tests := []struct {
+		name            string
+		pods            []runtime.Object
+		forceDelete     bool
+		registryMirrors map[string]string
+		expectedJobs    int
+		expectedStatus  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Image not used by any pod is deleted",
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:            "#2: Image used by a running pod is not deleted",
+			pods:            []runtime.Object{newPod("web", "node1", corev1.PodRunning, "docker.io/library/nginx:1.25")},
+			expectedJobs:    0,
+			expectedStatus:  ImageWorkResultStatusSkipped,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageImageInUse + " (default/web)",
+		},
+		{
+			name: "#3: Image used by an init container of a pending pod is not deleted",
+			pods: []runtime.Object{func() *corev1.Pod {
+				pod := newPod("web", "node1", corev1.PodPending, "busybox")
+				pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "nginx:1.25"}}
+				return pod
+			}()},
+			expectedJobs:    0,
+			expectedStatus:  ImageWorkResultStatusSkipped,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageImageInUse + " (default/web)",
+		},
+		{
+			name: "#4: Image used by pods on other nodes or by finished pods is deleted",
+			pods: []runtime.Object{
+				newPod("web", "node2", corev1.PodRunning, "nginx:1.25"),
+				newPod("batch", "node1", corev1.PodSucceeded, "nginx:1.25"),
+				newPod("cache", "node1", corev1.PodRunning, "nginx:1.24"),
+			},
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#5: Image used by a running pod is deleted when forced",
+			pods:           []runtime.Object{newPod("web", "node1", corev1.PodRunning, "nginx:1.25")},
+			forceDelete:    true,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:            "#6: Image used by a pod through its registry mirror is not deleted",
+			pods:            []runtime.Object{newPod("web", "node1", corev1.PodRunning, "registry.internal/mirror/nginx:1.25")},
+			registryMirrors: map[string]string{"docker.io/library": "registry.internal/mirror"},
+			expectedJobs:    0,
+			expectedStatus:  ImageWorkResultStatusSkipped,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageImageInUse + " (default/web)",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{ForceDelete: test.forceDelete},
+		}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(test.pods...)
+		fakekubeclientset.PrependReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+			job.Name = names.SimpleNameGenerator.GenerateName(job.GenerateName)
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.RegistryMirrors = test.registryMirrors
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   "nginx:1.25",
+			Node:                    node,
+			ContainerRuntimeVersion: "containerd://1.6.0",
+			WorkType:                ImageCachePurge,
+			Imagecache:              imagecache,
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, createdJobs(fakekubeclientset))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if test.expectedStatus == ImageWorkResultStatusSkipped &&
+				(iwres.Reason != fledgedv1alpha3.ImageCacheReasonImageInUse || iwres.Message != test.expectedMessage) {
+				t.Errorf("Test: %s failed: expectedReason=%s, expectedMessage=%s, actualReason=%s, actualMessage=%s", test.name,
+					fledgedv1alpha3.ImageCacheReasonImageInUse, test.expectedMessage, iwres.Reason, iwres.Message)
+			}
+		}
+	}
+}
@@ -23,8 +23,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"go.opentelemetry.io/otel/trace"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -40,6 +40,7 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 )
 
 const controllerAgentName = "fledged"
@@ -48,14 +49,33 @@ const fakeJobPrefix = "fakejob-"
 const (
 	// ImageWorkResultStatusSucceeded means image pull/delete succeeded
 	ImageWorkResultStatusSucceeded = "succeeded"
+	// ImageWorkResultStatusSucceededAfterRetries means image pull/delete succeeded after one or more failed attempts
+	ImageWorkResultStatusSucceededAfterRetries = "succeededafterretries"
 	// ImageWorkResultStatusFailed means image pull/delete failed
 	ImageWorkResultStatusFailed = "failed"
 	// ImageWorkResultStatusJobCreated means job for image pull/delete created
 	ImageWorkResultStatusJobCreated = "jobcreated"
+	// ImageWorkResultStatusJobQueued means job for image pull is waiting for a free slot on the node
+	ImageWorkResultStatusJobQueued = "jobqueued"
+	// ImageWorkResultStatusJobShared means image pull waits for the result of the job of another request
+	// already pulling the same image onto the same node
+	ImageWorkResultStatusJobShared = "jobshared"
 	//ImageWorkResultStatusAlreadyPulled  means image is already present in the node
 	ImageWorkResultStatusAlreadyPulled = "alreadypulled"
 	//ImageWorkResultStatusUnknown  means status of image pull/delete unknown
 	ImageWorkResultStatusUnknown = "unknown"
+	//ImageWorkResultStatusImageMissing means image is not present in the node and image pull policy is Never
+	ImageWorkResultStatusImageMissing = "imagemissing"
+	//ImageWorkResultStatusSkipped means image is not pulled as it is not built for the architecture of the node,
+	//as the node is unschedulable or as the node has a taint not tolerated by the image cache,
+	//or image is not deleted as it is used by pods on the node
+	ImageWorkResultStatusSkipped = "skipped"
+	// ImageWorkResultStatusWouldPull means image would be pulled, but the image cache is in dry run mode
+	ImageWorkResultStatusWouldPull = "wouldpull"
+	// ImageWorkResultStatusWouldDelete means image would be deleted, but the image cache is in dry run mode
+	ImageWorkResultStatusWouldDelete = "woulddelete"
+	// ImageWorkResultStatusAlreadyAbsent means image is not deleted as it is not present in the node
+	ImageWorkResultStatusAlreadyAbsent = "alreadyabsent"
 )
 
 // ImageManager provides the functionalities for pulling and deleting images
@@ -68,26 +88,151 @@ type ImageManager struct {
 	kubeInformerFactory       kubeinformers.SharedInformerFactory
 	podsLister                corelisters.PodLister
 	podsSynced                cache.InformerSynced
+	jobsSynced                cache.InformerSynced
 	imagePullDeadlineDuration time.Duration
 	criClientImage            string
 	busyboxImage              string
 	imagePullPolicy           string
 	serviceAccountName        string
-	imageDeleteJobHostNetwork bool
 	jobPriorityClassName      string
 	canDeleteJob              bool
 	criSocketPath             string
-	lock                      sync.RWMutex
+	jobOptions                JobOptions
+	// jobCreationBackoff is the backoff of the retries of jobs whose creation failed with a transient error
+	jobCreationBackoff wait.Backoff
+	// pendingPullJobs are the keys in imageworkstatus of the queued pull requests, per image cache
+	pendingPullJobs map[string][]string
+	// pendingImageCaches are the image caches with queued pull requests, in the order they were queued
+	pendingImageCaches []string
+	lock               sync.RWMutex
+	// registryPullLimits are the per-registry limits of the active pull jobs, set from the registry pull
+	// limits ConfigMap
+	registryPullLimits     RegistryPullLimits
+	registryPullLimitsLock sync.RWMutex
+	// jobWatches are the channels notified when the result of a job of an image cache changes,
+	// mapped to the key of the image cache (see imageCacheKey)
+	jobWatches   map[chan struct{}]string
+	jobWatchLock sync.Mutex
+	// reconcileSpans are the spans of the active reconciles, mapped to the key of their image cache, and
+	// jobSpans the spans of the active jobs, mapped to the name of the job
+	reconcileSpans map[string]trace.Span
+	jobSpans       map[string]jobSpan
+	spanLock       sync.Mutex
+	// helperImageChecks are the checks of the helper images of the jobs, mapped to the comma-separated
+	// helper images. Guarded by lock.
+	helperImageChecks map[string]helperImageCheck
+	// logger logs the image pull/delete requests with their image cache, image and node
+	logger klog.Logger
+}
+
+// JobOptions holds the controller-wide settings used while constructing image pull/delete jobs
+type JobOptions struct {
+	// LegacyModelzDirCache caches the conda directories of images whose name contains "modelzai".
+	// Deprecated: set CachePaths on the image in the cache spec instead.
+	LegacyModelzDirCache bool
+	// ForceFullCache caches all the files of the images without forceFullCache or cachePaths in the cache
+	// spec. Images with forceFullCache are fully cached regardless.
+	ForceFullCache bool
+	// ImagePullJobDeadline is the activeDeadlineSeconds of image pull jobs. Defaults to one hour when zero.
+	ImagePullJobDeadline time.Duration
+	// ImageDeleteJobDeadline is the activeDeadlineSeconds of image delete jobs. Defaults to one hour when zero.
+	ImageDeleteJobDeadline time.Duration
+	// JobBackoffLimit is the number of retries of image pull/delete jobs before they are considered failed
+	JobBackoffLimit int32
+	// Resources are the resource requests and limits of the containers of image pull/delete jobs
+	Resources corev1.ResourceRequirements
+	// TTLSecondsAfterFinished is the ttlSecondsAfterFinished of image pull/delete jobs. Zero disables it.
+	TTLSecondsAfterFinished int32
+	// ContainerRuntime overrides the container runtime detected from the node for deleting images:
+	// docker, containerd, crio, nerdctl or podman
+	ContainerRuntime string
+	// KubernetesDistribution overrides the kubernetes distribution detected from the node for resolving the
+	// cri socket and the registry trust directory of the container runtime it embeds: k3s or microk8s
+	KubernetesDistribution string
+	// MaxPullJobsPerNode is the maximum number of image pull jobs active on a node at once. The remaining
+	// pull requests of the node are queued. Zero means no limit.
+	MaxPullJobsPerNode int
+	// MaxConcurrentPullJobs is the maximum number of image pull jobs active in the cluster at once.
+	// Zero means no limit.
+	MaxConcurrentPullJobs int
+	// WindowsCRIClientImage is the image of the host process containers that delete images on
+	// Windows nodes. Defaults to DefaultWindowsCRIClientImage when empty.
+	WindowsCRIClientImage string
+	// RegistryMirrors maps source prefixes of image repositories to the prefixes of their mirrors.
+	// Images are pulled from and deleted by their mirror reference. See RewriteImageRef.
+	RegistryMirrors map[string]string
+	// DisableLatestAlwaysPull keeps the IfNotPresent image pull policy for images tagged latest or
+	// untagged, which are otherwise always pulled. See latestAlwaysPull.
+	DisableLatestAlwaysPull bool
+	// ImagePullBackOffGracePeriod is how long the pod of a job may fail to pull its image (ErrImagePull or
+	// ImagePullBackOff) before the job is failed and deleted. Zero fails the job at the first failed pull.
+	ImagePullBackOffGracePeriod time.Duration
+	// RateLimitRetryAfter is how long after a pull rate-limited by the registry the image cache is
+	// refreshed to retry it, unless the error of the registry gives a retry-after. Zero disables the retry.
+	RateLimitRetryAfter time.Duration
+	// HTTPProxy and HTTPSProxy are set as HTTP_PROXY and HTTPS_PROXY of the containers of image pull/delete
+	// jobs, with NoProxy added to the in-cluster destinations as NO_PROXY. Unset if both are empty.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// PullJobRestartPolicy and DeleteJobRestartPolicy are the restart policies of the pods of image pull and
+	// delete jobs. OnFailure retries a failed container within its pod instead of creating a new pod. Never when empty.
+	PullJobRestartPolicy   corev1.RestartPolicy
+	DeleteJobRestartPolicy corev1.RestartPolicy
+	// OrasImage is the image of the oras client pulling the images of artifact type Artifact.
+	// Defaults to DefaultOrasImage when empty.
+	OrasImage string
+	// ArtifactCacheDir is the directory of the nodes to which the images of artifact type Artifact
+	// are pulled. Defaults to DefaultArtifactCacheDir when empty.
+	ArtifactCacheDir string
+	// MaxNodeDiskUsagePercent defers the image pulls to the nodes reporting DiskPressure, or whose images use
+	// at least this percentage of their ephemeral storage, to the next refresh. Zero disables the check.
+	MaxNodeDiskUsagePercent int
+	// DeleteImagesByDigest deletes the images by the repo@digest name listed for them in the status of the
+	// node instead of by their tag, so that an image with several tags is removed from the node and frees
+	// its disk. Images not listed with a digest are deleted by their tag.
+	DeleteImagesByDigest bool
+	// RegistryPullLimitsConfigMap is the ConfigMap in the namespace of kubefledged-controller holding the
+	// default and per-registry limits of the pull jobs active at once. See ParseRegistryPullLimits.
+	RegistryPullLimitsConfigMap string
+	// JobNamespace is the namespace in which image pull/delete jobs are created. Defaults to the
+	// namespace of the image cache when empty.
+	JobNamespace string
+	// CheckHelperImages checks with a single job that the busybox and cri client images can be pulled
+	// onto a node before creating the image pull jobs, which fail with HelperImageUnavailable otherwise
+	CheckHelperImages bool
 }
 
 // ImageWorkRequest has image name, node name, work type and imagecache
 type ImageWorkRequest struct {
 	Image                   string
 	ForceFullCache          bool
+	ImagePullPolicy         corev1.PullPolicy
+	CachePaths              *[]string
+	WarmCommand             *[]string
+	Aliases                 *[]string
+	Architectures           *[]string
+	ImagePullSecrets        *[]corev1.LocalObjectReference
 	Node                    *corev1.Node
 	ContainerRuntimeVersion string
 	WorkType                WorkType
 	Imagecache              *fledgedv1alpha3.ImageCache
+	// MaxUnavailableNodes is the maximum number of nodes with active pull jobs of the image cache,
+	// from its rollout strategy. Zero means no limit.
+	MaxUnavailableNodes int
+	// NodeGroup is the value of the RefreshGroupByLabel label of the node of the request
+	NodeGroup string
+	// MaxUnavailableNodesPerGroup is the maximum number of nodes of the node group with active pull jobs of
+	// the image cache, from its rollout strategy. Zero means no limit.
+	MaxUnavailableNodesPerGroup int
+	// Digest is the digest the image is pinned to, for image caches pinning digests.
+	// The image is then pulled and deleted by its repo@digest reference.
+	Digest string
+	// Priority is the priority of the image in its image cache. Queued pull requests of higher
+	// priority get a free pull job slot first.
+	Priority int32
+	// ArtifactType is the artifact type of the image, which tells how it is pulled and deleted
+	ArtifactType fledgedv1alpha3.ArtifactType
 }
 
 // ImageWorkResult stores the result of pulling and deleting image
@@ -96,6 +241,34 @@ type ImageWorkResult struct {
 	Status           string
 	Reason           string
 	Message          string
+	// Retries is the number of failed attempts of the job so far
+	Retries int32
+	// TimeoutRetries is the number of times the pull job was recreated after not completing within the image pull deadline
+	TimeoutRetries int32
+	// FailureRetries is the number of times the pull job was recreated after failing
+	FailureRetries int32
+	// ImagePullBackOffSince is when the pod of the job was first seen unable to pull its image
+	ImagePullBackOffSince time.Time
+	// ImagePullError is the last error of the pod of the job pulling its image
+	ImagePullError string
+	// RetryAfter is how long to wait before retrying a pull rate-limited by the registry
+	RetryAfter time.Duration
+	// SharedJob is the job whose result is shared by a request with status ImageWorkResultStatusJobShared
+	SharedJob string
+	// Verification is set once the pull succeeded and the job is the one verifying the pulled image
+	Verification bool
+	// Tagging is set once the pull succeeded and the job is the one tagging the pulled image with its aliases
+	Tagging bool
+	// Verified is set when the pulled image passed verification
+	Verified bool
+	// PresenceCheck is set when the job is the one checking the presence of the image through the
+	// container runtime of the node, before pulling it
+	PresenceCheck bool
+	// HelperImageCheck is set when the job is the one checking that the helper images of the jobs
+	// can be pulled, before pulling the image
+	HelperImageCheck bool
+	// HelperImageCheckJob is the helper image check job a queued pull request waits for
+	HelperImageCheckJob string
 }
 
 // WorkType refers to type of work to be done by sync handler
@@ -117,6 +290,12 @@ type WorkQueueKey struct {
 	ObjKey        string
 	Status        *map[string]ImageWorkResult
 	OldImageCache *fledgedv1alpha3.ImageCache
+	// Nodes are the comma-separated names of the nodes a refresh is limited to, e.g. nodes
+	// that just joined the cluster. A refresh of all the nodes of the image cache if empty.
+	Nodes string
+	// Image is the image a purge is limited to, set by the purge-image annotation.
+	// A purge of all the images of the image cache if empty.
+	Image string
 }
 
 // NewImageManager returns a new image manager object
@@ -127,10 +306,11 @@ func NewImageManager(
 	namespace string,
 	imagePullDeadlineDuration time.Duration,
 	criClientImage, busyboxImage, imagePullPolicy, serviceAccountName string,
-	imageDeleteJobHostNetwork bool,
 	jobPriorityClassName string,
 	canDeleteJob bool,
-	criSocketPath string) (*ImageManager, coreinformers.PodInformer) {
+	criSocketPath string,
+	jobOptions JobOptions,
+	logger klog.Logger) (*ImageManager, coreinformers.PodInformer) {
 
 	appEqKubefledged, _ := labels.NewRequirement("app", selection.Equals, []string{"kubefledged"})
 	kubefledgedEqImagemanager, _ := labels.NewRequirement("kubefledged", selection.Equals, []string{"kubefledged-image-manager"})
@@ -144,6 +324,7 @@ func NewImageManager(
 			options.LabelSelector = labelSelector.String()
 		}))
 	podInformer := kubeInformerFactory.Core().V1().Pods()
+	jobInformer := kubeInformerFactory.Batch().V1().Jobs()
 
 	imagemanager := &ImageManager{
 		fledgedNameSpace:          namespace,
@@ -154,18 +335,37 @@ func NewImageManager(
 		kubeInformerFactory:       kubeInformerFactory,
 		podsLister:                podInformer.Lister(),
 		podsSynced:                podInformer.Informer().HasSynced,
+		jobsSynced:                jobInformer.Informer().HasSynced,
 		imagePullDeadlineDuration: imagePullDeadlineDuration,
 		criClientImage:            criClientImage,
 		busyboxImage:              busyboxImage,
 		imagePullPolicy:           imagePullPolicy,
 		serviceAccountName:        serviceAccountName,
-		imageDeleteJobHostNetwork: imageDeleteJobHostNetwork,
 		jobPriorityClassName:      jobPriorityClassName,
 		canDeleteJob:              canDeleteJob,
 		criSocketPath:             criSocketPath,
+		jobOptions:                jobOptions,
+		jobCreationBackoff:        defaultJobCreationBackoff,
+		pendingPullJobs:           make(map[string][]string),
+		jobWatches:                make(map[chan struct{}]string),
+		reconcileSpans:            make(map[string]trace.Span),
+		jobSpans:                  make(map[string]jobSpan),
+		helperImageChecks:         make(map[string]helperImageCheck),
+		logger:                    logger,
 	}
+	// The result of a job is recorded as soon as its pod finishes, so jobs reaped by
+	// ttlSecondsAfterFinished do not lose their result
 	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		//AddFunc: ,
+		AddFunc: func(obj interface{}) {
+			// A pod that finished before it was first observed never goes through UpdateFunc
+			pod := obj.(*corev1.Pod)
+			if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				imagemanager.handlePodStatusChange(pod)
+			}
+			if pod.Status.Phase == corev1.PodPending {
+				imagemanager.handlePodPending(pod)
+			}
+		},
 		UpdateFunc: func(old, new interface{}) {
 			newPod := new.(*corev1.Pod)
 			oldPod := old.(*corev1.Pod)
@@ -174,19 +374,27 @@ func NewImageManager(
 				// Two different versions of the same Pod will always have different RVs.
 				return
 			}
-			glog.V(4).Infof("Pod %s changed status to %s", newPod.Name, newPod.Status.Phase)
+			klog.V(4).Infof("Pod %s changed status to %s", newPod.Name, newPod.Status.Phase)
 			if (newPod.Status.Phase == corev1.PodSucceeded || newPod.Status.Phase == corev1.PodFailed) &&
 				(oldPod.Status.Phase != corev1.PodSucceeded && oldPod.Status.Phase != corev1.PodFailed) {
 				imagemanager.handlePodStatusChange(newPod)
 			}
+			if newPod.Status.Phase == corev1.PodPending {
+				imagemanager.handlePodPending(newPod)
+			}
+			if newPod.Status.Phase == corev1.PodPending || newPod.Status.Phase == corev1.PodRunning {
+				imagemanager.handlePodRestarts(newPod)
+			}
 		},
 		//DeleteFunc: ,
 	})
+	// The result of a job failed without a failed pod, e.g. as its deadline expired, is recorded from the job
+	jobInformer.Informer().AddEventHandler(imagemanager.jobEventHandler())
 	return imagemanager, podInformer
 }
 
 func (m *ImageManager) handlePodStatusChange(pod *corev1.Pod) {
-	glog.V(4).Infof("Pod %s changed status to %s", pod.Name, pod.Status.Phase)
+	klog.V(4).Infof("Pod %s changed status to %s", pod.Name, pod.Status.Phase)
 	m.lock.RLock()
 	iwres, ok := m.imageworkstatus[pod.Labels["job-name"]]
 	m.lock.RUnlock()
@@ -195,71 +403,120 @@ func (m *ImageManager) handlePodStatusChange(pod *corev1.Pod) {
 	if !ok {
 		return
 	}
+	// The job was failed as its pod could not pull the image
+	if iwres.Status == ImageWorkResultStatusFailed {
+		return
+	}
+	if restartedInPod(pod) && podRestarts(pod) > iwres.Retries {
+		iwres.Retries = podRestarts(pod)
+	}
 
+	logger := klog.LoggerWithValues(m.requestLogger(iwres.ImageWorkRequest), "job", pod.Labels["job-name"], "action", jobAction(iwres))
 	if pod.Status.Phase == corev1.PodSucceeded {
 		iwres.Status = ImageWorkResultStatusSucceeded
-		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s succeeded (delete:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
-		} else {
-			glog.Infof("Job %s succeeded (pull:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
+		if iwres.Retries > 0 || iwres.TimeoutRetries > 0 || iwres.FailureRetries > 0 {
+			iwres.Status = ImageWorkResultStatusSucceededAfterRetries
 		}
+		logger.Info("Job succeeded", "runtime", iwres.ImageWorkRequest.ContainerRuntimeVersion)
 	}
-	if pod.Status.Phase == corev1.PodFailed {
+	if pod.Status.Phase == corev1.PodFailed && restartedInPod(pod) {
+		// The containers were restarted within the pod until the job failed, or the pod was evicted
+		// and gets replaced by the job controller; the result is recorded from the job
+		logger.Info("Job pod failed after restarts", "pod", pod.Name, "restarts", podRestarts(pod))
+	} else if pod.Status.Phase == corev1.PodFailed && iwres.Retries < m.jobOptions.JobBackoffLimit {
+		// The job controller creates a new pod for the next attempt; keep waiting for it
+		iwres.Retries++
+		logger.Info("Job attempt failed, retrying", "attempt", iwres.Retries, "attempts", m.jobOptions.JobBackoffLimit+1)
+	} else if pod.Status.Phase == corev1.PodFailed {
 		iwres.Status = ImageWorkResultStatusFailed
-		if len(pod.Status.ContainerStatuses) == 1 {
-			if pod.Status.ContainerStatuses[0].State.Terminated != nil {
-				iwres.Reason = pod.Status.ContainerStatuses[0].State.Terminated.Reason
-				iwres.Message = pod.Status.ContainerStatuses[0].State.Terminated.Message
-			}
+		// the termination message of the failed container carries the error of the pull or delete
+		if reason, message, ok := podFailure(pod); ok {
+			iwres.Reason = reason
+			iwres.Message = message
 		} else {
 			iwres.Reason = fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown
 			iwres.Message = fledgedv1alpha3.ImageCacheMessageImagePullStatusUnknown
 		}
-		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s failed (delete: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-		} else {
-			glog.Infof("Job %s failed (pull: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-		}
+		m.classifyRateLimited(&iwres)
+		logger.Info("Job failed", "reason", iwres.Reason)
 	}
+	if iwres.HelperImageCheck && iwres.Status != ImageWorkResultStatusJobCreated {
+		m.finishHelperImageCheck(pod.Labels["job-name"], iwres)
+		return
+	}
+	verificationResult(&iwres)
+	taggingResult(&iwres)
+	pull := m.presenceCheckResult(&iwres)
 	m.lock.Lock()
-	m.imageworkstatus[pod.Labels["job-name"]] = iwres
+	if pull {
+		// the result may have been recorded from the job in the meantime
+		if current, ok := m.imageworkstatus[pod.Labels["job-name"]]; ok && current.Status == ImageWorkResultStatusJobCreated {
+			iwres = m.pullAfterPresenceCheck(pod.Labels["job-name"], iwres)
+		}
+	} else if pullSucceeded(iwres) && m.tagsPull(iwres) {
+		// the result may have been recorded from the job in the meantime
+		if current, ok := m.imageworkstatus[pod.Labels["job-name"]]; ok && current.Status == ImageWorkResultStatusJobCreated {
+			m.startTagging(pod.Labels["job-name"], iwres)
+		}
+	} else if pullSucceeded(iwres) && verifiesPull(iwres) {
+		// the result may have been recorded from the job in the meantime
+		if current, ok := m.imageworkstatus[pod.Labels["job-name"]]; ok && current.Status == ImageWorkResultStatusJobCreated {
+			m.startVerification(pod.Labels["job-name"], iwres)
+		}
+	} else {
+		m.imageworkstatus[pod.Labels["job-name"]] = iwres
+	}
 	m.lock.Unlock()
+	m.endJobSpan(pod.Labels["job-name"], iwres)
+	m.notifyImageWorkResult(iwres.ImageWorkRequest)
+	m.notifySharedJob(pod.Labels["job-name"])
+	if m.pullJobThrottled(iwres.ImageWorkRequest) && iwres.Status != ImageWorkResultStatusJobCreated && iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+		m.dispatchPullJobs()
+	}
 }
 
-func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) error {
+func (m *ImageManager) updatePendingImageWorkResults(cacheKey string) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	m.resolveSharedJobs()
 	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCacheName {
+		if imageCacheKey(iwres.ImageWorkRequest.Imagecache) == cacheKey {
+			logger := m.requestLogger(iwres.ImageWorkRequest)
+			if iwres.Status == ImageWorkResultStatusJobShared {
+				logger.Info("Job still active for shared pull", "job", iwres.SharedJob, "action", "pull")
+				m.imageworkstatus[job] = sharedJobTimedOut(iwres)
+			}
+			if iwres.Status == ImageWorkResultStatusJobQueued {
+				logger.Info("Job expired while queued", "action", "pull")
+				iwres.Status = ImageWorkResultStatusFailed
+				iwres.Reason = fledgedv1alpha3.ImageCacheReasonPullJobQueued
+				iwres.Message = fledgedv1alpha3.ImageCacheMessagePullJobQueued
+				m.imageworkstatus[job] = iwres
+			}
 			if iwres.Status == ImageWorkResultStatusJobCreated {
-				pods, err := m.podsLister.Pods(iwres.ImageWorkRequest.Imagecache.Namespace).
+				pods, err := m.podsLister.Pods(m.jobNamespace(iwres.ImageWorkRequest.Imagecache)).
 					List(labels.Set(map[string]string{"job-name": job}).AsSelector())
 				if err != nil {
-					glog.Errorf("Error listing Pods: %v", err)
+					logger.Error(err, "Error listing pods", "job", job)
 					return err
 				}
-				if len(pods) > 1 {
-					glog.Errorf("More than one pod matched job %s", job)
+				if len(pods) > 1 && m.jobOptions.JobBackoffLimit == 0 {
+					logger.Error(nil, "More than one pod matched job", "job", job)
 					return fmt.Errorf("more than one pod matched job %s", job)
 				}
+				if len(pods) > 1 {
+					// Pods of earlier attempts of the job are retained; the latest attempt decides the result
+					pods = []*corev1.Pod{latestPod(pods)}
+				}
 				if len(pods) == 0 {
-					glog.Warningf("No pods matched job %s", job)
-					if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-						glog.Warningf("Job %s status unknown (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					} else {
-						glog.Warningf("Job %s status unknown (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					}
+					logger.Info("Job status unknown, no pods matched job", "job", job, "action", jobAction(iwres))
 					iwres.Status = ImageWorkResultStatusUnknown
 					iwres.Reason = fmt.Sprintf("No pods matched job %s", job)
 					iwres.Message = fmt.Sprintf("No pods matched job %s", job)
 				}
 				if len(pods) == 1 {
 					iwres.Status = ImageWorkResultStatusFailed
-					if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-						glog.Infof("Job %s expired (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					} else {
-						glog.Infof("Job %s expired (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
-					}
+					logger.Info("Job expired", "job", job, "action", jobAction(iwres))
 					if pods[0].Status.Phase == corev1.PodPending {
 						if len(pods[0].Status.ContainerStatuses) == 1 {
 							if pods[0].Status.ContainerStatuses[0].State.Waiting != nil {
@@ -275,18 +532,37 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 							iwres.Message = "Check if node is ready"
 						}
 					}
+					// the containers of a running pod with restartPolicy OnFailure may keep failing
+					if pods[0].Status.Phase == corev1.PodRunning && restartedInPod(pods[0]) {
+						if reason, message, ok := podFailure(pods[0]); ok {
+							iwres.Reason = reason
+							iwres.Message = message
+						}
+					}
+					// a pull that did not complete within the deadline is reported as timed out, with the
+					// state of its pod as details
+					if iwres.Verification {
+						iwres.Message = verificationFailedMessage(iwres.Reason, iwres.Message)
+						iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageVerificationFailed
+					} else if iwres.Tagging {
+						iwres.Message = tagFailedMessage(iwres.Reason, iwres.Message)
+						iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageTagFailed
+					} else if iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+						iwres.Message = pullTimedOutMessage(iwres.Reason, iwres.Message)
+						iwres.Reason = fledgedv1alpha3.ImageCacheReasonPullTimedOut
+					}
 					if iwres.ImageWorkRequest.WorkType != ImageCachePurge {
 						fieldSelector := fields.Set{
 							"involvedObject.kind":      "Pod",
 							"involvedObject.name":      pods[0].Name,
-							"involvedObject.namespace": iwres.ImageWorkRequest.Imagecache.Namespace,
+							"involvedObject.namespace": m.jobNamespace(iwres.ImageWorkRequest.Imagecache),
 							"reason":                   "Failed",
 						}.AsSelector().String()
 
-						eventlist, err := m.kubeclientset.CoreV1().Events(iwres.ImageWorkRequest.Imagecache.Namespace).
+						eventlist, err := m.kubeclientset.CoreV1().Events(m.jobNamespace(iwres.ImageWorkRequest.Imagecache)).
 							List(context.TODO(), metav1.ListOptions{FieldSelector: fieldSelector})
 						if err != nil {
-							glog.Errorf("Error listing events for pod (%s): %v", pods[0].Name, err)
+							logger.Error(err, "Error listing events of pod", "job", job, "pod", pods[0].Name)
 							return err
 						}
 
@@ -294,39 +570,141 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 							iwres.Message = iwres.Message + ":" + v.Message
 						}
 					}
+					m.classifyRateLimited(&iwres)
 				}
 				m.imageworkstatus[job] = iwres
 			}
 		}
 	}
-	glog.V(4).Infof("imageworkstatus map: %+v", m.imageworkstatus)
+	klog.V(4).Infof("imageworkstatus map: %+v", m.imageworkstatus)
 	return nil
 }
 
-func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageCache, errCh chan<- error) {
-	wait.Poll(time.Second, m.imagePullDeadlineDuration,
-		func() (done bool, err error) {
-			m.lock.RLock()
-			defer m.lock.RUnlock()
-			done, err = true, nil
-			for _, iwres := range m.imageworkstatus {
-				if iwres.ImageWorkRequest.Imagecache.Name == imageCache.Name {
-					if iwres.Status == ImageWorkResultStatusJobCreated {
-						done, err = false, nil
-						return
-					}
-				}
+// imagePullDeadline returns the maximum duration allowed for pulling the images of the image cache
+func (m *ImageManager) imagePullDeadline(imageCache *fledgedv1alpha3.ImageCache) time.Duration {
+	return imagePullDeadline(imageCache, m.imagePullDeadlineDuration)
+}
+
+// retryTimedOutPullJobs recreates the pull jobs of the image cache that did not complete within the
+// image pull deadline, whether still active or failed as their activeDeadlineSeconds expired. It returns
+// whether any pull job was recreated.
+func (m *ImageManager) retryTimedOutPullJobs(cacheKey string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	timedOut := map[string]ImageWorkResult{}
+	for job, iwres := range m.imageworkstatus {
+		if imageCacheKey(iwres.ImageWorkRequest.Imagecache) == cacheKey && iwres.ImageWorkRequest.WorkType != ImageCachePurge &&
+			(iwres.Status == ImageWorkResultStatusJobCreated || pullTimedOut(iwres)) {
+			timedOut[job] = iwres
+		}
+	}
+	deletePropagation := metav1.DeletePropagationBackground
+	for job, iwres := range timedOut {
+		logger := m.requestLogger(iwres.ImageWorkRequest)
+		newJob, err := m.pullImage(iwres.ImageWorkRequest)
+		if err != nil {
+			logger.Error(err, "Error recreating timed out job", "job", job, "action", "pull")
+			continue
+		}
+		logger.Info("Job timed out, retrying", "job", job, "action", "pull", "retryJob", newJob.Name)
+		if !strings.HasPrefix(job, fakeJobPrefix) && m.canDeleteJob {
+			if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwres.ImageWorkRequest.Imagecache)).
+				Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+				logger.Error(err, "Error deleting job", "job", job)
 			}
-			return
-		})
-	glog.V(4).Info("wait.Poll exited successfully")
-	err := m.updatePendingImageWorkResults(imageCache.Name)
+		}
+		delete(m.imageworkstatus, job)
+		iwres.Status = ImageWorkResultStatusJobCreated
+		iwres.Reason = ""
+		iwres.Message = ""
+		iwres.Retries = 0
+		iwres.TimeoutRetries++
+		// a pull whose verification timed out is verified again after the new pull
+		iwres.Verification = false
+		iwres.Tagging = false
+		iwres.PresenceCheck = false
+		iwres.HelperImageCheck = false
+		m.imageworkstatus[newJob.Name] = iwres
+		m.moveSharedJob(job, newJob.Name)
+	}
+	return len(timedOut) > 0
+}
+
+// retryFailedPullJobs recreates the failed pull jobs of the image cache. Pulls rate-limited by the
+// registry are not recreated, they are retried after the retry-after, nor the pulls of image caches
+// aborting on failure or whose helper images could not be pulled. Pulls timed out are left to
+// retryTimedOutPullJobs. It returns whether any pull job was recreated.
+func (m *ImageManager) retryFailedPullJobs(cacheKey string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	failed := map[string]ImageWorkResult{}
+	for job, iwres := range m.imageworkstatus {
+		if imageCacheKey(iwres.ImageWorkRequest.Imagecache) == cacheKey && iwres.Status == ImageWorkResultStatusFailed &&
+			iwres.ImageWorkRequest.WorkType != ImageCachePurge && iwres.Reason != fledgedv1alpha3.ImageCacheReasonRateLimited &&
+			iwres.Reason != fledgedv1alpha3.ImageCacheReasonHelperImageUnavailable && !pullTimedOut(iwres) &&
+			!abortsOnFailure(iwres.ImageWorkRequest) {
+			failed[job] = iwres
+		}
+	}
+	deletePropagation := metav1.DeletePropagationBackground
+	for job, iwres := range failed {
+		logger := m.requestLogger(iwres.ImageWorkRequest)
+		newJob, err := m.pullImage(iwres.ImageWorkRequest)
+		if err != nil {
+			logger.Error(err, "Error recreating failed job", "job", job, "action", "pull")
+			continue
+		}
+		logger.Info("Job failed, retrying", "job", job, "action", "pull", "retryJob", newJob.Name)
+		if !strings.HasPrefix(job, fakeJobPrefix) && m.canDeleteJob {
+			if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwres.ImageWorkRequest.Imagecache)).
+				Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+				logger.Error(err, "Error deleting job", "job", job)
+			}
+		}
+		delete(m.imageworkstatus, job)
+		iwres.Status = ImageWorkResultStatusJobCreated
+		iwres.Reason = ""
+		iwres.Message = ""
+		iwres.ImagePullError = ""
+		iwres.ImagePullBackOffSince = time.Time{}
+		iwres.SharedJob = ""
+		iwres.Retries = 0
+		iwres.FailureRetries++
+		iwres.Verification = false
+		iwres.Tagging = false
+		iwres.PresenceCheck = false
+		iwres.HelperImageCheck = false
+		m.imageworkstatus[newJob.Name] = iwres
+		m.moveSharedJob(job, newJob.Name)
+	}
+	return len(failed) > 0
+}
+
+func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageCache, errCh chan<- error) {
+	// When pull jobs are queued, every batch of pull jobs on a node gets the full deadline
+	cacheKey := imageCacheKey(imageCache)
+	logger := m.imageCacheLogger(imageCache)
+	deadline := m.imagePullDeadline(imageCache) * time.Duration(m.pullJobRounds(cacheKey))
+	for retries, failureRetries := int32(0), int32(0); ; {
+		m.waitForJobs(cacheKey, deadline)
+		logger.V(4).Info("m.waitForJobs exited successfully")
+		if retries < imageCache.Spec.ImagePullTimeoutRetries && m.retryTimedOutPullJobs(cacheKey) {
+			retries++
+		} else if failureRetries < imageCache.Spec.FailedPullRetries && m.retryFailedPullJobs(cacheKey) {
+			failureRetries++
+		} else {
+			break
+		}
+		// retried pull jobs get the full deadline
+		deadline = m.imagePullDeadline(imageCache)
+	}
+	err := m.updatePendingImageWorkResults(cacheKey)
 	if err != nil {
-		glog.Errorf("Error from updatePendingImageWorkResults(): %v", err)
+		logger.Error(err, "Error updating the pending results of the jobs")
 		errCh <- err
 		return
 	}
-	glog.V(4).Info("m.updatePendingImageWorkResults exited successfully")
+	logger.V(4).Info("m.updatePendingImageWorkResults exited successfully")
 	//m.lock.Lock()
 	iwstatus := map[string]ImageWorkResult{}
 	//m.lock.Unlock()
@@ -334,21 +712,23 @@ func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageC
 	var iwstatusLock sync.RWMutex
 	m.lock.Lock()
 	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCache.Name {
+		if imageCacheKey(iwres.ImageWorkRequest.Imagecache) == cacheKey {
 			iwstatusLock.Lock()
 			iwstatus[job] = iwres
 			iwstatusLock.Unlock()
+			// the requests of other image caches sharing the job get its result before it is dropped
+			m.shareJobResult(job, iwres)
 			imageCache = iwres.ImageWorkRequest.Imagecache
 			delete(m.imageworkstatus, job)
 			// delete the job if RetentionPolicy is not Retain
 			if !strings.HasPrefix(job, fakeJobPrefix) && m.canDeleteJob {
-				if err := m.kubeclientset.BatchV1().Jobs(imageCache.Namespace).
+				if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(imageCache)).
 					Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
 					// if for some reason the job cannot be deleted, we'll not retry. rather we continue processing the remaining jobs
 					if strings.Contains(err.Error(), "not found") {
-						glog.Warningf("Error deleting job %s: %s", job, "not found")
+						m.requestLogger(iwres.ImageWorkRequest).Info("Job to delete not found", "job", job)
 					} else {
-						glog.Errorf("Error deleting job %s: %v", job, err)
+						m.requestLogger(iwres.ImageWorkRequest).Error(err, "Error deleting job", "job", job)
 					}
 					//m.lock.Unlock()
 					//errCh <- err
@@ -357,18 +737,23 @@ func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageC
 			}
 		}
 	}
+	m.forgetUnavailableHelperImages(iwstatus)
 	m.lock.Unlock()
+	for job := range iwstatus {
+		m.notifySharedJob(job)
+	}
 	if imageCache == nil {
-		glog.Errorf("Unable to obtain reference to image cache")
+		logger.Error(nil, "Unable to obtain reference to image cache")
 		errCh <- fmt.Errorf("unable to obtain reference to image cache")
 		return
 	}
-	objKey, err := cache.MetaNamespaceKeyFunc(imageCache)
+	objKey, err := ImageCacheKey(imageCache)
 	if err != nil {
-		glog.Errorf("Error from cache.MetaNamespaceKeyFunc(imageCache): %v", err)
+		logger.Error(err, "Error from ImageCacheKey(imageCache)")
 		errCh <- err
 		return
 	}
+	m.endImageCacheJobSpans(objKey, iwstatus)
 	m.workqueue.AddRateLimited(WorkQueueKey{
 		WorkType: ImageCacheStatusUpdate,
 		Status:   &iwstatus,
@@ -381,17 +766,17 @@ func (m *ImageManager) updateImageCacheStatus(imageCache *fledgedv1alpha3.ImageC
 // Run starts the Image Manager go routine
 func (m *ImageManager) Run(stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
-	glog.Info("Starting image manager")
+	klog.Info("Starting image manager")
 	go m.kubeInformerFactory.Start(stopCh)
 	// Wait for the caches to be synced before starting workers
-	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, m.podsSynced); !ok {
+	klog.Info("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, m.podsSynced, m.jobsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 	go wait.Until(m.runWorker, time.Second, stopCh)
-	glog.Info("Started image manager")
+	klog.Info("Started image manager")
 	<-stopCh
-	glog.Info("Shutting down image manager")
+	klog.Info("Shutting down image manager")
 	return nil
 }
 
@@ -406,7 +791,7 @@ func (m *ImageManager) runWorker() {
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
 func (m *ImageManager) processNextWorkItem() bool {
-	//glog.Info("processNextWorkItem::Beginning...")
+	//klog.Info("processNextWorkItem::Beginning...")
 	obj, shutdown := m.imageworkqueue.Get()
 
 	if shutdown {
@@ -446,39 +831,184 @@ func (m *ImageManager) processNextWorkItem() bool {
 			go m.updateImageCacheStatus(iwr.Imagecache, errCh)
 			return nil
 		}
+		logger := m.requestLogger(iwr)
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
 		var job *batchv1.Job
 		var err error
 		var pull, delete bool
+		if iwr.WorkType == ImageCachePurge && m.imageAbsent(iwr) {
+			logger.Info("Job not created", "reason", "image-absent", "action", "delete")
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusAlreadyAbsent,
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		}
 		if iwr.WorkType == ImageCachePurge {
+			iwres, err := m.imageInUse(iwr)
+			if err != nil {
+				return fmt.Errorf("error checking whether image '%s' is in use on node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+			}
+			if iwres != nil {
+				logger.Info("Job not created", "reason", "image-in-use", "action", "delete")
+				m.lock.Lock()
+				m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = *iwres
+				m.lock.Unlock()
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+		}
+		if iwr.WorkType == ImageCachePurge && iwr.Imagecache.Spec.DryRun {
+			logger.Info("Job not created", "reason", "dry-run", "action", "delete")
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusWouldDelete,
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		} else if iwr.WorkType == ImageCachePurge {
 			delete = true
 			job, err = m.deleteImage(iwr)
 			if err != nil {
+				m.jobCreationFailed(iwr, err)
 				return fmt.Errorf("error deleting image '%s' from node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
 			}
-			glog.Infof("Job %s created (delete:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+			logger.Info("Job created", "job", job.Name, "action", "delete", "runtime", iwr.ContainerRuntimeVersion)
+		} else if !architectureSupported(iwr.Architectures, iwr.Node) {
+			logger.Info("Job not created", "reason", "architecture-mismatch", "action", "pull", "architecture", iwr.Node.Status.NodeInfo.Architecture)
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusSkipped,
+				Reason:           fledgedv1alpha3.ImageCacheReasonArchitectureMismatch,
+				Message:          fledgedv1alpha3.ImageCacheMessageArchitectureMismatch,
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		} else if iwr.Node.Spec.Unschedulable && !iwr.Imagecache.Spec.CacheOnUnschedulableNodes {
+			logger.Info("Job not created", "reason", "node-unschedulable", "action", "pull")
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusSkipped,
+				Reason:           fledgedv1alpha3.ImageCacheReasonNodeUnschedulable,
+				Message:          fledgedv1alpha3.ImageCacheMessageNodeUnschedulable,
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		} else if taint, ok := taintsTolerated(iwr.Node, pullJobTolerations(iwr.Imagecache)); !ok {
+			logger.Info("Job not created", "reason", "taint-not-tolerated", "action", "pull", "taint", taint.ToString())
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusSkipped,
+				Reason:           fledgedv1alpha3.ImageCacheReasonTaintNotTolerated,
+				Message:          fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessageTaintNotTolerated, taint.ToString()),
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		} else if pressure, ok := nodeDiskPressure(iwr.Node, m.jobOptions.MaxNodeDiskUsagePercent); ok {
+			logger.Info("Job not created", "reason", "disk-pressure", "action", "pull", "pressure", pressure)
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusSkipped,
+				Reason:           fledgedv1alpha3.ImageCacheReasonDeferredDiskPressure,
+				Message:          fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessageDeferredDiskPressure, pressure),
+			}
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
+		} else if effectiveImagePullPolicy(iwr, m.imagePullPolicy) == string(corev1.PullNever) && storedByRuntime(iwr.ArtifactType) {
+			// Only verify the presence of the image, never create a pull job
+			if checksPresenceWithRuntime(iwr) {
+				if err := m.checkPresence(iwr); err != nil {
+					return fmt.Errorf("error checking the presence of image '%s' on node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				}
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			present, err := imageAlreadyPresentInNode(RewriteImageRef(pinnedImage(iwr), m.jobOptions.RegistryMirrors), iwr.Node)
+			if err != nil {
+				logger.Error(err, "Error checking whether the image is present on the node")
+				return fmt.Errorf("error from imageAlreadyPresentInNode(): %+v", err)
+			}
+			iwres := ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusAlreadyPulled}
+			if present {
+				logger.Info("Job not created", "reason", "image-already-present", "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
+			} else {
+				logger.Info("Job not created", "reason", "image-missing", "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
+				iwres.Status = ImageWorkResultStatusImageMissing
+				iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageMissing
+				iwres.Message = fledgedv1alpha3.ImageCacheMessageImageMissing
+			}
+			m.lock.Lock()
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = iwres
+			m.lock.Unlock()
+			m.imageworkqueue.Forget(obj)
+			return nil
 		} else {
 			pull = true
-			pull, err = checkIfImageNeedsToBePulled(m.imagePullPolicy, iwr.Image, iwr.Node)
-			if err != nil {
-				glog.Errorf("Error from checkIfImageNeedsToBePulled(): %+v", err)
-				return fmt.Errorf("error from checkIfImageNeedsToBePulled(): %+v", err)
+			// artifacts not stored by the runtime are not listed in the status of the node,
+			// so their pull job checks whether they are already pulled
+			if storedByRuntime(iwr.ArtifactType) {
+				pull, err = checkIfImageNeedsToBePulled(effectiveImagePullPolicy(iwr, m.imagePullPolicy),
+					RewriteImageRef(pinnedImage(iwr), m.jobOptions.RegistryMirrors), iwr.Node,
+					latestAlwaysPull(iwr.Imagecache, m.jobOptions))
+				if err != nil {
+					logger.Error(err, "Error checking whether the image needs to be pulled")
+					return fmt.Errorf("error from checkIfImageNeedsToBePulled(): %+v", err)
+				}
+			}
+			// the node's status may list an image the runtime no longer has
+			if !pull && checksPresenceWithRuntime(iwr) {
+				if err := m.checkPresence(iwr); err != nil {
+					return fmt.Errorf("error checking the presence of image '%s' on node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				}
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			// the image is present, but may not be tagged yet with aliases added since its pull
+			if !pull && !iwr.Imagecache.Spec.DryRun && m.aliasesMissing(iwr) {
+				if err := m.tagPresentImage(iwr); err != nil {
+					return fmt.Errorf("error tagging image '%s' on node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				}
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if pull && iwr.Imagecache.Spec.DryRun {
+				logger.Info("Job not created", "reason", "dry-run", "action", "pull")
+				m.lock.Lock()
+				m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+					ImageWorkRequest: iwr,
+					Status:           ImageWorkResultStatusWouldPull,
+				}
+				m.lock.Unlock()
+				m.imageworkqueue.Forget(obj)
+				return nil
 			}
 			if pull {
-				job, err = m.pullImage(iwr)
-				if err != nil {
-					return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				if err := m.startPull(iwr, true); err != nil {
+					return err
 				}
-				glog.Infof("Job %s created (pull:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
-			} else {
-				glog.Infof("Job not created (image-already-present:- %s --> %s, runtime: %s)", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				m.imageworkqueue.Forget(obj)
+				return nil
 			}
+			logger.Info("Job not created", "reason", "image-already-present", "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		m.lock.Lock()
-		if pull || delete {
+		if delete {
 			m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
 		} else {
 			// generate a random fake job name
@@ -497,38 +1027,145 @@ func (m *ImageManager) processNextWorkItem() bool {
 	return true
 }
 
+// startPull creates the pull job of the request, unless its image cache aborted on failure, an active job already
+// pulls the image onto the node or, with checkHelperImages, the request waits for the check of the helper images.
+// The request is queued while the pull jobs are throttled.
+func (m *ImageManager) startPull(iwr ImageWorkRequest, checkHelperImages bool) error {
+	logger := m.requestLogger(iwr)
+	if m.abortPullOnFailure(iwr) {
+		logger.Info("Job not created", "reason", "aborted-on-failure", "action", "pull")
+		return nil
+	}
+	if job, ok := m.shareActivePullJob(iwr); ok {
+		logger.Info("Job not created", "reason", "pull-shared", "action", "pull", "job", job)
+		return nil
+	}
+	if checkHelperImages && m.waitForHelperImages(iwr) {
+		return nil
+	}
+	if m.pullJobThrottled(iwr) {
+		m.queuePullJob(iwr)
+		m.dispatchPullJobs()
+		return nil
+	}
+	job, err := m.pullImage(iwr)
+	if err != nil {
+		m.jobCreationFailed(iwr, err)
+		return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+	}
+	logger.Info("Job created", "job", job.Name, "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
+	m.lock.Lock()
+	m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+	m.lock.Unlock()
+	return nil
+}
+
+// pullTimedOutMessage returns the message of a pull that did not complete within the deadline,
+// given the reason and message of the state of its pod if any
+func pullTimedOutMessage(reason, message string) string {
+	if reason == "" {
+		return fledgedv1alpha3.ImageCacheMessagePullTimedOut
+	}
+	if message == "" {
+		return fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessagePullTimedOut, reason)
+	}
+	return fmt.Sprintf("%s (%s: %s)", fledgedv1alpha3.ImageCacheMessagePullTimedOut, reason, message)
+}
+
+// pullTimedOut checks whether the pull of the result failed as its job did not complete within the image pull deadline
+func pullTimedOut(iwres ImageWorkResult) bool {
+	return iwres.Status == ImageWorkResultStatusFailed && iwres.Reason == fledgedv1alpha3.ImageCacheReasonPullTimedOut
+}
+
+// latestPod returns the most recently created pod
+func latestPod(pods []*corev1.Pod) *corev1.Pod {
+	latest := pods[0]
+	for _, pod := range pods[1:] {
+		if latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest
+}
+
+// effectiveImagePullPolicy returns the image pull policy of the image if set, else the controller-wide one
+func effectiveImagePullPolicy(iwr ImageWorkRequest, imagePullPolicy string) string {
+	if iwr.ImagePullPolicy != "" {
+		return string(iwr.ImagePullPolicy)
+	}
+	return imagePullPolicy
+}
+
+// imageCacheLogger returns the logger of the image manager with the image cache
+func (m *ImageManager) imageCacheLogger(imagecache *fledgedv1alpha3.ImageCache) klog.Logger {
+	if imagecache != nil {
+		if key, err := ImageCacheKey(imagecache); err == nil {
+			return klog.LoggerWithValues(m.logger, "imagecache", key)
+		}
+	}
+	return m.logger
+}
+
+// requestLogger returns the logger of the image manager with the image cache, image and node of the request
+func (m *ImageManager) requestLogger(iwr ImageWorkRequest) klog.Logger {
+	logger := m.imageCacheLogger(iwr.Imagecache)
+	var node string
+	if iwr.Node != nil {
+		node = iwr.Node.Labels["kubernetes.io/hostname"]
+	}
+	return klog.LoggerWithValues(logger, "image", iwr.Image, "node", node)
+}
+
+// jobAction returns the action of the job of the result: pull, verify, tag, check, helper-check or delete
+func jobAction(iwres ImageWorkResult) string {
+	switch {
+	case iwres.ImageWorkRequest.WorkType == ImageCachePurge:
+		return "delete"
+	case iwres.HelperImageCheck:
+		return "helper-check"
+	case iwres.Verification:
+		return "verify"
+	case iwres.Tagging:
+		return "tag"
+	case iwres.PresenceCheck:
+		return "check"
+	default:
+		return "pull"
+	}
+}
+
 // pullImage pulls the image to the node
 func (m *ImageManager) pullImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
 	// Construct the Job manifest
-	newjob, err := newImagePullJob(iwr.Imagecache, iwr.Image, iwr.ForceFullCache, iwr.Node, m.imagePullPolicy,
-		m.busyboxImage, m.serviceAccountName, m.jobPriorityClassName)
+	newjob, err := m.jobBuilder().PullJob(iwr)
 	if err != nil {
-		glog.Errorf("Error when constructing job manifest: %v", err)
+		m.requestLogger(iwr).Error(err, "Error when constructing job manifest")
 		return nil, err
 	}
 	// Create a Job to pull the image into the node
-	job, err := m.kubeclientset.BatchV1().Jobs(iwr.Imagecache.Namespace).Create(context.TODO(), newjob, metav1.CreateOptions{})
+	job, err := m.createJob(m.jobNamespace(iwr.Imagecache), newjob)
 	if err != nil {
-		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
+		m.requestLogger(iwr).Error(err, "Error creating job")
 		return nil, err
 	}
+	m.startJobSpan(iwr, job.Name, "pull")
 	return job, nil
 }
 
 // deleteImage deletes the image from the node
 func (m *ImageManager) deleteImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
 	// Construct the Job manifest
-	newjob, err := newImageDeleteJob(iwr.Imagecache, iwr.Image, iwr.Node, iwr.ContainerRuntimeVersion,
-		m.criClientImage, m.serviceAccountName, m.imageDeleteJobHostNetwork, m.jobPriorityClassName, m.criSocketPath)
+	newjob, err := m.jobBuilder().DeleteJob(iwr)
 	if err != nil {
-		glog.Errorf("Error when constructing job manifest: %v", err)
+		m.requestLogger(iwr).Error(err, "Error when constructing job manifest")
 		return nil, err
 	}
 	// Create a Job to delete the image from the node
-	job, err := m.kubeclientset.BatchV1().Jobs(iwr.Imagecache.Namespace).Create(context.TODO(), newjob, metav1.CreateOptions{})
+	job, err := m.createJob(m.jobNamespace(iwr.Imagecache), newjob)
 	if err != nil {
-		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
+		m.requestLogger(iwr).Error(err, "Error creating job")
 		return nil, err
 	}
+	m.startJobSpan(iwr, job.Name, "delete")
 	return job, nil
 }
@@ -23,17 +23,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
 	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/storage/names"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
 )
 
 const fledgedNameSpace = "kube-fledged"
@@ -45,14 +48,13 @@ var node = corev1.Node{
 }
 
 func newTestImageManager(kubeclientset kubernetes.Interface, imagepullpolicy string,
-	serviceaccountname string, imagedeletejobhostnetwork bool,
+	serviceaccountname string,
 	jobpriorityclassname string, candeletejob bool, criSocketPath string) (*ImageManager, coreinformers.PodInformer) {
 	imagePullDeadlineDuration := time.Millisecond * 10
 	criClientImage := "senthilrch/fledged-docker-client:latest"
 	busyboxImage := "senthilrch/busybox:1.35.0"
 	imagePullPolicy := imagepullpolicy
 	serviceAccountName := serviceaccountname
-	imageDeleteJobHostNetwork := imagedeletejobhostnetwork
 	jobPriorityClassName := jobpriorityclassname
 	canDeleteJob := candeletejob
 	socketPath := criSocketPath
@@ -61,8 +63,9 @@ func newTestImageManager(kubeclientset kubernetes.Interface, imagepullpolicy str
 
 	imagemanager, podInformer := NewImageManager(imagecacheworkqueue, imageworkqueue, kubeclientset,
 		fledgedNameSpace, imagePullDeadlineDuration, criClientImage, busyboxImage, imagePullPolicy,
-		serviceAccountName, imageDeleteJobHostNetwork, jobPriorityClassName, canDeleteJob, socketPath)
+		serviceAccountName, jobPriorityClassName, canDeleteJob, socketPath, JobOptions{}, klog.Background())
 	imagemanager.podsSynced = func() bool { return true }
+	imagemanager.jobsSynced = func() bool { return true }
 
 	return imagemanager, podInformer
 }
@@ -218,7 +221,7 @@ func TestPullDeleteImage(t *testing.T) {
 			})
 		}
 
-		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
 			"priority-class-kube-fledged", false, "")
 		var err error
 		if test.action == "pullimage" {
@@ -317,7 +320,7 @@ func TestHandlePodStatusChange(t *testing.T) {
 	}
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
-		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
 			"priority-class-kube-fledged", false, "")
 		imagemanager.imageworkstatus[test.pod.Labels["job-name"]] = ImageWorkResult{
 			Status: ImageWorkResultStatusJobCreated,
@@ -341,6 +344,79 @@ func TestHandlePodStatusChange(t *testing.T) {
 	}
 }
 
+func TestHandlePodStatusChangeRetries(t *testing.T) {
+	failedPod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"job-name": "fakejob"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+		},
+	}
+	succeededPod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"job-name": "fakejob"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+		},
+	}
+	tests := []struct {
+		name            string
+		pods            []corev1.Pod
+		expectedStatus  string
+		expectedRetries int32
+	}{
+		{
+			name:            "#1: Succeeded on first attempt",
+			pods:            []corev1.Pod{succeededPod},
+			expectedStatus:  ImageWorkResultStatusSucceeded,
+			expectedRetries: 0,
+		},
+		{
+			name:            "#2: Failed attempt is retried",
+			pods:            []corev1.Pod{failedPod},
+			expectedStatus:  ImageWorkResultStatusJobCreated,
+			expectedRetries: 1,
+		},
+		{
+			name:            "#3: Succeeded after retries",
+			pods:            []corev1.Pod{failedPod, failedPod, succeededPod},
+			expectedStatus:  ImageWorkResultStatusSucceededAfterRetries,
+			expectedRetries: 2,
+		},
+		{
+			name:            "#4: Failed after backoff limit is exhausted",
+			pods:            []corev1.Pod{failedPod, failedPod, failedPod},
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedRetries: 2,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.JobBackoffLimit = 2
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				WorkType: ImageCacheCreate,
+				Node:     &node,
+			},
+		}
+		for i := range test.pods {
+			imagemanager.handlePodStatusChange(&test.pods[i])
+		}
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+		}
+		if iwres.Retries != test.expectedRetries {
+			t.Errorf("Test: %s failed: expectedRetries=%d, actualRetries=%d", test.name, test.expectedRetries, iwres.Retries)
+		}
+	}
+}
+
 func TestUpdateImageCacheStatus(t *testing.T) {
 	imageCacheName := "fakeimagecache"
 	imageCache := &fledgedv1alpha3.ImageCache{
@@ -631,7 +707,7 @@ func TestUpdateImageCacheStatus(t *testing.T) {
 				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
 			})
 		}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged", false,
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
 			"priority-class-kube-fledged", false, "")
 		for _, pod := range test.pods {
 			if !reflect.DeepEqual(pod, corev1.Pod{}) {
@@ -658,6 +734,225 @@ func TestUpdateImageCacheStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateImageCacheStatusPullTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		workType        WorkType
+		retries         int32
+		waiting         *corev1.ContainerStateWaiting
+		expectedReason  string
+		expectedMessage string
+		expectedRetries int32
+		expectedJobs    int
+	}{
+		{
+			name:            "#1: Pull that never completes times out",
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonPullTimedOut,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessagePullTimedOut,
+		},
+		{
+			name:            "#2: Timed out pull reports the state of its pod",
+			waiting:         &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonPullTimedOut,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessagePullTimedOut + " (ImagePullBackOff: Back-off pulling image)",
+		},
+		{
+			name:            "#3: Timed out pull is retried with a new job",
+			retries:         2,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonPullTimedOut,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessagePullTimedOut,
+			expectedRetries: 2,
+			expectedJobs:    2,
+		},
+		{
+			name:            "#4: Expired delete job is not reported as a timed out pull",
+			workType:        ImageCachePurge,
+			retries:         2,
+			waiting:         &corev1.ContainerStateWaiting{Reason: "fakereason", Message: "fakemessage"},
+			expectedReason:  "fakereason",
+			expectedMessage: "fakemessage",
+		},
+	}
+	for _, test := range tests {
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ImagePullDeadline:       &metav1.Duration{Duration: 10 * time.Millisecond},
+				ImagePullTimeoutRetries: test.retries,
+			},
+		}
+		// the pods of the jobs never complete
+		newPod := func(job string) *corev1.Pod {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: job, Namespace: fledgedNameSpace, Labels: map[string]string{"job-name": job}},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+			if test.waiting != nil {
+				pod.Status.Phase = corev1.PodPending
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{Waiting: test.waiting}}}
+			}
+			return pod
+		}
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		// the deadline of the image cache overrides the controller-wide deadline
+		imagemanager.imagePullDeadlineDuration = time.Hour
+		fakekubeclientset.PrependReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+			job.Name = names.SimpleNameGenerator.GenerateName(job.GenerateName)
+			podInformer.Informer().GetIndexer().Add(newPod(job.Name))
+			return true, job, nil
+		})
+		podInformer.Informer().GetIndexer().Add(newPod("fakejob"))
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"fakejob": {
+				ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: test.workType, Imagecache: imageCache},
+				Status:           ImageWorkResultStatusJobCreated,
+			},
+		}
+		errCh := make(chan error)
+		go imagemanager.updateImageCacheStatus(imageCache, errCh)
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Test: %s failed: image pull deadline of the image cache not applied", test.name)
+			continue
+		}
+		item, _ := imagemanager.workqueue.Get()
+		results := *item.(WorkQueueKey).Status
+		if len(results) != 1 {
+			t.Errorf("Test: %s failed: expectedResults=1, actualResults=%d", test.name, len(results))
+			continue
+		}
+		for _, iwres := range results {
+			if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+				t.Errorf("Test: %s failed: expectedReason=%s, expectedMessage=%s, actualStatus=%s, actualReason=%s, actualMessage=%s",
+					test.name, test.expectedReason, test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message)
+			}
+			if iwres.TimeoutRetries != test.expectedRetries {
+				t.Errorf("Test: %s failed: expectedRetries=%d, actualRetries=%d", test.name, test.expectedRetries, iwres.TimeoutRetries)
+			}
+		}
+		if jobs := createdJobs(fakekubeclientset); jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+	}
+}
+
+func TestFailedPullRetries(t *testing.T) {
+	tests := []struct {
+		name                   string
+		workType               WorkType
+		reason                 string
+		retries                int32
+		retriedPullsSucceed    bool
+		expectedStatus         string
+		expectedFailureRetries int32
+		expectedJobs           int
+	}{
+		{
+			name:           "#1: Failed pull is not retried by default",
+			reason:         "fakereason",
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+		{
+			name:                   "#2: Failed pull is retried up to the failed pull retries",
+			reason:                 "fakereason",
+			retries:                2,
+			expectedStatus:         ImageWorkResultStatusFailed,
+			expectedFailureRetries: 2,
+			expectedJobs:           2,
+		},
+		{
+			name:                   "#3: Retried pull succeeds after retries",
+			reason:                 "fakereason",
+			retries:                2,
+			retriedPullsSucceed:    true,
+			expectedStatus:         ImageWorkResultStatusSucceededAfterRetries,
+			expectedFailureRetries: 1,
+			expectedJobs:           1,
+		},
+		{
+			name:           "#4: Rate-limited pull is not retried",
+			reason:         fledgedv1alpha3.ImageCacheReasonRateLimited,
+			retries:        2,
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+		{
+			name:           "#5: Failed delete is not retried",
+			workType:       ImageCachePurge,
+			reason:         "fakereason",
+			retries:        2,
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				ImagePullDeadline: &metav1.Duration{Duration: time.Minute},
+				FailedPullRetries: test.retries,
+			},
+		}
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		// the pods of the retried jobs finish once the image manager recorded the jobs
+		phase := corev1.PodFailed
+		if test.retriedPullsSucceed {
+			phase = corev1.PodSucceeded
+		}
+		fakekubeclientset.PrependReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+			job.Name = names.SimpleNameGenerator.GenerateName(job.GenerateName)
+			go imagemanager.handlePodStatusChange(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job-name": job.Name}},
+				Status:     corev1.PodStatus{Phase: phase},
+			})
+			return true, job, nil
+		})
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			fakeJobPrefix + "1": {
+				ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: test.workType, Imagecache: imageCache},
+				Status:           ImageWorkResultStatusFailed,
+				Reason:           test.reason,
+			},
+		}
+		errCh := make(chan error)
+		go imagemanager.updateImageCacheStatus(imageCache, errCh)
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+				continue
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Test: %s failed: retried pull jobs not completed", test.name)
+			continue
+		}
+		item, _ := imagemanager.workqueue.Get()
+		results := *item.(WorkQueueKey).Status
+		if len(results) != 1 {
+			t.Errorf("Test: %s failed: expectedResults=1, actualResults=%d", test.name, len(results))
+			continue
+		}
+		for _, iwres := range results {
+			if iwres.Status != test.expectedStatus || iwres.FailureRetries != test.expectedFailureRetries {
+				t.Errorf("Test: %s failed: expectedStatus=%s, expectedFailureRetries=%d, actualStatus=%s, actualFailureRetries=%d",
+					test.name, test.expectedStatus, test.expectedFailureRetries, iwres.Status, iwres.FailureRetries)
+			}
+		}
+		if jobs := createdJobs(fakekubeclientset); jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+	}
+}
+
 func TestProcessNextWorkItem(t *testing.T) {
 	defaultImageCache := fledgedv1alpha3.ImageCache{
 		ObjectMeta: metav1.ObjectMeta{
@@ -916,7 +1211,7 @@ func TestProcessNextWorkItem(t *testing.T) {
 	}
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, test.imagepullpolicy, "sa-kube-fledged", false,
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, test.imagepullpolicy, "sa-kube-fledged",
 			"priority-class-kube-fledged", false, "")
 		for _, pod := range test.pods {
 			if !reflect.DeepEqual(pod, corev1.Pod{}) {
@@ -942,3 +1237,786 @@ func TestProcessNextWorkItem(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessNextWorkItemImagePullPolicyNever(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	testnode := node
+	testnode.Status.Images = []corev1.ContainerImage{
+		{
+			Names: []string{"docker.io/library/foo:v1"},
+		},
+	}
+	tests := []struct {
+		name           string
+		image          string
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Image present in node",
+			image:          "foo:v1",
+			expectedStatus: ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:           "#2: Image missing in node",
+			image:          "foo:v2",
+			expectedStatus: ImageWorkResultStatusImageMissing,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonImageMissing,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "Never", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      test.image,
+			Node:       &testnode,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &defaultImageCache,
+		})
+		imagemanager.processNextWorkItem()
+		if len(fakekubeclientset.Actions()) != 0 {
+			t.Errorf("Test: %s failed: expectedActions=0, actualActions=%d", test.name, len(fakekubeclientset.Actions()))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for job, iwres := range imagemanager.imageworkstatus {
+			if !strings.HasPrefix(job, fakeJobPrefix) {
+				t.Errorf("Test: %s failed: expected fake job, actual job=%s", test.name, job)
+			}
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, iwres.Reason)
+			}
+		}
+	}
+}
+
+// newJobCreatingClientset returns a fake clientset that generates the names of the jobs it creates
+func TestProcessNextWorkItemSkipped(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	newNode := func(hostname, architecture string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   hostname,
+				Labels: map[string]string{"kubernetes.io/hostname": hostname},
+			},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{Architecture: architecture},
+			},
+		}
+	}
+	amd64Node := newNode("amd64-node", "amd64")
+	arm64Node := newNode("arm64-node", "arm64")
+	cordonedNode := newNode("cordoned-node", "amd64")
+	cordonedNode.Spec = corev1.NodeSpec{
+		Unschedulable: true,
+		Taints: []corev1.Taint{
+			{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule},
+		},
+	}
+	tests := []struct {
+		name                      string
+		architectures             []string
+		node                      *corev1.Node
+		workType                  WorkType
+		cacheOnUnschedulableNodes bool
+		expectedJobs              int
+		expectedStatus            string
+		expectedReason            string
+	}{
+		{
+			name:           "#1: Image for all architectures pulled on arm64 node",
+			node:           arm64Node,
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: amd64 image pulled on amd64 node",
+			architectures:  []string{"amd64"},
+			node:           amd64Node,
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#3: amd64 image skipped on arm64 node",
+			architectures:  []string{"amd64"},
+			node:           arm64Node,
+			workType:       ImageCacheCreate,
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusSkipped,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonArchitectureMismatch,
+		},
+		{
+			name:           "#4: Multi-arch image pulled on arm64 node",
+			architectures:  []string{"amd64", "arm64"},
+			node:           arm64Node,
+			workType:       ImageCacheRefresh,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#5: Node not reporting its architecture is not skipped",
+			architectures:  []string{"amd64"},
+			node:           newNode("unknown-node", ""),
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name: "#6: Image skipped on node with a taint not tolerated",
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "cordoned-node", Labels: map[string]string{"kubernetes.io/hostname": "cordoned-node"}},
+				Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+					{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule},
+				}},
+			},
+			workType:       ImageCacheCreate,
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusSkipped,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonTaintNotTolerated,
+		},
+		{
+			name:           "#7: Image skipped on unschedulable node",
+			node:           cordonedNode,
+			workType:       ImageCacheCreate,
+			expectedJobs:   0,
+			expectedStatus: ImageWorkResultStatusSkipped,
+			expectedReason: fledgedv1alpha3.ImageCacheReasonNodeUnschedulable,
+		},
+		{
+			name:                      "#8: Image pulled on unschedulable node when caching on unschedulable nodes",
+			node:                      cordonedNode,
+			workType:                  ImageCacheRefresh,
+			cacheOnUnschedulableNodes: true,
+			expectedJobs:              1,
+			expectedStatus:            ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		imagecache := defaultImageCache
+		imagecache.Spec.CacheOnUnschedulableNodes = test.cacheOnUnschedulableNodes
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		architectures := test.architectures
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:         "foo:v1",
+			Architectures: &architectures,
+			Node:          test.node,
+			WorkType:      test.workType,
+			Imagecache:    &imagecache,
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, createdJobs(fakekubeclientset))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, test.expectedReason, iwres.Reason)
+			}
+		}
+	}
+}
+
+func TestProcessNextWorkItemDryRun(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			DryRun: true,
+		},
+	}
+	newNode := func(hostname string, images ...string) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   hostname,
+				Labels: map[string]string{"kubernetes.io/hostname": hostname},
+			},
+		}
+		for _, image := range images {
+			node.Status.Images = append(node.Status.Images, corev1.ContainerImage{Names: []string{image}})
+		}
+		return node
+	}
+	emptyNode := newNode("empty-node")
+	cachedNode := newNode("cached-node", "docker.io/library/foo:v1")
+	tests := []struct {
+		name               string
+		imagePullPolicy    string
+		maxPullJobsPerNode int
+		node               *corev1.Node
+		workType           WorkType
+		expectedStatus     string
+	}{
+		{
+			name:            "#1: Missing image would be pulled",
+			imagePullPolicy: "IfNotPresent",
+			node:            emptyNode,
+			workType:        ImageCacheCreate,
+			expectedStatus:  ImageWorkResultStatusWouldPull,
+		},
+		{
+			name:            "#2: Image present in node would not be pulled",
+			imagePullPolicy: "IfNotPresent",
+			node:            cachedNode,
+			workType:        ImageCacheCreate,
+			expectedStatus:  ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:            "#3: Image present in node would be pulled with pull policy Always",
+			imagePullPolicy: "Always",
+			node:            cachedNode,
+			workType:        ImageCacheRefresh,
+			expectedStatus:  ImageWorkResultStatusWouldPull,
+		},
+		{
+			name:               "#4: Pull job is not queued when pull jobs are throttled",
+			imagePullPolicy:    "IfNotPresent",
+			maxPullJobsPerNode: 1,
+			node:               emptyNode,
+			workType:           ImageCacheUpdate,
+			expectedStatus:     ImageWorkResultStatusWouldPull,
+		},
+		{
+			name:            "#5: Image would be deleted",
+			imagePullPolicy: "IfNotPresent",
+			node:            cachedNode,
+			workType:        ImageCachePurge,
+			expectedStatus:  ImageWorkResultStatusWouldDelete,
+		},
+	}
+	for _, test := range tests {
+		imagecache := defaultImageCache
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, test.imagePullPolicy, "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.MaxPullJobsPerNode = test.maxPullJobsPerNode
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      "foo:v1",
+			Node:       test.node,
+			WorkType:   test.workType,
+			Imagecache: &imagecache,
+		})
+		imagemanager.processNextWorkItem()
+		if createdJobs(fakekubeclientset) != 0 {
+			t.Errorf("Test: %s failed: expectedJobs=0, actualJobs=%d", test.name, createdJobs(fakekubeclientset))
+		}
+		if len(imagemanager.pendingPullJobs) != 0 {
+			t.Errorf("Test: %s failed: expectedPendingPullJobs=0, actualPendingPullJobs=%d", test.name, len(imagemanager.pendingPullJobs))
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedWorkResults=1, actualWorkResults=%d", test.name, len(imagemanager.imageworkstatus))
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+			}
+		}
+	}
+}
+
+func newJobCreatingClientset() *fakeclientset.Clientset {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		job := action.(core.CreateAction).GetObject().(*batchv1.Job).DeepCopy()
+		job.Name = names.SimpleNameGenerator.GenerateName(job.GenerateName)
+		return true, job, nil
+	})
+	return fakekubeclientset
+}
+
+// activeJobs returns the names of the jobs of the image manager that are not yet finished
+func activeJobs(imagemanager *ImageManager) []string {
+	jobs := []string{}
+	for job, iwres := range imagemanager.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusJobCreated {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// createdJobs returns the number of jobs created using the clientset
+func createdJobs(fakekubeclientset *fakeclientset.Clientset) int {
+	return len(createdJobKinds(fakekubeclientset))
+}
+
+// createdJobKinds returns the kinds of the jobs created using the clientset, in order: tag for the jobs tagging
+// the image, check for the jobs inspecting the image before any pull job (presence checks) and verify for those
+// inspecting it after, pull for the others
+func createdJobKinds(fakekubeclientset *fakeclientset.Clientset) []string {
+	kinds := []string{}
+	pulled := false
+	for _, action := range fakekubeclientset.Actions() {
+		if action.GetVerb() != "create" || action.GetResource().Resource != "jobs" {
+			continue
+		}
+		command := strings.Join(action.(core.CreateAction).GetObject().(*batchv1.Job).Spec.Template.Spec.Containers[0].Command, " ")
+		switch {
+		case strings.Contains(command, " tag "):
+			kinds = append(kinds, "tag")
+		case strings.Contains(command, "inspecti") && pulled:
+			kinds = append(kinds, "verify")
+		case strings.Contains(command, "inspecti"):
+			kinds = append(kinds, "check")
+		default:
+			kinds = append(kinds, "pull")
+			pulled = true
+		}
+	}
+	return kinds
+}
+
+// finishJob simulates the pod of the job succeeding
+func finishJob(imagemanager *ImageManager, job string) {
+	imagemanager.handlePodStatusChange(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"job-name": job},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+		},
+	})
+}
+
+func TestMaxPullJobsPerNode(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	maxPullJobsPerNode := 2
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.jobOptions.MaxPullJobsPerNode = maxPullJobsPerNode
+
+	for i := 0; i < 10; i++ {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      fmt.Sprintf("foo:v%d", i),
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &defaultImageCache,
+		})
+	}
+	for i := 0; i < 10; i++ {
+		imagemanager.processNextWorkItem()
+	}
+
+	// Finish the active jobs one at a time until all the images are pulled
+	for finished := 0; finished < 10; finished++ {
+		jobs := activeJobs(imagemanager)
+		if len(jobs) > maxPullJobsPerNode {
+			t.Fatalf("Test failed: expectedMaxActiveJobs=%d, actualActiveJobs=%d", maxPullJobsPerNode, len(jobs))
+		}
+		if len(jobs) == 0 {
+			t.Fatalf("Test failed: no active jobs after %d of 10 jobs finished", finished)
+		}
+		if expected := finished + len(jobs); createdJobs(fakekubeclientset) != expected {
+			t.Errorf("Test failed: expectedCreatedJobs=%d, actualCreatedJobs=%d", expected, createdJobs(fakekubeclientset))
+		}
+		finishJob(imagemanager, jobs[0])
+	}
+	if jobs := activeJobs(imagemanager); len(jobs) != 0 {
+		t.Errorf("Test failed: expectedActiveJobs=0, actualActiveJobs=%d", len(jobs))
+	}
+	if createdJobs(fakekubeclientset) != 10 {
+		t.Errorf("Test failed: expectedCreatedJobs=10, actualCreatedJobs=%d", createdJobs(fakekubeclientset))
+	}
+	for job, iwres := range imagemanager.imageworkstatus {
+		if iwres.Status != ImageWorkResultStatusSucceeded {
+			t.Errorf("Test failed: job=%s, expectedWorkResult=%s, actualWorkResult=%s", job, ImageWorkResultStatusSucceeded, iwres.Status)
+		}
+	}
+}
+
+func TestMaxConcurrentPullJobs(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	maxConcurrentPullJobs := 10
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.jobOptions.MaxConcurrentPullJobs = maxConcurrentPullJobs
+
+	for i := 0; i < 100; i++ {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image: "foo:v1",
+			Node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"kubernetes.io/hostname": fmt.Sprintf("node%d", i)},
+				},
+			},
+			WorkType:   ImageCacheCreate,
+			Imagecache: &defaultImageCache,
+		})
+	}
+	for i := 0; i < 100; i++ {
+		imagemanager.processNextWorkItem()
+	}
+
+	// Finish the active jobs a few at a time until all the images are pulled
+	for finished := 0; finished < 100; {
+		jobs := activeJobs(imagemanager)
+		if len(jobs) > maxConcurrentPullJobs {
+			t.Fatalf("Test failed: expectedMaxActiveJobs=%d, actualActiveJobs=%d", maxConcurrentPullJobs, len(jobs))
+		}
+		if expected := maxConcurrentPullJobs; finished+expected <= 100 && len(jobs) != expected {
+			t.Errorf("Test failed: expectedActiveJobs=%d, actualActiveJobs=%d", expected, len(jobs))
+		}
+		if len(jobs) == 0 {
+			t.Fatalf("Test failed: no active jobs after %d of 100 jobs finished", finished)
+		}
+		for i := 0; i < 3 && i < len(jobs); i++ {
+			finishJob(imagemanager, jobs[i])
+			finished++
+		}
+	}
+	if createdJobs(fakekubeclientset) != 100 {
+		t.Errorf("Test failed: expectedCreatedJobs=100, actualCreatedJobs=%d", createdJobs(fakekubeclientset))
+	}
+}
+
+func TestPullJobFairness(t *testing.T) {
+	bigImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "big",
+			Namespace: "kube-fledged",
+		},
+	}
+	smallImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "small",
+			Namespace: "kube-fledged",
+		},
+	}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.jobOptions.MaxConcurrentPullJobs = 2
+
+	// The big image cache is queued before the small one
+	for i := 0; i < 20; i++ {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      fmt.Sprintf("foo:v%d", i),
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &bigImageCache,
+		})
+	}
+	imagemanager.imageworkqueue.Add(ImageWorkRequest{
+		Image:      "bar:v1",
+		Node:       &node,
+		WorkType:   ImageCacheCreate,
+		Imagecache: &smallImageCache,
+	})
+	for i := 0; i < 21; i++ {
+		imagemanager.processNextWorkItem()
+	}
+
+	// The next free slot goes to the small image cache which has no active pull jobs
+	finishJob(imagemanager, activeJobs(imagemanager)[0])
+	smallImageCacheActive := false
+	for _, job := range activeJobs(imagemanager) {
+		if imagemanager.imageworkstatus[job].ImageWorkRequest.Imagecache.Name == smallImageCache.Name {
+			smallImageCacheActive = true
+		}
+	}
+	if !smallImageCacheActive {
+		t.Errorf("Test failed: expected a pull job of image cache %s to be active", smallImageCache.Name)
+	}
+}
+
+func TestPullJobPriority(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.jobOptions.MaxConcurrentPullJobs = 1
+
+	// The first request takes the only pull job slot, the others are queued
+	for _, image := range []struct {
+		name     string
+		priority int32
+	}{{"envoy:v1", 0}, {"fluentd:v1", 0}, {"app:v1", 10}, {"init:v1", 5}, {"statsd:v1", 0}} {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      image.name,
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &defaultImageCache,
+			Priority:   image.priority,
+		})
+	}
+	for i := 0; i < 5; i++ {
+		imagemanager.processNextWorkItem()
+	}
+
+	// Queued images of higher priority get the slot first
+	expectedImages := []string{"envoy:v1", "app:v1", "init:v1", "fluentd:v1", "statsd:v1"}
+	actualImages := []string{}
+	for len(actualImages) < len(expectedImages) {
+		jobs := activeJobs(imagemanager)
+		if len(jobs) != 1 {
+			t.Fatalf("Test failed: expectedActiveJobs=1, actualActiveJobs=%d", len(jobs))
+		}
+		actualImages = append(actualImages, imagemanager.imageworkstatus[jobs[0]].ImageWorkRequest.Image)
+		finishJob(imagemanager, jobs[0])
+	}
+	if !reflect.DeepEqual(actualImages, expectedImages) {
+		t.Errorf("Test failed: expectedImages=%v, actualImages=%v", expectedImages, actualImages)
+	}
+}
+
+func TestRolloutMaxUnavailableNodes(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	// maxUnavailable 25% of 8 nodes
+	maxUnavailableNodes := 2
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+
+	for i := 0; i < 8; i++ {
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{"kubernetes.io/hostname": fmt.Sprintf("node%d", i)},
+			},
+		}
+		for _, image := range []string{"foo:v1", "bar:v1"} {
+			imagemanager.imageworkqueue.Add(ImageWorkRequest{
+				Image:               image,
+				Node:                n,
+				WorkType:            ImageCacheRefresh,
+				Imagecache:          &defaultImageCache,
+				MaxUnavailableNodes: maxUnavailableNodes,
+			})
+		}
+	}
+	for i := 0; i < 16; i++ {
+		imagemanager.processNextWorkItem()
+	}
+	// Both images are pulled to 2 nodes at a time, in 4 batches
+	if jobs := activeJobs(imagemanager); len(jobs) != 4 {
+		t.Errorf("Test failed: expectedActiveJobs=4, actualActiveJobs=%d", len(jobs))
+	}
+	if rounds := imagemanager.pullJobRounds(imageCacheKey(&defaultImageCache)); rounds != 4 {
+		t.Errorf("Test failed: expectedPullJobRounds=4, actualPullJobRounds=%d", rounds)
+	}
+
+	// Finish the active jobs one at a time until the image cache is refreshed on all the nodes
+	for finished := 0; finished < 16; finished++ {
+		jobs := activeJobs(imagemanager)
+		nodes := map[string]bool{}
+		for _, job := range jobs {
+			nodes[imagemanager.imageworkstatus[job].ImageWorkRequest.Node.Labels["kubernetes.io/hostname"]] = true
+		}
+		if len(nodes) > maxUnavailableNodes {
+			t.Fatalf("Test failed: expectedMaxRefreshingNodes=%d, actualRefreshingNodes=%d", maxUnavailableNodes, len(nodes))
+		}
+		if len(jobs) == 0 {
+			t.Fatalf("Test failed: no active jobs after %d of 16 jobs finished", finished)
+		}
+		finishJob(imagemanager, jobs[0])
+	}
+	if createdJobs(fakekubeclientset) != 16 {
+		t.Errorf("Test failed: expectedCreatedJobs=16, actualCreatedJobs=%d", createdJobs(fakekubeclientset))
+	}
+}
+
+func TestRolloutMaxUnavailableNodesPerGroup(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	// 3 zones of 3 nodes, maxUnavailablePerGroup 1
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+	maxUnavailableNodesPerGroup := 1
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+
+	for i := 0; i < 9; i++ {
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{"kubernetes.io/hostname": fmt.Sprintf("node%d", i), "topology.kubernetes.io/zone": zones[i%3]},
+			},
+		}
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                       "foo:v1",
+			Node:                        n,
+			WorkType:                    ImageCacheRefresh,
+			Imagecache:                  &defaultImageCache,
+			NodeGroup:                   zones[i%3],
+			MaxUnavailableNodesPerGroup: maxUnavailableNodesPerGroup,
+		})
+	}
+	for i := 0; i < 9; i++ {
+		imagemanager.processNextWorkItem()
+	}
+	// The zones are refreshed in parallel, one node of each zone at a time, in 3 batches
+	if jobs := activeJobs(imagemanager); len(jobs) != 3 {
+		t.Errorf("Test failed: expectedActiveJobs=3, actualActiveJobs=%d", len(jobs))
+	}
+	if rounds := imagemanager.pullJobRounds(imageCacheKey(&defaultImageCache)); rounds != 3 {
+		t.Errorf("Test failed: expectedPullJobRounds=3, actualPullJobRounds=%d", rounds)
+	}
+
+	// Finish the active jobs one at a time until the image cache is refreshed on all the nodes
+	for finished := 0; finished < 9; finished++ {
+		jobs := activeJobs(imagemanager)
+		nodesPerZone := map[string]int{}
+		for _, job := range jobs {
+			nodesPerZone[imagemanager.imageworkstatus[job].ImageWorkRequest.NodeGroup]++
+		}
+		for zone, nodes := range nodesPerZone {
+			if nodes > maxUnavailableNodesPerGroup {
+				t.Fatalf("Test failed: expectedMaxRefreshingNodes=%d, actualRefreshingNodes=%d in %s", maxUnavailableNodesPerGroup, nodes, zone)
+			}
+		}
+		// every zone with nodes left to refresh has a node refreshing
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status == ImageWorkResultStatusJobQueued && nodesPerZone[iwres.ImageWorkRequest.NodeGroup] == 0 {
+				t.Fatalf("Test failed: expectedRefreshingNodes=1, actualRefreshingNodes=0 in %s after %d of 9 jobs finished",
+					iwres.ImageWorkRequest.NodeGroup, finished)
+			}
+		}
+		if len(jobs) == 0 {
+			t.Fatalf("Test failed: no active jobs after %d of 9 jobs finished", finished)
+		}
+		finishJob(imagemanager, jobs[0])
+	}
+	if createdJobs(fakekubeclientset) != 9 {
+		t.Errorf("Test failed: expectedCreatedJobs=9, actualCreatedJobs=%d", createdJobs(fakekubeclientset))
+	}
+}
+
+func TestImageManagerStructuredLogging(t *testing.T) {
+	imagecache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	request := `"imagecache"="kube-fledged/foo" "image"="nginx:1.25" "node"="bar"`
+	tests := []struct {
+		name                string
+		workType            WorkType
+		maxUnavailableNodes int
+		finishedByJob       bool
+		expectedLines       []string
+	}{
+		{
+			name:     "#1: Image pull logged with the image cache, image and node",
+			workType: ImageCacheCreate,
+			expectedLines: []string{
+				`"level"=0 "msg"="Job created" ` + request + ` "job"="foo-`,
+				`"level"=0 "msg"="Job succeeded" ` + request + ` "job"="foo-`,
+			},
+		},
+		{
+			name:     "#2: Image delete logged with the image cache, image and node",
+			workType: ImageCachePurge,
+			expectedLines: []string{
+				`"level"=0 "msg"="Job created" ` + request + ` "job"="foo-`,
+				`"level"=0 "msg"="Job succeeded" ` + request + ` "job"="foo-`,
+			},
+		},
+		{
+			name:                "#3: Throttled image pull logged with the image cache, image and node",
+			workType:            ImageCacheRefresh,
+			maxUnavailableNodes: 1,
+			expectedLines: []string{
+				`"level"=0 "msg"="Job queued" ` + request + ` "action"="pull"`,
+				`"level"=0 "msg"="Job created" ` + request + ` "job"="foo-`,
+				`"level"=0 "msg"="Job succeeded" ` + request + ` "job"="foo-`,
+			},
+		},
+		{
+			name:          "#4: Image pull finished by its job logged with the image cache, image and node",
+			workType:      ImageCacheCreate,
+			finishedByJob: true,
+			expectedLines: []string{
+				`"level"=0 "msg"="Job created" ` + request + ` "job"="foo-`,
+				`"level"=0 "msg"="Job finished" ` + request + ` "job"="foo-`,
+			},
+		},
+	}
+	for _, test := range tests {
+		lines := []string{}
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.logger = funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{})
+		// the image to delete is present on the node
+		testnode := node
+		if test.workType == ImageCachePurge {
+			testnode.Status.Images = []corev1.ContainerImage{{Names: []string{"docker.io/library/nginx:1.25"}}}
+		}
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:               "nginx:1.25",
+			Node:                &testnode,
+			WorkType:            test.workType,
+			Imagecache:          &imagecache,
+			MaxUnavailableNodes: test.maxUnavailableNodes,
+		})
+		imagemanager.processNextWorkItem()
+		for _, job := range activeJobs(imagemanager) {
+			if test.finishedByJob {
+				imagemanager.jobEventHandler().AddFunc(finishedJob(&imagecache, job, batchv1.JobComplete, "", ""))
+				continue
+			}
+			finishJob(imagemanager, job)
+		}
+		for _, expected := range test.expectedLines {
+			found := false
+			for _, line := range lines {
+				found = found || strings.HasPrefix(line, expected)
+			}
+			if !found {
+				t.Errorf("Test: %s failed: expectedLine=%s, actualLines=%q", test.name, expected, lines)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Waiting reasons of containers whose image cannot be pulled, as reported by the kubelet
+const (
+	waitingReasonErrImagePull     = "ErrImagePull"
+	waitingReasonImagePullBackOff = "ImagePullBackOff"
+)
+
+// imagePullBackOff returns the container of the pod waiting because its image cannot be pulled, if any
+func imagePullBackOff(pod *corev1.Pod) (*corev1.ContainerStateWaiting, bool) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if w := s.State.Waiting; w != nil && (w.Reason == waitingReasonErrImagePull || w.Reason == waitingReasonImagePullBackOff) {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// handlePodPending fails the job of a pending pod whose image cannot be pulled, instead of waiting for
+// the image pull deadline. The image pull is retried by the kubelet for the image pull back-off grace
+// period, so that transient registry or network errors do not fail the job. The job is deleted, which
+// stops its pod from retrying the pull.
+func (m *ImageManager) handlePodPending(pod *corev1.Pod) {
+	job := pod.Labels["job-name"]
+	m.lock.Lock()
+	iwres, ok := m.imageworkstatus[job]
+	if !ok || iwres.Status != ImageWorkResultStatusJobCreated {
+		m.lock.Unlock()
+		return
+	}
+	waiting, backOff := imagePullBackOff(pod)
+	if !backOff {
+		// the image got pulled after all
+		if !iwres.ImagePullBackOffSince.IsZero() {
+			iwres.ImagePullBackOffSince = time.Time{}
+			iwres.ImagePullError = ""
+			m.imageworkstatus[job] = iwres
+		}
+		m.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	if iwres.ImagePullBackOffSince.IsZero() {
+		iwres.ImagePullBackOffSince = now
+	}
+	// the message of ErrImagePull has the error of the registry, the message of ImagePullBackOff only the image
+	if waiting.Reason == waitingReasonErrImagePull || iwres.ImagePullError == "" {
+		iwres.ImagePullError = waiting.Message
+	}
+	if now.Sub(iwres.ImagePullBackOffSince) < m.jobOptions.ImagePullBackOffGracePeriod {
+		klog.V(4).Infof("Job %s waiting for image pull back-off grace period (%s: %s)", job, waiting.Reason, waiting.Message)
+		m.imageworkstatus[job] = iwres
+		m.lock.Unlock()
+		return
+	}
+	iwres.Status = ImageWorkResultStatusFailed
+	iwres.Reason = waiting.Reason
+	iwres.Message = iwres.ImagePullError
+	m.classifyRateLimited(&iwres)
+	m.imageworkstatus[job] = iwres
+	m.lock.Unlock()
+	if iwres.HelperImageCheck {
+		m.finishHelperImageCheck(job, iwres)
+	}
+	m.notifyImageWorkResult(iwres.ImageWorkRequest)
+	m.notifySharedJob(job)
+	if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
+		klog.Infof("Job %s failed, image cannot be pulled (delete: %s --> %s): %s", job, iwres.ImageWorkRequest.Image,
+			iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.Message)
+	} else {
+		klog.Infof("Job %s failed, image cannot be pulled (pull: %s --> %s): %s", job, iwres.ImageWorkRequest.Image,
+			iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.Message)
+	}
+
+	// the job is deleted whatever the job retention policy, as its pod would keep retrying the pull
+	deletePropagation := metav1.DeletePropagationBackground
+	if err := m.kubeclientset.BatchV1().Jobs(pod.Namespace).
+		Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+		klog.Errorf("Error deleting job %s: %v", job, err)
+	}
+	if m.pullJobThrottled(iwres.ImageWorkRequest) && iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+		m.dispatchPullJobs()
+	}
+}
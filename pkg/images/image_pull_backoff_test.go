@@ -0,0 +1,203 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func waitingContainer(reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+	}
+}
+
+func TestHandlePodPending(t *testing.T) {
+	const registryError = "rpc error: code = Unknown desc = failed to pull and unpack image \"docker.io/library/nginx:404\": not found"
+	tests := []struct {
+		name                 string
+		worktype             WorkType
+		gracePeriod          time.Duration
+		backOffSince         time.Duration
+		imagePullError       string
+		status               corev1.PodStatus
+		expectedStatus       string
+		expectedReason       string
+		expectedMessage      string
+		expectedBackOff      bool
+		expectedImagePullErr string
+		expectedJobDeleted   bool
+	}{
+		{
+			name:     "#1: Pull fails at the first failed pull without grace period",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer(waitingReasonErrImagePull, registryError)},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     waitingReasonErrImagePull,
+			expectedMessage:    registryError,
+			expectedJobDeleted: true,
+		},
+		{
+			name:           "#2: ImagePullBackOff reports the error of the registry",
+			worktype:       ImageCacheCreate,
+			imagePullError: registryError,
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					waitingContainer(waitingReasonImagePullBackOff, "Back-off pulling image \"nginx:404\""),
+				},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     waitingReasonImagePullBackOff,
+			expectedMessage:    registryError,
+			expectedJobDeleted: true,
+		},
+		{
+			name:        "#3: Failed pull within the grace period is retried",
+			worktype:    ImageCacheCreate,
+			gracePeriod: 30 * time.Second,
+			status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer(waitingReasonErrImagePull, registryError)},
+			},
+			expectedStatus:       ImageWorkResultStatusJobCreated,
+			expectedBackOff:      true,
+			expectedImagePullErr: registryError,
+		},
+		{
+			name:         "#4: Pull still backing off after the grace period fails",
+			worktype:     ImageCacheCreate,
+			gracePeriod:  30 * time.Second,
+			backOffSince: time.Minute,
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					waitingContainer(waitingReasonImagePullBackOff, "Back-off pulling image \"nginx:404\""),
+				},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     waitingReasonImagePullBackOff,
+			expectedMessage:    "Back-off pulling image \"nginx:404\"",
+			expectedJobDeleted: true,
+		},
+		{
+			name:     "#5: Init container unable to pull the busybox image",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{
+					waitingContainer(waitingReasonErrImagePull, "pull access denied for busybox"),
+				},
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer("PodInitializing", "")},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     waitingReasonErrImagePull,
+			expectedMessage:    "pull access denied for busybox",
+			expectedJobDeleted: true,
+		},
+		{
+			name:           "#6: Image pulled within the grace period",
+			worktype:       ImageCacheCreate,
+			gracePeriod:    30 * time.Second,
+			backOffSince:   10 * time.Second,
+			imagePullError: registryError,
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:     "#7: Delete job unable to pull the cri client image",
+			worktype: ImageCachePurge,
+			status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer(waitingReasonErrImagePull, registryError)},
+			},
+			expectedStatus:     ImageWorkResultStatusFailed,
+			expectedReason:     waitingReasonErrImagePull,
+			expectedMessage:    registryError,
+			expectedJobDeleted: true,
+		},
+		{
+			name:     "#8: Pod scheduled and creating its container",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer("ContainerCreating", "")},
+			},
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.ImagePullBackOffGracePeriod = test.gracePeriod
+		iwres := ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				Image:    "nginx:404",
+				WorkType: test.worktype,
+				Node:     &node,
+			},
+			ImagePullError: test.imagePullError,
+		}
+		if test.backOffSince > 0 {
+			iwres.ImagePullBackOffSince = time.Now().Add(-test.backOffSince)
+		}
+		imagemanager.imageworkstatus["fakejob"] = iwres
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-fledged", Labels: map[string]string{"job-name": "fakejob"}},
+			Status:     test.status,
+		}
+		imagemanager.handlePodPending(pod)
+
+		actual := imagemanager.imageworkstatus["fakejob"]
+		if actual.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, actual.Status)
+		}
+		if test.expectedStatus == ImageWorkResultStatusFailed && (actual.Reason != test.expectedReason || actual.Message != test.expectedMessage) {
+			t.Errorf("Test: %s failed: expectedReason=%s, expectedMessage=%s, actualReason=%s, actualMessage=%s",
+				test.name, test.expectedReason, test.expectedMessage, actual.Reason, actual.Message)
+		}
+		if test.expectedStatus == ImageWorkResultStatusJobCreated &&
+			(actual.ImagePullBackOffSince.IsZero() == test.expectedBackOff || actual.ImagePullError != test.expectedImagePullErr) {
+			t.Errorf("Test: %s failed: expectedBackOff=%t, expectedImagePullError=%s, actualBackOffSince=%s, actualImagePullError=%s",
+				test.name, test.expectedBackOff, test.expectedImagePullErr, actual.ImagePullBackOffSince, actual.ImagePullError)
+		}
+		jobDeleted := false
+		for _, action := range fakekubeclientset.Actions() {
+			if action.Matches("delete", "jobs") {
+				jobDeleted = true
+			}
+		}
+		if jobDeleted != test.expectedJobDeleted {
+			t.Errorf("Test: %s failed: expectedJobDeleted=%t, actualJobDeleted=%t", test.name, test.expectedJobDeleted, jobDeleted)
+		}
+	}
+}
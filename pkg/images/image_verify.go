@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"fmt"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// newImageVerifyJob constructs a job manifest inspecting the image through the client of the container
+// runtime of the node, failing if the image is not present. An image pinned to a digest is inspected by
+// that digest. Like the image delete job, it is a short-lived job of the runtime client and gets the
+// settings of the image delete jobs.
+func newImageVerifyJob(imagecache *fledgedv1alpha3.ImageCache, image string, node *corev1.Node,
+	containerRuntimeVersion string, dockerclientimage string, serviceAccountName string,
+	jobPriorityClassName string, criSocketPath string, jobOptions JobOptions) (*batchv1.Job, error) {
+	if imagecache == nil {
+		klog.Error("imagecache pointer is nil")
+		return nil, fmt.Errorf("imagecache pointer is nil")
+	}
+	if isWindowsNode(node) {
+		return nil, fmt.Errorf("images are not verified on Windows nodes")
+	}
+	// jobs are labelled with the image of the cache, not the one pulled from its mirror
+	cachedImage := image
+	image = RewriteImageRef(image, jobOptions.RegistryMirrors)
+	runtime := detectContainerRuntime(containerRuntimeVersion, jobOptions.ContainerRuntime)
+	socketPath := resolveCRISocketPath(node, runtime, containerRuntimeVersion, criSocketPath, jobOptions.KubernetesDistribution)
+
+	job := criClientJob(imagecache, node.Labels["kubernetes.io/hostname"], jobLabels(imagecache, cachedImage),
+		criClientImage(imagecache, runtime, dockerclientimage),
+		buildVerifyCommand(runtime, socketPath, image, imagecache.Spec.ContainerdNamespace), socketPath)
+	setJobSecurityContext(job, imagecache.Spec.JobPodSecurityContext, imagecache.Spec.JobSecurityContext,
+		imagecache.Spec.JobSeccompProfile, deleteJobPodSecurityContext())
+	finishImageDeleteJob(job, imagecache, cachedImage, serviceAccountName, jobPriorityClassName, jobOptions)
+	return job, nil
+}
+
+// verifyImage verifies the image pulled to the node
+func (m *ImageManager) verifyImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	newjob, err := m.jobBuilder().VerifyJob(iwr)
+	if err != nil {
+		klog.Errorf("Error when constructing job manifest: %v", err)
+		return nil, err
+	}
+	// Create a Job to verify the image in the node
+	job, err := m.createJob(m.jobNamespace(iwr.Imagecache), newjob)
+	if err != nil {
+		klog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
+		return nil, err
+	}
+	m.startJobSpan(iwr, job.Name, "verify")
+	return job, nil
+}
+
+// verifiesPull checks whether the image of a succeeded pull is to be verified: the image cache verifies its
+// images and the image is stored by the container runtime of a Linux node
+func verifiesPull(iwres ImageWorkResult) bool {
+	iwr := iwres.ImageWorkRequest
+	return !iwres.Verification && iwr.WorkType != ImageCachePurge && iwr.Imagecache != nil &&
+		iwr.Imagecache.Spec.VerifyImages && storedByRuntime(iwr.ArtifactType) && iwr.Node != nil && !isWindowsNode(iwr.Node)
+}
+
+// pullSucceeded checks whether the job of the request succeeded
+func pullSucceeded(iwres ImageWorkResult) bool {
+	return iwres.Status == ImageWorkResultStatusSucceeded || iwres.Status == ImageWorkResultStatusSucceededAfterRetries
+}
+
+// startVerification replaces the succeeded pull job by a job verifying the pulled image, which then decides
+// the result of the request. The caller must hold m.lock.
+func (m *ImageManager) startVerification(job string, iwres ImageWorkResult) {
+	iwr := iwres.ImageWorkRequest
+	newJob, err := m.verifyImage(iwr)
+	if err != nil {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageVerificationFailed
+		iwres.Message = fmt.Sprintf("%s: error creating verification job: %v", fledgedv1alpha3.ImageCacheMessageImageVerificationFailed, err)
+		m.imageworkstatus[job] = iwres
+		return
+	}
+	m.requestLogger(iwr).Info("Job created", "job", newJob.Name, "action", "verify", "runtime", iwr.ContainerRuntimeVersion, "pullJob", job)
+	if m.canDeleteJob {
+		deletePropagation := metav1.DeletePropagationBackground
+		if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwr.Imagecache)).
+			Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+			klog.Errorf("Error deleting job %s: %v", job, err)
+		}
+	}
+	delete(m.imageworkstatus, job)
+	iwres.Status = ImageWorkResultStatusJobCreated
+	iwres.Verification = true
+	m.imageworkstatus[newJob.Name] = iwres
+	m.moveSharedJob(job, newJob.Name)
+}
+
+// verificationResult applies the result of a finished verification job to the result of the request
+func verificationResult(iwres *ImageWorkResult) {
+	if !iwres.Verification {
+		return
+	}
+	switch iwres.Status {
+	case ImageWorkResultStatusSucceeded, ImageWorkResultStatusSucceededAfterRetries:
+		iwres.Verified = true
+	case ImageWorkResultStatusFailed:
+		iwres.Message = verificationFailedMessage(iwres.Reason, iwres.Message)
+		iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageVerificationFailed
+	}
+}
+
+// verificationFailedMessage returns the message of a failed verification, given the reason and message
+// of the failure of its job if any
+func verificationFailedMessage(reason, message string) string {
+	if reason == "" {
+		return fledgedv1alpha3.ImageCacheMessageImageVerificationFailed
+	}
+	if message == "" {
+		return fmt.Sprintf("%s (%s)", fledgedv1alpha3.ImageCacheMessageImageVerificationFailed, reason)
+	}
+	return fmt.Sprintf("%s (%s: %s)", fledgedv1alpha3.ImageCacheMessageImageVerificationFailed, reason, message)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core "k8s.io/client-go/testing"
+)
+
+func TestImageVerification(t *testing.T) {
+	windowsNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "bar", corev1.LabelOSStable: "windows"},
+		},
+	}
+	failedPod := corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "no such image: foo:v1"},
+		}}},
+	}
+	tests := []struct {
+		name                string
+		verifyImages        bool
+		verification        bool
+		node                *corev1.Node
+		workType            WorkType
+		podStatus           corev1.PodStatus
+		expectedVerifyJob   bool
+		expectedStatus      string
+		expectedVerified    bool
+		expectedReason      string
+		expectedMessagePart string
+	}{
+		{
+			name:              "#1: Verification job is created after a successful pull",
+			verifyImages:      true,
+			node:              &node,
+			workType:          ImageCacheCreate,
+			podStatus:         corev1.PodStatus{Phase: corev1.PodSucceeded},
+			expectedVerifyJob: true,
+			expectedStatus:    ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Image is not verified unless the image cache verifies its images",
+			node:           &node,
+			workType:       ImageCacheCreate,
+			podStatus:      corev1.PodStatus{Phase: corev1.PodSucceeded},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#3: Image is not verified after a failed pull",
+			verifyImages:   true,
+			node:           &node,
+			workType:       ImageCacheCreate,
+			podStatus:      failedPod,
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: "Error",
+		},
+		{
+			name:           "#4: Image is not verified on Windows nodes",
+			verifyImages:   true,
+			node:           &windowsNode,
+			workType:       ImageCacheCreate,
+			podStatus:      corev1.PodStatus{Phase: corev1.PodSucceeded},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#5: Deleted image is not verified",
+			verifyImages:   true,
+			node:           &node,
+			workType:       ImageCachePurge,
+			podStatus:      corev1.PodStatus{Phase: corev1.PodSucceeded},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:             "#6: Succeeded verification marks the image verified",
+			verifyImages:     true,
+			verification:     true,
+			node:             &node,
+			workType:         ImageCacheCreate,
+			podStatus:        corev1.PodStatus{Phase: corev1.PodSucceeded},
+			expectedStatus:   ImageWorkResultStatusSucceeded,
+			expectedVerified: true,
+		},
+		{
+			name:                "#7: Failed verification fails the image",
+			verifyImages:        true,
+			verification:        true,
+			node:                &node,
+			workType:            ImageCacheCreate,
+			podStatus:           failedPod,
+			expectedStatus:      ImageWorkResultStatusFailed,
+			expectedReason:      fledgedv1alpha3.ImageCacheReasonImageVerificationFailed,
+			expectedMessagePart: "no such image: foo:v1",
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", true, "")
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{VerifyImages: test.verifyImages},
+		}
+		imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: test.node, WorkType: test.workType, Imagecache: imageCache,
+				ContainerRuntimeVersion: "containerd://1.6.8"},
+			Status:       ImageWorkResultStatusJobCreated,
+			Verification: test.verification,
+		}
+		imagemanager.handlePodStatusChange(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-1-abcde", Labels: map[string]string{"job-name": "foo-1"}},
+			Status:     test.podStatus,
+		})
+
+		var verifyJob *batchv1.Job
+		for _, action := range fakekubeclientset.Actions() {
+			if action.GetVerb() == "create" && action.GetResource().Resource == "jobs" {
+				verifyJob = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			}
+		}
+		if (verifyJob != nil) != test.expectedVerifyJob {
+			t.Errorf("Test: %s failed: expectedVerifyJob=%t, actualVerifyJob=%t", test.name, test.expectedVerifyJob, verifyJob != nil)
+			continue
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedResults=1, actualResults=%d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for job, actual := range imagemanager.imageworkstatus {
+			if test.expectedVerifyJob {
+				command := verifyJob.Spec.Template.Spec.Containers[0].Command
+				if job == "foo-1" || !actual.Verification || !strings.Contains(strings.Join(command, " "), "inspecti 'foo:v1'") {
+					t.Errorf("Test: %s failed: expected verification job inspecting foo:v1, actualJob=%s, actualVerification=%t, actualCommand=%v",
+						test.name, job, actual.Verification, command)
+				}
+			}
+			if actual.Status != test.expectedStatus || actual.Verified != test.expectedVerified {
+				t.Errorf("Test: %s failed: expectedStatus=%s, expectedVerified=%t, actualStatus=%s, actualVerified=%t",
+					test.name, test.expectedStatus, test.expectedVerified, actual.Status, actual.Verified)
+			}
+			if actual.Reason != test.expectedReason || !strings.Contains(actual.Message, test.expectedMessagePart) {
+				t.Errorf("Test: %s failed: expectedReason=%s, expectedMessagePart=%s, actualReason=%s, actualMessage=%s",
+					test.name, test.expectedReason, test.expectedMessagePart, actual.Reason, actual.Message)
+			}
+		}
+	}
+}
+
+func TestCompletedJobStartsVerification(t *testing.T) {
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+		Spec:       fledgedv1alpha3.ImageCacheSpec{VerifyImages: true},
+	}
+	imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	imagemanager.handleJobStatusChange(finishedJob(imageCache, "foo-1", batchv1.JobComplete, "", ""))
+
+	if createdJobs(fakekubeclientset) != 1 {
+		t.Errorf("Test: verification job created after job completion failed: expectedJobs=1, actualJobs=%d", createdJobs(fakekubeclientset))
+	}
+	if _, ok := imagemanager.imageworkstatus["foo-1"]; ok || len(activeJobs(imagemanager)) != 1 {
+		t.Errorf("Test: verification job created after job completion failed: expected result moved to the verification job, actualResults=%+v",
+			imagemanager.imageworkstatus)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageJobBuilder constructs the manifests of the jobs pulling, deleting, verifying and tagging the images of
+// image caches on nodes, for controllers embedding the image caching of kube-fledged. The jobs are
+// built for the image, node, artifact type and settings of the image cache of the request; creating
+// them and watching their pods is left to the caller.
+type ImageJobBuilder interface {
+	// PullJob constructs the job pulling the image of the request to its node
+	PullJob(iwr ImageWorkRequest) (*batchv1.Job, error)
+	// DeleteJob constructs the job deleting the image of the request from its node
+	DeleteJob(iwr ImageWorkRequest) (*batchv1.Job, error)
+	// VerifyJob constructs the job inspecting the image of the request pulled to its node
+	VerifyJob(iwr ImageWorkRequest) (*batchv1.Job, error)
+	// TagJob constructs the job tagging the image of the request pulled to its node with its aliases
+	TagJob(iwr ImageWorkRequest) (*batchv1.Job, error)
+}
+
+// ImageJobBuilderOptions holds the controller-wide settings of the jobs constructed by an ImageJobBuilder.
+// The settings of the spec of an image cache take precedence over them.
+type ImageJobBuilderOptions struct {
+	// CriClientImage is the image of the cri client of image delete/verify jobs on Linux nodes
+	CriClientImage string
+	// BusyboxImage is the image that image pull jobs copy the echo binary from
+	BusyboxImage string
+	// ImagePullPolicy is the image pull policy of the images with none set in the cache spec:
+	// IfNotPresent, Always or Never
+	ImagePullPolicy string
+	// ServiceAccountName is the service account of the pods of the jobs
+	ServiceAccountName string
+	// JobPriorityClassName is the priority class of the pods of the jobs
+	JobPriorityClassName string
+	// CriSocketPath is the path to the cri socket on the nodes, detected from the node when empty
+	CriSocketPath string
+	// ImagePullDeadline is the maximum duration allowed for pulling an image, bounding the activeDeadlineSeconds
+	// of image pull jobs. The imagePullDeadline of the image cache takes precedence. Zero leaves them unbounded.
+	ImagePullDeadline time.Duration
+	// JobOptions are the remaining settings of the jobs
+	JobOptions JobOptions
+}
+
+// imageJobBuilder constructs the jobs of the image manager
+type imageJobBuilder struct {
+	options ImageJobBuilderOptions
+}
+
+// NewImageJobBuilder returns an ImageJobBuilder constructing jobs with the given settings
+func NewImageJobBuilder(options ImageJobBuilderOptions) ImageJobBuilder {
+	return &imageJobBuilder{options: options}
+}
+
+// PullJob constructs the job pulling the image of the request, stopped once the image pull deadline expires
+func (b *imageJobBuilder) PullJob(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	job, err := b.pullJob(iwr)
+	if err != nil {
+		return nil, err
+	}
+	boundPullJobDeadline(job, iwr.Imagecache, b.options.ImagePullDeadline)
+	return job, nil
+}
+
+// pullJob constructs the job pulling the image of the request, depending on its artifact type
+func (b *imageJobBuilder) pullJob(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	var cachePaths []string
+	if iwr.CachePaths != nil {
+		cachePaths = *iwr.CachePaths
+	}
+	imagePullSecrets := requestImagePullSecrets(iwr)
+	o := b.options
+	switch iwr.ArtifactType {
+	case fledgedv1alpha3.ArtifactTypeWasm:
+		return newRuntimePullJob(iwr.Imagecache, pinnedImage(iwr), imagePullSecrets, iwr.Node, iwr.ContainerRuntimeVersion,
+			o.CriClientImage, o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+	case fledgedv1alpha3.ArtifactTypeArtifact:
+		return newArtifactPullJob(iwr.Imagecache, pinnedImage(iwr), effectiveImagePullPolicy(iwr, o.ImagePullPolicy) == string(corev1.PullAlways),
+			imagePullSecrets, iwr.Node, o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+	default:
+		job, err := newImagePullJob(iwr.Imagecache, pinnedImage(iwr), iwr.ForceFullCache, cachePaths, imagePullSecrets, iwr.Node, o.ImagePullPolicy,
+			iwr.ImagePullPolicy, o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+		if err != nil {
+			return nil, err
+		}
+		setWarmCommand(job, iwr)
+		return job, nil
+	}
+}
+
+// DeleteJob constructs the job deleting the image of the request, from the container runtime or,
+// for OCI artifacts, from the artifact cache directory of the node
+func (b *imageJobBuilder) DeleteJob(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	o := b.options
+	if storedByRuntime(iwr.ArtifactType) {
+		return newImageDeleteJob(iwr.Imagecache, pinnedImage(iwr), requestImagePullSecrets(iwr), iwr.Node, iwr.ContainerRuntimeVersion,
+			o.CriClientImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+	}
+	return newArtifactDeleteJob(iwr.Imagecache, pinnedImage(iwr), iwr.Node,
+		o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+}
+
+// VerifyJob constructs the job inspecting the image of the request through the client of the container runtime
+func (b *imageJobBuilder) VerifyJob(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	o := b.options
+	return newImageVerifyJob(iwr.Imagecache, pinnedImage(iwr), iwr.Node, iwr.ContainerRuntimeVersion,
+		o.CriClientImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+}
+
+// TagJob constructs the job tagging the image of the request with its aliases through the client of the container runtime
+func (b *imageJobBuilder) TagJob(iwr ImageWorkRequest) (*batchv1.Job, error) {
+	o := b.options
+	return newImageTagJob(iwr.Imagecache, pinnedImage(iwr), imageAliases(iwr), iwr.Node, iwr.ContainerRuntimeVersion,
+		o.CriClientImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+}
+
+// requestImagePullSecrets returns the image pull secrets of the image of the request, without those of its image cache
+func requestImagePullSecrets(iwr ImageWorkRequest) []corev1.LocalObjectReference {
+	if iwr.ImagePullSecrets == nil {
+		return nil
+	}
+	return *iwr.ImagePullSecrets
+}
+
+// jobBuilder returns the builder of the jobs of the image manager, with its current settings
+func (m *ImageManager) jobBuilder() ImageJobBuilder {
+	return NewImageJobBuilder(ImageJobBuilderOptions{
+		CriClientImage:       m.criClientImage,
+		BusyboxImage:         m.busyboxImage,
+		ImagePullPolicy:      m.imagePullPolicy,
+		ServiceAccountName:   m.serviceAccountName,
+		JobPriorityClassName: m.jobPriorityClassName,
+		CriSocketPath:        m.criSocketPath,
+		ImagePullDeadline:    m.imagePullDeadlineDuration,
+		JobOptions:           m.jobOptions,
+	})
+}
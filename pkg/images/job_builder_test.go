@@ -0,0 +1,169 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImageJobBuilder(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+			UID:       "f00",
+		},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "cache-secret"}},
+			JobLabels:        map[string]string{"cost-center": "cc-1234"},
+		},
+	}
+	options := ImageJobBuilderOptions{
+		CriClientImage:       "cri-client:latest",
+		BusyboxImage:         "busybox:1.35.0",
+		ImagePullPolicy:      "IfNotPresent",
+		ServiceAccountName:   "sa-kube-fledged",
+		JobPriorityClassName: "priority-class-kube-fledged",
+		CriSocketPath:        "/run/k3s/containerd/containerd.sock",
+		JobOptions: JobOptions{
+			JobBackoffLimit:        1,
+			RegistryMirrors:        map[string]string{"docker.io/library": "registry.internal/mirror"},
+			PullJobRestartPolicy:   corev1.RestartPolicyOnFailure,
+			DeleteJobRestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+	cachePaths := []string{"/opt/app/"}
+	imagePullSecrets := []corev1.LocalObjectReference{{Name: "image-secret"}}
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	pinned := PinnedImageRef("nginx:1.25", digest)
+	containerRuntimeVersion := "containerd://1.6.8"
+	o := options
+	tests := []struct {
+		name        string
+		iwr         ImageWorkRequest
+		build       func(ImageJobBuilder, ImageWorkRequest) (*batchv1.Job, error)
+		expectedJob func() (*batchv1.Job, error)
+		expectErr   bool
+	}{
+		{
+			name:  "#1: Image pull job",
+			iwr:   ImageWorkRequest{Image: "nginx:1.25", Node: &node, Imagecache: imagecache, ImagePullSecrets: &imagePullSecrets},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImagePullJob(imagecache, "nginx:1.25", false, nil, imagePullSecrets, &node, o.ImagePullPolicy, "",
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+		},
+		{
+			name: "#2: Image pull job caching directories of an image pinned to a digest, with its own pull policy",
+			iwr: ImageWorkRequest{Image: "nginx:1.25", Digest: digest, CachePaths: &cachePaths, ImagePullPolicy: corev1.PullAlways,
+				Node: &node, Imagecache: imagecache},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImagePullJob(imagecache, pinned, false, cachePaths, nil, &node, o.ImagePullPolicy, corev1.PullAlways,
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+		},
+		{
+			name:  "#3: Image pull job caching all the files of the image",
+			iwr:   ImageWorkRequest{Image: "nginx:1.25", ForceFullCache: true, Node: &node, Imagecache: imagecache},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImagePullJob(imagecache, "nginx:1.25", true, nil, nil, &node, o.ImagePullPolicy, "",
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+		},
+		{
+			name: "#4: WASM module pull job",
+			iwr: ImageWorkRequest{Image: "ghcr.io/org/module:v1", ArtifactType: fledgedv1alpha3.ArtifactTypeWasm,
+				ContainerRuntimeVersion: containerRuntimeVersion, Node: &node, Imagecache: imagecache},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newRuntimePullJob(imagecache, "ghcr.io/org/module:v1", nil, &node, containerRuntimeVersion,
+					o.CriClientImage, o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+			},
+		},
+		{
+			name: "#5: OCI artifact pull job always pulling",
+			iwr: ImageWorkRequest{Image: "ghcr.io/org/charts/app:1.0.0", ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact,
+				ImagePullPolicy: corev1.PullAlways, Node: &node, Imagecache: imagecache},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newArtifactPullJob(imagecache, "ghcr.io/org/charts/app:1.0.0", true, nil, &node,
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+		},
+		{
+			name: "#6: Image delete job",
+			iwr: ImageWorkRequest{Image: "nginx:1.25", Digest: digest, ContainerRuntimeVersion: containerRuntimeVersion,
+				Node: &node, Imagecache: imagecache, WorkType: ImageCachePurge},
+			build: ImageJobBuilder.DeleteJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImageDeleteJob(imagecache, pinned, nil, &node, containerRuntimeVersion,
+					o.CriClientImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+			},
+		},
+		{
+			name: "#7: OCI artifact delete job",
+			iwr: ImageWorkRequest{Image: "ghcr.io/org/charts/app:1.0.0", ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact,
+				Node: &node, Imagecache: imagecache, WorkType: ImageCachePurge},
+			build: ImageJobBuilder.DeleteJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newArtifactDeleteJob(imagecache, "ghcr.io/org/charts/app:1.0.0", &node,
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+		},
+		{
+			name: "#8: Image verify job",
+			iwr: ImageWorkRequest{Image: "nginx:1.25", ContainerRuntimeVersion: containerRuntimeVersion,
+				Node: &node, Imagecache: imagecache},
+			build: ImageJobBuilder.VerifyJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImageVerifyJob(imagecache, "nginx:1.25", &node, containerRuntimeVersion,
+					o.CriClientImage, o.ServiceAccountName, o.JobPriorityClassName, o.CriSocketPath, o.JobOptions)
+			},
+		},
+		{
+			name:  "#9: Request without an image cache",
+			iwr:   ImageWorkRequest{Image: "nginx:1.25", Node: &node},
+			build: ImageJobBuilder.PullJob,
+			expectedJob: func() (*batchv1.Job, error) {
+				return newImagePullJob(nil, "nginx:1.25", false, nil, nil, &node, o.ImagePullPolicy, "",
+					o.BusyboxImage, o.ServiceAccountName, o.JobPriorityClassName, o.JobOptions)
+			},
+			expectErr: true,
+		},
+	}
+	builder := NewImageJobBuilder(options)
+	for _, test := range tests {
+		expectedJob, expectedErr := test.expectedJob()
+		job, err := test.build(builder, test.iwr)
+		if (err != nil) != test.expectErr || (expectedErr != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectedError=%v, actualError=%v", test.name, expectedErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(job, expectedJob) {
+			t.Errorf("Test: %s failed: expectedJob=%+v, actualJob=%+v", test.name, expectedJob, job)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// ImageLabelKey is the label of image pull and delete jobs and their pods holding the image they pull
+// or delete, encoded by ImageLabelValue
+const ImageLabelKey = "image"
+
+// ImageAnnotationKey is the annotation of image pull and delete jobs and their pods holding the full
+// reference of the image they pull or delete
+const ImageAnnotationKey = "kubefledged.io/image"
+
+// imageLabelHashLength is the number of hex digits of the hash ending the label value of long image references
+const imageLabelHashLength = 10
+
+// ImageLabelValue encodes an image reference into a label value: the characters not allowed in label
+// values ('/', ':', '@') are replaced by '_'. References longer than the 63 characters of a label value,
+// such as those with a digest, are cut and end with a hash of the full reference to keep them apart.
+func ImageLabelValue(image string) string {
+	value := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, image)
+	if len(value) > validation.LabelValueMaxLength {
+		sum := sha256.Sum256([]byte(image))
+		value = value[:validation.LabelValueMaxLength-imageLabelHashLength-1] + "-" + hex.EncodeToString(sum[:])[:imageLabelHashLength]
+	}
+	// label values begin and end with an alphanumeric character
+	return strings.Trim(value, "-_.")
+}
+
+// reservedJobLabelKeys are the labels set by the controller on image pull/delete jobs and their pods
+var reservedJobLabelKeys = []string{"app", "kubefledged", "imagecache", "controller", ImageLabelKey, ImageCacheNamespaceLabelKey}
+
+// IsReservedJobLabel checks whether the label is set by the controller on image pull/delete jobs,
+// so that it cannot be set by the jobLabels of an image cache
+func IsReservedJobLabel(key string) bool {
+	for _, reserved := range reservedJobLabelKeys {
+		if key == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// jobLabels returns the labels of the jobs of an image cache pulling or deleting the image
+func jobLabels(imagecache *fledgedv1alpha3.ImageCache, image string) map[string]string {
+	return map[string]string{
+		"app":         "kubefledged",
+		"kubefledged": "kubefledged-image-manager",
+		"imagecache":  imagecache.Name,
+		"controller":  controllerAgentName,
+		ImageLabelKey: ImageLabelValue(image),
+	}
+}
+
+// setImageAnnotation annotates a job and its pods with the full reference of the image
+func setImageAnnotation(job *batchv1.Job, image string) {
+	for _, meta := range []*map[string]string{&job.Annotations, &job.Spec.Template.Annotations} {
+		if *meta == nil {
+			*meta = map[string]string{}
+		}
+		(*meta)[ImageAnnotationKey] = image
+	}
+}
+
+// setJobPodMetadata adds the jobLabels and jobAnnotations of the image cache to the pods of a job.
+// The labels and annotations set by the controller are kept.
+func setJobPodMetadata(job *batchv1.Job, jobLabels, jobAnnotations map[string]string) {
+	if len(jobLabels) == 0 && len(jobAnnotations) == 0 {
+		return
+	}
+	template := &job.Spec.Template
+	// the job and its pods share the map of labels; the pods get a copy so the job keeps its labels
+	labels := make(map[string]string, len(template.Labels)+len(jobLabels))
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+	for k, v := range jobLabels {
+		if _, ok := labels[k]; ok || IsReservedJobLabel(k) {
+			klog.V(4).Infof("Label %s of the pods of job %s is set by the controller, ignoring the value %q of jobLabels", k, job.GenerateName, v)
+			continue
+		}
+		labels[k] = v
+	}
+	template.Labels = labels
+	if template.Annotations == nil && len(jobAnnotations) > 0 {
+		template.Annotations = map[string]string{}
+	}
+	for k, v := range jobAnnotations {
+		if _, ok := template.Annotations[k]; ok {
+			klog.V(4).Infof("Annotation %s of the pods of job %s is set by the controller, ignoring the value %q of jobAnnotations", k, job.GenerateName, v)
+			continue
+		}
+		template.Annotations[k] = v
+	}
+}
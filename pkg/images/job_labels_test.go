@@ -0,0 +1,229 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestImageLabelValue(t *testing.T) {
+	digestRef := "gcr.io/google-containers/pause@sha256:927d98197ec1141a368550822d18fa1c60bdae27b78b0c004f705f548c07814f"
+	longTag := "registry.example.com/some-team/some-project/some-component:" + strings.Repeat("v1", 20)
+	tests := []struct {
+		name           string
+		image          string
+		expectedPrefix string
+		expectedLength int
+	}{
+		{
+			name:           "#1: Short reference",
+			image:          "nginx",
+			expectedPrefix: "nginx",
+			expectedLength: 5,
+		},
+		{
+			name:           "#2: Reference with registry, repository and tag",
+			image:          "docker.io/library/nginx:1.25",
+			expectedPrefix: "docker.io_library_nginx_1.25",
+			expectedLength: 28,
+		},
+		{
+			name:           "#3: Reference with digest is hashed",
+			image:          digestRef,
+			expectedPrefix: "gcr.io_google-containers_pause_sha256_927d98197ec114-",
+			expectedLength: validation.LabelValueMaxLength,
+		},
+		{
+			name:           "#4: Over-length tag is hashed",
+			image:          longTag,
+			expectedPrefix: "registry.example.com_some-team_some-project_some-com-",
+			expectedLength: validation.LabelValueMaxLength,
+		},
+		{
+			name:           "#5: Reference of exactly 63 characters is not hashed",
+			image:          "example.com/" + strings.Repeat("a", 48) + ":v1",
+			expectedPrefix: "example.com_" + strings.Repeat("a", 48) + "_v1",
+			expectedLength: validation.LabelValueMaxLength,
+		},
+	}
+	for _, test := range tests {
+		value := ImageLabelValue(test.image)
+		if !strings.HasPrefix(value, test.expectedPrefix) || len(value) != test.expectedLength {
+			t.Errorf("Test: %s failed: expectedPrefix=%s, expectedLength=%d, actualValue=%s, actualLength=%d",
+				test.name, test.expectedPrefix, test.expectedLength, value, len(value))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			t.Errorf("Test: %s failed: expectedValidLabelValue=true, actualErrors=%v", test.name, errs)
+		}
+	}
+
+	// references differing only past the cut have different label values
+	if ImageLabelValue(digestRef) == ImageLabelValue(digestRef[:len(digestRef)-1]+"0") {
+		t.Errorf("Test: Distinct over-length references failed: expectedDistinctValues=true, actualValue=%s", ImageLabelValue(digestRef))
+	}
+}
+
+func TestJobImageLabel(t *testing.T) {
+	digestRef := "gcr.io/google-containers/pause@sha256:927d98197ec1141a368550822d18fa1c60bdae27b78b0c004f705f548c07814f"
+	tests := []struct {
+		name            string
+		deleteJob       bool
+		image           string
+		registryMirrors map[string]string
+	}{
+		{
+			name:  "#1: Pull job",
+			image: "nginx:1.25",
+		},
+		{
+			name:      "#2: Delete job",
+			deleteJob: true,
+			image:     "nginx:1.25",
+		},
+		{
+			name:  "#3: Pull job of an image with digest",
+			image: digestRef,
+		},
+		{
+			name:      "#4: Delete job of an image with digest",
+			deleteJob: true,
+			image:     digestRef,
+		},
+		{
+			name:            "#5: Pull job of an image pulled from a registry mirror",
+			image:           "docker.io/library/nginx:1.25",
+			registryMirrors: map[string]string{"docker.io": "mirror.example.com"},
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+		}
+		jobOptions := JobOptions{RegistryMirrors: test.registryMirrors}
+		var job *batchv1.Job
+		var err error
+		if test.deleteJob {
+			job, err = newImageDeleteJob(imagecache, test.image, nil, &node, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", jobOptions)
+		} else {
+			job, err = newImagePullJob(imagecache, test.image, false, nil, nil, &node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", jobOptions)
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		expectedLabel := ImageLabelValue(test.image)
+		for _, meta := range []metav1.ObjectMeta{job.ObjectMeta, job.Spec.Template.ObjectMeta} {
+			if meta.Labels[ImageLabelKey] != expectedLabel || meta.Labels["imagecache"] != "foo" {
+				t.Errorf("Test: %s failed: expectedImageLabel=%s, actualLabels=%+v", test.name, expectedLabel, meta.Labels)
+			}
+			if meta.Annotations[ImageAnnotationKey] != test.image {
+				t.Errorf("Test: %s failed: expectedImageAnnotation=%s, actualAnnotations=%+v", test.name, test.image, meta.Annotations)
+			}
+		}
+	}
+}
+
+func TestJobPodMetadata(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			JobLabels: map[string]string{
+				"cost-center": "cc-1234",
+				"team":        "web",
+				"app":         "web",
+				"imagecache":  "bar",
+				"image":       "busybox",
+			},
+			JobAnnotations: map[string]string{
+				"sidecar.istio.io/inject": "false",
+				ImageAnnotationKey:        "busybox",
+			},
+		},
+	}
+	windowsNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "win1",
+			Labels: map[string]string{"kubernetes.io/hostname": "win1", "kubernetes.io/os": "windows"},
+		},
+	}
+	tests := []struct {
+		name       string
+		deleteJob  bool
+		node       *corev1.Node
+		cachePaths []string
+	}{
+		{name: "#1: Pull job", node: &node},
+		{name: "#2: Directory cache job", node: &node, cachePaths: []string{"/opt/conda/lib/"}},
+		{name: "#3: Delete job", node: &node, deleteJob: true},
+		{name: "#4: Windows pull job", node: windowsNode},
+		{name: "#5: Windows delete job", node: windowsNode, deleteJob: true},
+	}
+	expectedLabels := map[string]string{
+		"app":         "kubefledged",
+		"kubefledged": "kubefledged-image-manager",
+		"imagecache":  "foo",
+		"controller":  controllerAgentName,
+		"image":       ImageLabelValue("nginx:1.25"),
+		"cost-center": "cc-1234",
+		"team":        "web",
+	}
+	expectedAnnotations := map[string]string{
+		"sidecar.istio.io/inject": "false",
+		ImageAnnotationKey:        "nginx:1.25",
+	}
+	for _, test := range tests {
+		var job *batchv1.Job
+		var err error
+		if test.deleteJob {
+			job, err = newImageDeleteJob(imagecache, "nginx:1.25", nil, test.node, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", JobOptions{})
+		} else {
+			job, err = newImagePullJob(imagecache, "nginx:1.25", false, test.cachePaths, nil, test.node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", JobOptions{})
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(job.Spec.Template.Labels, expectedLabels) {
+			t.Errorf("Test: %s failed: expectedPodLabels=%+v, actualPodLabels=%+v", test.name, expectedLabels, job.Spec.Template.Labels)
+		}
+		if !reflect.DeepEqual(job.Spec.Template.Annotations, expectedAnnotations) {
+			t.Errorf("Test: %s failed: expectedPodAnnotations=%+v, actualPodAnnotations=%+v", test.name, expectedAnnotations, job.Spec.Template.Annotations)
+		}
+		// the labels of the job itself are those set by the controller
+		if _, ok := job.Labels["cost-center"]; ok || job.Labels["imagecache"] != "foo" {
+			t.Errorf("Test: %s failed: expectedJobLabels=controller labels, actualJobLabels=%+v", test.name, job.Labels)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ImageCacheNamespaceLabelKey is the label of the image pull and delete jobs created outside the namespace
+// of their image cache, holding the namespace of the image cache. Such jobs cannot be owned by the image cache.
+const ImageCacheNamespaceLabelKey = "imagecache-namespace"
+
+// JobNamespace returns the namespace of the jobs of the image cache: jobNamespace if set,
+// otherwise the namespace of the image cache
+func JobNamespace(imagecache *fledgedv1alpha3.ImageCache, jobNamespace string) string {
+	if jobNamespace != "" {
+		return jobNamespace
+	}
+	return imagecache.Namespace
+}
+
+// JobsOwned checks whether the jobs of the image cache are owned by it, and so garbage collected with it.
+// A namespaced image cache cannot own the jobs created in another namespace; a cluster image cache can.
+func JobsOwned(imagecache *fledgedv1alpha3.ImageCache, jobNamespace string) bool {
+	return fledgedv1alpha3.IsClusterImageCache(imagecache) || JobNamespace(imagecache, jobNamespace) == imagecache.Namespace
+}
+
+// ImageCacheJobsSelector selects the jobs of the image cache that it does not own
+func ImageCacheJobsSelector(imagecache *fledgedv1alpha3.ImageCache) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{
+		"app":                       "kubefledged",
+		"kubefledged":               "kubefledged-image-manager",
+		"imagecache":                imagecache.Name,
+		ImageCacheNamespaceLabelKey: imagecache.Namespace,
+	})
+}
+
+// setJobNamespace places the job and its pods in the job namespace. A job that cannot be owned by
+// its image cache is labelled with the namespace of the image cache instead.
+func setJobNamespace(job *batchv1.Job, imagecache *fledgedv1alpha3.ImageCache, jobOptions JobOptions) {
+	namespace := JobNamespace(imagecache, jobOptions.JobNamespace)
+	job.Namespace = namespace
+	job.Spec.Template.Namespace = namespace
+	if JobsOwned(imagecache, jobOptions.JobNamespace) {
+		return
+	}
+	job.OwnerReferences = nil
+	for _, meta := range []*map[string]string{&job.Labels, &job.Spec.Template.Labels} {
+		if *meta == nil {
+			*meta = map[string]string{}
+		}
+		(*meta)[ImageCacheNamespaceLabelKey] = imagecache.Namespace
+	}
+}
+
+// jobNamespace returns the namespace of the jobs of the image cache
+func (m *ImageManager) jobNamespace(imagecache *fledgedv1alpha3.ImageCache) string {
+	return JobNamespace(imagecache, m.jobOptions.JobNamespace)
+}
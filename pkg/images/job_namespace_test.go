@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	core "k8s.io/client-go/testing"
+)
+
+func TestJobNamespace(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "team-a", UID: "foo-uid"},
+	}
+	clusterImageCache := &fledgedv1alpha3.ImageCache{
+		TypeMeta:   metav1.TypeMeta{Kind: fledgedv1alpha3.ClusterImageCacheKind},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged", UID: "foo-uid"},
+	}
+	tests := []struct {
+		name                   string
+		imageCache             *fledgedv1alpha3.ImageCache
+		jobNamespace           string
+		workType               WorkType
+		expectedNamespace      string
+		expectedOwned          bool
+		expectedNamespaceLabel string
+	}{
+		{
+			name:              "#1: Pull job in the namespace of the image cache by default",
+			imageCache:        imageCache,
+			workType:          ImageCacheCreate,
+			expectedNamespace: "team-a",
+			expectedOwned:     true,
+		},
+		{
+			name:                   "#2: Pull job in the job namespace",
+			imageCache:             imageCache,
+			jobNamespace:           "kubefledged-jobs",
+			workType:               ImageCacheCreate,
+			expectedNamespace:      "kubefledged-jobs",
+			expectedNamespaceLabel: "team-a",
+		},
+		{
+			name:                   "#3: Delete job in the job namespace",
+			imageCache:             imageCache,
+			jobNamespace:           "kubefledged-jobs",
+			workType:               ImageCachePurge,
+			expectedNamespace:      "kubefledged-jobs",
+			expectedNamespaceLabel: "team-a",
+		},
+		{
+			name:              "#4: Job namespace of the image cache",
+			imageCache:        imageCache,
+			jobNamespace:      "team-a",
+			workType:          ImageCacheCreate,
+			expectedNamespace: "team-a",
+			expectedOwned:     true,
+		},
+		{
+			name:              "#5: Job in the job namespace owned by the cluster image cache",
+			imageCache:        clusterImageCache,
+			jobNamespace:      "kubefledged-jobs",
+			workType:          ImageCacheCreate,
+			expectedNamespace: "kubefledged-jobs",
+			expectedOwned:     true,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.JobNamespace = test.jobNamespace
+		iwr := ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: test.workType, Imagecache: test.imageCache}
+		var err error
+		if test.workType == ImageCachePurge {
+			_, err = imagemanager.deleteImage(iwr)
+		} else {
+			_, err = imagemanager.pullImage(iwr)
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if createdJobs(fakekubeclientset) != 1 {
+			t.Errorf("Test: %s failed: expectedJobs=1, actualJobs=%d", test.name, createdJobs(fakekubeclientset))
+		}
+		for _, action := range fakekubeclientset.Actions() {
+			if action.GetVerb() != "create" {
+				continue
+			}
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			if action.GetNamespace() != test.expectedNamespace || job.Namespace != test.expectedNamespace ||
+				job.Spec.Template.Namespace != test.expectedNamespace {
+				t.Errorf("Test: %s failed: expectedNamespace=%s, actualNamespace=%s, actualJobNamespace=%s, actualPodNamespace=%s",
+					test.name, test.expectedNamespace, action.GetNamespace(), job.Namespace, job.Spec.Template.Namespace)
+			}
+			if owned := len(job.OwnerReferences) == 1; owned != test.expectedOwned {
+				t.Errorf("Test: %s failed: expectedOwned=%t, actualOwnerReferences=%+v", test.name, test.expectedOwned, job.OwnerReferences)
+			}
+			if job.Labels[ImageCacheNamespaceLabelKey] != test.expectedNamespaceLabel ||
+				job.Spec.Template.Labels[ImageCacheNamespaceLabelKey] != test.expectedNamespaceLabel {
+				t.Errorf("Test: %s failed: expectedNamespaceLabel=%s, actualJobLabels=%v, actualPodLabels=%v",
+					test.name, test.expectedNamespaceLabel, job.Labels, job.Spec.Template.Labels)
+			}
+			if test.expectedNamespaceLabel != "" && !ImageCacheJobsSelector(test.imageCache).Matches(labels.Set(job.Labels)) {
+				t.Errorf("Test: %s failed: expected job selected as job of the image cache, actualLabels=%v", test.name, job.Labels)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/klog/v2"
+)
+
+// defaultJobCreationBackoff is the backoff of the retries of a job whose creation failed with a transient
+// error: up to 5 attempts over about 15s, each delay doubling and randomly lengthened by up to 50%, so that
+// the retries of the jobs failing together are spread over time
+var defaultJobCreationBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    5,
+	Cap:      30 * time.Second,
+}
+
+// retriableJobCreationError checks whether the creation of a job failed with a transient error, e.g. the
+// API server throttling requests or the job quota of the namespace being exceeded
+func retriableJobCreationError(err error) bool {
+	return apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) || (apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"))
+}
+
+// createJob creates the job, retrying with exponential backoff and jitter while its creation fails with
+// a transient error. The image worker is held meanwhile, so that no other job hammers a throttled API server.
+// The pod of the job keeps the image pull secrets of its service account.
+func (m *ImageManager) createJob(namespace string, job *batchv1.Job) (*batchv1.Job, error) {
+	m.inheritServiceAccountImagePullSecrets(namespace, job)
+	var created *batchv1.Job
+	var lastErr error
+	attempts := 0
+	err := wait.ExponentialBackoff(m.jobCreationBackoff, func() (bool, error) {
+		var err error
+		attempts++
+		created, err = m.kubeclientset.BatchV1().Jobs(namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+		if err == nil {
+			return true, nil
+		}
+		if !retriableJobCreationError(err) {
+			return false, err
+		}
+		klog.Warningf("Error creating job %s (attempt %d), retrying: %v", job.GenerateName, attempts, err)
+		lastErr = err
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		klog.Errorf("Job %s not created after %d attempts", job.GenerateName, attempts)
+		return nil, lastErr
+	}
+	return created, err
+}
+
+// jobCreationFailed records the failure of the image pull/delete request whose job could not be created,
+// so that the image is reported as failed on its node
+func (m *ImageManager) jobCreationFailed(iwr ImageWorkRequest, err error) {
+	m.lock.Lock()
+	m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{ImageWorkRequest: iwr,
+		Status: ImageWorkResultStatusFailed, Reason: "JobCreationFailed", Message: err.Error()}
+	m.lock.Unlock()
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestCreateJobRetries(t *testing.T) {
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+	throttled := apierrors.NewTooManyRequests("the server has received too many requests", 1)
+	quotaExceeded := apierrors.NewForbidden(jobs, "", fmt.Errorf("exceeded quota: jobs, requested: count/jobs.batch=1, used: count/jobs.batch=10, limited: count/jobs.batch=10"))
+	backoff := wait.Backoff{Duration: 10 * time.Millisecond, Factor: 2, Jitter: 0.5, Steps: 4}
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectErr        bool
+	}{
+		{
+			name:             "#1: Job created at the first attempt",
+			expectedAttempts: 1,
+		},
+		{
+			name:             "#2: Job created after the API server stopped throttling requests",
+			errs:             []error{throttled, throttled, throttled},
+			expectedAttempts: 4,
+		},
+		{
+			name:             "#3: Job created once the job quota is no longer exceeded",
+			errs:             []error{quotaExceeded},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "#4: Job not created after the last attempt",
+			errs:             []error{throttled, throttled, throttled, throttled, throttled},
+			expectedAttempts: 4,
+			expectErr:        true,
+		},
+		{
+			name:             "#5: Job creation not retried after an invalid job",
+			errs:             []error{apierrors.NewInvalid(schema.GroupKind{Group: "batch", Kind: "Job"}, "", nil)},
+			expectedAttempts: 1,
+			expectErr:        true,
+		},
+	}
+	for _, test := range tests {
+		attempts := []time.Time{}
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			attempts = append(attempts, time.Now())
+			if len(attempts) <= len(test.errs) {
+				return true, nil, test.errs[len(attempts)-1]
+			}
+			return true, action.(core.CreateAction).GetObject(), nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobCreationBackoff = backoff
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{GenerateName: "imagecache-foo-", Namespace: "kube-fledged"}}
+		_, err := imagemanager.createJob("kube-fledged", job)
+		if test.expectErr != (err != nil) {
+			t.Errorf("Test: %s failed: expectErr=%t, actualError=%v", test.name, test.expectErr, err)
+		}
+		if len(attempts) != test.expectedAttempts {
+			t.Errorf("Test: %s failed: expectedAttempts=%d, actualAttempts=%d", test.name, test.expectedAttempts, len(attempts))
+		}
+		// the delay before each retry doubles, lengthened by the jitter
+		for i := 1; i < len(attempts); i++ {
+			minDelay := backoff.Duration << (i - 1)
+			if delay := attempts[i].Sub(attempts[i-1]); delay < minDelay {
+				t.Errorf("Test: %s failed: retry=%d, expectedMinDelay=%s, actualDelay=%s", test.name, i, minDelay, delay)
+			}
+		}
+	}
+}
+
+func TestJobCreationFailed(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, nil, apierrors.NewTooManyRequests("the server has received too many requests", 1)
+	})
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.jobCreationBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 2}
+	imagemanager.imageworkqueue.Add(ImageWorkRequest{
+		Image:    "foo:v1",
+		Node:     &node,
+		WorkType: ImageCacheCreate,
+		Imagecache: &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+		},
+	})
+	imagemanager.processNextWorkItem()
+
+	// the image is reported as failed rather than left pulling
+	if len(imagemanager.imageworkstatus) != 1 {
+		t.Fatalf("Test failed: expectedWorkResults=1, actualWorkResults=%d", len(imagemanager.imageworkstatus))
+	}
+	for _, iwres := range imagemanager.imageworkstatus {
+		if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != "JobCreationFailed" {
+			t.Errorf("Test failed: expectedStatus=%s, expectedReason=JobCreationFailed, actualStatus=%s, actualReason=%s",
+				ImageWorkResultStatusFailed, iwres.Status, iwres.Reason)
+		}
+	}
+}
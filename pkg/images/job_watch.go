@@ -0,0 +1,245 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// jobReasonDeadlineExceeded is the reason of the Failed condition of a job whose activeDeadlineSeconds expired
+const jobReasonDeadlineExceeded = "DeadlineExceeded"
+
+// jobStatusResyncPeriod is the period at which the results of the jobs of an image cache are checked
+// while waiting for them, in case a change of their status was not notified
+const jobStatusResyncPeriod = 30 * time.Second
+
+// jobFinished returns the Complete or Failed condition of a finished job
+func jobFinished(job *batchv1.Job) (batchv1.JobCondition, bool) {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return c, true
+		}
+	}
+	return batchv1.JobCondition{}, false
+}
+
+// jobEventHandler handles the jobs finishing, e.g. a job failed by the job controller as its
+// activeDeadlineSeconds expired, whose pods are deleted rather than failed
+func (m *ImageManager) jobEventHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// A job that finished before it was first observed never goes through UpdateFunc
+			job := obj.(*batchv1.Job)
+			if _, finished := jobFinished(job); finished {
+				m.handleJobStatusChange(job)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			newJob := new.(*batchv1.Job)
+			oldJob := old.(*batchv1.Job)
+			if newJob.ResourceVersion == oldJob.ResourceVersion {
+				// Periodic resync will send update events for all known Jobs.
+				return
+			}
+			_, finished := jobFinished(newJob)
+			_, wasFinished := jobFinished(oldJob)
+			if finished && !wasFinished {
+				m.handleJobStatusChange(newJob)
+			}
+		},
+	}
+}
+
+// handleJobStatusChange records the result of a finished job not yet recorded from its pod, and wakes the
+// wait for the jobs of the image cache owning the job
+func (m *ImageManager) handleJobStatusChange(job *batchv1.Job) {
+	condition, _ := jobFinished(job)
+	klog.V(4).Infof("Job %s changed status to %s", job.Name, condition.Type)
+	m.lock.Lock()
+	iwres, ok := m.imageworkstatus[job.Name]
+	recorded := ok && iwres.Status == ImageWorkResultStatusJobCreated
+	if recorded {
+		if condition.Type == batchv1.JobComplete {
+			iwres.Status = ImageWorkResultStatusSucceeded
+			if iwres.Retries > 0 || iwres.TimeoutRetries > 0 || iwres.FailureRetries > 0 {
+				iwres.Status = ImageWorkResultStatusSucceededAfterRetries
+			}
+		} else {
+			iwres.Status = ImageWorkResultStatusFailed
+			iwres.Reason, iwres.Message = m.jobFailure(job, condition)
+			if pullDeadlineExceeded(iwres, condition) {
+				iwres.Message = pullTimedOutMessage(iwres.Reason, iwres.Message)
+				iwres.Reason = fledgedv1alpha3.ImageCacheReasonPullTimedOut
+			}
+			m.classifyRateLimited(&iwres)
+		}
+		// the result of a helper image check is applied once m.lock is released, as the pull jobs
+		// waiting for the check are then created
+		if !iwres.HelperImageCheck {
+			verificationResult(&iwres)
+			taggingResult(&iwres)
+			if m.presenceCheckResult(&iwres) {
+				iwres = m.pullAfterPresenceCheck(job.Name, iwres)
+			} else if pullSucceeded(iwres) && m.tagsPull(iwres) {
+				m.startTagging(job.Name, iwres)
+			} else if pullSucceeded(iwres) && verifiesPull(iwres) {
+				m.startVerification(job.Name, iwres)
+			} else {
+				m.imageworkstatus[job.Name] = iwres
+			}
+		}
+	}
+	m.lock.Unlock()
+	if recorded {
+		m.requestLogger(iwres.ImageWorkRequest).Info("Job finished", "job", job.Name, "action", jobAction(iwres),
+			"condition", condition.Type)
+	}
+	if recorded && iwres.HelperImageCheck {
+		m.finishHelperImageCheck(job.Name, iwres)
+		return
+	}
+
+	if recorded {
+		m.endJobSpan(job.Name, iwres)
+		m.notifySharedJob(job.Name)
+	}
+	if cacheKey, ok := jobImageCacheKey(job); ok {
+		m.notifyJobsChanged(cacheKey)
+	}
+	if recorded && m.pullJobThrottled(iwres.ImageWorkRequest) && iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+		m.dispatchPullJobs()
+	}
+}
+
+// jobImageCacheKey returns the key of the image cache of the job (see imageCacheKey): the ImageCache or
+// ClusterImageCache owning the job, or for the jobs created outside the namespace of their image cache,
+// which are not owned by it, the image cache of their labels
+func jobImageCacheKey(job *batchv1.Job) (string, bool) {
+	if owner := metav1.GetControllerOf(job); owner != nil {
+		switch owner.Kind {
+		case "ImageCache":
+			return job.Namespace + "/" + owner.Name, true
+		case fledgedv1alpha3.ClusterImageCacheKind:
+			return owner.Name, true
+		}
+	}
+	if namespace, ok := job.Labels[ImageCacheNamespaceLabelKey]; ok {
+		return namespace + "/" + job.Labels["imagecache"], true
+	}
+	return "", false
+}
+
+// jobFailure returns the reason and message of a failed job: the failure of its latest pod if any
+// remains, otherwise the Failed condition of the job e.g. DeadlineExceeded
+func (m *ImageManager) jobFailure(job *batchv1.Job, condition batchv1.JobCondition) (string, string) {
+	pods, err := m.podsLister.Pods(job.Namespace).List(labels.Set(map[string]string{"job-name": job.Name}).AsSelector())
+	if err == nil && len(pods) > 0 {
+		if reason, message, ok := podFailure(latestPod(pods)); ok {
+			return reason, message
+		}
+	}
+	return condition.Reason, condition.Message
+}
+
+// pullDeadlineExceeded checks whether the failed job is an image pull job stopped by the job controller as its
+// activeDeadlineSeconds, bounded by the image pull deadline, expired
+func pullDeadlineExceeded(iwres ImageWorkResult, condition batchv1.JobCondition) bool {
+	return condition.Reason == jobReasonDeadlineExceeded && iwres.ImageWorkRequest.WorkType != ImageCachePurge &&
+		!iwres.Verification && !iwres.Tagging && !iwres.PresenceCheck && !iwres.HelperImageCheck
+}
+
+// watchJobs returns a channel notified when the result of a job of the image cache changes
+func (m *ImageManager) watchJobs(cacheKey string) chan struct{} {
+	m.jobWatchLock.Lock()
+	defer m.jobWatchLock.Unlock()
+	changed := make(chan struct{}, 1)
+	m.jobWatches[changed] = cacheKey
+	return changed
+}
+
+// unwatchJobs stops notifying the channel returned by watchJobs
+func (m *ImageManager) unwatchJobs(changed chan struct{}) {
+	m.jobWatchLock.Lock()
+	defer m.jobWatchLock.Unlock()
+	delete(m.jobWatches, changed)
+}
+
+// notifyJobsChanged notifies the waits for the jobs of the image cache that the result of one of them changed
+func (m *ImageManager) notifyJobsChanged(cacheKey string) {
+	m.jobWatchLock.Lock()
+	defer m.jobWatchLock.Unlock()
+	for changed, key := range m.jobWatches {
+		if key != cacheKey {
+			continue
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+			// a notification is already pending
+		}
+	}
+}
+
+// notifyImageWorkResult notifies the waits for the jobs of the image cache of the request that its result changed
+func (m *ImageManager) notifyImageWorkResult(iwr ImageWorkRequest) {
+	if iwr.Imagecache != nil {
+		m.notifyJobsChanged(imageCacheKey(iwr.Imagecache))
+	}
+}
+
+// jobsDone checks whether every job of the image cache has a result, including the jobs of other
+// image caches whose result it shares
+func (m *ImageManager) jobsDone(cacheKey string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.resolveSharedJobs()
+	for _, iwres := range m.imageworkstatus {
+		if imageCacheKey(iwres.ImageWorkRequest.Imagecache) == cacheKey &&
+			(iwres.Status == ImageWorkResultStatusJobCreated || iwres.Status == ImageWorkResultStatusJobQueued ||
+				iwres.Status == ImageWorkResultStatusJobShared) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForJobs waits until every job of the image cache has a result, or the timeout expires.
+// It is woken by the changes of the pods and jobs of the image cache.
+func (m *ImageManager) waitForJobs(cacheKey string, timeout time.Duration) {
+	changed := m.watchJobs(cacheKey)
+	defer m.unwatchJobs(changed)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	resync := time.NewTicker(jobStatusResyncPeriod)
+	defer resync.Stop()
+	for !m.jobsDone(cacheKey) {
+		select {
+		case <-changed:
+		case <-resync.C:
+		case <-deadline.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+// finishedJob returns a job of the image cache with the given Complete or Failed condition
+func finishedJob(imageCache *fledgedv1alpha3.ImageCache, name string, conditionType batchv1.JobConditionType, reason, message string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       fledgedNameSpace,
+			ResourceVersion: "2",
+			OwnerReferences: []metav1.OwnerReference{ownerReference(imageCache)},
+		},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{
+				{Type: conditionType, Status: corev1.ConditionTrue, Reason: reason, Message: message},
+			},
+		},
+	}
+}
+
+func TestHandleJobStatusChange(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"}}
+	tests := []struct {
+		name            string
+		job             *batchv1.Job
+		workType        WorkType
+		status          string
+		retries         int32
+		pod             *corev1.Pod
+		expectedStatus  string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Complete job succeeds",
+			job:            finishedJob(imageCache, "foo-1", batchv1.JobComplete, "", ""),
+			status:         ImageWorkResultStatusJobCreated,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#2: Complete job succeeds after retries",
+			job:            finishedJob(imageCache, "foo-1", batchv1.JobComplete, "", ""),
+			status:         ImageWorkResultStatusJobCreated,
+			retries:        1,
+			expectedStatus: ImageWorkResultStatusSucceededAfterRetries,
+		},
+		{
+			name:            "#3: Pull job whose deadline expired times out",
+			job:             finishedJob(imageCache, "foo-1", batchv1.JobFailed, "DeadlineExceeded", "Job was active longer than specified deadline"),
+			status:          ImageWorkResultStatusJobCreated,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonPullTimedOut,
+			expectedMessage: pullTimedOutMessage("DeadlineExceeded", "Job was active longer than specified deadline"),
+		},
+		{
+			name:   "#4: Failed job reports the failure of its pod",
+			job:    finishedJob(imageCache, "foo-1", batchv1.JobFailed, "BackoffLimitExceeded", "Job has reached the specified backoff limit"),
+			status: ImageWorkResultStatusJobCreated,
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-1-abcde", Namespace: fledgedNameSpace, Labels: map[string]string{"job-name": "foo-1"}},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "manifest unknown"},
+					}}},
+				},
+			},
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "Error",
+			expectedMessage: "manifest unknown",
+		},
+		{
+			name:            "#5: Result recorded from the pod is kept",
+			job:             finishedJob(imageCache, "foo-1", batchv1.JobFailed, "BackoffLimitExceeded", "Job has reached the specified backoff limit"),
+			status:          ImageWorkResultStatusFailed,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  waitingReasonImagePullBackOff,
+			expectedMessage: "not found",
+		},
+		{
+			name:            "#6: Delete job whose deadline expired fails with the reason of the job",
+			job:             finishedJob(imageCache, "foo-1", batchv1.JobFailed, "DeadlineExceeded", "Job was active longer than specified deadline"),
+			workType:        ImageCachePurge,
+			status:          ImageWorkResultStatusJobCreated,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "DeadlineExceeded",
+			expectedMessage: "Job was active longer than specified deadline",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		if test.pod != nil {
+			podInformer.Informer().GetIndexer().Add(test.pod)
+		}
+		workType := ImageCacheCreate
+		if test.workType != "" {
+			workType = test.workType
+		}
+		imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: workType, Imagecache: imageCache},
+			Status:           test.status,
+			Retries:          test.retries,
+			Reason:           waitingReasonImagePullBackOff,
+			Message:          "not found",
+		}
+		handler := imagemanager.jobEventHandler()
+		oldJob := test.job.DeepCopy()
+		oldJob.ResourceVersion = "1"
+		oldJob.Status.Conditions = nil
+		handler.UpdateFunc(oldJob, test.job)
+
+		actual := imagemanager.imageworkstatus["foo-1"]
+		if actual.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, actual.Status)
+		}
+		if test.expectedStatus == ImageWorkResultStatusFailed && (actual.Reason != test.expectedReason || actual.Message != test.expectedMessage) {
+			t.Errorf("Test: %s failed: expectedReason=%s, expectedMessage=%s, actualReason=%s, actualMessage=%s",
+				test.name, test.expectedReason, test.expectedMessage, actual.Reason, actual.Message)
+		}
+	}
+}
+
+func TestJobEventNotifiesOwningImageCache(t *testing.T) {
+	foo := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"}}
+	imagemanager, _ := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	fooChanged := imagemanager.watchJobs(imageCacheKey(foo))
+	barChanged := imagemanager.watchJobs(fledgedNameSpace + "/bar")
+	defer imagemanager.unwatchJobs(fooChanged)
+	defer imagemanager.unwatchJobs(barChanged)
+
+	// a job still running does not notify its image cache
+	running := finishedJob(foo, "foo-1", batchv1.JobComplete, "", "")
+	running.Status.Conditions = nil
+	imagemanager.jobEventHandler().AddFunc(running)
+	if len(fooChanged) != 0 {
+		t.Errorf("Test: Running job failed: expectedNotified=false, actualNotified=true")
+	}
+
+	imagemanager.jobEventHandler().AddFunc(finishedJob(foo, "foo-1", batchv1.JobComplete, "", ""))
+	if len(fooChanged) != 1 || len(barChanged) != 0 {
+		t.Errorf("Test: Completed job failed: expectedNotified=foo, actualNotifiedFoo=%d, actualNotifiedBar=%d", len(fooChanged), len(barChanged))
+	}
+}
+
+func TestUpdateImageCacheStatusOnJobCompletion(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+		// the image pull deadline and the resync period are far longer than the test timeout
+		Spec: fledgedv1alpha3.ImageCacheSpec{ImagePullDeadline: &metav1.Duration{Duration: time.Hour}},
+	}
+	imagemanager, _ := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	errCh := make(chan error)
+	go imagemanager.updateImageCacheStatus(imageCache, errCh)
+
+	job := finishedJob(imageCache, "foo-1", batchv1.JobComplete, "", "")
+	oldJob := job.DeepCopy()
+	oldJob.ResourceVersion = "1"
+	oldJob.Status.Conditions = nil
+	imagemanager.jobEventHandler().UpdateFunc(oldJob, job)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("Test: Job completion failed: expectedError=nil, actualError=%s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Test: Job completion failed: image cache status not updated on job completion")
+	}
+	item, _ := imagemanager.workqueue.Get()
+	wqKey := item.(WorkQueueKey)
+	if wqKey.ObjKey != fledgedNameSpace+"/foo" || (*wqKey.Status)["foo-1"].Status != ImageWorkResultStatusSucceeded {
+		t.Errorf("Test: Job completion failed: expectedObjKey=%s/foo, expectedStatus=%s, actualObjKey=%s, actualResults=%+v",
+			fledgedNameSpace, ImageWorkResultStatusSucceeded, wqKey.ObjKey, *wqKey.Status)
+	}
+}
+
+func TestPullJobDeadlineExceededRetried(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+		// the image pull deadline and the resync period are far longer than the test timeout, so the
+		// pull jobs only time out as the job controller fails them
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			ImagePullDeadline:       &metav1.Duration{Duration: time.Hour},
+			ImagePullTimeoutRetries: 1,
+			FailedPullRetries:       1,
+		},
+	}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.imageworkstatus["foo-1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	errCh := make(chan error)
+	go imagemanager.updateImageCacheStatus(imageCache, errCh)
+
+	deadlineExceeded := func(name string) {
+		job := finishedJob(imageCache, name, batchv1.JobFailed, "DeadlineExceeded", "Job was active longer than specified deadline")
+		oldJob := job.DeepCopy()
+		oldJob.ResourceVersion = "1"
+		oldJob.Status.Conditions = nil
+		imagemanager.jobEventHandler().UpdateFunc(oldJob, job)
+	}
+	deadlineExceeded("foo-1")
+	retriedJob := ""
+	for start := time.Now(); retriedJob == "" && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		imagemanager.lock.Lock()
+		if jobs := activeJobs(imagemanager); len(jobs) == 1 {
+			retriedJob = jobs[0]
+		}
+		imagemanager.lock.Unlock()
+	}
+	if retriedJob == "" {
+		t.Fatalf("Test: Pull job deadline exceeded failed: expectedRetriedJobs=1, actualRetriedJobs=0")
+	}
+	deadlineExceeded(retriedJob)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("Test: Pull job deadline exceeded failed: expectedError=nil, actualError=%s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Test: Pull job deadline exceeded failed: image cache status not updated on job failure")
+	}
+	item, _ := imagemanager.workqueue.Get()
+	results := *item.(WorkQueueKey).Status
+	iwres, ok := results[retriedJob]
+	if len(results) != 1 || !ok {
+		t.Fatalf("Test: Pull job deadline exceeded failed: expectedResults=%s, actualResults=%+v", retriedJob, results)
+	}
+	// the timed out pull is retried once as a timeout, and not again as a failure
+	if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != fledgedv1alpha3.ImageCacheReasonPullTimedOut ||
+		iwres.TimeoutRetries != 1 || iwres.FailureRetries != 0 {
+		t.Errorf("Test: Pull job deadline exceeded failed: expectedStatus=%s, expectedReason=%s, expectedTimeoutRetries=1, expectedFailureRetries=0, "+
+			"actualStatus=%s, actualReason=%s, actualTimeoutRetries=%d, actualFailureRetries=%d", ImageWorkResultStatusFailed,
+			fledgedv1alpha3.ImageCacheReasonPullTimedOut, iwres.Status, iwres.Reason, iwres.TimeoutRetries, iwres.FailureRetries)
+	}
+	if jobs := createdJobs(fakekubeclientset); jobs != 1 {
+		t.Errorf("Test: Pull job deadline exceeded failed: expectedJobs=1, actualJobs=%d", jobs)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// checksPresenceWithRuntime checks whether the presence of the image of the pull request is checked through
+// the container runtime of the node rather than the node's status: the image cache checks presence with the
+// runtime, is not a dry run, and the image is stored by the container runtime of a Linux node
+func checksPresenceWithRuntime(iwr ImageWorkRequest) bool {
+	return iwr.WorkType != ImageCachePurge && iwr.Imagecache != nil && iwr.Imagecache.Spec.RuntimePresenceCheck &&
+		!iwr.Imagecache.Spec.DryRun && storedByRuntime(iwr.ArtifactType) && iwr.Node != nil && !isWindowsNode(iwr.Node)
+}
+
+// checkPresence creates the job inspecting the image through the client of the container runtime of the node,
+// whose result decides whether the image is already present or is to be pulled. See presenceCheckResult.
+func (m *ImageManager) checkPresence(iwr ImageWorkRequest) error {
+	job, err := m.verifyImage(iwr)
+	if err != nil {
+		m.jobCreationFailed(iwr, err)
+		return err
+	}
+	m.lock.Lock()
+	m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated, PresenceCheck: true}
+	m.lock.Unlock()
+	m.requestLogger(iwr).Info("Job created", "job", job.Name, "action", "check", "runtime", iwr.ContainerRuntimeVersion)
+	return nil
+}
+
+// presenceCheckResult applies the result of a finished presence check job to the result of the request.
+// The image found by the runtime is already pulled. The image not found, or whose check failed, is missing
+// with the Never image pull policy; otherwise it returns true, the image is to be pulled.
+func (m *ImageManager) presenceCheckResult(iwres *ImageWorkResult) bool {
+	if !iwres.PresenceCheck {
+		return false
+	}
+	switch iwres.Status {
+	case ImageWorkResultStatusSucceeded, ImageWorkResultStatusSucceededAfterRetries:
+		iwres.Status = ImageWorkResultStatusAlreadyPulled
+	case ImageWorkResultStatusFailed:
+		if effectiveImagePullPolicy(iwres.ImageWorkRequest, m.imagePullPolicy) != string(corev1.PullNever) {
+			return true
+		}
+		iwres.Status = ImageWorkResultStatusImageMissing
+		iwres.Reason = fledgedv1alpha3.ImageCacheReasonImageMissing
+		iwres.Message = fledgedv1alpha3.ImageCacheMessageImageMissing
+	}
+	return false
+}
+
+// pullAfterPresenceCheck replaces the presence check job of an image the runtime does not have by a job
+// pulling the image, and returns the result of the request. Like the retries of pull jobs, the pull job is
+// created whatever the limits of the active pull jobs. The caller must hold m.lock.
+func (m *ImageManager) pullAfterPresenceCheck(job string, iwres ImageWorkResult) ImageWorkResult {
+	iwr := iwres.ImageWorkRequest
+	newJob, err := m.pullImage(iwr)
+	if err != nil {
+		klog.Errorf("Error pulling image '%s' to node '%s' after its presence check: %v", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err)
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason = "JobCreationFailed"
+		iwres.Message = err.Error()
+		m.imageworkstatus[job] = iwres
+		return iwres
+	}
+	m.requestLogger(iwr).Info("Job created", "job", newJob.Name, "action", "pull", "runtime", iwr.ContainerRuntimeVersion, "checkJob", job)
+	if m.canDeleteJob {
+		deletePropagation := metav1.DeletePropagationBackground
+		if err := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwr.Imagecache)).
+			Delete(context.TODO(), job, metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+			klog.Errorf("Error deleting job %s: %v", job, err)
+		}
+	}
+	delete(m.imageworkstatus, job)
+	iwres = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+	m.imageworkstatus[newJob.Name] = iwres
+	m.moveSharedJob(job, newJob.Name)
+	return iwres
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRuntimePresenceCheck(t *testing.T) {
+	failedPod := corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "no such image: foo:v1"},
+		}}},
+	}
+	succeededPod := corev1.PodStatus{Phase: corev1.PodSucceeded}
+	tests := []struct {
+		name                 string
+		imagePullPolicy      string
+		runtimePresenceCheck bool
+		listedInNodeStatus   bool
+		checkPodStatus       *corev1.PodStatus
+		expectedJobs         []string
+		expectedStatus       string
+	}{
+		{
+			name:               "#1: Image listed in the node's status is already pulled",
+			imagePullPolicy:    "IfNotPresent",
+			listedInNodeStatus: true,
+			expectedJobs:       []string{},
+			expectedStatus:     ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:            "#2: Image not listed in the node's status is pulled",
+			imagePullPolicy: "IfNotPresent",
+			expectedJobs:    []string{"pull"},
+			expectedStatus:  ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:                 "#3: Image listed in the node's status and found by the runtime is already pulled",
+			imagePullPolicy:      "IfNotPresent",
+			runtimePresenceCheck: true,
+			listedInNodeStatus:   true,
+			checkPodStatus:       &succeededPod,
+			expectedJobs:         []string{"check"},
+			expectedStatus:       ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:                 "#4: Image listed in the stale node's status but not found by the runtime is pulled",
+			imagePullPolicy:      "IfNotPresent",
+			runtimePresenceCheck: true,
+			listedInNodeStatus:   true,
+			checkPodStatus:       &failedPod,
+			expectedJobs:         []string{"check", "pull"},
+			expectedStatus:       ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:                 "#5: Image not listed in the node's status is pulled without presence check",
+			imagePullPolicy:      "IfNotPresent",
+			runtimePresenceCheck: true,
+			expectedJobs:         []string{"pull"},
+			expectedStatus:       ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:            "#6: Image never pulled and not listed in the node's status is missing",
+			imagePullPolicy: "Never",
+			expectedJobs:    []string{},
+			expectedStatus:  ImageWorkResultStatusImageMissing,
+		},
+		{
+			name:                 "#7: Image never pulled, not listed in the stale node's status but found by the runtime is present",
+			imagePullPolicy:      "Never",
+			runtimePresenceCheck: true,
+			checkPodStatus:       &succeededPod,
+			expectedJobs:         []string{"check"},
+			expectedStatus:       ImageWorkResultStatusAlreadyPulled,
+		},
+		{
+			name:                 "#8: Image never pulled, listed in the stale node's status but not found by the runtime is missing",
+			imagePullPolicy:      "Never",
+			runtimePresenceCheck: true,
+			listedInNodeStatus:   true,
+			checkPodStatus:       &failedPod,
+			expectedJobs:         []string{"check"},
+			expectedStatus:       ImageWorkResultStatusImageMissing,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := newJobCreatingClientset()
+		imagemanager, _ := newTestImageManager(fakekubeclientset, test.imagePullPolicy, "sa-kube-fledged",
+			"priority-class-kube-fledged", true, "")
+		testnode := node
+		if test.listedInNodeStatus {
+			testnode.Status.Images = []corev1.ContainerImage{{Names: []string{"docker.io/library/foo:v1"}}}
+		}
+		imageCache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{RuntimePresenceCheck: test.runtimePresenceCheck},
+		}
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: "foo:v1", Node: &testnode, WorkType: ImageCacheCreate,
+			Imagecache: imageCache, ContainerRuntimeVersion: "containerd://1.6.8"})
+		imagemanager.processNextWorkItem()
+
+		if test.checkPodStatus != nil {
+			for job, iwres := range imagemanager.imageworkstatus {
+				if !iwres.PresenceCheck {
+					t.Errorf("Test: %s failed: expected presence check job, actualJob=%s", test.name, job)
+					continue
+				}
+				imagemanager.handlePodStatusChange(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: job + "-abcde", Labels: map[string]string{"job-name": job}},
+					Status:     *test.checkPodStatus,
+				})
+			}
+		}
+
+		if jobs := createdJobKinds(fakekubeclientset); strings.Join(jobs, ",") != strings.Join(test.expectedJobs, ",") {
+			t.Errorf("Test: %s failed: expectedJobs=%v, actualJobs=%v", test.name, test.expectedJobs, jobs)
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expectedResults=1, actualResults=%d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for _, actual := range imagemanager.imageworkstatus {
+			if actual.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, actual.Status)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultNoProxy are the in-cluster destinations never reached through the proxy: the loopback
+// addresses, the cluster domain and the private address ranges of pods and services
+var defaultNoProxy = []string{"localhost", "127.0.0.1", "::1", ".svc", ".cluster.local",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// noProxy returns the in-cluster destinations followed by the given ones, without duplicates
+func noProxy(val string) string {
+	entries := []string{}
+	seen := map[string]bool{}
+	for _, entry := range append(append([]string{}, defaultNoProxy...), strings.Split(val, ",")...) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ",")
+}
+
+// proxyEnv returns the proxy environment variables of the containers of image pull/delete jobs, in upper
+// and lower case as tools read either. It returns nil if no proxy is set.
+func proxyEnv(jobOptions JobOptions) []corev1.EnvVar {
+	if jobOptions.HTTPProxy == "" && jobOptions.HTTPSProxy == "" {
+		return nil
+	}
+	env := []corev1.EnvVar{}
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", jobOptions.HTTPProxy},
+		{"HTTPS_PROXY", jobOptions.HTTPSProxy},
+		{"NO_PROXY", noProxy(jobOptions.NoProxy)},
+	} {
+		if v.value == "" {
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: v.name, Value: v.value}, corev1.EnvVar{Name: strings.ToLower(v.name), Value: v.value})
+	}
+	return env
+}
+
+// setJobProxyEnv adds the proxy environment variables to all the containers of a job
+func setJobProxyEnv(job *batchv1.Job, jobOptions JobOptions) {
+	env := proxyEnv(jobOptions)
+	if env == nil {
+		return
+	}
+	podSpec := &job.Spec.Template.Spec
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].Env = append(podSpec.InitContainers[i].Env, env...)
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, env...)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJobProxyEnv(t *testing.T) {
+	inClusterNoProxy := "localhost,127.0.0.1,::1,.svc,.cluster.local,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"
+	tests := []struct {
+		name        string
+		jobOptions  JobOptions
+		expectedEnv []corev1.EnvVar
+	}{
+		{
+			name: "#1: No proxy",
+		},
+		{
+			name:       "#2: HTTP and HTTPS proxies",
+			jobOptions: JobOptions{HTTPProxy: "http://proxy.corp:3128", HTTPSProxy: "http://proxy.corp:3129"},
+			expectedEnv: []corev1.EnvVar{
+				{Name: "HTTP_PROXY", Value: "http://proxy.corp:3128"},
+				{Name: "http_proxy", Value: "http://proxy.corp:3128"},
+				{Name: "HTTPS_PROXY", Value: "http://proxy.corp:3129"},
+				{Name: "https_proxy", Value: "http://proxy.corp:3129"},
+				{Name: "NO_PROXY", Value: inClusterNoProxy},
+				{Name: "no_proxy", Value: inClusterNoProxy},
+			},
+		},
+		{
+			name:       "#3: Destinations added to the in-cluster destinations",
+			jobOptions: JobOptions{HTTPSProxy: "http://proxy.corp:3128", NoProxy: " registry.corp.internal,.svc,,10.96.0.1"},
+			expectedEnv: []corev1.EnvVar{
+				{Name: "HTTPS_PROXY", Value: "http://proxy.corp:3128"},
+				{Name: "https_proxy", Value: "http://proxy.corp:3128"},
+				{Name: "NO_PROXY", Value: inClusterNoProxy + ",registry.corp.internal,10.96.0.1"},
+				{Name: "no_proxy", Value: inClusterNoProxy + ",registry.corp.internal,10.96.0.1"},
+			},
+		},
+		{
+			name:       "#4: No proxy without a proxy",
+			jobOptions: JobOptions{NoProxy: "registry.corp.internal"},
+		},
+	}
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	for _, test := range tests {
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for name, job := range map[string]*batchv1.Job{"pull job": pullJob, "delete job": deleteJob} {
+			podSpec := job.Spec.Template.Spec
+			for _, c := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+				if !reflect.DeepEqual(c.Env, test.expectedEnv) {
+					t.Errorf("Test: %s failed: job=%s, container=%s, expectedEnv=%+v, actualEnv=%+v", test.name, name, c.Name, test.expectedEnv, c.Env)
+				}
+			}
+		}
+	}
+}
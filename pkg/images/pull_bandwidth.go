@@ -0,0 +1,45 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// IngressBandwidthAnnotationKey is the pod annotation from which the CNI bandwidth plugin shapes the
+// ingress traffic of the pod
+const IngressBandwidthAnnotationKey = "kubernetes.io/ingress-bandwidth"
+
+// MinPullBandwidth and MaxPullBandwidth are the bounds of the bandwidth annotations accepted by the kubelet
+var (
+	MinPullBandwidth = resource.MustParse("1k")
+	MaxPullBandwidth = resource.MustParse("1P")
+)
+
+// setPullBandwidth limits the ingress bandwidth of the pods of an image pull job. The annotation is set
+// by the controller, taking precedence over the same annotation in jobAnnotations.
+func setPullBandwidth(job *batchv1.Job, bandwidth *resource.Quantity) {
+	if bandwidth == nil {
+		return
+	}
+	template := &job.Spec.Template
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[IngressBandwidthAnnotationKey] = bandwidth.String()
+}
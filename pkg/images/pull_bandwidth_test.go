@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPullBandwidth(t *testing.T) {
+	tenMbps := resource.MustParse("10M")
+	tests := []struct {
+		name              string
+		pullBandwidth     *resource.Quantity
+		jobAnnotations    map[string]string
+		expectedBandwidth string
+	}{
+		{
+			name: "#1: No bandwidth limit",
+		},
+		{
+			name:              "#2: Bandwidth limit of the pull pods",
+			pullBandwidth:     &tenMbps,
+			expectedBandwidth: "10M",
+		},
+		{
+			name:              "#3: Bandwidth limit takes precedence over jobAnnotations",
+			pullBandwidth:     &tenMbps,
+			jobAnnotations:    map[string]string{IngressBandwidthAnnotationKey: "100M"},
+			expectedBandwidth: "10M",
+		},
+		{
+			name:              "#4: Bandwidth annotation of jobAnnotations",
+			jobAnnotations:    map[string]string{IngressBandwidthAnnotationKey: "100M"},
+			expectedBandwidth: "100M",
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				PullBandwidth:  test.pullBandwidth,
+				JobAnnotations: test.jobAnnotations,
+			},
+		}
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if actual := pullJob.Spec.Template.Annotations[IngressBandwidthAnnotationKey]; actual != test.expectedBandwidth {
+			t.Errorf("Test: %s failed: expectedBandwidth=%q, actualBandwidth=%q", test.name, test.expectedBandwidth, actual)
+		}
+		if _, ok := pullJob.Annotations[IngressBandwidthAnnotationKey]; ok {
+			t.Errorf("Test: %s failed: expected no bandwidth annotation on the pull job, actualAnnotations=%v", test.name, pullJob.Annotations)
+		}
+		// image deletes transfer no image data, so their pods only get the annotation of jobAnnotations
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		expected := test.jobAnnotations[IngressBandwidthAnnotationKey]
+		if actual := deleteJob.Spec.Template.Annotations[IngressBandwidthAnnotationKey]; actual != expected {
+			t.Errorf("Test: %s failed: expectedDeleteBandwidth=%q, actualDeleteBandwidth=%q", test.name, expected, actual)
+		}
+	}
+}
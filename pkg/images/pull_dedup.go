@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/klog/v2"
+)
+
+// samePull checks whether the pull requests pull the same image onto the same node the same way,
+// so that one of them can share the result of the job of the other
+func samePull(a, b ImageWorkRequest) bool {
+	if a.WorkType == ImageCachePurge || b.WorkType == ImageCachePurge {
+		return false
+	}
+	if a.Node.Labels["kubernetes.io/hostname"] != b.Node.Labels["kubernetes.io/hostname"] {
+		return false
+	}
+	var aPaths, bPaths []string
+	if a.CachePaths != nil {
+		aPaths = *a.CachePaths
+	}
+	if b.CachePaths != nil {
+		bPaths = *b.CachePaths
+	}
+	aCommand, bCommand := warmCommand(a), warmCommand(b)
+	aAliases, bAliases := imageAliases(a), imageAliases(b)
+	return SameImage(pinnedImage(a), pinnedImage(b)) && a.ArtifactType == b.ArtifactType &&
+		a.ForceFullCache == b.ForceFullCache && ((len(aPaths) == 0 && len(bPaths) == 0) || reflect.DeepEqual(aPaths, bPaths)) &&
+		((len(aCommand) == 0 && len(bCommand) == 0) || reflect.DeepEqual(aCommand, bCommand)) &&
+		((len(aAliases) == 0 && len(bAliases) == 0) || reflect.DeepEqual(aAliases, bAliases))
+}
+
+// shareActivePullJob makes the pull request wait for the result of an active job already pulling the same
+// image onto the same node, e.g. for another image cache, instead of creating a duplicate pull job.
+// It returns the name of the shared job, if any.
+func (m *ImageManager) shareActivePullJob(iwr ImageWorkRequest) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for job, iwres := range m.imageworkstatus {
+		// pull jobs being dispatched are keyed by a fake job name until they are created, and helper
+		// image check jobs pull no image
+		if iwres.Status != ImageWorkResultStatusJobCreated || strings.HasPrefix(job, fakeJobPrefix) ||
+			iwres.HelperImageCheck || !samePull(iwres.ImageWorkRequest, iwr) {
+			continue
+		}
+		m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{
+			ImageWorkRequest: iwr,
+			Status:           ImageWorkResultStatusJobShared,
+			SharedJob:        job,
+		}
+		return job, true
+	}
+	return "", false
+}
+
+// shareJobResult copies the result of the job to the requests sharing it, once the job finished.
+// The caller must hold m.lock.
+func (m *ImageManager) shareJobResult(job string, result ImageWorkResult) {
+	if result.Status == ImageWorkResultStatusJobCreated || result.Status == ImageWorkResultStatusJobQueued {
+		return
+	}
+	for key, iwres := range m.imageworkstatus {
+		if iwres.Status != ImageWorkResultStatusJobShared || iwres.SharedJob != job {
+			continue
+		}
+		iwres.Status = result.Status
+		iwres.Reason = result.Reason
+		iwres.Message = result.Message
+		iwres.Retries = result.Retries
+		iwres.TimeoutRetries = result.TimeoutRetries
+		iwres.FailureRetries = result.FailureRetries
+		iwres.ImagePullError = result.ImagePullError
+		iwres.RetryAfter = result.RetryAfter
+		m.imageworkstatus[key] = iwres
+		klog.Infof("Job %s result %s shared (pull: %s --> %s, image cache: %s)", job, result.Status, iwres.ImageWorkRequest.Image,
+			iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.Imagecache.Name)
+	}
+}
+
+// resolveSharedJobs copies the results of the finished jobs to the requests sharing them.
+// The caller must hold m.lock.
+func (m *ImageManager) resolveSharedJobs() {
+	for job, iwres := range m.imageworkstatus {
+		if iwres.Status != ImageWorkResultStatusJobShared {
+			m.shareJobResult(job, iwres)
+		}
+	}
+}
+
+// moveSharedJob makes the requests sharing a job share the job replacing it. The caller must hold m.lock.
+func (m *ImageManager) moveSharedJob(job, newJob string) {
+	for key, iwres := range m.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusJobShared && iwres.SharedJob == job {
+			iwres.SharedJob = newJob
+			m.imageworkstatus[key] = iwres
+		}
+	}
+}
+
+// notifySharedJob notifies the waits for the jobs of the image caches sharing the job that its result changed
+func (m *ImageManager) notifySharedJob(job string) {
+	imageCaches := map[string]bool{}
+	m.lock.RLock()
+	for _, iwres := range m.imageworkstatus {
+		if iwres.SharedJob == job && iwres.ImageWorkRequest.Imagecache != nil {
+			imageCaches[imageCacheKey(iwres.ImageWorkRequest.Imagecache)] = true
+		}
+	}
+	m.lock.RUnlock()
+	for cacheKey := range imageCaches {
+		m.notifyJobsChanged(cacheKey)
+	}
+}
+
+// sharedJobTimedOut returns the result of a request whose image cache stopped waiting for the shared job
+func sharedJobTimedOut(iwres ImageWorkResult) ImageWorkResult {
+	iwres.Status = ImageWorkResultStatusFailed
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonPullTimedOut
+	iwres.Message = pullTimedOutMessage("SharedJobActive", "job "+iwres.SharedJob+" still pulling the image")
+	return iwres
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSamePull(t *testing.T) {
+	otherNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "baz"},
+		},
+	}
+	cachePaths := []string{"/opt/conda/lib/"}
+	noCachePaths := []string{}
+	warmCommand := []string{"python", "-c", "import model; model.load()"}
+	pull := ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate}
+	tests := []struct {
+		name     string
+		other    ImageWorkRequest
+		expected bool
+	}{
+		{
+			name:     "#1: Same image by another reference on the same node",
+			other:    ImageWorkRequest{Image: "docker.io/library/nginx:1.25", Node: &node, WorkType: ImageCacheRefresh, CachePaths: &noCachePaths},
+			expected: true,
+		},
+		{
+			name:  "#2: Same image on another node",
+			other: ImageWorkRequest{Image: "nginx:1.25", Node: &otherNode, WorkType: ImageCacheCreate},
+		},
+		{
+			name:  "#3: Another tag of the image",
+			other: ImageWorkRequest{Image: "nginx:1.26", Node: &node, WorkType: ImageCacheCreate},
+		},
+		{
+			name:  "#4: Same image with files to cache",
+			other: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, CachePaths: &cachePaths},
+		},
+		{
+			name:  "#5: Same image pulled as an artifact",
+			other: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact},
+		},
+		{
+			name:  "#6: Same image deleted",
+			other: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCachePurge},
+		},
+		{
+			name:  "#7: Same image with a warm command",
+			other: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, WarmCommand: &warmCommand},
+		},
+	}
+	for _, test := range tests {
+		if actual := samePull(pull, test.other); actual != test.expected {
+			t.Errorf("Test: %s failed: expectedSamePull=%t, actualSamePull=%t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestSharedPullJob(t *testing.T) {
+	foo := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	bar := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: fledgedNameSpace}}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, Imagecache: foo})
+	imagemanager.processNextWorkItem()
+	imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: "docker.io/library/nginx:1.25", Node: &node, WorkType: ImageCacheCreate, Imagecache: bar})
+	imagemanager.processNextWorkItem()
+
+	jobs := activeJobs(imagemanager)
+	if len(jobs) != 1 {
+		t.Fatalf("Test: #1: Single pull job for both image caches failed: expectedJobs=1, actualJobs=%d", len(jobs))
+	}
+	creates := 0
+	for _, action := range fakekubeclientset.Actions() {
+		if action.Matches("create", "jobs") {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("Test: #1: Single pull job for both image caches failed: expectedJobsCreated=1, actualJobsCreated=%d", creates)
+	}
+	var shared string
+	for key, iwres := range imagemanager.imageworkstatus {
+		if iwres.ImageWorkRequest.Imagecache.Name == "bar" {
+			shared = key
+			if iwres.Status != ImageWorkResultStatusJobShared || iwres.SharedJob != jobs[0] {
+				t.Errorf("Test: #1: Single pull job for both image caches failed: expectedStatus=%s, expectedSharedJob=%s, actualStatus=%s, actualSharedJob=%s",
+					ImageWorkResultStatusJobShared, jobs[0], iwres.Status, iwres.SharedJob)
+			}
+		}
+	}
+	if imagemanager.jobsDone(imageCacheKey(bar)) {
+		t.Errorf("Test: #2: Image cache waits for the shared job failed: expectedJobsDone=false, actualJobsDone=true")
+	}
+
+	imagemanager.handlePodStatusChange(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job-name": jobs[0]}},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	})
+	if !imagemanager.jobsDone(imageCacheKey(bar)) {
+		t.Errorf("Test: #3: Result of the shared job is shared failed: expectedJobsDone=true, actualJobsDone=false")
+	}
+	if iwres := imagemanager.imageworkstatus[shared]; iwres.Status != ImageWorkResultStatusSucceeded {
+		t.Errorf("Test: #3: Result of the shared job is shared failed: expectedStatus=%s, actualStatus=%s", ImageWorkResultStatusSucceeded, iwres.Status)
+	}
+}
+
+func TestSharedPullJobResult(t *testing.T) {
+	foo := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	bar := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: fledgedNameSpace}}
+	tests := []struct {
+		name            string
+		ownerStatus     string
+		collectOwner    bool
+		expectedStatus  string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:            "#1: Failure of the shared job is shared",
+			ownerStatus:     ImageWorkResultStatusFailed,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "Error",
+			expectedMessage: "manifest unknown",
+		},
+		{
+			name:            "#2: Result of the shared job is shared when its image cache collects it",
+			ownerStatus:     ImageWorkResultStatusFailed,
+			collectOwner:    true,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  "Error",
+			expectedMessage: "manifest unknown",
+		},
+		{
+			name:            "#3: Shared job still active when the image cache stops waiting",
+			ownerStatus:     ImageWorkResultStatusJobCreated,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonPullTimedOut,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessagePullTimedOut + " (SharedJobActive: job foo-abcde still pulling the image)",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(newJobCreatingClientset(), "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.imageworkstatus["foo-abcde"] = ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, Imagecache: foo},
+			Status:           test.ownerStatus,
+			Reason:           "Error",
+			Message:          "manifest unknown",
+		}
+		imagemanager.imageworkstatus["fakejob-abcde"] = ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, Imagecache: bar},
+			Status:           ImageWorkResultStatusJobShared,
+			SharedJob:        "foo-abcde",
+		}
+		if test.collectOwner {
+			errCh := make(chan error, 1)
+			imagemanager.updateImageCacheStatus(foo, errCh)
+			if _, ok := imagemanager.imageworkstatus["foo-abcde"]; ok {
+				t.Errorf("Test: %s failed: expected result of job foo-abcde collected", test.name)
+			}
+		}
+		if err := imagemanager.updatePendingImageWorkResults(imageCacheKey(bar)); err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		iwres := imagemanager.imageworkstatus["fakejob-abcde"]
+		if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, expectedMessage=%s, actualStatus=%s, actualReason=%s, actualMessage=%s",
+				test.name, test.expectedStatus, test.expectedReason, test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message)
+		}
+	}
+}
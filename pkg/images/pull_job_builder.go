@@ -6,6 +6,7 @@ package images
 
 import (
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
@@ -13,7 +14,6 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // common Job will cache all at default status, but none at streaming mode of GCP
@@ -27,11 +27,7 @@ func commonJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy
 			GenerateName: imagecache.Name + "-",
 			Namespace:    imagecache.Namespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
-					Group:   fledgedv1alpha3.SchemeGroupVersion.Group,
-					Version: fledgedv1alpha3.SchemeGroupVersion.Version,
-					Kind:    "ImageCache",
-				}),
+				ownerReference(imagecache),
 			},
 			Labels: labels,
 		},
@@ -85,18 +81,14 @@ func commonJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy
 					},
 					RestartPolicy:    corev1.RestartPolicyNever,
 					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
-					Tolerations: []corev1.Toleration{
-						{
-							Operator: corev1.TolerationOpExists,
-						},
-					},
 				},
 			},
 		},
 	}
 }
 
-// special Job to cache common used files and directories at streaming mode of GCP
+// special Job to cache common used files and directories at streaming mode of GCP. Files that the user
+// of the job cannot read are skipped: the job reports them on stderr and still succeeds.
 func dirCacheJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy corev1.PullPolicy,
 	hostname string, labels map[string]string, cacheDir []string) *batchv1.Job {
 	backoffLimit := int32(0)
@@ -107,11 +99,7 @@ func dirCacheJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolic
 			GenerateName: imagecache.Name + "-",
 			Namespace:    imagecache.Namespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
-					Group:   fledgedv1alpha3.SchemeGroupVersion.Group,
-					Version: fledgedv1alpha3.SchemeGroupVersion.Version,
-					Kind:    "ImageCache",
-				}),
+				ownerReference(imagecache),
 			},
 			Labels: labels,
 		},
@@ -134,24 +122,14 @@ func dirCacheJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolic
 							Command: []string{
 								"bash",
 								"-c",
-								fmt.Sprintf("find %s "+
-									"-prune -o -path \"/dev/*\" "+
-									"-prune -o -path \"/proc/*\" "+
-									"-prune -o -path \"/sys/*\" "+
-									"-prune -o -path \"/mnt/*\" "+
-									"-type f -print0 | xargs -0 cat > /dev/null || true",
-									strings.Join(cacheDir, " ")),
+								findCacheFilesCommand(cacheDir) + " | xargs -0 -r cat >/dev/null || " +
+									"echo \"Some files could not be read and were not cached\" >&2",
 							},
 							ImagePullPolicy: pullPolicy,
 						},
 					},
 					RestartPolicy:    corev1.RestartPolicyNever,
 					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
-					Tolerations: []corev1.Toleration{
-						{
-							Operator: corev1.TolerationOpExists,
-						},
-					},
 				},
 			},
 		},
@@ -163,3 +141,40 @@ func fullCacheJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPoli
 	hostname string, labels map[string]string) *batchv1.Job {
 	return dirCacheJob(imagecache, image, pullPolicy, hostname, labels, []string{"/"})
 }
+
+// prunedCacheDirs are the pseudo and mount filesystems whose files are never read by a dir cache job
+var prunedCacheDirs = []string{"/dev", "/proc", "/sys", "/mnt"}
+
+// findCacheFilesCommand returns a find command listing the regular files under cacheDir, NUL-separated,
+// without descending into prunedCacheDirs
+func findCacheFilesCommand(cacheDir []string) string {
+	pruned := make([]string, len(prunedCacheDirs))
+	for i, dir := range prunedCacheDirs {
+		pruned[i] = "-path " + dir
+	}
+	return fmt.Sprintf("find %s \\( %s \\) -prune -o -type f -print0",
+		shellQuoteAll(cacheDir), strings.Join(pruned, " -o "))
+}
+
+// validateCachePath checks that a directory to be cached is an absolute path
+func validateCachePath(cachePath string) error {
+	if cachePath == "" {
+		return fmt.Errorf("cache path is empty")
+	}
+	if !path.IsAbs(cachePath) {
+		return fmt.Errorf("cache path %q is not an absolute path", cachePath)
+	}
+	if strings.ContainsAny(cachePath, "\x00\n") {
+		return fmt.Errorf("cache path %q contains a NUL or newline character", cachePath)
+	}
+	return nil
+}
+
+// shellQuoteAll single-quotes each argument so that it is passed verbatim to the shell
+func shellQuoteAll(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,171 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package images
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDirCacheJobFindCommand(t *testing.T) {
+	if _, err := exec.LookPath("find"); err != nil {
+		t.Skip("find is not installed")
+	}
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	root := t.TempDir()
+	files := []string{
+		"conda/bin/python",
+		"conda/lib/libc.so",
+		"conda/lib/site-packages/numpy/core.py",
+		"my models/llama.bin",
+		"data; rm -rf/weights.bin",
+		"it's/config.json",
+		"other/unused.txt",
+	}
+	for _, file := range files {
+		file = filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Error creating directory: %s", err.Error())
+		}
+		if err := os.WriteFile(file, []byte("cached"), 0644); err != nil {
+			t.Fatalf("Error creating file: %s", err.Error())
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "other"), filepath.Join(root, "conda", "link")); err != nil {
+		t.Fatalf("Error creating symlink: %s", err.Error())
+	}
+	tests := []struct {
+		name          string
+		cacheDir      []string
+		expectedFiles []string
+	}{
+		{
+			name:          "#1: Plain paths",
+			cacheDir:      []string{"conda/bin/", "conda/lib/"},
+			expectedFiles: []string{"conda/bin/python", "conda/lib/libc.so", "conda/lib/site-packages/numpy/core.py"},
+		},
+		{
+			name:          "#2: Symlinks are not followed",
+			cacheDir:      []string{"conda/"},
+			expectedFiles: []string{"conda/bin/python", "conda/lib/libc.so", "conda/lib/site-packages/numpy/core.py"},
+		},
+		{
+			name:          "#3: Path with a space",
+			cacheDir:      []string{"my models/"},
+			expectedFiles: []string{"my models/llama.bin"},
+		},
+		{
+			name:          "#4: Path with a semicolon",
+			cacheDir:      []string{"data; rm -rf"},
+			expectedFiles: []string{"data; rm -rf/weights.bin"},
+		},
+		{
+			name:          "#5: Path with a single quote",
+			cacheDir:      []string{"it's"},
+			expectedFiles: []string{"it's/config.json"},
+		},
+	}
+	for _, test := range tests {
+		cacheDir := make([]string, len(test.cacheDir))
+		for i, dir := range test.cacheDir {
+			cacheDir[i] = filepath.Join(root, dir) + "/"
+		}
+		job := dirCacheJob(imagecache, "foo:v1", corev1.PullIfNotPresent, "bar", map[string]string{}, cacheDir)
+		command := job.Spec.Template.Spec.Containers[0].Command[2]
+		findCommand := findCacheFilesCommand(cacheDir)
+		if !strings.HasPrefix(command, findCommand+" | ") {
+			t.Errorf("Test: %s failed: expectedPrefix=%s, actualCommand=%s", test.name, findCommand, command)
+			continue
+		}
+		output, err := exec.Command("bash", "-c", findCommand).Output()
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		actualFiles := []string{}
+		for _, file := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+			if file == "" {
+				continue
+			}
+			relPath, err := filepath.Rel(root, file)
+			if err != nil {
+				t.Errorf("Test: %s failed: file %s is outside %s", test.name, file, root)
+				continue
+			}
+			actualFiles = append(actualFiles, relPath)
+		}
+		sort.Strings(actualFiles)
+		if !reflect.DeepEqual(actualFiles, test.expectedFiles) {
+			t.Errorf("Test: %s failed: expectedFiles=%q, actualFiles=%q", test.name, test.expectedFiles, actualFiles)
+		}
+	}
+}
+
+func TestFindCacheFilesCommandPrunesPseudoFilesystems(t *testing.T) {
+	command := findCacheFilesCommand([]string{"/"})
+	expected := `find '/' \( -path /dev -o -path /proc -o -path /sys -o -path /mnt \) -prune -o -type f -print0`
+	if command != expected {
+		t.Errorf("Test: prune pseudo filesystems failed: expectedCommand=%s, actualCommand=%s", expected, command)
+	}
+}
+
+func TestValidateCachePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		cachePath   string
+		expectError bool
+	}{
+		{
+			name:      "#1: Absolute path",
+			cachePath: "/opt/conda/lib/",
+		},
+		{
+			name:      "#2: Absolute path with a space",
+			cachePath: "/data/my models",
+		},
+		{
+			name:      "#3: Absolute path with a semicolon",
+			cachePath: "/data;ls",
+		},
+		{
+			name:        "#4: Empty path",
+			cachePath:   "",
+			expectError: true,
+		},
+		{
+			name:        "#5: Relative path",
+			cachePath:   "opt/conda",
+			expectError: true,
+		},
+		{
+			name:        "#6: Path with a newline",
+			cachePath:   "/data\n/etc",
+			expectError: true,
+		},
+	}
+	for _, test := range tests {
+		err := validateCachePath(test.cachePath)
+		if test.expectError && err == nil {
+			t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+	}
+}
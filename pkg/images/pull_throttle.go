@@ -0,0 +1,279 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+// pullJobThrottled reports whether the number of active pull jobs of the request is limited, per node,
+// per registry or cluster-wide, or by the rollout strategy of its image cache
+func (m *ImageManager) pullJobThrottled(iwr ImageWorkRequest) bool {
+	return m.jobOptions.MaxPullJobsPerNode > 0 || m.jobOptions.MaxConcurrentPullJobs > 0 || iwr.MaxUnavailableNodes > 0 ||
+		iwr.MaxUnavailableNodesPerGroup > 0 || m.registryPullLimited()
+}
+
+// activePullJobs returns the number of pull jobs created and not yet finished, in total, per node, per
+// registry and per image cache, and the nodes with such pull jobs per image cache and per node group
+// of an image cache. Together with
+// MaxConcurrentPullJobs and the registry pull limits it acts as a counting semaphore for pull jobs.
+// The caller must hold m.lock.
+func (m *ImageManager) activePullJobs() (int, map[string]int, map[string]int, map[string]int, map[string]map[string]bool) {
+	total := 0
+	perNode := map[string]int{}
+	perRegistry := map[string]int{}
+	perImageCache := map[string]int{}
+	nodesPerImageCache := map[string]map[string]bool{}
+	for _, iwres := range m.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusJobCreated && iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+			total++
+			perNode[iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"]]++
+			perRegistry[m.pullRegistry(iwres.ImageWorkRequest)]++
+			perImageCache[imageCacheKey(iwres.ImageWorkRequest.Imagecache)]++
+			addNode(nodesPerImageCache, iwres.ImageWorkRequest)
+		}
+	}
+	return total, perNode, perRegistry, perImageCache, nodesPerImageCache
+}
+
+// addNode records the node of the request among the nodes of its image cache, and of its node group
+// if the rollout strategy of the image cache limits the nodes per group
+func addNode(nodesPerImageCache map[string]map[string]bool, iwr ImageWorkRequest) {
+	keys := []string{imageCacheKey(iwr.Imagecache)}
+	if iwr.MaxUnavailableNodesPerGroup > 0 {
+		keys = append(keys, nodeGroupKey(iwr))
+	}
+	for _, key := range keys {
+		if nodesPerImageCache[key] == nil {
+			nodesPerImageCache[key] = map[string]bool{}
+		}
+		nodesPerImageCache[key][iwr.Node.Labels["kubernetes.io/hostname"]] = true
+	}
+}
+
+// nodeGroupKey returns the key of the image cache of the request followed by ":" and its node group.
+// Neither names nor label values have a colon, so the key differs from the keys of image caches.
+func nodeGroupKey(iwr ImageWorkRequest) string {
+	return imageCacheKey(iwr.Imagecache) + ":" + iwr.NodeGroup
+}
+
+// pullJobSlotFree reports whether a pull job can be created for the request. A node joins the nodes
+// refreshing an image cache only while fewer than MaxUnavailableNodes of them, and fewer than
+// MaxUnavailableNodesPerGroup of the nodes of its node group, have active pull jobs.
+func (m *ImageManager) pullJobSlotFree(total int, perNode, perRegistry map[string]int,
+	nodesPerImageCache map[string]map[string]bool, iwr ImageWorkRequest) bool {
+	hostname := iwr.Node.Labels["kubernetes.io/hostname"]
+	if m.jobOptions.MaxConcurrentPullJobs > 0 && total >= m.jobOptions.MaxConcurrentPullJobs {
+		return false
+	}
+	if m.jobOptions.MaxPullJobsPerNode > 0 && perNode[hostname] >= m.jobOptions.MaxPullJobsPerNode {
+		return false
+	}
+	if registry := m.pullRegistry(iwr); registry != "" {
+		if limit := m.registryPullLimit(registry); limit > 0 && perRegistry[registry] >= limit {
+			return false
+		}
+	}
+	if nodes := nodesPerImageCache[imageCacheKey(iwr.Imagecache)]; iwr.MaxUnavailableNodes > 0 && !nodes[hostname] &&
+		len(nodes) >= iwr.MaxUnavailableNodes {
+		return false
+	}
+	if nodes := nodesPerImageCache[nodeGroupKey(iwr)]; iwr.MaxUnavailableNodesPerGroup > 0 && !nodes[hostname] &&
+		len(nodes) >= iwr.MaxUnavailableNodesPerGroup {
+		return false
+	}
+	return true
+}
+
+// queuePullJob queues the image pull request until a pull job slot is free. The request is queued
+// after the requests of the image cache of the same or higher priority.
+func (m *ImageManager) queuePullJob(iwr ImageWorkRequest) {
+	cacheKey := imageCacheKey(iwr.Imagecache)
+	m.lock.Lock()
+	key := names.SimpleNameGenerator.GenerateName(fakeJobPrefix)
+	m.imageworkstatus[key] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobQueued}
+	if _, ok := m.pendingPullJobs[cacheKey]; !ok {
+		m.pendingImageCaches = append(m.pendingImageCaches, cacheKey)
+	}
+	pending := m.pendingPullJobs[cacheKey]
+	i := len(pending)
+	for i > 0 && m.imageworkstatus[pending[i-1]].ImageWorkRequest.Priority < iwr.Priority {
+		i--
+	}
+	m.pendingPullJobs[cacheKey] = append(pending[:i:i], append([]string{key}, pending[i:]...)...)
+	m.lock.Unlock()
+	m.requestLogger(iwr).Info("Job queued", "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
+}
+
+// nextPullJob returns the index in the queue of the image cache of the first queued pull request
+// whose node has a free pull job slot. Expired requests are dropped from the queue. The caller must hold m.lock.
+func (m *ImageManager) nextPullJob(cacheKey string, total int, perNode, perRegistry map[string]int,
+	nodesPerImageCache map[string]map[string]bool) (int, bool) {
+	pending := []string{}
+	next, found := 0, false
+	for _, key := range m.pendingPullJobs[cacheKey] {
+		iwres, ok := m.imageworkstatus[key]
+		// The request might have expired and its status reported already
+		if !ok || iwres.Status != ImageWorkResultStatusJobQueued {
+			continue
+		}
+		if !found && m.pullJobSlotFree(total, perNode, perRegistry, nodesPerImageCache, iwres.ImageWorkRequest) {
+			next, found = len(pending), true
+		}
+		pending = append(pending, key)
+	}
+	m.pendingPullJobs[cacheKey] = pending
+	return next, found
+}
+
+// dispatchPullJobs creates pull jobs for the queued image pull requests as long as pull job slots are free.
+// A free slot goes to the image cache with the fewest active pull jobs, so that an image cache with many
+// images does not starve the others. The queued requests of the image caches aborting on failure are skipped.
+func (m *ImageManager) dispatchPullJobs() {
+	m.lock.Lock()
+	aborted := m.abortQueuedPullJobs()
+	total, perNode, perRegistry, perImageCache, nodesPerImageCache := m.activePullJobs()
+	dispatched := []string{}
+	for {
+		next, nextCacheKey := 0, ""
+		for _, cacheKey := range m.pendingImageCaches {
+			if nextCacheKey != "" && perImageCache[cacheKey] >= perImageCache[nextCacheKey] {
+				continue
+			}
+			if i, ok := m.nextPullJob(cacheKey, total, perNode, perRegistry, nodesPerImageCache); ok {
+				next, nextCacheKey = i, cacheKey
+			}
+		}
+		if nextCacheKey == "" {
+			break
+		}
+		pending := m.pendingPullJobs[nextCacheKey]
+		key := pending[next]
+		m.pendingPullJobs[nextCacheKey] = append(pending[:next:next], pending[next+1:]...)
+		// Reserve the slot until the job is created
+		iwres := m.imageworkstatus[key]
+		iwres.Status = ImageWorkResultStatusJobCreated
+		m.imageworkstatus[key] = iwres
+		total++
+		perNode[iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"]]++
+		perRegistry[m.pullRegistry(iwres.ImageWorkRequest)]++
+		perImageCache[nextCacheKey]++
+		addNode(nodesPerImageCache, iwres.ImageWorkRequest)
+		dispatched = append(dispatched, key)
+	}
+	remaining := []string{}
+	for _, cacheKey := range m.pendingImageCaches {
+		if len(m.pendingPullJobs[cacheKey]) > 0 {
+			remaining = append(remaining, cacheKey)
+		} else {
+			delete(m.pendingPullJobs, cacheKey)
+		}
+	}
+	m.pendingImageCaches = remaining
+	m.lock.Unlock()
+
+	for _, iwr := range aborted {
+		m.requestLogger(iwr).Info("Job not created", "reason", "aborted-on-failure", "action", "pull")
+		m.notifyImageWorkResult(iwr)
+	}
+
+	for _, key := range dispatched {
+		m.lock.RLock()
+		iwr := m.imageworkstatus[key].ImageWorkRequest
+		m.lock.RUnlock()
+		logger := m.requestLogger(iwr)
+		job, err := m.pullImage(iwr)
+		m.lock.Lock()
+		if err != nil {
+			logger.Error(err, "Error pulling image", "action", "pull")
+			m.imageworkstatus[key] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusFailed,
+				Reason: "JobCreationFailed", Message: err.Error()}
+		} else {
+			delete(m.imageworkstatus, key)
+			m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+		}
+		m.lock.Unlock()
+		if err != nil {
+			m.notifyImageWorkResult(iwr)
+		} else {
+			logger.Info("Job created", "job", job.Name, "action", "pull", "runtime", iwr.ContainerRuntimeVersion)
+		}
+	}
+}
+
+// pullJobRounds returns the number of successive batches of pull jobs needed for the image cache,
+// given its pull jobs still active or queued, the per node, per registry and cluster-wide limits and its rollout strategy,
+// per image cache and per node group
+func (m *ImageManager) pullJobRounds(cacheKey string) int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	total := 0
+	perNode := map[string]int{}
+	perRegistry := map[string]int{}
+	maxUnavailableNodes := 0
+	nodesPerGroup := map[string]map[string]bool{}
+	maxUnavailableNodesPerGroup := map[string]int{}
+	for _, iwres := range m.imageworkstatus {
+		if iwres.ImageWorkRequest.Imagecache == nil || imageCacheKey(iwres.ImageWorkRequest.Imagecache) != cacheKey ||
+			iwres.ImageWorkRequest.WorkType == ImageCachePurge {
+			continue
+		}
+		if iwres.Status == ImageWorkResultStatusJobCreated || iwres.Status == ImageWorkResultStatusJobQueued {
+			total++
+			perNode[iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"]]++
+			if registry := m.pullRegistry(iwres.ImageWorkRequest); registry != "" {
+				perRegistry[registry]++
+			}
+			maxUnavailableNodes = iwres.ImageWorkRequest.MaxUnavailableNodes
+			if limit := iwres.ImageWorkRequest.MaxUnavailableNodesPerGroup; limit > 0 {
+				addNode(nodesPerGroup, iwres.ImageWorkRequest)
+				maxUnavailableNodesPerGroup[nodeGroupKey(iwres.ImageWorkRequest)] = limit
+			}
+		}
+	}
+	rounds := 1
+	if limit := m.jobOptions.MaxConcurrentPullJobs; limit > 0 {
+		if r := (total + limit - 1) / limit; r > rounds {
+			rounds = r
+		}
+	}
+	if limit := m.jobOptions.MaxPullJobsPerNode; limit > 0 {
+		for _, n := range perNode {
+			if r := (n + limit - 1) / limit; r > rounds {
+				rounds = r
+			}
+		}
+	}
+	for registry, n := range perRegistry {
+		if limit := m.registryPullLimit(registry); limit > 0 {
+			if r := (n + limit - 1) / limit; r > rounds {
+				rounds = r
+			}
+		}
+	}
+	if limit := maxUnavailableNodes; limit > 0 {
+		if r := (len(perNode) + limit - 1) / limit; r > rounds {
+			rounds = r
+		}
+	}
+	for group, limit := range maxUnavailableNodesPerGroup {
+		if r := (len(nodesPerGroup[group]) + limit - 1) / limit; r > rounds {
+			rounds = r
+		}
+	}
+	return rounds
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"k8s.io/klog/v2"
+)
+
+// rateLimitedRegexp matches the errors of registries rate-limiting pulls e.g. the
+// "toomanyrequests: You have reached your pull rate limit" of Docker Hub, or HTTP 429
+var rateLimitedRegexp = regexp.MustCompile(`(?i)toomanyrequests|too many requests|(?:status|code|error)[: ]+429\b`)
+
+// retryAfterRegexp matches the retry-after, in seconds, given by some registries with a rate-limit error
+var retryAfterRegexp = regexp.MustCompile(`(?i)retry[- ]after[:= ]+(\d+)`)
+
+// registryRateLimited checks whether the error of a pull is a rate limit of the registry, and returns
+// the retry-after given by the registry if any
+func registryRateLimited(message string) (time.Duration, bool) {
+	if !rateLimitedRegexp.MatchString(message) {
+		return 0, false
+	}
+	if m := retryAfterRegexp.FindStringSubmatch(message); m != nil {
+		if seconds, err := strconv.Atoi(m[1]); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, true
+}
+
+// classifyRateLimited reports a failed job whose image pull was rate-limited by the registry with reason
+// RateLimited, and the duration after which the pull is to be retried
+func (m *ImageManager) classifyRateLimited(iwres *ImageWorkResult) {
+	if iwres.Status != ImageWorkResultStatusFailed {
+		return
+	}
+	retryAfter, ok := registryRateLimited(iwres.Message)
+	if !ok {
+		return
+	}
+	if retryAfter == 0 {
+		retryAfter = m.jobOptions.RateLimitRetryAfter
+	}
+	klog.Warningf("Image pull rate-limited by the registry (%s --> %s), retry after %s: %s", iwres.ImageWorkRequest.Image,
+		iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], retryAfter, iwres.Message)
+	iwres.Reason = fledgedv1alpha3.ImageCacheReasonRateLimited
+	iwres.RetryAfter = retryAfter
+}
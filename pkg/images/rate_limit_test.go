@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+	"time"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+const dockerHubRateLimitError = "failed to pull and unpack image \"docker.io/library/nginx:1.25\": failed to copy: httpReadSeeker: failed open: " +
+	"unexpected status code https://registry-1.docker.io/v2/library/nginx/manifests/sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31: " +
+	"429 Too Many Requests - Server message: toomanyrequests: You have reached your pull rate limit. " +
+	"You may increase the limit by authenticating and upgrading: https://www.docker.com/increase-rate-limit"
+
+func TestRegistryRateLimited(t *testing.T) {
+	tests := []struct {
+		name               string
+		message            string
+		expectedLimited    bool
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name:            "#1: Docker Hub pull rate limit",
+			message:         dockerHubRateLimitError,
+			expectedLimited: true,
+		},
+		{
+			name:            "#2: Docker daemon error",
+			message:         "Error response from daemon: toomanyrequests: Rate exceeded",
+			expectedLimited: true,
+		},
+		{
+			name:               "#3: HTTP 429 with a retry-after",
+			message:            "error pulling image: unexpected status code 429, Retry-After: 120",
+			expectedLimited:    true,
+			expectedRetryAfter: 2 * time.Minute,
+		},
+		{
+			name:            "#4: Image not found",
+			message:         "failed to pull and unpack image \"docker.io/library/nginx:429\": not found",
+			expectedLimited: false,
+		},
+		{
+			name:            "#5: Digest containing 429",
+			message:         "manifest unknown: sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9429",
+			expectedLimited: false,
+		},
+	}
+	for _, test := range tests {
+		retryAfter, limited := registryRateLimited(test.message)
+		if limited != test.expectedLimited || retryAfter != test.expectedRetryAfter {
+			t.Errorf("Test: %s failed: expectedRateLimited=%t, expectedRetryAfter=%s, actualRateLimited=%t, actualRetryAfter=%s",
+				test.name, test.expectedLimited, test.expectedRetryAfter, limited, retryAfter)
+		}
+	}
+}
+
+func TestClassifyRateLimited(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             corev1.PodStatus
+		expectedReason     string
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name: "#1: Termination message of a rate-limited pull",
+			status: corev1.PodStatus{
+				Phase:             corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{terminated(1, "Error", dockerHubRateLimitError)},
+			},
+			expectedReason:     fledgedv1alpha3.ImageCacheReasonRateLimited,
+			expectedRetryAfter: time.Hour,
+		},
+		{
+			name: "#2: Image of the job rate-limited by the registry",
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason: waitingReasonErrImagePull, Message: "rpc error: code = Unknown desc = " + dockerHubRateLimitError}}}},
+			},
+			expectedReason:     fledgedv1alpha3.ImageCacheReasonRateLimited,
+			expectedRetryAfter: time.Hour,
+		},
+		{
+			name: "#3: Retry-after given by the registry",
+			status: corev1.PodStatus{
+				Phase:             corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{terminated(1, "Error", "429 Too Many Requests (retry-after=30)")},
+			},
+			expectedReason:     fledgedv1alpha3.ImageCacheReasonRateLimited,
+			expectedRetryAfter: 30 * time.Second,
+		},
+		{
+			name: "#4: Other pull failure",
+			status: corev1.PodStatus{
+				Phase:             corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{terminated(1, "Error", "pull access denied")},
+			},
+			expectedReason: "Error",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.RateLimitRetryAfter = time.Hour
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				Image:    "nginx:1.25",
+				WorkType: ImageCacheCreate,
+				Node:     &node,
+			},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-fledged", Labels: map[string]string{"job-name": "fakejob"}},
+			Status:     test.status,
+		}
+		if test.status.Phase == corev1.PodPending {
+			imagemanager.handlePodPending(pod)
+		} else {
+			imagemanager.handlePodStatusChange(pod)
+		}
+
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != test.expectedReason || iwres.RetryAfter != test.expectedRetryAfter {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, expectedRetryAfter=%s, actualStatus=%s, actualReason=%s, actualRetryAfter=%s",
+				test.name, ImageWorkResultStatusFailed, test.expectedReason, test.expectedRetryAfter, iwres.Status, iwres.Reason, iwres.RetryAfter)
+		}
+	}
+}
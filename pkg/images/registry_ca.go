@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// RegistryCertsDirAnnotationKey is the node annotation that sets the registry trust directory of that node
+const RegistryCertsDirAnnotationKey = "kubefledged.io/registry-certs-dir"
+
+// Registry trust directories of the container runtimes, in which the CA bundle of a registry is read
+// from <dir>/<registry>/ca.crt
+const (
+	dockerCertsDir             = "/etc/docker/certs.d"
+	containerdCertsDir         = "/etc/containerd/certs.d"
+	k3sContainerdCertsDir      = "/var/lib/rancher/k3s/agent/etc/containerd/certs.d"
+	microk8sContainerdCertsDir = "/var/snap/microk8s/current/args/certs.d"
+	containersCertsDir         = "/etc/containers/certs.d"
+)
+
+// registryCAMountPath is where the CA bundles are mounted in the container installing them
+const registryCAMountPath = "/var/run/kubefledged/registry-ca"
+
+// registryCertsMountPath is where the registry trust directory of the node is mounted in the container installing them
+const registryCertsMountPath = "/var/run/kubefledged/certs.d"
+
+// resolveRegistryCertsDir returns the registry trust directory of the container runtime of the node. In order of
+// precedence: the node's RegistryCertsDirAnnotationKey annotation, the directory of the kubernetes distribution
+// (k3s/rke2, microk8s), set by distributionOverride or detected from the node, and finally the directory of the runtime.
+func resolveRegistryCertsDir(node *corev1.Node, runtime containerRuntime, containerRuntimeVersion string, distributionOverride string) string {
+	if certsDir := node.Annotations[RegistryCertsDirAnnotationKey]; certsDir != "" {
+		return certsDir
+	}
+	switch runtime {
+	case runtimeContainerd, runtimeNerdctl:
+		switch detectKubernetesDistribution(node, containerRuntimeVersion, distributionOverride) {
+		case distributionK3s:
+			return k3sContainerdCertsDir
+		case distributionMicrok8s:
+			return microk8sContainerdCertsDir
+		}
+		return containerdCertsDir
+	case runtimeCRIO, runtimePodman:
+		return containersCertsDir
+	default:
+		return dockerCertsDir
+	}
+}
+
+// setRegistryCAs adds an init container to an image pull job that installs the CA bundles of the registries of the
+// image cache in the registry trust directory of the node, so that the image is pulled from registries with a
+// self-signed or internal CA without disabling TLS verification. The kubelet pulls the image of the job only once
+// the init containers completed. The init container runs as root, the owner of the trust directory.
+func setRegistryCAs(job *batchv1.Job, registryCAs []fledgedv1alpha3.RegistryCA, node *corev1.Node, busyboxImage string,
+	runtimeOverride string, distributionOverride string) {
+	if len(registryCAs) == 0 {
+		return
+	}
+	if isWindowsNode(node) {
+		klog.Warningf("Installing registry CAs is not supported on Windows node %s", node.Labels["kubernetes.io/hostname"])
+		return
+	}
+	containerRuntimeVersion := node.Status.NodeInfo.ContainerRuntimeVersion
+	certsDir := resolveRegistryCertsDir(node, detectContainerRuntime(containerRuntimeVersion, runtimeOverride), containerRuntimeVersion,
+		distributionOverride)
+
+	podSpec := &job.Spec.Template.Spec
+	mounts := []corev1.VolumeMount{{Name: "registry-certs", MountPath: registryCertsMountPath}}
+	commands := []string{}
+	directoryOrCreate := corev1.HostPathDirectoryOrCreate
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "registry-certs",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: certsDir, Type: &directoryOrCreate},
+		},
+	})
+	for i, ca := range registryCAs {
+		volume := corev1.Volume{Name: fmt.Sprintf("registry-ca-%d", i)}
+		if ca.ConfigMapRef != nil {
+			volume.VolumeSource.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: ca.ConfigMapRef.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: ca.ConfigMapRef.Key, Path: "ca.crt"}},
+			}
+		} else if ca.SecretRef != nil {
+			volume.VolumeSource.Secret = &corev1.SecretVolumeSource{
+				SecretName: ca.SecretRef.Name,
+				Items:      []corev1.KeyToPath{{Key: ca.SecretRef.Key, Path: "ca.crt"}},
+			}
+		} else {
+			continue
+		}
+		podSpec.Volumes = append(podSpec.Volumes, volume)
+		mountPath := path.Join(registryCAMountPath, volume.Name)
+		mounts = append(mounts, corev1.VolumeMount{Name: volume.Name, MountPath: mountPath, ReadOnly: true})
+		registryDir := path.Join(registryCertsMountPath, ca.Registry)
+		commands = append(commands, "mkdir -p "+shellQuoteAll([]string{registryDir})+
+			" && cp "+shellQuoteAll([]string{path.Join(mountPath, "ca.crt"), path.Join(registryDir, "ca.crt")}))
+	}
+
+	runAsNonRoot := false
+	runAsUser := int64(0)
+	securityContext := jobSecurityContext()
+	securityContext.RunAsNonRoot = &runAsNonRoot
+	securityContext.RunAsUser = &runAsUser
+	installer := corev1.Container{
+		Name:                     "install-registry-ca",
+		Image:                    busyboxImage,
+		Command:                  []string{"sh", "-c", strings.Join(commands, " && ")},
+		VolumeMounts:             mounts,
+		ImagePullPolicy:          corev1.PullIfNotPresent,
+		SecurityContext:          securityContext,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	if len(podSpec.Containers) > 0 {
+		installer.Resources = *podSpec.Containers[0].Resources.DeepCopy()
+	}
+	podSpec.InitContainers = append([]corev1.Container{installer}, podSpec.InitContainers...)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRegistryCAs(t *testing.T) {
+	registryCAs := []fledgedv1alpha3.RegistryCA{
+		{Registry: "registry.corp.internal:5000", ConfigMapRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "corp-ca"}, Key: "bundle.pem"}},
+		{Registry: "harbor.corp.internal", SecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "harbor-ca"}, Key: "ca.crt"}},
+	}
+	newNode := func(runtimeVersion string, labels, annotations map[string]string) *corev1.Node {
+		n := node.DeepCopy()
+		n.Status.NodeInfo.ContainerRuntimeVersion = runtimeVersion
+		for k, v := range labels {
+			n.Labels[k] = v
+		}
+		n.Annotations = annotations
+		return n
+	}
+	tests := []struct {
+		name             string
+		registryCAs      []fledgedv1alpha3.RegistryCA
+		node             *corev1.Node
+		runtimeOverride  string
+		expectedCertsDir string
+	}{
+		{
+			name: "#1: No registry CAs",
+			node: newNode("containerd://1.6.8", nil, nil),
+		},
+		{
+			name:             "#2: containerd node",
+			registryCAs:      registryCAs,
+			node:             newNode("containerd://1.6.8", nil, nil),
+			expectedCertsDir: containerdCertsDir,
+		},
+		{
+			name:             "#3: k3s node",
+			registryCAs:      registryCAs,
+			node:             newNode("containerd://1.7.7-k3s1", nil, nil),
+			expectedCertsDir: k3sContainerdCertsDir,
+		},
+		{
+			name:             "#4: cri-o node",
+			registryCAs:      registryCAs,
+			node:             newNode("cri-o://1.25.1", nil, nil),
+			expectedCertsDir: containersCertsDir,
+		},
+		{
+			name:             "#5: docker node",
+			registryCAs:      registryCAs,
+			node:             newNode("docker://20.10.17", nil, nil),
+			expectedCertsDir: dockerCertsDir,
+		},
+		{
+			name:             "#6: Container runtime override",
+			registryCAs:      registryCAs,
+			node:             newNode("docker://20.10.17", nil, nil),
+			runtimeOverride:  "containerd",
+			expectedCertsDir: containerdCertsDir,
+		},
+		{
+			name:             "#7: Trust directory set by the node annotation",
+			registryCAs:      registryCAs,
+			node:             newNode("containerd://1.6.8", nil, map[string]string{RegistryCertsDirAnnotationKey: "/etc/registry/certs.d"}),
+			expectedCertsDir: "/etc/registry/certs.d",
+		},
+		{
+			name:        "#8: Windows node",
+			registryCAs: registryCAs,
+			node:        newNode("containerd://1.6.8", map[string]string{"kubernetes.io/os": "windows"}, nil),
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Spec:       fledgedv1alpha3.ImageCacheSpec{RegistryCAs: test.registryCAs},
+		}
+		if test.node.Labels["kubernetes.io/os"] == "windows" {
+			test.node.Status.NodeInfo.OperatingSystem = "windows"
+		}
+		job, err := newImagePullJob(imagecache, "registry.corp.internal:5000/app:v1", false, nil, nil, test.node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", JobOptions{ContainerRuntime: test.runtimeOverride})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		var installer *corev1.Container
+		for i := range podSpec.InitContainers {
+			if podSpec.InitContainers[i].Name == "install-registry-ca" {
+				installer = &podSpec.InitContainers[i]
+			}
+		}
+		if test.expectedCertsDir == "" {
+			if installer != nil {
+				t.Errorf("Test: %s failed: expectedInstaller=nil, actualInstaller=%+v", test.name, installer)
+			}
+			continue
+		}
+		if installer == nil || podSpec.InitContainers[0].Name != "install-registry-ca" {
+			t.Errorf("Test: %s failed: expected install-registry-ca to be the first init container, actualInitContainers=%+v", test.name, podSpec.InitContainers)
+			continue
+		}
+		volumes := map[string]corev1.Volume{}
+		for _, v := range podSpec.Volumes {
+			volumes[v.Name] = v
+		}
+		certs := volumes["registry-certs"].HostPath
+		if certs == nil || certs.Path != test.expectedCertsDir || certs.Type == nil || *certs.Type != corev1.HostPathDirectoryOrCreate {
+			t.Errorf("Test: %s failed: expectedCertsDir=%s, actualVolume=%+v", test.name, test.expectedCertsDir, volumes["registry-certs"])
+		}
+		expectedConfigMap := &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "corp-ca"},
+			Items:                []corev1.KeyToPath{{Key: "bundle.pem", Path: "ca.crt"}},
+		}
+		if !reflect.DeepEqual(volumes["registry-ca-0"].ConfigMap, expectedConfigMap) {
+			t.Errorf("Test: %s failed: expectedConfigMap=%+v, actualVolume=%+v", test.name, expectedConfigMap, volumes["registry-ca-0"])
+		}
+		expectedSecret := &corev1.SecretVolumeSource{
+			SecretName: "harbor-ca",
+			Items:      []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+		}
+		if !reflect.DeepEqual(volumes["registry-ca-1"].Secret, expectedSecret) {
+			t.Errorf("Test: %s failed: expectedSecret=%+v, actualVolume=%+v", test.name, expectedSecret, volumes["registry-ca-1"])
+		}
+		expectedMounts := []corev1.VolumeMount{
+			{Name: "registry-certs", MountPath: registryCertsMountPath},
+			{Name: "registry-ca-0", MountPath: registryCAMountPath + "/registry-ca-0", ReadOnly: true},
+			{Name: "registry-ca-1", MountPath: registryCAMountPath + "/registry-ca-1", ReadOnly: true},
+		}
+		if !reflect.DeepEqual(installer.VolumeMounts, expectedMounts) {
+			t.Errorf("Test: %s failed: expectedVolumeMounts=%+v, actualVolumeMounts=%+v", test.name, expectedMounts, installer.VolumeMounts)
+		}
+		expectedCommand := []string{"sh", "-c",
+			"mkdir -p '/var/run/kubefledged/certs.d/registry.corp.internal:5000' && " +
+				"cp '/var/run/kubefledged/registry-ca/registry-ca-0/ca.crt' '/var/run/kubefledged/certs.d/registry.corp.internal:5000/ca.crt' && " +
+				"mkdir -p '/var/run/kubefledged/certs.d/harbor.corp.internal' && " +
+				"cp '/var/run/kubefledged/registry-ca/registry-ca-1/ca.crt' '/var/run/kubefledged/certs.d/harbor.corp.internal/ca.crt'"}
+		if !reflect.DeepEqual(installer.Command, expectedCommand) {
+			t.Errorf("Test: %s failed: expectedCommand=%q, actualCommand=%q", test.name, expectedCommand, installer.Command)
+		}
+		// the CA bundles are written to the trust directory of the node, owned by root
+		if sc := installer.SecurityContext; sc == nil || sc.RunAsUser == nil || *sc.RunAsUser != 0 ||
+			sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem {
+			t.Errorf("Test: %s failed: expected read-only root filesystem and user 0, actualSecurityContext=%+v", test.name, installer.SecurityContext)
+		}
+	}
+}
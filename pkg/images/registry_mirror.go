@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"k8s.io/klog/v2"
+)
+
+// RewriteImageRef rewrites the image reference to pull it from a registry mirror. mirrors maps a
+// source prefix of fully-qualified repository names (e.g. docker.io/library) to the prefix of the
+// mirror (e.g. registry.internal/mirror). The longest source prefix matching whole path components
+// of the repository name wins. The tag and digest of the image are preserved, and a reference with
+// neither is given the latest tag. Images matching no source prefix are returned unchanged.
+func RewriteImageRef(image string, mirrors map[string]string) string {
+	if len(mirrors) == 0 {
+		return image
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		// let the job report the invalid reference
+		klog.Warningf("Unable to parse image reference %s for registry mirrors: %v", image, err)
+		return image
+	}
+	name := named.Name()
+	source, mirror, matched := "", "", false
+	for s, m := range mirrors {
+		prefix := strings.TrimSuffix(s, "/")
+		if (name == prefix || strings.HasPrefix(name, prefix+"/")) && (!matched || len(prefix) > len(source)) {
+			source, mirror, matched = prefix, m, true
+		}
+	}
+	if !matched {
+		return image
+	}
+	rewritten := strings.TrimSuffix(mirror, "/") + strings.TrimPrefix(name, source)
+	tagged, isTagged := named.(reference.Tagged)
+	canonical, isCanonical := named.(reference.Canonical)
+	if isTagged {
+		rewritten += ":" + tagged.Tag()
+	}
+	if isCanonical {
+		rewritten += "@" + canonical.Digest().String()
+	}
+	if !isTagged && !isCanonical {
+		// the mirror may have a port, so that the tag can no longer be omitted
+		rewritten += ":latest"
+	}
+	return rewritten
+}
+
+// ParseRegistryMirrors parses a comma-separated list of source=mirror prefixes
+// e.g. docker.io/library=registry.internal/mirror,quay.io=registry.internal/quay
+func ParseRegistryMirrors(val string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		source, mirror, ok := strings.Cut(pair, "=")
+		source, mirror = strings.TrimSuffix(strings.TrimSpace(source), "/"), strings.TrimSuffix(strings.TrimSpace(mirror), "/")
+		if !ok || source == "" || mirror == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q: must be of the form source=mirror", pair)
+		}
+		if _, err := reference.ParseNamed(mirror + "/image"); err != nil {
+			return nil, fmt.Errorf("invalid registry mirror %q: %v", mirror, err)
+		}
+		mirrors[source] = mirror
+	}
+	return mirrors, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRewriteImageRef(t *testing.T) {
+	mirrors := map[string]string{
+		"docker.io/library":   "registry.internal/mirror",
+		"docker.io/bitnami":   "registry.internal:5000/bitnami/",
+		"quay.io":             "registry.internal/quay",
+		"quay.io/prometheus/": "registry.internal/prometheus",
+	}
+	tests := []struct {
+		name          string
+		image         string
+		expectedImage string
+	}{
+		{
+			name:          "#1: Fully-qualified reference",
+			image:         "docker.io/library/nginx:1.25",
+			expectedImage: "registry.internal/mirror/nginx:1.25",
+		},
+		{
+			name:          "#2: Short reference",
+			image:         "nginx:1.25",
+			expectedImage: "registry.internal/mirror/nginx:1.25",
+		},
+		{
+			name:          "#3: Reference without tag is given the latest tag",
+			image:         "bitnami/redis",
+			expectedImage: "registry.internal:5000/bitnami/redis:latest",
+		},
+		{
+			name:          "#4: Digest is preserved",
+			image:         "nginx@" + testDigest,
+			expectedImage: "registry.internal/mirror/nginx@" + testDigest,
+		},
+		{
+			name:          "#5: Tag and digest are preserved",
+			image:         "quay.io/coreos/etcd:v3.5.0@" + testDigest,
+			expectedImage: "registry.internal/quay/coreos/etcd:v3.5.0@" + testDigest,
+		},
+		{
+			name:          "#6: Longest source prefix wins",
+			image:         "quay.io/prometheus/node-exporter:v1.6.0",
+			expectedImage: "registry.internal/prometheus/node-exporter:v1.6.0",
+		},
+		{
+			name:          "#7: Source prefix matches whole path components only",
+			image:         "docker.io/bitnamilabs/redis:7.0",
+			expectedImage: "docker.io/bitnamilabs/redis:7.0",
+		},
+		{
+			name:          "#8: Image without mirror is unchanged",
+			image:         "gcr.io/google-containers/pause:3.2",
+			expectedImage: "gcr.io/google-containers/pause:3.2",
+		},
+		{
+			name:          "#9: Invalid reference is unchanged",
+			image:         "NGINX:1.25",
+			expectedImage: "NGINX:1.25",
+		},
+	}
+	for _, test := range tests {
+		if image := RewriteImageRef(test.image, mirrors); image != test.expectedImage {
+			t.Errorf("Test: %s failed: expectedImage=%s, actualImage=%s", test.name, test.expectedImage, image)
+		}
+	}
+	if image := RewriteImageRef("nginx", nil); image != "nginx" {
+		t.Errorf("Test: no registry mirrors failed: expectedImage=nginx, actualImage=%s", image)
+	}
+}
+
+func TestParseRegistryMirrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		val             string
+		expectedMirrors map[string]string
+		expectErr       bool
+	}{
+		{
+			name:            "#1: Empty",
+			val:             "",
+			expectedMirrors: map[string]string{},
+		},
+		{
+			name: "#2: Several mirrors",
+			val:  "docker.io/library=registry.internal/mirror/, quay.io=registry.internal:5000/quay",
+			expectedMirrors: map[string]string{
+				"docker.io/library": "registry.internal/mirror",
+				"quay.io":           "registry.internal:5000/quay",
+			},
+		},
+		{
+			name:      "#3: Missing mirror",
+			val:       "docker.io/library",
+			expectErr: true,
+		},
+		{
+			name:      "#4: Invalid mirror",
+			val:       "docker.io/library=registry.internal/Mirror",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		mirrors, err := ParseRegistryMirrors(test.val)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if !test.expectErr && !reflect.DeepEqual(mirrors, test.expectedMirrors) {
+			t.Errorf("Test: %s failed: expectedMirrors=%v, actualMirrors=%v", test.name, test.expectedMirrors, mirrors)
+		}
+	}
+}
+
+func TestRegistryMirrorJobs(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	jobOptions := JobOptions{RegistryMirrors: map[string]string{"docker.io/library": "registry.internal/mirror"}}
+	mirrorImage := "registry.internal/mirror/nginx@" + testDigest
+
+	pullJob, err := newImagePullJob(imagecache, "nginx@"+testDigest, false, nil, nil, &node, "IfNotPresent",
+		"", "busybox:1.35.0", "", "", jobOptions)
+	if err != nil {
+		t.Fatalf("Test: pull job failed: expectedError=nil, actualError=%v", err)
+	}
+	if image := pullJob.Spec.Template.Spec.Containers[0].Image; image != mirrorImage {
+		t.Errorf("Test: pull job failed: expectedImage=%s, actualImage=%s", mirrorImage, image)
+	}
+
+	deleteJob, err := newImageDeleteJob(imagecache, "nginx@"+testDigest, nil, &node, "containerd://1.6.8", "cri-client:latest",
+		"", "", "", jobOptions)
+	if err != nil {
+		t.Fatalf("Test: delete job failed: expectedError=nil, actualError=%v", err)
+	}
+	if command := strings.Join(deleteJob.Spec.Template.Spec.Containers[0].Command, " "); !strings.Contains(command, mirrorImage) {
+		t.Errorf("Test: delete job failed: expectedImage=%s, actualCommand=%s", mirrorImage, command)
+	}
+}
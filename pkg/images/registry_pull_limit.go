@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+const (
+	// RegistryPullLimitsDefaultKey is the key of the registry pull limits ConfigMap with the maximum number
+	// of pull jobs active at once for the images of any registry without a limit of its own
+	RegistryPullLimitsDefaultKey = "default"
+	// RegistryPullLimitsRegistriesKey is the key of the registry pull limits ConfigMap with the comma-separated
+	// limits of given registries, each of the form registry=limit e.g. docker.io=2,registry.internal:5000=20
+	RegistryPullLimitsRegistriesKey = "registries"
+)
+
+// RegistryPullLimits are the maximum numbers of pull jobs active at once for the images of a registry.
+// Zero means no limit.
+type RegistryPullLimits struct {
+	// Default is the limit of the registries not in Registries
+	Default int
+	// Registries maps registry hosts e.g. docker.io to their limit
+	Registries map[string]int
+}
+
+// ParseRegistryPullLimits parses the data of the registry pull limits ConfigMap
+func ParseRegistryPullLimits(data map[string]string) (RegistryPullLimits, error) {
+	limits := RegistryPullLimits{Registries: map[string]int{}}
+	if val := strings.TrimSpace(data[RegistryPullLimitsDefaultKey]); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 0 {
+			return RegistryPullLimits{}, fmt.Errorf("invalid default registry pull limit %q: must be a non-negative integer", val)
+		}
+		limits.Default = limit
+	}
+	for _, pair := range strings.Split(data[RegistryPullLimitsRegistriesKey], ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		registry, val, ok := strings.Cut(pair, "=")
+		registry, val = strings.TrimSpace(registry), strings.TrimSpace(val)
+		if !ok || registry == "" {
+			return RegistryPullLimits{}, fmt.Errorf("invalid registry pull limit %q: must be of the form registry=limit", pair)
+		}
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 0 {
+			return RegistryPullLimits{}, fmt.Errorf("invalid registry pull limit %q: must be a non-negative integer", pair)
+		}
+		limits.Registries[registry] = limit
+	}
+	return limits, nil
+}
+
+// SetRegistryPullLimits replaces the per-registry limits of the pull jobs, and creates the queued pull
+// jobs the new limits allow
+func (m *ImageManager) SetRegistryPullLimits(limits RegistryPullLimits) {
+	m.registryPullLimitsLock.Lock()
+	m.registryPullLimits = limits
+	m.registryPullLimitsLock.Unlock()
+	m.dispatchPullJobs()
+}
+
+// registryPullLimited reports whether the pull jobs of any registry are limited
+func (m *ImageManager) registryPullLimited() bool {
+	m.registryPullLimitsLock.RLock()
+	defer m.registryPullLimitsLock.RUnlock()
+	if m.registryPullLimits.Default > 0 {
+		return true
+	}
+	for _, limit := range m.registryPullLimits.Registries {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// registryPullLimit returns the maximum number of pull jobs active at once for the images of the registry
+func (m *ImageManager) registryPullLimit(registry string) int {
+	m.registryPullLimitsLock.RLock()
+	defer m.registryPullLimitsLock.RUnlock()
+	if limit, ok := m.registryPullLimits.Registries[registry]; ok {
+		return limit
+	}
+	return m.registryPullLimits.Default
+}
+
+// pullRegistry returns the host of the registry from which the image of the request is pulled, after
+// its rewrite to its registry mirror if any. Images that do not parse are accounted to no registry.
+func (m *ImageManager) pullRegistry(iwr ImageWorkRequest) string {
+	named, err := reference.ParseNormalizedNamed(RewriteImageRef(iwr.Image, m.jobOptions.RegistryMirrors))
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
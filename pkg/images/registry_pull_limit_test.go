@@ -0,0 +1,199 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseRegistryPullLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           map[string]string
+		expectedLimits RegistryPullLimits
+		expectErr      bool
+	}{
+		{
+			name:           "#1: Empty configmap",
+			data:           nil,
+			expectedLimits: RegistryPullLimits{Registries: map[string]int{}},
+		},
+		{
+			name: "#2: Default and per-registry limits",
+			data: map[string]string{
+				RegistryPullLimitsDefaultKey:    "4",
+				RegistryPullLimitsRegistriesKey: " docker.io=2, registry.internal:5000=20,quay.io=0 ",
+			},
+			expectedLimits: RegistryPullLimits{Default: 4,
+				Registries: map[string]int{"docker.io": 2, "registry.internal:5000": 20, "quay.io": 0}},
+		},
+		{
+			name:      "#3: Invalid default limit",
+			data:      map[string]string{RegistryPullLimitsDefaultKey: "-1"},
+			expectErr: true,
+		},
+		{
+			name:      "#4: Registry without limit",
+			data:      map[string]string{RegistryPullLimitsRegistriesKey: "docker.io"},
+			expectErr: true,
+		},
+		{
+			name:      "#5: Invalid registry limit",
+			data:      map[string]string{RegistryPullLimitsRegistriesKey: "docker.io=two"},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		limits, err := ParseRegistryPullLimits(test.data)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if !test.expectErr && !reflect.DeepEqual(limits, test.expectedLimits) {
+			t.Errorf("Test: %s failed: expectedLimits=%+v, actualLimits=%+v", test.name, test.expectedLimits, limits)
+		}
+	}
+}
+
+func TestPullRegistry(t *testing.T) {
+	tests := []struct {
+		name             string
+		image            string
+		mirrors          map[string]string
+		expectedRegistry string
+	}{
+		{name: "#1: Docker Hub image", image: "nginx", expectedRegistry: "docker.io"},
+		{name: "#2: Registry with port", image: "registry.internal:5000/foo/bar:v1", expectedRegistry: "registry.internal:5000"},
+		{name: "#3: Image pulled from its mirror", image: "nginx", mirrors: map[string]string{"docker.io/library": "mirror.internal/library"},
+			expectedRegistry: "mirror.internal"},
+		{name: "#4: Invalid image", image: "Invalid Image", expectedRegistry: ""},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(newJobCreatingClientset(), "Always", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.RegistryMirrors = test.mirrors
+		if registry := imagemanager.pullRegistry(ImageWorkRequest{Image: test.image}); registry != test.expectedRegistry {
+			t.Errorf("Test: %s failed: expectedRegistry=%s, actualRegistry=%s", test.name, test.expectedRegistry, registry)
+		}
+	}
+}
+
+// activeRegistryJobs returns the number of active jobs of the image manager per registry
+func activeRegistryJobs(imagemanager *ImageManager) map[string]int {
+	perRegistry := map[string]int{}
+	for _, job := range activeJobs(imagemanager) {
+		perRegistry[imagemanager.pullRegistry(imagemanager.imageworkstatus[job].ImageWorkRequest)]++
+	}
+	return perRegistry
+}
+
+func TestRegistryPullLimits(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	slowRegistry, fastRegistry := "slow.example.com", "fast.internal"
+	limits := map[string]int{slowRegistry: 1, fastRegistry: 3}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.SetRegistryPullLimits(RegistryPullLimits{Registries: limits})
+
+	// The images of the slow registry are queued before those of the fast one
+	for _, registry := range []string{slowRegistry, fastRegistry} {
+		for i := 0; i < 6; i++ {
+			imagemanager.imageworkqueue.Add(ImageWorkRequest{
+				Image:      fmt.Sprintf("%s/foo:v%d", registry, i),
+				Node:       &node,
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			})
+		}
+	}
+	for i := 0; i < 12; i++ {
+		imagemanager.processNextWorkItem()
+	}
+
+	// Each registry has as many active jobs as its limit, whatever the jobs queued for the other
+	if perRegistry := activeRegistryJobs(imagemanager); !reflect.DeepEqual(perRegistry, limits) {
+		t.Errorf("Test failed: expectedActiveJobs=%v, actualActiveJobs=%v", limits, perRegistry)
+	}
+
+	// Finish the active jobs one at a time until all the images are pulled
+	for finished := 0; finished < 12; finished++ {
+		jobs := activeJobs(imagemanager)
+		if len(jobs) == 0 {
+			t.Fatalf("Test failed: no active jobs after %d of 12 jobs finished", finished)
+		}
+		for registry, n := range activeRegistryJobs(imagemanager) {
+			if n > limits[registry] {
+				t.Fatalf("Test failed: registry=%s, expectedMaxActiveJobs=%d, actualActiveJobs=%d", registry, limits[registry], n)
+			}
+		}
+		finishJob(imagemanager, jobs[0])
+	}
+	if createdJobs(fakekubeclientset) != 12 {
+		t.Errorf("Test failed: expectedCreatedJobs=12, actualCreatedJobs=%d", createdJobs(fakekubeclientset))
+	}
+}
+
+func TestSetRegistryPullLimits(t *testing.T) {
+	defaultImageCache := fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.SetRegistryPullLimits(RegistryPullLimits{Default: 1})
+
+	for i := 0; i < 4; i++ {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:      fmt.Sprintf("foo:v%d", i),
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &defaultImageCache,
+		})
+	}
+	for i := 0; i < 4; i++ {
+		imagemanager.processNextWorkItem()
+	}
+	if jobs := activeJobs(imagemanager); len(jobs) != 1 {
+		t.Errorf("Test failed: expectedActiveJobs=1, actualActiveJobs=%d", len(jobs))
+	}
+	if rounds := imagemanager.pullJobRounds(imageCacheKey(&defaultImageCache)); rounds != 4 {
+		t.Errorf("Test failed: expectedRounds=4, actualRounds=%d", rounds)
+	}
+
+	// Raising the limit of the registry creates the queued jobs it allows
+	imagemanager.SetRegistryPullLimits(RegistryPullLimits{Default: 1, Registries: map[string]int{"docker.io": 3}})
+	if jobs := activeJobs(imagemanager); len(jobs) != 3 {
+		t.Errorf("Test failed: expectedActiveJobs=3, actualActiveJobs=%d", len(jobs))
+	}
+	if rounds := imagemanager.pullJobRounds(imageCacheKey(&defaultImageCache)); rounds != 2 {
+		t.Errorf("Test failed: expectedRounds=2, actualRounds=%d", rounds)
+	}
+}
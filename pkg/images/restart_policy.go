@@ -0,0 +1,85 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ParseRestartPolicy validates the restart policy of the pods of image pull or delete jobs.
+// An empty policy means Never.
+func ParseRestartPolicy(val string) (corev1.RestartPolicy, error) {
+	switch policy := corev1.RestartPolicy(val); policy {
+	case "":
+		return corev1.RestartPolicyNever, nil
+	case corev1.RestartPolicyNever, corev1.RestartPolicyOnFailure:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported restart policy %q: supported values are %q and %q",
+		val, corev1.RestartPolicyNever, corev1.RestartPolicyOnFailure)
+}
+
+// setJobRestartPolicy sets the restart policy of the pod of the job, Never if empty
+func setJobRestartPolicy(job *batchv1.Job, policy corev1.RestartPolicy) {
+	if policy == "" {
+		policy = corev1.RestartPolicyNever
+	}
+	job.Spec.Template.Spec.RestartPolicy = policy
+}
+
+// podRestarts returns the number of times the containers of the pod were restarted
+func podRestarts(pod *corev1.Pod) int32 {
+	var restarts int32
+	for _, s := range pod.Status.InitContainerStatuses {
+		restarts += s.RestartCount
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		restarts += s.RestartCount
+	}
+	return restarts
+}
+
+// restartedInPod checks whether the failed containers of the pod are restarted within the pod,
+// rather than by the job controller creating a new pod
+func restartedInPod(pod *corev1.Pod) bool {
+	return pod.Spec.RestartPolicy == corev1.RestartPolicyOnFailure
+}
+
+// handlePodRestarts records the restarts of the containers of a pod with restartPolicy OnFailure as
+// retries of its job, which the job controller counts against the backoff limit of the job
+func (m *ImageManager) handlePodRestarts(pod *corev1.Pod) {
+	if !restartedInPod(pod) {
+		return
+	}
+	job := pod.Labels["job-name"]
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	iwres, ok := m.imageworkstatus[job]
+	if !ok || iwres.Status != ImageWorkResultStatusJobCreated {
+		return
+	}
+	if restarts := podRestarts(pod); restarts > iwres.Retries {
+		iwres.Retries = restarts
+		m.imageworkstatus[job] = iwres
+		klog.Infof("Job %s attempt %d of %d failed, restarted in pod %s (%s --> %s)", job, restarts,
+			m.jobOptions.JobBackoffLimit+1, pod.Name, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		val            string
+		expectedPolicy corev1.RestartPolicy
+		expectError    bool
+	}{
+		{name: "#1: Empty restart policy", val: "", expectedPolicy: corev1.RestartPolicyNever},
+		{name: "#2: Never", val: "Never", expectedPolicy: corev1.RestartPolicyNever},
+		{name: "#3: OnFailure", val: "OnFailure", expectedPolicy: corev1.RestartPolicyOnFailure},
+		{name: "#4: Always is not supported by jobs", val: "Always", expectError: true},
+	}
+	for _, test := range tests {
+		policy, err := ParseRestartPolicy(test.val)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=true, actualError=nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if policy != test.expectedPolicy {
+			t.Errorf("Test: %s failed: expectedPolicy=%s, actualPolicy=%s", test.name, test.expectedPolicy, policy)
+		}
+	}
+}
+
+func TestJobRestartPolicy(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name                 string
+		jobOptions           JobOptions
+		cachePaths           []string
+		expectedPullPolicy   corev1.RestartPolicy
+		expectedDeletePolicy corev1.RestartPolicy
+	}{
+		{
+			name:                 "#1: Pods never restarted by default",
+			expectedPullPolicy:   corev1.RestartPolicyNever,
+			expectedDeletePolicy: corev1.RestartPolicyNever,
+		},
+		{
+			name:                 "#2: Pods of pull jobs reading cache paths restarted on failure",
+			jobOptions:           JobOptions{PullJobRestartPolicy: corev1.RestartPolicyOnFailure},
+			cachePaths:           []string{"/opt/conda/lib/"},
+			expectedPullPolicy:   corev1.RestartPolicyOnFailure,
+			expectedDeletePolicy: corev1.RestartPolicyNever,
+		},
+		{
+			name:                 "#3: Pods of delete jobs restarted on failure",
+			jobOptions:           JobOptions{DeleteJobRestartPolicy: corev1.RestartPolicyOnFailure},
+			expectedPullPolicy:   corev1.RestartPolicyNever,
+			expectedDeletePolicy: corev1.RestartPolicyOnFailure,
+		},
+	}
+	for _, test := range tests {
+		pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, test.cachePaths, nil, &node, "IfNotPresent",
+			"", "busybox:1.35.0", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+			"", "", "", test.jobOptions)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if policy := pullJob.Spec.Template.Spec.RestartPolicy; policy != test.expectedPullPolicy {
+			t.Errorf("Test: %s failed: expectedPullPolicy=%s, actualPullPolicy=%s", test.name, test.expectedPullPolicy, policy)
+		}
+		if policy := deleteJob.Spec.Template.Spec.RestartPolicy; policy != test.expectedDeletePolicy {
+			t.Errorf("Test: %s failed: expectedDeletePolicy=%s, actualDeletePolicy=%s", test.name, test.expectedDeletePolicy, policy)
+		}
+	}
+}
+
+// onFailurePod returns a pod of job fakejob with restartPolicy OnFailure, whose container was restarted
+// the given times and is in the given state
+func onFailurePod(phase corev1.PodPhase, restarts int32, state corev1.ContainerState) *corev1.Pod {
+	status := corev1.ContainerStatus{Name: "imagepuller", RestartCount: restarts, State: state}
+	if restarts > 0 {
+		status.LastTerminationState = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "cat: read error: I/O error"},
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "fakejob-abcde",
+			Namespace:       fledgedNameSpace,
+			ResourceVersion: "2",
+			Labels:          map[string]string{"job-name": "fakejob"},
+		},
+		Spec: corev1.PodSpec{RestartPolicy: corev1.RestartPolicyOnFailure},
+		Status: corev1.PodStatus{
+			Phase:             phase,
+			ContainerStatuses: []corev1.ContainerStatus{status},
+		},
+	}
+}
+
+func TestHandlePodStatusChangeOnFailure(t *testing.T) {
+	imageCache := &fledgedv1alpha3.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"}}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	crashLoop := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	succeeded := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}
+	tests := []struct {
+		name            string
+		pods            []*corev1.Pod
+		job             *batchv1.Job
+		expectedStatus  string
+		expectedRetries int32
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Succeeded without restarts",
+			pods:           []*corev1.Pod{onFailurePod(corev1.PodSucceeded, 0, succeeded)},
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name: "#2: Restarts in the pod recorded as retries",
+			pods: []*corev1.Pod{
+				onFailurePod(corev1.PodRunning, 1, running),
+				onFailurePod(corev1.PodRunning, 2, crashLoop),
+			},
+			expectedStatus:  ImageWorkResultStatusJobCreated,
+			expectedRetries: 2,
+		},
+		{
+			name: "#3: Succeeded after restarts in the pod",
+			pods: []*corev1.Pod{
+				onFailurePod(corev1.PodRunning, 1, running),
+				onFailurePod(corev1.PodSucceeded, 1, succeeded),
+			},
+			expectedStatus:  ImageWorkResultStatusSucceededAfterRetries,
+			expectedRetries: 1,
+		},
+		{
+			name:            "#4: Failed pod waits for the result of the job",
+			pods:            []*corev1.Pod{onFailurePod(corev1.PodFailed, 2, crashLoop)},
+			expectedStatus:  ImageWorkResultStatusJobCreated,
+			expectedRetries: 2,
+		},
+		{
+			name:            "#5: Failed job reports the last failed run of the container",
+			pods:            []*corev1.Pod{onFailurePod(corev1.PodFailed, 2, crashLoop)},
+			job:             finishedJob(imageCache, "fakejob", batchv1.JobFailed, "BackoffLimitExceeded", "Job has reached the specified backoff limit"),
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedRetries: 2,
+			expectedReason:  "Error",
+			expectedMessage: "cat: read error: I/O error",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(fakeclientset.NewSimpleClientset(), "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.jobOptions.JobBackoffLimit = 2
+		imagemanager.jobOptions.PullJobRestartPolicy = corev1.RestartPolicyOnFailure
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				Image:      "foo:v1",
+				WorkType:   ImageCacheCreate,
+				Node:       &node,
+				Imagecache: imageCache,
+			},
+		}
+		for _, pod := range test.pods {
+			podInformer.Informer().GetIndexer().Update(pod)
+			if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				imagemanager.handlePodStatusChange(pod)
+			} else {
+				imagemanager.handlePodRestarts(pod)
+			}
+		}
+		if test.job != nil {
+			imagemanager.handleJobStatusChange(test.job)
+		}
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, iwres.Status)
+		}
+		if iwres.Retries != test.expectedRetries {
+			t.Errorf("Test: %s failed: expectedRetries=%d, actualRetries=%d", test.name, test.expectedRetries, iwres.Retries)
+		}
+		if iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedReason=%s, expectedMessage=%s, actualReason=%s, actualMessage=%s",
+				test.name, test.expectedReason, test.expectedMessage, iwres.Reason, iwres.Message)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nobodyUser is the user that runs the containers of image pull jobs
+const nobodyUser int64 = 65534
+
+// pullJobPodSecurityContext runs the containers of image pull jobs as an unprivileged user. The pulled
+// image is only run to echo a message (or read its files), which needs no particular user.
+func pullJobPodSecurityContext() *corev1.PodSecurityContext {
+	runAsNonRoot := true
+	runAsUser := nobodyUser
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: &runAsNonRoot,
+		RunAsUser:    &runAsUser,
+		RunAsGroup:   &runAsUser,
+	}
+}
+
+// deleteJobPodSecurityContext runs the containers of image delete jobs as root, the owner of the
+// runtime socket of the node. Root needs no capability to connect to a socket it owns.
+func deleteJobPodSecurityContext() *corev1.PodSecurityContext {
+	runAsNonRoot := false
+	runAsUser := int64(0)
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: &runAsNonRoot,
+		RunAsUser:    &runAsUser,
+	}
+}
+
+// jobSecurityContext is the security context of the containers of image pull/delete jobs: a
+// read-only root filesystem, no capabilities and no privilege escalation
+func jobSecurityContext() *corev1.SecurityContext {
+	readOnlyRootFilesystem := true
+	allowPrivilegeEscalation := false
+	return &corev1.SecurityContext{
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+// setJobSecurityContext sets the pod security context of a job and the security context of all its
+// containers. The per-imagecache overrides take precedence over the restrictive defaults. The pods
+// run with the RuntimeDefault seccomp profile required by the restricted pod security standard,
+// unless the seccomp profile or the pod security context of the image cache sets another profile.
+func setJobSecurityContext(job *batchv1.Job, podOverride *corev1.PodSecurityContext, override *corev1.SecurityContext,
+	seccompProfile *corev1.SeccompProfile, podSecurityContext *corev1.PodSecurityContext) {
+	if podOverride != nil {
+		podSecurityContext = podOverride.DeepCopy()
+	}
+	if seccompProfile != nil {
+		podSecurityContext.SeccompProfile = seccompProfile.DeepCopy()
+	} else if podSecurityContext.SeccompProfile == nil {
+		podSecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+	securityContext := jobSecurityContext()
+	if override != nil {
+		securityContext = override
+	}
+	podSpec := &job.Spec.Template.Spec
+	podSpec.SecurityContext = podSecurityContext
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].SecurityContext = securityContext.DeepCopy()
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = securityContext.DeepCopy()
+	}
+}
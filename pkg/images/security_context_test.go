@@ -0,0 +1,219 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJobSeccompProfile(t *testing.T) {
+	localhostProfile := "profiles/kubefledged.json"
+	tests := []struct {
+		name                     string
+		deleteJob                bool
+		podOverride              *corev1.PodSecurityContext
+		seccompProfile           *corev1.SeccompProfile
+		expectedType             corev1.SeccompProfileType
+		expectedLocalhostProfile string
+	}{
+		{
+			name:         "#1: Pull job runs with the RuntimeDefault profile",
+			expectedType: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+		{
+			name:         "#2: Delete job runs with the RuntimeDefault profile",
+			deleteJob:    true,
+			expectedType: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+		{
+			name:         "#3: Pod security context override without a profile keeps RuntimeDefault",
+			podOverride:  &corev1.PodSecurityContext{},
+			expectedType: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+		{
+			name:                     "#4: Localhost profile of the image cache",
+			deleteJob:                true,
+			seccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &localhostProfile},
+			expectedType:             corev1.SeccompProfileTypeLocalhost,
+			expectedLocalhostProfile: localhostProfile,
+		},
+		{
+			name:           "#5: Seccomp profile takes precedence over the pod security context override",
+			podOverride:    &corev1.PodSecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}},
+			seccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			expectedType:   corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				JobPodSecurityContext: test.podOverride,
+				JobSeccompProfile:     test.seccompProfile,
+			},
+		}
+		var job *batchv1.Job
+		var err error
+		if test.deleteJob {
+			job, err = newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", JobOptions{})
+		} else {
+			job, err = newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", JobOptions{})
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSecurityContext := job.Spec.Template.Spec.SecurityContext
+		if podSecurityContext == nil || podSecurityContext.SeccompProfile == nil {
+			t.Errorf("Test: %s failed: expectedSeccompProfile=%s, actualPodSecurityContext=%+v", test.name, test.expectedType, podSecurityContext)
+			continue
+		}
+		profile := podSecurityContext.SeccompProfile
+		localhost := ""
+		if profile.LocalhostProfile != nil {
+			localhost = *profile.LocalhostProfile
+		}
+		if profile.Type != test.expectedType || localhost != test.expectedLocalhostProfile {
+			t.Errorf("Test: %s failed: expectedType=%s, expectedLocalhostProfile=%s, actualType=%s, actualLocalhostProfile=%s",
+				test.name, test.expectedType, test.expectedLocalhostProfile, profile.Type, localhost)
+		}
+		if test.podOverride != nil && test.seccompProfile == nil && test.podOverride.SeccompProfile == nil && imagecache.Spec.JobPodSecurityContext.SeccompProfile != nil {
+			t.Errorf("Test: %s failed: expectedSpecSeccompProfile=nil, actualSpecSeccompProfile=%+v", test.name, imagecache.Spec.JobPodSecurityContext.SeccompProfile)
+		}
+	}
+}
+
+func TestJobSecurityContext(t *testing.T) {
+	privileged := true
+	rootUser := int64(0)
+	nobody := nobodyUser
+	windowsNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "win", corev1.LabelOSStable: "windows"},
+		},
+	}
+	tests := []struct {
+		name                   string
+		deleteJob              bool
+		node                   corev1.Node
+		podOverride            *corev1.PodSecurityContext
+		override               *corev1.SecurityContext
+		expectedRunAsUser      *int64
+		expectedRunAsNonRoot   bool
+		expectedPrivileged     bool
+		expectSecurityContexts bool
+	}{
+		{
+			name:                   "#1: Pull job runs as an unprivileged user",
+			node:                   node,
+			expectedRunAsUser:      &nobody,
+			expectedRunAsNonRoot:   true,
+			expectSecurityContexts: true,
+		},
+		{
+			name:                   "#2: Delete job runs as the owner of the runtime socket",
+			deleteJob:              true,
+			node:                   node,
+			expectedRunAsUser:      &rootUser,
+			expectSecurityContexts: true,
+		},
+		{
+			name:                   "#3: Overrides of the image cache",
+			node:                   node,
+			podOverride:            &corev1.PodSecurityContext{RunAsUser: &rootUser},
+			override:               &corev1.SecurityContext{Privileged: &privileged},
+			expectedRunAsUser:      &rootUser,
+			expectedPrivileged:     true,
+			expectSecurityContexts: true,
+		},
+		{
+			name: "#4: Pull job on a Windows node has no Linux security context",
+			node: windowsNode,
+		},
+	}
+	for _, test := range tests {
+		imagecache := &fledgedv1alpha3.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: fledgedv1alpha3.ImageCacheSpec{
+				JobPodSecurityContext: test.podOverride,
+				JobSecurityContext:    test.override,
+			},
+		}
+		var job *batchv1.Job
+		var err error
+		if test.deleteJob {
+			job, err = newImageDeleteJob(imagecache, "nginx:1.25", nil, &test.node, "containerd://1.6.8", "cri-client:latest",
+				"", "", "", JobOptions{})
+		} else {
+			job, err = newImagePullJob(imagecache, "nginx:1.25", false, nil, nil, &test.node, "IfNotPresent",
+				"", "busybox:1.35.0", "", "", JobOptions{})
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if !test.expectSecurityContexts {
+			if podSpec.SecurityContext != nil || podSpec.Containers[0].SecurityContext != nil {
+				t.Errorf("Test: %s failed: expectedSecurityContext=nil, actualPodSecurityContext=%+v, actualSecurityContext=%+v",
+					test.name, podSpec.SecurityContext, podSpec.Containers[0].SecurityContext)
+			}
+			continue
+		}
+		podSecurityContext := podSpec.SecurityContext
+		if podSecurityContext == nil || podSecurityContext.RunAsUser == nil || *podSecurityContext.RunAsUser != *test.expectedRunAsUser {
+			t.Errorf("Test: %s failed: expectedRunAsUser=%d, actualPodSecurityContext=%+v", test.name, *test.expectedRunAsUser, podSecurityContext)
+			continue
+		}
+		if runAsNonRoot := podSecurityContext.RunAsNonRoot != nil && *podSecurityContext.RunAsNonRoot; runAsNonRoot != test.expectedRunAsNonRoot {
+			t.Errorf("Test: %s failed: expectedRunAsNonRoot=%t, actualRunAsNonRoot=%t", test.name, test.expectedRunAsNonRoot, runAsNonRoot)
+		}
+		containers := append(podSpec.InitContainers, podSpec.Containers...)
+		for _, container := range containers {
+			securityContext := container.SecurityContext
+			if securityContext == nil {
+				t.Errorf("Test: %s failed: expectedSecurityContext, actualSecurityContext=nil (container %s)", test.name, container.Name)
+				continue
+			}
+			if test.expectedPrivileged {
+				if securityContext.Privileged == nil || !*securityContext.Privileged {
+					t.Errorf("Test: %s failed: expectedPrivileged=true, actualSecurityContext=%+v (container %s)", test.name, securityContext, container.Name)
+				}
+				continue
+			}
+			if securityContext.ReadOnlyRootFilesystem == nil || !*securityContext.ReadOnlyRootFilesystem ||
+				securityContext.AllowPrivilegeEscalation == nil || *securityContext.AllowPrivilegeEscalation ||
+				securityContext.Capabilities == nil || len(securityContext.Capabilities.Drop) != 1 || securityContext.Capabilities.Drop[0] != "ALL" {
+				t.Errorf("Test: %s failed: expectedReadOnlyRootFilesystem=true, expectedAllowPrivilegeEscalation=false, expectedDrop=[ALL], actualSecurityContext=%+v (container %s)",
+					test.name, securityContext, container.Name)
+			}
+		}
+	}
+}
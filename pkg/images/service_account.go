@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// defaultServiceAccountName is the service account of the pods of the jobs when none is set
+const defaultServiceAccountName = "default"
+
+// inheritServiceAccountImagePullSecrets adds the image pull secrets of the service account of the pod of the job
+// after its own. The ServiceAccount admission plugin gives a pod the image pull secrets of its service account
+// only if the pod has none, so the pull secrets of an image cache would shadow the registry credentials attached
+// to the service account, e.g. those of the registry of the busybox or cri client image. A job without image pull
+// secrets is left as is, for the admission plugin to add them. A service account the controller cannot get
+// adds no secrets.
+func (m *ImageManager) inheritServiceAccountImagePullSecrets(namespace string, job *batchv1.Job) {
+	podSpec := &job.Spec.Template.Spec
+	if len(podSpec.ImagePullSecrets) == 0 {
+		return
+	}
+	name := podSpec.ServiceAccountName
+	if name == "" {
+		name = defaultServiceAccountName
+	}
+	sa, err := m.kubeclientset.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		klog.V(4).Infof("Unable to get image pull secrets of service account %s/%s: %v", namespace, name, err)
+		return
+	} else if err != nil {
+		klog.Warningf("Error getting image pull secrets of service account %s/%s: %v", namespace, name, err)
+		return
+	}
+	podSpec.ImagePullSecrets = MergeImagePullSecrets(podSpec.ImagePullSecrets, sa.ImagePullSecrets)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestInheritServiceAccountImagePullSecrets(t *testing.T) {
+	serviceAccounts := []corev1.ServiceAccount{
+		{
+			ObjectMeta:       metav1.ObjectMeta{Name: "sa-kube-fledged", Namespace: fledgedNameSpace},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-registry"}, {Name: "cache-registry"}},
+		},
+		{
+			ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: fledgedNameSpace},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "default-registry"}},
+		},
+	}
+	tests := []struct {
+		name                     string
+		serviceAccountName       string
+		imagePullSecrets         []corev1.LocalObjectReference
+		expectedImagePullSecrets []corev1.LocalObjectReference
+	}{
+		{
+			name:               "#1: Job without image pull secrets left for the admission plugin",
+			serviceAccountName: "sa-kube-fledged",
+		},
+		{
+			name:                     "#2: Secrets of the service account added after those of the image cache",
+			serviceAccountName:       "sa-kube-fledged",
+			imagePullSecrets:         []corev1.LocalObjectReference{{Name: "cache-registry"}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "cache-registry"}, {Name: "sa-registry"}},
+		},
+		{
+			name:                     "#3: Secrets of the default service account",
+			imagePullSecrets:         []corev1.LocalObjectReference{{Name: "cache-registry"}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "cache-registry"}, {Name: "default-registry"}},
+		},
+		{
+			name:                     "#4: Service account not found",
+			serviceAccountName:       "sa-missing",
+			imagePullSecrets:         []corev1.LocalObjectReference{{Name: "cache-registry"}},
+			expectedImagePullSecrets: []corev1.LocalObjectReference{{Name: "cache-registry"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset(&serviceAccounts[0], &serviceAccounts[1])
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", test.serviceAccountName,
+			"priority-class-kube-fledged", false, "")
+		job := &batchv1.Job{}
+		job.Spec.Template.Spec.ServiceAccountName = test.serviceAccountName
+		job.Spec.Template.Spec.ImagePullSecrets = test.imagePullSecrets
+		imagemanager.inheritServiceAccountImagePullSecrets(fledgedNameSpace, job)
+		if actual := job.Spec.Template.Spec.ImagePullSecrets; !reflect.DeepEqual(actual, test.expectedImagePullSecrets) {
+			t.Errorf("Test: %s failed: expectedImagePullSecrets=%v, actualImagePullSecrets=%v", test.name, test.expectedImagePullSecrets, actual)
+		}
+	}
+}
+
+func TestPullJobServiceAccountImagePullSecrets(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "cache-registry"}},
+		},
+	}
+	fakekubeclientset := newJobCreatingClientset()
+	fakekubeclientset.AddReactor("get", "serviceaccounts", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, &corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Name: "sa-kube-fledged", Namespace: fledgedNameSpace},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-registry"}},
+		}, nil
+	})
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", false, "")
+	imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: "nginx:1.25", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache})
+	imagemanager.processNextWorkItem()
+
+	expected := []corev1.LocalObjectReference{{Name: "cache-registry"}, {Name: "sa-registry"}}
+	created := 0
+	for _, action := range fakekubeclientset.Actions() {
+		if !action.Matches("create", "jobs") {
+			continue
+		}
+		created++
+		job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+		if actual := job.Spec.Template.Spec.ImagePullSecrets; !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Test: #1: Pull job inherits the secrets of its service account failed: expectedImagePullSecrets=%v, actualImagePullSecrets=%v",
+				expected, actual)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Test: #1: Pull job inherits the secrets of its service account failed: expectedJobsCreated=1, actualJobsCreated=%d", created)
+	}
+}
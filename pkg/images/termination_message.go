@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// setTerminationMessagePolicy makes the containers of a job that fail report the tail of their
+// log as termination message, unless they wrote one to /dev/termination-log
+func setTerminationMessagePolicy(job *batchv1.Job) {
+	podSpec := &job.Spec.Template.Spec
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	}
+}
+
+// podFailure returns the reason and termination message of the container that made the pod fail:
+// the first init container or container that terminated with a non-zero exit code, else the first
+// one that terminated. A container waiting to be restarted in its pod reports its last failed run.
+// ok is false if no container of the pod terminated.
+func podFailure(pod *corev1.Pod) (reason, message string, ok bool) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	var terminated *corev1.ContainerStateTerminated
+	for _, s := range statuses {
+		state := s.State.Terminated
+		// a container restarted in its pod (restartPolicy OnFailure) reports the failure of its last run
+		if state == nil && s.LastTerminationState.Terminated != nil && s.LastTerminationState.Terminated.ExitCode != 0 {
+			state = s.LastTerminationState.Terminated
+		}
+		if state == nil {
+			continue
+		}
+		if state.ExitCode != 0 {
+			terminated = state
+			break
+		}
+		if terminated == nil {
+			terminated = state
+		}
+	}
+	if terminated == nil {
+		return "", "", false
+	}
+	return terminated.Reason, strings.TrimSpace(terminated.Message), true
+}
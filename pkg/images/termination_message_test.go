@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func terminated(exitCode int32, reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason, Message: message},
+		},
+	}
+}
+
+func TestHandlePodStatusChangeTerminationMessage(t *testing.T) {
+	tests := []struct {
+		name            string
+		worktype        WorkType
+		status          corev1.PodStatus
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:     "#1: Create - Termination message of the failed container",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					terminated(1, "Error", "failed to pull image \"foo:v1\": pull access denied\n"),
+				},
+			},
+			expectedReason:  "Error",
+			expectedMessage: "failed to pull image \"foo:v1\": pull access denied",
+		},
+		{
+			name:     "#2: Create - Failed init container takes precedence",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				InitContainerStatuses: []corev1.ContainerStatus{
+					terminated(1, "Error", "cp: can't create '/tmp/bin/sleep': Read-only file system"),
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+				},
+			},
+			expectedReason:  "Error",
+			expectedMessage: "cp: can't create '/tmp/bin/sleep': Read-only file system",
+		},
+		{
+			name:     "#3: Purge - Container exiting with a non-zero code",
+			worktype: ImageCachePurge,
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					terminated(0, "Completed", ""),
+					terminated(1, "Error", "rpc error: code = NotFound desc = no such image"),
+				},
+			},
+			expectedReason:  "Error",
+			expectedMessage: "rpc error: code = NotFound desc = no such image",
+		},
+		{
+			name:     "#4: Create - No container terminated",
+			worktype: ImageCacheCreate,
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+				},
+			},
+			expectedReason:  fledgedv1alpha3.ImageCacheReasonImagePullStatusUnknown,
+			expectedMessage: fledgedv1alpha3.ImageCacheMessageImagePullStatusUnknown,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent", "sa-kube-fledged",
+			"priority-class-kube-fledged", false, "")
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				WorkType: test.worktype,
+				Node:     &node,
+			},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job-name": "fakejob"}},
+			Status:     test.status,
+		}
+		imagemanager.handlePodStatusChange(pod)
+
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedStatus=%s, expectedReason=%s, expectedMessage=%s, actualStatus=%s, actualReason=%s, actualMessage=%s",
+				test.name, ImageWorkResultStatusFailed, test.expectedReason, test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message)
+		}
+	}
+}
+
+func TestJobTerminationMessagePolicy(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	pullJob, err := newImagePullJob(imagecache, "nginx:1.25", false, []string{"/var/cache/nginx"}, nil, &node, "IfNotPresent",
+		"", "busybox:1.35.0", "", "", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: pull job failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	deleteJob, err := newImageDeleteJob(imagecache, "nginx:1.25", nil, &node, "containerd://1.6.8", "cri-client:latest",
+		"", "", "", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: delete job failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	for name, job := range map[string]*batchv1.Job{"pull job": pullJob, "delete job": deleteJob} {
+		podSpec := job.Spec.Template.Spec
+		containers := append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+		for _, c := range containers {
+			if c.TerminationMessagePolicy != corev1.TerminationMessageFallbackToLogsOnError {
+				t.Errorf("Test: %s failed: container=%s, expectedTerminationMessagePolicy=%s, actualTerminationMessagePolicy=%s",
+					name, c.Name, corev1.TerminationMessageFallbackToLogsOnError, c.TerminationMessagePolicy)
+			}
+		}
+	}
+}
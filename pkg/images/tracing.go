@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer recording the spans of the reconciles of image caches and of their jobs
+const TracerName = "github.com/lcouds/kube-fledged"
+
+const (
+	// reconcileSpanName is the name of the span of a reconcile of an image cache, from its sync until its
+	// status reflects the results of its jobs
+	reconcileSpanName = "ImageCache reconcile"
+	// jobSpanName is the name of the span of an image job, from its creation until its result is recorded
+	jobSpanName = "ImageCache job"
+)
+
+// Attributes of the spans
+const (
+	imageCacheAttributeKey = attribute.Key("kubefledged.imagecache")
+	workTypeAttributeKey   = attribute.Key("kubefledged.work_type")
+	statusAttributeKey     = attribute.Key("kubefledged.status")
+	imageAttributeKey      = attribute.Key("kubefledged.image")
+	nodeAttributeKey       = attribute.Key("kubefledged.node")
+	jobAttributeKey        = attribute.Key("kubefledged.job")
+	actionAttributeKey     = attribute.Key("kubefledged.action")
+	reasonAttributeKey     = attribute.Key("kubefledged.reason")
+)
+
+// jobSpan is the span of an active job, with the key of its image cache
+type jobSpan struct {
+	span       trace.Span
+	imageCache string
+}
+
+// tracer returns the tracer of kube-fledged from the global tracer provider, which records nothing
+// unless tracing is set up
+func tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// StartReconcileSpan starts the span of a reconcile of the image cache with the given key. The spans of the
+// jobs of the reconcile are its children. An open span of a previous reconcile of the image cache is ended.
+func (m *ImageManager) StartReconcileSpan(objKey string, workType WorkType) {
+	_, span := tracer().Start(context.Background(), reconcileSpanName, trace.WithAttributes(
+		imageCacheAttributeKey.String(objKey), workTypeAttributeKey.String(string(workType))))
+	m.spanLock.Lock()
+	defer m.spanLock.Unlock()
+	if previous, ok := m.reconcileSpans[objKey]; ok {
+		previous.SetAttributes(statusAttributeKey.String("Superseded"))
+		previous.End()
+	}
+	m.reconcileSpans[objKey] = span
+}
+
+// EndReconcileSpan ends the span of the reconcile of the image cache with the given key, if any, with the
+// status of the image cache or the error that ended the reconcile
+func (m *ImageManager) EndReconcileSpan(objKey string, status string, err error) {
+	m.spanLock.Lock()
+	span, ok := m.reconcileSpans[objKey]
+	delete(m.reconcileSpans, objKey)
+	m.spanLock.Unlock()
+	if !ok {
+		return
+	}
+	if status != "" {
+		span.SetAttributes(statusAttributeKey.String(status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startJobSpan starts the span of the job created for the request, as a child of the span of the
+// reconcile of its image cache
+func (m *ImageManager) startJobSpan(iwr ImageWorkRequest, job string, action string) {
+	objKey, _ := ImageCacheKey(iwr.Imagecache)
+	var node string
+	if iwr.Node != nil {
+		node = iwr.Node.Labels["kubernetes.io/hostname"]
+	}
+	m.spanLock.Lock()
+	defer m.spanLock.Unlock()
+	ctx := context.Background()
+	if parent, ok := m.reconcileSpans[objKey]; ok {
+		ctx = trace.ContextWithSpan(ctx, parent)
+	}
+	_, span := tracer().Start(ctx, jobSpanName, trace.WithAttributes(imageCacheAttributeKey.String(objKey),
+		imageAttributeKey.String(iwr.Image), nodeAttributeKey.String(node), jobAttributeKey.String(job),
+		actionAttributeKey.String(action)))
+	m.jobSpans[job] = jobSpan{span: span, imageCache: objKey}
+}
+
+// endJobSpan ends the span of the job with the result of its request, unless the job is still active,
+// e.g. retrying a failed pod
+func (m *ImageManager) endJobSpan(job string, iwres ImageWorkResult) {
+	m.lock.RLock()
+	current, ok := m.imageworkstatus[job]
+	m.lock.RUnlock()
+	if ok {
+		if current.Status == ImageWorkResultStatusJobCreated {
+			return
+		}
+		iwres = current
+	}
+	m.spanLock.Lock()
+	s, ok := m.jobSpans[job]
+	delete(m.jobSpans, job)
+	m.spanLock.Unlock()
+	if ok {
+		finishJobSpan(s.span, iwres)
+	}
+}
+
+// endImageCacheJobSpans ends the spans of the jobs of the image cache still open once its results are
+// collected, e.g. of jobs replaced by a retry or timed out
+func (m *ImageManager) endImageCacheJobSpans(objKey string, results map[string]ImageWorkResult) {
+	m.spanLock.Lock()
+	defer m.spanLock.Unlock()
+	for job, s := range m.jobSpans {
+		if s.imageCache != objKey {
+			continue
+		}
+		iwres, ok := results[job]
+		if !ok {
+			iwres = ImageWorkResult{Status: ImageWorkResultStatusUnknown}
+		}
+		finishJobSpan(s.span, iwres)
+		delete(m.jobSpans, job)
+	}
+}
+
+// finishJobSpan ends the span of a job with the status and reason of the result of its request
+func finishJobSpan(span trace.Span, iwres ImageWorkResult) {
+	span.SetAttributes(statusAttributeKey.String(iwres.Status))
+	if iwres.Reason != "" {
+		span.SetAttributes(reasonAttributeKey.String(iwres.Reason))
+	}
+	if iwres.Status == ImageWorkResultStatusFailed {
+		span.SetStatus(codes.Error, iwres.Message)
+	}
+	span.End()
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// spanAttribute returns the value of the attribute of the span
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestReconcileSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	fakekubeclientset := newJobCreatingClientset()
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent", "sa-kube-fledged",
+		"priority-class-kube-fledged", true, "")
+	imageCache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace, UID: "foo-uid"},
+	}
+	testnode := node
+	imagemanager.StartReconcileSpan("kube-fledged/foo", ImageCacheCreate)
+	for _, image := range []string{"foo:v1", "bar:v1"} {
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{Image: image, Node: &testnode, WorkType: ImageCacheCreate,
+			Imagecache: imageCache, ContainerRuntimeVersion: "containerd://1.6.8"})
+		imagemanager.processNextWorkItem()
+	}
+	if len(recorder.Ended()) != 0 {
+		t.Errorf("Test: spans of active jobs failed: expectedEndedSpans=0, actualEndedSpans=%d", len(recorder.Ended()))
+	}
+	// the pull job of foo:v1 finishes, the one of bar:v1 is still active when the results are collected
+	// and ends with an unknown status
+	for job, iwres := range imagemanager.imageworkstatus {
+		if iwres.ImageWorkRequest.Image == "foo:v1" {
+			finishJob(imagemanager, job)
+		}
+	}
+	errCh := make(chan error, 1)
+	imagemanager.updateImageCacheStatus(imageCache, errCh)
+	if err := <-errCh; err != nil {
+		t.Fatalf("Test: status update failed: %v", err)
+	}
+	imagemanager.EndReconcileSpan("kube-fledged/foo", string(fledgedv1alpha3.ImageCacheActionStatusFailed), nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Test: span hierarchy failed: expectedEndedSpans=3, actualEndedSpans=%d", len(spans))
+	}
+	var reconcile sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == reconcileSpanName {
+			reconcile = span
+		}
+	}
+	if reconcile == nil {
+		t.Fatalf("Test: span hierarchy failed: expected span %q", reconcileSpanName)
+	}
+	if actual := spanAttribute(reconcile, imageCacheAttributeKey); actual != "kube-fledged/foo" {
+		t.Errorf("Test: reconcile span failed: expectedImageCache=kube-fledged/foo, actualImageCache=%s", actual)
+	}
+	if actual := spanAttribute(reconcile, workTypeAttributeKey); actual != string(ImageCacheCreate) {
+		t.Errorf("Test: reconcile span failed: expectedWorkType=%s, actualWorkType=%s", ImageCacheCreate, actual)
+	}
+	expectedStatus := map[string]string{"foo:v1": ImageWorkResultStatusSucceeded, "bar:v1": ImageWorkResultStatusUnknown}
+	for _, span := range spans {
+		if span.Name() == reconcileSpanName {
+			continue
+		}
+		image := spanAttribute(span, imageAttributeKey)
+		if span.Name() != jobSpanName {
+			t.Errorf("Test: job span of %s failed: expectedName=%s, actualName=%s", image, jobSpanName, span.Name())
+		}
+		if span.Parent().SpanID() != reconcile.SpanContext().SpanID() || span.SpanContext().TraceID() != reconcile.SpanContext().TraceID() {
+			t.Errorf("Test: job span of %s failed: expected child of the reconcile span %s, actualParent=%s",
+				image, reconcile.SpanContext().SpanID(), span.Parent().SpanID())
+		}
+		if actual := spanAttribute(span, nodeAttributeKey); actual != "bar" {
+			t.Errorf("Test: job span of %s failed: expectedNode=bar, actualNode=%s", image, actual)
+		}
+		if actual := spanAttribute(span, actionAttributeKey); actual != "pull" {
+			t.Errorf("Test: job span of %s failed: expectedAction=pull, actualAction=%s", image, actual)
+		}
+		if actual := spanAttribute(span, statusAttributeKey); actual != expectedStatus[image] {
+			t.Errorf("Test: job span of %s failed: expectedStatus=%s, actualStatus=%s", image, expectedStatus[image], actual)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// warmCommand returns the warm command of the image of the request, if any
+func warmCommand(iwr ImageWorkRequest) []string {
+	if iwr.WarmCommand == nil {
+		return nil
+	}
+	return *iwr.WarmCommand
+}
+
+// setWarmCommand runs the warm command of the image in the container of the image pull job, instead of the
+// echo binary copied from the busybox image or the reading of the cached files. The busybox init container
+// and the volume it copies the echo binary to are then dropped.
+func setWarmCommand(job *batchv1.Job, iwr ImageWorkRequest) {
+	command := warmCommand(iwr)
+	if len(command) == 0 {
+		return
+	}
+	if isWindowsNode(iwr.Node) {
+		klog.Warningf("Warm command of image %s is not supported on Windows node %s, the image is only pulled", iwr.Image,
+			iwr.Node.Labels["kubernetes.io/hostname"])
+		return
+	}
+	podSpec := &job.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != "imagepuller" {
+			continue
+		}
+		podSpec.Containers[i].Command = append([]string{}, command...)
+		podSpec.Containers[i].Args = nil
+		podSpec.Containers[i].VolumeMounts = withoutVolumeMount(podSpec.Containers[i].VolumeMounts, "tmp-bin")
+	}
+	initContainers := []corev1.Container{}
+	for _, c := range podSpec.InitContainers {
+		if c.Name != "busybox" {
+			initContainers = append(initContainers, c)
+		}
+	}
+	podSpec.InitContainers = initContainers
+	volumes := []corev1.Volume{}
+	for _, v := range podSpec.Volumes {
+		if v.Name != "tmp-bin" {
+			volumes = append(volumes, v)
+		}
+	}
+	podSpec.Volumes = volumes
+}
+
+// withoutVolumeMount returns the volume mounts but the mount of the named volume
+func withoutVolumeMount(mounts []corev1.VolumeMount, name string) []corev1.VolumeMount {
+	kept := []corev1.VolumeMount{}
+	for _, m := range mounts {
+		if m.Name != name {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
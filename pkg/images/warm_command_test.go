@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWarmCommand(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+	}
+	windowsNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "win1",
+			Labels: map[string]string{"kubernetes.io/hostname": "win1", "kubernetes.io/os": "windows"},
+		},
+	}
+	warmCommand := []string{"python", "-c", "import model; model.load()"}
+	noWarmCommand := []string{}
+	tests := []struct {
+		name            string
+		warmCommand     *[]string
+		node            *corev1.Node
+		jobOptions      JobOptions
+		expectedCommand []string
+		expectBusybox   bool
+	}{
+		{
+			name:            "#1: No warm command",
+			node:            &node,
+			expectedCommand: []string{"/tmp/bin/echo", "Image pulled successfully!"},
+			expectBusybox:   true,
+		},
+		{
+			name:            "#2: Empty warm command",
+			warmCommand:     &noWarmCommand,
+			node:            &node,
+			expectedCommand: []string{"/tmp/bin/echo", "Image pulled successfully!"},
+			expectBusybox:   true,
+		},
+		{
+			name:            "#3: Warm command run in the pulled image",
+			warmCommand:     &warmCommand,
+			node:            &node,
+			expectedCommand: warmCommand,
+		},
+		{
+			name:            "#4: Warm command takes precedence over the controller-wide force full cache",
+			warmCommand:     &warmCommand,
+			node:            &node,
+			jobOptions:      JobOptions{ForceFullCache: true},
+			expectedCommand: warmCommand,
+		},
+		{
+			name:            "#5: Warm command not run on Windows nodes",
+			warmCommand:     &warmCommand,
+			node:            &windowsNode,
+			expectedCommand: []string{"cmd", "/c", "echo Image pulled successfully!"},
+		},
+	}
+	for _, test := range tests {
+		builder := NewImageJobBuilder(ImageJobBuilderOptions{BusyboxImage: "busybox:1.35.0", ImagePullPolicy: "IfNotPresent",
+			JobOptions: test.jobOptions})
+		job, err := builder.PullJob(ImageWorkRequest{Image: "example.com/llm:v1", WarmCommand: test.warmCommand,
+			Node: test.node, Imagecache: imagecache})
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if command := podSpec.Containers[0].Command; !reflect.DeepEqual(command, test.expectedCommand) {
+			t.Errorf("Test: %s failed: expectedCommand=%q, actualCommand=%q", test.name, test.expectedCommand, command)
+		}
+		busybox := false
+		for _, c := range podSpec.InitContainers {
+			if c.Name == "busybox" {
+				busybox = true
+			}
+		}
+		if busybox != test.expectBusybox {
+			t.Errorf("Test: %s failed: expectedBusyboxInitContainer=%t, actualBusyboxInitContainer=%t", test.name, test.expectBusybox, busybox)
+		}
+		for _, c := range podSpec.Containers {
+			for _, m := range c.VolumeMounts {
+				if m.Name == "tmp-bin" && !test.expectBusybox {
+					t.Errorf("Test: %s failed: volume tmp-bin of the echo binary still mounted in container %s", test.name, c.Name)
+				}
+			}
+		}
+	}
+}
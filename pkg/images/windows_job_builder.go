@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"strings"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultWindowsCRIClientImage is the image of the host process containers that delete images on Windows nodes
+const DefaultWindowsCRIClientImage = "mcr.microsoft.com/oss/kubernetes/windows-host-process-containers-base-image:v1.0.0"
+
+// windowsContainerdEndpoint is the named pipe of containerd on Windows nodes
+const windowsContainerdEndpoint = "npipe:////./pipe/containerd-containerd"
+
+// windowsHostProcessUser is the user that runs the host process containers deleting images
+const windowsHostProcessUser = "NT AUTHORITY\\SYSTEM"
+
+// isWindowsNode checks whether the node runs Windows
+func isWindowsNode(node *corev1.Node) bool {
+	if node.Status.NodeInfo.OperatingSystem != "" {
+		return node.Status.NodeInfo.OperatingSystem == "windows"
+	}
+	return node.Labels[corev1.LabelOSStable] == "windows"
+}
+
+// windowsPullJob pulls the image to a Windows node. Windows images have no busybox
+// to copy an echo binary from, so the pulled image runs its own cmd.exe instead.
+func windowsPullJob(imagecache *fledgedv1alpha3.ImageCache, image string, pullPolicy corev1.PullPolicy,
+	hostname string, labels map[string]string) *batchv1.Job {
+	return windowsJob(imagecache, hostname, labels, corev1.Container{
+		Name:            "imagepuller",
+		Image:           image,
+		Command:         []string{"cmd", "/c", "echo Image pulled successfully!"},
+		ImagePullPolicy: pullPolicy,
+	})
+}
+
+// windowsDeleteJob deletes the image from a Windows node using the crictl of the node.
+// The container runs as a host process, as containerd is only reachable on a named pipe of the host.
+func windowsDeleteJob(imagecache *fledgedv1alpha3.ImageCache, image string, criClientImage string,
+	hostname string, labels map[string]string) *batchv1.Job {
+	hostProcess := true
+	runAsUserName := windowsHostProcessUser
+	job := windowsJob(imagecache, hostname, labels, corev1.Container{
+		Name:  "windows-cri-client",
+		Image: criClientImage,
+		Command: []string{
+			"powershell.exe",
+			"-NoProfile",
+			"-Command",
+			fmt.Sprintf("crictl --runtime-endpoint %s rmi %s; exit $LASTEXITCODE", windowsContainerdEndpoint, powershellQuote(image)),
+		},
+		ImagePullPolicy: corev1.PullIfNotPresent,
+	})
+	podSpec := &job.Spec.Template.Spec
+	podSpec.SecurityContext = &corev1.PodSecurityContext{
+		WindowsOptions: &corev1.WindowsSecurityContextOptions{
+			HostProcess:   &hostProcess,
+			RunAsUserName: &runAsUserName,
+		},
+	}
+	// host process pods must run in the network namespace of the host
+	podSpec.HostNetwork = true
+	return job
+}
+
+// windowsJob builds a job running the container on a Windows node
+func windowsJob(imagecache *fledgedv1alpha3.ImageCache, hostname string, labels map[string]string, container corev1.Container) *batchv1.Job {
+	backoffLimit := int32(0)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: imagecache.Name + "-",
+			Namespace:    imagecache.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				ownerReference(imagecache),
+			},
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: imagecache.Namespace,
+					Labels:    labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"kubernetes.io/hostname": hostname,
+						corev1.LabelOSStable:     "windows",
+					},
+					Containers:       []corev1.Container{container},
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
+				},
+			},
+		},
+	}
+}
+
+// powershellQuote single-quotes an argument so that it is passed verbatim to powershell
+func powershellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsWindowsNode(t *testing.T) {
+	tests := []struct {
+		name            string
+		operatingSystem string
+		labels          map[string]string
+		expectedWindows bool
+	}{
+		{
+			name:            "#1: Linux node",
+			operatingSystem: "linux",
+			labels:          map[string]string{"kubernetes.io/os": "linux"},
+			expectedWindows: false,
+		},
+		{
+			name:            "#2: Windows node",
+			operatingSystem: "windows",
+			labels:          map[string]string{"kubernetes.io/os": "windows"},
+			expectedWindows: true,
+		},
+		{
+			name:            "#3: Windows node not yet reporting its operating system",
+			labels:          map[string]string{"kubernetes.io/os": "windows"},
+			expectedWindows: true,
+		},
+		{
+			name:            "#4: Node without operating system",
+			expectedWindows: false,
+		},
+	}
+	for _, test := range tests {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Labels: test.labels},
+			Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OperatingSystem: test.operatingSystem}},
+		}
+		if windows := isWindowsNode(node); windows != test.expectedWindows {
+			t.Errorf("Test: %s failed: expectedWindows=%t, actualWindows=%t", test.name, test.expectedWindows, windows)
+		}
+	}
+}
+
+func TestWindowsJobs(t *testing.T) {
+	imagecache := &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	windowsNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "win1",
+			Labels: map[string]string{"kubernetes.io/hostname": "win1", "kubernetes.io/os": "windows"},
+		},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "windows"}},
+	}
+	expectedNodeSelector := map[string]string{"kubernetes.io/hostname": "win1", "kubernetes.io/os": "windows"}
+
+	tests := []struct {
+		name           string
+		forceFullCache bool
+		cachePaths     []string
+	}{
+		{name: "#1: Common job"},
+		{name: "#2: Directory cache job", cachePaths: []string{"/opt/conda/lib/"}},
+		{name: "#3: Full cache job", forceFullCache: true},
+	}
+	for _, test := range tests {
+		job, err := newImagePullJob(imagecache, "mcr.microsoft.com/windows/servercore:ltsc2022", test.forceFullCache, test.cachePaths, nil,
+			windowsNode, "IfNotPresent", "", "busybox:1.35.0", "", "", JobOptions{})
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		if len(podSpec.InitContainers) != 0 {
+			t.Errorf("Test: %s failed: expectedInitContainers=0, actualInitContainers=%d", test.name, len(podSpec.InitContainers))
+		}
+		if len(podSpec.Containers) != 1 || podSpec.Containers[0].Image != "mcr.microsoft.com/windows/servercore:ltsc2022" ||
+			!reflect.DeepEqual(podSpec.Containers[0].Command, []string{"cmd", "/c", "echo Image pulled successfully!"}) {
+			t.Errorf("Test: %s failed: expected cmd container pulling the image, actualContainers=%+v", test.name, podSpec.Containers)
+		}
+		if !reflect.DeepEqual(podSpec.NodeSelector, expectedNodeSelector) {
+			t.Errorf("Test: %s failed: expectedNodeSelector=%v, actualNodeSelector=%v", test.name, expectedNodeSelector, podSpec.NodeSelector)
+		}
+		if len(podSpec.Volumes) != 0 {
+			t.Errorf("Test: %s failed: expectedVolumes=0, actualVolumes=%d", test.name, len(podSpec.Volumes))
+		}
+	}
+
+	job, err := newImageDeleteJob(imagecache, "example.com/app:it's", nil, windowsNode, "containerd://1.6.8", "cri-client:latest",
+		"", "", "", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: Windows delete job failed. expectedError=nil, actualError=%s", err.Error())
+	}
+	podSpec := job.Spec.Template.Spec
+	container := podSpec.Containers[0]
+	if container.Image != DefaultWindowsCRIClientImage {
+		t.Errorf("Test: Windows delete job failed: expectedImage=%s, actualImage=%s", DefaultWindowsCRIClientImage, container.Image)
+	}
+	expectedCommand := "crictl --runtime-endpoint npipe:////./pipe/containerd-containerd rmi 'example.com/app:it''s'; exit $LASTEXITCODE"
+	if container.Command[0] != "powershell.exe" || container.Command[len(container.Command)-1] != expectedCommand {
+		t.Errorf("Test: Windows delete job failed: expectedCommand=%s, actualCommand=%v", expectedCommand, container.Command)
+	}
+	if podSpec.SecurityContext == nil || podSpec.SecurityContext.WindowsOptions == nil ||
+		podSpec.SecurityContext.WindowsOptions.HostProcess == nil || !*podSpec.SecurityContext.WindowsOptions.HostProcess {
+		t.Errorf("Test: Windows delete job failed: expected host process pod, actualSecurityContext=%+v", podSpec.SecurityContext)
+	}
+	if !podSpec.HostNetwork {
+		t.Errorf("Test: Windows delete job failed: expected host network")
+	}
+	if len(podSpec.Volumes) != 0 {
+		t.Errorf("Test: Windows delete job failed: expectedVolumes=0, actualVolumes=%d", len(podSpec.Volumes))
+	}
+	if !reflect.DeepEqual(podSpec.NodeSelector, expectedNodeSelector) {
+		t.Errorf("Test: Windows delete job failed: expectedNodeSelector=%v, actualNodeSelector=%v", expectedNodeSelector, podSpec.NodeSelector)
+	}
+
+	job, err = newImageDeleteJob(imagecache, "example.com/app:v1", nil, windowsNode, "containerd://1.6.8", "cri-client:latest",
+		"", "", "", JobOptions{WindowsCRIClientImage: "example.com/windows-cri-client:v1"})
+	if err != nil {
+		t.Fatalf("Test: Windows delete job with custom image failed. expectedError=nil, actualError=%s", err.Error())
+	}
+	if image := job.Spec.Template.Spec.Containers[0].Image; image != "example.com/windows-cri-client:v1" {
+		t.Errorf("Test: Windows delete job with custom image failed: expectedImage=example.com/windows-cri-client:v1, actualImage=%s", image)
+	}
+
+	// Linux nodes are unchanged
+	job, err = newImageDeleteJob(imagecache, "example.com/app:v1", nil, &node, "containerd://1.6.8", "cri-client:latest",
+		"", "", "", JobOptions{})
+	if err != nil {
+		t.Fatalf("Test: Linux delete job failed. expectedError=nil, actualError=%s", err.Error())
+	}
+	if command := job.Spec.Template.Spec.Containers[0].Command; command[0] != "/bin/bash" || !strings.Contains(command[2], "crictl") {
+		t.Errorf("Test: Linux delete job failed: expected bash crictl command, actualCommand=%v", command)
+	}
+	if _, ok := job.Spec.Template.Spec.NodeSelector["kubernetes.io/os"]; ok {
+		t.Errorf("Test: Linux delete job failed: unexpected os nodeSelector %v", job.Spec.Template.Spec.NodeSelector)
+	}
+}
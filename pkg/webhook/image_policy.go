@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// ImagePolicy restricts the images that can be cached to the repositories matching a pattern of
+// the allowlist, if any, and not matching a pattern of the denylist
+type ImagePolicy struct {
+	Allowlist []string
+	Denylist  []string
+}
+
+// imagePolicy is the image policy of the webhook server, evaluated for the images of every image cache
+var imagePolicy imagePolicyMatcher
+
+// imagePolicyMatcher is the compiled form of an image policy
+type imagePolicyMatcher struct {
+	allowlist []*regexp.Regexp
+	denylist  []*regexp.Regexp
+}
+
+// SetImagePolicy sets the image policy evaluated by ValidateImageCache
+func SetImagePolicy(policy ImagePolicy) error {
+	allowlist, err := compileImagePatterns(policy.Allowlist)
+	if err != nil {
+		return fmt.Errorf("invalid image allowlist: %v", err)
+	}
+	denylist, err := compileImagePatterns(policy.Denylist)
+	if err != nil {
+		return fmt.Errorf("invalid image denylist: %v", err)
+	}
+	imagePolicy = imagePolicyMatcher{allowlist: allowlist, denylist: denylist}
+	return nil
+}
+
+// ParseImagePatterns parses a comma-separated list of repository patterns e.g.
+// docker.io/library/*,*.internal.io/*
+func ParseImagePatterns(val string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(val, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := compileImagePattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func compileImagePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := compileImagePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// compileImagePattern compiles a pattern matching the fully-qualified repository of an image, in which
+// '*' matches any sequence of characters, including '/'. A pattern without wildcards is normalized
+// like an image reference e.g. nginx --> docker.io/library/nginx
+func compileImagePattern(pattern string) (*regexp.Regexp, error) {
+	if !strings.Contains(pattern, "*") {
+		named, err := reference.ParseNormalizedNamed(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		if !reference.IsNameOnly(named) {
+			return nil, fmt.Errorf("invalid pattern %q: must not have a tag or digest", pattern)
+		}
+		return regexp.MustCompile("^" + regexp.QuoteMeta(named.Name()) + "$"), nil
+	}
+	if _, err := reference.ParseNormalizedNamed(strings.ReplaceAll(pattern, "*", "x")); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"), nil
+}
+
+// allowed returns an error if the image is denied by the image policy
+func (p imagePolicyMatcher) allowed(image string) error {
+	if len(p.allowlist) == 0 && len(p.denylist) == 0 {
+		return nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return err
+	}
+	repository := named.Name()
+	for _, re := range p.denylist {
+		if re.MatchString(repository) {
+			return fmt.Errorf("repository %s is denied by the image policy", repository)
+		}
+	}
+	if len(p.allowlist) == 0 {
+		return nil
+	}
+	for _, re := range p.allowlist {
+		if re.MatchString(repository) {
+			return nil
+		}
+	}
+	return fmt.Errorf("repository %s is not in the image allowlist", repository)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	v1 "k8s.io/api/admission/v1"
+)
+
+func TestImagePolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		policy            ImagePolicy
+		image             string
+		expectedErrString string
+	}{
+		{
+			name:   "#1: No policy",
+			policy: ImagePolicy{},
+			image:  "untrusted.example.com/miner:latest",
+		},
+		{
+			name:   "#2: Image in the allowlist",
+			policy: ImagePolicy{Allowlist: []string{"docker.io/library/*"}},
+			image:  "nginx:1.25",
+		},
+		{
+			name:              "#3: Image not in the allowlist",
+			policy:            ImagePolicy{Allowlist: []string{"docker.io/library/*"}},
+			image:             "quay.io/coreos/etcd:v3.5.0",
+			expectedErrString: "repository quay.io/coreos/etcd is not in the image allowlist",
+		},
+		{
+			name:   "#4: Wildcard registry matching nested repositories",
+			policy: ImagePolicy{Allowlist: []string{"*.internal.io/*"}},
+			image:  "registry.internal.io/team/app@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+		},
+		{
+			name:              "#5: Wildcard registry does not match its parent domain",
+			policy:            ImagePolicy{Allowlist: []string{"*.internal.io/*"}},
+			image:             "internal.io/app:v1",
+			expectedErrString: "repository internal.io/app is not in the image allowlist",
+		},
+		{
+			name:              "#6: Image in the denylist",
+			policy:            ImagePolicy{Denylist: []string{"untrusted.example.com/*"}},
+			image:             "untrusted.example.com/miner:latest",
+			expectedErrString: "repository untrusted.example.com/miner is denied by the image policy",
+		},
+		{
+			name:              "#7: Denylist takes precedence over the allowlist",
+			policy:            ImagePolicy{Allowlist: []string{"docker.io/*"}, Denylist: []string{"docker.io/library/busybox"}},
+			image:             "busybox:1.36",
+			expectedErrString: "repository docker.io/library/busybox is denied by the image policy",
+		},
+		{
+			name:   "#8: Pattern without wildcards is normalized",
+			policy: ImagePolicy{Allowlist: []string{"nginx"}},
+			image:  "docker.io/library/nginx:1.25",
+		},
+		{
+			name:              "#9: Pattern without wildcards matches the repository only",
+			policy:            ImagePolicy{Allowlist: []string{"nginx"}},
+			image:             "nginx/nginx-ingress:3.0",
+			expectedErrString: "repository docker.io/nginx/nginx-ingress is not in the image allowlist",
+		},
+	}
+	defer SetImagePolicy(ImagePolicy{})
+	for _, test := range tests {
+		if err := SetImagePolicy(test.policy); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		err := imagePolicy.allowed(test.image)
+		if test.expectedErrString == "" && err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if test.expectedErrString != "" && (err == nil || err.Error() != test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrString, err)
+		}
+	}
+}
+
+func TestParseImagePatterns(t *testing.T) {
+	tests := []struct {
+		name              string
+		val               string
+		expectedPatterns  []string
+		expectedErrString string
+	}{
+		{
+			name:             "#1: Comma-separated patterns",
+			val:              " docker.io/library/* ,*.internal.io/*,, nginx",
+			expectedPatterns: []string{"docker.io/library/*", "*.internal.io/*", "nginx"},
+		},
+		{
+			name:              "#2: Pattern with a tag",
+			val:               "nginx:1.25",
+			expectedErrString: "invalid pattern \"nginx:1.25\": must not have a tag or digest",
+		},
+		{
+			name:              "#3: Malformed pattern",
+			val:               "my registry/*",
+			expectedErrString: "invalid pattern \"my registry/*\"",
+		},
+	}
+	for _, test := range tests {
+		patterns, err := ParseImagePatterns(test.val)
+		if test.expectedErrString != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expectedErrString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(patterns, test.expectedPatterns) {
+			t.Errorf("Test: %s failed: expectedPatterns=%v, actualPatterns=%v", test.name, test.expectedPatterns, patterns)
+		}
+	}
+}
+
+func TestValidateImageCacheImagePolicy(t *testing.T) {
+	if err := SetImagePolicy(ImagePolicy{Allowlist: []string{"*.internal.io/*"}, Denylist: []string{"registry.internal.io/untrusted/*"}}); err != nil {
+		t.Fatalf("Error setting image policy: %v", err)
+	}
+	defer SetImagePolicy(ImagePolicy{})
+	tests := []struct {
+		name              string
+		imageCache        *fledgedv1alpha3.ImageCache
+		expectAllowed     bool
+		expectedErrString string
+	}{
+		{
+			name:          "#1: Allowed images",
+			imageCache:    newImageCache(fledgedv1alpha3.Image{Name: "registry.internal.io/team/app:v1"}, fledgedv1alpha3.Image{Name: "mirror.internal.io/nginx:1.25"}),
+			expectAllowed: true,
+		},
+		{
+			name:              "#2: Image not in the allowlist",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "registry.internal.io/team/app:v1"}, fledgedv1alpha3.Image{Name: "nginx:1.25"}),
+			expectAllowed:     false,
+			expectedErrString: "Image \"nginx:1.25\" in cacheSpec[0].images[1] not allowed: repository docker.io/library/nginx is not in the image allowlist",
+		},
+		{
+			name:              "#3: Denied image",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "registry.internal.io/untrusted/miner:latest"}),
+			expectAllowed:     false,
+			expectedErrString: "Image \"registry.internal.io/untrusted/miner:latest\" in cacheSpec[0].images[0] not allowed: repository registry.internal.io/untrusted/miner is denied by the image policy",
+		},
+	}
+	for _, test := range tests {
+		resp := ValidateImageCache(newAdmissionReview(t, v1.Create, test.imageCache, nil))
+		if resp.Allowed != test.expectAllowed {
+			t.Errorf("Test: %s failed: expectedAllowed=%t, actualAllowed=%t", test.name, test.expectAllowed, resp.Allowed)
+		}
+		if !test.expectAllowed && (resp.Result == nil || resp.Result.Message != test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualResult=%+v", test.name, test.expectedErrString, resp.Result)
+		}
+	}
+}
@@ -19,61 +19,149 @@ package webhook
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	// time zones are embedded, as the webhook server image may not provide them
+	_ "time/tzdata"
 
-	"github.com/golang/glog"
-	fledgedv1alpha2 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha2"
+	"github.com/docker/distribution/reference"
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	"github.com/lcouds/kube-fledged/pkg/images"
+	"github.com/robfig/cron"
 	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
 )
 
-const (
-	customResourcePatch1 string = `[
-         { "op": "add", "path": "/data/mutation-stage-1", "value": "yes" }
-     ]`
-	customResourcePatch2 string = `[
-         { "op": "add", "path": "/data/mutation-stage-2", "value": "yes" }
-     ]`
-)
+// OriginalImageNamesAnnotationKey is the annotation recording the image names as given by
+// the user, keyed by the canonical name that the mutating webhook stored in the spec
+const OriginalImageNamesAnnotationKey = "kubefledged.io/original-image-names"
 
-// MutateImageCache modifies image cache resource
-/*
+// jsonPatchOperation is a single operation of a JSON patch (RFC 6902)
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MutateImageCache canonicalizes the image references of an image cache e.g.
+// nginx --> docker.io/library/nginx:latest, so that the stored spec is unambiguous.
+// The original names are recorded in the original-image-names annotation. Digest
+// references and references that do not parse are left untouched, the latter
+// being rejected by the validating webhook.
 func MutateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
-	glog.V(4).Info("mutating custom resource")
-	cr := struct {
-		metav1.ObjectMeta
-		Data map[string]string
-	}{}
+	klog.V(4).Info("mutating image cache")
+	var imageCache fledgedv1alpha3.ImageCache
 
 	raw := ar.Request.Object.Raw
-	err := json.Unmarshal(raw, &cr)
+	err := json.Unmarshal(raw, &imageCache)
 	if err != nil {
-		glog.Error(err)
+		klog.Error(err)
 		return toV1AdmissionResponse(err)
 	}
 
 	reviewResponse := v1.AdmissionResponse{}
 	reviewResponse.Allowed = true
 
-	if cr.Data["mutation-start"] == "yes" {
-		reviewResponse.Patch = []byte(customResourcePatch1)
+	originals := map[string]string{}
+	if val, ok := imageCache.Annotations[OriginalImageNamesAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(val), &originals); err != nil {
+			klog.Warningf("Ignoring malformed annotation %s: %v", OriginalImageNamesAnnotationKey, err)
+			originals = map[string]string{}
+		}
 	}
-	if cr.Data["mutation-stage-1"] == "yes" {
-		reviewResponse.Patch = []byte(customResourcePatch2)
+
+	patch := []jsonPatchOperation{}
+	names := map[string]bool{}
+	for k, i := range imageCache.Spec.CacheSpec {
+		for m, image := range i.Images {
+			names[image.Name] = true
+			canonical, ok := canonicalImageReference(image.Name)
+			if !ok || canonical == image.Name {
+				continue
+			}
+			names[canonical] = true
+			patch = append(patch, jsonPatchOperation{
+				Op:    "replace",
+				Path:  fmt.Sprintf("/spec/cacheSpec/%d/images/%d/name", k, m),
+				Value: canonical,
+			})
+			originals[canonical] = image.Name
+			klog.V(4).Infof("Image %s canonicalized to %s", image.Name, canonical)
+		}
 	}
-	if len(reviewResponse.Patch) != 0 {
-		pt := v1.PatchTypeJSONPatch
-		reviewResponse.PatchType = &pt
+	if len(patch) == 0 {
+		return &reviewResponse
 	}
+
+	// images no longer in the spec are dropped from the annotation
+	for canonical := range originals {
+		if !names[canonical] {
+			delete(originals, canonical)
+		}
+	}
+	val, err := json.Marshal(originals)
+	if err != nil {
+		klog.Error(err)
+		return toV1AdmissionResponse(err)
+	}
+	if imageCache.Annotations == nil {
+		patch = append(patch, jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{OriginalImageNamesAnnotationKey: string(val)},
+		})
+	} else {
+		patch = append(patch, jsonPatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + escapeJSONPointer(OriginalImageNamesAnnotationKey),
+			Value: string(val),
+		})
+	}
+
+	reviewResponse.Patch, err = json.Marshal(patch)
+	if err != nil {
+		klog.Error(err)
+		return toV1AdmissionResponse(err)
+	}
+	pt := v1.PatchTypeJSONPatch
+	reviewResponse.PatchType = &pt
 	return &reviewResponse
 }
-*/
+
+// canonicalImageReference returns the fully-qualified form of a tagged or untagged image
+// reference. It returns false for digest references and references that do not parse.
+func canonicalImageReference(image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := named.(reference.Canonical); ok {
+		return "", false
+	}
+	return reference.TagNameOnly(named).String(), true
+}
+
+// escapeJSONPointer escapes a key for use as a JSON pointer (RFC 6901) token
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
 
 // ValidateImageCache validates image cache resource
 func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
-	glog.V(4).Info("admitting image cache")
+	klog.V(4).Info("admitting image cache")
 	var raw, oldraw []byte
-	var imageCache, oldImageCache fledgedv1alpha2.ImageCache
+	var imageCache, oldImageCache fledgedv1alpha3.ImageCache
 
 	reviewResponse := v1.AdmissionResponse{}
 	reviewResponse.Allowed = true
@@ -81,7 +169,7 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	raw = ar.Request.Object.Raw
 	err := json.Unmarshal(raw, &imageCache)
 	if err != nil {
-		glog.Error(err)
+		klog.Error(err)
 		return toV1AdmissionResponse(err)
 	}
 
@@ -89,47 +177,192 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 		oldraw = ar.Request.OldObject.Raw
 		err := json.Unmarshal(oldraw, &oldImageCache)
 		if err != nil {
-			glog.Error(err)
+			klog.Error(err)
 			return toV1AdmissionResponse(err)
 		}
+		// the purge-image annotation is validated even if the spec is unchanged
+		if err := validatePurgeImage(&oldImageCache, &imageCache); err != nil {
+			klog.Errorf("Invalid %s annotation: %v", fledgedv1alpha3.ImageCachePurgeImageAnnotationKey, err)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid %s annotation: %v", fledgedv1alpha3.ImageCachePurgeImageAnnotationKey, err))
+		}
 		if reflect.DeepEqual(oldImageCache.Spec, imageCache.Spec) {
-			glog.V(4).Info("No change in image cache spec: skipping validation")
+			klog.V(4).Info("No change in image cache spec: skipping validation")
 			return &reviewResponse
 		}
 	}
 
+	if err := validateJobDeadline(imageCache.Spec.ImagePullJobDeadline); err != nil {
+		klog.Errorf("Invalid imagePullJobDeadline: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid imagePullJobDeadline: %v", err))
+	}
+	if err := validateJobDeadline(imageCache.Spec.ImageDeleteJobDeadline); err != nil {
+		klog.Errorf("Invalid imageDeleteJobDeadline: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid imageDeleteJobDeadline: %v", err))
+	}
+	if err := validateJobDeadline(imageCache.Spec.ImagePullDeadline); err != nil {
+		klog.Errorf("Invalid imagePullDeadline: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid imagePullDeadline: %v", err))
+	}
+	if imageCache.Spec.ImagePullTimeoutRetries < 0 {
+		klog.Errorf("Invalid imagePullTimeoutRetries: %d is negative", imageCache.Spec.ImagePullTimeoutRetries)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid imagePullTimeoutRetries: %d is negative", imageCache.Spec.ImagePullTimeoutRetries))
+	}
+	if imageCache.Spec.FailedPullRetries < 0 {
+		klog.Errorf("Invalid failedPullRetries: %d is negative", imageCache.Spec.FailedPullRetries)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid failedPullRetries: %d is negative", imageCache.Spec.FailedPullRetries))
+	}
+	if threshold := imageCache.Spec.PartialFailureThresholdPercent; threshold < 0 || threshold > 100 {
+		klog.Errorf("Invalid partialFailureThresholdPercent: %d is not between 0 and 100", threshold)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid partialFailureThresholdPercent: %d is not between 0 and 100", threshold))
+	}
+	if err := validateFailurePolicy(imageCache.Spec); err != nil {
+		klog.Errorf("Invalid failurePolicy: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid failurePolicy: %v", err))
+	}
+
+	if err := validateJobResources(imageCache.Spec.JobResources); err != nil {
+		klog.Errorf("Invalid jobResources: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid jobResources: %v", err))
+	}
+
+	if err := validateContainerdNamespace(imageCache.Spec.ContainerdNamespace); err != nil {
+		klog.Errorf("Invalid containerdNamespace: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid containerdNamespace: %v", err))
+	}
+	if err := validateSnapshotter(imageCache.Spec.Snapshotter); err != nil {
+		klog.Errorf("Invalid snapshotter: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid snapshotter: %v", err))
+	}
+
+	if err := validateRefreshSchedule(imageCache.Spec.RefreshSchedule); err != nil {
+		klog.Errorf("Invalid refreshSchedule: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid refreshSchedule: %v", err))
+	}
+
+	if err := validateRefreshTimeZone(imageCache.Spec.RefreshTimeZone); err != nil {
+		klog.Errorf("Invalid refreshTimeZone: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid refreshTimeZone: %v", err))
+	}
+
+	if err := validateRolloutStrategy(imageCache.Spec.RolloutStrategy); err != nil {
+		klog.Errorf("Invalid rolloutStrategy: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid rolloutStrategy: %v", err))
+	}
+
+	if err := validateSeccompProfile(imageCache.Spec.JobSeccompProfile); err != nil {
+		klog.Errorf("Invalid jobSeccompProfile: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid jobSeccompProfile: %v", err))
+	}
+
+	if err := validateBusyboxImage(imageCache.Spec.BusyboxImage); err != nil {
+		klog.Errorf("Invalid busyboxImage: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid busyboxImage: %v", err))
+	}
+
+	if err := validateCriClientImages(imageCache.Spec.CriClientImage, imageCache.Spec.CriClientImages); err != nil {
+		klog.Errorf("Invalid criClientImages: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid criClientImages: %v", err))
+	}
+
+	if err := validateJobLabels(imageCache.Spec.JobLabels); err != nil {
+		klog.Errorf("Invalid jobLabels: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid jobLabels: %v", err))
+	}
+
+	if err := validateJobAnnotations(imageCache.Spec.JobAnnotations); err != nil {
+		klog.Errorf("Invalid jobAnnotations: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid jobAnnotations: %v", err))
+	}
+
+	if err := validateExcludedNodeSelector(imageCache.Spec.ExcludedNodeSelector); err != nil {
+		klog.Errorf("Invalid excludedNodeSelector: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid excludedNodeSelector: %v", err))
+	}
+
+	if err := validateJobDNS(imageCache.Spec.JobDNSPolicy, imageCache.Spec.JobDNSConfig); err != nil {
+		klog.Errorf("Invalid job DNS settings: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid job DNS settings: %v", err))
+	}
+
+	if err := validateWorkloadRef(imageCache.Spec.WorkloadRef); err != nil {
+		klog.Errorf("Invalid workloadRef: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid workloadRef: %v", err))
+	}
+
+	if err := validateRegistryCAs(imageCache.Spec.RegistryCAs); err != nil {
+		klog.Errorf("Invalid registryCAs: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid registryCAs: %v", err))
+	}
+
+	if err := validateImageListFrom(imageCache.Spec.ImageListFrom); err != nil {
+		klog.Errorf("Invalid imageListFrom: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid imageListFrom: %v", err))
+	}
+
+	if err := validatePullBandwidth(imageCache.Spec.PullBandwidth); err != nil {
+		klog.Errorf("Invalid pullBandwidth: %v", err)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid pullBandwidth: %v", err))
+	}
+
 	cacheSpec := imageCache.Spec.CacheSpec
-	glog.V(4).Infof("cacheSpec: %+v", cacheSpec)
+	klog.V(4).Infof("cacheSpec: %+v", cacheSpec)
 
-	for _, i := range cacheSpec {
+	for k, i := range cacheSpec {
 		if len(i.Images) == 0 {
-			glog.Error("No images specified within image list")
+			klog.Error("No images specified within image list")
 			return toV1AdmissionResponse(fmt.Errorf("No images specified within image list"))
 		}
 
+		imageRefs := make([]string, len(i.Images))
 		for m := range i.Images {
+			imageRef, err := validateImageReference(i.Images[m].Name)
+			if err != nil {
+				klog.Errorf("Invalid image reference %q in cacheSpec[%d].images[%d]: %v", i.Images[m].Name, k, m, err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid image reference %q in cacheSpec[%d].images[%d]: %v", i.Images[m].Name, k, m, err))
+			}
+			if err := imagePolicy.allowed(i.Images[m].Name); err != nil {
+				klog.Errorf("Image %q in cacheSpec[%d].images[%d] not allowed: %v", i.Images[m].Name, k, m, err)
+				return toV1AdmissionResponse(fmt.Errorf("Image %q in cacheSpec[%d].images[%d] not allowed: %v", i.Images[m].Name, k, m, err))
+			}
+			imageRefs[m] = imageRef
 			for p := 0; p < m; p++ {
-				if i.Images[p] == i.Images[m] {
-					glog.Errorf("Duplicate image names within image list: %s", i.Images[m])
-					return toV1AdmissionResponse(fmt.Errorf("Duplicate image names within image list: %s", i.Images[m]))
+				if imageRefs[p] == imageRef {
+					klog.Errorf("Duplicate image names within image list: %s (cacheSpec[%d].images[%d] and cacheSpec[%d].images[%d])", i.Images[m].Name, k, p, k, m)
+					return toV1AdmissionResponse(fmt.Errorf("Duplicate image names within image list: %s (cacheSpec[%d].images[%d] and cacheSpec[%d].images[%d])", i.Images[m].Name, k, p, k, m))
 				}
 			}
+			if err := validateImagePullPolicy(i.Images[m].ImagePullPolicy); err != nil {
+				klog.Errorf("Invalid image pull policy for image %s: %v", i.Images[m].Name, err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid image pull policy for image %s: %v", i.Images[m].Name, err))
+			}
+			if err := validateArtifactType(i.Images[m]); err != nil {
+				klog.Errorf("Invalid artifact type for image %s: %v", i.Images[m].Name, err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid artifact type for image %s: %v", i.Images[m].Name, err))
+			}
+			if err := validateWarmCommand(i.Images[m]); err != nil {
+				klog.Errorf("Invalid warm command for image %s: %v", i.Images[m].Name, err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid warm command for image %s: %v", i.Images[m].Name, err))
+			}
+			if err := validateAliases(i.Images[m]); err != nil {
+				klog.Errorf("Invalid aliases for image %s: %v", i.Images[m].Name, err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid aliases for image %s: %v", i.Images[m].Name, err))
+			}
 		}
 		/*
 			if len(i.NodeSelector) > 0 {
 				if nodes, err = c.nodesLister.List(labels.Set(i.NodeSelector).AsSelector()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector %+v: %v", i.NodeSelector, err)
+					klog.Errorf("Error listing nodes using nodeselector %+v: %v", i.NodeSelector, err)
 					return err
 				}
 			} else {
 				if nodes, err = c.nodesLister.List(labels.Everything()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector labels.Everything(): %v", err)
+					klog.Errorf("Error listing nodes using nodeselector labels.Everything(): %v", err)
 					return err
 				}
 			}
-			glog.V(4).Infof("No. of nodes in %+v is %d", i.NodeSelector, len(nodes))
+			klog.V(4).Infof("No. of nodes in %+v is %d", i.NodeSelector, len(nodes))
 			if len(nodes) == 0 {
-				glog.Errorf("NodeSelector %s did not match any nodes.", labels.Set(i.NodeSelector).String())
+				klog.Errorf("NodeSelector %s did not match any nodes.", labels.Set(i.NodeSelector).String())
 				return fmt.Errorf("NodeSelector %s did not match any nodes", labels.Set(i.NodeSelector).String())
 			}
 		*/
@@ -137,22 +370,482 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 
 	if ar.Request.Operation == v1.Update {
 		if len(oldImageCache.Spec.CacheSpec) != len(imageCache.Spec.CacheSpec) {
-			glog.Errorf("Mismatch in no. of image lists")
+			klog.Errorf("Mismatch in no. of image lists")
 			return toV1AdmissionResponse(fmt.Errorf("Mismatch in no. of image lists"))
 		}
 
 		for i := range oldImageCache.Spec.CacheSpec {
 			if !reflect.DeepEqual(oldImageCache.Spec.CacheSpec[i].NodeSelector, imageCache.Spec.CacheSpec[i].NodeSelector) {
-				glog.Errorf("Mismatch in node selector")
+				klog.Errorf("Mismatch in node selector")
 				return toV1AdmissionResponse(fmt.Errorf("Mismatch in node selector"))
 			}
 		}
 	}
 
-	glog.Info("Image cache creation/update validated successfully")
+	klog.Info("Image cache creation/update validated successfully")
 	return &reviewResponse
 }
 
+// validateImageReference parses the image reference and returns its fully-qualified form
+// e.g. nginx --> docker.io/library/nginx:latest, so that different forms of the same image compare equal
+func validateImageReference(image string) (string, error) {
+	if image == "" {
+		return "", fmt.Errorf("image name is empty")
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return reference.TrimNamed(named).String() + "@" + canonical.Digest().String(), nil
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// validateImagePullPolicy allows an empty pull policy (controller-wide policy applies) or one of Always/IfNotPresent/Never
+func validateImagePullPolicy(pullPolicy corev1.PullPolicy) error {
+	switch pullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		return nil
+	}
+	return fmt.Errorf("unsupported value %q: supported values are %q, %q and %q",
+		pullPolicy, corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever)
+}
+
+// validateFailurePolicy allows an empty failure policy (Continue) or one of Continue/Abort. Failed pulls are
+// not retried by an image cache aborting on failure.
+func validateFailurePolicy(spec fledgedv1alpha3.ImageCacheSpec) error {
+	switch spec.FailurePolicy {
+	case "", fledgedv1alpha3.FailurePolicyContinue:
+		return nil
+	case fledgedv1alpha3.FailurePolicyAbort:
+	default:
+		return fmt.Errorf("unsupported value %q: supported values are %q and %q", spec.FailurePolicy,
+			fledgedv1alpha3.FailurePolicyContinue, fledgedv1alpha3.FailurePolicyAbort)
+	}
+	if spec.FailedPullRetries > 0 {
+		return fmt.Errorf("failedPullRetries is not supported with failure policy %s", spec.FailurePolicy)
+	}
+	return nil
+}
+
+// validateArtifactType allows an empty artifact type (a container image) or one of Image/Wasm/Artifact.
+// Images not run by their pull job have no files to cache, and artifacts cannot be verified with the Never pull policy.
+func validateArtifactType(image fledgedv1alpha3.Image) error {
+	switch image.ArtifactType {
+	case "", fledgedv1alpha3.ArtifactTypeImage:
+		return nil
+	case fledgedv1alpha3.ArtifactTypeWasm, fledgedv1alpha3.ArtifactTypeArtifact:
+	default:
+		return fmt.Errorf("unsupported value %q: supported values are %q, %q and %q", image.ArtifactType,
+			fledgedv1alpha3.ArtifactTypeImage, fledgedv1alpha3.ArtifactTypeWasm, fledgedv1alpha3.ArtifactTypeArtifact)
+	}
+	if image.ForceFullCache || len(image.CachePaths) > 0 {
+		return fmt.Errorf("forceFullCache and cachePaths are not supported for artifact type %s", image.ArtifactType)
+	}
+	if image.ArtifactType == fledgedv1alpha3.ArtifactTypeArtifact && image.ImagePullPolicy == corev1.PullNever {
+		return fmt.Errorf("image pull policy %s is not supported for artifact type %s", corev1.PullNever, image.ArtifactType)
+	}
+	return nil
+}
+
+// validateWarmCommand allows no warm command, or a warm command with an executable run in a container image
+// whose files are not otherwise cached
+func validateWarmCommand(image fledgedv1alpha3.Image) error {
+	if len(image.WarmCommand) == 0 {
+		return nil
+	}
+	if image.ArtifactType != "" && image.ArtifactType != fledgedv1alpha3.ArtifactTypeImage {
+		return fmt.Errorf("warmCommand is not supported for artifact type %s", image.ArtifactType)
+	}
+	if image.ForceFullCache || len(image.CachePaths) > 0 {
+		return fmt.Errorf("warmCommand cannot be combined with forceFullCache or cachePaths")
+	}
+	if strings.TrimSpace(image.WarmCommand[0]) == "" {
+		return fmt.Errorf("the executable of the warm command is empty")
+	}
+	for _, arg := range image.WarmCommand {
+		if strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("argument %q contains a NUL character", arg)
+		}
+	}
+	return nil
+}
+
+// validateAliases allows no aliases, or aliases of a container image that are distinct references by tag. An
+// image cannot be tagged with a digest, which is the one of the image itself.
+func validateAliases(image fledgedv1alpha3.Image) error {
+	if len(image.Aliases) == 0 {
+		return nil
+	}
+	if image.ArtifactType == fledgedv1alpha3.ArtifactTypeArtifact {
+		return fmt.Errorf("aliases are not supported for artifact type %s", image.ArtifactType)
+	}
+	imageRef, _ := validateImageReference(image.Name)
+	seen := map[string]bool{imageRef: true}
+	for _, alias := range image.Aliases {
+		aliasRef, err := validateImageReference(alias)
+		if err != nil {
+			return fmt.Errorf("invalid alias %q: %v", alias, err)
+		}
+		if strings.Contains(aliasRef, "@") {
+			return fmt.Errorf("alias %q is a digest reference", alias)
+		}
+		if seen[aliasRef] {
+			return fmt.Errorf("alias %q duplicates the image or another alias", alias)
+		}
+		seen[aliasRef] = true
+	}
+	return nil
+}
+
+// validateJobDeadline allows an unset deadline (controller-wide deadline applies) or a deadline of at least one second
+func validateJobDeadline(deadline *metav1.Duration) error {
+	if deadline == nil {
+		return nil
+	}
+	if deadline.Duration < time.Second {
+		return fmt.Errorf("deadline %s is less than 1s", deadline.Duration)
+	}
+	return nil
+}
+
+// validateJobResources checks that no resource request exceeds its limit
+func validateJobResources(resources *corev1.ResourceRequirements) error {
+	if resources == nil {
+		return nil
+	}
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("%s request %s is greater than limit %s", name, request.String(), limit.String())
+		}
+	}
+	return nil
+}
+
+// containerdNamespaceRegexp matches the identifiers accepted by containerd as namespace names
+var containerdNamespaceRegexp = regexp.MustCompile(`^[A-Za-z0-9]+(?:[._-][A-Za-z0-9]+)*$`)
+
+// validateContainerdNamespace allows an empty namespace (images are deleted through the CRI) or a valid containerd namespace
+func validateContainerdNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	if len(namespace) > 76 || !containerdNamespaceRegexp.MatchString(namespace) {
+		return fmt.Errorf("%q is not a valid containerd namespace", namespace)
+	}
+	return nil
+}
+
+// validateSnapshotter allows an empty snapshotter (the snapshotter of the CRI plugin of containerd) or the name
+// of a containerd snapshotter, an identifier as for containerd namespaces
+func validateSnapshotter(snapshotter string) error {
+	if snapshotter == "" {
+		return nil
+	}
+	if len(snapshotter) > 76 || !containerdNamespaceRegexp.MatchString(snapshotter) {
+		return fmt.Errorf("%q is not a valid containerd snapshotter name", snapshotter)
+	}
+	return nil
+}
+
+// validateRefreshSchedule allows an empty schedule (the controller-wide refresh frequency applies) or a standard cron expression
+func validateRefreshSchedule(schedule string) error {
+	if schedule == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("%q is not a valid cron schedule: %v", schedule, err)
+	}
+	return nil
+}
+
+// validateRefreshTimeZone allows an empty time zone (UTC) or an IANA time zone name
+func validateRefreshTimeZone(timeZone string) error {
+	if timeZone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return fmt.Errorf("%q is not a valid time zone: %v", timeZone, err)
+	}
+	return nil
+}
+
+// validateRolloutStrategy allows an unset rollout strategy or maxUnavailable (all nodes at once), or a
+// maxUnavailable that is a positive number or percentage. maxUnavailablePerGroup is validated likewise and
+// requires refreshGroupByLabel, a valid label key, which in turn requires maxUnavailablePerGroup.
+func validateRolloutStrategy(strategy *fledgedv1alpha3.RolloutStrategy) error {
+	if strategy == nil {
+		return nil
+	}
+	if err := validateMaxUnavailable(strategy.MaxUnavailable, "maxUnavailable"); err != nil {
+		return err
+	}
+	if err := validateMaxUnavailable(strategy.MaxUnavailablePerGroup, "maxUnavailablePerGroup"); err != nil {
+		return err
+	}
+	if strategy.RefreshGroupByLabel == "" {
+		if strategy.MaxUnavailablePerGroup != nil {
+			return fmt.Errorf("maxUnavailablePerGroup requires refreshGroupByLabel")
+		}
+		return nil
+	}
+	if errs := validation.IsQualifiedName(strategy.RefreshGroupByLabel); len(errs) > 0 {
+		return fmt.Errorf("refreshGroupByLabel %q is not a valid label key: %s", strategy.RefreshGroupByLabel, strings.Join(errs, "; "))
+	}
+	if strategy.MaxUnavailablePerGroup == nil {
+		return fmt.Errorf("refreshGroupByLabel requires maxUnavailablePerGroup")
+	}
+	return nil
+}
+
+// validateMaxUnavailable allows an unset maximum number of nodes, or a positive number or percentage
+func validateMaxUnavailable(maxUnavailable *intstr.IntOrString, fieldName string) error {
+	if maxUnavailable == nil {
+		return nil
+	}
+	// A percentage of 100 nodes equals the percentage itself
+	value, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, 100, true)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", fieldName, err)
+	}
+	if value < 1 {
+		return fmt.Errorf("%s %s must be greater than zero", fieldName, maxUnavailable.String())
+	}
+	return nil
+}
+
+// validateSeccompProfile allows an unset seccomp profile (RuntimeDefault applies), a RuntimeDefault or
+// Unconfined profile, or a Localhost profile with the path of the profile on the node
+func validateSeccompProfile(profile *corev1.SeccompProfile) error {
+	if profile == nil {
+		return nil
+	}
+	switch profile.Type {
+	case corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined:
+		if profile.LocalhostProfile != nil {
+			return fmt.Errorf("localhostProfile must only be set for type %q", corev1.SeccompProfileTypeLocalhost)
+		}
+	case corev1.SeccompProfileTypeLocalhost:
+		if profile.LocalhostProfile == nil || *profile.LocalhostProfile == "" {
+			return fmt.Errorf("localhostProfile must be set for type %q", corev1.SeccompProfileTypeLocalhost)
+		}
+	default:
+		return fmt.Errorf("unsupported type %q: supported values are %q, %q and %q", profile.Type,
+			corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeLocalhost, corev1.SeccompProfileTypeUnconfined)
+	}
+	return nil
+}
+
+// validateBusyboxImage allows an unset busybox image (controller-wide busybox image applies) or a
+// non-blank, valid image reference
+func validateBusyboxImage(image string) error {
+	if image == "" {
+		return nil
+	}
+	if strings.TrimSpace(image) == "" {
+		return fmt.Errorf("image name is blank")
+	}
+	_, err := validateImageReference(image)
+	return err
+}
+
+// validateCriClientImages allows unset cri client images (controller-wide cri client image applies), or
+// valid image references keyed by a supported container runtime
+func validateCriClientImages(image string, imagesByRuntime map[string]string) error {
+	if image != "" {
+		if _, err := validateImageReference(image); err != nil {
+			return fmt.Errorf("criClientImage %q: %v", image, err)
+		}
+	}
+	for runtime, image := range imagesByRuntime {
+		if parsed, err := images.ParseContainerRuntime(runtime); err != nil || parsed == "" || parsed != runtime {
+			return fmt.Errorf("unsupported container runtime %q", runtime)
+		}
+		if _, err := validateImageReference(image); err != nil {
+			return fmt.Errorf("image %q of container runtime %s: %v", image, runtime, err)
+		}
+	}
+	return nil
+}
+
+// validateJobLabels allows labels with a valid key and value that are not set by the controller on the
+// pods of image pull/delete jobs
+func validateJobLabels(labels map[string]string) error {
+	if errs := metav1validation.ValidateLabels(labels, field.NewPath("jobLabels")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	for key := range labels {
+		if images.IsReservedJobLabel(key) {
+			return fmt.Errorf("label %q is reserved for the controller", key)
+		}
+	}
+	return nil
+}
+
+// validatePullBandwidth checks that the bandwidth is within the bounds accepted by the kubelet
+func validatePullBandwidth(bandwidth *resource.Quantity) error {
+	if bandwidth == nil {
+		return nil
+	}
+	if bandwidth.Cmp(images.MinPullBandwidth) < 0 || bandwidth.Cmp(images.MaxPullBandwidth) > 0 {
+		return fmt.Errorf("%s is not between %s and %s", bandwidth.String(), images.MinPullBandwidth.String(), images.MaxPullBandwidth.String())
+	}
+	return nil
+}
+
+// validateJobAnnotations allows annotations with a valid key, not exceeding the total size of annotations
+func validateJobAnnotations(annotations map[string]string) error {
+	if errs := apivalidation.ValidateAnnotations(annotations, field.NewPath("jobAnnotations")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if _, ok := annotations[images.ImageAnnotationKey]; ok {
+		return fmt.Errorf("annotation %q is reserved for the controller", images.ImageAnnotationKey)
+	}
+	return nil
+}
+
+// validateExcludedNodeSelector allows label selectors with valid keys, operators and values
+func validateExcludedNodeSelector(selector *metav1.LabelSelector) error {
+	if errs := metav1validation.ValidateLabelSelector(selector, field.NewPath("excludedNodeSelector")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return nil
+}
+
+// maxJobDNSNameservers and maxJobDNSSearches are the limits of the kubelet on the dnsConfig of a pod
+const (
+	maxJobDNSNameservers = 3
+	maxJobDNSSearches    = 32
+)
+
+// validateJobDNS allows a supported dnsPolicy, and a dnsConfig of valid nameservers and search domains
+// within the limits of the kubelet. The None dnsPolicy requires a nameserver in the dnsConfig.
+func validateJobDNS(dnsPolicy corev1.DNSPolicy, dnsConfig *corev1.PodDNSConfig) error {
+	switch dnsPolicy {
+	case "", corev1.DNSClusterFirst, corev1.DNSClusterFirstWithHostNet, corev1.DNSDefault, corev1.DNSNone:
+	default:
+		return fmt.Errorf("unsupported jobDNSPolicy %q", dnsPolicy)
+	}
+	if dnsPolicy == corev1.DNSNone && (dnsConfig == nil || len(dnsConfig.Nameservers) == 0) {
+		return fmt.Errorf("jobDNSConfig must have a nameserver when jobDNSPolicy is %s", corev1.DNSNone)
+	}
+	if dnsConfig == nil {
+		return nil
+	}
+	if len(dnsConfig.Nameservers) > maxJobDNSNameservers {
+		return fmt.Errorf("jobDNSConfig must not have more than %d nameservers", maxJobDNSNameservers)
+	}
+	for _, nameserver := range dnsConfig.Nameservers {
+		if net.ParseIP(nameserver) == nil {
+			return fmt.Errorf("jobDNSConfig nameserver %q is not a valid IP address", nameserver)
+		}
+	}
+	if len(dnsConfig.Searches) > maxJobDNSSearches {
+		return fmt.Errorf("jobDNSConfig must not have more than %d search domains", maxJobDNSSearches)
+	}
+	for _, search := range dnsConfig.Searches {
+		if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(search, ".")); len(errs) > 0 {
+			return fmt.Errorf("jobDNSConfig search domain %q: %s", search, strings.Join(errs, ", "))
+		}
+	}
+	for _, option := range dnsConfig.Options {
+		if option.Name == "" {
+			return fmt.Errorf("jobDNSConfig option must have a name")
+		}
+	}
+	return nil
+}
+
+// validateImageListFrom allows an image list read from a ConfigMap of a valid name and key.
+// The images of the ConfigMap are validated by the controller when it reads them.
+func validateImageListFrom(source *fledgedv1alpha3.ImageListSource) error {
+	if source == nil {
+		return nil
+	}
+	if source.ConfigMapRef == nil {
+		return fmt.Errorf("configMapRef is required")
+	}
+	if errs := validation.IsDNS1123Subdomain(source.ConfigMapRef.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid configMapRef.name %q: %s", source.ConfigMapRef.Name, strings.Join(errs, ", "))
+	}
+	if source.ConfigMapRef.Key != "" {
+		if errs := validation.IsConfigMapKey(source.ConfigMapRef.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid configMapRef.key %q: %s", source.ConfigMapRef.Key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// validateWorkloadRef allows a reference to a Deployment or DaemonSet of a valid name
+func validateWorkloadRef(ref *fledgedv1alpha3.WorkloadReference) error {
+	if ref == nil {
+		return nil
+	}
+	if ref.Kind != fledgedv1alpha3.WorkloadKindDeployment && ref.Kind != fledgedv1alpha3.WorkloadKindDaemonSet {
+		return fmt.Errorf("kind %q is not supported, must be %s or %s", ref.Kind,
+			fledgedv1alpha3.WorkloadKindDeployment, fledgedv1alpha3.WorkloadKindDaemonSet)
+	}
+	if errs := validation.IsDNS1123Subdomain(ref.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q: %s", ref.Name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateRegistryCAs allows CA bundles of distinct registries, given by their host and port if any, each
+// read from the key of either a ConfigMap or a Secret
+func validateRegistryCAs(registryCAs []fledgedv1alpha3.RegistryCA) error {
+	registries := map[string]bool{}
+	for i, ca := range registryCAs {
+		named, err := reference.ParseNamed(ca.Registry + "/image")
+		if ca.Registry == "" || err != nil || reference.Domain(named) != ca.Registry {
+			return fmt.Errorf("registryCAs[%d]: invalid registry %q: must be the host of the registry and its port if any", i, ca.Registry)
+		}
+		if registries[ca.Registry] {
+			return fmt.Errorf("registryCAs[%d]: duplicate registry %q", i, ca.Registry)
+		}
+		registries[ca.Registry] = true
+		var name, key string
+		switch {
+		case ca.ConfigMapRef != nil && ca.SecretRef != nil:
+			return fmt.Errorf("registryCAs[%d]: only one of configMapRef and secretRef can be set", i)
+		case ca.ConfigMapRef != nil:
+			name, key = ca.ConfigMapRef.Name, ca.ConfigMapRef.Key
+		case ca.SecretRef != nil:
+			name, key = ca.SecretRef.Name, ca.SecretRef.Key
+		default:
+			return fmt.Errorf("registryCAs[%d]: one of configMapRef and secretRef is required", i)
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("registryCAs[%d]: invalid name %q: %s", i, name, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("registryCAs[%d]: invalid key %q: %s", i, key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// validatePurgeImage allows a purge-image annotation naming an image in the cacheSpec. An annotation
+// left unchanged is not validated again, so that it does not block the removal of the image from the cacheSpec.
+func validatePurgeImage(oldImageCache, imageCache *fledgedv1alpha3.ImageCache) error {
+	image, ok := imageCache.Annotations[fledgedv1alpha3.ImageCachePurgeImageAnnotationKey]
+	if !ok {
+		return nil
+	}
+	if oldImage, ok := oldImageCache.Annotations[fledgedv1alpha3.ImageCachePurgeImageAnnotationKey]; ok && oldImage == image {
+		return nil
+	}
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, cached := range i.Images {
+			if images.SameImage(cached.Name, image) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("image %q is not in the cacheSpec", image)
+}
+
 func toV1AdmissionResponse(err error) *v1.AdmissionResponse {
 	return &v1.AdmissionResponse{
 		Result: &metav1.Status{
@@ -0,0 +1,1040 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	fledgedv1alpha3 "github.com/lcouds/kube-fledged/pkg/apis/kubefledged/v1alpha3"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newAdmissionReview(t *testing.T, operation v1.Operation, imageCache, oldImageCache *fledgedv1alpha3.ImageCache) v1.AdmissionReview {
+	ar := v1.AdmissionReview{
+		Request: &v1.AdmissionRequest{
+			Operation: operation,
+		},
+	}
+	raw, err := json.Marshal(imageCache)
+	if err != nil {
+		t.Fatalf("Error marshalling imagecache: %v", err)
+	}
+	ar.Request.Object = runtime.RawExtension{Raw: raw}
+	if oldImageCache != nil {
+		oldraw, err := json.Marshal(oldImageCache)
+		if err != nil {
+			t.Fatalf("Error marshalling old imagecache: %v", err)
+		}
+		ar.Request.OldObject = runtime.RawExtension{Raw: oldraw}
+	}
+	return ar
+}
+
+func newImageCache(images ...fledgedv1alpha3.Image) *fledgedv1alpha3.ImageCache {
+	return &fledgedv1alpha3.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha3.ImageCacheSpec{
+			CacheSpec: []fledgedv1alpha3.CacheSpecImages{
+				{
+					Images: images,
+				},
+			},
+		},
+	}
+}
+
+func TestValidateImageCache(t *testing.T) {
+	tests := []struct {
+		name              string
+		imageCache        *fledgedv1alpha3.ImageCache
+		expectAllowed     bool
+		expectedErrString string
+	}{
+		{
+			name:          "#1: Valid imagecache",
+			imageCache:    newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}),
+			expectAllowed: true,
+		},
+		{
+			name:              "#2: No images in image list",
+			imageCache:        newImageCache(),
+			expectAllowed:     false,
+			expectedErrString: "No images specified within image list",
+		},
+		{
+			name:              "#3: Duplicate images in image list",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}, fledgedv1alpha3.Image{Name: "nginx:1.25", ForceFullCache: true}),
+			expectAllowed:     false,
+			expectedErrString: "Duplicate image names within image list",
+		},
+		{
+			name: "#4: Valid image pull policies",
+			imageCache: newImageCache(
+				fledgedv1alpha3.Image{Name: "nginx:1.23", ImagePullPolicy: "Always"},
+				fledgedv1alpha3.Image{Name: "nginx:1.24", ImagePullPolicy: "IfNotPresent"},
+				fledgedv1alpha3.Image{Name: "nginx:1.25", ImagePullPolicy: "Never"},
+			),
+			expectAllowed: true,
+		},
+		{
+			name:              "#5: Invalid image pull policy",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25", ImagePullPolicy: "Sometimes"}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid image pull policy for image nginx:1.25",
+		},
+		{
+			name: "#6: Valid job deadlines",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImagePullJobDeadline = &metav1.Duration{Duration: 2 * time.Hour}
+				imageCache.Spec.ImageDeleteJobDeadline = &metav1.Duration{Duration: 10 * time.Minute}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#7: Invalid image delete job deadline",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImageDeleteJobDeadline = &metav1.Duration{Duration: -time.Minute}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid imageDeleteJobDeadline",
+		},
+		{
+			name: "#8: Job resource request greater than limit",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobResources = &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+				}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobResources",
+		},
+		{
+			name: "#9: Valid containerd namespace",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ContainerdNamespace = "buildkit"
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#10: Invalid containerd namespace",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ContainerdNamespace = "build kit"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid containerdNamespace",
+		},
+		{
+			name: "#11: Valid refresh schedule",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RefreshSchedule = "0 2 * * *"
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#12: Invalid refresh schedule",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RefreshSchedule = "0 25 * * *"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid refreshSchedule",
+		},
+		{
+			name: "#13: Valid refresh time zone",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RefreshSchedule = "0 2 * * *"
+				imageCache.Spec.RefreshTimeZone = "America/New_York"
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#14: Invalid refresh time zone",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RefreshSchedule = "0 2 * * *"
+				imageCache.Spec.RefreshTimeZone = "America/Gotham"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid refreshTimeZone",
+		},
+		{
+			name: "#15: Valid rollout strategy",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailable := intstr.FromString("25%")
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{MaxUnavailable: &maxUnavailable}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#16: Invalid maxUnavailable percentage",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailable := intstr.FromString("quarter")
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{MaxUnavailable: &maxUnavailable}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy",
+		},
+		{
+			name: "#17: Zero maxUnavailable",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailable := intstr.FromInt(0)
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{MaxUnavailable: &maxUnavailable}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy",
+		},
+		{
+			name: "#18: Valid image references",
+			imageCache: newImageCache(
+				fledgedv1alpha3.Image{Name: "nginx"},
+				fledgedv1alpha3.Image{Name: "registry.example.com:5000/team/app:2.0"},
+				fledgedv1alpha3.Image{Name: "quay.io/coreos/etcd@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"},
+				fledgedv1alpha3.Image{Name: "gcr.io/pause:3.2@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"},
+			),
+			expectAllowed: true,
+		},
+		{
+			name:              "#19: Malformed tag",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}, fledgedv1alpha3.Image{Name: "nginx::"}),
+			expectAllowed:     false,
+			expectedErrString: `Invalid image reference "nginx::" in cacheSpec[0].images[1]`,
+		},
+		{
+			name:              "#20: Whitespace in image reference",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "my registry/img"}),
+			expectAllowed:     false,
+			expectedErrString: `Invalid image reference "my registry/img" in cacheSpec[0].images[0]`,
+		},
+		{
+			name:              "#21: Uppercase repository",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "Nginx:1.25"}),
+			expectAllowed:     false,
+			expectedErrString: `Invalid image reference "Nginx:1.25" in cacheSpec[0].images[0]`,
+		},
+		{
+			name:              "#22: Empty image name",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: ""}),
+			expectAllowed:     false,
+			expectedErrString: `Invalid image reference "" in cacheSpec[0].images[0]`,
+		},
+		{
+			name:              "#23: Duplicate images in different forms",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx"}, fledgedv1alpha3.Image{Name: "docker.io/library/nginx:latest"}),
+			expectAllowed:     false,
+			expectedErrString: "Duplicate image names within image list: docker.io/library/nginx:latest (cacheSpec[0].images[0] and cacheSpec[0].images[1])",
+		},
+		{
+			name: "#24: Same image in different image lists",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.CacheSpec = append(imageCache.Spec.CacheSpec, fledgedv1alpha3.CacheSpecImages{
+					Images:       []fledgedv1alpha3.Image{{Name: "nginx:1.25"}},
+					NodeSelector: map[string]string{"tier": "backend"},
+				})
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#25: Valid busybox image",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.BusyboxImage = "registry.internal/mirror/busybox:1.35.0"
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#26: Blank busybox image",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.BusyboxImage = " "
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid busyboxImage: image name is blank",
+		},
+		{
+			name: "#27: Malformed busybox image",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.BusyboxImage = "registry.internal/Busybox:1.35.0"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid busyboxImage",
+		},
+		{
+			name: "#28: Valid cri client images",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.CriClientImage = "registry.internal/mirror/cri-client:v0.10.0"
+				imageCache.Spec.CriClientImages = map[string]string{"crio": "registry.internal/mirror/crictl:v1.25.0"}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#29: Malformed cri client image",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.CriClientImage = "registry.internal/mirror/cri-client:v0.10.0 "
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid criClientImages: criClientImage",
+		},
+		{
+			name: "#30: Cri client image of an unsupported container runtime",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.CriClientImages = map[string]string{"rkt": "registry.internal/mirror/rkt:v1.30.0"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid criClientImages: unsupported container runtime \"rkt\"",
+		},
+		{
+			name: "#31: Malformed cri client image of a container runtime",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.CriClientImages = map[string]string{"containerd": ""}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid criClientImages: image \"\" of container runtime containerd",
+		},
+		{
+			name: "#32: Localhost seccomp profile",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				localhostProfile := "profiles/kubefledged.json"
+				imageCache.Spec.JobSeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &localhostProfile}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#33: Localhost seccomp profile without a path",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobSeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobSeccompProfile: localhostProfile must be set",
+		},
+		{
+			name: "#34: Unsupported seccomp profile type",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobSeccompProfile = &corev1.SeccompProfile{Type: "Default"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobSeccompProfile: unsupported type",
+		},
+		{
+			name: "#35: Image pull deadline less than 1s",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImagePullDeadline = &metav1.Duration{Duration: 500 * time.Millisecond}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid imagePullDeadline: deadline 500ms is less than 1s",
+		},
+		{
+			name: "#36: Negative image pull timeout retries",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImagePullDeadline = &metav1.Duration{Duration: 10 * time.Minute}
+				imageCache.Spec.ImagePullTimeoutRetries = -1
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid imagePullTimeoutRetries: -1 is negative",
+		},
+		{
+			name: "#37: Job labels and annotations",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobLabels = map[string]string{"cost-center": "cc-1234", "example.com/team": "web"}
+				imageCache.Spec.JobAnnotations = map[string]string{"sidecar.istio.io/inject": "false"}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#38: Invalid job label value",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobLabels = map[string]string{"team": "web team"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobLabels: jobLabels: Invalid value: \"web team\"",
+		},
+		{
+			name: "#39: Reserved job label",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobLabels = map[string]string{"imagecache": "bar"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobLabels: label \"imagecache\" is reserved for the controller",
+		},
+		{
+			name: "#40: Invalid job annotation key",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobAnnotations = map[string]string{"not/a/key": "true"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid jobAnnotations: jobAnnotations: Invalid value: \"not/a/key\"",
+		},
+		{
+			name: "#41: Excluded nodes",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ExcludedNodeNames = []string{"node1"}
+				imageCache.Spec.ExcludedNodeSelector = &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "node-role.kubernetes.io/control-plane", Operator: metav1.LabelSelectorOpExists},
+					},
+				}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#42: Invalid excluded node selector operator",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ExcludedNodeSelector = &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "pool", Operator: metav1.LabelSelectorOpIn},
+					},
+				}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid excludedNodeSelector: excludedNodeSelector.matchExpressions[0].values: Required value",
+		},
+		{
+			name: "#43: Image list read from a ConfigMap",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImageListFrom = &fledgedv1alpha3.ImageListSource{
+					ConfigMapRef: &fledgedv1alpha3.ConfigMapImageListReference{Name: "images", Key: "images.txt"},
+				}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#44: Image list without a ConfigMap",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImageListFrom = &fledgedv1alpha3.ImageListSource{NodeSelector: map[string]string{"pool": "gpu"}}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid imageListFrom: configMapRef is required",
+		},
+		{
+			name: "#45: Image list of an invalid ConfigMap key",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.ImageListFrom = &fledgedv1alpha3.ImageListSource{
+					ConfigMapRef: &fledgedv1alpha3.ConfigMapImageListReference{Name: "images", Key: "images/txt"},
+				}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid imageListFrom: invalid configMapRef.key \"images/txt\"",
+		},
+		{
+			name: "#46: Job DNS resolving through an internal resolver",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "registry.corp.internal/app:v1"})
+				imageCache.Spec.JobDNSPolicy = corev1.DNSNone
+				imageCache.Spec.JobDNSConfig = &corev1.PodDNSConfig{
+					Nameservers: []string{"10.0.0.53", "fd00::53"},
+					Searches:    []string{"corp.internal."},
+					Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: func() *string { v := "1"; return &v }()}},
+				}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#47: Job DNS policy None without nameservers",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobDNSPolicy = corev1.DNSNone
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid job DNS settings: jobDNSConfig must have a nameserver when jobDNSPolicy is None",
+		},
+		{
+			name: "#48: Unsupported job DNS policy",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobDNSPolicy = "ClusterOnly"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid job DNS settings: unsupported jobDNSPolicy \"ClusterOnly\"",
+		},
+		{
+			name: "#49: Job DNS nameserver not an IP address",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobDNSConfig = &corev1.PodDNSConfig{Nameservers: []string{"dns.corp.internal"}}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid job DNS settings: jobDNSConfig nameserver \"dns.corp.internal\" is not a valid IP address",
+		},
+		{
+			name: "#50: Job DNS search domain invalid",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.JobDNSConfig = &corev1.PodDNSConfig{Searches: []string{"corp_internal"}}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid job DNS settings: jobDNSConfig search domain \"corp_internal\"",
+		},
+		{
+			name: "#51: CA bundles of registries",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "registry.corp.internal:5000/app:v1"})
+				imageCache.Spec.RegistryCAs = []fledgedv1alpha3.RegistryCA{
+					{Registry: "registry.corp.internal:5000", ConfigMapRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "corp-ca"}, Key: "ca.crt"}},
+					{Registry: "harbor.corp.internal", SecretRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "harbor-ca"}, Key: "ca.pem"}},
+				}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#52: CA bundle of a registry given with a path",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RegistryCAs = []fledgedv1alpha3.RegistryCA{
+					{Registry: "registry.corp.internal/team", ConfigMapRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "corp-ca"}, Key: "ca.crt"}},
+				}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid registryCAs: registryCAs[0]: invalid registry \"registry.corp.internal/team\"",
+		},
+		{
+			name: "#53: CA bundle of a registry without a ConfigMap or Secret",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RegistryCAs = []fledgedv1alpha3.RegistryCA{{Registry: "registry.corp.internal"}}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid registryCAs: registryCAs[0]: one of configMapRef and secretRef is required",
+		},
+		{
+			name: "#54: CA bundles of the same registry",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				ca := fledgedv1alpha3.RegistryCA{Registry: "registry.corp.internal", ConfigMapRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "corp-ca"}, Key: "ca.crt"}}
+				imageCache.Spec.RegistryCAs = []fledgedv1alpha3.RegistryCA{ca, ca}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid registryCAs: registryCAs[1]: duplicate registry \"registry.corp.internal\"",
+		},
+		{
+			name: "#55: Valid artifact types",
+			imageCache: newImageCache(
+				fledgedv1alpha3.Image{Name: "nginx:1.25", ArtifactType: fledgedv1alpha3.ArtifactTypeImage},
+				fledgedv1alpha3.Image{Name: "ghcr.io/org/wasm/filter:v1", ArtifactType: fledgedv1alpha3.ArtifactTypeWasm},
+				fledgedv1alpha3.Image{Name: "ghcr.io/org/charts/app:1.0.0", ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact, ImagePullPolicy: "Always"},
+			),
+			expectAllowed: true,
+		},
+		{
+			name:              "#56: Invalid artifact type",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/charts/app:1.0.0", ArtifactType: "HelmChart"}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid artifact type for image ghcr.io/org/charts/app:1.0.0: unsupported value \"HelmChart\"",
+		},
+		{
+			name:              "#57: Cache paths of a Wasm image",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/wasm/filter:v1", ArtifactType: fledgedv1alpha3.ArtifactTypeWasm, CachePaths: []string{"/"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid artifact type for image ghcr.io/org/wasm/filter:v1: forceFullCache and cachePaths are not supported for artifact type Wasm",
+		},
+		{
+			name:              "#58: Artifact with image pull policy Never",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/charts/app:1.0.0", ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact, ImagePullPolicy: "Never"}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid artifact type for image ghcr.io/org/charts/app:1.0.0: image pull policy Never is not supported for artifact type Artifact",
+		},
+		{
+			name: "#59: Workload reference to a deployment",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.WorkloadRef = &fledgedv1alpha3.WorkloadReference{Kind: fledgedv1alpha3.WorkloadKindDeployment, Name: "web"}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#60: Workload reference to an unsupported kind",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.WorkloadRef = &fledgedv1alpha3.WorkloadReference{Kind: "StatefulSet", Name: "db"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid workloadRef: kind \"StatefulSet\" is not supported",
+		},
+		{
+			name: "#61: Workload reference without a name",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.WorkloadRef = &fledgedv1alpha3.WorkloadReference{Kind: fledgedv1alpha3.WorkloadKindDaemonSet}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid workloadRef: invalid name \"\"",
+		},
+		{
+			name: "#62: Pull bandwidth limit",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				bandwidth := resource.MustParse("10M")
+				imageCache.Spec.PullBandwidth = &bandwidth
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#63: Pull bandwidth limit below the minimum of the kubelet",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				bandwidth := resource.MustParse("100")
+				imageCache.Spec.PullBandwidth = &bandwidth
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid pullBandwidth: 100 is not between 1k and 1P",
+		},
+		{
+			name: "#64: Failed pull retries and partial failure threshold",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.FailedPullRetries = 2
+				imageCache.Spec.PartialFailureThresholdPercent = 10
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#65: Negative failed pull retries",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.FailedPullRetries = -1
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid failedPullRetries: -1 is negative",
+		},
+		{
+			name: "#66: Partial failure threshold above 100 percent",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.PartialFailureThresholdPercent = 101
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid partialFailureThresholdPercent: 101 is not between 0 and 100",
+		},
+		{
+			name: "#67: Warm command",
+			imageCache: newImageCache(fledgedv1alpha3.Image{Name: "example.com/llm:v1",
+				WarmCommand: []string{"python", "-c", "import model; model.load()"}}),
+			expectAllowed: true,
+		},
+		{
+			name: "#68: Warm command with cache paths",
+			imageCache: newImageCache(fledgedv1alpha3.Image{Name: "example.com/llm:v1",
+				WarmCommand: []string{"python", "-c", "import model; model.load()"}, CachePaths: []string{"/models/"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid warm command for image example.com/llm:v1: warmCommand cannot be combined with forceFullCache or cachePaths",
+		},
+		{
+			name: "#69: Warm command of an artifact",
+			imageCache: newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/charts/app:1.0.0",
+				ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact, WarmCommand: []string{"cat", "/chart.yaml"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid warm command for image ghcr.io/org/charts/app:1.0.0: warmCommand is not supported for artifact type Artifact",
+		},
+		{
+			name:              "#70: Warm command without executable",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "example.com/llm:v1", WarmCommand: []string{" ", "-c"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid warm command for image example.com/llm:v1: the executable of the warm command is empty",
+		},
+		{
+			name: "#71: Snapshotter",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/wasm/filter:v1", ArtifactType: fledgedv1alpha3.ArtifactTypeWasm})
+				imageCache.Spec.Snapshotter = "stargz"
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#72: Invalid snapshotter",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/org/wasm/filter:v1", ArtifactType: fledgedv1alpha3.ArtifactTypeWasm})
+				imageCache.Spec.Snapshotter = "stargz; reboot"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid snapshotter: \"stargz; reboot\" is not a valid containerd snapshotter name",
+		},
+		{
+			name: "#73: Abort failure policy",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.FailurePolicy = fledgedv1alpha3.FailurePolicyAbort
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#74: Unsupported failure policy",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.FailurePolicy = "Ignore"
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid failurePolicy: unsupported value \"Ignore\": supported values are \"Continue\" and \"Abort\"",
+		},
+		{
+			name: "#75: Abort failure policy with failed pull retries",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.FailurePolicy = fledgedv1alpha3.FailurePolicyAbort
+				imageCache.Spec.FailedPullRetries = 2
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid failurePolicy: failedPullRetries is not supported with failure policy Abort",
+		},
+		{
+			name:          "#76: Image with aliases",
+			imageCache:    newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25", Aliases: []string{"registry.example.com/nginx:1.25", "nginx:stable"}}),
+			expectAllowed: true,
+		},
+		{
+			name:              "#77: Digest alias",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25", Aliases: []string{"registry.example.com/nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid aliases for image nginx:1.25: alias \"registry.example.com/nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31\" is a digest reference",
+		},
+		{
+			name:              "#78: Alias naming the image itself",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25", Aliases: []string{"docker.io/library/nginx:1.25"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid aliases for image nginx:1.25: alias \"docker.io/library/nginx:1.25\" duplicates the image or another alias",
+		},
+		{
+			name:              "#79: Invalid alias",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25", Aliases: []string{"Nginx:1.25"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid aliases for image nginx:1.25: invalid alias \"Nginx:1.25\"",
+		},
+		{
+			name:              "#80: Aliases of an OCI artifact",
+			imageCache:        newImageCache(fledgedv1alpha3.Image{Name: "ghcr.io/foo/chart:1.0", ArtifactType: fledgedv1alpha3.ArtifactTypeArtifact, Aliases: []string{"ghcr.io/bar/chart:1.0"}}),
+			expectAllowed:     false,
+			expectedErrString: "Invalid aliases for image ghcr.io/foo/chart:1.0: aliases are not supported for artifact type Artifact",
+		},
+		{
+			name: "#81: Valid rollout strategy per zone",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailablePerGroup := intstr.FromString("50%")
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone",
+					MaxUnavailablePerGroup: &maxUnavailablePerGroup}
+				return imageCache
+			}(),
+			expectAllowed: true,
+		},
+		{
+			name: "#82: Invalid maxUnavailablePerGroup percentage",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailablePerGroup := intstr.FromString("abc%")
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone",
+					MaxUnavailablePerGroup: &maxUnavailablePerGroup}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy: invalid maxUnavailablePerGroup",
+		},
+		{
+			name: "#83: Zero maxUnavailablePerGroup",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailablePerGroup := intstr.FromInt(0)
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone",
+					MaxUnavailablePerGroup: &maxUnavailablePerGroup}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy: maxUnavailablePerGroup 0 must be greater than zero",
+		},
+		{
+			name: "#84: maxUnavailablePerGroup without refreshGroupByLabel",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailablePerGroup := intstr.FromInt(1)
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{MaxUnavailablePerGroup: &maxUnavailablePerGroup}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy: maxUnavailablePerGroup requires refreshGroupByLabel",
+		},
+		{
+			name: "#85: Invalid refreshGroupByLabel",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				maxUnavailablePerGroup := intstr.FromInt(1)
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology zone",
+					MaxUnavailablePerGroup: &maxUnavailablePerGroup}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy: refreshGroupByLabel \"topology zone\" is not a valid label key",
+		},
+		{
+			name: "#86: refreshGroupByLabel without maxUnavailablePerGroup",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"})
+				imageCache.Spec.RolloutStrategy = &fledgedv1alpha3.RolloutStrategy{RefreshGroupByLabel: "topology.kubernetes.io/zone"}
+				return imageCache
+			}(),
+			expectAllowed:     false,
+			expectedErrString: "Invalid rolloutStrategy: refreshGroupByLabel requires maxUnavailablePerGroup",
+		},
+	}
+	for _, test := range tests {
+		resp := ValidateImageCache(newAdmissionReview(t, v1.Create, test.imageCache, nil))
+		if resp.Allowed != test.expectAllowed {
+			t.Errorf("Test: %s failed: expectedAllowed=%t, actualAllowed=%t", test.name, test.expectAllowed, resp.Allowed)
+		}
+		if !test.expectAllowed && (resp.Result == nil || !strings.HasPrefix(resp.Result.Message, test.expectedErrString)) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualResult=%+v", test.name, test.expectedErrString, resp.Result)
+		}
+	}
+}
+
+func TestValidateImageCachePurgeImage(t *testing.T) {
+	purgeImage := func(imageCache *fledgedv1alpha3.ImageCache, image string) *fledgedv1alpha3.ImageCache {
+		imageCache.Annotations = map[string]string{fledgedv1alpha3.ImageCachePurgeImageAnnotationKey: image}
+		return imageCache
+	}
+	tests := []struct {
+		name              string
+		oldImageCache     *fledgedv1alpha3.ImageCache
+		imageCache        *fledgedv1alpha3.ImageCache
+		expectAllowed     bool
+		expectedErrString string
+	}{
+		{
+			name:          "#1: Image in the cacheSpec",
+			oldImageCache: newImageCache(fledgedv1alpha3.Image{Name: "docker.io/library/nginx:1.25"}),
+			imageCache:    purgeImage(newImageCache(fledgedv1alpha3.Image{Name: "docker.io/library/nginx:1.25"}), "nginx:1.25"),
+			expectAllowed: true,
+		},
+		{
+			name:              "#2: Image not in the cacheSpec",
+			oldImageCache:     newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}),
+			imageCache:        purgeImage(newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}), "redis:7"),
+			expectAllowed:     false,
+			expectedErrString: "Invalid kubefledged.io/purge-image annotation: image \"redis:7\" is not in the cacheSpec",
+		},
+		{
+			name: "#3: Image removed from the cacheSpec with the annotation unchanged",
+			oldImageCache: purgeImage(newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}, fledgedv1alpha3.Image{Name: "redis:7"}),
+				"redis:7"),
+			imageCache:    purgeImage(newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}), "redis:7"),
+			expectAllowed: true,
+		},
+	}
+	for _, test := range tests {
+		resp := ValidateImageCache(newAdmissionReview(t, v1.Update, test.imageCache, test.oldImageCache))
+		if resp.Allowed != test.expectAllowed {
+			t.Errorf("Test: %s failed: expectedAllowed=%t, actualAllowed=%t", test.name, test.expectAllowed, resp.Allowed)
+		}
+		if !test.expectAllowed && (resp.Result == nil || resp.Result.Message != test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualResult=%+v", test.name, test.expectedErrString, resp.Result)
+		}
+	}
+}
+
+func TestMutateImageCache(t *testing.T) {
+	tests := []struct {
+		name                string
+		imageCache          *fledgedv1alpha3.ImageCache
+		expectPatch         bool
+		expectedImages      []string
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "#1: Bare name is canonicalized",
+			imageCache:          newImageCache(fledgedv1alpha3.Image{Name: "nginx"}),
+			expectPatch:         true,
+			expectedImages:      []string{"docker.io/library/nginx:latest"},
+			expectedAnnotations: map[string]string{OriginalImageNamesAnnotationKey: `{"docker.io/library/nginx:latest":"nginx"}`},
+		},
+		{
+			name: "#2: Canonical and digest references are untouched",
+			imageCache: newImageCache(
+				fledgedv1alpha3.Image{Name: "docker.io/library/nginx:1.25"},
+				fledgedv1alpha3.Image{Name: "nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"},
+			),
+			expectPatch: false,
+			expectedImages: []string{
+				"docker.io/library/nginx:1.25",
+				"nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+			},
+		},
+		{
+			name: "#3: Existing annotations are kept",
+			imageCache: func() *fledgedv1alpha3.ImageCache {
+				imageCache := newImageCache(fledgedv1alpha3.Image{Name: "nginx:1.25"}, fledgedv1alpha3.Image{Name: "quay.io/coreos/etcd"})
+				imageCache.Annotations = map[string]string{
+					"team":                          "web",
+					OriginalImageNamesAnnotationKey: `{"docker.io/library/redis:latest":"redis","quay.io/coreos/etcd:latest":"etcd"}`,
+				}
+				return imageCache
+			}(),
+			expectPatch:    true,
+			expectedImages: []string{"docker.io/library/nginx:1.25", "quay.io/coreos/etcd:latest"},
+			expectedAnnotations: map[string]string{
+				"team":                          "web",
+				OriginalImageNamesAnnotationKey: `{"docker.io/library/nginx:1.25":"nginx:1.25","quay.io/coreos/etcd:latest":"quay.io/coreos/etcd"}`,
+			},
+		},
+		{
+			name:           "#4: Invalid reference is left to the validating webhook",
+			imageCache:     newImageCache(fledgedv1alpha3.Image{Name: "my registry/img"}),
+			expectPatch:    false,
+			expectedImages: []string{"my registry/img"},
+		},
+	}
+	for _, test := range tests {
+		ar := newAdmissionReview(t, v1.Create, test.imageCache, nil)
+		resp := MutateImageCache(ar)
+		if !resp.Allowed {
+			t.Errorf("Test: %s failed: expectedAllowed=true, actualAllowed=false, result=%+v", test.name, resp.Result)
+			continue
+		}
+		if (len(resp.Patch) != 0) != test.expectPatch {
+			t.Errorf("Test: %s failed: expectPatch=%t, actualPatch=%s", test.name, test.expectPatch, string(resp.Patch))
+			continue
+		}
+		stored := ar.Request.Object.Raw
+		if test.expectPatch {
+			if resp.PatchType == nil || *resp.PatchType != v1.PatchTypeJSONPatch {
+				t.Errorf("Test: %s failed: expectedPatchType=%s, actualPatchType=%v", test.name, v1.PatchTypeJSONPatch, resp.PatchType)
+			}
+			patch, err := jsonpatch.DecodePatch(resp.Patch)
+			if err != nil {
+				t.Errorf("Test: %s failed: error decoding patch: %v", test.name, err)
+				continue
+			}
+			if stored, err = patch.Apply(stored); err != nil {
+				t.Errorf("Test: %s failed: error applying patch: %v", test.name, err)
+				continue
+			}
+		}
+		var imageCache fledgedv1alpha3.ImageCache
+		if err := json.Unmarshal(stored, &imageCache); err != nil {
+			t.Errorf("Test: %s failed: error unmarshalling patched imagecache: %v", test.name, err)
+			continue
+		}
+		actualImages := []string{}
+		for _, i := range imageCache.Spec.CacheSpec[0].Images {
+			actualImages = append(actualImages, i.Name)
+		}
+		if !reflect.DeepEqual(actualImages, test.expectedImages) {
+			t.Errorf("Test: %s failed: expectedImages=%v, actualImages=%v", test.name, test.expectedImages, actualImages)
+		}
+		if test.expectPatch && !reflect.DeepEqual(imageCache.Annotations, test.expectedAnnotations) {
+			t.Errorf("Test: %s failed: expectedAnnotations=%v, actualAnnotations=%v", test.name, test.expectedAnnotations, imageCache.Annotations)
+		}
+	}
+}